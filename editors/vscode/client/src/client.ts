@@ -90,7 +90,15 @@ export async function buildLanguageClient(
       transport: TransportKind.pipe,
     } as ServerOptions,
     {
-      initializationOptions: {},
+      initializationOptions: {
+        textDocumentSync: vscode.workspace
+          .getConfiguration("protols")
+          .get("textDocumentSync"),
+        remote: vscode.workspace.getConfiguration("protols").get("remote"),
+        sandbox:
+          !vscode.workspace.isTrusted ||
+          vscode.workspace.getConfiguration("protols").get("sandbox"),
+      },
       documentSelector,
       synchronize: {
         fileEvents: vscode.workspace.createFileSystemWatcher("**/*.proto"),
@@ -15,8 +15,31 @@ export async function activate(context: vscode.ExtensionContext) {
     return
   }
   vscode.workspace.registerTextDocumentContentProvider("proto", client)
+  if (vscode.workspace.getConfiguration("protols").get("remote")) {
+    context.subscriptions.push(
+      client.onRequest("protols/readFile", async (params: { uri: string }) => {
+        const contents = await vscode.workspace.fs.readFile(
+          client.protocol2CodeConverter.asUri(params.uri),
+        )
+        return { contents: new TextDecoder().decode(contents) }
+      }),
+    )
+  }
   // Start the client. This will also launch the server
-  client.start()
+  client.start().then(async () => {
+    if (!vscode.workspace.getConfiguration("protols").get("remote")) {
+      return
+    }
+    // in remote mode, the server only learns about workspace files through
+    // file events, so report all existing files as created
+    const files = await vscode.workspace.findFiles("**/*.proto")
+    await client.sendNotification("workspace/didChangeWatchedFiles", {
+      changes: files.map((uri) => ({
+        uri: client.code2ProtocolConverter.asUri(uri),
+        type: 1, // FileChangeType.Created
+      })),
+    })
+  })
 
   const astViewer = new ASTViewer(
     (uri: vscode.Uri, version: number, token: vscode.CancellationToken) => {
@@ -52,6 +75,52 @@ export async function activate(context: vscode.ExtensionContext) {
   )
 
   context.subscriptions.push(
+    client.onNotification(
+      "protols/readOnlyFile",
+      async (params: { uri: string; reason: string }) => {
+        const uri = client.protocol2CodeConverter.asUri(params.uri)
+        const active = vscode.window.activeTextEditor?.document.uri
+        if (active?.toString() === uri.toString()) {
+          await vscode.commands.executeCommand(
+            "workbench.action.files.setActiveEditorReadonlyInSession",
+          )
+        }
+        const choice = await vscode.window.showInformationMessage(
+          params.reason,
+          "Make Editable Copy",
+        )
+        if (choice === "Make Editable Copy") {
+          await vscode.commands.executeCommand("protols.makeEditableCopy", uri)
+        }
+      },
+    ),
+    vscode.commands.registerCommand(
+      "protols.makeEditableCopy",
+      async (uri?: vscode.Uri) => {
+        if (!client.isRunning()) {
+          return
+        }
+        uri ??= vscode.window.activeTextEditor?.document.uri
+        if (!uri) {
+          return
+        }
+        try {
+          const result: string = await client.sendRequest(
+            "workspace/executeCommand",
+            {
+              command: "protols/makeEditableCopy",
+              arguments: [{ uri: client.code2ProtocolConverter.asUri(uri) }],
+            },
+          )
+          const doc = await vscode.workspace.openTextDocument(
+            client.protocol2CodeConverter.asUri(result),
+          )
+          await vscode.window.showTextDocument(doc)
+        } catch (e) {
+          vscode.window.showErrorMessage(e.message)
+        }
+      },
+    ),
     vscode.commands.registerCommand("protols.restart", async () => {
       if (!client.isRunning()) {
         await client.start()
@@ -68,6 +137,15 @@ export async function activate(context: vscode.ExtensionContext) {
         arguments: [],
       })
     }),
+    vscode.commands.registerCommand("protols.indexWorkspace", async () => {
+      if (!client.isRunning()) {
+        return
+      }
+      await client.sendRequest("workspace/executeCommand", {
+        command: "protols/indexWorkspace",
+        arguments: [],
+      })
+    }),
     vscode.commands.registerCommand("protols.refreshModules", async () => {
       if (!client.isRunning()) {
         return
@@ -77,6 +155,57 @@ export async function activate(context: vscode.ExtensionContext) {
         arguments: [],
       })
     }),
+    vscode.commands.registerCommand("protols.setImportPrecedence", async () => {
+      if (!client.isRunning()) {
+        return
+      }
+      const choice = await vscode.window.showQuickPick(
+        [
+          { label: "Prefer workspace files", precedence: ["workspace"] },
+          { label: "Prefer Go modules", precedence: ["goModule"] },
+          { label: "Use the protols.importPrecedence setting", precedence: [] },
+        ],
+        { placeHolder: "Import paths provided by more than one source" },
+      )
+      if (!choice) {
+        return
+      }
+      await client.sendRequest("workspace/executeCommand", {
+        command: "protols/setImportPrecedence",
+        arguments: [{ precedence: choice.precedence }],
+      })
+    }),
+    vscode.commands.registerCommand("protols.bugReport", async () => {
+      if (!client.isRunning()) {
+        return
+      }
+      const report: string = await client.sendRequest(
+        "workspace/executeCommand",
+        {
+          command: "protols/bugReport",
+          arguments: [],
+        },
+      )
+      const doc = await vscode.workspace.openTextDocument({
+        language: "markdown",
+        content: report,
+      })
+      await vscode.window.showTextDocument(doc)
+    }),
+    vscode.commands.registerCommand("protols.showMetrics", async () => {
+      if (!client.isRunning()) {
+        return
+      }
+      const metrics = await client.sendRequest("workspace/executeCommand", {
+        command: "protols/metrics",
+        arguments: [],
+      })
+      const doc = await vscode.workspace.openTextDocument({
+        language: "json",
+        content: JSON.stringify(metrics, null, 2),
+      })
+      await vscode.window.showTextDocument(doc)
+    }),
     vscode.commands.registerCommand("protols.stop", async () => {
       if (!client.isRunning()) {
         return
@@ -130,6 +259,41 @@ export async function activate(context: vscode.ExtensionContext) {
         }
       },
     ),
+    vscode.commands.registerTextEditorCommand(
+      "protols.peekMembers",
+      async (editor) => {
+        if (!client.isRunning()) {
+          return
+        }
+        try {
+          const result: Location[] = await client.sendRequest(
+            "workspace/executeCommand",
+            {
+              command: "protols/messageMembers",
+              arguments: [
+                client.code2ProtocolConverter.asTextDocumentPositionParams(
+                  editor.document,
+                  editor.selection.anchor,
+                ),
+              ],
+            },
+          )
+          if (!result?.length) {
+            vscode.window.showInformationMessage("No members found")
+            return
+          }
+          await vscode.commands.executeCommand(
+            "editor.action.peekLocations",
+            editor.document.uri,
+            editor.selection.anchor,
+            result.map(client.protocol2CodeConverter.asLocation),
+            "peek",
+          )
+        } catch (e) {
+          vscode.window.showErrorMessage(e.message)
+        }
+      },
+    ),
     vscode.commands.registerTextEditorCommand(
       "protols.generateWorkspace",
       async (editor) => {
@@ -180,6 +344,193 @@ export async function activate(context: vscode.ExtensionContext) {
         }
       },
     ),
+    vscode.commands.registerTextEditorCommand(
+      "protols.addFieldsFromJSON",
+      async (editor) => {
+        if (!client.isRunning()) {
+          return
+        }
+        const json = await vscode.env.clipboard.readText()
+        try {
+          await client.sendRequest("workspace/executeCommand", {
+            command: "protols/addFieldsFromJSON",
+            arguments: [
+              {
+                ...client.code2ProtocolConverter.asTextDocumentPositionParams(
+                  editor.document,
+                  editor.selection.active,
+                ),
+                json,
+              },
+            ],
+          })
+        } catch (e) {
+          vscode.window.showErrorMessage(e.message)
+        }
+      },
+    ),
+    vscode.commands.registerTextEditorCommand(
+      "protols.messageFromGoStruct",
+      async (editor) => {
+        if (!client.isRunning()) {
+          return
+        }
+        const clipboard = await vscode.env.clipboard.readText()
+        const input = await vscode.window.showInputBox({
+          title: "Insert Message from Go Struct",
+          prompt:
+            "Qualified name of a Go struct (e.g. example.com/foo/bar.Baz), or leave empty to use Go source from the clipboard",
+        })
+        if (input === undefined) {
+          return
+        }
+        try {
+          await client.sendRequest("workspace/executeCommand", {
+            command: "protols/messageFromGoStruct",
+            arguments: [
+              {
+                ...client.code2ProtocolConverter.asTextDocumentPositionParams(
+                  editor.document,
+                  editor.selection.active,
+                ),
+                ...(input ? { typeName: input } : { source: clipboard }),
+              },
+            ],
+          })
+        } catch (e) {
+          vscode.window.showErrorMessage(e.message)
+        }
+      },
+    ),
+    vscode.commands.registerTextEditorCommand(
+      "protols.previewRename",
+      async (editor) => {
+        if (!client.isRunning()) {
+          return
+        }
+        const newName = await vscode.window.showInputBox({
+          title: "Preview Rename",
+          prompt: "New name",
+        })
+        if (!newName) {
+          return
+        }
+        try {
+          const preview: any = await client.sendRequest(
+            "workspace/executeCommand",
+            {
+              command: "protols/previewRename",
+              arguments: [
+                {
+                  ...client.code2ProtocolConverter.asTextDocumentPositionParams(
+                    editor.document,
+                    editor.selection.active,
+                  ),
+                  newName,
+                },
+              ],
+            },
+          )
+          if (await confirmEditPreview(preview)) {
+            await vscode.workspace.applyEdit(
+              await client.protocol2CodeConverter.asWorkspaceEdit(preview.edit),
+            )
+          }
+        } catch (e) {
+          vscode.window.showErrorMessage(e.message)
+        }
+      },
+    ),
+    vscode.commands.registerTextEditorCommand(
+      "protols.extractToFile",
+      async (editor, _edit, request?: any) => {
+        if (!client.isRunning()) {
+          return
+        }
+        if (!request) {
+          const filename = await vscode.window.showInputBox({
+            title: "Move Declaration to New File",
+            prompt:
+              "Name of the new file, relative to the current file's directory (leave empty to name it after the declaration)",
+          })
+          if (filename === undefined) {
+            return
+          }
+          request = {
+            ...client.code2ProtocolConverter.asTextDocumentPositionParams(
+              editor.document,
+              editor.selection.active,
+            ),
+            ...(filename ? { filename } : {}),
+          }
+        }
+        try {
+          const edit: any = await client.sendRequest(
+            "workspace/executeCommand",
+            {
+              command: "protols/extractToFile",
+              arguments: [request],
+            },
+          )
+          await applyNewFilesEdit(client, edit)
+        } catch (e) {
+          vscode.window.showErrorMessage(e.message)
+        }
+      },
+    ),
+    vscode.commands.registerTextEditorCommand(
+      "protols.splitFile",
+      async (editor) => {
+        if (!client.isRunning()) {
+          return
+        }
+        const uri = client.code2ProtocolConverter.asUri(editor.document.uri)
+        try {
+          const proposal: any = await client.sendRequest(
+            "workspace/executeCommand",
+            {
+              command: "protols/proposeFileSplit",
+              arguments: [{ uri }],
+            },
+          )
+          if (proposal.groups.length === 0) {
+            vscode.window.showInformationMessage(
+              "No split found: all declarations in this file depend on each other",
+            )
+            return
+          }
+          const picked = await vscode.window.showQuickPick(
+            proposal.groups.map((group: any) => ({
+              label: group.filename,
+              detail: group.declarations.join(", "),
+              picked: true,
+              group,
+            })),
+            {
+              title: "Split File",
+              placeHolder: `Select the files to create (remaining in this file: ${proposal.remaining.join(", ")})`,
+              canPickMany: true,
+            },
+          )
+          if (!picked || picked.length === 0) {
+            return
+          }
+          const groups = picked.map((item: any) => item.group)
+          const result: any = await client.sendRequest(
+            "workspace/executeCommand",
+            {
+              command: "protols/splitFile",
+              arguments: [{ uri, groups, dryRun: true }],
+            },
+          )
+          if (await confirmEditPreview(result.preview)) {
+            await applyNewFilesEdit(client, result.edit)
+          }
+        } catch (e) {
+          vscode.window.showErrorMessage(e.message)
+        }
+      },
+    ),
     vscode.commands.registerTextEditorCommand("protols.ast", async (editor) => {
       if (!client.isRunning()) {
         return
@@ -191,6 +542,60 @@ export async function activate(context: vscode.ExtensionContext) {
   initCommands(context)
 }
 
+// Creates the new files in a NewFilesEdit returned by the server and applies
+// its edit, as a single workspace edit.
+async function applyNewFilesEdit(
+  client: LanguageClient,
+  edit: any,
+): Promise<boolean> {
+  const workspaceEdit = await client.protocol2CodeConverter.asWorkspaceEdit(
+    edit.edit,
+  )
+  const encoder = new TextEncoder()
+  for (const file of edit.files) {
+    workspaceEdit.createFile(client.protocol2CodeConverter.asUri(file.uri), {
+      contents: encoder.encode(file.content),
+    })
+  }
+  return vscode.workspace.applyEdit(workspaceEdit)
+}
+
+// Shows a summary of the edit described by the preview, and asks whether it
+// should be applied.
+async function confirmEditPreview(preview: any): Promise<boolean> {
+  const lines = [
+    `${preview.totalEdits} edits in ${preview.files.length} files`,
+    "",
+  ]
+  for (const file of preview.files) {
+    if (file.created) {
+      lines.push(`${file.path || file.uri} (new file)`)
+      for (const snippet of file.snippets ?? []) {
+        lines.push(...snippet.after.split("\n").map((l: string) => `  + ${l}`))
+      }
+      continue
+    }
+    lines.push(`${file.path || file.uri} (${file.edits} edits)`)
+    if (file.renamedTo) {
+      lines.push(`  -> ${file.renamedTo}`)
+    }
+    for (const snippet of file.snippets ?? []) {
+      lines.push(`  ${snippet.line + 1}: - ${snippet.before.trim()}`)
+      lines.push(`  ${snippet.line + 1}: + ${snippet.after.trim()}`)
+    }
+  }
+  const doc = await vscode.workspace.openTextDocument({
+    language: "plaintext",
+    content: lines.join("\n"),
+  })
+  await vscode.window.showTextDocument(doc, { preview: true })
+  const choice = await vscode.window.showInformationMessage(
+    `Apply ${preview.totalEdits} edits in ${preview.files.length} files?`,
+    "Apply",
+  )
+  return choice === "Apply"
+}
+
 export function deactivate(): Thenable<void> | undefined {
   if (!client) {
     return undefined
@@ -0,0 +1,139 @@
+// Package analysis defines the interface implemented by third-party analyzers,
+// which can be compiled into a build of protols to report additional
+// diagnostics and fixes for workspace-local files.
+//
+// Analyzers are registered from an init function, and are enabled by
+// importing the package which registers them (usually for side effects) into
+// the main package of the build:
+//
+//	import _ "example.com/myanalyzers/nofloats"
+//
+// Registered analyzers run after the builtin lint rules each time a file is
+// compiled. They are subject to the same settings: they are skipped when
+// linting is disabled, and can be disabled individually by adding their name
+// to the lint.disabled setting.
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// An Analyzer checks a linked file and reports its findings to a Pass.
+type Analyzer interface {
+	// Name identifies the analyzer in diagnostics and in the lint.disabled
+	// setting. It must be unique among all analyzers and builtin lint rules.
+	Name() string
+	// Run analyzes pass.Result. It is called with the server's compilation
+	// lock held, so it must not block, and must use pass.Resolver instead of
+	// calling back into the server to look up other descriptors. An error
+	// is logged, and discards any diagnostics reported by the pass.
+	Run(ctx context.Context, pass *Pass) error
+}
+
+// A Pass holds the file being analyzed, and collects the diagnostics reported
+// for it.
+type Pass struct {
+	// The linked file being analyzed. Its AST is always available.
+	Result linker.Result
+	// Resolves descriptors in the file's dependencies, and in all other
+	// files in the workspace.
+	Resolver linker.Resolver
+
+	diagnostics []*Diagnostic
+}
+
+// NewPass returns a pass for the given file. It is used by the server, and by
+// tests of individual analyzers.
+func NewPass(result linker.Result, resolver linker.Resolver) *Pass {
+	return &Pass{Result: result, Resolver: resolver}
+}
+
+// Report adds a warning for the given node. The returned diagnostic can be
+// modified to change its severity or to add fixes.
+func (p *Pass) Report(node ast.Node, format string, args ...any) *Diagnostic {
+	d := &Diagnostic{
+		Range:    p.Result.AST().NodeInfo(node),
+		Severity: protocol.SeverityWarning,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	p.diagnostics = append(p.diagnostics, d)
+	return d
+}
+
+// Add adds a diagnostic with an arbitrary range.
+func (p *Pass) Add(d *Diagnostic) {
+	p.diagnostics = append(p.diagnostics, d)
+}
+
+// Diagnostics returns the diagnostics reported so far.
+func (p *Pass) Diagnostics() []*Diagnostic {
+	return p.diagnostics
+}
+
+// A Diagnostic is a finding in the file being analyzed.
+type Diagnostic struct {
+	Range    ast.SourceSpan
+	Severity protocol.DiagnosticSeverity
+	Message  string
+	// Fixes are offered as quick fix code actions for the diagnostic.
+	Fixes []Fix
+}
+
+// A Fix is a set of edits to the file being analyzed which resolves a
+// diagnostic.
+type Fix struct {
+	Title       string
+	IsPreferred bool
+	Edits       []Edit
+}
+
+// An Edit replaces the text in a range of the file being analyzed.
+type Edit struct {
+	Range   ast.SourceSpan
+	NewText string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Analyzer
+)
+
+// Register makes an analyzer available to the server. It panics if an
+// analyzer with the same name is already registered.
+func Register(a Analyzer) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, existing := range registry {
+		if existing.Name() == a.Name() {
+			panic("analysis: Register called twice for analyzer " + a.Name())
+		}
+	}
+	registry = append(registry, a)
+	slices.SortFunc(registry, func(a, b Analyzer) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+}
+
+// Unregister removes the analyzer with the given name, if it is registered.
+func Unregister(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = slices.DeleteFunc(registry, func(a Analyzer) bool {
+		return a.Name() == name
+	})
+}
+
+// Registered returns the registered analyzers, sorted by name.
+func Registered() []Analyzer {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return slices.Clone(registry)
+}
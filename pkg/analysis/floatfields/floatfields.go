@@ -0,0 +1,52 @@
+// Package floatfields is an example analyzer, which reports fields of type
+// float and offers to change them to double. Importing it registers the
+// analyzer:
+//
+//	import _ "github.com/kralicky/protols/pkg/analysis/floatfields"
+package floatfields
+
+import (
+	"context"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protols/pkg/analysis"
+)
+
+func init() {
+	analysis.Register(Analyzer{})
+}
+
+// Analyzer reports fields of type float. Floats have only 24 bits of
+// precision, which is rarely enough for values such as money or coordinates.
+type Analyzer struct{}
+
+var _ analysis.Analyzer = Analyzer{}
+
+// Name implements analysis.Analyzer.
+func (Analyzer) Name() string {
+	return "float-fields"
+}
+
+// Run implements analysis.Analyzer.
+func (Analyzer) Run(_ context.Context, pass *analysis.Pass) error {
+	fileNode := pass.Result.AST()
+	ast.Inspect(fileNode, func(node ast.Node) bool {
+		field, ok := node.(*ast.FieldNode)
+		if !ok {
+			return true
+		}
+		if field.GetName() == nil || field.GetFieldType() == nil || field.GetFieldType().AsIdentifier() != "float" {
+			return false
+		}
+		typeNode := field.GetFieldType().Unwrap()
+		d := pass.Report(typeNode, "field %s has type float, which has only 24 bits of precision; consider using double", field.GetName().AsIdentifier())
+		d.Fixes = append(d.Fixes, analysis.Fix{
+			Title: "Change type to double",
+			Edits: []analysis.Edit{
+				{Range: fileNode.NodeInfo(typeNode), NewText: "double"},
+			},
+		})
+		return false
+	})
+	return nil
+}
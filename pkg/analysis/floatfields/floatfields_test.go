@@ -0,0 +1,72 @@
+package floatfields_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/kralicky/protols/pkg/analysis/floatfields"
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestFloatFields(t *testing.T) {
+	workspace := t.TempDir()
+	filename := filepath.Join(workspace, "a.proto")
+	source := `syntax = "proto3";
+package a;
+message A {
+  float x = 1;
+  double y = 2;
+}
+`
+	if err := os.WriteFile(filename, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := lsp.NewCache(protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(workspace))}, lsp.WithSandboxedCache())
+	defer c.Close(nil)
+	c.LoadFiles([]string{filename})
+
+	all, err := c.XGetAllDiagnostics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := protocol.URIFromPath(filename)
+	var diagnostics []protocol.Diagnostic
+	for _, d := range all[uri] {
+		if d.Code == "float-fields" {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %v", all[uri])
+	}
+	d := diagnostics[0]
+	wantRange := protocol.Range{
+		Start: protocol.Position{Line: 3, Character: 2},
+		End:   protocol.Position{Line: 3, Character: 7},
+	}
+	if d.Range != wantRange || d.Severity != protocol.SeverityWarning {
+		t.Errorf("unexpected diagnostic: %+v", d)
+	}
+
+	actions, err := c.GetCodeActions(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        d.Range,
+		Context: protocol.CodeActionContext{
+			Diagnostics: []protocol.Diagnostic{d},
+			Only:        []protocol.CodeActionKind{protocol.QuickFix},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || actions[0].Title != "Change type to double" {
+		t.Fatalf("unexpected code actions: %+v", actions)
+	}
+	edits := actions[0].Edit.Changes[uri]
+	if len(edits) != 1 || edits[0].Range != wantRange || edits[0].NewText != "double" {
+		t.Errorf("unexpected edits: %+v", edits)
+	}
+}
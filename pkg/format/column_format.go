@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"slices"
 
 	"github.com/kralicky/protocompile/ast"
 )
@@ -432,7 +433,11 @@ GROUPS:
 			bufferedFields = append(bufferedFields, field)
 		}
 
-		for block := range splitSegmentedFields(bufferedFields) {
+		blocks := splitSegmentedFields(bufferedFields)
+		if f.options.DisableColumnAlignment {
+			blocks = slices.Chunk(bufferedFields, 1)
+		}
+		for block := range blocks {
 			// find the longest string in each column
 			typeNameCol, fieldNameCol, equalsTagCol, optionsSemicolonCol := 0, 0, 0, 0
 			for i, field := range block {
@@ -14,6 +14,12 @@ import (
 )
 
 func Format(in io.Reader, out io.Writer) error {
+	return FormatWithOptions(in, out, FormatterOptions{})
+}
+
+// FormatWithOptions is like Format, but formats the input with the given
+// options.
+func FormatWithOptions(in io.Reader, out io.Writer, options FormatterOptions) error {
 	a, err := parser.Parse("", in, reporter.NewHandler(reporter.NewReporter(
 		func(err reporter.ErrorWithPos) error {
 			return err
@@ -23,7 +29,7 @@ func Format(in io.Reader, out io.Writer) error {
 	if err != nil {
 		return err
 	}
-	formatter := NewFormatter(out, a)
+	formatter := NewFormatterWithOptions(out, a, options)
 	return formatter.Run()
 }
 
@@ -37,6 +43,12 @@ func File(filename string, out io.Writer) error {
 }
 
 func FileInPlace(filename string) error {
+	return FileInPlaceWithOptions(filename, FormatterOptions{})
+}
+
+// FileInPlaceWithOptions is like FileInPlace, but formats the file with the
+// given options.
+func FileInPlaceWithOptions(filename string, options FormatterOptions) error {
 	info, err := os.Stat(filename)
 	if err != nil {
 		return err
@@ -46,7 +58,7 @@ func FileInPlace(filename string) error {
 		return err
 	}
 	var formatted bytes.Buffer
-	if err := Format(bytes.NewReader(original), &formatted); err != nil {
+	if err := FormatWithOptions(bytes.NewReader(original), &formatted, options); err != nil {
 		return err
 	}
 	return util.OverwriteFile(filename, original, formatted.Bytes(), info.Mode().Perm(), info.Size())
@@ -74,7 +86,12 @@ func NewDefaultPrinter() *protoprint.Printer {
 }
 
 func PrintAndFormatFileDescriptor(fd protoreflect.FileDescriptor, out io.Writer) error {
-	printer := NewDefaultPrinter()
+	return PrintAndFormatFileDescriptorWithPrinter(fd, NewDefaultPrinter(), out)
+}
+
+// PrintAndFormatFileDescriptorWithPrinter is like PrintAndFormatFileDescriptor,
+// but prints the descriptor with the given printer before formatting it.
+func PrintAndFormatFileDescriptorWithPrinter(fd protoreflect.FileDescriptor, printer *protoprint.Printer, out io.Writer) error {
 	var buf bytes.Buffer
 	err := printer.PrintProto(fd, &buf)
 	if err != nil {
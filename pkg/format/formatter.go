@@ -40,6 +40,7 @@ type FileNodeInterface interface {
 type formatter struct {
 	writer   io.Writer
 	fileNode FileNodeInterface
+	options  FormatterOptions
 
 	// Current level of indentation.
 	indent int
@@ -79,6 +80,7 @@ func (f *formatter) saveState(newWriter io.Writer) *formatter {
 	return &formatter{
 		writer:           newWriter,
 		fileNode:         f.fileNode,
+		options:          f.options,
 		indent:           f.indent,
 		lastWritten:      f.lastWritten,
 		previousNode:     f.previousNode,
@@ -104,10 +106,21 @@ func (f *formatter) mergeState(other *formatter, reader io.Reader) {
 func NewFormatter(
 	writer io.Writer,
 	fileNode FileNodeInterface,
+) *formatter {
+	return NewFormatterWithOptions(writer, fileNode, FormatterOptions{})
+}
+
+// NewFormatterWithOptions is like NewFormatter, but formats the file with the
+// given options.
+func NewFormatterWithOptions(
+	writer io.Writer,
+	fileNode FileNodeInterface,
+	options FormatterOptions,
 ) *formatter {
 	return &formatter{
 		writer:   writer,
 		fileNode: fileNode,
+		options:  options,
 	}
 }
 
@@ -178,7 +191,7 @@ func (f *formatter) Indent(nextNode ast.Node) {
 			indent--
 		}
 	}
-	f.WriteString(strings.Repeat("  ", indent))
+	f.WriteString(strings.Repeat(f.options.indent(), indent))
 }
 
 // WriteString writes the given element to the generated output.
@@ -1280,6 +1293,9 @@ func (f *formatter) compactOptionsShouldBeExpanded(compactOptionsNode *ast.Compa
 	if len(compactOptionsNode.Options) == 0 {
 		return false
 	}
+	if n := f.options.ExpandCompactOptions; n > 0 && len(compactOptionsNode.Options) >= n {
+		return true
+	}
 	info := f.fileNode.NodeInfo(compactOptionsNode.Options[0])
 	if strings.Contains(info.LeadingWhitespace(), "\n") {
 		return true
@@ -2222,9 +2238,20 @@ func (f *formatter) writeMultilineComments(comments ast.Comments) {
 
 func (f *formatter) writeMultilineCommentsMaybeCompact(comments ast.Comments, forceCompact bool) {
 	compact := forceCompact || isOpenBrace(f.previousNode)
+	// consecutive line comments are buffered here to be reflowed together,
+	// if a comment width is set
+	var lineComments []string
+	flushLineComments := func() {
+		for _, line := range f.reflowLineComments(lineComments) {
+			f.writeComment(line)
+			f.WriteString("\n")
+		}
+		lineComments = lineComments[:0]
+	}
 	for i := 0; i < comments.Len(); i++ {
 		comment := comments.Index(i)
 		if !compact && newlineCount(comment.LeadingWhitespace()) > 1 {
+			flushLineComments()
 			// Newlines between blocks of comments should be preserved.
 			//
 			// For example,
@@ -2238,9 +2265,78 @@ func (f *formatter) writeMultilineCommentsMaybeCompact(comments ast.Comments, fo
 			f.P("")
 		}
 		compact = false
+		if f.options.CommentWidth > 0 && strings.HasPrefix(comment.RawText(), "//") {
+			lineComments = append(lineComments, comment.RawText())
+			continue
+		}
+		flushLineComments()
 		f.writeComment(comment.RawText())
 		f.WriteString("\n")
 	}
+	flushLineComments()
+}
+
+// reflowLineComments rewraps the text of consecutive line comments to fit
+// within the configured comment width. See FormatterOptions.CommentWidth.
+func (f *formatter) reflowLineComments(comments []string) []string {
+	if len(comments) == 0 {
+		return nil
+	}
+	width := f.options.CommentWidth - f.indent*len(f.options.indent()) - len("// ")
+	var lines, words []string
+	flushParagraph := func() {
+		var line string
+		for _, word := range words {
+			if line != "" && len(line)+1+len(word) > width {
+				lines = append(lines, "// "+line)
+				line = ""
+			}
+			if line == "" {
+				line = word
+			} else {
+				line += " " + word
+			}
+		}
+		if line != "" {
+			lines = append(lines, "// "+line)
+		}
+		words = words[:0]
+	}
+	for _, comment := range comments {
+		text := strings.TrimRightFunc(strings.TrimPrefix(strings.TrimSpace(comment), "//"), unicode.IsSpace)
+		if rest, ok := strings.CutPrefix(text, " "); !ok || rest == "" || unicode.IsSpace(rune(rest[0])) {
+			// empty lines, directives and preformatted text
+			flushParagraph()
+			lines = append(lines, comment)
+			continue
+		}
+		fields := strings.Fields(text)
+		if isListMarker(fields[0]) {
+			flushParagraph()
+		}
+		words = append(words, fields...)
+	}
+	flushParagraph()
+	return lines
+}
+
+// isListMarker reports whether the first word of a comment line starts an
+// item in a list, such as "-", "*" or "1.".
+func isListMarker(word string) bool {
+	switch word {
+	case "-", "*", "+":
+		return true
+	}
+	digits := strings.TrimRight(word, ".)")
+	if len(digits) == 0 || len(digits) != len(word)-1 {
+		return false
+	}
+	for _, r := range digits {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
 }
 
 // writeInlineComments writes the given comments in-line. Standard comments are
@@ -306,3 +306,100 @@ message Foo {
 		})
 	}
 }
+
+func TestFormatWithOptions(t *testing.T) {
+	cases := []struct {
+		options format.FormatterOptions
+		input   string
+		want    string
+	}{
+		0: {
+			options: format.FormatterOptions{Indent: "\t"},
+			input: `
+message Foo {
+  message Bar {
+    string name = 1;
+  }
+}`[1:],
+			want: `
+message Foo {
+	message Bar {
+		string name = 1;
+	}
+}`[1:],
+		},
+		1: {
+			options: format.FormatterOptions{DisableColumnAlignment: true},
+			input: `
+message Foo {
+  optional string name   = 1;
+  optional uint64 id     = 2;
+  repeated bool   _      = 4;
+}`[1:],
+			want: `
+message Foo {
+  optional string name = 1;
+  optional uint64 id = 2;
+  repeated bool _ = 4;
+}`[1:],
+		},
+		2: {
+			options: format.FormatterOptions{ExpandCompactOptions: 2},
+			input: `
+message Foo {
+  string a = 1 [deprecated = true];
+  string b = 2 [deprecated = true, json_name = "bb"];
+}`[1:],
+			want: `
+message Foo {
+  string a = 1 [deprecated = true];
+  string b = 2 [
+    deprecated = true,
+    json_name  = "bb"
+  ];
+}`[1:],
+		},
+		3: {
+			options: format.FormatterOptions{CommentWidth: 30},
+			input: `
+message Foo {
+  // This comment is much too long to fit on one line.
+  // It continues here.
+  //
+  // A list:
+  // - first item in the list is long
+  // - second
+  //   preformatted   text
+  string a = 1;
+}`[1:],
+			want: `
+message Foo {
+  // This comment is much too
+  // long to fit on one line.
+  // It continues here.
+  //
+  // A list:
+  // - first item in the list
+  // is long
+  // - second
+  //   preformatted   text
+  string a = 1;
+}`[1:],
+		},
+	}
+
+	for i, c := range cases {
+		t.Run("", func(t *testing.T) {
+			input := c.input
+			for iteration := range 2 {
+				var out strings.Builder
+				require.NoError(t, format.FormatWithOptions(strings.NewReader(input), &out, c.options))
+				got := strings.TrimSuffix(out.String(), "\n")
+
+				require.Equal(t, c.want, got, "case %d (iteration %d)", i, iteration+1)
+
+				input = got
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package format
+
+// FormatterOptions configures the formatter. The zero value formats files the
+// same way as 'protols fmt' with no flags.
+type FormatterOptions struct {
+	// The string written for each level of indentation. Defaults to two
+	// spaces.
+	Indent string `mapstructure:"indent"`
+	// If true, the names, numbers and options of consecutive fields, enum
+	// values and options are separated by a single space instead of being
+	// aligned into columns.
+	DisableColumnAlignment bool `mapstructure:"disableColumnAlignment"`
+	// Compact options (e.g. "[deprecated = true]") with at least this many
+	// options are written with one option per line. If zero, compact options
+	// are only written across multiple lines if they already span multiple
+	// lines or contain comments.
+	ExpandCompactOptions int `mapstructure:"expandCompactOptions"`
+	// If greater than zero, blocks of line comments preceding a declaration
+	// are rewrapped to fit within this many columns, including indentation.
+	// Empty comment lines separate paragraphs and list items start new lines.
+	// Lines indented further than a single space after the slashes, and
+	// directives with no space after the slashes, are left as they are. Words
+	// are never split, so lines containing long words may exceed the width.
+	CommentWidth int `mapstructure:"commentWidth"`
+}
+
+func (o FormatterOptions) indent() string {
+	if o.Indent == "" {
+		return "  "
+	}
+	return o.Indent
+}
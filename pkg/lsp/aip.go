@@ -0,0 +1,232 @@
+package lsp
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protocompile/protoutil"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Lint rules implementing a subset of the API Improvement Proposals
+// (https://google.aip.dev). These belong to the "aip" rule pack, which must be
+// enabled explicitly.
+
+const (
+	lintPackAIP = "aip"
+
+	fieldBehaviorOptionName = "google.api.field_behavior"
+	emptyMessageName        = "google.protobuf.Empty"
+	operationMessageName    = "google.longrunning.Operation"
+)
+
+// standardMethodVerbs are the method name prefixes of the AIP standard methods
+// (AIP-131 through AIP-135).
+var standardMethodVerbs = []string{"Get", "List", "Create", "Update", "Delete"}
+
+var upperCamelCaseRegex = regexp.MustCompile(`^[A-Z][a-zA-Z0-9]*$`)
+
+// standardMethod splits the name of a standard method into its verb and the
+// resource name, e.g. "GetBook" into "Get" and "Book". The resource name is
+// plural for List methods.
+func standardMethod(name protoreflect.Name) (verb, noun string, ok bool) {
+	for _, verb := range standardMethodVerbs {
+		if noun, ok := strings.CutPrefix(string(name), verb); ok && upperCamelCaseRegex.MatchString(noun) {
+			return verb, noun, true
+		}
+	}
+	return "", "", false
+}
+
+// fieldBehaviors returns the values of the google.api.field_behavior option
+// set on a field.
+func fieldBehaviors(fd protoreflect.FieldDescriptor) []annotations.FieldBehavior {
+	opts, ok := fd.Options().(*descriptorpb.FieldOptions)
+	if !ok || opts == nil {
+		return nil
+	}
+	var behaviors []annotations.FieldBehavior
+	opts.ProtoReflect().Range(func(ext protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if ext.FullName() != fieldBehaviorOptionName || !ext.IsList() {
+			return true
+		}
+		for i := range v.List().Len() {
+			behaviors = append(behaviors, annotations.FieldBehavior(v.List().Get(i).Enum()))
+		}
+		return false
+	})
+	return behaviors
+}
+
+func hasFieldBehavior(fd protoreflect.FieldDescriptor, behavior annotations.FieldBehavior) bool {
+	for _, b := range fieldBehaviors(fd) {
+		if b == behavior {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeMethods calls fn for each method declared in the file along with its
+// rpc node.
+func rangeMethods(res linker.Result, fn func(protoreflect.MethodDescriptor, *ast.RPCNode)) {
+	services := res.Services()
+	for i := range services.Len() {
+		methods := services.Get(i).Methods()
+		for j := range methods.Len() {
+			md := methods.Get(j)
+			wrapper, ok := md.(protoutil.DescriptorProtoWrapper)
+			if !ok {
+				continue
+			}
+			rpcNode := res.MethodNode(wrapper.AsProto().(*descriptorpb.MethodDescriptorProto))
+			if rpcNode == nil || rpcNode.Input == nil || rpcNode.Output == nil {
+				continue
+			}
+			fn(md, rpcNode)
+		}
+	}
+}
+
+// localFieldNode returns the name of the field's declaration if it is declared
+// in the given file, otherwise it returns the fallback node.
+func localFieldNode(res linker.Result, fd protoreflect.FieldDescriptor, fallback ast.Node) ast.Node {
+	if fd.ParentFile() == nil || fd.ParentFile().Path() != res.Path() {
+		return fallback
+	}
+	wrapper, ok := fd.(protoutil.DescriptorProtoWrapper)
+	if !ok {
+		return fallback
+	}
+	if fieldNode := res.FieldNode(wrapper.AsProto().(*descriptorpb.FieldDescriptorProto)); fieldNode != nil && fieldNode.GetName() != nil {
+		return fieldNode.GetName()
+	}
+	return fallback
+}
+
+// lintAIPMethodNames checks that method names are UpperCamelCase, and that
+// standard methods return the resource they operate on (AIP-131, 133, 134) or
+// google.protobuf.Empty for Delete methods (AIP-135). Long-running operations
+// are accepted in place of the resource for all but Get methods.
+func lintAIPMethodNames(_ context.Context, p *lintPass) {
+	rangeMethods(p.result, func(md protoreflect.MethodDescriptor, rpcNode *ast.RPCNode) {
+		if !upperCamelCaseRegex.MatchString(string(md.Name())) {
+			p.report(rpcNode.Name, "method name %s should be UpperCamelCase", md.Name())
+			return
+		}
+		verb, noun, ok := standardMethod(md.Name())
+		if !ok || verb == "List" {
+			return
+		}
+		output := md.Output()
+		if verb != "Get" && output.FullName() == operationMessageName {
+			return
+		}
+		switch verb {
+		case "Delete":
+			if output.FullName() != emptyMessageName && string(output.Name()) != noun {
+				p.report(rpcNode.Output, "%s should return %s or %s", md.Name(), emptyMessageName, noun)
+			}
+		default:
+			if string(output.Name()) != noun {
+				p.report(rpcNode.Output, "%s should return the resource message %s", md.Name(), noun)
+			}
+		}
+	})
+}
+
+// lintAIPRequestResponseNames checks that request and response messages are
+// named after their method (AIP-131 through AIP-136).
+func lintAIPRequestResponseNames(_ context.Context, p *lintPass) {
+	rangeMethods(p.result, func(md protoreflect.MethodDescriptor, rpcNode *ast.RPCNode) {
+		if !upperCamelCaseRegex.MatchString(string(md.Name())) {
+			// reported by aip-method-names
+			return
+		}
+		if want := string(md.Name()) + "Request"; string(md.Input().Name()) != want {
+			p.report(rpcNode.Input, "request message for %s should be named %s", md.Name(), want)
+		}
+		switch md.Output().FullName() {
+		case emptyMessageName, operationMessageName:
+			return
+		}
+		if verb, _, ok := standardMethod(md.Name()); ok && verb != "List" {
+			// reported by aip-method-names
+			return
+		}
+		if want := string(md.Name()) + "Response"; string(md.Output().Name()) != want {
+			p.report(rpcNode.Output, "response message for %s should be named %s", md.Name(), want)
+		}
+	})
+}
+
+// lintAIPFieldBehavior checks that the fields identifying the resource in
+// standard method requests are annotated as REQUIRED (AIP-203).
+func lintAIPFieldBehavior(_ context.Context, p *lintPass) {
+	rangeMethods(p.result, func(md protoreflect.MethodDescriptor, rpcNode *ast.RPCNode) {
+		verb, noun, ok := standardMethod(md.Name())
+		if !ok {
+			return
+		}
+		fields := md.Input().Fields()
+		var required []protoreflect.Name
+		switch verb {
+		case "Get", "Delete":
+			required = append(required, "name")
+		case "List":
+			required = append(required, "parent")
+		case "Create":
+			required = append(required, "parent", protoreflect.Name(protoFieldName(noun)))
+		case "Update":
+			required = append(required, protoreflect.Name(protoFieldName(noun)))
+		}
+		for _, name := range required {
+			fd := fields.ByName(name)
+			if fd == nil {
+				if name != "parent" {
+					p.report(rpcNode.Input, "%s is missing the %q field", md.Input().Name(), name)
+				}
+				continue
+			}
+			if !hasFieldBehavior(fd, annotations.FieldBehavior_REQUIRED) {
+				p.report(localFieldNode(p.result, fd, rpcNode.Input), "field %s should be annotated with (%s) = REQUIRED", fd.FullName(), fieldBehaviorOptionName)
+			}
+		}
+	})
+}
+
+// lintAIPPagination checks that List methods support pagination (AIP-158).
+func lintAIPPagination(_ context.Context, p *lintPass) {
+	type wantField struct {
+		name protoreflect.Name
+		kind protoreflect.Kind
+	}
+	check := func(msg protoreflect.MessageDescriptor, node ast.Node, want ...wantField) {
+		for _, w := range want {
+			fd := msg.Fields().ByName(w.name)
+			switch {
+			case fd == nil:
+				p.report(node, "%s is missing the pagination field \"%s %s\"", msg.Name(), w.kind, w.name)
+			case fd.Kind() != w.kind || fd.IsList():
+				p.report(localFieldNode(p.result, fd, node), "pagination field %s should be of type %s", fd.FullName(), w.kind)
+			}
+		}
+	}
+	rangeMethods(p.result, func(md protoreflect.MethodDescriptor, rpcNode *ast.RPCNode) {
+		if verb, _, ok := standardMethod(md.Name()); !ok || verb != "List" {
+			return
+		}
+		check(md.Input(), rpcNode.Input,
+			wantField{"page_size", protoreflect.Int32Kind},
+			wantField{"page_token", protoreflect.StringKind})
+		if md.Output().FullName() != operationMessageName {
+			check(md.Output(), rpcNode.Output,
+				wantField{"next_page_token", protoreflect.StringKind})
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package lsp
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile"
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// An importAlias maps an import path, or all import paths with a given
+// prefix, to a directory or to another import path.
+type importAlias struct {
+	// the import path, or the prefix (including the trailing slash) if this is
+	// a prefix alias
+	from     string
+	isPrefix bool
+	// an absolute filesystem path if isDir is true, otherwise an import path
+	// (or prefix)
+	to    string
+	isDir bool
+}
+
+// parseImportAliases converts the importAliases setting into a list of aliases,
+// ordered such that longer (more specific) patterns are matched first.
+// Relative directories are resolved against the workspace root.
+func parseImportAliases(root string, aliases map[string]string) []importAlias {
+	parsed := make([]importAlias, 0, len(aliases))
+	for from, to := range aliases {
+		alias := importAlias{from: from, to: to}
+		if prefix, ok := strings.CutSuffix(from, "/*"); ok {
+			alias.from = prefix + "/"
+			alias.isPrefix = true
+			to = strings.TrimSuffix(to, "/*")
+		}
+		if filepath.IsAbs(to) || to == "." || to == ".." || strings.HasPrefix(to, "./") || strings.HasPrefix(to, "../") {
+			alias.isDir = true
+			if !filepath.IsAbs(to) {
+				to = filepath.Join(root, to)
+			}
+			alias.to = filepath.Clean(to)
+		} else if alias.isPrefix {
+			alias.to = strings.TrimSuffix(to, "/") + "/"
+		} else {
+			alias.to = to
+		}
+		parsed = append(parsed, alias)
+	}
+	slices.SortFunc(parsed, func(a, b importAlias) int {
+		if len(a.from) != len(b.from) {
+			return len(b.from) - len(a.from)
+		}
+		return strings.Compare(a.from, b.from)
+	})
+	return parsed
+}
+
+// match returns the filename or import path that the import path refers to.
+func (a importAlias) match(importPath string) (string, bool) {
+	var rest string
+	if a.isPrefix {
+		var ok bool
+		if rest, ok = strings.CutPrefix(importPath, a.from); !ok || rest == "" {
+			return "", false
+		}
+	} else if importPath != a.from {
+		return "", false
+	}
+	if a.isDir {
+		if !a.isPrefix {
+			return a.to, true
+		}
+		return filepath.Join(a.to, filepath.FromSlash(rest)), true
+	}
+	return a.to + rest, true
+}
+
+// reverse returns the import path of the file with the given filename, if it
+// is within the directory of a directory alias.
+func (a importAlias) reverse(filename string) (string, bool) {
+	if !a.isDir {
+		return "", false
+	}
+	if !a.isPrefix {
+		return a.from, filename == a.to
+	}
+	rel, err := filepath.Rel(a.to, filename)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", false
+	}
+	return a.from + filepath.ToSlash(rel), true
+}
+
+// SetImportAliases replaces the configured import aliases. It reports whether
+// the aliases changed.
+func (r *Resolver) SetImportAliases(aliases map[string]string) bool {
+	parsed := parseImportAliases(uriPath(protocol.DocumentURI(r.folder.URI)), aliases)
+	r.pathsMu.Lock()
+	defer r.pathsMu.Unlock()
+	if slices.Equal(parsed, r.importAliases) {
+		return false
+	}
+	r.importAliases = parsed
+	return true
+}
+
+// aliasedPathLocked returns the import path of the file with the given
+// filename according to the configured directory aliases.
+func (r *Resolver) aliasedPathLocked(filename string) (string, bool) {
+	for _, alias := range r.importAliases {
+		if importPath, ok := alias.reverse(filename); ok {
+			return importPath, true
+		}
+	}
+	return "", false
+}
+
+// findAliasedFileLocked resolves an import path using the configured import
+// aliases. If no alias matches the path, ok is false.
+func (r *Resolver) findAliasedFileLocked(importPath string, whence protocompile.ImportContext) (_ protocompile.SearchResult, ok bool, _ error) {
+	for _, alias := range r.importAliases {
+		target, matched := alias.match(importPath)
+		if !matched {
+			continue
+		}
+		if !alias.isDir {
+			res, err := r.findFileByPathLocked(target, whence)
+			if err != nil {
+				return protocompile.SearchResult{}, true, err
+			}
+			if res.ResolvedPath == "" {
+				res.ResolvedPath = protocompile.ResolvedPath(target)
+			}
+			return res, true, nil
+		}
+		if info, err := os.Stat(target); err != nil || !info.Mode().IsRegular() {
+			return protocompile.SearchResult{}, true, os.ErrNotExist
+		}
+		uri := protocol.URIFromPath(target)
+		if existing, ok := r.filePathsByURI[uri]; ok && existing != importPath {
+			delete(r.fileURIsByPath, existing)
+		}
+		r.filePathsByURI[uri] = importPath
+		r.fileURIsByPath[importPath] = uri
+		r.importSourcesByURI[uri] = SourceImportAlias
+		res, err := r.checkFS(importPath, whence)
+		return res, true, err
+	}
+	return protocompile.SearchResult{}, false, nil
+}
+
+// staleAliasMappingsLocked returns the URIs of files whose path mappings do
+// not agree with the configured directory aliases.
+func (r *Resolver) staleAliasMappingsLocked() []protocol.DocumentURI {
+	var stale []protocol.DocumentURI
+	for uri, existing := range r.filePathsByURI {
+		if !uri.IsFile() || r.HasSchemeHandler(uri) {
+			continue
+		}
+		switch r.importSourcesByURI[uri] {
+		case SourceRelativePath, SourceLocalGoModule, SourceImportAlias:
+		default:
+			continue
+		}
+		want, ok := r.aliasedPathLocked(uri.Path())
+		if (ok && want != existing) || (!ok && r.importSourcesByURI[uri] == SourceImportAlias) {
+			stale = append(stale, uri)
+		}
+	}
+	slices.Sort(stale)
+	return stale
+}
+
+// remapAliasedFiles recreates the path mappings of files which are affected by
+// a change to the configured import aliases, and recompiles them.
+func (c *Cache) remapAliasedFiles(ctx context.Context) {
+	c.resolver.pathsMu.RLock()
+	stale := c.resolver.staleAliasMappingsLocked()
+	c.resolver.pathsMu.RUnlock()
+	if len(stale) == 0 {
+		return
+	}
+	slog.Info("import aliases changed, updating path mappings", "files", len(stale))
+	root := uriPath(protocol.DocumentURI(c.workspace.URI))
+	var mods []file.Modification
+	for _, uri := range stale {
+		mods = append(mods, file.Modification{URI: uri, Action: file.Delete, OnDisk: true, Version: -1})
+		if strings.HasPrefix(uri.Path(), root+string(filepath.Separator)) {
+			// files outside the workspace are only known through imports, and
+			// will be found again if they are still imported
+			mods = append(mods, file.Modification{URI: uri, Action: file.Create, OnDisk: true, Version: -1})
+		}
+	}
+	c.DidModifyFiles(ctx, mods)
+}
@@ -0,0 +1,78 @@
+package lsp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestImportAliases(t *testing.T) {
+	workspace := t.TempDir()
+	external := t.TempDir()
+	files := map[string]string{
+		filepath.Join(workspace, "a.proto"): `syntax = "proto3";
+package a;
+import "company/protos/foo/foo.proto";
+import "ext/bar.proto";
+import "wkt/any.proto";
+message A {
+  company.foo.Foo foo = 1;
+  ext.Bar bar = 2;
+  google.protobuf.Any any = 3;
+}
+`,
+		filepath.Join(workspace, "vendored", "foo", "foo.proto"): "syntax = \"proto3\";\npackage company.foo;\nmessage Foo {}\n",
+		filepath.Join(external, "bar.proto"):                     "syntax = \"proto3\";\npackage ext;\nmessage Bar {}\n",
+	}
+	for filename, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewCache(protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(workspace))}, WithSandboxedCache())
+	defer c.Close(nil)
+	c.LoadFiles([]string{
+		filepath.Join(workspace, "a.proto"),
+		filepath.Join(workspace, "vendored", "foo", "foo.proto"),
+	})
+	fooURI := protocol.URIFromPath(filepath.Join(workspace, "vendored", "foo", "foo.proto"))
+	if path, _ := c.resolver.URIToPath(fooURI); path != "vendored/foo/foo.proto" {
+		t.Fatalf("got path %q before aliases were configured", path)
+	}
+
+	c.DidChangeConfiguration(context.Background(), Settings{
+		ImportAliases: map[string]string{
+			"company/protos/*": "./vendored/*",
+			"ext/bar.proto":    filepath.Join(external, "bar.proto"),
+			"wkt/*":            "google/protobuf/*",
+		},
+	})
+	if path, _ := c.resolver.URIToPath(fooURI); path != "company/protos/foo/foo.proto" {
+		t.Errorf("got path %q, want company/protos/foo/foo.proto", path)
+	}
+	// recompile a.proto now that its imports can be resolved
+	c.LoadFiles([]string{filepath.Join(workspace, "a.proto")})
+
+	fd, err := c.FindFileByURI(protocol.URIFromPath(filepath.Join(workspace, "a.proto")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := fd.Messages().ByName("A").Fields()
+	for _, name := range []string{"foo", "bar", "any"} {
+		if msg := fields.ByName(protoreflect.Name(name)).Message(); msg == nil || msg.IsPlaceholder() {
+			t.Errorf("type of field %s was not resolved", name)
+		}
+	}
+	barURI := protocol.URIFromPath(filepath.Join(external, "bar.proto"))
+	if path, _ := c.resolver.URIToPath(barURI); path != "ext/bar.proto" {
+		t.Errorf("got path %q, want ext/bar.proto", path)
+	}
+}
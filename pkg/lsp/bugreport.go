@@ -0,0 +1,237 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kralicky/protols/pkg/version"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// LogTail keeps the most recent log lines in memory, so they can be included
+// in bug reports.
+type LogTail struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+}
+
+// DefaultLogTail records the logs of the current process. The serve command
+// installs it as part of the default logger.
+var DefaultLogTail = NewLogTail(200)
+
+func NewLogTail(size int) *LogTail {
+	return &LogTail{
+		lines: make([]string, 0, size),
+	}
+}
+
+// Write implements io.Writer. Each call is recorded as one or more lines.
+func (t *LogTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if len(t.lines) < cap(t.lines) {
+			t.lines = append(t.lines, line)
+		} else {
+			t.lines[t.next] = line
+		}
+		t.next = (t.next + 1) % cap(t.lines)
+	}
+	return len(p), nil
+}
+
+// Lines returns the recorded lines, oldest first.
+func (t *LogTail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.lines) < cap(t.lines) {
+		return slices.Clone(t.lines)
+	}
+	return append(slices.Clone(t.lines[t.next:]), t.lines[:t.next]...)
+}
+
+// Handler returns a slog handler which records all log messages at or above
+// the given level, and forwards them to the next handler.
+func (t *LogTail) Handler(next slog.Handler, level slog.Leveler) slog.Handler {
+	return teeHandler{
+		slog.NewTextHandler(t, &slog.HandlerOptions{Level: level}),
+		next,
+	}
+}
+
+type teeHandler []slog.Handler
+
+func (h teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, r.Level) {
+			if err := handler.Handle(ctx, r.Clone()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(teeHandler, len(h))
+	for i, handler := range h {
+		out[i] = handler.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	out := make(teeHandler, len(h))
+	for i, handler := range h {
+		out[i] = handler.WithGroup(name)
+	}
+	return out
+}
+
+var bugReportGoEnvVars = []string{"GOVERSION", "GOROOT", "GOPATH", "GOMODCACHE", "GOMOD", "GOWORK", "GOFLAGS", "GOPROXY"}
+
+// WriteBugReport writes a markdown report describing the environment and the
+// state of the given caches, suitable for attaching to an issue.
+func WriteBugReport(ctx context.Context, w io.Writer, caches []*Cache, logs *LogTail) {
+	fmt.Fprintf(w, "# protols bug report\n\n")
+
+	fmt.Fprintf(w, "## Version\n\n")
+	fmt.Fprintf(w, "- protols %s\n", version.FriendlyVersion())
+	fmt.Fprintf(w, "- built with %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(w, "- cpus: %d\n\n", runtime.NumCPU())
+
+	fmt.Fprintf(w, "## Go toolchain\n\n")
+	if slices.ContainsFunc(caches, func(c *Cache) bool { return c.sandbox }) {
+		fmt.Fprintf(w, "unavailable: sandbox mode is enabled\n\n")
+	} else if env, err := goEnv(ctx, bugReportGoEnvVars...); err != nil {
+		fmt.Fprintf(w, "unavailable: %v\n\n", err)
+	} else {
+		for _, key := range bugReportGoEnvVars {
+			fmt.Fprintf(w, "- %s=%s\n", key, env[key])
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "## Workspaces\n\n")
+	if len(caches) == 0 {
+		fmt.Fprintf(w, "none\n\n")
+	}
+	caches = slices.SortedFunc(slices.Values(caches), func(a, b *Cache) int {
+		return strings.Compare(a.workspace.URI, b.workspace.URI)
+	})
+	for _, c := range caches {
+		c.writeBugReportSection(w)
+	}
+
+	fmt.Fprintf(w, "## Recent logs\n\n")
+	if logs == nil {
+		fmt.Fprintf(w, "not recorded\n")
+		return
+	}
+	fmt.Fprintf(w, "```\n%s\n```\n", strings.Join(logs.Lines(), "\n"))
+}
+
+func (c *Cache) writeBugReportSection(w io.Writer) {
+	root := protocol.DocumentURI(c.workspace.URI).Path()
+	fmt.Fprintf(w, "### %s\n\n", root)
+
+	driver := c.resolver.goLanguageDriver
+	if driver.HasGoModule() {
+		fmt.Fprintf(w, "- go module: %s (%s)\n", driver.localModName, driver.localModDir)
+	} else {
+		fmt.Fprintf(w, "- go module: none\n")
+	}
+	if err := c.resolver.goLanguageDriverErr; err != nil {
+		fmt.Fprintf(w, "- go toolchain: %v\n", err)
+	}
+
+	c.resolver.pathsMu.RLock()
+	mappings := len(c.resolver.filePathsByURI)
+	sources := map[string]int{}
+	for _, src := range c.resolver.importSourcesByURI {
+		sources[src.String()]++
+	}
+	synthetic := len(c.resolver.syntheticFiles)
+	c.resolver.pathsMu.RUnlock()
+
+	fmt.Fprintf(w, "- path mappings: %d\n", mappings)
+	for _, name := range slices.Sorted(maps.Keys(sources)) {
+		fmt.Fprintf(w, "  - %s: %d\n", name, sources[name])
+	}
+	fmt.Fprintf(w, "- synthetic files: %d\n", synthetic)
+
+	c.resultsMu.RLock()
+	results := len(c.results)
+	partial, unlinked := len(c.partiallyLinkedResults), len(c.unlinkedResults)
+	c.resultsMu.RUnlock()
+	fmt.Fprintf(w, "- linked files: %d (partially linked: %d, unlinked: %d)\n\n", results, partial, unlinked)
+}
+
+func (s ImportSource) String() string {
+	switch s {
+	case SourceWellKnown:
+		return "well-known"
+	case SourceRelativePath:
+		return "relative path"
+	case SourceLocalGoModule:
+		return "local go module"
+	case SourceGoModuleCache:
+		return "go module cache"
+	case SourceSynthetic:
+		return "synthetic"
+	case SourceImportAlias:
+		return "import alias"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(s))
+	}
+}
+
+// goEnv returns the values of the given variables as reported by the go
+// command. Toolchain downloads are disabled, so that the report describes the
+// toolchain that is installed locally.
+func goEnv(ctx context.Context, keys ...string) (map[string]string, error) {
+	ctx, ca := context.WithTimeout(ctx, 10*time.Second)
+	defer ca()
+	cmd := exec.CommandContext(ctx, "go", append([]string{"env", "-json"}, keys...)...)
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	env := map[string]string{}
+	if err := json.Unmarshal(out, &env); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
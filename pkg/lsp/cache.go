@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -12,10 +14,10 @@ import (
 
 	gsync "github.com/kralicky/gpkg/sync"
 	"github.com/kralicky/protocompile"
-	"github.com/kralicky/protocompile/ast"
 	"github.com/kralicky/protocompile/linker"
 	"github.com/kralicky/protocompile/parser"
 	"github.com/kralicky/protocompile/reporter"
+	"github.com/kralicky/protols/pkg/sources"
 	"github.com/kralicky/tools-lite/gopls/pkg/file"
 	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
 	"golang.org/x/sync/errgroup"
@@ -32,7 +34,10 @@ type Cache struct {
 	diagHandler *DiagnosticHandler
 	resultsMu   sync.RWMutex
 	results     linker.Files
+	refIndex    *referenceIndex
 	settings    atomic.Pointer[Settings]
+	snapshot    atomic.Pointer[Snapshot]
+	snapshotIDs atomic.Uint64
 
 	// partialResultsMu has an invariant that resultsMu is write-locked; it expects
 	// to be required only during compilation. This means that if resultsMu is
@@ -40,16 +45,42 @@ type Cache struct {
 	partialResultsMu       sync.Mutex
 	unlinkedResults        map[protocompile.ResolvedPath]parser.Result
 	partiallyLinkedResults map[protocompile.ResolvedPath]linker.Result
+	recompiledPaths        map[protocompile.ResolvedPath]struct{}
+	// paths which have been requested for compilation, but have not started
+	// compiling yet
+	compileQueue compileQueue
 
 	inflightTasksInvalidate gsync.Map[protocompile.ResolvedPath, time.Time]
 	inflightTasksCompile    gsync.Map[protocompile.ResolvedPath, time.Time]
 	pragmas                 gsync.Map[protocompile.ResolvedPath, *pragmaMap]
-
-	documentVersions *documentVersionQueue
+	tokenIndexes            gsync.Map[protocol.DocumentURI, *semanticTokenIndex]
+	pathMemos               gsync.Map[protocompile.ResolvedPath, *pathMemo]
+
+	documentVersions        *documentVersionQueue
+	baseline                *gitBaseline
+	externalAnalyzerResults *externalAnalyzerResults
+	// if true, no subprocesses are run for this cache
+	sandbox bool
+	// files which have not been compiled yet in lazy mode
+	pending pendingFiles
+	// called with the URIs of synthetic files whose contents changed
+	onSyntheticFilesChanged func(ctx context.Context, uris []protocol.DocumentURI)
+	// if true, workspace edits may contain file renames
+	fileRenames bool
+
+	// lifetime is cancelled when the cache is closed, which stops any
+	// compilations that are still in progress.
+	lifetime context.Context
+	close    context.CancelCauseFunc
+}
+
+type CacheOptions struct {
+	schemeHandlers          map[string]SchemeHandler
+	sandbox                 bool
+	onSyntheticFilesChanged func(ctx context.Context, uris []protocol.DocumentURI)
+	fileRenames             bool
 }
 
-type CacheOptions struct{}
-
 type CacheOption func(*CacheOptions)
 
 func (o *CacheOptions) apply(opts ...CacheOption) {
@@ -58,12 +89,28 @@ func (o *CacheOptions) apply(opts ...CacheOption) {
 	}
 }
 
+// WithSandboxedCache prevents the cache from running any subprocesses. Go
+// modules are not resolved, and the git baseline is unavailable.
+func WithSandboxedCache() CacheOption {
+	return func(o *CacheOptions) {
+		o.sandbox = true
+	}
+}
+
+// WithFileRenames indicates that the client can apply workspace edits which
+// rename files, allowing refactorings to move files as well as edit them.
+func WithFileRenames() CacheOption {
+	return func(o *CacheOptions) {
+		o.fileRenames = true
+	}
+}
+
 func NewCache(workspace protocol.WorkspaceFolder, opts ...CacheOption) *Cache {
 	options := CacheOptions{}
 	options.apply(opts...)
 	diagHandler := NewDiagnosticHandler()
 	reporter := reporter.NewReporter(diagHandler.HandleError, diagHandler.HandleWarning)
-	resolver := NewResolver(workspace)
+	resolver := newResolver(workspace, &options)
 	resolver.PreloadWellKnownPaths()
 
 	compiler := &Compiler{
@@ -78,18 +125,29 @@ func NewCache(workspace protocol.WorkspaceFolder, opts ...CacheOption) *Cache {
 			IncludeDependenciesInResults: true,
 			InterpretOptionsLenient:      true,
 		},
-		workdir: protocol.DocumentURI(workspace.URI).Path(),
+		workdir: uriPath(protocol.DocumentURI(workspace.URI)),
 	}
+	lifetime, close := context.WithCancelCause(context.Background())
 	cache := &Cache{
-		workspace:              workspace,
-		compiler:               compiler,
-		resolver:               resolver,
-		diagHandler:            diagHandler,
-		unlinkedResults:        make(map[protocompile.ResolvedPath]parser.Result),
-		partiallyLinkedResults: make(map[protocompile.ResolvedPath]linker.Result),
-		documentVersions:       newDocumentVersionQueue(),
+		lifetime:                lifetime,
+		close:                   close,
+		workspace:               workspace,
+		compiler:                compiler,
+		resolver:                resolver,
+		diagHandler:             diagHandler,
+		refIndex:                newReferenceIndex(),
+		unlinkedResults:         make(map[protocompile.ResolvedPath]parser.Result),
+		partiallyLinkedResults:  make(map[protocompile.ResolvedPath]linker.Result),
+		recompiledPaths:         make(map[protocompile.ResolvedPath]struct{}),
+		documentVersions:        newDocumentVersionQueue(),
+		baseline:                newGitBaseline(options.sandbox),
+		externalAnalyzerResults: newExternalAnalyzerResults(),
+		sandbox:                 options.sandbox,
+		onSyntheticFilesChanged: options.onSyntheticFilesChanged,
+		fileRenames:             options.fileRenames,
 	}
 	cache.DidChangeConfiguration(context.TODO(), Settings{}) // load default settings
+	cache.publishSnapshotLocked()
 
 	compiler.Hooks = protocompile.CompilerHooks{
 		PreInvalidate:  cache.preInvalidateHook,
@@ -100,18 +158,72 @@ func NewCache(workspace protocol.WorkspaceFolder, opts ...CacheOption) *Cache {
 	return cache
 }
 
+// Close cancels any in-progress compilations. The cache should not be used
+// after it has been closed.
+func (c *Cache) Close(cause error) {
+	c.close(cause)
+}
+
 func (c *Cache) LoadFiles(files []string) {
-	created := make([]file.Modification, len(files))
+	c.LoadFilesContext(c.lifetime, files)
+}
+
+// LoadFilesContext is like LoadFiles, but stops compiling early if ctx is
+// cancelled, leaving the remaining files unloaded.
+func (c *Cache) LoadFilesContext(ctx context.Context, files []string) {
+	uris := make([]protocol.DocumentURI, len(files))
 	for i, f := range files {
+		uris[i] = protocol.URIFromPath(f)
+	}
+	c.loadURIs(ctx, uris)
+}
+
+// LoadURIs is like LoadFiles, but accepts URIs, which may use any scheme
+// with a registered SchemeHandler.
+func (c *Cache) LoadURIs(uris []protocol.DocumentURI) {
+	c.loadURIs(c.lifetime, uris)
+}
+
+func (c *Cache) loadURIs(ctx context.Context, uris []protocol.DocumentURI) {
+	created := make([]file.Modification, len(uris))
+	for i, uri := range uris {
 		created[i] = file.Modification{
 			Action:  file.Create,
 			OnDisk:  true,
-			URI:     protocol.URIFromPath(f),
+			URI:     uri,
 			Version: -1,
 		}
 	}
 
-	c.DidModifyFiles(context.TODO(), created)
+	c.DidModifyFiles(ctx, created)
+}
+
+// loadWorkspaceFiles loads all .proto files in the workspace folder, then
+// starts warming up synthetic files for Go module imports in the background.
+func (c *Cache) loadWorkspaceFiles() {
+	c.LoadURIs(c.listWorkspaceFiles())
+	go c.warmSyntheticImports()
+}
+
+// listWorkspaceFiles returns the URIs of all .proto files in the workspace
+// folder which are not excluded, using the scheme handler for the workspace
+// URI if it is not a file:// URI.
+func (c *Cache) listWorkspaceFiles() []protocol.DocumentURI {
+	root := protocol.DocumentURI(c.workspace.URI)
+	if h, ok := c.resolver.fsDelegate.handlerFor(root); ok {
+		uris, err := h.ListProtoFiles(c.lifetime, root)
+		if err != nil {
+			slog.With("workspace", root, "error", err).Error("failed to list workspace files")
+			return nil
+		}
+		return slices.DeleteFunc(uris, c.isExcluded)
+	}
+	files := sources.SearchDirsExcluding(c.settings.Load().Exclude, root.Path())
+	uris := make([]protocol.DocumentURI, len(files))
+	for i, f := range files {
+		uris[i] = protocol.URIFromPath(f)
+	}
+	return uris
 }
 
 // FindDescriptorByName implements linker.Resolver.
@@ -205,7 +317,12 @@ func (c *Cache) findResultByPathLocked(path string) (linker.Result, error) {
 	if f == nil {
 		return nil, fmt.Errorf("FindResultByPath: package not found: %q", path)
 	}
-	return f.(linker.Result), nil
+	res, ok := f.(linker.Result)
+	if !ok {
+		// placeholder for a file that failed to link
+		return nil, fmt.Errorf("FindResultByPath: no linker result for %q", path)
+	}
+	return res, nil
 }
 
 func (c *Cache) findResultOrPartialResultByPathLocked(path string) (linker.Result, error) {
@@ -251,12 +368,16 @@ func (c *Cache) FindMessageByURL(url string) (protoreflect.MessageType, error) {
 	return c.results.AsResolver().FindMessageByURL(url)
 }
 
-func (c *Cache) FindTypeDescriptorAtLocation(params protocol.TextDocumentPositionParams) (protoreflect.Descriptor, protocol.Range, error) {
-	parseRes, err := c.FindParseResultByURI(params.TextDocument.URI)
+// FindTypeDescriptorAtLocation returns the descriptor referred to at the given
+// location, and the range of the reference. The parse and link results of the
+// file are both read from the given snapshot, so they come from the same
+// compilation.
+func (c *Cache) FindTypeDescriptorAtLocation(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams) (protoreflect.Descriptor, protocol.Range, error) {
+	parseRes, err := snapshot.FindParseResultByURI(params.TextDocument.URI)
 	if err != nil {
 		return nil, protocol.Range{}, err
 	}
-	linkRes, err := c.FindResultOrPartialResultByURI(params.TextDocument.URI)
+	linkRes, err := snapshot.FindResultOrPartialResultByURI(params.TextDocument.URI)
 	if err != nil {
 		return nil, protocol.Range{}, err
 	}
@@ -266,44 +387,48 @@ func (c *Cache) FindTypeDescriptorAtLocation(params protocol.TextDocumentPositio
 		return nil, protocol.Range{}, err
 	}
 
-	enc := semanticItems{
-		options: semanticItemsOptions{
-			skipComments: true,
-		},
-		parseRes:     parseRes,
-		maybeLinkRes: linkRes,
-	}
 	offset, err := mapper.PositionOffset(params.Position)
 	if err != nil {
 		return nil, protocol.Range{}, err
 	}
-	root := enc.AST()
+	root := linkRes.AST()
+	if root == nil {
+		root = parseRes.AST()
+	}
 	if root == nil {
 		return nil, protocol.Range{}, nil
 	}
-	token, comment := root.ItemAtOffset(offset)
-	if comment.IsValid() {
+	if _, comment := root.ItemAtOffset(offset); comment.IsValid() {
 		return nil, protocol.Range{}, nil
 	}
 
-	computeSemanticTokens(c, &enc, ast.WithIntersection(token))
-
-	item, found := findNarrowestSemanticToken(parseRes, enc.items, params.Position)
+	index := c.semanticTokenIndex(params.TextDocument.URI, parseRes, linkRes)
+	item, found := findNarrowestSemanticToken(parseRes, index.line(params.Position.Line), params.Position)
 	if !found {
 		return nil, protocol.Range{}, nil
 	}
 
-	return deepPathSearch(item.path, parseRes, linkRes)
+	return c.deepPathSearch(ctx, item.path, parseRes, linkRes)
 }
 
-func (c *Cache) FindDefinitionForTypeDescriptor(desc protoreflect.Descriptor) (protocol.Location, error) {
-	c.resultsMu.RLock()
-	defer c.resultsMu.RUnlock()
+// FindDefinitions returns the definition of the symbol at the given position,
+// which may be a type reference, a name in a string literal which refers to a
+// descriptor, or a package name. See FindDefinitionLinks for the declarations
+// related to custom options which are also returned.
+func (c *Cache) FindDefinitions(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams) ([]protocol.Location, error) {
+	links, err := c.FindDefinitionLinks(ctx, snapshot, params)
+	if err != nil {
+		return nil, err
+	}
+	return linksToLocations(links), nil
+}
+
+func (c *Cache) FindDefinitionForTypeDescriptor(snapshot *Snapshot, desc protoreflect.Descriptor) (protocol.Location, error) {
 	parentFile := desc.ParentFile()
 	if parentFile == nil {
 		return protocol.Location{}, fmt.Errorf("no parent file found for descriptor")
 	}
-	linkRes, err := c.findResultOrPartialResultByPathLocked(parentFile.Path())
+	linkRes, err := snapshot.FindResultOrPartialResultByPath(parentFile.Path())
 	if err != nil {
 		return protocol.Location{}, err
 	}
@@ -322,9 +447,45 @@ func (c *Cache) FindDefinitionForTypeDescriptor(desc protoreflect.Descriptor) (p
 	}, nil
 }
 
+// FindTypeDefinitionsAtLocation returns the definitions of the types of the
+// descriptor at the given location. See FindTypeDefinitionLinks.
+func (c *Cache) FindTypeDefinitionsAtLocation(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams) ([]protocol.Location, error) {
+	links, err := c.FindTypeDefinitionLinks(ctx, snapshot, params)
+	if err != nil {
+		return nil, err
+	}
+	return linksToLocations(links), nil
+}
+
 func (c *Cache) DidChangeConfiguration(ctx context.Context, settings Settings) error {
 	slog.Info("Configuration updated", "settings", settings)
-	c.settings.Store(&settings)
+	prev := c.settings.Swap(&settings)
+	if c.resolver.SetImportAliases(settings.ImportAliases) {
+		c.remapAliasedFiles(ctx)
+	}
+	if c.resolver.SetImportPrecedence(settings.ImportPrecedence) {
+		c.applyImportPrecedence(ctx)
+	}
+	if prev != nil && !slices.Equal(prev.Exclude, settings.Exclude) {
+		c.applyExcludes(ctx)
+	}
+	if c.resolver.SetSyntheticFileSettings(settings.SyntheticFiles) {
+		c.regenerateSyntheticFiles(ctx)
+	}
+	if settings.IndexArchive != "" && (prev == nil || prev.IndexArchive != settings.IndexArchive) {
+		filename := settings.IndexArchive
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(uriPath(protocol.DocumentURI(c.workspace.URI)), filename)
+		}
+		if n, err := c.ImportIndexFile(filename); err != nil {
+			slog.Warn("failed to import index archive", "path", filename, "error", err)
+		} else {
+			slog.Info("imported index archive", "path", filename, "files", n)
+		}
+	}
+	if !settings.Lazy {
+		c.IndexWorkspace(ctx)
+	}
 	return nil
 }
 
@@ -358,6 +519,30 @@ func (wd workspaceDescriptors) Len() int {
 	return wd.len
 }
 
+// linkedOrPartialResultsLocked returns the results to search when looking for
+// descriptors across the workspace. Files which failed to link are searched
+// using their partially linked results, including files which have never
+// linked successfully and so have no entry in c.results.
+func (c *Cache) linkedOrPartialResultsLocked() []linker.Result {
+	results := make([]linker.Result, 0, len(c.results))
+	seen := make(map[protocompile.ResolvedPath]struct{}, len(c.results))
+	for _, f := range c.results {
+		path := protocompile.ResolvedPath(f.Path())
+		seen[path] = struct{}{}
+		if !f.IsPlaceholder() {
+			results = append(results, f.(linker.Result))
+		} else if partial, ok := c.partiallyLinkedResults[path]; ok {
+			results = append(results, partial)
+		}
+	}
+	for path, partial := range c.partiallyLinkedResults {
+		if _, ok := seen[path]; !ok {
+			results = append(results, partial)
+		}
+	}
+	return results
+}
+
 func (c *Cache) FindAllDescriptorsByPrefix(ctx context.Context, prefix string, filter ...func(protoreflect.Descriptor) bool) WorkspaceDescriptors {
 	c.resultsMu.RLock()
 	defer c.resultsMu.RUnlock()
@@ -367,16 +552,10 @@ func (c *Cache) FindAllDescriptorsByPrefix(ctx context.Context, prefix string, f
 func (c *Cache) findAllDescriptorsByPrefixLocked(ctx context.Context, prefix string, filter ...func(protoreflect.Descriptor) bool) WorkspaceDescriptors {
 	eg, ctx := errgroup.WithContext(ctx)
 	eg.SetLimit(runtime.NumCPU())
-	descriptorsByFile := make([][]protoreflect.Descriptor, len(c.results))
-	pathIndex := make([]string, len(c.results))
-	for i, res := range c.results {
-		if res.IsPlaceholder() {
-			if partial, ok := c.partiallyLinkedResults[protocompile.ResolvedPath(res.Path())]; ok {
-				res = partial
-			} else {
-				continue
-			}
-		}
+	results := c.linkedOrPartialResultsLocked()
+	descriptorsByFile := make([][]protoreflect.Descriptor, len(results))
+	pathIndex := make([]string, len(results))
+	for i, res := range results {
 		pathIndex[i] = res.Path()
 		pkg := res.Package()
 		if pkg == "" {
@@ -384,7 +563,7 @@ func (c *Cache) findAllDescriptorsByPrefixLocked(ctx context.Context, prefix str
 			continue
 		}
 		eg.Go(func() (err error) {
-			descriptorsByFile[i], err = res.(linker.Result).FindDescriptorsByPrefix(ctx, string(pkg.Append(protoreflect.Name(prefix))), filter...)
+			descriptorsByFile[i], err = res.FindDescriptorsByPrefix(ctx, string(pkg.Append(protoreflect.Name(prefix))), filter...)
 			return
 		})
 	}
@@ -411,20 +590,14 @@ func (c *Cache) FindAllDescriptorsByQualifiedPrefix(ctx context.Context, prefix
 func (c *Cache) findAllDescriptorsByQualifiedPrefixLocked(ctx context.Context, prefix string, filter ...func(protoreflect.Descriptor) bool) WorkspaceDescriptors {
 	eg, ctx := errgroup.WithContext(ctx)
 	eg.SetLimit(runtime.NumCPU())
-	resultsByPackage := make([][]protoreflect.Descriptor, len(c.results))
-	pathIndex := make([]string, len(c.results))
+	results := c.linkedOrPartialResultsLocked()
+	resultsByPackage := make([][]protoreflect.Descriptor, len(results))
+	pathIndex := make([]string, len(results))
 	isFullyQualified := strings.HasPrefix(prefix, ".")
 	if isFullyQualified {
 		prefix = prefix[1:]
 	}
-	for i, res := range c.results {
-		if res.IsPlaceholder() {
-			if partial, ok := c.partiallyLinkedResults[protocompile.ResolvedPath(res.Path())]; ok {
-				res = partial
-			} else {
-				continue
-			}
-		}
+	for i, res := range results {
 		pathIndex[i] = res.Path()
 		pkg := res.Package()
 		if pkg == "" {
@@ -436,7 +609,7 @@ func (c *Cache) findAllDescriptorsByQualifiedPrefixLocked(ctx context.Context, p
 			continue
 		}
 		eg.Go(func() (err error) {
-			resultsByPackage[i], err = res.(linker.Result).FindDescriptorsByPrefix(ctx, prefix, filter...)
+			resultsByPackage[i], err = res.FindDescriptorsByPrefix(ctx, prefix, filter...)
 			return
 		})
 	}
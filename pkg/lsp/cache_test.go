@@ -0,0 +1,51 @@
+package lsp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// newTestCache writes files to a new workspace directory and returns a
+// sandboxed cache for it, along with the directory. If settings is non-nil,
+// it is applied before every .proto file in files is loaded. The cache is
+// closed when the test completes.
+func newTestCache(t *testing.T, files map[string]string, settings *Settings) (*Cache, string) {
+	t.Helper()
+	workspace := t.TempDir()
+	writeFiles(t, workspace, files)
+	c := NewCache(protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(workspace))}, WithSandboxedCache())
+	t.Cleanup(func() { c.Close(nil) })
+	if settings != nil {
+		if err := c.DidChangeConfiguration(context.Background(), *settings); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var filenames []string
+	for name := range files {
+		if strings.HasSuffix(name, ".proto") {
+			filenames = append(filenames, filepath.Join(workspace, name))
+		}
+	}
+	slices.Sort(filenames)
+	c.LoadFiles(filenames)
+	return c, workspace
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
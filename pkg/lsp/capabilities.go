@@ -0,0 +1,308 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// supportsMarkdown reports whether a client which declared the given content
+// formats can render markdown. Clients which do not declare any formats are
+// assumed to support markdown, as most do.
+func supportsMarkdown(formats []protocol.MarkupKind) bool {
+	return len(formats) == 0 || slices.Contains(formats, protocol.Markdown)
+}
+
+var (
+	markdownLink       = regexp.MustCompile(`\[([^\]]*)\]\(([^)]*)\)`)
+	markdownEmphasis   = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	markdownInlineCode = regexp.MustCompile("`([^`]*)`")
+)
+
+// markdownToPlainText converts the markdown written by the server into text
+// which reads well when displayed verbatim: code fences are removed (keeping
+// their contents), links are replaced with their text followed by the target,
+// and emphasis and inline code markers are dropped.
+func markdownToPlainText(md string) string {
+	var b strings.Builder
+	inCode := false
+	for i, line := range strings.Split(md, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if i > 0 && b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		if !inCode {
+			line = markdownLink.ReplaceAllStringFunc(line, func(link string) string {
+				m := markdownLink.FindStringSubmatch(link)
+				if m[1] == m[2] || m[2] == "" {
+					return m[1]
+				}
+				return fmt.Sprintf("%s (%s)", m[1], m[2])
+			})
+			line = markdownEmphasis.ReplaceAllString(line, "$1$2")
+			line = markdownInlineCode.ReplaceAllString(line, "$1")
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// plainTextMarkup converts markdown content to plain text.
+func plainTextMarkup(content protocol.MarkupContent) protocol.MarkupContent {
+	if content.Kind != protocol.Markdown {
+		return content
+	}
+	return protocol.MarkupContent{
+		Kind:  protocol.PlainText,
+		Value: markdownToPlainText(content.Value),
+	}
+}
+
+// adaptHover converts the contents of a hover to plain text if the client
+// cannot render markdown hovers. Hovers are always computed as markdown, and
+// converted afterwards rather than generated in the client's format: they
+// only use fenced code blocks, inline code, links and emphasis, which
+// markdownToPlainText reduces to their text without losing information, and
+// this keeps the format out of each of the hover builders.
+func (s *Server) adaptHover(hover *protocol.Hover) {
+	if hover == nil || s.clientCapabilities.TextDocument.Hover == nil ||
+		supportsMarkdown(s.clientCapabilities.TextDocument.Hover.ContentFormat) {
+		return
+	}
+	hover.Contents = plainTextMarkup(hover.Contents)
+}
+
+// adaptCompletionDocs converts the documentation of completion items to plain
+// text if the client cannot render markdown documentation.
+func (s *Server) adaptCompletionDocs(list *protocol.CompletionList) {
+	if list == nil || supportsMarkdown(s.clientCapabilities.TextDocument.Completion.CompletionItem.DocumentationFormat) {
+		return
+	}
+	for i, item := range list.Items {
+		if item.Documentation == nil {
+			continue
+		}
+		if content, ok := item.Documentation.Value.(protocol.MarkupContent); ok {
+			list.Items[i].Documentation = &protocol.Or_CompletionItem_documentation{
+				Value: plainTextMarkup(content),
+			}
+		}
+	}
+}
+
+// adaptWorkspaceEdit rewrites an edit into a form the client can apply.
+// Document changes are flattened into a map of text edits for clients which
+// do not support versioned document changes. An error is returned if the edit
+// contains file operations the client does not support, since they cannot be
+// expressed any other way.
+func (s *Server) adaptWorkspaceEdit(edit *protocol.WorkspaceEdit) error {
+	if edit == nil || len(edit.DocumentChanges) == 0 {
+		return nil
+	}
+	caps := s.clientCapabilities.Workspace.WorkspaceEdit
+	var resourceOps []protocol.ResourceOperationKind
+	if caps != nil {
+		resourceOps = caps.ResourceOperations
+	}
+	for _, change := range edit.DocumentChanges {
+		if change.RenameFile != nil && (caps == nil || !caps.DocumentChanges || !slices.Contains(resourceOps, protocol.Rename)) {
+			return fmt.Errorf("the client does not support renaming files in workspace edits (%s -> %s)",
+				change.RenameFile.OldURI.Path(), change.RenameFile.NewURI.Path())
+		}
+	}
+	if caps != nil && caps.DocumentChanges {
+		return nil
+	}
+	changes := make(map[protocol.DocumentURI][]protocol.TextEdit, len(edit.DocumentChanges))
+	for uri, edits := range edit.Changes {
+		changes[uri] = append(changes[uri], edits...)
+	}
+	for _, change := range edit.DocumentChanges {
+		if change.TextDocumentEdit == nil {
+			continue
+		}
+		uri := change.TextDocumentEdit.TextDocument.URI
+		for _, e := range change.TextDocumentEdit.Edits {
+			switch e := e.Value.(type) {
+			case protocol.TextEdit:
+				changes[uri] = append(changes[uri], e)
+			case protocol.AnnotatedTextEdit:
+				changes[uri] = append(changes[uri], e.TextEdit)
+			}
+		}
+	}
+	edit.Changes = changes
+	edit.DocumentChanges = nil
+	return nil
+}
+
+// semanticTokenLegend is the subset of the server's semantic token modifiers
+// which the client declared support for. Tokens are computed with the full
+// set of modifiers, and remapped to the legend before they are sent.
+type semanticTokenLegend struct {
+	modifiers []string
+	// the bit of each server modifier in the legend, or -1 if the client does
+	// not support it; nil if the legend contains every modifier
+	remap []int
+}
+
+func newSemanticTokenLegend(caps protocol.SemanticTokensClientCapabilities) semanticTokenLegend {
+	legend := semanticTokenLegend{modifiers: []string{}}
+	remap := make([]int, len(semanticTokenModifiers))
+	identity := true
+	for i, modifier := range semanticTokenModifiers {
+		if !slices.Contains(caps.TokenModifiers, modifier) {
+			remap[i] = -1
+			identity = false
+			continue
+		}
+		remap[i] = len(legend.modifiers)
+		if remap[i] != i {
+			identity = false
+		}
+		legend.modifiers = append(legend.modifiers, modifier)
+	}
+	if !identity {
+		legend.remap = remap
+	}
+	return legend
+}
+
+// remapModifiers rewrites the modifier sets in encoded token data (five
+// integers per token, the last being the modifier set) to use the legend.
+func (l semanticTokenLegend) remapModifiers(data []uint32) {
+	if l.remap == nil {
+		return
+	}
+	for i := 4; i < len(data); i += 5 {
+		var mods uint32
+		for bit, to := range l.remap {
+			if to >= 0 && data[i]&(1<<bit) != 0 {
+				mods |= 1 << to
+			}
+		}
+		data[i] = mods
+	}
+}
+
+// semanticTokensOptions returns the semantic token provider options for the
+// requests the client supports, or nil if it does not support any.
+func semanticTokensOptions(caps protocol.SemanticTokensClientCapabilities, legend semanticTokenLegend) *protocol.SemanticTokensOptions {
+	supported := func(v any) bool {
+		b, isBool := v.(bool)
+		return v != nil && (!isBool || b)
+	}
+	var opts protocol.SemanticTokensOptions
+	if caps.Requests.Full != nil && supported(caps.Requests.Full.Value) {
+		opts.Full = &protocol.Or_SemanticTokensOptions_full{Value: true}
+	}
+	if caps.Requests.Range != nil && supported(caps.Requests.Range.Value) {
+		opts.Range = &protocol.Or_SemanticTokensOptions_range{Value: true}
+	}
+	if opts.Full == nil && opts.Range == nil {
+		return nil
+	}
+	opts.Legend = protocol.SemanticTokensLegend{
+		TokenTypes:     semanticTokenTypes,
+		TokenModifiers: legend.modifiers,
+	}
+	return &opts
+}
+
+// adaptCompletionSnippets converts snippet completions to plain text if the
+// client does not support snippets.
+func (s *Server) adaptCompletionSnippets(list *protocol.CompletionList) {
+	if list == nil || s.clientCapabilities.TextDocument.Completion.CompletionItem.SnippetSupport {
+		return
+	}
+	plainText := protocol.PlainTextTextFormat
+	for i, item := range list.Items {
+		if item.InsertTextFormat == nil || *item.InsertTextFormat != protocol.SnippetTextFormat {
+			continue
+		}
+		item.InsertText = snippetToPlainText(item.InsertText)
+		if item.TextEditText != "" {
+			item.TextEditText = snippetToPlainText(item.TextEditText)
+		}
+		if item.TextEdit != nil {
+			switch edit := item.TextEdit.Value.(type) {
+			case protocol.TextEdit:
+				edit.NewText = snippetToPlainText(edit.NewText)
+				item.TextEdit = &protocol.Or_CompletionItem_textEdit{Value: edit}
+			case protocol.InsertReplaceEdit:
+				edit.NewText = snippetToPlainText(edit.NewText)
+				item.TextEdit = &protocol.Or_CompletionItem_textEdit{Value: edit}
+			}
+		}
+		item.InsertTextFormat = &plainText
+		list.Items[i] = item
+	}
+}
+
+// snippetToPlainText returns the text a snippet would insert if none of its
+// tab stops were edited: empty tab stops are removed, placeholders are
+// replaced by their default text, and choices by their first option.
+func snippetToPlainText(snippet string) string {
+	var b strings.Builder
+	var expand func(s string, nested bool) int
+	// expand writes the text of s up to the end of the snippet, or up to the
+	// closing brace of a placeholder if nested is true, and returns the number
+	// of bytes of s that were consumed.
+	expand = func(s string, nested bool) int {
+		i := 0
+		for i < len(s) {
+			c := s[i]
+			switch {
+			case c == '\\' && i+1 < len(s) && strings.IndexByte(`$}\`, s[i+1]) >= 0:
+				b.WriteByte(s[i+1])
+				i += 2
+			case c == '}' && nested:
+				return i + 1
+			case c == '$' && i+1 < len(s) && isDigit(s[i+1]):
+				i++
+				for i < len(s) && isDigit(s[i]) {
+					i++
+				}
+			case c == '$' && i+2 < len(s) && s[i+1] == '{' && isDigit(s[i+2]):
+				j := i + 2
+				for j < len(s) && isDigit(s[j]) {
+					j++
+				}
+				switch {
+				case j < len(s) && s[j] == '}':
+					i = j + 1
+				case j < len(s) && s[j] == ':':
+					i = j + 1 + expand(s[j+1:], true)
+				case j < len(s) && s[j] == '|':
+					end := strings.Index(s[j+1:], "|}")
+					if end < 0 {
+						b.WriteString(s[i:])
+						return len(s)
+					}
+					choice, _, _ := strings.Cut(s[j+1:j+1+end], ",")
+					b.WriteString(choice)
+					i = j + 1 + end + 2
+				default:
+					b.WriteString(s[i:j])
+					i = j
+				}
+			default:
+				b.WriteByte(c)
+				i++
+			}
+		}
+		return i
+	}
+	expand(snippet, false)
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
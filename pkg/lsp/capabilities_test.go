@@ -0,0 +1,139 @@
+package lsp
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestMarkdownToPlainText(t *testing.T) {
+	md := "```protobuf\nmessage Foo {}\n```\n**Deprecated:** use [Bar](file:///bar.proto) or `Baz` instead"
+	want := "message Foo {}\nDeprecated: use Bar (file:///bar.proto) or Baz instead"
+	if got := markdownToPlainText(md); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSemanticTokenLegend(t *testing.T) {
+	all := newSemanticTokenLegend(protocol.SemanticTokensClientCapabilities{TokenModifiers: semanticTokenModifiers})
+	if all.remap != nil || !slices.Equal(all.modifiers, semanticTokenModifiers) {
+		t.Fatalf("expected the full legend, got %v", all.modifiers)
+	}
+
+	legend := newSemanticTokenLegend(protocol.SemanticTokensClientCapabilities{
+		TokenModifiers: []string{string(protocol.ModDefinition), string(protocol.ModDeprecated)},
+	})
+	if !slices.Equal(legend.modifiers, []string{string(protocol.ModDefinition), string(protocol.ModDeprecated)}) {
+		t.Fatalf("unexpected legend %v", legend.modifiers)
+	}
+	data := []uint32{
+		0, 0, 3, 1, uint32(semanticModifierDefinition | semanticModifierDeprecated | semanticModifierReadonly),
+		1, 0, 3, 1, uint32(semanticModifierDeclaration),
+	}
+	legend.remapModifiers(data)
+	if data[4] != 0b11 || data[9] != 0 {
+		t.Errorf("unexpected modifiers after remapping: %b %b", data[4], data[9])
+	}
+
+	if opts := semanticTokensOptions(protocol.SemanticTokensClientCapabilities{}, legend); opts != nil {
+		t.Errorf("expected no semantic tokens provider for a client without semantic token support")
+	}
+	opts := semanticTokensOptions(protocol.SemanticTokensClientCapabilities{
+		Requests: protocol.ClientSemanticTokensRequestOptions{
+			Full:  &protocol.Or_ClientSemanticTokensRequestOptions_full{Value: map[string]any{"delta": false}},
+			Range: &protocol.Or_ClientSemanticTokensRequestOptions_range{Value: false},
+		},
+	}, legend)
+	if opts == nil || opts.Full == nil || opts.Range != nil {
+		t.Errorf("expected only full semantic tokens, got %+v", opts)
+	}
+}
+
+func TestAdaptWorkspaceEdit(t *testing.T) {
+	const uri = protocol.DocumentURI("file:///workspace/a.proto")
+	newEdit := func() *protocol.WorkspaceEdit {
+		return &protocol.WorkspaceEdit{
+			DocumentChanges: protocol.TextEditsToDocumentChanges(uri, 1, []protocol.TextEdit{{NewText: "x"}}),
+		}
+	}
+
+	s := &Server{}
+	edit := newEdit()
+	if err := s.adaptWorkspaceEdit(edit); err != nil {
+		t.Fatal(err)
+	}
+	if edit.DocumentChanges != nil || len(edit.Changes[uri]) != 1 || edit.Changes[uri][0].NewText != "x" {
+		t.Errorf("expected document changes to be flattened, got %+v", edit)
+	}
+
+	s.clientCapabilities.Workspace.WorkspaceEdit = &protocol.WorkspaceEditClientCapabilities{DocumentChanges: true}
+	edit = newEdit()
+	if err := s.adaptWorkspaceEdit(edit); err != nil {
+		t.Fatal(err)
+	}
+	if len(edit.DocumentChanges) != 1 || edit.Changes != nil {
+		t.Errorf("expected document changes to be kept, got %+v", edit)
+	}
+
+	edit.DocumentChanges = append(edit.DocumentChanges, protocol.DocumentChanges{
+		RenameFile: &protocol.RenameFile{Kind: "rename", OldURI: uri, NewURI: "file:///workspace/b.proto"},
+	})
+	if err := s.adaptWorkspaceEdit(edit); err == nil {
+		t.Error("expected an error for a file rename the client does not support")
+	}
+	s.clientCapabilities.Workspace.WorkspaceEdit.ResourceOperations = []protocol.ResourceOperationKind{protocol.Rename}
+	if err := s.adaptWorkspaceEdit(edit); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSnippetToPlainText(t *testing.T) {
+	for _, tc := range []struct {
+		snippet, want string
+	}{
+		{"foo: {\n  ${0}\n}", "foo: {\n  \n}"},
+		{"foo: [${0}]", "foo: []"},
+		{`json_name = "${0}"`, `json_name = ""`},
+		{"foo = ${0};", "foo = ;"},
+		{"option (foo) = {$0});", "option (foo) = {});"},
+		{"foo: [$1, ${2:bar}]$0", "foo: [, bar]"},
+		{"{ seconds: ${1:0}, nanos: ${2:0} }", "{ seconds: 0, nanos: 0 }"},
+		{"m = {key: ${1:string}, value: ${2:int32}};", "m = {key: string, value: int32};"},
+		{"${1|a,b|} = $2 x", "a =  x"},
+		{`syntax = "proto3";` + "\n", `syntax = "proto3";` + "\n"},
+		{`cost \$5 ${1:a\}b}`, `cost $5 a}b`},
+	} {
+		if got := snippetToPlainText(tc.snippet); got != tc.want {
+			t.Errorf("snippetToPlainText(%q) = %q, want %q", tc.snippet, got, tc.want)
+		}
+	}
+}
+
+func TestAdaptCompletionSnippets(t *testing.T) {
+	snippet := protocol.SnippetTextFormat
+	list := &protocol.CompletionList{Items: []protocol.CompletionItem{{
+		Label:            "foo",
+		InsertTextFormat: &snippet,
+		TextEdit: &protocol.Or_CompletionItem_textEdit{
+			Value: protocol.TextEdit{NewText: "foo: [${0}]"},
+		},
+	}}}
+
+	s := &Server{}
+	s.clientCapabilities.TextDocument.Completion.CompletionItem.SnippetSupport = true
+	s.adaptCompletionSnippets(list)
+	if *list.Items[0].InsertTextFormat != protocol.SnippetTextFormat {
+		t.Fatal("snippets should be kept for clients which support them")
+	}
+
+	s.clientCapabilities.TextDocument.Completion.CompletionItem.SnippetSupport = false
+	s.adaptCompletionSnippets(list)
+	item := list.Items[0]
+	if *item.InsertTextFormat != protocol.PlainTextTextFormat {
+		t.Error("expected a plain text completion")
+	}
+	if edit := item.TextEdit.Value.(protocol.TextEdit); edit.NewText != "foo: []" {
+		t.Errorf("unexpected text %q", edit.NewText)
+	}
+}
@@ -55,17 +55,36 @@ func (c *Cache) GetCodeActions(ctx context.Context, params *protocol.CodeActionP
 						}
 						result = append(result, actions...)
 					}
+				case diagnosticKindLint:
+					if newName := data.Metadata[diagnosticRenameTo]; newName != "" && want[protocol.QuickFix] {
+						if action, ok := c.renameQuickFix(ctx, params.TextDocument, d, newName); ok {
+							result = append(result, action)
+						}
+					}
 				}
 			}
 		}
 	}
-	if want[protocol.RefactorExtract] || want[protocol.RefactorInline] || want[protocol.RefactorRewrite] {
+	if want[protocol.QuickFix] && len(diagnostics) > 0 {
+		if parseRes, err := c.FindParseResultByURI(params.TextDocument.URI); err == nil {
+			result = append(result, enumQuickFixes(parseRes, params.TextDocument.URI, diagnostics)...)
+		}
+	}
+	if want[protocol.RefactorExtract] || want[protocol.RefactorInline] || want[protocol.RefactorRewrite] || want[SourceSortMembers] {
 		if linkRes, err := c.FindResultOrPartialResultByURI(params.TextDocument.URI); err == nil {
 			mapper, err := c.GetMapper(params.TextDocument.URI)
 			if err != nil {
 				return nil, err
 			}
-			result = append(result, FindRefactorActions(ctx, params, linkRes, mapper, want)...)
+			result = append(result, c.FindRefactorActions(ctx, params, linkRes, mapper, want)...)
+			if want[protocol.RefactorExtract] {
+				result = append(result, c.extractToFileActions(ctx, params, linkRes, mapper)...)
+			}
+			if want[protocol.RefactorRewrite] {
+				result = append(result, c.compactFieldNumbers(ctx, params, linkRes, mapper)...)
+				result = append(result, c.mergeDuplicateMessageActions(ctx, params, linkRes, mapper)...)
+				result = append(result, c.importVisibilityActions(ctx, params, linkRes, mapper)...)
+			}
 		}
 	}
 
@@ -153,6 +172,7 @@ var supportedCodeActions = map[protocol.CodeActionKind]bool{
 	protocol.RefactorRewrite:       true,
 	protocol.RefactorInline:        true,
 	protocol.RefactorExtract:       true,
+	SourceSortMembers:              true,
 }
 
 // Logic here copied from gopls/internal/server/code_action.go
@@ -186,3 +206,24 @@ func requestedActionKinds(only []protocol.CodeActionKind) (map[protocol.CodeActi
 	}
 	return want, nil
 }
+
+// renameQuickFix returns a quick fix which renames the declaration at the
+// start of the diagnostic's range, along with all of its references.
+func (c *Cache) renameQuickFix(ctx context.Context, doc protocol.TextDocumentIdentifier, d protocol.Diagnostic, newName string) (protocol.CodeAction, bool) {
+	edit, err := c.Rename(ctx, &protocol.RenameParams{
+		TextDocument: doc,
+		Position:     d.Range.Start,
+		NewName:      newName,
+	})
+	if err != nil {
+		slog.Debug("rename quick fix unavailable", "newName", newName, "error", err)
+		return protocol.CodeAction{}, false
+	}
+	return protocol.CodeAction{
+		Title:       fmt.Sprintf("Rename to %s", newName),
+		Kind:        protocol.QuickFix,
+		Diagnostics: []protocol.Diagnostic{d},
+		IsPreferred: true,
+		Edit:        edit,
+	}, true
+}
@@ -4,19 +4,17 @@ import (
 	"encoding/json"
 
 	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protols/pkg/protocolext"
 	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-func (c *Cache) ComputeCodeLens(uri protocol.DocumentURI) ([]protocol.CodeLens, error) {
-	c.resultsMu.RLock()
-	defer c.resultsMu.RUnlock()
-
+func (c *Cache) ComputeCodeLens(snapshot *Snapshot, uri protocol.DocumentURI) ([]protocol.CodeLens, error) {
 	if !c.resolver.IsRealWorkspaceLocalFile(uri) {
 		return nil, nil
 	}
 
-	parseRes, err := c.FindParseResultByURI(uri)
+	parseRes, err := snapshot.FindParseResultByURI(uri)
 	if err != nil {
 		return nil, err
 	}
@@ -25,7 +23,7 @@ func (c *Cache) ComputeCodeLens(uri protocol.DocumentURI) ([]protocol.CodeLens,
 	}
 
 	var codeLenses []protocol.CodeLens
-	req, _ := json.Marshal(GenerateCodeRequest{
+	req, _ := json.Marshal(protocolext.GenerateCodeRequest{
 		URIs: []protocol.DocumentURI{uri},
 	})
 
@@ -33,7 +31,7 @@ func (c *Cache) ComputeCodeLens(uri protocol.DocumentURI) ([]protocol.CodeLens,
 		protocol.CodeLens{
 			Command: &protocol.Command{
 				Title:     "Generate File",
-				Command:   "protols.generate",
+				Command:   protocolext.ClientGenerateCommand,
 				Arguments: []json.RawMessage{json.RawMessage(req)},
 			},
 		},
@@ -41,7 +39,7 @@ func (c *Cache) ComputeCodeLens(uri protocol.DocumentURI) ([]protocol.CodeLens,
 
 	if pkg := protoreflect.FullName(parseRes.FileDescriptorProto().GetPackage()); pkg != "" {
 		var uris []protocol.DocumentURI
-		c.results.RangeFilesByPackage(pkg, func(f linker.File) bool {
+		snapshot.Results().RangeFilesByPackage(pkg, func(f linker.File) bool {
 			uri, err := c.resolver.PathToURI(f.Path())
 			if err != nil {
 				return true
@@ -49,28 +47,28 @@ func (c *Cache) ComputeCodeLens(uri protocol.DocumentURI) ([]protocol.CodeLens,
 			uris = append(uris, uri)
 			return true
 		})
-		req, _ := json.Marshal(GenerateCodeRequest{
+		req, _ := json.Marshal(protocolext.GenerateCodeRequest{
 			URIs: uris,
 		})
 		codeLenses = append(codeLenses,
 			protocol.CodeLens{
 				Command: &protocol.Command{
 					Title:     "Generate Package",
-					Command:   "protols.generate",
+					Command:   protocolext.ClientGenerateCommand,
 					Arguments: []json.RawMessage{json.RawMessage(req)},
 				},
 			},
 		)
 	}
 
-	req, _ = json.Marshal(GenerateWorkspaceRequest{
+	req, _ = json.Marshal(protocolext.GenerateWorkspaceRequest{
 		Workspace: c.workspace,
 	})
 	codeLenses = append(codeLenses,
 		protocol.CodeLens{
 			Command: &protocol.Command{
 				Title:     "Generate Workspace",
-				Command:   "protols.generateWorkspace",
+				Command:   protocolext.ClientGenerateWorkspaceCommand,
 				Arguments: []json.RawMessage{json.RawMessage(req)},
 			},
 		},
@@ -0,0 +1,107 @@
+package lsp
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ComputeDocumentColors returns the colors held in string option values
+// assigned to the fields listed in the colorFields setting. Colors are written
+// as hex strings, in one of the forms "#rgb", "#rgba", "#rrggbb" or
+// "#rrggbbaa". The color's range excludes the quotes, so that it is replaced
+// with the new value when the color is edited.
+func (c *Cache) ComputeDocumentColors(snapshot *Snapshot, doc protocol.TextDocumentIdentifier) ([]protocol.ColorInformation, error) {
+	colorFields := c.settings.Load().ColorFields
+	if len(colorFields) == 0 {
+		return nil, nil
+	}
+	res, err := snapshot.FindResultOrPartialResultByURI(doc.URI)
+	if err != nil {
+		return nil, err
+	}
+	fileNode := res.AST()
+	if fileNode == nil {
+		return nil, nil
+	}
+	var colors []protocol.ColorInformation
+	rangeOptionValues(res, snapshot, func(fd protoreflect.FieldDescriptor, val *ast.ValueNode) {
+		if fd.Kind() != protoreflect.StringKind || !slices.Contains(colorFields, string(fd.FullName())) {
+			return
+		}
+		lit := val.GetStringLiteral()
+		if lit == nil {
+			return
+		}
+		color, ok := parseHexColor(lit.GetVal())
+		if !ok {
+			return
+		}
+		rng := toRange(fileNode.NodeInfo(lit))
+		if rng.Start.Line != rng.End.Line {
+			return
+		}
+		rng.Start.Character++
+		rng.End.Character--
+		colors = append(colors, protocol.ColorInformation{Range: rng, Color: color})
+	})
+	return colors, nil
+}
+
+// ComputeColorPresentations returns the hex string form of a color picked in
+// the editor. The alpha component is only included if the color is not
+// fully opaque.
+func ComputeColorPresentations(params protocol.ColorPresentationParams) []protocol.ColorPresentation {
+	label := formatHexColor(params.Color)
+	return []protocol.ColorPresentation{
+		{
+			Label:    label,
+			TextEdit: &protocol.TextEdit{Range: params.Range, NewText: label},
+		},
+	}
+}
+
+func parseHexColor(s string) (protocol.Color, bool) {
+	if len(s) == 0 || s[0] != '#' {
+		return protocol.Color{}, false
+	}
+	digits := s[1:]
+	var components []string
+	switch len(digits) {
+	case 3, 4:
+		for _, d := range digits {
+			components = append(components, string(d)+string(d))
+		}
+	case 6, 8:
+		for i := 0; i < len(digits); i += 2 {
+			components = append(components, digits[i:i+2])
+		}
+	default:
+		return protocol.Color{}, false
+	}
+	values := []float64{0, 0, 0, 1}
+	for i, comp := range components {
+		n, err := strconv.ParseUint(comp, 16, 8)
+		if err != nil {
+			return protocol.Color{}, false
+		}
+		values[i] = float64(n) / 255
+	}
+	return protocol.Color{Red: values[0], Green: values[1], Blue: values[2], Alpha: values[3]}, true
+}
+
+func formatHexColor(color protocol.Color) string {
+	component := func(v float64) uint8 {
+		return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+	}
+	s := fmt.Sprintf("#%02x%02x%02x", component(color.Red), component(color.Green), component(color.Blue))
+	if a := component(color.Alpha); a != 255 {
+		s += fmt.Sprintf("%02x", a)
+	}
+	return s
+}
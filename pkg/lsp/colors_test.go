@@ -0,0 +1,64 @@
+package lsp
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestDocumentColors(t *testing.T) {
+	const source = `syntax = "proto3";
+package ui;
+import "google/protobuf/descriptor.proto";
+message Style {
+  string background = 1;
+  string label = 2;
+}
+extend google.protobuf.FieldOptions {
+  string color = 50000;
+  Style style = 50001;
+}
+message Button {
+  string text = 1 [(color) = "#ff8800"];
+  string icon = 2 [(style) = { background: "#00f8", label: "#00f8" }];
+  string hint = 3 [(color) = "orange"];
+}
+`
+	c, workspace := newTestCache(t, map[string]string{"ui.proto": source}, &Settings{
+		ColorFields: []string{"ui.color", "ui.Style.background"},
+	})
+
+	colors, err := c.ComputeDocumentColors(c.Snapshot(), protocol.TextDocumentIdentifier{URI: protocol.URIFromPath(filepath.Join(workspace, "ui.proto"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []protocol.ColorInformation{
+		{
+			Range: protocol.Range{Start: protocol.Position{Line: 12, Character: 30}, End: protocol.Position{Line: 12, Character: 37}},
+			Color: protocol.Color{Red: 1, Green: 136.0 / 255, Blue: 0, Alpha: 1},
+		},
+		{
+			Range: protocol.Range{Start: protocol.Position{Line: 13, Character: 44}, End: protocol.Position{Line: 13, Character: 49}},
+			Color: protocol.Color{Red: 0, Green: 0, Blue: 1, Alpha: 136.0 / 255},
+		},
+	}
+	if len(colors) != len(want) {
+		t.Fatalf("got %d colors, want %d: %v", len(colors), len(want), colors)
+	}
+	for i := range want {
+		if colors[i] != want[i] {
+			t.Errorf("color %d: got %+v, want %+v", i, colors[i], want[i])
+		}
+	}
+
+	for _, color := range want {
+		presentations := ComputeColorPresentations(protocol.ColorPresentationParams{Color: color.Color, Range: color.Range})
+		if len(presentations) != 1 {
+			t.Fatalf("got %d presentations", len(presentations))
+		}
+		if parsed, ok := parseHexColor(presentations[0].Label); !ok || parsed != color.Color {
+			t.Errorf("presentation %q does not round-trip %+v", presentations[0].Label, color.Color)
+		}
+	}
+}
@@ -6,66 +6,28 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"os"
 	"runtime"
+	"slices"
+	"strings"
 
 	"github.com/kralicky/protols/pkg/format"
+	"github.com/kralicky/protols/pkg/protocolext"
 	"github.com/kralicky/tools-lite/gopls/pkg/file"
 	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
 )
 
-type SelectRangeParams struct {
-	// A range in the current document that should be selected. Setting the
-	// start and end position to the same location has the effect of
-	// moving the cursor to that location.
-	SelectRange protocol.Range `json:"selectRange"`
-	// A range in the current document that will be revealed by the editor.
-	RevealRange protocol.Range `json:"revealRange"`
-	// Whether to highlight the revealed range.
-	HighlightRevealedRange bool `json:"highlightRevealedRange"`
-}
-
-func NewSelectRangeCommand(params SelectRangeParams) *protocol.Command {
+func NewSelectRangeCommand(params protocolext.SelectRangeParams) *protocol.Command {
 	paramsData, _ := json.Marshal(params)
 	return &protocol.Command{
-		Command: "protols.api.selectRange",
+		Command: protocolext.SelectRangeCommand,
 		Arguments: []json.RawMessage{
 			json.RawMessage(paramsData),
 		},
 	}
 }
 
-type SyntheticFileContentsRequest struct {
-	// The URI of the file to update.
-	URI string `json:"uri"`
-}
-
-type DocumentASTRequest struct {
-	// The URI of the file to retrieve the AST for.
-	URI     string `json:"uri"`
-	Version int32  `json:"version"`
-}
-
-type ReindexWorkspacesRequest struct{}
-
-type RefreshModulesRequest struct {
-	Workspace protocol.WorkspaceFolder `json:"workspace"`
-}
-
-type GeneratedDefinitionParams struct {
-	protocol.TextDocumentPositionParams
-}
-
-type GenerateCodeRequest struct {
-	// The URIs of the files to generate code for. All URIs in this list must
-	// belong to the same workspace; the server will look at the first URI in
-	// the list to determine which workspace to use.
-	URIs []protocol.DocumentURI `json:"uris"`
-}
-
-type GenerateWorkspaceRequest struct {
-	Workspace protocol.WorkspaceFolder `json:"workspace"`
-}
-
 type UnknownCommandHandler interface {
 	Execute(ctx context.Context, uc UnknownCommand) (any, error)
 }
@@ -79,8 +41,8 @@ type UnknownCommand struct {
 // ExecuteCommand implements protocol.Server.
 func (s *Server) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCommandParams) (any, error) {
 	switch params.Command {
-	case "protols/syntheticFileContents":
-		var req SyntheticFileContentsRequest
+	case protocolext.SyntheticFileContentsCommand:
+		var req protocolext.SyntheticFileContentsRequest
 		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
 			return nil, err
 		}
@@ -89,8 +51,8 @@ func (s *Server) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCom
 			return nil, err
 		}
 		return c.GetSyntheticFileContents(ctx, protocol.DocumentURI(req.URI))
-	case "protols/ast":
-		var req DocumentASTRequest
+	case protocolext.DocumentASTCommand:
+		var req protocolext.DocumentASTRequest
 		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
 			return nil, err
 		}
@@ -106,7 +68,7 @@ func (s *Server) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCom
 			return nil, err
 		}
 		return format.DumpAST(parseRes.AST(), parseRes), nil
-	case "protols/reindexWorkspaces":
+	case protocolext.ReindexWorkspacesCommand:
 		s.cachesMu.Lock()
 		allWorkspaces := []protocol.WorkspaceFolder{}
 		openOverlays := map[protocol.WorkspaceFolder][]file.Modification{}
@@ -154,27 +116,247 @@ func (s *Server) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCom
 		clear(s.caches)
 		runtime.GC()
 		for _, folder := range allWorkspaces {
-			path := protocol.DocumentURI(folder.URI).Path()
-			c := NewCache(folder)
+			path := uriPath(protocol.DocumentURI(folder.URI))
+			c := NewCache(folder, s.cacheOptions()...)
 			s.cacheInitLocked(c, path)
 			if changes, ok := openOverlays[folder]; ok {
-				c.DidModifyFiles(ctx, changes)
+				// the old caches are already gone, so this must not be interrupted
+				c.DidModifyFiles(context.WithoutCancel(ctx), changes)
 			}
 		}
 		s.cachesMu.Unlock()
 		return nil, nil
-	case "protols/refreshModules":
+	case protocolext.IndexWorkspaceCommand:
+		var req protocolext.IndexWorkspaceRequest
+		if len(params.Arguments) > 0 {
+			if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+				return nil, err
+			}
+		}
+		if req.Workspace.URI != "" {
+			c, err := s.CacheForURI(protocol.DocumentURI(req.Workspace.URI))
+			if err != nil {
+				return nil, err
+			}
+			c.IndexWorkspace(ctx)
+			return nil, nil
+		}
+		s.cachesMu.RLock()
+		caches := slices.Collect(maps.Values(s.caches))
+		s.cachesMu.RUnlock()
+		for _, c := range caches {
+			c.IndexWorkspace(ctx)
+		}
+		return nil, nil
+	case protocolext.ExportIndexCommand:
+		var req protocolext.ExportIndexRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForURI(protocol.DocumentURI(req.Workspace.URI))
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Create(req.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return nil, c.ExportIndex(f)
+	case protocolext.ImportIndexCommand:
+		var req protocolext.ImportIndexRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForURI(protocol.DocumentURI(req.Workspace.URI))
+		if err != nil {
+			return nil, err
+		}
+		return c.ImportIndexFile(req.Path)
+	case protocolext.RefreshModulesCommand:
 		s.cachesMu.Lock()
+		defer s.cachesMu.Unlock()
+		var unavailable []string
 		for _, c := range s.caches {
 			if c.resolver.goLanguageDriver == nil {
-				return nil, fmt.Errorf("go language driver not available for workspace %s", c.workspace.Name)
+				unavailable = append(unavailable, c.workspace.Name)
+				continue
 			}
 			c.resolver.goLanguageDriver.RefreshModules()
+			c.resolver.ClearImportConflicts()
+		}
+		if len(unavailable) > 0 {
+			return nil, fmt.Errorf("go language driver not available for workspaces: %s", strings.Join(unavailable, ", "))
 		}
-		s.cachesMu.Unlock()
 		return nil, nil
-	case "protols/goToGeneratedDefinition":
-		var req GeneratedDefinitionParams
+	case protocolext.SetImportPrecedenceCommand:
+		var req protocolext.SetImportPrecedenceRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		s.cachesMu.RLock()
+		caches := slices.Collect(maps.Values(s.caches))
+		s.cachesMu.RUnlock()
+		var conflicts []ImportConflict
+		for _, c := range caches {
+			if c.resolver.OverrideImportPrecedence(req.Precedence) {
+				c.applyImportPrecedence(ctx)
+			}
+			conflicts = append(conflicts, c.resolver.ImportConflicts()...)
+		}
+		return conflicts, nil
+	case protocolext.ReresolveCommand:
+		var req protocolext.ReresolveRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForURI(req.URI)
+		if err != nil {
+			return nil, err
+		}
+		return nil, c.Reresolve(ctx, req.URI)
+	case protocolext.BugReportCommand:
+		s.cachesMu.RLock()
+		caches := slices.Collect(maps.Values(s.caches))
+		s.cachesMu.RUnlock()
+		var report strings.Builder
+		WriteBugReport(ctx, &report, caches, DefaultLogTail)
+		return report.String(), nil
+	case protocolext.MetricsCommand:
+		var req protocolext.MetricsRequest
+		if len(params.Arguments) > 0 {
+			if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+				return nil, err
+			}
+		}
+		return CollectMetrics(req.SlowestFiles), nil
+	case protocolext.FileInfoCommand:
+		var req protocolext.FileInfoRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForURI(req.URI)
+		if err != nil {
+			return nil, err
+		}
+		return c.FileInfo(req.URI)
+	case protocolext.PathMappingsCommand:
+		var req protocolext.PathMappingsRequest
+		if len(params.Arguments) > 0 {
+			if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+				return nil, err
+			}
+		}
+		if req.Workspace.URI != "" {
+			c, err := s.CacheForURI(protocol.DocumentURI(req.Workspace.URI))
+			if err != nil {
+				return nil, err
+			}
+			return []WorkspacePathMappings{c.PathMappings()}, nil
+		}
+		s.cachesMu.RLock()
+		workspaces := make([]WorkspacePathMappings, 0, len(s.caches))
+		for _, c := range s.caches {
+			workspaces = append(workspaces, c.PathMappings())
+		}
+		s.cachesMu.RUnlock()
+		slices.SortFunc(workspaces, func(a, b WorkspacePathMappings) int {
+			return strings.Compare(a.Workspace, b.Workspace)
+		})
+		return workspaces, nil
+	case protocolext.GoToGeneratedDefinitionCommand:
+		var req protocolext.GeneratedDefinitionParams
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, snapshot, err := s.snapshotForURI(params.Command, req.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return c.FindGeneratedDefinition(ctx, snapshot, req.TextDocumentPositionParams)
+	case protocolext.MessageMembersCommand:
+		var req protocolext.MessageMembersParams
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, snapshot, err := s.snapshotForURI(params.Command, req.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return c.FindMessageMembers(ctx, snapshot, req.TextDocumentPositionParams)
+	case protocolext.DuplicateMessagesCommand:
+		var req protocolext.DuplicateMessagesRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForWorkspace(req.Workspace)
+		if err != nil {
+			return nil, err
+		}
+		return c.FindDuplicateMessages(ctx, c.Snapshot())
+	case protocolext.ServicesCommand:
+		var req protocolext.ServicesRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForWorkspace(req.Workspace)
+		if err != nil {
+			return nil, err
+		}
+		return c.FindServices(ctx, c.Snapshot())
+	case protocolext.SmokeTestsCommand:
+		var req protocolext.SmokeTestsRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForWorkspace(req.Workspace)
+		if err != nil {
+			return nil, err
+		}
+		return c.FindSmokeTests(ctx, c.Snapshot())
+	case protocolext.RunSmokeTestsCommand:
+		var req protocolext.RunSmokeTestsRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForWorkspace(req.Workspace)
+		if err != nil {
+			return nil, err
+		}
+		return c.RunSmokeTests(ctx, req.IDs, req.Endpoint, func(result SmokeTestResult) {
+			if s.notify == nil {
+				return
+			}
+			if err := s.notify(ctx, protocolext.SmokeTestResultNotification, result); err != nil {
+				slog.Warn("failed to send smoke test result notification", "id", result.ID, "error", err)
+			}
+		})
+	case protocolext.MakeEditableCopyCommand:
+		var req protocolext.MakeEditableCopyRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForURI(req.URI)
+		if err != nil {
+			return nil, err
+		}
+		return c.MakeEditableCopy(req.URI)
+	case protocolext.AddFieldsFromJSONCommand:
+		var req protocolext.AddFieldsFromJSONRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForURI(req.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		edit, err := c.AddFieldsFromJSON(ctx, req.TextDocumentPositionParams, req.JSON)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.applyEdit(ctx, "Add fields from JSON", edit)
+	case protocolext.PreviewRenameCommand:
+		var req protocolext.PreviewRenameRequest
 		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
 			return nil, err
 		}
@@ -182,7 +364,80 @@ func (s *Server) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCom
 		if err != nil {
 			return nil, err
 		}
-		return c.FindGeneratedDefinition(ctx, req.TextDocumentPositionParams)
+		edit, err := c.Rename(ctx, &req.RenameParams)
+		if err != nil {
+			return nil, err
+		}
+		preview := c.PreviewWorkspaceEdit(edit, req.MaxSnippets)
+		if err := s.adaptWorkspaceEdit(preview.Edit); err != nil {
+			return nil, err
+		}
+		return preview, nil
+	case protocolext.ExtractToFileCommand:
+		var req protocolext.ExtractToFileRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForURI(req.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		edit, err := c.ExtractToFile(ctx, req.TextDocumentPositionParams, req.Filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.adaptWorkspaceEdit(edit.Edit); err != nil {
+			return nil, err
+		}
+		return edit, nil
+	case protocolext.ProposeFileSplitCommand:
+		var req protocolext.SplitFileRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForURI(req.URI)
+		if err != nil {
+			return nil, err
+		}
+		return c.ProposeFileSplit(ctx, req.URI)
+	case protocolext.SplitFileCommand:
+		var req protocolext.SplitFileRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForURI(req.URI)
+		if err != nil {
+			return nil, err
+		}
+		edit, err := c.SplitFile(ctx, req.URI, req.Groups)
+		if err != nil {
+			return nil, err
+		}
+		var preview *WorkspaceEditPreview
+		if req.DryRun {
+			preview = c.PreviewNewFilesEdit(edit, 0)
+		}
+		if err := s.adaptWorkspaceEdit(edit.Edit); err != nil {
+			return nil, err
+		}
+		if preview == nil {
+			return edit, nil
+		}
+		return FileSplitResult{Edit: edit, Preview: preview}, nil
+	case protocolext.MessageFromGoStructCommand:
+		var req protocolext.MessageFromGoStructRequest
+		if err := json.Unmarshal(params.Arguments[0], &req); err != nil {
+			return nil, err
+		}
+		c, err := s.CacheForURI(req.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		edit, err := c.MessageFromGoStruct(ctx, req.TextDocumentPositionParams, req.Source, req.TypeName)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.applyEdit(ctx, "Convert Go struct to message", edit)
 	default:
 		var jsonData map[string]interface{}
 		if err := json.Unmarshal(params.Arguments[0], &jsonData); err != nil {
@@ -222,3 +477,20 @@ func (s *Server) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCom
 		return nil, fmt.Errorf("unknown command %q", params.Command)
 	}
 }
+
+func (s *Server) applyEdit(ctx context.Context, label string, edit *protocol.WorkspaceEdit) error {
+	if err := s.adaptWorkspaceEdit(edit); err != nil {
+		return err
+	}
+	res, err := s.client.ApplyEdit(ctx, &protocol.ApplyWorkspaceEditParams{
+		Label: label,
+		Edit:  *edit,
+	})
+	if err != nil {
+		return err
+	}
+	if !res.Applied {
+		return fmt.Errorf("failed to apply edit: %s", res.FailureReason)
+	}
+	return nil
+}
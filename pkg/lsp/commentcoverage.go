@@ -0,0 +1,101 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile/protoutil"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A lint rule requiring leading comments on the declarations which make up a
+// file's public API. It belongs to the "comments" rule pack, which must be
+// enabled explicitly; the kinds of declarations checked and the files they
+// are checked in can be changed with the lint.commentCoverage settings.
+
+const lintPackComments = "comments"
+
+var defaultCommentCoverageKinds = []string{namingKindMessage, namingKindField, namingKindService, namingKindMethod}
+
+// lintCommentCoverage reports declarations of the kinds listed in the
+// lint.commentCoverage settings which have no leading comments, with a quick
+// fix inserting a TODO comment stub above the declaration.
+func lintCommentCoverage(ctx context.Context, p *lintPass) {
+	settings := &p.settings.Lint.CommentCoverage
+	if len(settings.Paths) > 0 && !slices.ContainsFunc(settings.Paths, func(pattern string) bool {
+		ok, _ := path.Match(pattern, p.result.Path())
+		return ok
+	}) {
+		return
+	}
+	kinds := settings.Kinds
+	if len(kinds) == 0 {
+		kinds = defaultCommentCoverageKinds
+	}
+	fileNode := p.result.AST()
+	locations := p.result.SourceLocations()
+	p.result.RangeDescriptors(ctx, func(desc protoreflect.Descriptor) bool {
+		var kind string
+		switch desc := desc.(type) {
+		case protoreflect.MessageDescriptor:
+			if desc.IsMapEntry() {
+				return true
+			}
+			kind = namingKindMessage
+		case protoreflect.FieldDescriptor:
+			if desc.ContainingMessage().IsMapEntry() {
+				return true
+			}
+			kind = namingKindField
+		case protoreflect.EnumDescriptor:
+			kind = namingKindEnum
+		case protoreflect.EnumValueDescriptor:
+			kind = namingKindEnumValue
+		case protoreflect.ServiceDescriptor:
+			kind = namingKindService
+		case protoreflect.MethodDescriptor:
+			kind = namingKindMethod
+		default:
+			return true
+		}
+		if !slices.Contains(kinds, kind) {
+			return true
+		}
+		if strings.TrimSpace(locations.ByDescriptor(desc).LeadingComments) != "" {
+			return true
+		}
+		ref, err := findDefinition(desc, p.result)
+		if err != nil || !ref.NodeInfo.IsValid() {
+			return true
+		}
+		d := p.reportSpan(ref.NodeInfo, "%s %s has no leading comment", kindDisplayName(kind), desc.Name())
+
+		declNode := p.result.Node(protoutil.ProtoFromDescriptor(desc))
+		if declNode == nil {
+			return true
+		}
+		info := fileNode.NodeInfo(declNode)
+		ws := info.LeadingWhitespace()
+		if !strings.Contains(ws, "\n") && info.Start().Line > 1 {
+			// a stub can't be inserted above a declaration which shares its
+			// line with a preceding token
+			return true
+		}
+		indent := ws[strings.LastIndexByte(ws, '\n')+1:]
+		start := toPosition(info.Start())
+		d.CodeActions = append(d.CodeActions, CodeAction{
+			Title: "Add a TODO comment",
+			Path:  p.result.Path(),
+			Kind:  protocol.QuickFix,
+			Edits: []protocol.TextEdit{{
+				Range:   protocol.Range{Start: start, End: start},
+				NewText: fmt.Sprintf("// TODO: document %s.\n%s", desc.Name(), indent),
+			}},
+		})
+		return true
+	})
+}
@@ -0,0 +1,80 @@
+package lsp
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLintCommentCoverage(t *testing.T) {
+	const source = `syntax = "proto3";
+package api;
+// A documented message.
+message A {
+  // A documented field.
+  int32 a = 1;
+  int32 b = 2;
+  map<string, int32> m = 3;
+  enum E {
+    E_UNSPECIFIED = 0;
+  }
+}
+service S {
+  rpc Get(A) returns (A);
+}
+`
+	c, _ := newTestCache(t, map[string]string{
+		"api/a.proto":      source,
+		"internal/b.proto": "syntax = \"proto3\";\npackage internal;\nmessage B {}\n",
+	}, &Settings{
+		Lint: LintSettings{
+			Packs:           []string{lintPackComments},
+			CommentCoverage: CommentCoverageSettings{Paths: []string{"api/*.proto"}},
+		},
+	})
+
+	diagnostics, _, _ := c.diagHandler.GetDiagnosticsForPath("api/a.proto")
+	var messages []string
+	var stubs []string
+	for _, d := range diagnostics {
+		if d.Code != "comment-coverage" {
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("%d: %s", d.Range.Start().Line, d.Error))
+		for _, action := range d.CodeActions {
+			for _, edit := range action.Edits {
+				stubs = append(stubs, fmt.Sprintf("%d:%d %q", edit.Range.Start.Line, edit.Range.Start.Character, edit.NewText))
+			}
+		}
+	}
+	want := []string{
+		"7: field b has no leading comment",
+		"8: field m has no leading comment",
+		"13: service S has no leading comment",
+		"14: method Get has no leading comment",
+	}
+	wantStubs := []string{
+		`6:2 "// TODO: document b.\n  "`,
+		`7:2 "// TODO: document m.\n  "`,
+		`12:0 "// TODO: document S.\n"`,
+		`13:2 "// TODO: document Get.\n  "`,
+	}
+	slices.Sort(messages)
+	slices.Sort(want)
+	slices.Sort(stubs)
+	slices.Sort(wantStubs)
+	if !slices.Equal(messages, want) {
+		t.Errorf("got diagnostics:\n%s\nwant:\n%s", strings.Join(messages, "\n"), strings.Join(want, "\n"))
+	}
+	if !slices.Equal(stubs, wantStubs) {
+		t.Errorf("got stubs:\n%s\nwant:\n%s", strings.Join(stubs, "\n"), strings.Join(wantStubs, "\n"))
+	}
+
+	diagnostics, _, _ = c.diagHandler.GetDiagnosticsForPath("internal/b.proto")
+	for _, d := range diagnostics {
+		if d.Code == "comment-coverage" {
+			t.Errorf("unexpected diagnostic in a file outside the configured paths: %v", d.Error)
+		}
+	}
+}
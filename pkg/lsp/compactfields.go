@@ -0,0 +1,209 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/ast/paths"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// compactFieldNumbers offers to renumber the fields of a message sequentially
+// in declaration order, skipping reserved numbers and extension ranges. Field
+// numbers are part of the wire format, so this is only offered for messages
+// that are marked as under development, either with an annotation in their
+// leading comments or by matching one of the configured path patterns. If the
+// message already exists in the git baseline revision and renumbering would
+// change the number of a field that was present there, the action is disabled.
+func (c *Cache) compactFieldNumbers(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper) []protocol.CodeAction {
+	if request.Range.Start != request.Range.End {
+		return nil
+	}
+	settings := c.settings.Load()
+	fileNode := linkRes.AST()
+	msgNode, msgDesc, ok := c.messageNameAtPosition(ctx, linkRes, mapper, request.Range.Start)
+	if !ok || !isUnstableMessage(&settings.Refactor, fileNode, msgNode, linkRes.Path()) {
+		return nil
+	}
+
+	numbers := compactedFieldNumbers(msgDesc)
+	var edits []protocol.TextEdit
+	fields := msgDesc.Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		if fd.Number() == numbers[fd.Name()] {
+			continue
+		}
+		node := fieldDeclNode(linkRes, fd)
+		if node == nil || node.GetTag() == nil {
+			return nil
+		}
+		edits = append(edits, protocol.TextEdit{
+			Range:   toRange(fileNode.NodeInfo(node.GetTag())),
+			NewText: fmt.Sprint(numbers[fd.Name()]),
+		})
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+
+	action := actionQueue.enqueue("Compact field numbers", protocol.RefactorRewrite, mapper.URI, fileNode.Version(), func(ca *protocol.CodeAction) error {
+		ca.Edit = &protocol.WorkspaceEdit{
+			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+				request.TextDocument.URI: edits,
+			},
+		}
+		return nil
+	})
+	if rev := settings.Lint.GetGitBaseline(); rev != "" && mapper.URI.IsFile() {
+		if field, ok := c.releasedFieldConflict(ctx, mapper.URI, rev, msgDesc, numbers); ok {
+			action.Disabled = &protocol.CodeActionDisabled{
+				Reason: fmt.Sprintf("field %s of %s exists in git revision %s; renumbering it would break wire compatibility", field, msgDesc.Name(), rev),
+			}
+		}
+	}
+	return []protocol.CodeAction{action}
+}
+
+// messageNameAtPosition returns the message whose name contains the given
+// position.
+func (c *Cache) messageNameAtPosition(ctx context.Context, linkRes linker.Result, mapper *protocol.Mapper, pos protocol.Position) (*ast.MessageNode, protoreflect.MessageDescriptor, bool) {
+	offset, err := mapper.PositionOffset(pos)
+	if err != nil {
+		return nil, nil, false
+	}
+	token, comment := linkRes.AST().ItemAtOffset(offset)
+	if token == ast.TokenError || comment.IsValid() {
+		return nil, nil, false
+	}
+	path, ok := c.findPathIntersectingToken(linkRes, token, pos)
+	if !ok {
+		return nil, nil, false
+	}
+	msgNode := paths.NodeAt[*ast.MessageNode](path.Index(-1))
+	if msgNode == nil || token < msgNode.Name.Start() || token > msgNode.Name.End() {
+		return nil, nil, false
+	}
+	desc, _, err := c.deepPathSearch(ctx, path.Path, linkRes, linkRes)
+	if err != nil {
+		return nil, nil, false
+	}
+	msgDesc, ok := desc.(protoreflect.MessageDescriptor)
+	return msgNode, msgDesc, ok
+}
+
+// compactedFieldNumbers assigns sequential numbers to the fields of the
+// message in declaration order.
+func compactedFieldNumbers(msgDesc protoreflect.MessageDescriptor) map[protoreflect.Name]protoreflect.FieldNumber {
+	numbers := map[protoreflect.Name]protoreflect.FieldNumber{}
+	next := protoreflect.FieldNumber(1)
+	fields := msgDesc.Fields()
+	for i := range fields.Len() {
+		for msgDesc.ReservedRanges().Has(next) || msgDesc.ExtensionRanges().Has(next) ||
+			(next >= protowire.FirstReservedNumber && next <= protowire.LastReservedNumber) {
+			next++
+		}
+		numbers[fields.Get(i).Name()] = next
+		next++
+	}
+	return numbers
+}
+
+// isUnstableMessage reports whether the message is marked as under
+// development, and therefore safe to renumber.
+func isUnstableMessage(settings *RefactorSettings, fileNode *ast.FileNode, msgNode *ast.MessageNode, filename string) bool {
+	for _, pattern := range settings.UnstablePaths {
+		if ok, _ := path.Match(pattern, filename); ok {
+			return true
+		}
+	}
+	annotation := settings.GetUnstableAnnotation()
+	if annotation == "" {
+		return false
+	}
+	comments := fileNode.NodeInfo(msgNode).LeadingComments()
+	for i := range comments.Len() {
+		if strings.Contains(comments.Index(i).RawText(), annotation) {
+			return true
+		}
+	}
+	return false
+}
+
+// releasedFieldConflict compares the compacted field numbers against the
+// message as it exists in the given git revision. It returns the name of the
+// first field whose number would differ from the number it had (or that was
+// used by a different field) in that revision.
+func (c *Cache) releasedFieldConflict(ctx context.Context, uri protocol.DocumentURI, rev string, msgDesc protoreflect.MessageDescriptor, numbers map[protoreflect.Name]protoreflect.FieldNumber) (protoreflect.Name, bool) {
+	prev, err := c.baseline.FileAtRevision(ctx, uri.Path(), rev)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Debug("failed to read git baseline", "path", uri.Path(), "error", err)
+		}
+		return "", false
+	}
+	prevMsg := findMessageProto(prev, msgDesc.FullName())
+	if prevMsg == nil {
+		return "", false
+	}
+	prevByNumber := map[protoreflect.FieldNumber]string{}
+	prevByName := map[protoreflect.Name]protoreflect.FieldNumber{}
+	for _, fld := range prevMsg.GetField() {
+		prevByNumber[protoreflect.FieldNumber(fld.GetNumber())] = fld.GetName()
+		prevByName[protoreflect.Name(fld.GetName())] = protoreflect.FieldNumber(fld.GetNumber())
+	}
+	fields := msgDesc.Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		number := numbers[fd.Name()]
+		if number == fd.Number() {
+			continue
+		}
+		if _, ok := prevByName[fd.Name()]; ok {
+			return fd.Name(), true
+		}
+		if name, ok := prevByNumber[number]; ok && name != string(fd.Name()) {
+			return fd.Name(), true
+		}
+	}
+	return "", false
+}
+
+// findMessageProto finds a message in an unlinked file descriptor by its
+// fully-qualified name.
+func findMessageProto(fdp *descriptorpb.FileDescriptorProto, name protoreflect.FullName) *descriptorpb.DescriptorProto {
+	rel := string(name)
+	if pkg := fdp.GetPackage(); pkg != "" {
+		var ok bool
+		rel, ok = strings.CutPrefix(rel, pkg+".")
+		if !ok {
+			return nil
+		}
+	}
+	msgs := fdp.GetMessageType()
+	var found *descriptorpb.DescriptorProto
+	for _, part := range strings.Split(rel, ".") {
+		found = nil
+		for _, msg := range msgs {
+			if msg.GetName() == part {
+				found = msg
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		msgs = found.GetNestedType()
+	}
+	return found
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/kralicky/protocompile"
@@ -38,45 +40,227 @@ func (c *Cache) postInvalidateHook(path protocompile.ResolvedPath, prevResult li
 				break
 			}
 		}
+		c.refIndex.remove(string(path))
 	}
 }
 
 func (c *Cache) preCompile(path protocompile.ResolvedPath) {
 	slog.Debug(fmt.Sprintf("compiling %s\n", path))
 	c.inflightTasksCompile.Store(path, time.Now())
+	metrics.filesCompiled.Add(1)
 	c.partialResultsMu.Lock()
 	defer c.partialResultsMu.Unlock()
 	delete(c.partiallyLinkedResults, path)
 	delete(c.unlinkedResults, path)
+	c.recompiledPaths[path] = struct{}{}
 }
 
 func (c *Cache) postCompile(path protocompile.ResolvedPath) {
+	// the document may have been relinked against changed dependencies
+	c.clearPathMemo(string(path))
 	startTime, ok := c.inflightTasksCompile.LoadAndDelete(path)
 	if ok {
+		metrics.compileTime.since(startTime)
+		metrics.fileCompileTimes.record(string(path), time.Since(startTime))
 		slog.Debug(fmt.Sprintf("compiled %s (took %s)\n", path, time.Since(startTime)))
 	} else {
 		slog.Debug(fmt.Sprintf("compiled %s\n", path))
 	}
+	// publish diagnostics for this file without waiting for the rest of the
+	// batch; lint diagnostics are added and flushed once compilation finishes
+	c.diagHandler.FlushPath(string(path))
 }
 
-func (c *Cache) Compile(protos []string, after ...func()) {
+// Compile compiles the given files and updates the cache with the results.
+// If the context is cancelled or the cache is closed, compilation stops early
+// and the cache is left unchanged, and the after functions are not run since
+// they record what was compiled. If open documents are compiled ahead of the
+// other files, the after functions also run once they are done, so they must
+// be safe to repeat.
+func (c *Cache) Compile(ctx context.Context, protos []string, after ...func()) {
+	ctx, ca := context.WithCancelCause(ctx)
+	defer ca(nil)
+	stop := context.AfterFunc(c.lifetime, func() {
+		ca(context.Cause(c.lifetime))
+	})
+	defer stop()
+
+	// paths which are already queued by another caller are compiled once, by
+	// whichever request queued them first
+	flight, protos, joined := c.compileQueue.join(protos)
+	retry := joined.wait(ctx)
+	// git is run before locking, so that lint rules can read the baseline
+	// revisions of these files from the cache
+	c.prefetchGitBaseline(slices.Concat(protos, retry))
+
 	c.resultsMu.Lock()
 	defer c.resultsMu.Unlock()
-	c.compileLocked(protos...)
+	if paths := append(protos, retry...); len(paths) > 0 {
+		if flight != nil {
+			c.compileQueue.start(flight)
+		}
+		// open documents and their dependencies are compiled first. The lock is
+		// released before compiling the rest, so that requests for the open
+		// documents can be answered in the meantime.
+		if open, rest := c.partitionOpenPaths(paths); len(open) > 0 && len(rest) > 0 {
+			slog.Debug("compiling open files first", "open", len(open), "remaining", len(rest))
+			c.compileLocked(ctx, open...)
+			c.finishCompileLocked(ctx, after)
+			c.resultsMu.Unlock()
+			c.resultsMu.Lock()
+			paths = rest
+		}
+		c.compileLocked(ctx, paths...)
+		if flight != nil {
+			flight.finish(ctx.Err() != nil)
+		}
+	}
+	c.finishCompileLocked(ctx, after)
+}
+
+// finishCompileLocked runs the functions passed to Compile, then publishes a
+// snapshot of the results. Nothing is done if the compilation was cancelled.
+func (c *Cache) finishCompileLocked(ctx context.Context, after []func()) {
+	if ctx.Err() != nil {
+		return
+	}
 	for _, f := range after {
 		f()
 	}
+	c.publishSnapshotLocked()
+}
+
+// partitionOpenPaths splits paths into those of documents open in the editor
+// and the rest.
+func (c *Cache) partitionOpenPaths(paths []string) (open, rest []string) {
+	openPaths := map[string]bool{}
+	for _, o := range c.resolver.Overlays() {
+		if path, err := c.resolver.URIToPath(o.URI()); err == nil {
+			openPaths[path] = true
+		}
+	}
+	for _, path := range paths {
+		if openPaths[path] {
+			open = append(open, path)
+		} else {
+			rest = append(rest, path)
+		}
+	}
+	return open, rest
+}
+
+// compileFlight is a compilation which has been requested, and is shared by
+// every request for the same paths until it starts.
+type compileFlight struct {
+	paths []protocompile.ResolvedPath
+	done  chan struct{}
+	// set before done is closed if the compilation stopped early
+	cancelled bool
+}
+
+func (f *compileFlight) finish(cancelled bool) {
+	f.cancelled = cancelled
+	close(f.done)
+}
+
+// joinedFlights maps flights queued by other requests to the paths this
+// request is waiting on them for.
+type joinedFlights map[*compileFlight][]string
+
+// wait blocks until each flight has finished, or until the context is done,
+// and returns the paths from flights which were cancelled. These have to be
+// compiled again by the waiting request.
+func (j joinedFlights) wait(ctx context.Context) []string {
+	var retry []string
+	for f, paths := range j {
+		select {
+		case <-f.done:
+			if f.cancelled {
+				retry = append(retry, paths...)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	slices.Sort(retry)
+	return retry
+}
+
+// compileQueue tracks which paths have been requested for compilation but
+// have not started compiling yet, so that concurrent requests for the same
+// file (for example when a document is opened while other features are
+// waiting on it) share a single compilation. Once a compilation starts, its
+// paths can be queued again, since the files may have changed since it read
+// them.
+type compileQueue struct {
+	mu      sync.Mutex
+	waiting map[protocompile.ResolvedPath]*compileFlight
+}
+
+// join queues a new flight for the paths which are not already waiting to be
+// compiled, and returns it along with those paths. The returned flight is nil
+// if every path was already queued.
+func (q *compileQueue) join(paths []string) (*compileFlight, []string, joinedFlights) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.waiting == nil {
+		q.waiting = make(map[protocompile.ResolvedPath]*compileFlight)
+	}
+	var own []string
+	var joined joinedFlights
+	seen := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		if _, ok := seen[path]; ok {
+			continue
+		}
+		seen[path] = struct{}{}
+		if f, ok := q.waiting[protocompile.ResolvedPath(path)]; ok {
+			if joined == nil {
+				joined = make(joinedFlights)
+			}
+			joined[f] = append(joined[f], path)
+			metrics.compilationsCoalesced.Add(1)
+			continue
+		}
+		own = append(own, path)
+	}
+	if len(own) == 0 {
+		return nil, nil, joined
+	}
+	f := &compileFlight{done: make(chan struct{})}
+	for _, path := range own {
+		f.paths = append(f.paths, protocompile.ResolvedPath(path))
+		q.waiting[protocompile.ResolvedPath(path)] = f
+	}
+	return f, own, joined
+}
+
+// start removes the paths of a flight from the queue once it begins
+// compiling.
+func (q *compileQueue) start(f *compileFlight) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, path := range f.paths {
+		if q.waiting[path] == f {
+			delete(q.waiting, path)
+		}
+	}
 }
 
-func (c *Cache) compileLocked(protos ...string) {
+func (c *Cache) compileLocked(ctx context.Context, protos ...string) {
 	slog.Debug("compiling", "protos", len(protos))
+	metrics.compilations.Add(1)
 
 	resolved := make([]protocompile.ResolvedPath, 0, len(protos))
 	for _, proto := range protos {
 		resolved = append(resolved, protocompile.ResolvedPath(proto))
 	}
-	res, err := c.compiler.Compile(context.TODO(), resolved...)
+	res, err := c.compiler.Compile(ctx, resolved...)
 	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			slog.Debug("compilation cancelled", "protos", len(protos))
+			return
+		}
 		if !errors.Is(err, reporter.ErrInvalidSource) {
 			slog.With("error", err).Error("failed to compile")
 			return
@@ -148,8 +332,31 @@ func (c *Cache) compileLocked(protos ...string) {
 		}
 		c.pragmas.Store(path, &pragmaMap{m: pragmas})
 	}
+	recompiled := c.recompiledPaths
+	c.recompiledPaths = make(map[protocompile.ResolvedPath]struct{})
 	c.partialResultsMu.Unlock()
 
+	for _, r := range res.Files {
+		if _, ok := recompiled[protocompile.ResolvedPath(r.Path())]; ok {
+			start := time.Now()
+			c.refIndex.update(r.(linker.Result))
+			metrics.indexTime.since(start)
+			start = time.Now()
+			c.lintLocked(r.(linker.Result))
+			c.validateOptionLiteralsLocked(r.(linker.Result))
+			metrics.lintTime.since(start)
+		} else if r, ok := r.(linker.Result); ok && !c.refIndex.indexed(r.Path()) {
+			start := time.Now()
+			c.refIndex.update(r)
+			metrics.indexTime.since(start)
+		}
+	}
+	for _, partial := range res.PartialLinkResults {
+		start := time.Now()
+		c.validateOptionLiteralsLocked(partial)
+		metrics.lintTime.since(start)
+	}
+
 	syntheticFiles := c.resolver.CheckIncompleteDescriptors(c.results)
 	if len(syntheticFiles) == 0 {
 		return
@@ -158,5 +365,5 @@ func (c *Cache) compileLocked(protos ...string) {
 		slog.Debug("error checking incomplete descriptors", "err", err)
 	}
 	slog.Debug("building new synthetic sources", "sources", len(syntheticFiles))
-	c.compileLocked(syntheticFiles...)
+	c.compileLocked(ctx, syntheticFiles...)
 }
@@ -0,0 +1,134 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestCompileQueue(t *testing.T) {
+	var q compileQueue
+
+	first, own, joined := q.join([]string{"a.proto", "b.proto", "a.proto"})
+	if first == nil || !slices.Equal(own, []string{"a.proto", "b.proto"}) || len(joined) != 0 {
+		t.Fatalf("unexpected first flight: %v %v", own, joined)
+	}
+
+	second, own, joined := q.join([]string{"b.proto", "c.proto"})
+	if second == nil || !slices.Equal(own, []string{"c.proto"}) {
+		t.Fatalf("expected only c.proto to be queued, got %v", own)
+	}
+	if !slices.Equal(joined[first], []string{"b.proto"}) {
+		t.Fatalf("expected to wait for b.proto in the first flight, got %v", joined)
+	}
+
+	if f, own, _ := q.join([]string{"a.proto"}); f != nil || len(own) != 0 {
+		t.Fatalf("a.proto is already queued, got a new flight for %v", own)
+	}
+
+	// once a flight starts, its paths can be queued again
+	q.start(first)
+	third, own, _ := q.join([]string{"a.proto", "c.proto"})
+	if third == nil || !slices.Equal(own, []string{"a.proto"}) {
+		t.Fatalf("expected a.proto to be queued again, got %v", own)
+	}
+
+	first.finish(true)
+	if retry := joined.wait(context.Background()); !slices.Equal(retry, []string{"b.proto"}) {
+		t.Fatalf("expected b.proto to be retried after cancellation, got %v", retry)
+	}
+}
+
+func TestConcurrentCompile(t *testing.T) {
+	handler := memSchemeHandler{
+		"mem:///workspace/a.proto": "syntax = \"proto3\";\npackage a;\nmessage A {}\n",
+		"mem:///workspace/b.proto": "syntax = \"proto3\";\npackage b;\nimport \"a.proto\";\nmessage B {\n  a.A a = 1;\n}\n",
+	}
+	c := NewCache(protocol.WorkspaceFolder{URI: "mem:///workspace"}, WithSchemeHandlers(map[string]SchemeHandler{"mem": handler}))
+	defer c.Close(nil)
+	c.resolver.UpdateURIPathMappings([]file.Modification{
+		{URI: "mem:///workspace/a.proto", Action: file.Create},
+		{URI: "mem:///workspace/b.proto", Action: file.Create},
+	})
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Compile(context.Background(), []string{"b.proto", "a.proto"})
+		}()
+	}
+	wg.Wait()
+
+	for _, uri := range []protocol.DocumentURI{"mem:///workspace/a.proto", "mem:///workspace/b.proto"} {
+		if _, err := c.FindFileByURI(uri); err != nil {
+			t.Errorf("%s: %v", uri, err)
+		}
+	}
+}
+
+func TestCompileOpenFilesFirst(t *testing.T) {
+	workspace := t.TempDir()
+	files := map[string]string{
+		"a.proto": "syntax = \"proto3\";\npackage a;\nimport \"b.proto\";\nmessage A {\n  b.B b = 1;\n}\n",
+		"b.proto": "syntax = \"proto3\";\npackage b;\nmessage B {}\n",
+		"c.proto": "syntax = \"proto3\";\npackage c;\nmessage C {}\n",
+	}
+	writeFiles(t, workspace, files)
+	ctx := context.Background()
+	c := NewCache(protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(workspace))}, WithSandboxedCache())
+	defer c.Close(nil)
+	c.LoadFiles([]string{
+		filepath.Join(workspace, "a.proto"),
+		filepath.Join(workspace, "b.proto"),
+		filepath.Join(workspace, "c.proto"),
+	})
+	c.DidModifyFiles(ctx, []file.Modification{{
+		URI:        protocol.URIFromPath(filepath.Join(workspace, "a.proto")),
+		Action:     file.Open,
+		Version:    1,
+		Text:       []byte(files["a.proto"]),
+		LanguageID: "protobuf",
+	}})
+
+	open, rest := c.partitionOpenPaths([]string{"c.proto", "a.proto", "b.proto"})
+	if !slices.Equal(open, []string{"a.proto"}) || !slices.Equal(rest, []string{"c.proto", "b.proto"}) {
+		t.Errorf("unexpected partition %v %v", open, rest)
+	}
+
+	// the open file is compiled in a batch of its own, followed by the rest
+	before := c.Snapshot().ID()
+	c.Compile(ctx, []string{"a.proto", "b.proto", "c.proto"})
+	if n := c.Snapshot().ID() - before; n != 2 {
+		t.Errorf("expected 2 snapshots to be published, got %d", n)
+	}
+	for _, path := range []string{"a.proto", "b.proto", "c.proto"} {
+		if _, err := c.FindResultByPath(path); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCompileCancelled(t *testing.T) {
+	c, _ := newTestCache(t, map[string]string{
+		"a.proto": "syntax = \"proto3\";\npackage a;\nmessage A {}\n",
+	}, nil)
+	ctx, ca := context.WithCancel(context.Background())
+	ca()
+
+	before := c.Snapshot().ID()
+	var ran bool
+	c.Compile(ctx, []string{"a.proto"}, func() { ran = true })
+	if ran {
+		t.Error("after function ran for a cancelled compilation")
+	}
+	if c.Snapshot().ID() != before {
+		t.Error("snapshot published for a cancelled compilation")
+	}
+}
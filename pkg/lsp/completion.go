@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"path"
 	"reflect"
+	"regexp"
 	"slices"
 	"sort"
 	"strings"
+	"unicode"
 
 	"github.com/kralicky/protocompile/ast"
 	"github.com/kralicky/protocompile/ast/paths"
@@ -21,7 +23,7 @@ import (
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
-func (c *Cache) GetCompletions(params *protocol.CompletionParams) (result *protocol.CompletionList, err error) {
+func (c *Cache) GetCompletions(ctx context.Context, snapshot *Snapshot, params *protocol.CompletionParams) (result *protocol.CompletionList, err error) {
 	defer func() {
 		if result != nil && len(result.Items) > 0 {
 			foundPreselect := false
@@ -41,11 +43,11 @@ func (c *Cache) GetCompletions(params *protocol.CompletionParams) (result *proto
 		}
 	}()
 	doc := params.TextDocument
-	currentParseRes, err := c.FindParseResultByURI(doc.URI)
+	currentParseRes, err := snapshot.FindParseResultByURI(doc.URI)
 	if err != nil {
 		return nil, err
 	}
-	maybeCurrentLinkRes, err := c.FindResultOrPartialResultByURI(doc.URI)
+	maybeCurrentLinkRes, err := snapshot.FindResultOrPartialResultByURI(doc.URI)
 	if err != nil {
 		return nil, err
 	}
@@ -80,11 +82,27 @@ func (c *Cache) GetCompletions(params *protocol.CompletionParams) (result *proto
 	}
 	textFollowingCursor := string(mapper.Content[start:end])
 
+	if items, ok := completeSyntaxOrEdition(textPrecedingCursor, textFollowingCursor, params.Position); ok {
+		return &protocol.CompletionList{
+			Items: items,
+		}, nil
+	}
+
 	latestAstValid, err := c.LatestDocumentContentsWellFormed(doc.URI, false)
 	if err != nil {
 		return nil, err
 	}
 
+	if !latestAstValid {
+		// Statements that are still being typed are often dropped from the AST
+		// entirely, so check the tokens preceding the cursor for common patterns.
+		if items, ok := c.completeIncompleteStatement(currentParseRes.AST(), posOffset, textFollowingCursor, maybeCurrentLinkRes, params.Position); ok {
+			return &protocol.CompletionList{
+				Items: items,
+			}, nil
+		}
+	}
+
 	var searchTarget parser.Result
 	if !latestAstValid {
 		// The user is in the middle of editing the file and it's not valid yet,
@@ -100,7 +118,7 @@ func (c *Cache) GetCompletions(params *protocol.CompletionParams) (result *proto
 		return nil, nil
 	}
 
-	path, found := findPathIntersectingToken(searchTarget, tokenAtOffset, params.Position)
+	path, found := c.findPathIntersectingToken(searchTarget, tokenAtOffset, params.Position)
 	if !found {
 		var completions []protocol.CompletionItem
 		if searchTarget.AST().EndExclusive() == ast.TokenError { // only EOF
@@ -119,9 +137,9 @@ func (c *Cache) GetCompletions(params *protocol.CompletionParams) (result *proto
 	}
 
 	completions := []protocol.CompletionItem{}
-	desc, _, _ := deepPathSearch(path.Path, searchTarget, maybeCurrentLinkRes)
+	desc, _, _ := c.deepPathSearch(ctx, path.Path, searchTarget, maybeCurrentLinkRes)
 
-	scope := findCompletionScope(path, maybeCurrentLinkRes)
+	scope := c.findCompletionScope(ctx, path, maybeCurrentLinkRes)
 	if scope == nil {
 		return nil, nil
 	}
@@ -204,6 +222,8 @@ func (c *Cache) GetCompletions(params *protocol.CompletionParams) (result *proto
 				// complete within the field value
 				completions = append(completions,
 					c.completeFieldLiteralValues(fd, node.Val, searchTarget.AST(), mapper, posOffset, params.Position)...)
+				completions = append(completions,
+					c.completeFieldPaths(ctx, maybeCurrentLinkRes, path, node.Val, posOffset)...)
 			}
 		}
 	case *ast.RPCTypeNode:
@@ -241,6 +261,14 @@ func (c *Cache) GetCompletions(params *protocol.CompletionParams) (result *proto
 		}
 		completions = append(completions, completeTypeNames(c, partialName, partialNameSuffix, maybeCurrentLinkRes, scopeName, params.Position)...)
 	case *ast.CompactOptionsNode:
+		if opt := optionPrecedingToken(node, tokenAtOffset); opt != nil && opt.Name != nil && opt.Equals != nil && opt.IsIncomplete() {
+			// the cursor is after the '=' of an option that has no value yet
+			if len(opt.Name.Parts) == 1 && isDefaultOptionRef(opt.Name.Parts[0].GetFieldRef()) {
+				completions = append(completions,
+					completeDefaultValue(enclosingFieldDescriptor(maybeCurrentLinkRes, nodes), "", "", params.Position)...)
+			}
+			break
+		}
 		completions = append(completions,
 			c.completeOptionOrExtensionName(scope, path, searchTarget.AST(), nil, 0, maybeCurrentLinkRes, existingOpts, mapper, posOffset, params.Position)...)
 	case *ast.OptionNode:
@@ -248,10 +276,23 @@ func (c *Cache) GetCompletions(params *protocol.CompletionParams) (result *proto
 		case !node.Name.IsIncomplete() && node.Equals != nil && tokenAtOffset > node.Equals.GetToken():
 			// complete option values
 			ref := node.Name.Parts[len(node.Name.Parts)-1].GetFieldRef()
+			if isDefaultOptionRef(ref) {
+				if _, ok := nodes[len(nodes)-2].(*ast.CompactOptionsNode); ok {
+					partialName, partialNameSuffix, err := findPartialNames(searchTarget.AST(), node.Val, mapper, posOffset)
+					if err != nil {
+						return nil, err
+					}
+					completions = append(completions,
+						completeDefaultValue(enclosingFieldDescriptor(maybeCurrentLinkRes, nodes), partialName, partialNameSuffix, params.Position)...)
+					break
+				}
+			}
 			fd := maybeCurrentLinkRes.FindFieldDescriptorByFieldReferenceNode(ref)
 			if fd != nil {
 				completions = append(completions,
 					c.completeFieldLiteralValues(fd, node.Val, searchTarget.AST(), mapper, posOffset, params.Position)...)
+				completions = append(completions,
+					c.completeFieldPaths(ctx, maybeCurrentLinkRes, path, node.Val, posOffset)...)
 			}
 		case node.Name == nil && tokenAtOffset > node.Keyword.GetToken() && (node.Equals == nil || tokenAtOffset <= node.Equals.GetToken()):
 			// complete new option names
@@ -267,7 +308,7 @@ func (c *Cache) GetCompletions(params *protocol.CompletionParams) (result *proto
 			nodeIdx = unwrapIndex(prev.Parts, node)
 		case *ast.MessageFieldNode:
 			if desc == nil {
-				if desc, _, _ := deepPathSearch(path.Path[:len(path.Path)-2], searchTarget, maybeCurrentLinkRes); desc != nil {
+				if desc, _, _ := c.deepPathSearch(ctx, path.Path[:len(path.Path)-2], searchTarget, maybeCurrentLinkRes); desc != nil {
 					nodeIdx = 0
 					scope = desc
 				}
@@ -413,7 +454,7 @@ func (c *Cache) GetCompletions(params *protocol.CompletionParams) (result *proto
 			// completing type
 			var scope protoreflect.FullName
 			if len(path.Path) > 1 {
-				if desc, _, err := deepPathSearch(path.Path[:len(path.Path)-1], searchTarget, maybeCurrentLinkRes); err == nil {
+				if desc, _, err := c.deepPathSearch(ctx, path.Path[:len(path.Path)-1], searchTarget, maybeCurrentLinkRes); err == nil {
 					scope = desc.FullName()
 				}
 			}
@@ -681,7 +722,27 @@ func (c *Cache) completeFieldLiteralValues(
 		msg := fd.Message()
 		if !msg.IsMapEntry() {
 			if !valueNode.HasValue() {
-				return []protocol.CompletionItem{
+				var items []protocol.CompletionItem
+				if wk, ok := wellKnownLiterals[msg.FullName()]; ok {
+					items = append(items, protocol.CompletionItem{
+						Label: wk.label,
+						LabelDetails: &protocol.CompletionItemLabelDetails{
+							Description: string(msg.FullName()),
+						},
+						Kind: protocol.StructCompletion,
+						TextEdit: &protocol.Or_CompletionItem_textEdit{
+							Value: protocol.TextEdit{
+								Range: protocol.Range{
+									Start: pos,
+									End:   pos,
+								},
+								NewText: wk.snippet,
+							},
+						},
+						InsertTextFormat: &snippetMode,
+					})
+				}
+				return append(items, []protocol.CompletionItem{
 					{
 						Label: "{...}",
 						LabelDetails: &protocol.CompletionItemLabelDetails{
@@ -701,7 +762,7 @@ func (c *Cache) completeFieldLiteralValues(
 						InsertTextFormat: &snippetMode,
 						InsertTextMode:   &adjustIndentationMode,
 					},
-				}
+				}...)
 			}
 		}
 	case protoreflect.EnumKind:
@@ -709,6 +770,10 @@ func (c *Cache) completeFieldLiteralValues(
 		return completeEnumValues(enum, partialName, partialNameSuffix, pos)
 	case protoreflect.BoolKind:
 		return completeKeywords([]string{"true", "false"}, partialName, partialNameSuffix, pos)
+	case protoreflect.StringKind:
+		if kind, _ := c.stringReferenceKind(fd); kind == "resource" {
+			return c.completeResourceTypes(valueNode, fileNode, pos)
+		}
 	}
 	return nil
 }
@@ -788,10 +853,14 @@ func fieldCompletion(fld protoreflect.FieldDescriptor, rng protocol.Range, style
 		case protoreflect.MessageKind:
 			msg := fld.Message()
 			if !msg.IsMapEntry() {
+				literal := "{\n  ${0}\n}"
+				if wk, ok := wellKnownLiterals[msg.FullName()]; ok {
+					literal = wk.snippet
+				}
 				compl.TextEdit = &protocol.Or_CompletionItem_textEdit{
 					Value: protocol.TextEdit{
 						Range:   rng,
-						NewText: fmt.Sprintf("%s%s{\n  ${0}\n}", name, operator),
+						NewText: name + operator + literal,
 					},
 				}
 				textFmt := protocol.SnippetTextFormat
@@ -834,20 +903,27 @@ var (
 	snippetMode           = protocol.SnippetTextFormat
 )
 
-func findCompletionScope(nodePath protopath.Values, linkRes linker.Result) protoreflect.Descriptor {
+func (c *Cache) findCompletionScope(ctx context.Context, nodePath protopath.Values, linkRes linker.Result) protoreflect.Descriptor {
 	var scope protoreflect.Descriptor
 LOOP:
 	for i := len(nodePath.Path) - 1; i >= 0; i-- {
 		if paths.NodeIsConcrete(nodePath, i) {
 			switch paths.NodeAt[ast.Node](nodePath.Index(i)).(type) {
 			case *ast.MessageNode, *ast.FieldNode, *ast.EnumNode, *ast.ServiceNode, *ast.MessageFieldNode:
-				desc, _, err := deepPathSearch(nodePath.Path[:i+1], linkRes, linkRes)
+				desc, _, err := c.deepPathSearch(ctx, nodePath.Path[:i+1], linkRes, linkRes)
 				if err != nil || desc == nil {
 					continue
 				}
 				scope = desc
 				break LOOP
-			case *ast.FileNode, *ast.RPCNode:
+			case *ast.RPCNode:
+				if desc, _, err := c.deepPathSearch(ctx, nodePath.Path[:i+1], linkRes, linkRes); err == nil && desc != nil {
+					scope = desc
+				} else {
+					scope = linkRes
+				}
+				break LOOP
+			case *ast.FileNode:
 				scope = linkRes
 				break LOOP
 			}
@@ -856,6 +932,307 @@ LOOP:
 	return scope
 }
 
+var (
+	// matches '[(ext) = ' and '[(ext) = [A, B, ' (for repeated options)
+	incompleteCompactOptionValueRegex = regexp.MustCompile(`[\[,]\s*\(([\w.]+)\)\s*=\s*(\[(?:\s*\w+\s*,)*)?\s*(\w*)$`)
+	// matches '<type> <name> = <tag> [default = ' and '[..., default = '
+	incompleteDefaultOptionValueRegex = regexp.MustCompile(`([\w.]+)\s+\w+\s*=\s*\d+\s*\[(?:[^\]]*,)?\s*default\s*=\s*(\w*)$`)
+	identSuffixRegex                  = regexp.MustCompile(`^[\w.]*`)
+)
+
+// completeIncompleteStatement provides completions for statements which are
+// not yet complete enough to appear in the AST, such as 'rpc Foo (' or
+// 'string foo = 1 [(', based on the enclosing declaration in the partial AST
+// and the tokens of the statement preceding the cursor.
+func (c *Cache) completeIncompleteStatement(
+	fileNode *ast.FileNode,
+	offset int,
+	textFollowingCursor string,
+	linkRes linker.Result,
+	pos protocol.Position,
+) ([]protocol.CompletionItem, bool) {
+	if linkRes == nil || fileNode == nil {
+		return nil, false
+	}
+	stmt, ok := findIncompleteStatement(fileNode, offset)
+	if !ok {
+		return nil, false
+	}
+	partialNameSuffix := identSuffixRegex.FindString(textFollowingCursor)
+
+	var optionsMsg protoreflect.MessageDescriptor
+	switch stmt.block {
+	case "service":
+		stream, ok := stmt.rpcType()
+		if !ok {
+			return nil, false
+		}
+		var items []protocol.CompletionItem
+		if !stream {
+			items = append(items, completeKeywords([]string{"stream"}, stmt.partialName, partialNameSuffix, pos)...)
+		}
+		items = append(items, completeTypeNames(c, stmt.partialName, partialNameSuffix, linkRes, linkRes.Package(), pos)...)
+		return items, true
+	case "message", "group", "extend", "oneof":
+		optionsMsg = (*descriptorpb.FieldOptions)(nil).ProtoReflect().Descriptor()
+		if m := incompleteDefaultOptionValueRegex.FindStringSubmatch(stmt.text); m != nil {
+			return completeIncompleteDefaultValue(m[1], m[2], partialNameSuffix, linkRes, pos), true
+		}
+	case "enum":
+		optionsMsg = (*descriptorpb.EnumValueOptions)(nil).ProtoReflect().Descriptor()
+	default:
+		return nil, false
+	}
+	if m := incompleteCompactOptionValueRegex.FindStringSubmatch(stmt.text); m != nil {
+		return c.completeIncompleteOptionValue(m[1], m[2], m[3], partialNameSuffix, linkRes, pos), true
+	}
+	hasOpenParen, ok := stmt.compactOptionName()
+	if !ok {
+		return nil, false
+	}
+	items, err := c.deepCompleteOptionNames(optionsMsg, stmt.partialName, partialNameSuffix, linkRes.AST(), linkRes, nil, nil, pos)
+	if err != nil {
+		return nil, false
+	}
+	if hasOpenParen {
+		// only extensions can be completed, and the edit should replace the
+		// paren that was already typed
+		hasCloseParen := strings.HasPrefix(textFollowingCursor[len(partialNameSuffix):], ")")
+		items = slices.DeleteFunc(items, func(item protocol.CompletionItem) bool {
+			return !strings.HasPrefix(item.Label, "(")
+		})
+		for i := range items {
+			edit := items[i].TextEdit.Value.(protocol.TextEdit)
+			edit.Range.Start = adjustColumn(edit.Range.Start, -1)
+			if hasCloseParen {
+				edit.Range.End = adjustColumn(edit.Range.End, 1)
+			}
+			items[i].TextEdit.Value = edit
+		}
+	}
+	return items, true
+}
+
+// incompleteStatement is the part of a statement preceding the cursor which
+// the parser could not make sense of, and so is missing from the AST.
+type incompleteStatement struct {
+	// the keyword of the innermost declaration whose body contains the
+	// statement (e.g. "message"), or empty at the top level of the file
+	block string
+	// the text of each token in the statement, not including partialName
+	tokens []string
+	// the name (possibly qualified) immediately preceding the cursor, if any
+	partialName string
+	// the text of the statement, with comments removed and whitespace
+	// between tokens collapsed to a single space
+	text string
+}
+
+// findIncompleteStatement collects the tokens between the cursor and the end
+// of the previous statement or the start of the enclosing block. Since the
+// tokens come from the lexer, braces and semicolons within strings and
+// comments are not mistaken for statement boundaries.
+func findIncompleteStatement(fileNode *ast.FileNode, offset int) (incompleteStatement, bool) {
+	if _, comment := fileNode.ItemAtOffset(offset); comment.IsValid() {
+		return incompleteStatement{}, false
+	}
+	var stmt incompleteStatement
+	tokens := fileNode.Tokens()
+	tok, ok := tokens.Last()
+	for ok && fileNode.TokenInfo(tok).Start().Offset >= offset {
+		tok, ok = tokens.Previous(tok)
+	}
+	var text []string // in reverse order
+	// offset of the start of the token following the current one
+	next := offset
+	inPartialName := true
+	for ; ok; tok, ok = tokens.Previous(tok) {
+		info := fileNode.TokenInfo(tok)
+		start := info.Start().Offset
+		raw := info.RawText()
+		if len(raw) == 0 {
+			// virtual tokens inserted by the parser
+			continue
+		}
+		if raw == ";" || raw == "{" || raw == "}" {
+			break
+		}
+		if start+len(raw) > offset {
+			// the cursor is within this token
+			raw = raw[:offset-start]
+		}
+		adjacent := start+len(raw) == next
+		if !adjacent {
+			text = append(text, " ")
+		}
+		if inPartialName = inPartialName && adjacent && isNameText(raw); inPartialName {
+			stmt.partialName = raw + stmt.partialName
+		} else {
+			stmt.tokens = append(stmt.tokens, raw)
+		}
+		text = append(text, raw)
+		next = start
+	}
+	if len(text) == 0 {
+		return incompleteStatement{}, false
+	}
+	slices.Reverse(stmt.tokens)
+	slices.Reverse(text)
+	stmt.text = strings.Join(text, "")
+
+	// Find the brace which opened the enclosing block. The parser drops the
+	// declaration containing a syntax error when it cannot recover within it,
+	// so the block is only looked up in the partial AST once its brace has
+	// been found.
+	depth := 0
+	for ; ok; tok, ok = tokens.Previous(tok) {
+		switch fileNode.TokenInfo(tok).RawText() {
+		case "}":
+			depth++
+		case "{":
+			if depth > 0 {
+				depth--
+				continue
+			}
+			stmt.block = blockKeyword(fileNode, tok, findEnclosingBlock(fileNode, offset))
+			return stmt, true
+		}
+	}
+	return stmt, true
+}
+
+// blockKeyword returns the keyword of the declaration opened by the given
+// brace. If the declaration is the given block from the partial AST, the
+// keyword is determined by its node type; otherwise it is the first token of
+// the declaration.
+func blockKeyword(fileNode *ast.FileNode, openBrace ast.Token, block ast.Node) string {
+	tokens := fileNode.Tokens()
+	first := openBrace
+	for tok, ok := tokens.Previous(openBrace); ok; tok, ok = tokens.Previous(tok) {
+		if raw := fileNode.TokenInfo(tok).RawText(); raw == ";" || raw == "{" || raw == "}" {
+			break
+		} else if raw != "" {
+			first = tok
+		}
+	}
+	if block != nil && fileNode.NodeInfo(block).Start().Offset == fileNode.TokenInfo(first).Start().Offset {
+		switch block.(type) {
+		case *ast.MessageNode:
+			return "message"
+		case *ast.GroupNode:
+			return "group"
+		case *ast.EnumNode:
+			return "enum"
+		case *ast.ServiceNode:
+			return "service"
+		case *ast.ExtendNode:
+			return "extend"
+		case *ast.OneofNode:
+			return "oneof"
+		case *ast.RPCNode:
+			return "rpc"
+		}
+	}
+	return fileNode.TokenInfo(first).RawText()
+}
+
+// findEnclosingBlock returns the innermost message, group, enum, service,
+// extend, oneof, or rpc declaration in the (possibly partial) AST which
+// contains the given offset.
+func findEnclosingBlock(fileNode *ast.FileNode, offset int) ast.Node {
+	var block ast.Node
+	ast.Inspect(fileNode, func(node ast.Node) bool {
+		if node == fileNode {
+			return true
+		}
+		info := fileNode.NodeInfo(node)
+		if !info.IsValid() || offset <= info.Start().Offset || offset > info.End().Offset {
+			return false
+		}
+		switch node.(type) {
+		case *ast.MessageNode, *ast.GroupNode, *ast.EnumNode, *ast.ServiceNode,
+			*ast.ExtendNode, *ast.OneofNode, *ast.RPCNode:
+			block = node
+		}
+		return true
+	})
+	return block
+}
+
+// rpcType reports whether the statement is an rpc declaration with the cursor
+// at its input or output type, i.e. 'rpc Foo (' or 'rpc Foo (Req) returns ('.
+// The returned bool indicates whether the type is already marked as a stream.
+func (s incompleteStatement) rpcType() (stream bool, ok bool) {
+	toks := s.tokens
+	if n := len(toks); n > 0 && toks[n-1] == "stream" {
+		stream = true
+		toks = toks[:n-1]
+	}
+	if n := len(toks); n == 0 || toks[n-1] != "(" {
+		return false, false
+	}
+	toks = toks[:len(toks)-1]
+	switch {
+	case len(toks) == 2 && toks[0] == "rpc" && isNameText(toks[1]):
+		return stream, true
+	case len(toks) > 2 && toks[0] == "rpc" && toks[len(toks)-2] == ")" && toks[len(toks)-1] == "returns":
+		return stream, true
+	}
+	return false, false
+}
+
+// compactOptionName reports whether the cursor is at the name of a compact
+// option, i.e. following '[' or ',' within brackets. The returned bool
+// indicates whether the name begins with an open paren.
+func (s incompleteStatement) compactOptionName() (hasOpenParen bool, ok bool) {
+	toks := s.tokens
+	if n := len(toks); n > 0 && toks[n-1] == "(" {
+		hasOpenParen = true
+		toks = toks[:n-1]
+	}
+	n := len(toks)
+	if n == 0 || (toks[n-1] != "[" && toks[n-1] != ",") || !slices.Contains(toks, "[") {
+		return false, false
+	}
+	return hasOpenParen, true
+}
+
+func isNameText(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool {
+		return r != '_' && r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) == -1
+}
+
+// completeIncompleteOptionValue completes enum and bool values for an
+// extension in an incomplete compact option. Values already present in a list
+// of repeated values are excluded.
+func (c *Cache) completeIncompleteOptionValue(extName, listPrefix, partialName, partialNameSuffix string, linkRes linker.Result, pos protocol.Position) []protocol.CompletionItem {
+	desc := resolveRelativeName(linker.ResolverFromFile(linkRes), linkRes.Package(), extName, func(d protoreflect.Descriptor) bool {
+		_, ok := d.(protoreflect.ExtensionDescriptor)
+		return ok
+	})
+	if desc == nil {
+		return nil
+	}
+	fd := desc.(protoreflect.ExtensionDescriptor)
+	var items []protocol.CompletionItem
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		items = completeEnumValues(fd.Enum(), partialName, partialNameSuffix, pos)
+	case protoreflect.BoolKind:
+		items = completeKeywords([]string{"true", "false"}, partialName, partialNameSuffix, pos)
+	}
+	if listPrefix != "" {
+		existing := strings.FieldsFunc(listPrefix, func(r rune) bool {
+			return r == '[' || r == ',' || unicode.IsSpace(r)
+		})
+		items = slices.DeleteFunc(items, func(item protocol.CompletionItem) bool {
+			return slices.Contains(existing, item.Label)
+		})
+	}
+	return items
+}
+
 func findExistingOptions(scope protoreflect.Descriptor) map[string]struct{} {
 	existing := map[string]struct{}{}
 	scope.Options().ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
@@ -904,7 +1281,8 @@ func (c *Cache) deepCompleteOptionNames(
 	if prevMsg == nil || prevMsg.IsMapEntry() {
 		return nil, nil
 	}
-	if existingFieldRef != nil && shouldCompleteExtensions && existingFieldRef.IsExtension() {
+	// an open paren without a name (e.g. 'option (<cursor>') is also an extension
+	if existingFieldRef != nil && shouldCompleteExtensions && existingFieldRef.Open != nil && existingFieldRef.Slash == nil {
 		shouldCompleteNonExtensions = false
 	}
 
@@ -1029,6 +1407,13 @@ func completeTypeNames(cache *Cache, partialName, partialNameSuffix string, link
 	} else {
 		candidates = cache.FindAllDescriptorsByPrefix(context.TODO(), partialName, filter).All()
 	}
+	for _, wkt := range findWellKnownTypesByPrefix(partialName, filter) {
+		if !slices.ContainsFunc(candidates, func(d protoreflect.Descriptor) bool {
+			return d.FullName() == wkt.FullName()
+		}) {
+			candidates = append(candidates, wkt)
+		}
+	}
 
 	return completeTypeNamesFromList(candidates, partialName, partialNameSuffix, linkRes, scope, pos)
 }
@@ -1324,13 +1709,12 @@ func messageKeywordCompletions(fileNode *ast.FileNode, partialName, partialNameS
 
 func fileKeywordCompletions(fileNode *ast.FileNode, partialName, partialNameSuffix string, pos protocol.Position) []protocol.CompletionItem {
 	possibleKeywords := make([]string, 0, 8)
-	// TODO(editions): add edition keyword
 	var completions []protocol.CompletionItem
-	if fileNode.Syntax == nil {
-		if strings.HasPrefix("syntax", partialName) {
+	if fileNode.Syntax == nil && fileNode.Edition == nil {
+		if strings.HasPrefix("syntax", partialName) || strings.HasPrefix("edition", partialName) {
 			completions = append(completions, syntaxSnippets()...)
 		}
-		possibleKeywords = append(possibleKeywords, "syntax")
+		possibleKeywords = append(possibleKeywords, "syntax", "edition")
 	}
 	hasPkgNode := false
 	for _, pkg := range fileNode.Decls {
@@ -1362,7 +1746,12 @@ func syntaxSnippets() []protocol.CompletionItem {
 			InsertTextFormat: &snippetMode,
 			InsertText:       "syntax = \"proto2\";\n",
 		},
-		// TODO(editions): add edition keyword
+		{
+			Label:            "edition: " + newestSupportedEdition(),
+			Kind:             protocol.SnippetCompletion,
+			InsertTextFormat: &snippetMode,
+			InsertText:       fmt.Sprintf("edition = %q;\n", newestSupportedEdition()),
+		},
 	}
 }
 
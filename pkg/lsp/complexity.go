@@ -0,0 +1,61 @@
+package lsp
+
+import (
+	"context"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// lintComplexity reports declarations which exceed the size limits configured
+// in the lint.complexity settings: the number of fields in a message, the
+// nesting depth of messages, the number of fields in a oneof, and the number
+// of methods in a service. Limits are unset, and not checked, by default.
+func lintComplexity(_ context.Context, p *lintPass) {
+	limits := &p.settings.Lint.Complexity
+	severity := protocol.SeverityWarning
+	if limits.Severity == "hint" {
+		severity = protocol.SeverityHint
+	}
+	report := func(desc protoreflect.Descriptor, format string, args ...any) {
+		ref, err := findDefinition(desc, p.result)
+		if err != nil || !ref.NodeInfo.IsValid() {
+			return
+		}
+		d := p.reportSpan(ref.NodeInfo, format, args...)
+		d.Severity = severity
+	}
+
+	rangeMessages(p.result.Messages(), func(msg protoreflect.MessageDescriptor) {
+		if n := msg.Fields().Len(); limits.MaxFields > 0 && n > limits.MaxFields {
+			report(msg, "message %s has %d fields, more than the limit of %d", msg.Name(), n, limits.MaxFields)
+		}
+		if limits.MaxNestingDepth > 0 {
+			depth := 1
+			for parent := msg.Parent(); parent != nil; parent = parent.Parent() {
+				if _, ok := parent.(protoreflect.MessageDescriptor); ok {
+					depth++
+				}
+			}
+			// only the first message past the limit is reported
+			if depth == limits.MaxNestingDepth+1 {
+				report(msg, "message %s is nested %d levels deep, more than the limit of %d", msg.Name(), depth, limits.MaxNestingDepth)
+			}
+		}
+		oneofs := msg.Oneofs()
+		for i := range oneofs.Len() {
+			oneof := oneofs.Get(i)
+			if n := oneof.Fields().Len(); !oneof.IsSynthetic() && limits.MaxOneofMembers > 0 && n > limits.MaxOneofMembers {
+				report(oneof, "oneof %s has %d members, more than the limit of %d", oneof.Name(), n, limits.MaxOneofMembers)
+			}
+		}
+	})
+
+	services := p.result.Services()
+	for i := range services.Len() {
+		svc := services.Get(i)
+		if n := svc.Methods().Len(); limits.MaxMethods > 0 && n > limits.MaxMethods {
+			report(svc, "service %s has %d methods, more than the limit of %d", svc.Name(), n, limits.MaxMethods)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package lsp
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestLintComplexity(t *testing.T) {
+	const source = `syntax = "proto3";
+package a;
+message A {
+  int32 a = 1;
+  int32 b = 2;
+  int32 c = 3;
+  message B {
+    message C {
+      message D {}
+    }
+  }
+  oneof choice {
+    int32 x = 4;
+    int32 y = 5;
+    int32 z = 6;
+  }
+}
+service S {
+  rpc One(A) returns (A);
+  rpc Two(A) returns (A);
+}
+`
+	c, _ := newTestCache(t, map[string]string{"a.proto": source}, &Settings{
+		Lint: LintSettings{
+			Complexity: ComplexitySettings{
+				MaxFields:       5,
+				MaxNestingDepth: 2,
+				MaxOneofMembers: 2,
+				MaxMethods:      1,
+				Severity:        "hint",
+			},
+		},
+	})
+
+	diagnostics, _, _ := c.diagHandler.GetDiagnosticsForPath("a.proto")
+	var messages []string
+	for _, d := range diagnostics {
+		if d.Code != "complexity" {
+			continue
+		}
+		if d.Severity != protocol.SeverityHint {
+			t.Errorf("expected hint severity, got %v", d.Severity)
+		}
+		messages = append(messages, fmt.Sprintf("%d: %s", d.Range.Start().Line, d.Error))
+	}
+	want := []string{
+		"3: message A has 6 fields, more than the limit of 5",
+		"8: message C is nested 3 levels deep, more than the limit of 2",
+		"12: oneof choice has 3 members, more than the limit of 2",
+		"18: service S has 2 methods, more than the limit of 1",
+	}
+	slices.Sort(messages)
+	slices.Sort(want)
+	if !slices.Equal(messages, want) {
+		t.Errorf("got diagnostics:\n%s\nwant:\n%s", strings.Join(messages, "\n"), strings.Join(want, "\n"))
+	}
+}
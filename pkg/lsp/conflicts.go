@@ -0,0 +1,315 @@
+package lsp
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/kralicky/protocompile"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/pkg/gocommand"
+)
+
+// Sources which can provide a file for an import path, named as in the
+// importPrecedence setting. When a path can be resolved by more than one of
+// them, the first in the precedence order is used. Well-known imports and
+// import aliases always take precedence over all of these.
+const (
+	// files in the workspace, and files in the go module cache which were
+	// previously found under the same path
+	importSourceWorkspace = "workspace"
+	// synthetic files from an imported index archive
+	importSourceIndex = "index"
+	// files found in, or synthesized from, go modules required by the local
+	// module. Within go modules, the module with the longest matching path
+	// provides the file, as with the go command.
+	importSourceGoModule = "goModule"
+)
+
+var defaultImportPrecedence = []string{importSourceWorkspace, importSourceIndex, importSourceGoModule}
+
+// normalizeImportPrecedence returns a complete precedence order from a
+// possibly partial one: unknown and repeated sources are dropped, and sources
+// which are not listed follow the listed ones in their default order.
+func normalizeImportPrecedence(order []string) []string {
+	normalized := make([]string, 0, len(defaultImportPrecedence))
+	for _, source := range order {
+		if !slices.Contains(defaultImportPrecedence, source) {
+			slog.Warn("ignoring unknown import source in import precedence", "source", source)
+			continue
+		}
+		if !slices.Contains(normalized, source) {
+			normalized = append(normalized, source)
+		}
+	}
+	for _, source := range defaultImportPrecedence {
+		if !slices.Contains(normalized, source) {
+			normalized = append(normalized, source)
+		}
+	}
+	return normalized
+}
+
+// importConflict records an import path which is provided both by a file in
+// the workspace and by a go module.
+type importConflict struct {
+	workspaceURI protocol.DocumentURI
+	module       *gocommand.ModuleJSON
+}
+
+type ImportConflict = protocolext.ImportConflict
+
+// SetImportPrecedence changes the configured order of import sources, and
+// reports whether the order in effect changed. The configured order is not
+// used while a session override is set with OverrideImportPrecedence.
+func (r *Resolver) SetImportPrecedence(order []string) bool {
+	r.pathsMu.Lock()
+	defer r.pathsMu.Unlock()
+	r.importPrecedenceSetting = normalizeImportPrecedence(order)
+	return r.updateImportPrecedenceLocked()
+}
+
+// OverrideImportPrecedence sets the order of import sources for the rest of
+// the session, or removes the override if order is empty. It reports whether
+// the order in effect changed.
+func (r *Resolver) OverrideImportPrecedence(order []string) bool {
+	r.pathsMu.Lock()
+	defer r.pathsMu.Unlock()
+	if len(order) == 0 {
+		r.importPrecedenceOverride = nil
+	} else {
+		r.importPrecedenceOverride = normalizeImportPrecedence(order)
+	}
+	return r.updateImportPrecedenceLocked()
+}
+
+func (r *Resolver) updateImportPrecedenceLocked() bool {
+	order := defaultImportPrecedence
+	if r.importPrecedenceOverride != nil {
+		order = r.importPrecedenceOverride
+	} else if r.importPrecedenceSetting != nil {
+		order = r.importPrecedenceSetting
+	}
+	if slices.Equal(order, r.importPrecedence) {
+		return false
+	}
+	r.importPrecedence = order
+	return true
+}
+
+// prefersLocked reports whether the first source comes before the second in
+// the order in effect.
+func (r *Resolver) prefersLocked(a, b string) bool {
+	return slices.Index(r.importPrecedence, a) < slices.Index(r.importPrecedence, b)
+}
+
+func isWorkspaceImportSource(source ImportSource) bool {
+	switch source {
+	case SourceRelativePath, SourceLocalGoModule, SourceImportAlias:
+		return true
+	}
+	return false
+}
+
+// recordConflictsLocked checks whether a path resolved from the given source
+// can also be resolved from the source it was preferred over, and records the
+// conflict if so. previous is the URI the path was mapped to before it was
+// resolved.
+func (r *Resolver) recordConflictsLocked(path string, source string, previous protocol.DocumentURI) {
+	if _, ok := r.importConflicts[path]; ok {
+		return
+	}
+	switch source {
+	case importSourceWorkspace:
+		uri := r.fileURIsByPath[path]
+		if !isWorkspaceImportSource(r.importSourcesByURI[uri]) || !r.goLanguageDriver.HasGoModule() {
+			return
+		}
+		var conflict importConflict
+		res, err := r.goLanguageDriver.ImportFromGoModule(path)
+		if err == nil && res.Module.Path != r.goLanguageDriver.localModName &&
+			(!res.SourceExists || protocol.URIFromPath(res.SourcePath) != uri) {
+			conflict = importConflict{workspaceURI: uri, module: res.Module}
+		}
+		// an empty entry records that the path was checked
+		r.importConflicts[path] = conflict
+	case importSourceGoModule:
+		if previous == "" || !isWorkspaceImportSource(r.importSourcesByURI[previous]) {
+			return
+		}
+		module := r.importOrigins[r.fileURIsByPath[path]].module
+		if module == nil {
+			return
+		}
+		r.importConflicts[path] = importConflict{workspaceURI: previous, module: module}
+	}
+}
+
+// ImportConflicts returns the import paths which are provided both by a file
+// in the workspace and by a go module, sorted by path.
+func (r *Resolver) ImportConflicts() []ImportConflict {
+	r.pathsMu.RLock()
+	defer r.pathsMu.RUnlock()
+	var conflicts []ImportConflict
+	for path := range r.importConflicts {
+		if conflict, ok := r.importConflictLocked(path); ok {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	slices.SortFunc(conflicts, func(a, b ImportConflict) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return conflicts
+}
+
+// ImportConflict returns the conflict for the given import path, if it is
+// provided both by a file in the workspace and by a go module.
+func (r *Resolver) ImportConflict(path string) (ImportConflict, bool) {
+	r.pathsMu.RLock()
+	defer r.pathsMu.RUnlock()
+	return r.importConflictLocked(path)
+}
+
+func (r *Resolver) importConflictLocked(path string) (ImportConflict, bool) {
+	conflict, ok := r.importConflicts[path]
+	if !ok || conflict.module == nil {
+		return ImportConflict{}, false
+	}
+	chosen := importSourceGoModule
+	if r.prefersLocked(importSourceWorkspace, importSourceGoModule) {
+		chosen = importSourceWorkspace
+	}
+	return ImportConflict{
+		Path:         path,
+		Chosen:       chosen,
+		WorkspaceURI: conflict.workspaceURI,
+		GoModule: GoModuleInfo{
+			Path:    conflict.module.Path,
+			Version: conflict.module.Version,
+			Dir:     conflict.module.Dir,
+		},
+	}, true
+}
+
+// remapConflictsLocked points conflicting paths at the file from the
+// preferred source, and returns the paths which changed. Paths preferring go
+// modules are unmapped from workspace files, and mapped again when they are
+// next resolved.
+func (r *Resolver) remapConflictsLocked() []string {
+	var changed []string
+	preferWorkspace := r.prefersLocked(importSourceWorkspace, importSourceGoModule)
+	for path, conflict := range r.importConflicts {
+		if conflict.module == nil {
+			continue
+		}
+		if r.filePathsByURI[conflict.workspaceURI] != path {
+			// the workspace file has moved or been deleted
+			delete(r.importConflicts, path)
+			continue
+		}
+		current := r.fileURIsByPath[path]
+		switch {
+		case preferWorkspace && current != conflict.workspaceURI:
+			r.fileURIsByPath[path] = conflict.workspaceURI
+		case !preferWorkspace && current == conflict.workspaceURI:
+			delete(r.fileURIsByPath, path)
+		default:
+			continue
+		}
+		changed = append(changed, path)
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// ClearImportConflicts forgets all known conflicts, so that they are checked
+// again the next time each path is resolved.
+func (r *Resolver) ClearImportConflicts() {
+	r.pathsMu.Lock()
+	defer r.pathsMu.Unlock()
+	clear(r.importConflicts)
+}
+
+// applyImportPrecedence recompiles the files affected by a change to the
+// order of import sources.
+func (c *Cache) applyImportPrecedence(ctx context.Context) {
+	c.resolver.pathsMu.Lock()
+	changed := c.resolver.remapConflictsLocked()
+	c.resolver.pathsMu.Unlock()
+	if len(changed) == 0 {
+		return
+	}
+	slog.Info("import precedence changed, recompiling conflicting imports", "paths", len(changed))
+	c.Compile(ctx, changed, c.diagHandler.Flush)
+}
+
+// lintImportConflicts reports imports of paths which are provided both by a
+// file in the workspace and by a go module, explaining which copy is used.
+func lintImportConflicts(_ context.Context, p *lintPass) {
+	fileNode := p.result.AST()
+	imports := p.result.Imports()
+	var index int
+	for _, decl := range fileNode.Decls {
+		imp := decl.GetImport()
+		if imp == nil || imp.IsIncomplete() {
+			continue
+		}
+		index++
+		if index > imports.Len() {
+			return
+		}
+		path := imports.Get(index - 1).Path()
+		conflict, ok := p.cache.resolver.ImportConflict(path)
+		if !ok {
+			continue
+		}
+		module := conflict.GoModule.Path
+		if conflict.GoModule.Version != "" {
+			module += "@" + conflict.GoModule.Version
+		}
+		var chosen, other string
+		if conflict.Chosen == importSourceWorkspace {
+			chosen = fmt.Sprintf("the workspace copy (%s)", conflict.WorkspaceURI.Path())
+			other = "the go module " + module
+		} else {
+			chosen = "the copy in the go module " + module
+			other = fmt.Sprintf("the workspace (%s)", conflict.WorkspaceURI.Path())
+		}
+		d := p.report(imp.Name, "%s is also provided by %s; using %s. The order can be changed with the importPrecedence setting", path, other, chosen)
+		d.Severity = protocol.SeverityInformation
+	}
+}
+
+// resolveInOrderLocked tries each import source in the order in effect.
+func (r *Resolver) resolveInOrderLocked(path string, whence protocompile.ImportContext, isSynthetic bool) (protocompile.SearchResult, string, error) {
+	for _, source := range r.importPrecedence {
+		var result protocompile.SearchResult
+		var err error
+		switch source {
+		case importSourceWorkspace:
+			if isSynthetic {
+				continue
+			}
+			result, err = r.checkFS(path, whence)
+		case importSourceIndex:
+			result, err = r.checkPrebuilt(path)
+		case importSourceGoModule:
+			result, err = r.checkGoModule(path, whence)
+			if errors.Is(err, ErrNoModule) {
+				err = os.ErrNotExist
+			}
+		}
+		if err == nil {
+			return result, source, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return protocompile.SearchResult{}, source, err
+		}
+	}
+	return protocompile.SearchResult{}, "", os.ErrNotExist
+}
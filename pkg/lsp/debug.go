@@ -0,0 +1,95 @@
+package lsp
+
+import (
+	"cmp"
+	"expvar"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"slices"
+
+	gsync "github.com/kralicky/gpkg/sync"
+)
+
+// liveServers contains the servers which have not yet shut down, so that
+// their state can be shown on the debug status page.
+var liveServers gsync.Map[*Server, bool]
+
+// DebugHandler returns a handler which serves pprof profiles at
+// /debug/pprof/, expvar metrics at /debug/vars, and a status page showing
+// the resolver path mappings of each workspace at /.
+func DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/{$}", serveStatusPage)
+	return mux
+}
+
+type workspaceStatus struct {
+	Root     string
+	Snapshot uint64
+	Mappings []PathMapping
+}
+
+func serveStatusPage(w http.ResponseWriter, r *http.Request) {
+	var workspaces []workspaceStatus
+	liveServers.Range(func(s *Server, _ bool) bool {
+		s.cachesMu.RLock()
+		defer s.cachesMu.RUnlock()
+		for path, c := range s.caches {
+			status := workspaceStatus{
+				Root:     path,
+				Mappings: c.resolver.PathMappings(),
+			}
+			// don't wait for a compilation in progress
+			if snapshot := c.snapshot.Load(); snapshot != nil {
+				status.Snapshot = snapshot.ID()
+			}
+			workspaces = append(workspaces, status)
+		}
+		return true
+	})
+	slices.SortFunc(workspaces, func(a, b workspaceStatus) int {
+		return cmp.Compare(a.Root, b.Root)
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusPageTemplate.Execute(w, workspaces); err != nil {
+		slog.Error("failed to render debug status page", "error", err)
+	}
+}
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>protols</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 8px; text-align: left; }
+tr:nth-child(even) { background: #f0f0f0; }
+</style>
+</head>
+<body>
+<h1>protols</h1>
+<p><a href="/debug/vars">metrics</a> | <a href="/debug/pprof/">profiles</a></p>
+{{- range .}}
+<h2>{{.Root}}</h2>
+<p>Snapshot {{.Snapshot}}</p>
+<table>
+<tr><th>Path</th><th>Source</th><th>URI</th></tr>
+{{- range .Mappings}}
+<tr><td>{{.Path}}{{if .Inconsistent}} (inconsistent){{end}}</td><td>{{.Source}}</td><td>{{.URI}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>No workspaces.</p>
+{{- end}}
+</body>
+</html>
+`))
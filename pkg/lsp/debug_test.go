@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestDebugHandler(t *testing.T) {
+	resolver := NewResolver(protocol.WorkspaceFolder{URI: "file:///workspace"})
+	resolver.filePathsByURI["file:///workspace/foo/foo.proto"] = "example.com/foo/foo.proto"
+	resolver.importSourcesByURI["file:///workspace/foo/foo.proto"] = SourceLocalGoModule
+	s := &Server{
+		caches: map[string]*Cache{
+			"/workspace": {resolver: resolver},
+		},
+	}
+	liveServers.Store(s, true)
+	defer liveServers.Delete(s)
+
+	metrics.referenceQueries.since(time.Now().Add(-time.Millisecond))
+
+	srv := httptest.NewServer(DebugHandler())
+	defer srv.Close()
+
+	get := func(path string) string {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: %s", path, resp.Status)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	status := get("/")
+	for _, want := range []string{"/workspace", "example.com/foo/foo.proto", "local go module"} {
+		if !strings.Contains(status, want) {
+			t.Errorf("status page does not contain %q:\n%s", want, status)
+		}
+	}
+
+	var vars struct {
+		Protols struct {
+			ReferenceQueries struct {
+				Count int64 `json:"count"`
+			} `json:"reference_queries"`
+		} `json:"protols"`
+	}
+	if err := json.Unmarshal([]byte(get("/debug/vars")), &vars); err != nil {
+		t.Fatal(err)
+	}
+	if vars.Protols.ReferenceQueries.Count == 0 {
+		t.Errorf("expected reference queries to be recorded")
+	}
+
+	get("/debug/pprof/")
+}
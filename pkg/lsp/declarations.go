@@ -0,0 +1,188 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protocompile/protoutil"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// lintExtensionDeclarations reports extensions of messages whose extension
+// ranges require declarations (verification = DECLARATION, or any
+// declarations present), when the range has no matching declaration for the
+// extension's number, or when the declaration's full_name or type do not
+// match. Missing declarations can be added to the extendee's file with a
+// quick fix.
+func lintExtensionDeclarations(_ context.Context, p *lintPass) {
+	rangeExtensions(p.result, func(xd protoreflect.ExtensionDescriptor) {
+		extendee := xd.ContainingMessage()
+		er, ok := extensionRangeProto(extendee, xd.Number())
+		if !ok || !requiresDeclarations(er.GetOptions()) {
+			return
+		}
+		node := fieldDeclNode(p.result, xd)
+		if node == nil || node.GetTag() == nil {
+			return
+		}
+		fullName, typeName := "."+string(xd.FullName()), declarationTypeName(xd)
+		for _, decl := range er.GetOptions().GetDeclaration() {
+			if decl.GetNumber() != int32(xd.Number()) {
+				continue
+			}
+			switch {
+			case decl.GetReserved():
+				p.report(node.GetTag(), "extension number %d is reserved in the extension declarations of %s", xd.Number(), extendee.FullName())
+			case decl.GetFullName() != fullName:
+				p.report(node.GetName(), "extension number %d is declared in %s with full_name %q, not %q", xd.Number(), extendee.FullName(), decl.GetFullName(), fullName)
+			case decl.GetType() != typeName:
+				p.report(node.GetFieldTypeNode(), "extension %s is declared in %s with type %q, not %q", xd.Name(), extendee.FullName(), decl.GetType(), typeName)
+			case decl.GetRepeated() != (xd.Cardinality() == protoreflect.Repeated):
+				p.report(node.GetTag(), "extension %s does not match the repeated label of its declaration in %s", xd.Name(), extendee.FullName())
+			}
+			return
+		}
+		d := p.report(node.GetTag(), "extension number %d is not declared in the extension range of %s", xd.Number(), extendee.FullName())
+		if action, ok := p.cache.addDeclarationAction(extendee, er, xd); ok {
+			d.CodeActions = append(d.CodeActions, action)
+		}
+	})
+}
+
+// rangeExtensions calls fn for each extension declared in the file, including
+// those nested in messages.
+func rangeExtensions(res linker.Result, fn func(protoreflect.ExtensionDescriptor)) {
+	exts := res.Extensions()
+	for i := range exts.Len() {
+		fn(exts.Get(i))
+	}
+	rangeMessages(res.Messages(), func(msg protoreflect.MessageDescriptor) {
+		exts := msg.Extensions()
+		for i := range exts.Len() {
+			fn(exts.Get(i))
+		}
+	})
+}
+
+// extensionRangeProto returns the extension range of the message which
+// contains the given number.
+func extensionRangeProto(msg protoreflect.MessageDescriptor, number protoreflect.FieldNumber) (*descriptorpb.DescriptorProto_ExtensionRange, bool) {
+	wrapper, ok := msg.(protoutil.DescriptorProtoWrapper)
+	if !ok {
+		return nil, false
+	}
+	for _, er := range wrapper.AsProto().(*descriptorpb.DescriptorProto).GetExtensionRange() {
+		if int32(number) >= er.GetStart() && int32(number) < er.GetEnd() {
+			return er, true
+		}
+	}
+	return nil, false
+}
+
+func requiresDeclarations(opts *descriptorpb.ExtensionRangeOptions) bool {
+	return opts.GetVerification() == descriptorpb.ExtensionRangeOptions_DECLARATION || len(opts.GetDeclaration()) > 0
+}
+
+// declarationTypeName returns the type of the extension as written in an
+// extension declaration: a fully qualified message or enum name with a leading
+// dot, or the name of a scalar type.
+func declarationTypeName(xd protoreflect.ExtensionDescriptor) string {
+	switch xd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "." + string(xd.Message().FullName())
+	case protoreflect.EnumKind:
+		return "." + string(xd.Enum().FullName())
+	default:
+		return xd.Kind().String()
+	}
+}
+
+// addDeclarationAction returns a quick fix which adds a declaration for the
+// extension to the compact options of the extension range in the extendee's
+// file. It requires resultsMu to be held.
+func (c *Cache) addDeclarationAction(extendee protoreflect.MessageDescriptor, er *descriptorpb.DescriptorProto_ExtensionRange, xd protoreflect.ExtensionDescriptor) (CodeAction, bool) {
+	res, err := c.findResultByPathLocked(extendee.ParentFile().Path())
+	if err != nil {
+		return CodeAction{}, false
+	}
+	fileNode := res.AST()
+	if fileNode == nil {
+		return CodeAction{}, false
+	}
+	rangeNode := res.ExtensionRangeNode(er)
+	if rangeNode == nil {
+		return CodeAction{}, false
+	}
+	var options *ast.CompactOptionsNode
+	ast.Inspect(fileNode, func(node ast.Node) bool {
+		if ern, ok := node.(*ast.ExtensionRangeNode); ok {
+			for _, elem := range ern.GetElements() {
+				if elem.GetRange() == rangeNode {
+					options = ern.GetOptions()
+				}
+			}
+			return false
+		}
+		return options == nil
+	})
+	if options == nil || options.CloseBracket == nil {
+		return CodeAction{}, false
+	}
+
+	var decl strings.Builder
+	fmt.Fprintf(&decl, "declaration = { number: %d, full_name: %q, type: %q", xd.Number(), "."+string(xd.FullName()), declarationTypeName(xd))
+	if xd.Cardinality() == protoreflect.Repeated {
+		decl.WriteString(", repeated: true")
+	}
+	decl.WriteString(" }")
+
+	// insert after the last option, on a new line if the options are written
+	// one per line
+	insertPos := toPosition(fileNode.NodeInfo(options.CloseBracket).Start())
+	newText := decl.String()
+	if n := len(options.Options); n > 0 {
+		last := options.Options[n-1]
+		lastInfo := fileNode.NodeInfo(last.Val)
+		separator := ","
+		if last.Semicolon != nil && !last.Semicolon.Virtual {
+			lastInfo = fileNode.NodeInfo(last.Semicolon)
+			separator = ""
+		}
+		insertPos = toPosition(lastInfo.End())
+		if closeLine := fileNode.NodeInfo(options.CloseBracket).Start().Line; closeLine > lastInfo.End().Line {
+			indent := fileNode.NodeInfo(last).LeadingWhitespace()
+			if i := strings.LastIndexByte(indent, '\n'); i >= 0 {
+				indent = indent[i+1:]
+			}
+			newText = separator + "\n" + indent + newText
+		} else {
+			newText = separator + " " + newText
+		}
+	}
+	return CodeAction{
+		Title:       fmt.Sprintf("Declare extension %s in %s", xd.FullName(), extendee.FullName()),
+		Path:        res.Path(),
+		Kind:        protocol.QuickFix,
+		IsPreferred: true,
+		Edits: []protocol.TextEdit{
+			{
+				Range:   protocol.Range{Start: insertPos, End: insertPos},
+				NewText: newText,
+			},
+		},
+	}, true
+}
+
+// resolveExtensionReference resolves the fully qualified name of an extension,
+// as used in extension declarations.
+func resolveExtensionReference(c *Cache, scope protoreflect.FullName, value string) protoreflect.Descriptor {
+	return resolveRelativeName(c, scope, value, func(d protoreflect.Descriptor) bool {
+		xd, ok := d.(protoreflect.FieldDescriptor)
+		return ok && xd.IsExtension()
+	})
+}
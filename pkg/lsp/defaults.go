@@ -0,0 +1,169 @@
+package lsp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Support for the 'default' pseudo-option of proto2 fields. The option is not
+// a field of FieldOptions, so it can't be resolved like other options; instead
+// it is resolved to the field it is declared on. The compiler validates the
+// value itself against the field type.
+
+// isDefaultPseudoOption reports whether the option name is the 'default'
+// pseudo-option.
+func isDefaultPseudoOption(name []*descriptorpb.UninterpretedOption_NamePart) bool {
+	return len(name) == 1 && name[0].GetNamePart() == "default" && !name[0].GetIsExtension()
+}
+
+// isDefaultOptionRef reports whether the option name part refers to the
+// 'default' pseudo-option.
+func isDefaultOptionRef(ref *ast.FieldReferenceNode) bool {
+	return ref != nil && !ref.IsExtension() && ref.GetName().AsIdentifier() == "default"
+}
+
+// enclosingFieldDescriptor returns the descriptor of the innermost field
+// declared along the given path of nodes, which must start at the file node.
+func enclosingFieldDescriptor(linkRes linker.Result, nodes []ast.Node) protoreflect.FieldDescriptor {
+	scope := linkRes.Package()
+	var field protoreflect.FieldDescriptor
+	for _, node := range nodes {
+		var fieldName protoreflect.Name
+		switch node := node.(type) {
+		case *ast.MessageNode:
+			scope = scope.Append(protoreflect.Name(node.Name.AsIdentifier()))
+			continue
+		case *ast.GroupNode:
+			fieldName = protoreflect.Name(strings.ToLower(string(node.Name.AsIdentifier())))
+		case *ast.FieldNode:
+			if node.Name == nil {
+				return nil
+			}
+			fieldName = protoreflect.Name(node.Name.AsIdentifier())
+		default:
+			continue
+		}
+		fd, ok := linkRes.FindDescriptorByName(scope.Append(fieldName)).(protoreflect.FieldDescriptor)
+		if !ok {
+			return nil
+		}
+		field = fd
+		if group, ok := node.(*ast.GroupNode); ok {
+			scope = scope.Append(protoreflect.Name(group.Name.AsIdentifier()))
+		}
+	}
+	return field
+}
+
+// resolveDefaultPseudoOption resolves a node within a 'default' pseudo-option
+// to the field the option is declared on, or to the enum value it refers to
+// if the cursor is on the value of an enum field's default.
+func resolveDefaultPseudoOption(linkRes linker.Result, values []ast.Node, current ast.Node) (protoreflect.Descriptor, protocol.Range, error) {
+	fd := enclosingFieldDescriptor(linkRes, values)
+	if fd == nil {
+		return nil, protocol.Range{}, fmt.Errorf("could not find field for default option")
+	}
+	root := linkRes.AST()
+	switch leaf := values[len(values)-1].(type) {
+	case *ast.IdentNode:
+		if _, ok := current.(*ast.OptionNode); !ok {
+			break
+		}
+		// the cursor is on the option value
+		if fd.Kind() != protoreflect.EnumKind {
+			return nil, protocol.Range{}, nil
+		}
+		if val := fd.Enum().Values().ByName(protoreflect.Name(leaf.AsIdentifier())); val != nil {
+			return val, toRange(root.NodeInfo(leaf)), nil
+		}
+		return nil, protocol.Range{}, nil
+	}
+	return fd, toRange(root.NodeInfo(current)), nil
+}
+
+// fieldDefaultDetails describes the explicit default value of a field, if it
+// has one.
+func fieldDefaultDetails(fd protoreflect.FieldDescriptor) string {
+	if !fd.HasDefault() {
+		return ""
+	}
+	var value string
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		ev := fd.DefaultEnumValue()
+		value = fmt.Sprintf("`%s` (%d)", ev.Name(), ev.Number())
+	case protoreflect.StringKind:
+		value = fmt.Sprintf("`%q`", fd.Default().String())
+	case protoreflect.BytesKind:
+		// escaped binary data is hard to read, so show the decoded bytes too
+		b := fd.Default().Bytes()
+		return fmt.Sprintf("Default value: `%q`\n\n%s", b, bytesDefaultPreview(b))
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		switch f := fd.Default().Float(); {
+		case math.IsInf(f, 1):
+			value = "`inf`"
+		case math.IsInf(f, -1):
+			value = "`-inf`"
+		case math.IsNaN(f):
+			value = "`nan`"
+		default:
+			value = fmt.Sprintf("`%s`", strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	default:
+		value = fmt.Sprintf("`%v`", fd.Default().Interface())
+	}
+	return fmt.Sprintf("Default value: %s\n", value)
+}
+
+// completeDefaultValue completes enum and bool values for the 'default'
+// pseudo-option of the given field.
+func completeDefaultValue(fd protoreflect.FieldDescriptor, partialName, partialNameSuffix string, pos protocol.Position) []protocol.CompletionItem {
+	if fd == nil || fd.IsList() {
+		return nil
+	}
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return completeEnumValues(fd.Enum(), partialName, partialNameSuffix, pos)
+	case protoreflect.BoolKind:
+		return completeKeywords([]string{"true", "false"}, partialName, partialNameSuffix, pos)
+	}
+	return nil
+}
+
+// completeIncompleteDefaultValue completes the value of a 'default'
+// pseudo-option in a field declaration which is still being typed. The field
+// type is resolved relative to the file's package.
+func completeIncompleteDefaultValue(typeName, partialName, partialNameSuffix string, linkRes linker.Result, pos protocol.Position) []protocol.CompletionItem {
+	if typeName == "bool" {
+		return completeKeywords([]string{"true", "false"}, partialName, partialNameSuffix, pos)
+	}
+	desc := resolveRelativeName(linker.ResolverFromFile(linkRes), linkRes.Package(), typeName, func(d protoreflect.Descriptor) bool {
+		_, ok := d.(protoreflect.EnumDescriptor)
+		return ok
+	})
+	if desc == nil {
+		return nil
+	}
+	return completeEnumValues(desc.(protoreflect.EnumDescriptor), partialName, partialNameSuffix, pos)
+}
+
+// optionPrecedingToken returns the last option in the list which starts
+// before the given token.
+func optionPrecedingToken(node *ast.CompactOptionsNode, token ast.Token) *ast.OptionNode {
+	var last *ast.OptionNode
+	for _, opt := range node.Options {
+		if opt.Start() >= token {
+			break
+		}
+		last = opt
+	}
+	return last
+}
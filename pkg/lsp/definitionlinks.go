@@ -0,0 +1,244 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protocompile/protoutil"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// FindDefinitionLinks returns the definitions of the symbol at the given
+// position as location links, whose origin is the range of the symbol, and
+// whose target is the whole declaration, with its name as the selection.
+//
+// For custom options, the links also include related declarations which can
+// be peeked at from the option: the options message being extended, and the
+// options declared on the extension itself, such as its default value and
+// any validation rules. For string option values which refer to files, the
+// link targets the file. For imports of paths which are provided by both a
+// workspace file and a go module, both files are returned, the one in use
+// first.
+func (c *Cache) FindDefinitionLinks(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams) ([]protocol.LocationLink, error) {
+	desc, rng, err := c.FindStringReferenceAtLocation(ctx, snapshot, params)
+	if err == nil && desc == nil {
+		desc, rng, err = c.FindTypeDescriptorAtLocation(ctx, snapshot, params)
+	}
+	if err != nil {
+		return nil, err
+	} else if desc == nil {
+		if link, ok := c.findFileReferenceLink(snapshot, params); ok {
+			return []protocol.LocationLink{link}, nil
+		}
+		locations, origin := c.tryFindPackageReferences(snapshot, params)
+		var links []protocol.LocationLink
+		for _, loc := range locations {
+			links = append(links, protocol.LocationLink{
+				OriginSelectionRange: &origin,
+				TargetURI:            loc.URI,
+				TargetRange:          loc.Range,
+				TargetSelectionRange: loc.Range,
+			})
+		}
+		return links, nil
+	}
+	if fd, ok := desc.(protoreflect.FieldDescriptor); ok && isCustomOption(fd) {
+		if links := c.customOptionLinks(snapshot, fd, rng); len(links) > 0 {
+			return links, nil
+		}
+	}
+	link, err := c.FindDeclarationLink(snapshot, desc, rng)
+	if err != nil {
+		return nil, err
+	}
+	links := []protocol.LocationLink{link}
+	if fd, ok := desc.(protoreflect.FileDescriptor); ok {
+		links = append(links, c.alternateImportLinks(fd.Path(), rng)...)
+	}
+	return links, nil
+}
+
+// FindTypeDefinitionLinks returns the definitions of the types of the
+// descriptor at the given location as location links: the message or enum
+// type of a field, or the request and response types of a method.
+func (c *Cache) FindTypeDefinitionLinks(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams) ([]protocol.LocationLink, error) {
+	desc, rng, err := c.FindTypeDescriptorAtLocation(ctx, snapshot, params)
+	if err != nil || desc == nil {
+		return nil, err
+	}
+	var types []protoreflect.Descriptor
+	switch desc := desc.(type) {
+	case protoreflect.FieldDescriptor:
+		if desc.IsMap() {
+			desc = desc.MapValue()
+		}
+		switch desc.Kind() {
+		case protoreflect.MessageKind, protoreflect.GroupKind:
+			types = append(types, desc.Message())
+		case protoreflect.EnumKind:
+			types = append(types, desc.Enum())
+		}
+	case protoreflect.MethodDescriptor:
+		types = append(types, desc.Input())
+		if desc.Output().FullName() != desc.Input().FullName() {
+			types = append(types, desc.Output())
+		}
+	case protoreflect.EnumValueDescriptor:
+		types = append(types, desc.Parent())
+	case protoreflect.MessageDescriptor, protoreflect.EnumDescriptor:
+		types = append(types, desc)
+	}
+	var links []protocol.LocationLink
+	for _, typ := range types {
+		link, err := c.FindDeclarationLink(snapshot, typ, rng)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// FindDeclarationLink returns a link from the origin range to the declaration
+// of the descriptor. The selection range of the link is the name of the
+// declaration, or the start of the file for file descriptors.
+func (c *Cache) FindDeclarationLink(snapshot *Snapshot, desc protoreflect.Descriptor, origin protocol.Range) (protocol.LocationLink, error) {
+	parentFile := desc.ParentFile()
+	if parentFile == nil {
+		return protocol.LocationLink{}, fmt.Errorf("no parent file found for descriptor")
+	}
+	linkRes, err := snapshot.FindResultOrPartialResultByPath(parentFile.Path())
+	if err != nil {
+		return protocol.LocationLink{}, err
+	}
+	decl, err := findDeclaration(desc, linkRes)
+	if err != nil {
+		return protocol.LocationLink{}, err
+	}
+	name, err := findDefinition(desc, linkRes)
+	if err != nil {
+		return protocol.LocationLink{}, err
+	}
+	uri, err := c.resolver.PathToURI(name.NodeInfo.Start().Filename)
+	if err != nil {
+		return protocol.LocationLink{}, err
+	}
+	link := protocol.LocationLink{
+		OriginSelectionRange: &origin,
+		TargetURI:            uri,
+		TargetRange:          toRange(linkRes.AST().NodeInfo(decl)),
+		TargetSelectionRange: toRange(name.NodeInfo),
+	}
+	if _, ok := desc.(protoreflect.FileDescriptor); ok {
+		link.TargetSelectionRange.End = link.TargetSelectionRange.Start
+	}
+	return link, nil
+}
+
+// alternateImportLinks returns links to the files which could also provide
+// the import path, but are not used because of the importPrecedence setting.
+func (c *Cache) alternateImportLinks(path string, origin protocol.Range) []protocol.LocationLink {
+	conflict, ok := c.resolver.ImportConflict(path)
+	if !ok {
+		return nil
+	}
+	var uri protocol.DocumentURI
+	switch conflict.Chosen {
+	case importSourceWorkspace:
+		rel, ok := strings.CutPrefix(path, conflict.GoModule.Path+"/")
+		if !ok || conflict.GoModule.Dir == "" {
+			return nil
+		}
+		filename := filepath.Join(conflict.GoModule.Dir, filepath.FromSlash(rel))
+		if _, err := os.Stat(filename); err != nil {
+			return nil
+		}
+		uri = protocol.URIFromPath(filename)
+	case importSourceGoModule:
+		uri = conflict.WorkspaceURI
+	default:
+		return nil
+	}
+	return []protocol.LocationLink{
+		{
+			OriginSelectionRange: &origin,
+			TargetURI:            uri,
+		},
+	}
+}
+
+// linksToLocations returns the target selection ranges of the links.
+func linksToLocations(links []protocol.LocationLink) []protocol.Location {
+	if links == nil {
+		return nil
+	}
+	locations := make([]protocol.Location, len(links))
+	for i, link := range links {
+		locations[i] = protocol.Location{
+			URI:   link.TargetURI,
+			Range: link.TargetSelectionRange,
+		}
+	}
+	return locations
+}
+
+// isCustomOption reports whether the field is an extension of one of the
+// options messages in descriptor.proto.
+func isCustomOption(fd protoreflect.FieldDescriptor) bool {
+	return fd.IsExtension() && fd.ContainingMessage().ParentFile().Path() == "google/protobuf/descriptor.proto"
+}
+
+// customOptionLinks returns links to the declaration of a custom option, the
+// options message it extends, and each option declared on the extension.
+func (c *Cache) customOptionLinks(snapshot *Snapshot, fd protoreflect.FieldDescriptor, origin protocol.Range) []protocol.LocationLink {
+	if xt, ok := fd.(protoreflect.ExtensionTypeDescriptor); ok {
+		fd = xt.Descriptor()
+	}
+	extLink, err := c.FindDeclarationLink(snapshot, fd, origin)
+	if err != nil {
+		return nil
+	}
+	links := []protocol.LocationLink{extLink}
+	if link, err := c.FindDeclarationLink(snapshot, fd.ContainingMessage(), origin); err == nil {
+		links = append(links, link)
+	}
+
+	extRes, err := snapshot.FindResultOrPartialResultByPath(fd.ParentFile().Path())
+	if err != nil {
+		return links
+	}
+	fdp, ok := descriptorProto(extRes, fd).(*descriptorpb.FieldDescriptorProto)
+	if !ok {
+		return links
+	}
+	for _, opt := range extRes.FieldNode(fdp).GetOptions().GetOptions() {
+		if opt.GetName() != nil {
+			links = append(links, protocol.LocationLink{
+				OriginSelectionRange: &origin,
+				TargetURI:            extLink.TargetURI,
+				TargetRange:          toRange(extRes.AST().NodeInfo(opt)),
+				TargetSelectionRange: toRange(extRes.AST().NodeInfo(opt.GetName())),
+			})
+		}
+	}
+	return links
+}
+
+// descriptorProto returns the descriptor proto backing a descriptor in the
+// given result. Builtin descriptors, such as those in descriptor.proto, are
+// looked up by name.
+func descriptorProto(linkRes linker.Result, desc protoreflect.Descriptor) any {
+	if w, ok := desc.(protoutil.DescriptorProtoWrapper); ok {
+		return w.AsProto()
+	}
+	if w, ok := linkRes.FindDescriptorByName(desc.FullName()).(protoutil.DescriptorProtoWrapper); ok {
+		return w.AsProto()
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestCustomOptionDefinitionLinks(t *testing.T) {
+	const source = `syntax = "proto2";
+package ui;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.FieldOptions {
+  optional int32 width = 50000 [default = 100, deprecated = true];
+}
+message Button {
+  optional string text = 1 [(width) = 10];
+}
+`
+	c, workspace := newTestCache(t, map[string]string{"ui.proto": source}, nil)
+	uri := protocol.URIFromPath(filepath.Join(workspace, "ui.proto"))
+
+	params := protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     protocol.Position{Line: 7, Character: 30},
+	}
+	links, err := c.FindDefinitionLinks(context.Background(), c.Snapshot(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 4 {
+		t.Fatalf("expected 4 links, got %d: %+v", len(links), links)
+	}
+	origin := protocol.Range{Start: protocol.Position{Line: 7, Character: 28}, End: protocol.Position{Line: 7, Character: 35}}
+	for _, link := range links {
+		if link.OriginSelectionRange == nil || *link.OriginSelectionRange != origin {
+			t.Errorf("unexpected origin %v", link.OriginSelectionRange)
+		}
+	}
+
+	// the extension declaration
+	if links[0].TargetURI != uri ||
+		links[0].TargetRange != (protocol.Range{Start: protocol.Position{Line: 4, Character: 2}, End: protocol.Position{Line: 4, Character: 66}}) ||
+		links[0].TargetSelectionRange != (protocol.Range{Start: protocol.Position{Line: 4, Character: 17}, End: protocol.Position{Line: 4, Character: 22}}) {
+		t.Errorf("unexpected extension link %+v", links[0])
+	}
+	// the extended options message
+	if !strings.HasSuffix(string(links[1].TargetURI), "google/protobuf/descriptor.proto") || links[1].TargetRange == links[1].TargetSelectionRange {
+		t.Errorf("unexpected extendee link %+v", links[1])
+	}
+	// the options declared on the extension
+	if links[2].TargetSelectionRange != (protocol.Range{Start: protocol.Position{Line: 4, Character: 32}, End: protocol.Position{Line: 4, Character: 39}}) ||
+		links[3].TargetSelectionRange != (protocol.Range{Start: protocol.Position{Line: 4, Character: 47}, End: protocol.Position{Line: 4, Character: 57}}) {
+		t.Errorf("unexpected option links %+v %+v", links[2], links[3])
+	}
+
+	locations, err := c.FindDefinitions(context.Background(), c.Snapshot(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != len(links) || locations[0].Range != links[0].TargetSelectionRange {
+		t.Errorf("expected definitions to match the link targets, got %+v", locations)
+	}
+}
+
+func TestDefinitionLinks(t *testing.T) {
+	const source = `syntax = "proto3";
+package ui.v1;
+message Size {
+  int32 width = 1;
+}
+message Button {
+  Size size = 1;
+}
+`
+	c, workspace := newTestCache(t, map[string]string{"ui.proto": source}, nil)
+	uri := protocol.URIFromPath(filepath.Join(workspace, "ui.proto"))
+
+	at := func(line, char uint32) protocol.TextDocumentPositionParams {
+		return protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: line, Character: char},
+		}
+	}
+	sizeDecl := protocol.Range{Start: protocol.Position{Line: 2, Character: 0}, End: protocol.Position{Line: 4, Character: 1}}
+	sizeName := protocol.Range{Start: protocol.Position{Line: 2, Character: 8}, End: protocol.Position{Line: 2, Character: 12}}
+	fieldType := protocol.Range{Start: protocol.Position{Line: 6, Character: 2}, End: protocol.Position{Line: 6, Character: 6}}
+
+	links, err := c.FindDefinitionLinks(context.Background(), c.Snapshot(), at(6, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || *links[0].OriginSelectionRange != fieldType ||
+		links[0].TargetRange != sizeDecl || links[0].TargetSelectionRange != sizeName {
+		t.Errorf("unexpected definition links %+v", links)
+	}
+
+	// the type definition of a field is its message, from the field's name
+	links, err = c.FindTypeDefinitionLinks(context.Background(), c.Snapshot(), at(6, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fieldName := protocol.Range{Start: protocol.Position{Line: 6, Character: 7}, End: protocol.Position{Line: 6, Character: 11}}
+	if len(links) != 1 || *links[0].OriginSelectionRange != fieldName ||
+		links[0].TargetRange != sizeDecl || links[0].TargetSelectionRange != sizeName {
+		t.Errorf("unexpected type definition links %+v", links)
+	}
+
+	// package name prefixes link from the prefix only
+	links, err = c.FindDefinitionLinks(context.Background(), c.Snapshot(), at(1, 9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := protocol.Range{Start: protocol.Position{Line: 1, Character: 8}, End: protocol.Position{Line: 1, Character: 10}}
+	if len(links) == 0 || *links[0].OriginSelectionRange != prefix {
+		t.Errorf("unexpected package links %+v", links)
+	}
+}
@@ -1,11 +1,13 @@
 package lsp
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"slices"
 	"strings"
 	"sync"
@@ -16,6 +18,7 @@ import (
 	"github.com/kralicky/protocompile/linker"
 	"github.com/kralicky/protocompile/parser"
 	"github.com/kralicky/protocompile/reporter"
+	"github.com/kralicky/protols/pkg/protocolext"
 	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
 )
 
@@ -91,6 +94,8 @@ func (c *Cache) toProtocolDiagnostics(rawReports []*ProtoDiagnostic) []protocol.
 		}
 		if rawReport.WerrorCategory != "" {
 			report.Code = rawReport.WerrorCategory
+		} else if rawReport.Code != "" {
+			report.Code = rawReport.Code
 		}
 		data := DiagnosticData{
 			Metadata:    rawReport.Metadata,
@@ -104,6 +109,15 @@ func (c *Cache) toProtocolDiagnostics(rawReports []*ProtoDiagnostic) []protocol.
 		report.Data = &rawMsg
 		reports = append(reports, report)
 	}
+	// diagnostics are reported in the order they are found, which depends on
+	// the order files and lint rules finish
+	slices.SortStableFunc(reports, func(a, b protocol.Diagnostic) int {
+		return cmp.Or(
+			protocol.CompareRange(a.Range, b.Range),
+			cmp.Compare(a.Severity, b.Severity),
+			strings.Compare(a.Message, b.Message),
+		)
+	})
 	return reports
 }
 
@@ -138,6 +152,9 @@ type ProtoDiagnostic struct {
 	CodeActions        []CodeAction
 	Metadata           map[string]string
 
+	// Code is an optional diagnostic code, such as the name of a lint rule.
+	Code string
+
 	// If this is a warning being treated as an error, WerrorCategory will be set to
 	// a category that can be named in a debug pragma to disable it.
 	WerrorCategory string
@@ -152,6 +169,11 @@ const (
 	diagnosticKind               = "kind"
 	diagnosticKindUndeclaredName = "undeclaredName"
 	diagnosticKindUnusedImport   = "unusedImport"
+	diagnosticKindLint           = "lint"
+
+	// Metadata of lint diagnostics which can be fixed by renaming the
+	// declaration at the start of the diagnostic's range.
+	diagnosticRenameTo = "renameTo"
 )
 
 type DiagnosticData struct {
@@ -358,12 +380,16 @@ func codeActionsForError(errWithPos reporter.ErrorWithPos) []CodeAction {
 						NewText: textToInsert,
 					},
 				},
-				Command: NewSelectRangeCommand(SelectRangeParams{
+				Command: NewSelectRangeCommand(protocolext.SelectRangeParams{
 					SelectRange: selectRange,
 					RevealRange: revealRange,
 				}),
 			},
 		}
+	default:
+		if _, ok := asUnsupportedEditionError(err); ok {
+			return editionCodeActions(pos.Start().Filename, toRange(pos))
+		}
 	}
 	return []CodeAction{}
 }
@@ -445,6 +471,9 @@ func (dr *DiagnosticHandler) HandleError(err reporter.ErrorWithPos) error {
 		CodeActions:        codeActionsForError(err),
 		Metadata:           metadataForError(err),
 	}
+	if editionErr, ok := asUnsupportedEditionError(err.Unwrap()); ok {
+		newDiagnostic.Error = editionErr
+	}
 
 	dl.Add(newDiagnostic)
 
@@ -496,6 +525,16 @@ func (dr *DiagnosticHandler) HandleWarning(err reporter.ErrorWithPos) {
 	// dr.listenerMu.RUnlock()
 }
 
+// AddDiagnostic adds a diagnostic that did not originate from the compiler,
+// such as one reported by a lint rule.
+func (dr *DiagnosticHandler) AddDiagnostic(d *ProtoDiagnostic) {
+	dr.diagnosticsMu.Lock()
+	dl, _ := dr.getOrCreateDiagnosticListLocked(d.Path)
+	dr.diagnosticsMu.Unlock()
+
+	dl.Add(d)
+}
+
 func (dr *DiagnosticHandler) GetDiagnosticsForPath(path string, prevResultId ...string) ([]*ProtoDiagnostic, string, bool) {
 	dr.diagnosticsMu.RLock()
 	defer dr.diagnosticsMu.RUnlock()
@@ -526,6 +565,7 @@ func (dr *DiagnosticHandler) FullDiagnosticSnapshot() map[string][]*ProtoDiagnos
 				RelatedInformation: d.RelatedInformation,
 				CodeActions:        d.CodeActions,
 				Metadata:           d.Metadata,
+				Code:               d.Code,
 				WerrorCategory:     d.WerrorCategory,
 			})
 		}
@@ -594,7 +634,8 @@ func (dr *DiagnosticHandler) Flush() {
 	dr.diagnosticsMu.Lock()
 	defer dr.diagnosticsMu.Unlock()
 
-	for path, dl := range dr.diagnostics {
+	for _, path := range slices.Sorted(maps.Keys(dr.diagnostics)) {
+		dl := dr.diagnostics[path]
 		diagnostics, resultId, wasDirty := dl.Flush()
 		if wasDirty {
 			slog.Debug(fmt.Sprintf("[diagnostic] flushing %d diagnostics for %s\n", len(diagnostics), path))
@@ -606,3 +647,27 @@ func (dr *DiagnosticHandler) Flush() {
 		}
 	}
 }
+
+// FlushPath is like Flush, but only sends the diagnostics of a single file.
+// It is called as each file finishes compiling, so that diagnostics can be
+// published while the rest of a large batch is still being compiled.
+func (dr *DiagnosticHandler) FlushPath(path string) {
+	dr.listenerMu.RLock()
+	defer dr.listenerMu.RUnlock()
+	if dr.listener == nil {
+		return
+	}
+
+	dr.diagnosticsMu.RLock()
+	dl, ok := dr.diagnostics[path]
+	dr.diagnosticsMu.RUnlock()
+	if !ok {
+		return
+	}
+	// The listener is called without holding diagnosticsMu, so that other
+	// files being compiled concurrently can continue to report diagnostics.
+	if diagnostics, resultId, wasDirty := dl.Flush(); wasDirty {
+		slog.Debug(fmt.Sprintf("[diagnostic] flushing %d diagnostics for %s\n", len(diagnostics), path))
+		dr.listener(path, resultId, diagnostics)
+	}
+}
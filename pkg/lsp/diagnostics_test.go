@@ -0,0 +1,73 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiagnosticHandlerFlushPath(t *testing.T) {
+	dr := NewDiagnosticHandler()
+	flushed := make(chan string, 10)
+	ctx, ca := context.WithCancel(context.Background())
+	defer ca()
+	go dr.Stream(ctx, func(path string, _ string, _ []*ProtoDiagnostic) {
+		flushed <- path
+	})
+	for {
+		dr.listenerMu.RLock()
+		ready := dr.listener != nil
+		dr.listenerMu.RUnlock()
+		if ready {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	dr.AddDiagnostic(&ProtoDiagnostic{Path: "a.proto", Error: errors.New("a")})
+	dr.AddDiagnostic(&ProtoDiagnostic{Path: "b.proto", Error: errors.New("b")})
+
+	dr.FlushPath("a.proto")
+	dr.FlushPath("a.proto")
+	dr.FlushPath("c.proto")
+	dr.Flush()
+	close(flushed)
+
+	var paths []string
+	for path := range flushed {
+		paths = append(paths, path)
+	}
+	if len(paths) != 2 || paths[0] != "a.proto" || paths[1] != "b.proto" {
+		t.Errorf("got flushed paths %v, want [a.proto b.proto]", paths)
+	}
+}
+
+func TestDiagnosticHandlerFlushOrder(t *testing.T) {
+	dr := NewDiagnosticHandler()
+	var flushed []string
+	ctx, ca := context.WithCancel(context.Background())
+	defer ca()
+	go dr.Stream(ctx, func(path string, _ string, _ []*ProtoDiagnostic) {
+		flushed = append(flushed, path)
+	})
+	for {
+		dr.listenerMu.RLock()
+		ready := dr.listener != nil
+		dr.listenerMu.RUnlock()
+		if ready {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, path := range []string{"c.proto", "a.proto", "d.proto", "b.proto"} {
+		dr.AddDiagnostic(&ProtoDiagnostic{Path: path, Error: errors.New(path)})
+	}
+	dr.Flush()
+
+	if !slices.Equal(flushed, []string{"a.proto", "b.proto", "c.proto", "d.proto"}) {
+		t.Errorf("got flushed paths %v, want them in order", flushed)
+	}
+}
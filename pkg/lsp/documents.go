@@ -30,23 +30,36 @@ func (s *Cache) ChangedText(ctx context.Context, uri protocol.VersionedTextDocum
 	if err != nil {
 		return nil, err
 	}
-	diffs, err := contentChangeEventsToDiffEdits(m, changes)
-	if err != nil {
-		return nil, err
-	}
-	return diff.ApplyBytes(m.Content, diffs)
+	return applyContentChanges(m, changes)
 }
 
-func contentChangeEventsToDiffEdits(mapper *protocol.Mapper, changes []protocol.TextDocumentContentChangeEvent) ([]diff.Edit, error) {
-	var edits []protocol.TextEdit
-	for _, change := range changes {
-		edits = append(edits, protocol.TextEdit{
-			Range:   *change.Range,
-			NewText: change.Text,
-		})
+// applyContentChanges applies a batch of content changes to the mapper's
+// content. Each change is relative to the document as modified by the
+// changes before it, and any of them may replace the entire document.
+// Positions are interpreted as UTF-16 offsets.
+func applyContentChanges(m *protocol.Mapper, changes []protocol.TextDocumentContentChangeEvent) ([]byte, error) {
+	content := m.Content
+	for i, change := range changes {
+		if change.Range == nil {
+			content = []byte(change.Text)
+		} else {
+			if i > 0 {
+				m = protocol.NewMapper(m.URI, content)
+			}
+			diffs, err := protocol.EditsToDiffEdits(m, []protocol.TextEdit{{
+				Range:   *change.Range,
+				NewText: change.Text,
+			}})
+			if err != nil {
+				return nil, err
+			}
+			content, err = diff.ApplyBytes(content, diffs)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
-
-	return protocol.EditsToDiffEdits(mapper, edits)
+	return content, nil
 }
 
 func (c *Cache) DidModifyFiles(ctx context.Context, modifications []file.Modification) {
@@ -54,6 +67,10 @@ func (c *Cache) DidModifyFiles(ctx context.Context, modifications []file.Modific
 	var toRecompile []string
 	for _, m := range modifications {
 		if m.Action == file.Delete {
+			if len(c.pending.take([]protocol.DocumentURI{m.URI})) > 0 {
+				// never compiled, nothing to invalidate
+				continue
+			}
 			path, err := c.resolver.URIToPath(m.URI)
 			if err == nil {
 				toRecompile = append(toRecompile, path)
@@ -62,6 +79,17 @@ func (c *Cache) DidModifyFiles(ctx context.Context, modifications []file.Modific
 	}
 	c.resolver.UpdateURIPathMappings(modifications)
 
+	// in lazy mode, files created on disk are only indexed unless they are open
+	// or match the eager paths
+	var deferred []protocol.DocumentURI
+	var open map[protocol.DocumentURI]bool
+	if c.isLazy() {
+		open = map[protocol.DocumentURI]bool{}
+		for _, o := range c.resolver.Overlays() {
+			open[o.URI()] = true
+		}
+	}
+
 	toDelete := []int{}
 	for i, m := range modifications {
 		if m.Action == file.Open && m.LanguageID != "protobuf" {
@@ -71,21 +99,31 @@ func (c *Cache) DidModifyFiles(ctx context.Context, modifications []file.Modific
 		if err != nil {
 			slog.With(
 				"error", err,
-				"uri", m.URI.Path(),
+				"uri", m.URI,
 			).Error("failed to resolve uri to path")
 			toDelete = append(toDelete, i)
 			continue
 		}
 		switch m.Action {
 		case file.Close:
+			c.tokenIndexes.Delete(m.URI)
+			c.clearPathMemo(path)
 		case file.Open, file.Save:
 			fh, err := c.compiler.fs.ReadFile(ctx, m.URI)
 			if err == nil || fh.Version() != m.Version {
 				toRecompile = append(toRecompile, path)
 			}
-		case file.Change, file.Create, file.Delete:
+		case file.Create:
+			if open != nil && !open[m.URI] && !c.matchWorkspacePatterns(c.settings.Load().EagerPaths, m.URI) {
+				deferred = append(deferred, m.URI)
+				continue
+			}
+			toRecompile = append(toRecompile, path)
+		case file.Change, file.Delete:
+			c.clearPathMemo(path)
 			toRecompile = append(toRecompile, path)
 		}
+		c.pending.remove(m.URI)
 	}
 	for _, idx := range toDelete {
 		modifications = slices.Delete(modifications, idx, idx+1)
@@ -93,8 +131,11 @@ func (c *Cache) DidModifyFiles(ctx context.Context, modifications []file.Modific
 	if err := c.compiler.fs.UpdateOverlays(ctx, modifications); err != nil {
 		panic(fmt.Errorf("internal protocol error: %w", err))
 	}
+	if len(deferred) > 0 {
+		c.indexPending(ctx, deferred)
+	}
 	if len(toRecompile) > 0 {
-		c.Compile(toRecompile,
+		c.Compile(ctx, toRecompile,
 			func() {
 				c.documentVersions.Update(modifications...)
 			},
@@ -139,7 +180,7 @@ func (c *Cache) WaitDocumentVersion(ctx context.Context, uri protocol.DocumentUR
 }
 
 func (r *Cache) GetMapper(uri protocol.DocumentURI) (*protocol.Mapper, error) {
-	if !uri.IsFile() {
+	if !uri.IsFile() && !r.resolver.HasSchemeHandler(uri) {
 		data, err := r.resolver.SyntheticFileContents(uri)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,72 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestApplyContentChanges(t *testing.T) {
+	rng := func(startLine, startChar, endLine, endChar uint32) *protocol.Range {
+		return &protocol.Range{
+			Start: protocol.Position{Line: startLine, Character: startChar},
+			End:   protocol.Position{Line: endLine, Character: endChar},
+		}
+	}
+	tests := []struct {
+		name    string
+		content string
+		changes []protocol.TextDocumentContentChangeEvent
+		want    string
+	}{
+		{
+			name:    "single edit",
+			content: "message Foo {}\n",
+			changes: []protocol.TextDocumentContentChangeEvent{
+				{Range: rng(0, 8, 0, 11), Text: "Bar"},
+			},
+			want: "message Bar {}\n",
+		},
+		{
+			name:    "sequential edits",
+			content: "message Foo {}\n",
+			changes: []protocol.TextDocumentContentChangeEvent{
+				// the second edit refers to positions after the first is applied
+				{Range: rng(0, 0, 0, 0), Text: "// x\n"},
+				{Range: rng(1, 8, 1, 11), Text: "Bar"},
+			},
+			want: "// x\nmessage Bar {}\n",
+		},
+		{
+			name:    "utf-16 offsets",
+			content: "// 😀 a\nmessage Foo {}\n",
+			changes: []protocol.TextDocumentContentChangeEvent{
+				// the emoji is two utf-16 code units
+				{Range: rng(0, 6, 0, 7), Text: "b"},
+			},
+			want: "// 😀 b\nmessage Foo {}\n",
+		},
+		{
+			name:    "full replacement in batch",
+			content: "message Foo {}\n",
+			changes: []protocol.TextDocumentContentChangeEvent{
+				{Range: rng(0, 8, 0, 11), Text: "Bar"},
+				{Text: "enum Foo {}\n"},
+				{Range: rng(0, 0, 0, 4), Text: "message"},
+			},
+			want: "message Foo {}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := protocol.NewMapper("file:///foo.proto", []byte(tt.content))
+			got, err := applyContentChanges(m, tt.changes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("applyContentChanges() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type (
+	DuplicateMessage      = protocolext.DuplicateMessage
+	DuplicateMessageGroup = protocolext.DuplicateMessageGroup
+)
+
+// FindDuplicateMessages returns groups of structurally identical messages
+// declared in the workspace. Messages without fields, and messages which
+// declare nested messages or enums, are not considered.
+func (c *Cache) FindDuplicateMessages(ctx context.Context, snapshot *Snapshot) ([]DuplicateMessageGroup, error) {
+	var groups []DuplicateMessageGroup
+	for _, msgs := range c.duplicateMessages(snapshot) {
+		var group DuplicateMessageGroup
+		for _, md := range msgs {
+			loc, err := c.FindDefinitionForTypeDescriptor(snapshot, md)
+			if err != nil {
+				return nil, err
+			}
+			group.Messages = append(group.Messages, DuplicateMessage{
+				Name:     string(md.FullName()),
+				Location: loc,
+			})
+		}
+		groups = append(groups, group)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(groups, func(a, b DuplicateMessageGroup) int {
+		return strings.Compare(a.Messages[0].Name, b.Messages[0].Name)
+	})
+	return groups, nil
+}
+
+// duplicateMessages returns the workspace-local messages grouped by their
+// structure. Only groups with more than one message are returned, and
+// messages within a group are sorted by name. Groups are sorted by the name
+// of their first message.
+func (c *Cache) duplicateMessages(snapshot *Snapshot) [][]protoreflect.MessageDescriptor {
+	byFingerprint := map[string][]protoreflect.MessageDescriptor{}
+	for _, res := range snapshot.Results() {
+		if res.IsPlaceholder() {
+			continue
+		}
+		uri, err := c.resolver.PathToURI(res.Path())
+		if err != nil || !c.resolver.IsRealWorkspaceLocalFile(uri) {
+			continue
+		}
+		rangeMessages(res.Messages(), func(md protoreflect.MessageDescriptor) {
+			if fp, ok := messageFingerprint(md); ok {
+				byFingerprint[fp] = append(byFingerprint[fp], md)
+			}
+		})
+	}
+	var groups [][]protoreflect.MessageDescriptor
+	for _, msgs := range byFingerprint {
+		if len(msgs) < 2 {
+			continue
+		}
+		slices.SortFunc(msgs, func(a, b protoreflect.MessageDescriptor) int {
+			return strings.Compare(string(a.FullName()), string(b.FullName()))
+		})
+		groups = append(groups, msgs)
+	}
+	slices.SortFunc(groups, func(a, b []protoreflect.MessageDescriptor) int {
+		return strings.Compare(string(a[0].FullName()), string(b[0].FullName()))
+	})
+	return groups
+}
+
+// messageFingerprint returns a key which is equal for messages that are
+// identical except for their names.
+func messageFingerprint(md protoreflect.MessageDescriptor) (string, bool) {
+	if md.Fields().Len() == 0 || md.Enums().Len() > 0 {
+		return "", false
+	}
+	nested := md.Messages()
+	for i := range nested.Len() {
+		if !nested.Get(i).IsMapEntry() {
+			return "", false
+		}
+	}
+	dp := protodesc.ToDescriptorProto(md)
+	dp.Name = nil
+	// map entry types are nested in the message, and are named relative to it
+	prefix := "." + string(md.FullName()) + "."
+	for _, fld := range dp.GetField() {
+		if rest, ok := strings.CutPrefix(fld.GetTypeName(), prefix); ok {
+			fld.TypeName = proto.String(rest)
+		}
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(dp)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// mergeDuplicateMessageActions offers to replace the message at the cursor
+// with each of its duplicates. The message declaration is removed, and all
+// references to it are rewritten to refer to the chosen duplicate, adding
+// imports where necessary.
+func (c *Cache) mergeDuplicateMessageActions(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper) []protocol.CodeAction {
+	if request.Range.Start != request.Range.End {
+		return nil
+	}
+	msgNode, msgDesc, ok := c.messageNameAtPosition(ctx, linkRes, mapper, request.Range.Start)
+	if !ok {
+		return nil
+	}
+	var actions []protocol.CodeAction
+	for _, group := range c.duplicateMessages(c.Snapshot()) {
+		if !slices.ContainsFunc(group, func(md protoreflect.MessageDescriptor) bool { return md.FullName() == msgDesc.FullName() }) {
+			continue
+		}
+		for _, canonical := range group {
+			if canonical.FullName() == msgDesc.FullName() {
+				continue
+			}
+			if canonical.ParentFile().Path() != msgDesc.ParentFile().Path() && importsFile(canonical.ParentFile(), msgDesc.ParentFile().Path()) {
+				// importing the canonical file would create an import cycle
+				continue
+			}
+			title := fmt.Sprintf("Replace with duplicate %s (%s)", canonical.FullName(), canonical.ParentFile().Path())
+			actions = append(actions, actionQueue.enqueue(title, protocol.RefactorRewrite, mapper.URI, linkRes.AST().Version(), func(ca *protocol.CodeAction) error {
+				edit, err := c.mergeDuplicateMessage(ctx, linkRes, msgNode, msgDesc, canonical)
+				if err != nil {
+					return err
+				}
+				ca.Edit = edit
+				return nil
+			}))
+		}
+	}
+	return actions
+}
+
+func (c *Cache) mergeDuplicateMessage(ctx context.Context, linkRes linker.Result, msgNode *ast.MessageNode, dup, canonical protoreflect.MessageDescriptor) (*protocol.WorkspaceEdit, error) {
+	refs, err := c.FindReferencesForTypeDescriptor(ctx, dup)
+	if err != nil {
+		return nil, err
+	}
+	dupURI, err := c.resolver.PathToURI(linkRes.Path())
+	if err != nil {
+		return nil, err
+	}
+	removed := declLineRange(linkRes.AST(), msgNode)
+	if mapper, err := c.GetMapper(dupURI); err == nil {
+		// also remove the blank line separating the message from the next
+		// declaration, if there is one
+		lines := strings.Split(string(mapper.Content), "\n")
+		if next := int(removed.End.Line); next < len(lines)-1 && strings.TrimSpace(lines[next]) == "" {
+			removed.End.Line++
+		}
+	}
+
+	changes := map[protocol.DocumentURI][]protocol.TextEdit{
+		dupURI: {{Range: removed}},
+	}
+	needsImport := map[string]bool{}
+	for _, ref := range refs {
+		filename := ref.NodeInfo.Start().Filename
+		uri, err := c.resolver.PathToURI(filename)
+		if err != nil {
+			return nil, err
+		}
+		if !c.resolver.IsRealWorkspaceLocalFile(uri) {
+			return nil, fmt.Errorf("references to %s exist outside of the workspace", dup.FullName())
+		}
+		refRes, err := c.FindResultOrPartialResultByPath(filename)
+		if err != nil {
+			return nil, err
+		}
+		var editRange ast.SourceSpan
+		switch node := ast.Unwrap(ref.Node).(type) {
+		case *ast.IdentNode, *ast.CompoundIdentNode:
+			editRange = ref.NodeInfo
+		case *ast.RPCTypeNode:
+			editRange = refRes.AST().NodeInfo(node.MessageType)
+		default:
+			return nil, fmt.Errorf("cannot rewrite reference %T", node)
+		}
+		rng := toRange(editRange)
+		if uri == dupURI && rangeContains(removed, rng) {
+			continue
+		}
+		changes[uri] = append(changes[uri], protocol.TextEdit{
+			Range:   rng,
+			NewText: relativeTypeName(refRes.Package(), canonical.FullName()),
+		})
+		if filename != canonical.ParentFile().Path() {
+			if importsFile(canonical.ParentFile(), filename) {
+				return nil, fmt.Errorf("%s cannot import %s: import cycle", filename, canonical.ParentFile().Path())
+			}
+			needsImport[filename] = true
+		}
+	}
+	for filename := range needsImport {
+		parseRes, err := c.FindParseResultByPath(filename)
+		if err != nil {
+			return nil, err
+		}
+		if hasImport(parseRes.AST(), canonical.ParentFile().Path()) {
+			continue
+		}
+		uri, err := c.resolver.PathToURI(filename)
+		if err != nil {
+			return nil, err
+		}
+		changes[uri] = append(changes[uri], editAddImport(parseRes, canonical.ParentFile().Path()))
+	}
+	return &protocol.WorkspaceEdit{Changes: changes}, nil
+}
+
+// declLineRange returns the range of whole lines spanned by the node and its
+// leading comments.
+func declLineRange(fileNode *ast.FileNode, node ast.Node) protocol.Range {
+	info := fileNode.NodeInfo(node)
+	start := info.Start().Line
+	if comments := info.LeadingComments(); comments.Len() > 0 {
+		start = comments.Index(0).Start().Line
+	}
+	return protocol.Range{
+		Start: protocol.Position{Line: uint32(start - 1)},
+		End:   protocol.Position{Line: uint32(info.End().Line)},
+	}
+}
+
+// relativeTypeName returns the name by which a type can be referenced from a
+// file in the given package.
+func relativeTypeName(pkg protoreflect.FullName, name protoreflect.FullName) string {
+	if pkg != "" {
+		if rest, ok := strings.CutPrefix(string(name), string(pkg)+"."); ok {
+			return rest
+		}
+	}
+	return string(name)
+}
+
+// importsFile reports whether the file imports the file with the given path,
+// directly or transitively.
+func importsFile(fd protoreflect.FileDescriptor, filename string) bool {
+	seen := map[string]bool{}
+	var visit func(fd protoreflect.FileDescriptor) bool
+	visit = func(fd protoreflect.FileDescriptor) bool {
+		if fd.Path() == filename {
+			return true
+		}
+		if seen[fd.Path()] {
+			return false
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := range imports.Len() {
+			if visit(imports.Get(i).FileDescriptor) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(fd)
+}
+
+func hasImport(fileNode *ast.FileNode, filename string) bool {
+	for _, decl := range fileNode.Decls {
+		if imp := decl.GetImport(); imp != nil && imp.Name != nil && path.Clean(imp.Name.AsString()) == filename {
+			return true
+		}
+	}
+	return false
+}
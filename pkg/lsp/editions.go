@@ -0,0 +1,131 @@
+package lsp
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile/editions"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// supportedEditionNames returns the editions supported by the compiler,
+// oldest first.
+func supportedEditionNames() []string {
+	names := make([]string, 0, len(editions.SupportedEditions))
+	for name := range editions.SupportedEditions {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Compare(editions.SupportedEditions[a], editions.SupportedEditions[b])
+	})
+	return names
+}
+
+func newestSupportedEdition() string {
+	names := supportedEditionNames()
+	return names[len(names)-1]
+}
+
+// unsupportedEditionRegex matches the error reported by the parser for an
+// edition it does not recognize.
+var unsupportedEditionRegex = regexp.MustCompile(`^edition value "(.*)" not recognized`)
+
+// unsupportedEditionError replaces the parser's error for an unrecognized
+// edition, describing the range of editions the server supports.
+type unsupportedEditionError struct {
+	edition string
+}
+
+func (e unsupportedEditionError) Error() string {
+	names := supportedEditionNames()
+	if len(names) == 1 {
+		return fmt.Sprintf("edition %q is not supported; the only supported edition is %q", e.edition, names[0])
+	}
+	return fmt.Sprintf("edition %q is not supported; supported editions are %q through %q", e.edition, names[0], names[len(names)-1])
+}
+
+// asUnsupportedEditionError returns the edition named by a parser error for
+// an unrecognized edition.
+func asUnsupportedEditionError(err error) (unsupportedEditionError, bool) {
+	if m := unsupportedEditionRegex.FindStringSubmatch(err.Error()); m != nil {
+		return unsupportedEditionError{edition: m[1]}, true
+	}
+	return unsupportedEditionError{}, false
+}
+
+// incompleteSyntaxValueRegex matches a syntax or edition statement up to the
+// cursor, with the (possibly empty) value being typed.
+var (
+	incompleteSyntaxValueRegex = regexp.MustCompile(`^\s*(syntax|edition)\s*=\s*("?)([\w.-]*)$`)
+	syntaxValueSuffixRegex     = regexp.MustCompile(`^[\w.-]*"?\s*;?`)
+)
+
+// completeSyntaxOrEdition completes the value of a syntax or edition
+// statement. The whole value is replaced, including its quotes and the
+// terminating semicolon if present.
+func completeSyntaxOrEdition(textPrecedingCursor, textFollowingCursor string, pos protocol.Position) ([]protocol.CompletionItem, bool) {
+	m := incompleteSyntaxValueRegex.FindStringSubmatch(textPrecedingCursor)
+	if m == nil {
+		return nil, false
+	}
+	keyword, quote, partial := m[1], m[2], m[3]
+	suffix := syntaxValueSuffixRegex.FindString(textFollowingCursor)
+	replaceRange := protocol.Range{
+		Start: adjustColumn(pos, -len(quote)-len(partial)),
+		End:   adjustColumn(pos, len(suffix)),
+	}
+	var values []string
+	var detail string
+	switch keyword {
+	case "syntax":
+		values = []string{"proto3", "proto2"}
+	case "edition":
+		values = slices.Clone(supportedEditionNames())
+		slices.Reverse(values)
+		detail = "supported edition"
+	}
+	var items []protocol.CompletionItem
+	for i, value := range values {
+		if !strings.HasPrefix(value, partial) {
+			continue
+		}
+		items = append(items, protocol.CompletionItem{
+			Label:     fmt.Sprintf("%q", value),
+			Kind:      protocol.ValueCompletion,
+			Detail:    detail,
+			Preselect: i == 0,
+			// allow filtering by the value without the quote
+			FilterText: quote + value,
+			TextEdit: &protocol.Or_CompletionItem_textEdit{
+				Value: protocol.TextEdit{
+					Range:   replaceRange,
+					NewText: fmt.Sprintf("%q;", value),
+				},
+			},
+		})
+	}
+	return items, true
+}
+
+// editionCodeActions returns a quick fix which replaces an unsupported
+// edition with the newest supported one.
+func editionCodeActions(path string, rng protocol.Range) []CodeAction {
+	newest := newestSupportedEdition()
+	return []CodeAction{
+		{
+			Title:       fmt.Sprintf("Switch to edition %s", newest),
+			Kind:        protocol.QuickFix,
+			Path:        path,
+			IsPreferred: true,
+			Edits: []protocol.TextEdit{
+				{
+					Range:   rng,
+					NewText: fmt.Sprintf("%q", newest),
+				},
+			},
+		},
+	}
+}
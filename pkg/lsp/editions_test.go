@@ -0,0 +1,57 @@
+package lsp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestCompleteSyntaxOrEdition(t *testing.T) {
+	for _, tc := range []struct {
+		preceding, following string
+		col                  uint32
+		want                 []string
+		start, end           uint32
+	}{
+		{preceding: `syntax = `, col: 9, want: []string{`"proto3";`, `"proto2";`}, start: 9, end: 9},
+		{preceding: `syntax = "pro`, following: `to2";`, col: 13, want: []string{`"proto3";`, `"proto2";`}, start: 9, end: 18},
+		{preceding: `syntax = "proto2`, col: 16, want: []string{`"proto2";`}, start: 9, end: 16},
+		{preceding: `edition = "`, following: `"`, col: 11, want: []string{`"2023";`}, start: 10, end: 12},
+	} {
+		pos := protocol.Position{Line: 0, Character: tc.col}
+		items, ok := completeSyntaxOrEdition(tc.preceding, tc.following, pos)
+		if !ok {
+			t.Fatalf("%q: expected completions", tc.preceding)
+		}
+		if len(items) != len(tc.want) {
+			t.Fatalf("%q: got %d items, want %d", tc.preceding, len(items), len(tc.want))
+		}
+		for i, item := range items {
+			edit := item.TextEdit.Value.(protocol.TextEdit)
+			if edit.NewText != tc.want[i] {
+				t.Errorf("%q: got %q, want %q", tc.preceding, edit.NewText, tc.want[i])
+			}
+			if edit.Range.Start.Character != tc.start || edit.Range.End.Character != tc.end {
+				t.Errorf("%q: unexpected range %v", tc.preceding, edit.Range)
+			}
+		}
+	}
+
+	if _, ok := completeSyntaxOrEdition(`option foo = `, "", protocol.Position{Character: 13}); ok {
+		t.Error("expected no syntax completions in an option")
+	}
+}
+
+func TestUnsupportedEditionError(t *testing.T) {
+	editionErr, ok := asUnsupportedEditionError(errors.New(`edition value "2099" not recognized; should be one of ["2023"]`))
+	if !ok {
+		t.Fatal("expected an unsupported edition error")
+	}
+	if want := `edition "2099" is not supported; the only supported edition is "2023"`; editionErr.Error() != want {
+		t.Errorf("got %q, want %q", editionErr.Error(), want)
+	}
+	if _, ok := asUnsupportedEditionError(errors.New("syntax error: unexpected ';'")); ok {
+		t.Error("unexpected unsupported edition error")
+	}
+}
@@ -0,0 +1,139 @@
+package lsp
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+const defaultPreviewSnippets = 3
+
+type (
+	WorkspaceEditPreview = protocolext.WorkspaceEditPreview
+	FileEditPreview      = protocolext.FileEditPreview
+	EditSnippet          = protocolext.EditSnippet
+)
+
+// PreviewWorkspaceEdit summarizes a workspace edit without applying it. At
+// most maxSnippets lines are shown for each file; if maxSnippets is zero, a
+// default number of lines is shown.
+func (c *Cache) PreviewWorkspaceEdit(edit *protocol.WorkspaceEdit, maxSnippets int) *WorkspaceEditPreview {
+	if maxSnippets <= 0 {
+		maxSnippets = defaultPreviewSnippets
+	}
+	preview := &WorkspaceEditPreview{Edit: edit}
+	if edit == nil {
+		return preview
+	}
+	editsByURI := map[protocol.DocumentURI][]protocol.TextEdit{}
+	renames := map[protocol.DocumentURI]protocol.DocumentURI{}
+	for uri, edits := range edit.Changes {
+		editsByURI[uri] = append(editsByURI[uri], edits...)
+	}
+	for _, change := range edit.DocumentChanges {
+		switch {
+		case change.TextDocumentEdit != nil:
+			uri := change.TextDocumentEdit.TextDocument.URI
+			for _, e := range change.TextDocumentEdit.Edits {
+				switch e := e.Value.(type) {
+				case protocol.TextEdit:
+					editsByURI[uri] = append(editsByURI[uri], e)
+				case protocol.AnnotatedTextEdit:
+					editsByURI[uri] = append(editsByURI[uri], e.TextEdit)
+				}
+			}
+		case change.RenameFile != nil:
+			renames[change.RenameFile.OldURI] = change.RenameFile.NewURI
+			if _, ok := editsByURI[change.RenameFile.OldURI]; !ok {
+				editsByURI[change.RenameFile.OldURI] = nil
+			}
+		}
+	}
+
+	for uri, edits := range editsByURI {
+		file := FileEditPreview{
+			URI:       uri,
+			Edits:     len(edits),
+			RenamedTo: renames[uri],
+		}
+		if path, err := c.resolver.URIToPath(uri); err == nil {
+			file.Path = path
+		}
+		if len(edits) > 0 {
+			if mapper, err := c.GetMapper(uri); err == nil {
+				file.Snippets = editSnippets(mapper, edits, maxSnippets)
+			}
+		}
+		preview.TotalEdits += len(edits)
+		preview.Files = append(preview.Files, file)
+	}
+	slices.SortFunc(preview.Files, func(a, b FileEditPreview) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.URI, b.URI))
+	})
+	return preview
+}
+
+// PreviewNewFilesEdit is like PreviewWorkspaceEdit, but also lists the files
+// created by the edit, with their contents as a single snippet.
+func (c *Cache) PreviewNewFilesEdit(edit *NewFilesEdit, maxSnippets int) *WorkspaceEditPreview {
+	preview := c.PreviewWorkspaceEdit(edit.Edit, maxSnippets)
+	for _, f := range edit.Files {
+		preview.Files = append(preview.Files, FileEditPreview{
+			URI:      f.URI,
+			Created:  true,
+			Snippets: []EditSnippet{{After: f.Content}},
+		})
+	}
+	return preview
+}
+
+// editSnippets returns the first n lines changed by the edits, with all edits
+// on each line applied.
+func editSnippets(mapper *protocol.Mapper, edits []protocol.TextEdit, n int) []EditSnippet {
+	edits = slices.Clone(edits)
+	slices.SortFunc(edits, func(a, b protocol.TextEdit) int {
+		return protocol.ComparePosition(a.Range.Start, b.Range.Start)
+	})
+	var snippets []EditSnippet
+	for i := 0; i < len(edits) && len(snippets) < n; {
+		line := edits[i].Range.Start.Line
+		// edits which start on the same line, and the line the last of them ends on
+		j, endLine := i, line
+		for ; j < len(edits) && edits[j].Range.Start.Line <= endLine; j++ {
+			endLine = max(endLine, edits[j].Range.End.Line)
+		}
+		start, err := mapper.PositionOffset(protocol.Position{Line: line})
+		if err != nil {
+			break
+		}
+		end := len(mapper.Content)
+		if endOffset, err := mapper.PositionOffset(protocol.Position{Line: endLine}); err == nil {
+			if nl := bytes.IndexByte(mapper.Content[endOffset:], '\n'); nl >= 0 {
+				end = endOffset + nl
+			}
+		}
+		var after bytes.Buffer
+		prev := start
+		for _, edit := range edits[i:j] {
+			editStart, err1 := mapper.PositionOffset(edit.Range.Start)
+			editEnd, err2 := mapper.PositionOffset(edit.Range.End)
+			if err1 != nil || err2 != nil || editStart < prev {
+				continue
+			}
+			after.Write(mapper.Content[prev:editStart])
+			after.WriteString(edit.NewText)
+			prev = editEnd
+		}
+		after.Write(mapper.Content[prev:end])
+		snippets = append(snippets, EditSnippet{
+			Line:   line,
+			Before: string(mapper.Content[start:end]),
+			After:  after.String(),
+		})
+		i = j
+	}
+	return snippets
+}
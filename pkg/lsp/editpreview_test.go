@@ -0,0 +1,56 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestPreviewRename(t *testing.T) {
+	c, workspace := newTestCache(t, map[string]string{
+		"a.proto": `syntax = "proto3";
+package ui;
+message Size {
+  int32 width = 1;
+}
+`,
+		"b.proto": `syntax = "proto3";
+package ui;
+import "a.proto";
+message Button {
+  Size size = 1;
+  Size min_size = 2; Size max_size = 3;
+  repeated Size sizes = 4;
+}
+`,
+	}, nil)
+	aURI := protocol.URIFromPath(filepath.Join(workspace, "a.proto"))
+
+	edit, err := c.Rename(context.Background(), &protocol.RenameParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: aURI},
+		Position:     protocol.Position{Line: 2, Character: 9},
+		NewName:      "Dimensions",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview := c.PreviewWorkspaceEdit(edit, 2)
+	if preview.Edit != edit {
+		t.Error("expected the preview to include the edit")
+	}
+	if preview.TotalEdits != 5 || len(preview.Files) != 2 {
+		t.Fatalf("unexpected preview %+v", preview)
+	}
+	a, b := preview.Files[0], preview.Files[1]
+	if a.Path != "a.proto" || a.Edits != 1 || len(a.Snippets) != 1 ||
+		a.Snippets[0] != (EditSnippet{Line: 2, Before: "message Size {", After: "message Dimensions {"}) {
+		t.Errorf("unexpected preview for a.proto %+v", a)
+	}
+	// edits on the same line are combined, and snippets are limited
+	if b.Path != "b.proto" || b.Edits != 4 || len(b.Snippets) != 2 ||
+		b.Snippets[1] != (EditSnippet{Line: 5, Before: "  Size min_size = 2; Size max_size = 3;", After: "  Dimensions min_size = 2; Dimensions max_size = 3;"}) {
+		t.Errorf("unexpected preview for b.proto %+v", b)
+	}
+}
@@ -0,0 +1,148 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/parser"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// enumQuickFixes returns quick fixes for the compiler's enum value checks:
+// open enums without a zero value, duplicate values without allow_alias, and
+// allow_alias without duplicate values. A fix is offered for each diagnostic
+// located within an enum that has one of these problems.
+func enumQuickFixes(parseRes parser.Result, uri protocol.DocumentURI, diagnostics []protocol.Diagnostic) []protocol.CodeAction {
+	fileNode := parseRes.AST()
+	fdp := parseRes.FileDescriptorProto()
+	openEnums := fdp.GetSyntax() != "" && fdp.GetSyntax() != "proto2"
+
+	var actions []protocol.CodeAction
+	rangeEnumProtos(fdp, func(ed *descriptorpb.EnumDescriptorProto) {
+		enumNode, ok := parseRes.Node(ed).(*ast.EnumNode)
+		if !ok {
+			return
+		}
+		enumRange := toRange(fileNode.NodeInfo(enumNode))
+		for _, d := range diagnostics {
+			if !rangeContains(enumRange, d.Range) {
+				continue
+			}
+			action := func(title string, edit protocol.TextEdit) {
+				actions = append(actions, protocol.CodeAction{
+					Title:       title,
+					Kind:        protocol.QuickFix,
+					Diagnostics: []protocol.Diagnostic{d},
+					IsPreferred: true,
+					Edit: &protocol.WorkspaceEdit{
+						DocumentChanges: protocol.TextEditsToDocumentChanges(uri, fileNode.Version(), []protocol.TextEdit{edit}),
+					},
+				})
+			}
+
+			hasZero, hasAliases := false, false
+			seen := map[int32]bool{}
+			for _, v := range ed.GetValue() {
+				hasZero = hasZero || v.GetNumber() == 0
+				hasAliases = hasAliases || seen[v.GetNumber()]
+				seen[v.GetNumber()] = true
+			}
+			allowAlias := allowAliasOption(enumNode)
+			if openEnums && !hasZero {
+				name := strings.ToUpper(protoFieldName(ed.GetName())) + "_UNSPECIFIED"
+				action(fmt.Sprintf("Insert %s = 0", name), insertEnumDeclEdit(fileNode, enumNode, fmt.Sprintf("%s = 0;", name), true))
+			}
+			if hasAliases && allowAlias == nil {
+				action("Add allow_alias option", insertEnumDeclEdit(fileNode, enumNode, "option allow_alias = true;", false))
+			}
+			if !hasAliases && allowAlias != nil {
+				info := fileNode.NodeInfo(allowAlias)
+				action("Remove allow_alias option", protocol.TextEdit{
+					Range: protocol.Range{
+						Start: protocol.Position{Line: uint32(info.Start().Line - 1)},
+						End:   protocol.Position{Line: uint32(info.End().Line)},
+					},
+				})
+			}
+			// only one set of fixes per enum, regardless of how many
+			// diagnostics it contains
+			return
+		}
+	})
+	return actions
+}
+
+// insertEnumDeclEdit returns an edit which inserts a declaration on its own
+// line before the first value of the enum, or before its first declaration
+// if beforeValue is false.
+func insertEnumDeclEdit(fileNode *ast.FileNode, enumNode *ast.EnumNode, decl string, beforeValue bool) protocol.TextEdit {
+	var first ast.Node
+	for _, elem := range enumNode.Decls {
+		if beforeValue {
+			if v := elem.GetEnumValue(); v != nil {
+				first = v
+				break
+			}
+		} else if n := elem.Unwrap(); n != nil {
+			first = n
+			break
+		}
+	}
+	if first == nil {
+		pos := toPosition(fileNode.NodeInfo(enumNode.OpenBrace).End())
+		indent := strings.Repeat(" ", fileNode.NodeInfo(enumNode).Start().Col-1)
+		return protocol.TextEdit{
+			Range:   protocol.Range{Start: pos, End: pos},
+			NewText: "\n" + indent + "  " + decl,
+		}
+	}
+	start := fileNode.NodeInfo(first).Start()
+	pos := protocol.Position{Line: uint32(start.Line - 1)}
+	return protocol.TextEdit{
+		Range:   protocol.Range{Start: pos, End: pos},
+		NewText: strings.Repeat(" ", start.Col-1) + decl + "\n",
+	}
+}
+
+// allowAliasOption returns the enum's allow_alias option if it is set to
+// true.
+func allowAliasOption(enumNode *ast.EnumNode) *ast.OptionNode {
+	for _, elem := range enumNode.Decls {
+		opt := elem.GetOption()
+		if opt == nil || opt.IsIncomplete() || len(opt.Name.Parts) != 1 {
+			continue
+		}
+		fieldRef := opt.Name.Parts[0].GetFieldRef()
+		if fieldRef.GetName().AsIdentifier() != "allow_alias" || fieldRef.IsExtension() {
+			continue
+		}
+		if id, ok := opt.Val.Value().(ast.Identifier); ok && id == "true" {
+			return opt
+		}
+	}
+	return nil
+}
+
+// rangeEnumProtos calls fn for each enum declared in the file, including
+// nested enums.
+func rangeEnumProtos(fdp *descriptorpb.FileDescriptorProto, fn func(*descriptorpb.EnumDescriptorProto)) {
+	for _, ed := range fdp.GetEnumType() {
+		fn(ed)
+	}
+	var visit func(msgs []*descriptorpb.DescriptorProto)
+	visit = func(msgs []*descriptorpb.DescriptorProto) {
+		for _, md := range msgs {
+			for _, ed := range md.GetEnumType() {
+				fn(ed)
+			}
+			visit(md.GetNestedType())
+		}
+	}
+	visit(fdp.GetMessageType())
+}
+
+func rangeContains(outer, inner protocol.Range) bool {
+	return protocol.ComparePosition(outer.Start, inner.Start) <= 0 && protocol.ComparePosition(inner.End, outer.End) <= 0
+}
@@ -0,0 +1,128 @@
+package lsp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Malformed escape sequences are syntax errors reported by the parser, but
+// some well-formed escapes still produce values that are probably not what
+// was intended: unicode escapes of surrogate code points are silently
+// replaced with U+FFFD, and octal or hex escapes can produce invalid UTF-8,
+// which is only allowed in bytes fields.
+
+var unicodeEscapeRegex = regexp.MustCompile(`\\(u[0-9a-fA-F]{4}|U[0-9a-fA-F]{8})`)
+
+// lintStringEscapes reports escape sequences in string literals which encode
+// surrogate code points, and values assigned to string fields (in defaults
+// and option values) which are not valid UTF-8.
+func lintStringEscapes(_ context.Context, p *lintPass) {
+	ast.Inspect(p.result.AST(), func(node ast.Node) bool {
+		if lit, ok := node.(*ast.StringLiteralNode); ok {
+			for _, m := range unicodeEscapeRegex.FindAllSubmatch(lit.GetRaw(), -1) {
+				cp, err := strconv.ParseUint(string(m[1][1:]), 16, 32)
+				if err == nil && cp >= 0xD800 && cp <= 0xDFFF {
+					p.report(lit, "unicode escape \\%s is a surrogate code point, which cannot be encoded in UTF-8 and will be replaced with U+FFFD", m[1])
+				}
+			}
+		}
+		return true
+	})
+
+	// default pseudo-options are resolved to the field they are declared on
+	rangeOptionValues(p.result, p.cache.results.AsResolver(), func(fd protoreflect.FieldDescriptor, val *ast.ValueNode) {
+		if fd.Kind() != protoreflect.StringKind {
+			return
+		}
+		if s, ok := val.Value().(string); ok && !utf8.ValidString(s) {
+			p.report(val, "value of string field %s is not valid UTF-8; use a bytes field for binary data", fd.Name())
+		}
+	})
+}
+
+// rangeOptionValues calls fn for each value in the file's options, along with
+// the field it is assigned to. Values in message and list literals are
+// visited after the literal itself.
+func rangeOptionValues(res linker.Result, resolver descriptorFinder, fn func(protoreflect.FieldDescriptor, *ast.ValueNode)) {
+	fileNode := res.AST()
+	if fileNode == nil {
+		return
+	}
+	v := &literalValidator{resolver: resolver, fileNode: fileNode, scope: res.Package()}
+	var visit func(fd protoreflect.FieldDescriptor, val *ast.ValueNode)
+	visit = func(fd protoreflect.FieldDescriptor, val *ast.ValueNode) {
+		if list := val.GetArrayLiteral(); list != nil {
+			for _, elem := range list.FilterValues() {
+				visit(fd, elem)
+			}
+			return
+		}
+		fn(fd, val)
+		lit := val.GetMessageLiteral()
+		if lit == nil || fd.Message() == nil {
+			return
+		}
+		for _, elem := range lit.GetElements() {
+			name := elem.GetName()
+			if name == nil || name.IsIncomplete() || name.IsAnyTypeReference() || elem.GetVal() == nil {
+				continue
+			}
+			if field := v.findField(fd.Message(), name); field != nil {
+				visit(field, elem.GetVal())
+			}
+		}
+	}
+	ast.Inspect(fileNode, func(node ast.Node) bool {
+		optionNode, ok := node.(*ast.OptionNode)
+		if !ok {
+			return true
+		}
+		if optionNode.Val == nil {
+			return false
+		}
+		opt, ok := res.Descriptor(optionNode).(*descriptorpb.UninterpretedOption)
+		if !ok {
+			return false
+		}
+		if fd := res.FindOptionFieldDescriptor(opt); fd != nil {
+			visit(fd, optionNode.Val)
+		}
+		return false
+	})
+}
+
+// maxBytesPreview limits the number of bytes shown in the hex dump of a bytes
+// default value.
+const maxBytesPreview = 256
+
+// bytesDefaultPreview describes the decoded value of a bytes default: its
+// length, its base64 encoding, and a hex dump.
+func bytesDefaultPreview(b []byte) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d bytes", len(b))
+	if len(b) == 0 {
+		return sb.String() + "\n"
+	}
+	fmt.Fprintf(&sb, ", base64 `%s`\n", base64.StdEncoding.EncodeToString(b))
+	dump := b
+	if len(dump) > maxBytesPreview {
+		dump = dump[:maxBytesPreview]
+	}
+	fmt.Fprintf(&sb, "```\n%s", hex.Dump(dump))
+	if len(b) > maxBytesPreview {
+		fmt.Fprintf(&sb, "... %d more bytes\n", len(b)-maxBytesPreview)
+	}
+	sb.WriteString("```\n")
+	return sb.String()
+}
@@ -0,0 +1,22 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBytesDefaultPreview(t *testing.T) {
+	got := bytesDefaultPreview([]byte("\x00\x01hi"))
+	want := "4 bytes, base64 `AAFoaQ==`\n" +
+		"```\n00000000  00 01 68 69                                       |..hi|\n```\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := bytesDefaultPreview(nil); got != "0 bytes\n" {
+		t.Errorf("got %q for empty bytes", got)
+	}
+	long := bytesDefaultPreview(make([]byte, maxBytesPreview+10))
+	if !strings.HasSuffix(long, "... 10 more bytes\n```\n") {
+		t.Errorf("long preview is not truncated:\n%s", long)
+	}
+}
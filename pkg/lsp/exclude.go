@@ -0,0 +1,77 @@
+package lsp
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protols/pkg/sources"
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// isExcluded reports whether the file is matched by the exclude patterns in
+// the workspace settings. Excluded files are not discovered when scanning the
+// workspace or through file events, and are not searched for references, but
+// are still compiled if they are opened or imported.
+func (c *Cache) isExcluded(uri protocol.DocumentURI) bool {
+	return c.matchWorkspacePatterns(c.settings.Load().Exclude, uri)
+}
+
+// matchWorkspacePatterns reports whether the path of the file relative to the
+// workspace root is matched by any of the given glob patterns.
+func (c *Cache) matchWorkspacePatterns(patterns []string, uri protocol.DocumentURI) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	root := strings.TrimSuffix(uriPath(protocol.DocumentURI(c.workspace.URI)), "/") + "/"
+	rel, ok := strings.CutPrefix(uriPath(uri), root)
+	return ok && sources.Excludes(patterns).Match(rel)
+}
+
+// searchableResults returns the linked results which are not excluded.
+// Requires c.resultsMu to be held for reading.
+func (c *Cache) searchableResultsLocked() linker.Files {
+	return c.searchable(c.results)
+}
+
+// searchable returns the given results without those which are excluded.
+func (c *Cache) searchable(files linker.Files) linker.Files {
+	if len(c.settings.Load().Exclude) == 0 {
+		return files
+	}
+	return slices.DeleteFunc(slices.Clone(files), func(f linker.File) bool {
+		uri, err := c.resolver.PathToURI(f.Path())
+		return err == nil && c.isExcluded(uri)
+	})
+}
+
+// applyExcludes updates the set of workspace files after the exclude patterns
+// have changed. Files which are now excluded are removed unless they are open,
+// and files which are no longer excluded are loaded.
+func (c *Cache) applyExcludes(ctx context.Context) {
+	open := map[protocol.DocumentURI]bool{}
+	for _, o := range c.resolver.Overlays() {
+		open[o.URI()] = true
+	}
+	var mods []file.Modification
+	for _, uri := range c.XListWorkspaceLocalURIs() {
+		if !c.isExcluded(uri) || open[uri] {
+			continue
+		}
+		mods = append(mods, file.Modification{URI: uri, Action: file.Delete, OnDisk: true, Version: -1})
+	}
+	for _, uri := range c.listWorkspaceFiles() {
+		if _, err := c.resolver.URIToPath(uri); err == nil {
+			continue
+		}
+		mods = append(mods, file.Modification{URI: uri, Action: file.Create, OnDisk: true, Version: -1})
+	}
+	if len(mods) == 0 {
+		return
+	}
+	slog.Info("exclude patterns changed, updating workspace files", "changes", len(mods))
+	c.DidModifyFiles(ctx, mods)
+}
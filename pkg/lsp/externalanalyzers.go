@@ -0,0 +1,246 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protols/pkg/analysis"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// External analyzers are binaries configured in the lint.external setting,
+// which are run each time a workspace-local file is compiled. An analyzer
+// receives a JSON externalAnalyzerRequest on stdin, and writes a JSON
+// externalAnalyzerResponse to stdout before exiting:
+//
+//	{
+//	  "path": "foo/bar.proto",
+//	  "source": "syntax = \"proto3\";\n...",
+//	  "fileDescriptorSet": "<base64>"
+//	}
+//
+//	{
+//	  "diagnostics": [{
+//	    "range": {"start": {"line": 3, "character": 2}, "end": {"line": 3, "character": 7}},
+//	    "severity": 2,
+//	    "message": "...",
+//	    "fixes": [{"title": "...", "edits": [{"range": {...}, "newText": "..."}]}]
+//	  }]
+//	}
+//
+// The descriptor set is a serialized google.protobuf.FileDescriptorSet
+// containing the file and all of its transitive dependencies, in topological
+// order, with the file itself last. The file includes source code info.
+// Ranges are zero-based LSP ranges in the file, and severities are LSP
+// severities; the default severity is a warning. An analyzer which exits with
+// a non-zero status, or does not finish within externalAnalyzerTimeout, is
+// logged as having failed and reports nothing.
+//
+// Results are cached by the analyzer's request, so an analyzer is only run
+// again for a file when the file or one of its dependencies has changed.
+// External analyzers are never run in sandbox mode.
+
+// ExternalAnalyzerSettings configures an external analyzer.
+type ExternalAnalyzerSettings struct {
+	// The analyzer's name, used as the code of its diagnostics and in the
+	// lint.disabled setting.
+	Name string `mapstructure:"name"`
+	// The analyzer's executable and arguments. Relative paths are resolved
+	// against the workspace root.
+	Command []string `mapstructure:"command"`
+}
+
+const externalAnalyzerTimeout = 10 * time.Second
+
+type externalAnalyzerRequest struct {
+	Path              string `json:"path"`
+	Source            string `json:"source"`
+	FileDescriptorSet []byte `json:"fileDescriptorSet"`
+}
+
+type externalAnalyzerResponse struct {
+	Diagnostics []struct {
+		Range    protocol.Range              `json:"range"`
+		Severity protocol.DiagnosticSeverity `json:"severity"`
+		Message  string                      `json:"message"`
+		Fixes    []struct {
+			Title       string              `json:"title"`
+			IsPreferred bool                `json:"isPreferred"`
+			Edits       []protocol.TextEdit `json:"edits"`
+		} `json:"fixes"`
+	} `json:"diagnostics"`
+}
+
+// externalAnalyzerResults holds the last response of each external analyzer
+// for each file, keyed by analyzer name and path.
+type externalAnalyzerResults struct {
+	mu      sync.Mutex
+	entries map[string]externalAnalyzerEntry
+}
+
+type externalAnalyzerEntry struct {
+	requestHash [sha256.Size]byte
+	response    []byte
+}
+
+func newExternalAnalyzerResults() *externalAnalyzerResults {
+	return &externalAnalyzerResults{
+		entries: map[string]externalAnalyzerEntry{},
+	}
+}
+
+// externalAnalyzer adapts an external analyzer binary to analysis.Analyzer.
+type externalAnalyzer struct {
+	cache    *Cache
+	settings ExternalAnalyzerSettings
+}
+
+var _ analysis.Analyzer = (*externalAnalyzer)(nil)
+
+// Name implements analysis.Analyzer.
+func (a *externalAnalyzer) Name() string {
+	return a.settings.Name
+}
+
+// Run implements analysis.Analyzer.
+func (a *externalAnalyzer) Run(ctx context.Context, pass *analysis.Pass) error {
+	if len(a.settings.Command) == 0 {
+		return fmt.Errorf("no command configured")
+	}
+	uri, err := a.cache.resolver.PathToURI(pass.Result.Path())
+	if err != nil {
+		return err
+	}
+	mapper, err := a.cache.GetMapper(uri)
+	if err != nil {
+		return err
+	}
+	fds, err := proto.Marshal(fileDescriptorSet(pass.Result))
+	if err != nil {
+		return err
+	}
+	request, err := json.Marshal(externalAnalyzerRequest{
+		Path:              pass.Result.Path(),
+		Source:            string(mapper.Content),
+		FileDescriptorSet: fds,
+	})
+	if err != nil {
+		return err
+	}
+	output, err := a.run(ctx, pass.Result.Path(), request)
+	if err != nil {
+		return err
+	}
+	var response externalAnalyzerResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+
+	fileNode := pass.Result.AST()
+	toSpan := func(rng protocol.Range) (ast.SourceSpan, error) {
+		start, end, err := mapper.RangeOffsets(rng)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewSourceSpan(fileNode.SourcePos(start), fileNode.SourcePos(end)), nil
+	}
+	for _, d := range response.Diagnostics {
+		span, err := toSpan(d.Range)
+		if err != nil {
+			return fmt.Errorf("invalid diagnostic range: %w", err)
+		}
+		diagnostic := &analysis.Diagnostic{
+			Range:    span,
+			Severity: d.Severity,
+			Message:  d.Message,
+		}
+		if diagnostic.Severity == 0 {
+			diagnostic.Severity = protocol.SeverityWarning
+		}
+		for _, f := range d.Fixes {
+			fix := analysis.Fix{Title: f.Title, IsPreferred: f.IsPreferred}
+			for _, edit := range f.Edits {
+				span, err := toSpan(edit.Range)
+				if err != nil {
+					return fmt.Errorf("invalid edit range: %w", err)
+				}
+				fix.Edits = append(fix.Edits, analysis.Edit{Range: span, NewText: edit.NewText})
+			}
+			diagnostic.Fixes = append(diagnostic.Fixes, fix)
+		}
+		pass.Add(diagnostic)
+	}
+	return nil
+}
+
+// run returns the analyzer's output for the given request, running the
+// analyzer only if the last request for the same file was different.
+func (a *externalAnalyzer) run(ctx context.Context, path string, request []byte) ([]byte, error) {
+	results := a.cache.externalAnalyzerResults
+	key := a.settings.Name + "\x00" + path
+	hash := sha256.Sum256(append([]byte(strings.Join(a.settings.Command, "\x00")+"\x00"), request...))
+	results.mu.Lock()
+	entry, ok := results.entries[key]
+	results.mu.Unlock()
+	if ok && entry.requestHash == hash {
+		return entry.response, nil
+	}
+
+	ctx, ca := context.WithTimeout(ctx, externalAnalyzerTimeout)
+	defer ca()
+	cmd := exec.CommandContext(ctx, a.settings.Command[0], a.settings.Command[1:]...)
+	cmd.Dir = uriPath(protocol.DocumentURI(a.cache.workspace.URI))
+	cmd.Stdin = bytes.NewReader(request)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	results.mu.Lock()
+	results.entries[key] = externalAnalyzerEntry{requestHash: hash, response: stdout.Bytes()}
+	results.mu.Unlock()
+	return stdout.Bytes(), nil
+}
+
+// fileDescriptorSet returns a descriptor set containing the file and its
+// transitive dependencies, in topological order.
+func fileDescriptorSet(res linker.Result) *descriptorpb.FileDescriptorSet {
+	fds := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := range imports.Len() {
+			add(imports.Get(i).FileDescriptor)
+		}
+		if fd.Path() == res.Path() {
+			fds.File = append(fds.File, res.FileDescriptorProto())
+		} else {
+			fds.File = append(fds.File, protodesc.ToFileDescriptorProto(fd))
+		}
+	}
+	add(res)
+	return fds
+}
@@ -0,0 +1,95 @@
+package lsp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestExternalAnalyzer(t *testing.T) {
+	c, workspace := newTestCache(t, map[string]string{
+		"a.proto": `syntax = "proto3";
+package a;
+import "b.proto";
+message A {
+  b.B b = 1;
+}
+`,
+		"b.proto": `syntax = "proto3";
+package b;
+message B {}
+`,
+		"analyzer.sh": `#!/bin/sh
+cat > request.json
+count=$(cat count 2>/dev/null || echo 0)
+echo $((count + 1)) > count
+cat <<EOF
+{"diagnostics": [{
+  "range": {"start": {"line": 3, "character": 8}, "end": {"line": 3, "character": 9}},
+  "message": "message A is not allowed",
+  "fixes": [{"title": "Rename to Z", "edits": [{"range": {"start": {"line": 3, "character": 8}, "end": {"line": 3, "character": 9}}, "newText": "Z"}]}]
+}]}
+EOF
+`,
+	}, nil)
+	if err := os.Chmod(filepath.Join(workspace, "analyzer.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &externalAnalyzer{
+		cache:    c,
+		settings: ExternalAnalyzerSettings{Name: "no-a", Command: []string{"./analyzer.sh"}},
+	}
+	c.resultsMu.Lock()
+	res, err := c.findResultByPathLocked("a.proto")
+	if err != nil {
+		c.resultsMu.Unlock()
+		t.Fatal(err)
+	}
+	diagnostics := c.runAnalyzerLocked(a, res)
+	// the second run uses the cached response
+	c.runAnalyzerLocked(a, res)
+	c.resultsMu.Unlock()
+
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d", len(diagnostics))
+	}
+	d := diagnostics[0]
+	wantRange := protocol.Range{
+		Start: protocol.Position{Line: 3, Character: 8},
+		End:   protocol.Position{Line: 3, Character: 9},
+	}
+	if d.Error.Error() != "message A is not allowed" || d.Code != "no-a" || d.Severity != protocol.SeverityWarning || toRange(d.Range) != wantRange {
+		t.Errorf("unexpected diagnostic: %+v", d)
+	}
+	if len(d.CodeActions) != 1 || d.CodeActions[0].Edits[0].Range != wantRange || d.CodeActions[0].Edits[0].NewText != "Z" {
+		t.Errorf("unexpected code actions: %+v", d.CodeActions)
+	}
+
+	if count, _ := os.ReadFile(filepath.Join(workspace, "count")); string(count) != "1\n" {
+		t.Errorf("expected the analyzer to run once, got %q", count)
+	}
+	data, err := os.ReadFile(filepath.Join(workspace, "request.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request externalAnalyzerRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		t.Fatal(err)
+	}
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(request.FileDescriptorSet, &fds); err != nil {
+		t.Fatal(err)
+	}
+	if request.Path != "a.proto" || len(fds.File) != 2 || fds.File[0].GetName() != "b.proto" || fds.File[1].GetName() != "a.proto" {
+		t.Errorf("unexpected request: %s", data)
+	}
+	if fds.File[1].GetSourceCodeInfo() == nil {
+		t.Errorf("expected source code info for a.proto")
+	}
+}
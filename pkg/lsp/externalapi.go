@@ -25,6 +25,14 @@ func (c *Cache) XGetAllDiagnostics() (map[protocol.DocumentURI][]protocol.Diagno
 	return res, nil
 }
 
+// Intended for use with external tools only, not part of LSP implementation.
+func (c *Cache) XGetDiagnosticsForPath(path string) []protocol.Diagnostic {
+	c.resultsMu.RLock()
+	defer c.resultsMu.RUnlock()
+	diagnostics, _, _ := c.diagHandler.GetDiagnosticsForPath(path)
+	return c.toProtocolDiagnostics(diagnostics)
+}
+
 // Intended for use with external tools only, not part of LSP implementation.
 func (c *Cache) XGetLinkerResults() []linker.Result {
 	c.resultsMu.RLock()
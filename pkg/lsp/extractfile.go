@@ -0,0 +1,564 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type (
+	NewFilesEdit = protocolext.NewFilesEdit
+	NewFile      = protocolext.NewFile
+)
+
+// siblingURI returns the URI of the file with the given slash-separated name,
+// relative to the directory of the file with the given URI. New files can only
+// be created next to files with file:// URIs.
+func siblingURI(uri protocol.DocumentURI, filename string) (protocol.DocumentURI, error) {
+	if !uri.IsFile() {
+		return "", fmt.Errorf("cannot create files next to %s", uri)
+	}
+	return protocol.URIFromPath(filepath.Join(filepath.Dir(uri.Path()), filepath.FromSlash(filename))), nil
+}
+
+// fileExists reports whether the file with the given URI can be read through
+// the cache's file source, which includes open documents, registered scheme
+// handlers and, in remote mode, the client's file system.
+func (c *Cache) fileExists(ctx context.Context, uri protocol.DocumentURI) bool {
+	fh, err := c.compiler.fs.ReadFile(ctx, uri)
+	if err != nil {
+		return false
+	}
+	_, err = fh.Content()
+	return err == nil
+}
+
+// declExtraction describes top-level declarations to be moved from a file
+// into a new file in the same directory.
+type declExtraction struct {
+	// The name of the new file, relative to the directory of the original file.
+	filename string
+	// The top-level message, enum, and service declarations to move.
+	decls []ast.Node
+}
+
+// ExtractToFile moves the top-level message, enum, or service declaration at
+// the given position into a new file in the same directory and package. The
+// new file imports whatever the moved declaration depends on, and every file
+// which references the moved types, including the original file, imports the
+// new file. If filename is empty, the file is named after the declaration.
+func (c *Cache) ExtractToFile(ctx context.Context, params protocol.TextDocumentPositionParams, filename string) (*NewFilesEdit, error) {
+	linkRes, err := c.FindResultByURI(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	mapper, err := c.GetMapper(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := mapper.PositionOffset(params.Position)
+	if err != nil {
+		return nil, err
+	}
+	decl, name := topLevelDeclAtOffset(linkRes.AST(), offset)
+	if decl == nil {
+		return nil, fmt.Errorf("no top-level message, enum, or service found at the given position")
+	}
+	if filename == "" {
+		filename = extractedFilename(name)
+	}
+	return c.extractDecls(ctx, linkRes, mapper, []declExtraction{{filename: filename, decls: []ast.Node{decl}}})
+}
+
+// extractToFileActions offers to move the top-level declaration whose name is
+// at the start of the requested range into a new file.
+func (c *Cache) extractToFileActions(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper) []protocol.CodeAction {
+	fileNode := linkRes.AST()
+	offset, err := mapper.PositionOffset(request.Range.Start)
+	if err != nil {
+		return nil
+	}
+	decl, name := topLevelDeclAtOffset(fileNode, offset)
+	if decl == nil || len(topLevelDecls(fileNode)) < 2 {
+		return nil
+	}
+	nameInfo := fileNode.NodeInfo(topLevelDeclNameNode(decl))
+	if offset < nameInfo.Start().Offset || offset > nameInfo.End().Offset {
+		return nil
+	}
+	filename := extractedFilename(name)
+	if uri, err := siblingURI(mapper.URI, filename); err != nil || c.fileExists(ctx, uri) {
+		return nil
+	}
+	title := fmt.Sprintf("Move %s to %s", name, filename)
+	req, _ := json.Marshal(protocolext.ExtractToFileRequest{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: request.TextDocument,
+			Position:     request.Range.Start,
+		},
+		Filename: filename,
+	})
+	return []protocol.CodeAction{
+		{
+			Title: title,
+			Kind:  protocol.RefactorExtract,
+			Command: &protocol.Command{
+				Title:     title,
+				Command:   protocolext.ClientExtractToFileCommand,
+				Arguments: []json.RawMessage{req},
+			},
+		},
+	}
+}
+
+// extractDecls computes the edits which move declarations out of a file into
+// new files. Each new file is given the syntax, package, and file options of
+// the original file, and imports for the declarations it depends on.
+func (c *Cache) extractDecls(ctx context.Context, linkRes linker.Result, mapper *protocol.Mapper, extractions []declExtraction) (*NewFilesEdit, error) {
+	origPath := linkRes.Path()
+	origURI := mapper.URI
+	if !c.resolver.IsRealWorkspaceLocalFile(origURI) {
+		return nil, fmt.Errorf("%s is not a file in this workspace", origPath)
+	}
+	fileNode := linkRes.AST()
+	content := mapper.Content
+	pkg := linkRes.Package()
+
+	type span struct{ start, end int }
+	var (
+		paths   = make([]string, len(extractions))
+		uris    = make([]protocol.DocumentURI, len(extractions))
+		spans   = make([][]span, len(extractions))
+		descs   = make([][]protoreflect.Descriptor, len(extractions))
+		destsBy = map[protoreflect.FullName]int{}
+	)
+	for i, ex := range extractions {
+		if ex.filename == "" || path.IsAbs(ex.filename) || strings.HasPrefix(path.Clean(ex.filename), "..") || path.Ext(ex.filename) != ".proto" {
+			return nil, fmt.Errorf("invalid file name %q", ex.filename)
+		}
+		paths[i] = path.Join(path.Dir(origPath), ex.filename)
+		uri, err := siblingURI(origURI, ex.filename)
+		if err != nil {
+			return nil, err
+		}
+		uris[i] = uri
+		if _, err := c.resolver.PathToURI(paths[i]); err == nil {
+			return nil, fmt.Errorf("a file with import path %q already exists", paths[i])
+		}
+		if c.fileExists(ctx, uri) {
+			return nil, fmt.Errorf("%s already exists", uri.Path())
+		}
+		for _, decl := range ex.decls {
+			nameNode := topLevelDeclNameNode(decl)
+			if nameNode == nil {
+				return nil, fmt.Errorf("cannot move %T to a new file", decl)
+			}
+			desc := linkRes.FindDescriptorByName(pkg.Append(protoreflect.Name(nameNode.AsIdentifier())))
+			if desc == nil {
+				return nil, fmt.Errorf("no descriptor found for %s", nameNode.AsIdentifier())
+			}
+			destsBy[desc.FullName()] = i
+			descs[i] = appendNestedTypeDescriptors(descs[i], desc)
+			start, end := declLineOffsets(fileNode, content, decl)
+			spans[i] = append(spans[i], span{start, end})
+		}
+		slices.SortFunc(spans[i], func(a, b span) int { return a.start - b.start })
+	}
+	for i := range paths {
+		for j := range i {
+			if paths[i] == paths[j] {
+				return nil, fmt.Errorf("duplicate file name %q", extractions[i].filename)
+			}
+		}
+	}
+
+	// the new file a descriptor in the original file is moved to, or -1
+	destOf := func(desc protoreflect.Descriptor) int {
+		if desc.ParentFile() == nil || desc.ParentFile().Path() != origPath {
+			return -1
+		}
+		if i, ok := destsBy[topLevelParent(desc).FullName()]; ok {
+			return i
+		}
+		return -1
+	}
+	// the new file a position in the original file is moved to, or -1
+	extractionAt := func(offset int) int {
+		for i, spans := range spans {
+			for _, s := range spans {
+				if offset >= s.start && offset < s.end {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+	pathOf := func(i int) string {
+		if i == -1 {
+			return origPath
+		}
+		return paths[i]
+	}
+
+	// imports needed by the new files and the rest of the original file
+	newImports := make([]map[string]bool, len(extractions))
+	for i := range newImports {
+		newImports[i] = map[string]bool{}
+	}
+	origImports := map[string]bool{}
+	for _, ref := range fileReferences(linkRes) {
+		from := extractionAt(ref.offset)
+		target := ref.via
+		if target == origPath {
+			target = pathOf(destOf(ref.desc))
+		}
+		if target == pathOf(from) {
+			continue
+		}
+		if from == -1 {
+			if !slices.Contains(paths, target) {
+				// already imported
+				continue
+			}
+			origImports[target] = true
+		} else {
+			newImports[from][target] = true
+		}
+	}
+	if err := checkExtractionCycles(origPath, origImports, paths, newImports); err != nil {
+		return nil, err
+	}
+
+	// other files referencing the moved types must import the new files
+	otherImports := map[string]map[string]bool{}
+	for i := range extractions {
+		for _, desc := range descs[i] {
+			if _, ok := desc.(protoreflect.ServiceDescriptor); ok {
+				continue
+			}
+			refs, err := c.FindReferencesForTypeDescriptor(ctx, desc)
+			if err != nil {
+				return nil, err
+			}
+			for _, ref := range refs {
+				filename := ref.NodeInfo.Start().Filename
+				if filename == origPath {
+					continue
+				}
+				uri, err := c.resolver.PathToURI(filename)
+				if err != nil {
+					return nil, err
+				}
+				if !c.resolver.IsRealWorkspaceLocalFile(uri) {
+					return nil, fmt.Errorf("references to %s exist outside of the workspace", desc.FullName())
+				}
+				if otherImports[filename] == nil {
+					otherImports[filename] = map[string]bool{}
+				}
+				otherImports[filename][paths[i]] = true
+			}
+		}
+	}
+
+	changes := map[protocol.DocumentURI][]protocol.TextEdit{}
+	for _, spans := range spans {
+		for _, s := range spans {
+			rng, err := mapper.OffsetRange(s.start, s.end)
+			if err != nil {
+				return nil, err
+			}
+			changes[origURI] = append(changes[origURI], protocol.TextEdit{Range: rng})
+		}
+	}
+	for _, imp := range slices.Sorted(maps.Keys(origImports)) {
+		changes[origURI] = append(changes[origURI], editAddImport(linkRes, imp))
+	}
+	for _, filename := range slices.Sorted(maps.Keys(otherImports)) {
+		parseRes, err := c.FindParseResultByPath(filename)
+		if err != nil {
+			return nil, err
+		}
+		uri, err := c.resolver.PathToURI(filename)
+		if err != nil {
+			return nil, err
+		}
+		for _, imp := range slices.Sorted(maps.Keys(otherImports[filename])) {
+			if !hasImport(parseRes.AST(), imp) {
+				changes[uri] = append(changes[uri], editAddImport(parseRes, imp))
+			}
+		}
+	}
+	edit, err := c.versionedWorkspaceEdit(ctx, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	header := extractedFileHeader(fileNode, content)
+	result := &NewFilesEdit{Edit: edit}
+	for i := range extractions {
+		var b strings.Builder
+		b.WriteString(header.syntax)
+		if header.pkg != "" {
+			b.WriteString(header.pkg + "\n\n")
+		}
+		if len(newImports[i]) > 0 {
+			for _, imp := range slices.Sorted(maps.Keys(newImports[i])) {
+				fmt.Fprintf(&b, "import %q;\n", imp)
+			}
+			b.WriteString("\n")
+		}
+		if len(header.options) > 0 {
+			for _, opt := range header.options {
+				b.WriteString(opt + "\n")
+			}
+			b.WriteString("\n")
+		}
+		for j, s := range spans[i] {
+			if j > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(strings.TrimRight(string(content[s.start:s.end]), "\n") + "\n")
+		}
+		result.Files = append(result.Files, NewFile{URI: uris[i], Content: b.String()})
+	}
+	return result, nil
+}
+
+// checkExtractionCycles returns an error if the imports added by moving
+// declarations into new files would create an import cycle.
+func checkExtractionCycles(origPath string, origImports map[string]bool, paths []string, newImports []map[string]bool) error {
+	edges := map[string]map[string]bool{origPath: origImports}
+	for i, p := range paths {
+		edges[p] = newImports[i]
+	}
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var visit func(p string, stack []string) error
+	visit = func(p string, stack []string) error {
+		switch state[p] {
+		case visiting:
+			return fmt.Errorf("moving these declarations would create an import cycle: %s", strings.Join(append(stack, p), " -> "))
+		case done:
+			return nil
+		}
+		state[p] = visiting
+		for _, next := range slices.Sorted(maps.Keys(edges[p])) {
+			if _, ok := edges[next]; !ok {
+				continue
+			}
+			if err := visit(next, append(stack, p)); err != nil {
+				return err
+			}
+		}
+		state[p] = done
+		return nil
+	}
+	for _, p := range append([]string{origPath}, paths...) {
+		if err := visit(p, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileReference is a reference from a position in a file to a descriptor,
+// along with the path of the file through which the descriptor is visible:
+// the file itself, or one of its direct imports.
+type fileReference struct {
+	offset int
+	desc   protoreflect.Descriptor
+	via    string
+}
+
+// fileReferences returns the references in a file to types declared in the
+// file and in its imports, and to extensions used as options.
+func fileReferences(linkRes linker.Result) []fileReference {
+	var refs []fileReference
+	providers := map[string]string{}
+	visit := func(f protoreflect.FileDescriptor, via string) {
+		if _, ok := providers[f.Path()]; ok {
+			return
+		}
+		providers[f.Path()] = via
+		for _, top := range collectTopLevelDescriptors(f) {
+			for _, desc := range appendNestedTypeDescriptors(nil, top) {
+				for _, ref := range linkRes.FindReferences(desc) {
+					refs = append(refs, fileReference{offset: ref.NodeInfo.Start().Offset, desc: desc, via: via})
+				}
+			}
+		}
+	}
+	visit(linkRes, linkRes.Path())
+	imports := linkRes.Imports()
+	for i := range imports.Len() {
+		imp := imports.Get(i)
+		for _, f := range publicImportClosure(imp.FileDescriptor) {
+			visit(f, imp.Path())
+		}
+	}
+	linkRes.RangeFieldReferenceNodesWithDescriptors(func(node ast.Node, fd protoreflect.FieldDescriptor) bool {
+		if !fd.IsExtension() || fd.ParentFile() == nil {
+			return true
+		}
+		if via, ok := providers[fd.ParentFile().Path()]; ok {
+			info := linkRes.AST().NodeInfo(node)
+			if info.IsValid() {
+				refs = append(refs, fileReference{offset: info.Start().Offset, desc: fd, via: via})
+			}
+		}
+		return true
+	})
+	return refs
+}
+
+// publicImportClosure returns the file and every file it publicly imports,
+// directly or transitively.
+func publicImportClosure(fd protoreflect.FileDescriptor) []protoreflect.FileDescriptor {
+	files := []protoreflect.FileDescriptor{fd}
+	seen := map[string]bool{fd.Path(): true}
+	for i := 0; i < len(files); i++ {
+		imports := files[i].Imports()
+		for j := range imports.Len() {
+			if imp := imports.Get(j); imp.IsPublic && !seen[imp.Path()] {
+				seen[imp.Path()] = true
+				files = append(files, imp.FileDescriptor)
+			}
+		}
+	}
+	return files
+}
+
+// topLevelParent returns the top-level declaration containing the descriptor.
+func topLevelParent(desc protoreflect.Descriptor) protoreflect.Descriptor {
+	for {
+		parent := desc.Parent()
+		if parent == nil {
+			return desc
+		}
+		if _, ok := parent.(protoreflect.FileDescriptor); ok {
+			return desc
+		}
+		desc = parent
+	}
+}
+
+// topLevelDecls returns the top-level message, enum, and service declarations
+// in the file.
+func topLevelDecls(fileNode *ast.FileNode) []ast.Node {
+	var decls []ast.Node
+	for _, decl := range fileNode.Decls {
+		switch {
+		case decl.GetMessage() != nil:
+			decls = append(decls, decl.GetMessage())
+		case decl.GetEnum() != nil:
+			decls = append(decls, decl.GetEnum())
+		case decl.GetService() != nil:
+			decls = append(decls, decl.GetService())
+		}
+	}
+	return decls
+}
+
+// topLevelDeclAtOffset returns the top-level message, enum, or service
+// declaration containing the offset, and its name.
+func topLevelDeclAtOffset(fileNode *ast.FileNode, offset int) (ast.Node, string) {
+	for _, decl := range topLevelDecls(fileNode) {
+		info := fileNode.NodeInfo(decl)
+		if offset >= info.Start().Offset && offset < info.End().Offset {
+			if name := topLevelDeclNameNode(decl); name != nil {
+				return decl, string(name.AsIdentifier())
+			}
+		}
+	}
+	return nil, ""
+}
+
+func topLevelDeclNameNode(decl ast.Node) *ast.IdentNode {
+	switch decl := decl.(type) {
+	case *ast.MessageNode:
+		return decl.Name
+	case *ast.EnumNode:
+		return decl.Name
+	case *ast.ServiceNode:
+		return decl.Name
+	}
+	return nil
+}
+
+// extractedFilename returns the default name of a file extracted from a
+// declaration, e.g. foo_service.proto for FooService.
+func extractedFilename(name string) string {
+	return lowerSnakeCaseWords(nameWords(name)) + ".proto"
+}
+
+// declLineOffsets returns the offsets of the whole lines spanned by the node
+// and its leading comments, including the newline ending the last line and
+// one blank line following it, if there is one.
+func declLineOffsets(fileNode *ast.FileNode, content []byte, node ast.Node) (int, int) {
+	info := fileNode.NodeInfo(node)
+	start := info.Start().Offset
+	if comments := info.LeadingComments(); comments.Len() > 0 {
+		start = comments.Index(0).Start().Offset
+	}
+	start = bytes.LastIndexByte(content[:start], '\n') + 1
+	end := info.End().Offset
+	if i := bytes.IndexByte(content[end:], '\n'); i >= 0 {
+		end += i + 1
+		if next := bytes.IndexByte(content[end:], '\n'); next >= 0 && len(bytes.TrimSpace(content[end:end+next])) == 0 {
+			end += next + 1
+		}
+	} else {
+		end = len(content)
+	}
+	return start, end
+}
+
+type fileHeader struct {
+	syntax  string
+	pkg     string
+	options []string
+}
+
+// extractedFileHeader returns the syntax or edition declaration, package
+// declaration, and file options of a file, for use in files extracted from it.
+func extractedFileHeader(fileNode *ast.FileNode, content []byte) fileHeader {
+	text := func(node ast.Node) string {
+		info := fileNode.NodeInfo(node)
+		end := info.End().Offset
+		// the trailing semicolon is not part of the node
+		if i := bytes.IndexByte(content[end:], ';'); i >= 0 && len(bytes.TrimSpace(content[end:end+i])) == 0 {
+			end += i + 1
+		}
+		return string(content[info.Start().Offset:end])
+	}
+	var header fileHeader
+	if fileNode.Syntax != nil {
+		header.syntax = text(fileNode.Syntax) + "\n\n"
+	} else if fileNode.Edition != nil {
+		header.syntax = text(fileNode.Edition) + "\n\n"
+	}
+	for _, decl := range fileNode.Decls {
+		switch {
+		case decl.GetPackage() != nil:
+			header.pkg = text(decl.GetPackage())
+		case decl.GetOption() != nil:
+			header.options = append(header.options, text(decl.GetOption()))
+		}
+	}
+	return header
+}
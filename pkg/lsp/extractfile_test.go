@@ -0,0 +1,154 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestExtractToFile(t *testing.T) {
+	c, workspace := newTestCache(t, map[string]string{
+		"ui/a.proto": `syntax = "proto3";
+package ui;
+import "google/protobuf/timestamp.proto";
+option go_package = "example.com/ui";
+
+message Size {
+  int32 width = 1;
+}
+
+// Serves buttons.
+service ButtonService {
+  rpc Get(Size) returns (Button);
+}
+
+message Button {
+  Size size = 1;
+  google.protobuf.Timestamp created = 2;
+}
+`,
+		"ui/b.proto": `syntax = "proto3";
+package ui;
+import "ui/a.proto";
+message Panel {
+  Size size = 1;
+}
+`,
+	}, nil)
+	aURI := protocol.URIFromPath(filepath.Join(workspace, "ui/a.proto"))
+	bURI := protocol.URIFromPath(filepath.Join(workspace, "ui/b.proto"))
+	ctx := context.Background()
+	at := func(line, char uint32) protocol.TextDocumentPositionParams {
+		return protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: aURI},
+			Position:     protocol.Position{Line: line, Character: char},
+		}
+	}
+	editsByURI := func(edit *protocol.WorkspaceEdit) map[protocol.DocumentURI][]protocol.TextEdit {
+		edits := map[protocol.DocumentURI][]protocol.TextEdit{}
+		for _, change := range edit.DocumentChanges {
+			edits[change.TextDocumentEdit.TextDocument.URI] = protocol.AsTextEdits(change.TextDocumentEdit.Edits)
+		}
+		return edits
+	}
+
+	// the service only depends on the original file
+	edit, err := c.ExtractToFile(ctx, at(10, 10), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edit.Files) != 1 || edit.Files[0].URI != protocol.URIFromPath(filepath.Join(workspace, "ui/button_service.proto")) {
+		t.Fatalf("unexpected files %+v", edit.Files)
+	}
+	const wantService = `syntax = "proto3";
+
+package ui;
+
+import "ui/a.proto";
+
+option go_package = "example.com/ui";
+
+// Serves buttons.
+service ButtonService {
+  rpc Get(Size) returns (Button);
+}
+`
+	if edit.Files[0].Content != wantService {
+		t.Errorf("unexpected content:\n%s", edit.Files[0].Content)
+	}
+	edits := editsByURI(edit.Edit)
+	if len(edits) != 1 || len(edits[aURI]) != 1 || edits[aURI][0].Range != (protocol.Range{
+		Start: protocol.Position{Line: 9},
+		End:   protocol.Position{Line: 14},
+	}) {
+		t.Errorf("unexpected edits %+v", edits)
+	}
+
+	// a message referenced from the original file and another file
+	edit, err = c.ExtractToFile(ctx, at(5, 9), "types/size.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(edit.Files[0].Content, "\nmessage Size {\n  int32 width = 1;\n}\n") ||
+		strings.Contains(edit.Files[0].Content, "import") {
+		t.Errorf("unexpected content:\n%s", edit.Files[0].Content)
+	}
+	edits = editsByURI(edit.Edit)
+	if len(edits[aURI]) != 2 || edits[aURI][1].NewText != "\nimport \"ui/types/size.proto\";" {
+		t.Errorf("expected an import of the new file in a.proto, got %+v", edits[aURI])
+	}
+	if len(edits[bURI]) != 1 || edits[bURI][0].NewText != "\nimport \"ui/types/size.proto\";" {
+		t.Errorf("expected an import of the new file in b.proto, got %+v", edits[bURI])
+	}
+
+	// the button depends on the original file, which depends on the button
+	if _, err := c.ExtractToFile(ctx, at(14, 9), ""); err == nil || !strings.Contains(err.Error(), "import cycle") {
+		t.Errorf("expected an import cycle error, got %v", err)
+	}
+}
+
+func TestExtractToFileRemote(t *testing.T) {
+	// size.proto is only known to the client, and does not exist on disk
+	handler := memSchemeHandler{
+		"file:///remote/workspace/a.proto":    "syntax = \"proto3\";\npackage a;\nmessage Size {}\nmessage Button {}\n",
+		"file:///remote/workspace/size.proto": "syntax = \"proto3\";\npackage a;\n",
+	}
+	const aURI = protocol.DocumentURI("file:///remote/workspace/a.proto")
+	c := NewCache(protocol.WorkspaceFolder{URI: "file:///remote/workspace"}, WithSchemeHandlers(map[string]SchemeHandler{"file": handler}))
+	defer c.Close(nil)
+	ctx := context.Background()
+	c.DidModifyFiles(ctx, []file.Modification{{URI: aURI, Action: file.Create, OnDisk: true, Version: -1}})
+
+	linkRes, err := c.FindResultByURI(aURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapper, err := c.GetMapper(aURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actionsAt := func(line uint32) []protocol.CodeAction {
+		pos := protocol.Position{Line: line, Character: 9}
+		return c.extractToFileActions(ctx, &protocol.CodeActionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: aURI},
+			Range:        protocol.Range{Start: pos, End: pos},
+		}, linkRes, mapper)
+	}
+	if actions := actionsAt(2); len(actions) != 0 {
+		t.Errorf("expected no action to move Size to an existing file, got %+v", actions)
+	}
+	if actions := actionsAt(3); len(actions) != 1 {
+		t.Errorf("expected an action to move Button, got %+v", actions)
+	}
+	_, err = c.ExtractToFile(ctx, protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: aURI},
+		Position:     protocol.Position{Line: 2, Character: 9},
+	}, "")
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an error for an existing file, got %v", err)
+	}
+}
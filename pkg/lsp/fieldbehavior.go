@@ -0,0 +1,141 @@
+package lsp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kralicky/protocompile/ast"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// conflictingFieldBehaviors lists pairs of google.api.field_behavior values
+// which cannot be used together (https://google.aip.dev/203).
+var conflictingFieldBehaviors = [][2]annotations.FieldBehavior{
+	{annotations.FieldBehavior_REQUIRED, annotations.FieldBehavior_OPTIONAL},
+	{annotations.FieldBehavior_REQUIRED, annotations.FieldBehavior_OUTPUT_ONLY},
+	{annotations.FieldBehavior_OPTIONAL, annotations.FieldBehavior_OUTPUT_ONLY},
+	{annotations.FieldBehavior_INPUT_ONLY, annotations.FieldBehavior_OUTPUT_ONLY},
+	{annotations.FieldBehavior_IMMUTABLE, annotations.FieldBehavior_OUTPUT_ONLY},
+}
+
+// lintFieldBehavior reports fields with contradicting google.api.field_behavior
+// annotations, and OUTPUT_ONLY or INPUT_ONLY fields in messages which are only
+// ever sent in the opposite direction by the services in the workspace.
+func lintFieldBehavior(ctx context.Context, p *lintPass) {
+	type directional struct {
+		field    protoreflect.FieldDescriptor
+		node     ast.Node
+		behavior annotations.FieldBehavior
+	}
+	var needsGraph []directional
+	rangeFields(p.result.Messages(), func(field protoreflect.FieldDescriptor) {
+		node := localFieldNode(p.result, field, nil)
+		if node == nil {
+			return
+		}
+		seen := map[annotations.FieldBehavior]bool{}
+		for _, b := range fieldBehaviors(field) {
+			if seen[b] {
+				p.report(node, "field behavior %s is specified more than once", b)
+			}
+			seen[b] = true
+		}
+		for _, pair := range conflictingFieldBehaviors {
+			if seen[pair[0]] && seen[pair[1]] {
+				p.report(node, "field behaviors %s and %s are contradictory", pair[0], pair[1])
+			}
+		}
+		for _, b := range []annotations.FieldBehavior{annotations.FieldBehavior_OUTPUT_ONLY, annotations.FieldBehavior_INPUT_ONLY} {
+			if seen[b] {
+				needsGraph = append(needsGraph, directional{field: field, node: node, behavior: b})
+			}
+		}
+	})
+	if len(needsGraph) == 0 {
+		return
+	}
+
+	requests, responses := p.cache.messageDirectionsLocked(ctx)
+	for _, d := range needsGraph {
+		msg := d.field.ContainingMessage().FullName()
+		switch d.behavior {
+		case annotations.FieldBehavior_OUTPUT_ONLY:
+			if requests[msg] && !responses[msg] {
+				p.report(d.node, "field is OUTPUT_ONLY, but %s is only used in requests", msg)
+			}
+		case annotations.FieldBehavior_INPUT_ONLY:
+			if responses[msg] && !requests[msg] {
+				p.report(d.node, "field is INPUT_ONLY, but %s is only used in responses", msg)
+			}
+		}
+	}
+}
+
+// rangeFields calls fn for each field of the given messages and their nested
+// messages, excluding synthetic map entries.
+func rangeFields(msgs protoreflect.MessageDescriptors, fn func(protoreflect.FieldDescriptor)) {
+	rangeMessages(msgs, func(msg protoreflect.MessageDescriptor) {
+		fields := msg.Fields()
+		for j := range fields.Len() {
+			fn(fields.Get(j))
+		}
+	})
+}
+
+// rangeMessages calls fn for each of the given messages and their nested
+// messages, excluding synthetic map entries.
+func rangeMessages(msgs protoreflect.MessageDescriptors, fn func(protoreflect.MessageDescriptor)) {
+	for i := range msgs.Len() {
+		msg := msgs.Get(i)
+		if msg.IsMapEntry() {
+			continue
+		}
+		fn(msg)
+		rangeMessages(msg.Messages(), fn)
+	}
+}
+
+// messageDirectionsLocked returns the set of messages which are reachable from
+// the request and response types of every method in the workspace. It
+// requires resultsMu to be held.
+func (c *Cache) messageDirectionsLocked(ctx context.Context) (requests, responses map[protoreflect.FullName]bool) {
+	var mu sync.Mutex
+	var inputs, outputs []protoreflect.MessageDescriptor
+	c.rangeAllDescriptorsLocked(ctx, func(d protoreflect.Descriptor) bool {
+		svc, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		methods := svc.Methods()
+		for i := range methods.Len() {
+			inputs = append(inputs, methods.Get(i).Input())
+			outputs = append(outputs, methods.Get(i).Output())
+		}
+		return true
+	})
+	return reachableMessages(inputs), reachableMessages(outputs)
+}
+
+// reachableMessages returns the given messages along with the types of all of
+// their message fields, transitively.
+func reachableMessages(roots []protoreflect.MessageDescriptor) map[protoreflect.FullName]bool {
+	seen := map[protoreflect.FullName]bool{}
+	var visit func(msg protoreflect.MessageDescriptor)
+	visit = func(msg protoreflect.MessageDescriptor) {
+		if msg == nil || seen[msg.FullName()] {
+			return
+		}
+		seen[msg.FullName()] = true
+		fields := msg.Fields()
+		for i := range fields.Len() {
+			visit(fields.Get(i).Message())
+		}
+	}
+	for _, msg := range roots {
+		visit(msg)
+	}
+	return seen
+}
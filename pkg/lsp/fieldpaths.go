@@ -0,0 +1,379 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/ast/paths"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protopath"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const fieldMaskPathsFullName protoreflect.FullName = "google.protobuf.FieldMask.paths"
+
+// builtinFieldPaths maps well-known string option fields whose values are
+// field paths to the message the paths select fields of.
+var builtinFieldPaths = map[protoreflect.FullName]string{
+	"google.api.HttpRule.body":          "input",
+	"google.api.HttpRule.response_body": "output",
+	"google.api.method_signature":       "input",
+}
+
+// A fieldPathValue is a string option value containing field paths, along
+// with the message the paths select fields of.
+type fieldPathValue struct {
+	node   ast.Node
+	value  string
+	target protoreflect.MessageDescriptor
+	// True if the value is one of the paths of a FieldMask.
+	fieldMask bool
+	// The offset in the file of the first character of the value, or -1 if
+	// the literal contains escapes or is a compound string, in which case
+	// positions within the value cannot be mapped to the file.
+	offset int
+}
+
+// A fieldPathSegment is one field name of a field path. Offsets are relative
+// to the start of the value.
+type fieldPathSegment struct {
+	start, end int
+	// The complete path the segment belongs to.
+	path string
+	// The field the segment selects, or nil if it could not be resolved, in
+	// which case err describes why. Segments following an invalid segment are
+	// not resolved, and have neither a field nor an error.
+	field protoreflect.FieldDescriptor
+	err   string
+}
+
+// segments splits the value into comma-separated paths, and resolves each
+// dot-separated segment of each path against the target message. The paths
+// of a FieldMask contain no commas, so they are always a single path.
+func (fp *fieldPathValue) segments() []fieldPathSegment {
+	var segments []fieldPathSegment
+	start := 0
+	for _, path := range strings.SplitAfter(fp.value, ",") {
+		pathStart := start
+		start += len(path)
+		path = strings.TrimSuffix(path, ",")
+		trimmed := strings.TrimLeft(path, " ")
+		pathStart += len(path) - len(trimmed)
+		trimmed = strings.TrimRight(trimmed, " ")
+		if trimmed == "" || trimmed == "*" {
+			continue
+		}
+		md := fp.target
+		var prev protoreflect.FieldDescriptor
+		segStart := pathStart
+		failed := false
+		for _, name := range strings.Split(trimmed, ".") {
+			seg := fieldPathSegment{start: segStart, end: segStart + len(name), path: trimmed}
+			segStart = seg.end + 1
+			switch {
+			case failed:
+			case name == "":
+				seg.err = "empty field name"
+			case prev != nil && prev.IsMap():
+				seg.err = fmt.Sprintf("cannot select fields of map field %s", prev.Name())
+			case prev != nil && prev.IsList():
+				seg.err = fmt.Sprintf("repeated field %s must be the last segment of a field path", prev.Name())
+			case md == nil:
+				seg.err = fmt.Sprintf("field %s is not a message", prev.Name())
+			default:
+				seg.field = md.Fields().ByName(protoreflect.Name(name))
+				if seg.field == nil {
+					seg.err = fmt.Sprintf("message %s has no field named %q", md.FullName(), name)
+				}
+			}
+			if seg.err != "" {
+				failed = true
+			}
+			if seg.field != nil {
+				prev, md = seg.field, seg.field.Message()
+			}
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+// span returns the location of the segment in the file, or of the whole
+// literal if positions within the value cannot be mapped to the file.
+func (fp *fieldPathValue) span(fileNode *ast.FileNode, seg fieldPathSegment) ast.SourceSpan {
+	if fp.offset < 0 {
+		return fileNode.NodeInfo(fp.node)
+	}
+	return ast.NewSourceSpan(fileNode.SourcePos(fp.offset+seg.start), fileNode.SourcePos(fp.offset+seg.end))
+}
+
+// fieldPathTarget returns the target configured for the field, or its builtin
+// target. ok is false if the field does not contain field paths.
+func fieldPathTarget(settings *Settings, field protoreflect.FieldDescriptor) (target string, ok bool) {
+	if target, ok := settings.FieldPaths[string(field.FullName())]; ok {
+		return target, true
+	}
+	target, ok = builtinFieldPaths[field.FullName()]
+	return target, ok
+}
+
+// fieldPathValueAt returns the field paths in the string literal at the end of
+// the path, if the field it is assigned to contains field paths and the target
+// message can be determined.
+func (c *Cache) fieldPathValueAt(ctx context.Context, linkRes linker.Result, resolver descriptorFinder, settings *Settings, path protopath.Values, strNode ast.Node, value string) (*fieldPathValue, bool) {
+	idx := valueFieldIndex(path)
+	if idx == -1 {
+		return nil, false
+	}
+	field := c.findStringValueField(ctx, linkRes, path)
+	if field == nil || field.Kind() != protoreflect.StringKind {
+		return nil, false
+	}
+	var target string
+	fieldMask := field.FullName() == fieldMaskPathsFullName
+	if fieldMask {
+		// the target is determined by the field the FieldMask is assigned to
+		parent := protopath.Values{Path: path.Path[:idx], Values: path.Values[:idx]}
+		if idx = valueFieldIndex(parent); idx == -1 {
+			return nil, false
+		}
+		if field = c.findStringValueField(ctx, linkRes, parent); field == nil {
+			return nil, false
+		}
+		target, _ = fieldPathTarget(settings, field)
+	} else {
+		var ok bool
+		if target, ok = fieldPathTarget(settings, field); !ok {
+			return nil, false
+		}
+	}
+	md := c.resolveFieldPathTarget(ctx, linkRes, resolver, path, idx, field, target)
+	if md == nil {
+		return nil, false
+	}
+	fp := &fieldPathValue{node: strNode, value: value, target: md, fieldMask: fieldMask, offset: -1}
+	if lit, ok := strNode.(*ast.StringLiteralNode); ok {
+		info := linkRes.AST().NodeInfo(lit)
+		if raw := info.RawText(); len(raw) == len(value)+2 && raw[1:len(raw)-1] == value {
+			fp.offset = info.Start().Offset + 1
+		}
+	}
+	return fp, true
+}
+
+// resolveFieldPathTarget resolves a target, as described in the "fieldPaths"
+// setting, for the field whose node is at index idx of the path.
+func (c *Cache) resolveFieldPathTarget(ctx context.Context, linkRes linker.Result, resolver descriptorFinder, path protopath.Values, idx int, field protoreflect.FieldDescriptor, target string) protoreflect.MessageDescriptor {
+	enclosing := func(match func(paths.PathIndex) bool) protoreflect.Descriptor {
+		for i := idx; i >= 0; i-- {
+			if _, ok := path.Index(i).Value.Interface().(protoreflect.Message); !ok || !match(path.Index(i)) {
+				continue
+			}
+			desc, _, err := c.deepPathSearch(ctx, path.Path[:i+1], linkRes, linkRes)
+			if err != nil {
+				return nil
+			}
+			return desc
+		}
+		return nil
+	}
+	isMessage := func(d protoreflect.Descriptor) bool {
+		_, ok := d.(protoreflect.MessageDescriptor)
+		return ok
+	}
+	switch {
+	case target == "" || target == "input" || target == "output":
+		if method, ok := enclosing(func(pi paths.PathIndex) bool {
+			return paths.NodeAt[*ast.RPCNode](pi) != nil
+		}).(protoreflect.MethodDescriptor); ok {
+			if target == "output" {
+				return method.Output()
+			}
+			return method.Input()
+		}
+		if target != "" {
+			return nil
+		}
+		fallthrough
+	case target == "parent":
+		md, _ := enclosing(func(pi paths.PathIndex) bool {
+			return paths.NodeAt[*ast.MessageNode](pi) != nil
+		}).(protoreflect.MessageDescriptor)
+		return md
+	case strings.HasPrefix(target, "sibling:"):
+		name := protoreflect.Name(strings.TrimPrefix(target, "sibling:"))
+		sibling := field.ContainingMessage().Fields().ByName(name)
+		if sibling == nil {
+			return nil
+		}
+		if sibling.Message() != nil {
+			return sibling.Message()
+		}
+		if sibling.Kind() != protoreflect.StringKind {
+			return nil
+		}
+		for i := idx; i >= 0; i-- {
+			if _, ok := path.Index(i).Value.Interface().(protoreflect.Message); !ok {
+				continue
+			}
+			lit := paths.NodeAt[*ast.MessageLiteralNode](path.Index(i))
+			if lit == nil {
+				continue
+			}
+			for _, elem := range lit.GetElements() {
+				if elem.GetName() == nil || elem.GetName().IsExtension() || protoreflect.Name(elem.GetName().Name.AsIdentifier()) != name || elem.GetVal() == nil {
+					continue
+				}
+				if value, ok := elem.GetVal().Value().(string); ok {
+					md, _ := resolveRelativeName(resolver, linkRes.Package(), value, isMessage).(protoreflect.MessageDescriptor)
+					return md
+				}
+			}
+			return nil
+		}
+		return nil
+	default:
+		md, _ := resolveRelativeName(resolver, linkRes.Package(), target, isMessage).(protoreflect.MessageDescriptor)
+		return md
+	}
+}
+
+// valueFieldIndex returns the index in the path of the innermost message
+// field or option node, to which the value at the end of the path is
+// assigned, or -1 if there is none.
+func valueFieldIndex(path protopath.Values) int {
+	for i := len(path.Path) - 1; i >= 0; i-- {
+		if _, ok := path.Index(i).Value.Interface().(protoreflect.Message); !ok {
+			continue
+		}
+		if paths.NodeAt[*ast.MessageFieldNode](path.Index(i)) != nil || paths.NodeAt[*ast.OptionNode](path.Index(i)) != nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// rangeFieldPathValues calls fn for each string option value in the file which
+// contains field paths.
+func (c *Cache) rangeFieldPathValues(ctx context.Context, linkRes linker.Result, resolver descriptorFinder, settings *Settings, fn func(*fieldPathValue)) {
+	fileNode := linkRes.AST()
+	if fileNode == nil {
+		return
+	}
+	tracker := &paths.AncestorTracker{}
+	ast.Inspect(fileNode, func(node ast.Node) bool {
+		var value string
+		switch node := node.(type) {
+		case *ast.CompoundStringLiteralNode:
+			value = node.AsString()
+		case *ast.StringLiteralNode:
+			value = node.AsString()
+		default:
+			return true
+		}
+		if fp, ok := c.fieldPathValueAt(ctx, linkRes, resolver, settings, tracker.Values(), node, value); ok {
+			fn(fp)
+		}
+		return false
+	}, tracker.AsWalkOptions()...)
+}
+
+// lintFieldPaths reports field paths which do not select a field of their
+// target message, highlighting the first invalid segment of each path.
+func lintFieldPaths(ctx context.Context, p *lintPass) {
+	fileNode := p.result.AST()
+	p.cache.rangeFieldPathValues(ctx, p.result, p.cache.results.AsResolver(), p.settings, func(fp *fieldPathValue) {
+		if fp.fieldMask && !fieldMaskPathPattern.MatchString(fp.value) {
+			// malformed paths are reported when the literal is validated
+			return
+		}
+		for _, seg := range fp.segments() {
+			if seg.err == "" {
+				continue
+			}
+			p.reportSpan(fp.span(fileNode, seg), "invalid field path %q: %s", seg.path, seg.err)
+		}
+	})
+}
+
+// completeFieldPaths completes the field name at the cursor, within a string
+// literal assigned to a field containing field paths. The path must end at
+// the message field or option node the value is assigned to.
+func (c *Cache) completeFieldPaths(ctx context.Context, linkRes linker.Result, path protopath.Values, val *ast.ValueNode, posOffset int) []protocol.CompletionItem {
+	if val == nil {
+		return nil
+	}
+	values := []*ast.ValueNode{val}
+	if list := val.GetArrayLiteral(); list != nil {
+		values = list.FilterValues()
+	}
+	fileNode := linkRes.AST()
+	for _, v := range values {
+		lit := v.GetStringLiteral()
+		if lit == nil {
+			continue
+		}
+		info := fileNode.NodeInfo(lit)
+		if posOffset <= info.Start().Offset || posOffset >= info.End().Offset {
+			continue
+		}
+		fp, ok := c.fieldPathValueAt(ctx, linkRes, c, c.settings.Load(), path, lit, lit.AsString())
+		if !ok || fp.offset < 0 {
+			return nil
+		}
+		return fp.completeAt(fileNode, posOffset-fp.offset)
+	}
+	return nil
+}
+
+// completeAt returns the fields which can be selected by the segment
+// containing the given offset within the value.
+func (fp *fieldPathValue) completeAt(fileNode *ast.FileNode, rel int) []protocol.CompletionItem {
+	prefix := fp.value[strings.LastIndex(fp.value[:rel], ",")+1 : rel]
+	prefix = strings.TrimLeft(prefix, " ")
+	parents, partial := "", prefix
+	if i := strings.LastIndex(prefix, "."); i != -1 {
+		parents, partial = prefix[:i], prefix[i+1:]
+	}
+	start := rel - len(partial)
+	end := rel + strings.IndexAny(fp.value[rel:]+",", ",. ")
+
+	md := fp.target
+	if parents != "" {
+		for _, name := range strings.Split(parents, ".") {
+			fd := md.Fields().ByName(protoreflect.Name(name))
+			if fd == nil || fd.IsList() || fd.IsMap() || fd.Message() == nil {
+				return nil
+			}
+			md = fd.Message()
+		}
+	}
+	rng := positionsToRange(fileNode.SourcePos(fp.offset+start), fileNode.SourcePos(fp.offset+end))
+	fields := md.Fields()
+	items := make([]protocol.CompletionItem, 0, fields.Len())
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		detail := kindName(fd)
+		if fd.Message() != nil {
+			detail = string(fd.Message().FullName())
+		}
+		items = append(items, protocol.CompletionItem{
+			Label:  string(fd.Name()),
+			Kind:   protocol.FieldCompletion,
+			Detail: detail,
+			LabelDetails: &protocol.CompletionItemLabelDetails{
+				Description: string(md.FullName()),
+			},
+			TextEdit: &protocol.Or_CompletionItem_textEdit{
+				Value: protocol.TextEdit{
+					Range:   rng,
+					NewText: string(fd.Name()),
+				},
+			},
+		})
+	}
+	return items
+}
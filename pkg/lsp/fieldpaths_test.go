@@ -0,0 +1,144 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestFieldPaths(t *testing.T) {
+	const source = `syntax = "proto3";
+package a;
+import "google/protobuf/descriptor.proto";
+import "google/protobuf/field_mask.proto";
+
+message CacheRule {
+  google.protobuf.FieldMask key = 1;
+  string columns = 2;
+  string type = 3;
+  google.protobuf.FieldMask fields = 4;
+}
+extend google.protobuf.MethodOptions {
+  CacheRule cache = 50000;
+}
+extend google.protobuf.MessageOptions {
+  CacheRule index = 50001;
+}
+message Address {
+  string city = 1;
+}
+message User {
+  option (index) = { key: { paths: ["address.city", "address.zip"] } };
+  string name = 1;
+  Address address = 2;
+  repeated string tags = 3;
+}
+message GetUserRequest {
+  string name = 1;
+  User user = 2;
+}
+service Users {
+  rpc GetUser(GetUserRequest) returns (User) {
+    option (cache) = {
+      key: { paths: ["user.tags.x", "name"] }
+      columns: "name, address.city"
+      type: "Address"
+      fields: { paths: "ci" }
+    };
+  }
+}
+`
+	c, workspace := newTestCache(t, map[string]string{"a.proto": source}, &Settings{
+		FieldPaths: map[string]string{
+			"a.CacheRule.columns": "output",
+			"a.CacheRule.fields":  "sibling:type",
+		},
+	})
+	uri := protocol.URIFromPath(filepath.Join(workspace, "a.proto"))
+	ctx := context.Background()
+
+	// the position of the end of the first match of the given text
+	after := func(text string) protocol.Position {
+		i := strings.Index(source, text) + len(text)
+		line := strings.Count(source[:i], "\n")
+		return protocol.Position{Line: uint32(line), Character: uint32(i - strings.LastIndex(source[:i], "\n") - 1)}
+	}
+
+	diagnostics, _, _ := c.diagHandler.GetDiagnosticsForPath("a.proto")
+	var messages []string
+	for _, d := range diagnostics {
+		if d.Code != "field-paths" {
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("%d:%d: %s", d.Range.Start().Line, d.Range.Start().Col, d.Error))
+	}
+	want := []string{
+		`22:62: invalid field path "address.zip": message a.Address has no field named "zip"`,
+		`34:33: invalid field path "user.tags.x": repeated field tags must be the last segment of a field path`,
+		`37:25: invalid field path "ci": message a.Address has no field named "ci"`,
+	}
+	slices.Sort(messages)
+	if !slices.Equal(messages, want) {
+		t.Errorf("got diagnostics:\n%s\nwant:\n%s", strings.Join(messages, "\n"), strings.Join(want, "\n"))
+	}
+
+	// segments of a comma-separated path in the method's response type
+	desc, rng, err := c.FindStringReferenceAtLocation(ctx, c.Snapshot(), protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     after(`"name, address.ci`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc == nil || desc.FullName() != "a.Address.city" {
+		t.Fatalf("expected a.Address.city, got %v", desc)
+	}
+	if rng.Start != after(`"name, address.`) || rng.End != after(`"name, address.city`) {
+		t.Errorf("unexpected range %v", rng)
+	}
+
+	complete := func(pos protocol.Position) []string {
+		t.Helper()
+		list, err := c.GetCompletions(ctx, c.Snapshot(), &protocol.CompletionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     pos,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var labels []string
+		for _, item := range list.Items {
+			if item.Kind == protocol.FieldCompletion {
+				labels = append(labels, item.Label)
+			}
+		}
+		return labels
+	}
+	// the request type of the enclosing method
+	if labels := complete(after(`"user.`)); !slices.Equal(labels, []string{"name", "address", "tags"}) {
+		t.Errorf("unexpected completions %v", labels)
+	}
+	// the type named by a sibling field
+	if labels := complete(after(`paths: "c`)); !slices.Equal(labels, []string{"city"}) {
+		t.Errorf("unexpected completions %v", labels)
+	}
+
+	var fd protoreflect.FieldDescriptor
+	if desc, _, _ := c.FindStringReferenceAtLocation(ctx, c.Snapshot(), protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     after(`["address.c`),
+	}); desc != nil {
+		fd, _ = desc.(protoreflect.FieldDescriptor)
+	}
+	if fd == nil || fd.FullName() != "a.Address.city" {
+		t.Errorf("expected a.Address.city in the enclosing message's option, got %v", fd)
+	}
+}
@@ -0,0 +1,166 @@
+package lsp
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/kralicky/protols/pkg/format"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/pkg/gocommand"
+)
+
+// importOrigin records where a file was found, when that is not evident from
+// its path and import source.
+type importOrigin struct {
+	// the import path the file was requested with, if it was found under a
+	// different canonical path
+	requestedPath string
+	// how requestedPath was mapped to the canonical path
+	resolution string
+	// for synthetic files, the name of the file in the descriptor embedded
+	// in the generated Go code
+	descriptorName string
+	// the go module the file was found in
+	module *gocommand.ModuleJSON
+}
+
+type (
+	FileInfo     = protocolext.FileInfo
+	GoModuleInfo = protocolext.GoModuleInfo
+)
+
+// FileInfo describes where the file with the given URI was found.
+func (r *Resolver) FileInfo(uri protocol.DocumentURI) (FileInfo, error) {
+	r.pathsMu.RLock()
+	defer r.pathsMu.RUnlock()
+	path, ok := r.filePathsByURI[uri]
+	if !ok {
+		return FileInfo{}, fmt.Errorf("unknown file: %s", uri)
+	}
+	info := FileInfo{
+		URI:    uri,
+		Path:   path,
+		Source: r.importSourcesByURI[uri].String(),
+	}
+	origin := r.importOrigins[uri]
+	info.OriginalName = origin.descriptorName
+	if info.OriginalName == "" {
+		info.OriginalName = r.syntheticFileOriginalNames[uri]
+	}
+	if info.OriginalName == path {
+		info.OriginalName = ""
+	}
+	if origin.requestedPath != path {
+		info.RequestedPath = origin.requestedPath
+		info.Resolution = origin.resolution
+	}
+	if origin.module != nil {
+		info.GoModule = &GoModuleInfo{
+			Path:    origin.module.Path,
+			Version: origin.module.Version,
+			Dir:     origin.module.Dir,
+		}
+	}
+	return info, nil
+}
+
+// FileInfo describes where the file with the given URI was found.
+func (c *Cache) FileInfo(uri protocol.DocumentURI) (FileInfo, error) {
+	info, err := c.resolver.FileInfo(uri)
+	if err != nil {
+		return info, err
+	}
+	if m := info.GoModule; m != nil && m.Version != "" && c.resolver.goLanguageDriver.HasGoModule() {
+		versions, err := c.resolver.goLanguageDriver.ModuleVersions(m.Path)
+		if err != nil {
+			slog.Debug("failed to read module graph", "error", err)
+		} else if len(versions) > 1 {
+			m.RequiredVersions = versions
+		}
+	}
+	return info, nil
+}
+
+// fileInfoMarkdown describes the file in a hover.
+func fileInfoMarkdown(info FileInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "- path: `%s`\n", info.Path)
+	fmt.Fprintf(&b, "- source: %s\n", info.Source)
+	if info.OriginalName != "" {
+		fmt.Fprintf(&b, "- original name: `%s`\n", info.OriginalName)
+	}
+	if info.RequestedPath != "" {
+		fmt.Fprintf(&b, "- resolved from `%s` (%s)\n", info.RequestedPath, info.Resolution)
+	}
+	if m := info.GoModule; m != nil {
+		if m.Version != "" {
+			fmt.Fprintf(&b, "- go module: `%s@%s`\n", m.Path, m.Version)
+			if len(m.RequiredVersions) > 0 {
+				fmt.Fprintf(&b, "\n**Warning:** multiple versions of `%s` are required in the build graph (%s); only %s is used\n",
+					m.Path, strings.Join(m.RequiredVersions, ", "), m.Version)
+			}
+		} else {
+			fmt.Fprintf(&b, "- go module: `%s`\n", m.Path)
+		}
+	}
+	return b.String()
+}
+
+// tryHoverImportNode describes where the file imported by the import
+// statement at the given position was found.
+func (c *Cache) tryHoverImportNode(snapshot *Snapshot, params protocol.TextDocumentPositionParams) *protocol.Hover {
+	res, err := snapshot.FindResultByURI(params.TextDocument.URI)
+	if err != nil {
+		return nil
+	}
+	mapper, err := c.GetMapper(params.TextDocument.URI)
+	if err != nil {
+		return nil
+	}
+	offset, err := mapper.PositionOffset(params.Position)
+	if err != nil {
+		return nil
+	}
+	fileNode := res.AST()
+	// imports are listed in the descriptor in the order they are declared,
+	// but under their canonical paths, which may differ from the import
+	// statements
+	imports := res.Imports()
+	var index int
+	for _, decl := range fileNode.Decls {
+		imp := decl.GetImport()
+		if imp == nil || imp.IsIncomplete() {
+			continue
+		}
+		index++
+		info := fileNode.NodeInfo(imp)
+		if offset < info.Start().Offset || offset >= info.End().Offset {
+			continue
+		}
+		if index > imports.Len() {
+			return nil
+		}
+		uri, err := c.resolver.PathToURI(imports.Get(index - 1).Path())
+		if err != nil {
+			return nil
+		}
+		fileInfo, err := c.FileInfo(uri)
+		if err != nil {
+			return nil
+		}
+		text, err := format.PrintNode(fileNode, imp)
+		if err != nil {
+			return nil
+		}
+		return &protocol.Hover{
+			Contents: protocol.MarkupContent{
+				Kind:  protocol.Markdown,
+				Value: fmt.Sprintf("```protobuf\n%s\n```\n", text) + fileInfoMarkdown(fileInfo),
+			},
+			Range: toRange(fileNode.NodeInfo(imp.Name)),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A fileReferenceResolver resolves the file named by the value of a string
+// option field. dir is the directory containing the file declaring the option.
+type fileReferenceResolver func(c *Cache, dir string, value string) (protocol.DocumentURI, bool)
+
+// fileReferenceResolvers contains the kinds of file references that can be
+// assigned to option fields by the "stringReferences" setting. Values of these
+// fields are shown as document links, and go-to-definition opens the file.
+var fileReferenceResolvers = map[string]fileReferenceResolver{
+	"file":          resolveRelativeFileReference,
+	"workspaceFile": resolveWorkspaceFileReference,
+}
+
+// resolveRelativeFileReference resolves a path relative to the directory of
+// the file declaring the option.
+func resolveRelativeFileReference(_ *Cache, dir string, value string) (protocol.DocumentURI, bool) {
+	return existingFileURI(dir, value)
+}
+
+// resolveWorkspaceFileReference resolves a path relative to the workspace root.
+func resolveWorkspaceFileReference(c *Cache, _ string, value string) (protocol.DocumentURI, bool) {
+	return existingFileURI(uriPath(protocol.DocumentURI(c.workspace.URI)), value)
+}
+
+func existingFileURI(dir string, value string) (protocol.DocumentURI, bool) {
+	if value == "" || filepath.IsAbs(value) {
+		return "", false
+	}
+	path := filepath.Join(dir, filepath.FromSlash(value))
+	if !fileExists(path) {
+		return "", false
+	}
+	return protocol.URIFromPath(path), true
+}
+
+// fileReferenceLinks returns document links for the string option values in
+// the file which refer to other files.
+func (c *Cache) fileReferenceLinks(res linker.Result, resolver descriptorFinder) []protocol.DocumentLink {
+	uri, err := c.resolver.PathToURI(res.Path())
+	if err != nil {
+		return nil
+	}
+	dir := filepath.Dir(uri.Path())
+	fileNode := res.AST()
+	var links []protocol.DocumentLink
+	rangeOptionValues(res, resolver, func(fd protoreflect.FieldDescriptor, val *ast.ValueNode) {
+		kind, ok := c.stringReferenceKind(fd)
+		if !ok {
+			return
+		}
+		resolve, ok := fileReferenceResolvers[kind]
+		if !ok {
+			return
+		}
+		value, ok := val.Value().(string)
+		if !ok {
+			return
+		}
+		if target, ok := resolve(c, dir, value); ok {
+			links = append(links, protocol.DocumentLink{
+				Range:  toRange(fileNode.NodeInfo(val)),
+				Target: (*string)(&target),
+			})
+		}
+	})
+	return links
+}
+
+// findFileReferenceLink returns a link to the file referred to by the string
+// option value at the given location, if any.
+func (c *Cache) findFileReferenceLink(snapshot *Snapshot, params protocol.TextDocumentPositionParams) (protocol.LocationLink, bool) {
+	res, err := snapshot.FindResultOrPartialResultByURI(params.TextDocument.URI)
+	if err != nil || res.AST() == nil {
+		return protocol.LocationLink{}, false
+	}
+	for _, link := range c.fileReferenceLinks(res, snapshot) {
+		if !protocol.Intersect(link.Range, protocol.Range{Start: params.Position, End: params.Position}) {
+			continue
+		}
+		origin := link.Range
+		return protocol.LocationLink{
+			OriginSelectionRange: &origin,
+			TargetURI:            protocol.DocumentURI(*link.Target),
+		}, true
+	}
+	return protocol.LocationLink{}, false
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,68 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestFileReferenceLinks(t *testing.T) {
+	c, workspace := newTestCache(t, map[string]string{
+		"api/a.proto": `syntax = "proto3";
+package a;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.MessageOptions {
+  repeated string example = 50000;
+  string schema = 50001;
+}
+message A {
+  option (example) = "testdata/a.textpb";
+  option (example) = "testdata/missing.textpb";
+  option (schema) = "schemas/a.json";
+}
+`,
+		"api/testdata/a.textpb": "name: \"a\"\n",
+		"schemas/a.json":        "{}\n",
+	}, &Settings{
+		StringReferences: map[string]string{
+			"a.example": "file",
+			"a.schema":  "workspaceFile",
+		},
+	})
+	ctx := context.Background()
+	uri := protocol.URIFromPath(filepath.Join(workspace, "api/a.proto"))
+
+	links, err := c.ComputeDocumentLinks(c.Snapshot(), protocol.TextDocumentIdentifier{URI: uri})
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := map[uint32]protocol.DocumentURI{}
+	for _, link := range links {
+		targets[link.Range.Start.Line] = protocol.DocumentURI(*link.Target)
+	}
+	want := map[uint32]protocol.DocumentURI{
+		8:  protocol.URIFromPath(filepath.Join(workspace, "api/testdata/a.textpb")),
+		10: protocol.URIFromPath(filepath.Join(workspace, "schemas/a.json")),
+	}
+	for line, target := range want {
+		if targets[line] != target {
+			t.Errorf("line %d: expected a link to %s, got %q", line, target, targets[line])
+		}
+	}
+	if _, ok := targets[9]; ok {
+		t.Errorf("unexpected link to a missing file")
+	}
+
+	defs, err := c.FindDefinitionLinks(ctx, c.Snapshot(), protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     protocol.Position{Line: 8, Character: 25},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || defs[0].TargetURI != want[8] || defs[0].OriginSelectionRange.Start != (protocol.Position{Line: 8, Character: 21}) {
+		t.Errorf("unexpected definitions %+v", defs)
+	}
+}
@@ -34,7 +34,7 @@ func (c *Cache) FormatDocument(doc protocol.TextDocumentIdentifier, options prot
 	}
 	// format whole file
 	buf := bytes.NewBuffer(make([]byte, 0, len(mapper.Content)))
-	format := format.NewFormatter(buf, res.AST())
+	format := format.NewFormatterWithOptions(buf, res.AST(), c.settings.Load().Format)
 	if err := format.Run(); err != nil {
 		return nil, err
 	}
@@ -15,10 +15,8 @@ import (
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-func (c *Cache) FindGeneratedDefinition(ctx context.Context, params protocol.TextDocumentPositionParams) ([]protocol.Location, error) {
-	c.resultsMu.RLock()
-	defer c.resultsMu.RUnlock()
-	desc, _, err := c.FindTypeDescriptorAtLocation(params)
+func (c *Cache) FindGeneratedDefinition(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams) ([]protocol.Location, error) {
+	desc, _, err := c.FindTypeDescriptorAtLocation(ctx, snapshot, params)
 	if err != nil {
 		return nil, fmt.Errorf("no generated definition found: %w", err)
 	}
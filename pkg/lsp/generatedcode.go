@@ -0,0 +1,230 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// lintStaleGeneratedCode reports files whose generated Go code in the local
+// module was generated from a different version of the file, by comparing the
+// descriptor embedded in the generated code with the compiled descriptor. A
+// code action runs the generate command for the file.
+func lintStaleGeneratedCode(_ context.Context, p *lintPass) {
+	uri, generated := findEmbeddedDescriptors(p)
+	var stale []string
+	for _, g := range generated {
+		if !equivalentGeneratedDescriptors(p.result, g.fd) {
+			stale = append(stale, filepath.Base(g.filename))
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+	d := p.report(fileDiagnosticNode(p.result.AST()), "generated code is out of date (%s)", strings.Join(stale, ", "))
+	if _, ok := p.result.AST().Pragma(PragmaNoGenerate); ok {
+		return
+	}
+	req, _ := json.Marshal(protocolext.GenerateCodeRequest{
+		URIs: []protocol.DocumentURI{uri},
+	})
+	d.CodeActions = append(d.CodeActions, CodeAction{
+		Title: "Regenerate code for this file",
+		Path:  p.result.Path(),
+		Kind:  protocol.QuickFix,
+		Command: &protocol.Command{
+			Title:     "Generate File",
+			Command:   protocolext.GenerateCommand,
+			Arguments: []json.RawMessage{req},
+		},
+	})
+}
+
+// lintMissingGeneratedDeclarations reports each declaration in a file which
+// is missing from the descriptor embedded in the file's generated Go code, so
+// that code using it would not compile. This pinpoints what
+// stale-generated-code reports for the file as a whole.
+func lintMissingGeneratedDeclarations(ctx context.Context, p *lintPass) {
+	_, generated := findEmbeddedDescriptors(p)
+	if len(generated) == 0 {
+		return
+	}
+	names := map[protoreflect.FullName]struct{}{}
+	for _, g := range generated {
+		collectDescriptorNames(g.fd, names)
+	}
+	p.result.RangeDescriptors(ctx, func(desc protoreflect.Descriptor) bool {
+		switch desc := desc.(type) {
+		case protoreflect.MessageDescriptor:
+			if desc.IsMapEntry() {
+				return true
+			}
+		case protoreflect.FieldDescriptor:
+			if desc.ContainingMessage().IsMapEntry() {
+				return true
+			}
+		case protoreflect.EnumDescriptor, protoreflect.EnumValueDescriptor,
+			protoreflect.ServiceDescriptor, protoreflect.MethodDescriptor:
+		default:
+			return true
+		}
+		if _, ok := names[desc.FullName()]; ok {
+			return true
+		}
+		if parent := desc.Parent(); parent != nil {
+			if _, ok := parent.(protoreflect.FileDescriptor); !ok {
+				if _, ok := names[parent.FullName()]; !ok {
+					// only report the outermost missing declaration
+					return true
+				}
+			}
+		}
+		ref, err := findDefinition(desc, p.result)
+		if err != nil || !ref.NodeInfo.IsValid() {
+			return true
+		}
+		d := p.reportSpan(ref.NodeInfo, "%s is missing from the generated code", desc.Name())
+		d.Severity = protocol.SeverityInformation
+		return true
+	})
+}
+
+type embeddedGeneratedDescriptor struct {
+	filename string
+	fd       *descriptorpb.FileDescriptorProto
+}
+
+// findEmbeddedDescriptors returns the descriptors embedded in the generated
+// Go code for the file in the local module.
+func findEmbeddedDescriptors(p *lintPass) (protocol.DocumentURI, []embeddedGeneratedDescriptor) {
+	driver := p.cache.resolver.goLanguageDriver
+	if !driver.HasGoModule() {
+		return "", nil
+	}
+	uri, err := p.cache.resolver.PathToURI(p.result.Path())
+	if err != nil || !uri.IsFile() {
+		return "", nil
+	}
+	var generated []embeddedGeneratedDescriptor
+	for _, sourcePath := range generatedSourcePaths(driver, uri, p.result.Path()) {
+		for _, filename := range driver.FindGeneratedFilenames(sourcePath) {
+			fd, err := driver.EmbeddedDescriptor(filename)
+			if err != nil {
+				// _grpc.pb.go files and other plugins' outputs have no
+				// embedded descriptor
+				continue
+			}
+			generated = append(generated, embeddedGeneratedDescriptor{filename: filename, fd: fd})
+		}
+	}
+	return uri, generated
+}
+
+// collectDescriptorNames adds the full names of all declarations in the file
+// to the set.
+func collectDescriptorNames(fd *descriptorpb.FileDescriptorProto, names map[protoreflect.FullName]struct{}) {
+	prefix := protoreflect.FullName(fd.GetPackage())
+	var addEnum func(scope protoreflect.FullName, e *descriptorpb.EnumDescriptorProto)
+	addEnum = func(scope protoreflect.FullName, e *descriptorpb.EnumDescriptorProto) {
+		name := scope.Append(protoreflect.Name(e.GetName()))
+		names[name] = struct{}{}
+		for _, v := range e.GetValue() {
+			// enum values are scoped to the enum's parent
+			names[scope.Append(protoreflect.Name(v.GetName()))] = struct{}{}
+		}
+	}
+	var addMessage func(scope protoreflect.FullName, m *descriptorpb.DescriptorProto)
+	addMessage = func(scope protoreflect.FullName, m *descriptorpb.DescriptorProto) {
+		name := scope.Append(protoreflect.Name(m.GetName()))
+		names[name] = struct{}{}
+		for _, f := range m.GetField() {
+			names[name.Append(protoreflect.Name(f.GetName()))] = struct{}{}
+		}
+		for _, f := range m.GetExtension() {
+			names[name.Append(protoreflect.Name(f.GetName()))] = struct{}{}
+		}
+		for _, nested := range m.GetNestedType() {
+			addMessage(name, nested)
+		}
+		for _, e := range m.GetEnumType() {
+			addEnum(name, e)
+		}
+	}
+	for _, m := range fd.GetMessageType() {
+		addMessage(prefix, m)
+	}
+	for _, e := range fd.GetEnumType() {
+		addEnum(prefix, e)
+	}
+	for _, f := range fd.GetExtension() {
+		names[prefix.Append(protoreflect.Name(f.GetName()))] = struct{}{}
+	}
+	for _, s := range fd.GetService() {
+		name := prefix.Append(protoreflect.Name(s.GetName()))
+		names[name] = struct{}{}
+		for _, m := range s.GetMethod() {
+			names[name.Append(protoreflect.Name(m.GetName()))] = struct{}{}
+		}
+	}
+}
+
+// equivalentGeneratedDescriptors reports whether a descriptor embedded in
+// generated code matches the compiled descriptor of the file, ignoring source
+// info and the paths used to refer to the file and its imports.
+func equivalentGeneratedDescriptors(res linker.Result, embedded *descriptorpb.FileDescriptorProto) bool {
+	compiled := proto.Clone(res.FileDescriptorProto()).(*descriptorpb.FileDescriptorProto)
+	embedded = proto.Clone(embedded).(*descriptorpb.FileDescriptorProto)
+	for _, fd := range []*descriptorpb.FileDescriptorProto{compiled, embedded} {
+		fd.Name = nil
+		fd.SourceCodeInfo = nil
+	}
+	if len(compiled.Dependency) == len(embedded.Dependency) {
+		for i, dep := range compiled.Dependency {
+			if strings.HasSuffix(dep, "/"+embedded.Dependency[i]) || strings.HasSuffix(embedded.Dependency[i], "/"+dep) {
+				compiled.Dependency[i] = embedded.Dependency[i]
+			}
+		}
+	}
+	// options are compared after a round trip through the wire format, so
+	// that custom options are represented the same way in both descriptors
+	resolver := linker.ResolverFromFile(res)
+	normalize := func(fd *descriptorpb.FileDescriptorProto) *descriptorpb.FileDescriptorProto {
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(fd)
+		if err != nil {
+			return fd
+		}
+		normalized := &descriptorpb.FileDescriptorProto{}
+		if err := (proto.UnmarshalOptions{Resolver: resolver}).Unmarshal(data, normalized); err != nil {
+			return fd
+		}
+		return normalized
+	}
+	return proto.Equal(normalize(compiled), normalize(embedded))
+}
+
+// fileDiagnosticNode returns the node that diagnostics for a file as a whole
+// are reported on: the syntax or edition declaration, or failing that, the
+// package declaration.
+func fileDiagnosticNode(fileNode *ast.FileNode) ast.Node {
+	if fileNode.Syntax != nil {
+		return fileNode.Syntax
+	}
+	if fileNode.Edition != nil {
+		return fileNode.Edition
+	}
+	for _, decl := range fileNode.Decls {
+		if pkg := decl.GetPackage(); pkg != nil {
+			return pkg
+		}
+	}
+	return fileNode
+}
@@ -0,0 +1,198 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kralicky/protocompile/parser"
+	"github.com/kralicky/protocompile/reporter"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// gitBaseline reads previous revisions of workspace files from git, so that
+// the current contents of a file can be compared against what was committed.
+// Revisions are read ahead of compilation by Prefetch, and lint rules only
+// read from the cache, so that git is never run while results are locked.
+type gitBaseline struct {
+	// if true, git is never run and no revisions are available
+	disabled bool
+
+	mu sync.Mutex
+	// the revision most recently prefetched, and the commit it resolved to.
+	// Only files at this commit are cached.
+	rev    string
+	commit string
+	// keyed by absolute filename
+	files map[string]gitBaselineEntry
+}
+
+type gitBaselineEntry struct {
+	fd  *descriptorpb.FileDescriptorProto
+	err error
+}
+
+// maxGitBaselineFiles bounds the number of files cached at the baseline
+// commit. Once full, arbitrary entries are evicted to make room.
+const maxGitBaselineFiles = 1024
+
+func newGitBaseline(disabled bool) *gitBaseline {
+	return &gitBaseline{
+		disabled: disabled,
+		files:    map[string]gitBaselineEntry{},
+	}
+}
+
+// Prefetch resolves rev, and reads each of the given files at the resulting
+// commit unless it is already cached. The files are expected to belong to the
+// same repository. If rev resolves
+// to a different commit than before, the cache is cleared. Prefetch runs git,
+// so it must not be called with resultsMu held.
+func (b *gitBaseline) Prefetch(ctx context.Context, rev string, filenames []string) {
+	if b.disabled || rev == "" || len(filenames) == 0 {
+		return
+	}
+	commit, err := resolveCommit(ctx, filepath.Dir(filenames[0]), rev)
+	if err != nil {
+		if ctx.Err() == nil {
+			b.mu.Lock()
+			b.setCommitLocked(rev, "")
+			b.mu.Unlock()
+		}
+		return
+	}
+	b.mu.Lock()
+	b.setCommitLocked(rev, commit)
+	var missing []string
+	for _, filename := range filenames {
+		if _, ok := b.files[filename]; !ok {
+			missing = append(missing, filename)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, filename := range missing {
+		fd, err := readFileAtCommit(ctx, filename, commit)
+		if ctx.Err() != nil {
+			return
+		}
+		b.mu.Lock()
+		if b.commit == commit {
+			b.storeLocked(filename, gitBaselineEntry{fd: fd, err: err})
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Cached returns the unlinked descriptor for the given file at the revision
+// most recently prefetched, without running git. If the revision was not
+// prefetched or the file was not found, the returned error wraps
+// os.ErrNotExist.
+func (b *gitBaseline) Cached(filename string, rev string) (*descriptorpb.FileDescriptorProto, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rev != rev || b.commit == "" {
+		return nil, fmt.Errorf("%w: git revision %q has not been resolved", os.ErrNotExist, rev)
+	}
+	entry, ok := b.files[filename]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has not been read at %s", os.ErrNotExist, filename, b.commit)
+	}
+	return entry.fd, entry.err
+}
+
+// FileAtRevision returns the unlinked descriptor for the given file as of the
+// given git revision. If the file is not tracked by git, or did not exist at
+// that revision, the returned error wraps os.ErrNotExist. Unlike Cached, it
+// runs git if needed.
+func (b *gitBaseline) FileAtRevision(ctx context.Context, filename string, rev string) (*descriptorpb.FileDescriptorProto, error) {
+	if b.disabled {
+		return nil, fmt.Errorf("%w: git is disabled in sandbox mode", os.ErrNotExist)
+	}
+	commit, err := resolveCommit(ctx, filepath.Dir(filename), rev)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	if entry, ok := b.files[filename]; ok && b.commit == commit {
+		b.mu.Unlock()
+		return entry.fd, entry.err
+	}
+	b.mu.Unlock()
+
+	fd, err := readFileAtCommit(ctx, filename, commit)
+	if ctx.Err() == nil {
+		b.mu.Lock()
+		if b.commit == commit {
+			b.storeLocked(filename, gitBaselineEntry{fd: fd, err: err})
+		}
+		b.mu.Unlock()
+	}
+	return fd, err
+}
+
+// setCommitLocked records the commit that rev resolved to, clearing the cache
+// if it changed.
+func (b *gitBaseline) setCommitLocked(rev, commit string) {
+	if b.rev == rev && b.commit == commit {
+		return
+	}
+	b.rev, b.commit = rev, commit
+	clear(b.files)
+}
+
+func (b *gitBaseline) storeLocked(filename string, entry gitBaselineEntry) {
+	if _, ok := b.files[filename]; !ok && len(b.files) >= maxGitBaselineFiles {
+		for k := range b.files {
+			delete(b.files, k)
+			break
+		}
+	}
+	b.files[filename] = entry
+}
+
+func resolveCommit(ctx context.Context, dir string, rev string) (string, error) {
+	commit, err := git(ctx, dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("%w: could not resolve git revision %q: %w", os.ErrNotExist, rev, err)
+	}
+	return strings.TrimSpace(commit), nil
+}
+
+func readFileAtCommit(ctx context.Context, filename string, commit string) (*descriptorpb.FileDescriptorProto, error) {
+	contents, err := git(ctx, filepath.Dir(filename), "show", fmt.Sprintf("%s:./%s", commit, filepath.Base(filename)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s at %s: %w", os.ErrNotExist, filename, commit, err)
+	}
+	handler := reporter.NewHandler(nil)
+	fileNode, err := parser.Parse(filename, bytes.NewReader([]byte(contents)), handler, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s at %s: %w", filename, commit, err)
+	}
+	res, err := parser.ResultFromAST(fileNode, false, handler)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s at %s: %w", filename, commit, err)
+	}
+	return res.FileDescriptorProto(), nil
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
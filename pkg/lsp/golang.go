@@ -3,6 +3,8 @@ package lsp
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	goast "go/ast"
 	goparser "go/parser"
@@ -13,17 +15,23 @@ import (
 	"maps"
 	"net/url"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	gsync "github.com/kralicky/gpkg/sync"
 	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
 	"github.com/kralicky/tools-lite/pkg/diff"
 	"github.com/kralicky/tools-lite/pkg/gocommand"
 	"github.com/kralicky/tools-lite/pkg/imports"
 	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
@@ -31,13 +39,51 @@ import (
 type GoLanguageDriver struct {
 	processEnv                *imports.ProcessEnv
 	moduleResolver            *imports.ModuleResolver
-	knownAlternativePackages  [][]diff.Edit
 	localModDir, localModName string
+
+	altPackagesMu            sync.Mutex
+	knownAlternativePackages [][]diff.Edit
+
+	// synthesized descriptors, keyed by the path of the .pb.go file they were
+	// decoded from (without the extension)
+	synthesized gsync.Map[string, *descriptorpb.FileDescriptorProto]
+
+	// descriptors embedded in .pb.go files, keyed by filename
+	embedded gsync.Map[string, embeddedDescriptor]
+
+	// .pb.go files in the local module, keyed by the source path recorded in
+	// their preamble. Built on first use, and cleared when the modules are
+	// refreshed.
+	generatedIndexMu sync.Mutex
+	generatedIndex   map[string][]string
+
+	// versions of each module in the requirement graph of the local module.
+	// Built on first use, and cleared when the modules are refreshed.
+	moduleGraphMu sync.Mutex
+	moduleGraph   map[string][]string
 }
 
 var requiredGoEnvVars = []string{"GO111MODULE", "GOFLAGS", "GOINSECURE", "GOMOD", "GOMODCACHE", "GONOPROXY", "GONOSUMDB", "GOPATH", "GOPROXY", "GOROOT", "GOSUMDB", "GOWORK"}
 
+// NewGoLanguageDriver returns a driver for the Go module containing workdir,
+// or nil if the go command is not available.
 func NewGoLanguageDriver(workdir string) *GoLanguageDriver {
+	driver, err := newGoLanguageDriver(workdir)
+	if err != nil {
+		slog.Warn("go language driver unavailable", "error", err)
+		return nil
+	}
+	return driver
+}
+
+// ErrGoToolchainUnavailable is returned by newGoLanguageDriver when the go
+// command cannot be found or run.
+var ErrGoToolchainUnavailable = errors.New("go toolchain unavailable")
+
+func newGoLanguageDriver(workdir string) (*GoLanguageDriver, error) {
+	if _, err := exec.LookPath("go"); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrGoToolchainUnavailable, err)
+	}
 	env := map[string]string{}
 	for _, key := range requiredGoEnvVars {
 		if v, ok := os.LookupEnv(key); ok {
@@ -51,9 +97,10 @@ func NewGoLanguageDriver(workdir string) *GoLanguageDriver {
 		WorkingDir:  workdir,
 	}
 	res, err := procEnv.GetResolver()
-	if err != nil || res == nil {
-		slog.Warn("failed to create module resolver", "error", err)
-		return nil
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrGoToolchainUnavailable, err)
+	} else if res == nil {
+		return nil, fmt.Errorf("%w: no module resolver", ErrGoToolchainUnavailable)
 	}
 	resolver := res.(*imports.ModuleResolver)
 	modDir, modName := resolver.ModInfo(workdir)
@@ -63,11 +110,64 @@ func NewGoLanguageDriver(workdir string) *GoLanguageDriver {
 		moduleResolver: resolver,
 		localModDir:    modDir,
 		localModName:   modName,
+	}, nil
+}
+
+// GoToolchainWarning returns a message describing the features which are
+// unavailable because the go command could not be run, or an empty string if
+// the go command is available or not needed. The go command is only needed
+// for workspaces within a Go module, and is never run in sandbox mode.
+func (c *Cache) GoToolchainWarning() string {
+	err := c.resolver.goLanguageDriverErr
+	if err == nil || !hasGoModFile(uriPath(protocol.DocumentURI(c.workspace.URI))) {
+		return ""
+	}
+	return fmt.Sprintf("protols: %v. Imports from Go modules and features which use generated Go code are unavailable in %s; formatting, diagnostics, and navigation within the workspace are unaffected.",
+		err, c.workspace.Name)
+}
+
+// hasGoModFile reports whether dir or one of its parents contains a go.mod
+// file. Unlike the go command, it does not consider GOWORK or GOFLAGS.
+func hasGoModFile(dir string) bool {
+	for dir != "" {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
 	}
+	return false
 }
 
 func (s *GoLanguageDriver) RefreshModules() {
 	s.moduleResolver.ClearForNewScan()
+	s.synthesized.Range(func(key string, _ *descriptorpb.FileDescriptorProto) bool {
+		s.synthesized.Delete(key)
+		return true
+	})
+	s.embedded.Range(func(key string, _ embeddedDescriptor) bool {
+		s.embedded.Delete(key)
+		return true
+	})
+	s.generatedIndexMu.Lock()
+	s.generatedIndex = nil
+	s.generatedIndexMu.Unlock()
+	s.moduleGraphMu.Lock()
+	s.moduleGraph = nil
+	s.moduleGraphMu.Unlock()
+}
+
+// ForgetImport removes the descriptor synthesized for the given import from
+// the cache, so that it is decoded again from the generated code.
+func (s *GoLanguageDriver) ForgetImport(importName string) {
+	res, err := s.ImportFromGoModule(importName)
+	if err != nil {
+		return
+	}
+	s.synthesized.Delete(synthesizedKey(importName, res))
 }
 
 func (s *GoLanguageDriver) HasGoModule() bool {
@@ -91,16 +191,18 @@ func (f ParsedGoFile) Position(pos token.Pos) protocol.Position {
 	}
 }
 
-func (s *GoLanguageDriver) FindGeneratedFiles(uri protocol.DocumentURI, fileOpts *descriptorpb.FileOptions, matchSourcePath string) ([]ParsedGoFile, error) {
-	pkgPath := fileOpts.GetGoPackage()
+// GoPackagePath returns the import path and package name alias of the Go
+// package that code generated from the given file belongs to, as declared by
+// its go_package option or implied by its location in the local module.
+func (s *GoLanguageDriver) GoPackagePath(uri protocol.DocumentURI, fileOpts *descriptorpb.FileOptions) (pkgPath string, pkgNameAlias string, _ error) {
+	pkgPath = fileOpts.GetGoPackage()
 	if pkgPath == "" && uri.IsFile() {
 		var err error
 		pkgPath, err = s.ImplicitGoPackagePath(uri.Path())
 		if err != nil {
-			return nil, err
+			return "", "", err
 		}
 	}
-	var pkgNameAlias string
 	if strings.Contains(pkgPath, ";") {
 		// path/to/package;alias
 		pkgPath, pkgNameAlias, _ = strings.Cut(pkgPath, ";")
@@ -108,10 +210,18 @@ func (s *GoLanguageDriver) FindGeneratedFiles(uri protocol.DocumentURI, fileOpts
 		// alias only
 		implicitPath, err := s.ImplicitGoPackagePath(uri.Path())
 		if err != nil {
-			return nil, err
+			return "", "", err
 		}
 		pkgPath, pkgNameAlias = implicitPath, pkgPath
 	}
+	return pkgPath, pkgNameAlias, nil
+}
+
+func (s *GoLanguageDriver) FindGeneratedFiles(uri protocol.DocumentURI, fileOpts *descriptorpb.FileOptions, matchSourcePath string) ([]ParsedGoFile, error) {
+	pkgPath, pkgNameAlias, err := s.GoPackagePath(uri, fileOpts)
+	if err != nil {
+		return nil, err
+	}
 	mod, dir := s.moduleResolver.FindPackage(pkgPath)
 	if mod == nil {
 		return nil, fmt.Errorf("no package found for %s", pkgPath)
@@ -162,6 +272,193 @@ func (s *GoLanguageDriver) FindGeneratedFiles(uri protocol.DocumentURI, fileOpts
 	return res, nil
 }
 
+type embeddedDescriptor struct {
+	modTime time.Time
+	size    int64
+	fd      *descriptorpb.FileDescriptorProto
+}
+
+// EmbeddedDescriptor decodes the file descriptor embedded in a generated
+// .pb.go file. Descriptors are cached until the file is modified.
+func (s *GoLanguageDriver) EmbeddedDescriptor(filename string) (*descriptorpb.FileDescriptorProto, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := s.embedded.Load(filename); ok && e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+		return e.fd, nil
+	}
+	f, err := goparser.ParseFile(token.NewFileSet(), filename, nil, goparser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	preamble, ok := ParseGeneratedPreamble(f)
+	if !ok || preamble.Source == "" {
+		return nil, fmt.Errorf("%s: not a generated file", filename)
+	}
+	object := lookupRawDesc(f, preamble.Source)
+	if object == nil {
+		return nil, fmt.Errorf("%w: could not find file descriptor in %s", os.ErrNotExist, filename)
+	}
+	fd, err := decodeRawDesc(object)
+	if err != nil {
+		return nil, err
+	}
+	s.embedded.Store(filename, embeddedDescriptor{modTime: info.ModTime(), size: info.Size(), fd: fd})
+	return fd, nil
+}
+
+// ParseGoPackage parses the non-test Go source files in the package with the
+// given import path.
+func (s *GoLanguageDriver) ParseGoPackage(pkgPath string) ([]ParsedGoFile, error) {
+	mod, dir := s.moduleResolver.FindPackage(pkgPath)
+	if mod == nil {
+		return nil, fmt.Errorf("no package found for %s", pkgPath)
+	}
+	fset := token.NewFileSet()
+	pkgs, err := goparser.ParseDir(fset, dir, func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, goparser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var res []ParsedGoFile
+	for _, pkg := range pkgs {
+		for filename, f := range pkg.Files {
+			res = append(res, ParsedGoFile{
+				File:     f,
+				Fset:     fset,
+				Filename: filename,
+			})
+		}
+	}
+	return res, nil
+}
+
+// FindGeneratedPackages returns the import paths of the packages in the local
+// module which contain code generated from the proto file with the given
+// import path. The local module is only scanned once; files which have since
+// been deleted are ignored, but new files are only found after the modules are
+// refreshed.
+func (s *GoLanguageDriver) FindGeneratedPackages(sourcePath string) []string {
+	var pkgPaths []string
+	for _, filename := range s.FindGeneratedFilenames(sourcePath) {
+		rel, err := filepath.Rel(s.localModDir, filepath.Dir(filename))
+		if err != nil {
+			continue
+		}
+		pkgPath := path.Join(s.localModName, filepath.ToSlash(rel))
+		if !slices.Contains(pkgPaths, pkgPath) {
+			pkgPaths = append(pkgPaths, pkgPath)
+		}
+	}
+	slices.Sort(pkgPaths)
+	return pkgPaths
+}
+
+// FindGeneratedFilenames returns the .pb.go files in the local module which
+// were generated from the proto file with the given import path. See
+// FindGeneratedPackages.
+func (s *GoLanguageDriver) FindGeneratedFilenames(sourcePath string) []string {
+	s.generatedIndexMu.Lock()
+	if s.generatedIndex == nil {
+		s.generatedIndex = s.indexGeneratedFiles()
+	}
+	filenames := s.generatedIndex[sourcePath]
+	s.generatedIndexMu.Unlock()
+
+	var existing []string
+	for _, filename := range filenames {
+		if _, err := os.Stat(filename); err == nil {
+			existing = append(existing, filename)
+		}
+	}
+	return existing
+}
+
+func (s *GoLanguageDriver) indexGeneratedFiles() map[string][]string {
+	index := map[string][]string{}
+	filepath.WalkDir(s.localModDir, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if filename != s.localModDir && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			if filename != s.localModDir {
+				// nested modules are not part of the local module
+				if _, err := os.Stat(filepath.Join(filename, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if !strings.HasSuffix(filename, ".pb.go") || strings.HasSuffix(filename, "_test.go") {
+			return nil
+		}
+		f, err := goparser.ParseFile(token.NewFileSet(), filename, nil, goparser.PackageClauseOnly|goparser.ParseComments)
+		if err != nil {
+			return nil
+		}
+		if preamble, ok := ParseGeneratedPreamble(f); ok && preamble.Source != "" {
+			index[preamble.Source] = append(index[preamble.Source], filename)
+		}
+		return nil
+	})
+	return index
+}
+
+// ModuleVersions returns the versions of the module with the given path which
+// are required anywhere in the requirement graph of the local module, in
+// semver order. Only one of these versions is selected for the build; more
+// than one version means that some dependencies require an older version of
+// the module than the one selected.
+func (s *GoLanguageDriver) ModuleVersions(modulePath string) ([]string, error) {
+	s.moduleGraphMu.Lock()
+	defer s.moduleGraphMu.Unlock()
+	if s.moduleGraph == nil {
+		env := make([]string, 0, len(s.processEnv.Env))
+		for k, v := range s.processEnv.Env {
+			env = append(env, k+"="+v)
+		}
+		stdout, err := s.processEnv.GocmdRunner.Run(context.Background(), gocommand.Invocation{
+			Verb:       "mod",
+			Args:       []string{"graph"},
+			Env:        env,
+			WorkingDir: s.localModDir,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.moduleGraph = parseModuleGraph(stdout.Bytes())
+	}
+	return s.moduleGraph[modulePath], nil
+}
+
+// parseModuleGraph parses the output of 'go mod graph', returning the
+// versions of each module which appear in the graph. The main module, which
+// has no version, is omitted.
+func parseModuleGraph(data []byte) map[string][]string {
+	graph := map[string][]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		for _, node := range strings.Fields(line) {
+			modPath, version, ok := strings.Cut(node, "@")
+			if !ok || modPath == "go" || modPath == "toolchain" {
+				continue
+			}
+			if !slices.Contains(graph[modPath], version) {
+				graph[modPath] = append(graph[modPath], version)
+			}
+		}
+	}
+	for _, versions := range graph {
+		semver.Sort(versions)
+	}
+	return graph
+}
+
 type GoModuleImportResults struct {
 	Module       *gocommand.ModuleJSON
 	DirInModule  string
@@ -189,7 +486,10 @@ func (s *GoLanguageDriver) ImportFromGoModule(importName string) (GoModuleImport
 	var knownAltPath string
 	pkgData, dir := s.moduleResolver.FindPackage(importPath)
 	if pkgData == nil || dir == "" {
-		for _, edits := range s.knownAlternativePackages {
+		s.altPackagesMu.Lock()
+		altPackages := slices.Clone(s.knownAlternativePackages)
+		s.altPackagesMu.Unlock()
+		for _, edits := range altPackages {
 			edited, err := diff.Apply(importPath, edits)
 			if err == nil {
 				pkgData, dir = s.moduleResolver.FindPackage(edited)
@@ -235,7 +535,44 @@ func (s *GoLanguageDriver) ImplicitGoPackagePath(filename string) (string, error
 	return path.Join(s.localModName, path.Dir(relativePath)), nil
 }
 
-func (s *GoLanguageDriver) SynthesizeFromGoSource(importName string, res GoModuleImportResults) (desc *descriptorpb.FileDescriptorProto, _err error) {
+// SynthesizeFromGoSource decodes the file descriptor embedded in the generated
+// Go code for the given import. Descriptors are cached until the modules are
+// refreshed.
+func (s *GoLanguageDriver) SynthesizeFromGoSource(importName string, res GoModuleImportResults) (*descriptorpb.FileDescriptorProto, error) {
+	key := synthesizedKey(importName, res)
+	fd, ok := s.synthesized.Load(key)
+	if !ok {
+		var err error
+		fd, err = s.synthesizeFromGoSource(importName, res)
+		if err != nil {
+			return nil, err
+		}
+		s.synthesized.Store(key, fd)
+	}
+	if fd.GetName() != importName {
+		// this package uses an alternate import path. we need to keep track of this
+		// in case any of its dependencies use a similar path structure.
+		alternateImportPath := fd.GetName()
+		resolvedImportPath := importName
+		edits := diff.Strings(alternateImportPath, resolvedImportPath)
+		s.altPackagesMu.Lock()
+		if !slices.ContainsFunc(s.knownAlternativePackages, func(known []diff.Edit) bool {
+			return slices.Equal(known, edits)
+		}) {
+			s.knownAlternativePackages = append(s.knownAlternativePackages, edits)
+		}
+		s.altPackagesMu.Unlock()
+	}
+	return proto.Clone(fd).(*descriptorpb.FileDescriptorProto), nil
+}
+
+// synthesizedKey returns the key of the descriptor synthesized for the given
+// import: the path of the generated code without its extension.
+func synthesizedKey(importName string, res GoModuleImportResults) string {
+	return filepath.Join(res.DirInModule, strings.TrimSuffix(path.Base(importName), ".proto"))
+}
+
+func (s *GoLanguageDriver) synthesizeFromGoSource(importName string, res GoModuleImportResults) (desc *descriptorpb.FileDescriptorProto, _err error) {
 	// buckle up
 	fset := token.NewFileSet()
 	packages, err := goparser.ParseDir(fset, res.DirInModule, func(fi fs.FileInfo) bool {
@@ -291,9 +628,7 @@ PACKAGES:
 			}
 
 			// found a possible match, check if there's a symbol with the right name
-			symbolName := fmt.Sprintf("file_%s_rawDesc", strings.ReplaceAll(strings.ReplaceAll(preamble.Source, "/", "_"), ".", "_"))
-			object := f.Scope.Lookup(symbolName)
-			if object != nil && (object.Kind == goast.Var || object.Kind == goast.Con) {
+			if object := lookupRawDesc(f, preamble.Source); object != nil {
 				// found it!
 				rawDescByteArray = object
 				break PACKAGES
@@ -303,7 +638,21 @@ PACKAGES:
 	if rawDescByteArray == nil {
 		return nil, fmt.Errorf("%w: %s", os.ErrNotExist, "could not find file descriptor in package")
 	}
+	return decodeRawDesc(rawDescByteArray)
+}
 
+// lookupRawDesc returns the variable holding the raw file descriptor in a
+// generated .pb.go file, given the source path from the file's preamble.
+func lookupRawDesc(f *goast.File, source string) *goast.Object {
+	symbolName := fmt.Sprintf("file_%s_rawDesc", strings.ReplaceAll(strings.ReplaceAll(source, "/", "_"), ".", "_"))
+	object := f.Scope.Lookup(symbolName)
+	if object != nil && (object.Kind == goast.Var || object.Kind == goast.Con) {
+		return object
+	}
+	return nil
+}
+
+func decodeRawDesc(rawDescByteArray *goast.Object) (*descriptorpb.FileDescriptorProto, error) {
 	// there are two possible formats for the raw descriptor:
 	// 1: byte array (old style)
 	// 2: strings (new style)
@@ -364,14 +713,6 @@ PACKAGES:
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", os.ErrNotExist, err)
 	}
-	if fd.GetName() != importName {
-		// this package uses an alternate import path. we need to keep track of this
-		// in case any of its dependencies use a similar path structure.
-		alternateImportPath := fd.GetName()
-		resolvedImportPath := importName
-		edits := diff.Strings(alternateImportPath, resolvedImportPath)
-		s.knownAlternativePackages = append(s.knownAlternativePackages, edits)
-	}
 	return fd, nil
 }
 
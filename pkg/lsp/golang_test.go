@@ -0,0 +1,50 @@
+package lsp
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseModuleGraph(t *testing.T) {
+	graph := parseModuleGraph([]byte(`example.com/app go@1.23.0
+example.com/app google.golang.org/genproto@v0.0.0-20240401170217-c3f982113cda
+example.com/app google.golang.org/grpc@v1.63.0
+google.golang.org/grpc@v1.63.0 google.golang.org/genproto@v0.0.0-20230410155749-daa745c078e1
+google.golang.org/grpc@v1.63.0 google.golang.org/protobuf@v1.33.0
+google.golang.org/grpc@v1.63.0 toolchain@go1.22.1
+google.golang.org/genproto@v0.0.0-20230410155749-daa745c078e1 google.golang.org/protobuf@v1.33.0
+`))
+	want := map[string][]string{
+		"google.golang.org/genproto": {"v0.0.0-20230410155749-daa745c078e1", "v0.0.0-20240401170217-c3f982113cda"},
+		"google.golang.org/grpc":     {"v1.63.0"},
+		"google.golang.org/protobuf": {"v1.33.0"},
+	}
+	if len(graph) != len(want) {
+		t.Fatalf("got %d modules, want %d: %v", len(graph), len(want), graph)
+	}
+	for path, versions := range want {
+		if !slices.Equal(graph[path], versions) {
+			t.Errorf("%s: got versions %v, want %v", path, graph[path], versions)
+		}
+	}
+}
+
+func TestFileInfoMarkdownMultipleVersions(t *testing.T) {
+	info := FileInfo{
+		Path:   "google/api/annotations.proto",
+		Source: "synthetic",
+		GoModule: &GoModuleInfo{
+			Path:             "google.golang.org/genproto/googleapis/api",
+			Version:          "v0.2.0",
+			RequiredVersions: []string{"v0.1.0", "v0.2.0"},
+		},
+	}
+	md := fileInfoMarkdown(info)
+	if !strings.Contains(md, "- go module: `google.golang.org/genproto/googleapis/api@v0.2.0`\n") {
+		t.Errorf("missing module version:\n%s", md)
+	}
+	if !strings.Contains(md, "multiple versions of `google.golang.org/genproto/googleapis/api` are required in the build graph (v0.1.0, v0.2.0); only v0.2.0 is used") {
+		t.Errorf("missing multiple versions warning:\n%s", md)
+	}
+}
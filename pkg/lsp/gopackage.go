@@ -0,0 +1,99 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// lintGoPackageDrift reports files whose generated Go code exists in the local
+// module, but not in the package named by the file's go_package option. This
+// usually happens when a proto file or its go_package is changed without
+// regenerating code, leaving Go code which imports the old package building
+// against stale types (or not at all, once the stale code is deleted).
+func lintGoPackageDrift(_ context.Context, p *lintPass) {
+	driver := p.cache.resolver.goLanguageDriver
+	if !driver.HasGoModule() {
+		return
+	}
+	uri, err := p.cache.resolver.PathToURI(p.result.Path())
+	if err != nil || !uri.IsFile() {
+		return
+	}
+	var found []string
+	for _, sourcePath := range generatedSourcePaths(driver, uri, p.result.Path()) {
+		if found = driver.FindGeneratedPackages(sourcePath); len(found) > 0 {
+			break
+		}
+	}
+	if len(found) == 0 {
+		return
+	}
+	opts := p.result.FileDescriptorProto().GetOptions()
+	pkgPath, alias, err := driver.GoPackagePath(uri, opts)
+	if err != nil {
+		return
+	}
+	for _, f := range found {
+		if f == pkgPath {
+			return
+		}
+	}
+	if generated, err := driver.FindGeneratedFiles(uri, opts, p.result.Path()); err == nil && len(generated) > 0 {
+		// generated since the local module was indexed
+		return
+	}
+
+	fileNode := p.result.AST()
+	var node ast.Node
+	var goPackageOpt *ast.OptionNode
+	for _, decl := range fileNode.Decls {
+		if opt := decl.GetOption(); opt != nil && !opt.IsIncomplete() && len(opt.Name.Parts) == 1 {
+			fieldRef := opt.Name.Parts[0].GetFieldRef()
+			if fieldRef.GetName().AsIdentifier() == "go_package" && !fieldRef.IsExtension() {
+				goPackageOpt = opt
+				node = opt.Val
+				break
+			}
+		}
+		if pkg := decl.GetPackage(); pkg != nil && node == nil {
+			node = pkg
+		}
+	}
+	if node == nil {
+		return
+	}
+	d := p.report(node, "generated code for this file is in package %s, but go_package refers to %s",
+		strings.Join(found, ", "), pkgPath)
+	if goPackageOpt == nil || len(found) != 1 {
+		return
+	}
+	newValue := found[0]
+	if alias != "" {
+		newValue += ";" + alias
+	}
+	d.CodeActions = append(d.CodeActions, CodeAction{
+		Title: "Change go_package to " + strconv.Quote(newValue),
+		Path:  p.result.Path(),
+		Kind:  protocol.QuickFix,
+		Edits: []protocol.TextEdit{{
+			Range:   toRange(fileNode.NodeInfo(goPackageOpt.Val)),
+			NewText: strconv.Quote(newValue),
+		}},
+	})
+}
+
+// generatedSourcePaths returns the paths that generated code may use to refer
+// to a file in its preamble. Depending on the include paths used, this is
+// either the file's import path or its path relative to the local module.
+func generatedSourcePaths(driver *GoLanguageDriver, uri protocol.DocumentURI, path string) []string {
+	paths := []string{path}
+	if rel, err := filepath.Rel(driver.localModDir, uri.Path()); err == nil && filepath.ToSlash(rel) != path {
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	return paths
+}
@@ -0,0 +1,353 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	"go/token"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// MessageFromGoStruct generates a message equivalent to a Go struct, and
+// returns an edit which inserts it at the given location. The struct is either
+// parsed from the given Go source, or looked up by its qualified name (e.g.
+// "example.com/foo/bar.Baz") in the workspace's Go module. Other structs
+// declared alongside it which it refers to are converted as well.
+func (c *Cache) MessageFromGoStruct(ctx context.Context, params protocol.TextDocumentPositionParams, source string, typeName string) (*protocol.WorkspaceEdit, error) {
+	var types map[string]*goast.StructType
+	var err error
+	switch {
+	case source != "":
+		var names []string
+		types, names, err = parseGoStructs(source)
+		if err != nil {
+			return nil, err
+		}
+		if typeName == "" {
+			typeName = names[0]
+		}
+	case typeName != "":
+		pkgPath, name, ok := cutLast(typeName, ".")
+		if !ok {
+			return nil, fmt.Errorf("expected a qualified type name, got %q", typeName)
+		}
+		if !c.resolver.goLanguageDriver.HasGoModule() {
+			return nil, errors.New("go language driver not available for workspace")
+		}
+		files, err := c.resolver.goLanguageDriver.ParseGoPackage(pkgPath)
+		if err != nil {
+			return nil, err
+		}
+		types = map[string]*goast.StructType{}
+		for _, f := range files {
+			collectGoStructs(f.File, types)
+		}
+		typeName = name
+	default:
+		return nil, errors.New("either a Go source or type name is required")
+	}
+
+	conv := &goStructConverter{types: types}
+	if _, ok := types[typeName]; !ok {
+		return nil, fmt.Errorf("struct %s not found", typeName)
+	}
+	conv.queue = append(conv.queue, typeName)
+
+	var messages []string
+	for i := 0; i < len(conv.queue); i++ {
+		lines, err := conv.messageDecl(conv.queue[i], types[conv.queue[i]])
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, strings.Join(lines, "\n"))
+	}
+
+	linkRes, err := c.FindResultOrPartialResultByURI(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	edits := []protocol.TextEdit{
+		{
+			Range:   protocol.Range{Start: params.Position, End: params.Position},
+			NewText: indentTextHanging(strings.Join(messages, "\n\n"), int(params.Position.Character)),
+		},
+	}
+	imports := linkRes.Imports()
+IMPORTS:
+	for _, path := range conv.imports {
+		for i := range imports.Len() {
+			if imports.Get(i).Path() == path {
+				continue IMPORTS
+			}
+		}
+		edits = append(edits, editAddImport(linkRes, path))
+	}
+	return &protocol.WorkspaceEdit{
+		DocumentChanges: protocol.TextEditsToDocumentChanges(params.TextDocument.URI, linkRes.AST().Version(), edits),
+	}, nil
+}
+
+// parseGoStructs parses a pasted snippet of Go source containing one or more
+// struct type declarations, and returns the structs along with their names in
+// declaration order. The package clause is optional.
+func parseGoStructs(source string) (map[string]*goast.StructType, []string, error) {
+	fset := token.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", source, goparser.SkipObjectResolution)
+	if err != nil {
+		var perr error
+		f, perr = goparser.ParseFile(fset, "", "package p\n"+source, goparser.SkipObjectResolution)
+		if perr != nil {
+			return nil, nil, fmt.Errorf("invalid Go source: %w", err)
+		}
+	}
+	types := map[string]*goast.StructType{}
+	names := collectGoStructs(f, types)
+	if len(names) == 0 {
+		return nil, nil, errors.New("no struct types found in Go source")
+	}
+	return types, names, nil
+}
+
+func collectGoStructs(f *goast.File, types map[string]*goast.StructType) (names []string) {
+	for _, decl := range f.Decls {
+		genDecl, ok := decl.(*goast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec := spec.(*goast.TypeSpec)
+			if st, ok := typeSpec.Type.(*goast.StructType); ok {
+				types[typeSpec.Name.Name] = st
+				names = append(names, typeSpec.Name.Name)
+			}
+		}
+	}
+	return
+}
+
+var goScalarTypes = map[string]string{
+	"string":  "string",
+	"bool":    "bool",
+	"int":     "int64",
+	"int8":    "int32",
+	"int16":   "int32",
+	"int32":   "int32",
+	"rune":    "int32",
+	"int64":   "int64",
+	"uint":    "uint64",
+	"uint8":   "uint32",
+	"byte":    "uint32",
+	"uint16":  "uint32",
+	"uint32":  "uint32",
+	"uint64":  "uint64",
+	"uintptr": "uint64",
+	"float32": "float",
+	"float64": "double",
+}
+
+var goWellKnownTypes = map[string][2]string{
+	"time.Time":     {"google.protobuf.Timestamp", "google/protobuf/timestamp.proto"},
+	"time.Duration": {"google.protobuf.Duration", "google/protobuf/duration.proto"},
+	"any":           {"google.protobuf.Value", "google/protobuf/struct.proto"},
+	"interface{}":   {"google.protobuf.Value", "google/protobuf/struct.proto"},
+}
+
+type goStructConverter struct {
+	types   map[string]*goast.StructType
+	queue   []string
+	imports []string
+}
+
+type goFieldType struct {
+	name     string
+	repeated bool
+	optional bool
+	isMap    bool
+	scalar   bool
+}
+
+func (c *goStructConverter) messageDecl(name string, st *goast.StructType) ([]string, error) {
+	gen := newFieldGenerator(nil)
+	lines := []string{fmt.Sprintf("message %s {", name)}
+	fields, err := c.fields(st, gen)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	for _, line := range append(fields, gen.nestedMessages...) {
+		if line == "" {
+			lines = append(lines, "")
+		} else {
+			lines = append(lines, "  "+line)
+		}
+	}
+	return append(lines, "}"), nil
+}
+
+func (c *goStructConverter) fields(st *goast.StructType, gen *fieldGenerator) ([]string, error) {
+	var lines []string
+	for _, field := range st.Fields.List {
+		var jsonName string
+		if field.Tag != nil {
+			if tag, err := strconv.Unquote(field.Tag.Value); err == nil {
+				jsonName, _, _ = strings.Cut(reflect.StructTag(tag).Get("json"), ",")
+			}
+		}
+		if jsonName == "-" {
+			continue
+		}
+		names := field.Names
+		if len(names) == 0 {
+			// embedded struct; inline its fields if it is known
+			ident, ok := unwrapStar(field.Type).(*goast.Ident)
+			if ok && jsonName == "" {
+				if embedded, ok := c.types[ident.Name]; ok {
+					embeddedLines, err := c.fields(embedded, gen)
+					if err != nil {
+						return nil, err
+					}
+					lines = append(lines, embeddedLines...)
+					continue
+				}
+			}
+			if ok {
+				names = []*goast.Ident{ident}
+			} else if sel, ok := unwrapStar(field.Type).(*goast.SelectorExpr); ok {
+				names = []*goast.Ident{sel.Sel}
+			} else {
+				continue
+			}
+		}
+		for _, ident := range names {
+			if !ident.IsExported() {
+				continue
+			}
+			fieldName := gen.uniqueName(protoFieldName(ident.Name))
+			ft, err := c.fieldType(field.Type, ident.Name, gen)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", ident.Name, err)
+			}
+			number, err := gen.number()
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", ident.Name, err)
+			}
+			var decl strings.Builder
+			switch {
+			case ft.repeated:
+				decl.WriteString("repeated ")
+			case ft.optional:
+				decl.WriteString("optional ")
+			}
+			fmt.Fprintf(&decl, "%s %s = %d", ft.name, fieldName, number)
+			if jsonName != "" && defaultJSONName(fieldName) != jsonName {
+				fmt.Fprintf(&decl, " [json_name = %s]", strconv.Quote(jsonName))
+			}
+			decl.WriteString(";")
+			lines = append(lines, decl.String())
+		}
+	}
+	return lines, nil
+}
+
+func (c *goStructConverter) fieldType(expr goast.Expr, goFieldName string, gen *fieldGenerator) (goFieldType, error) {
+	switch expr := expr.(type) {
+	case *goast.StarExpr:
+		ft, err := c.fieldType(expr.X, goFieldName, gen)
+		if err != nil {
+			return ft, err
+		}
+		if ft.scalar {
+			ft.optional = true
+		}
+		return ft, nil
+	case *goast.ArrayType:
+		if ident, ok := expr.Elt.(*goast.Ident); ok && (ident.Name == "byte" || ident.Name == "uint8") {
+			return goFieldType{name: "bytes", scalar: true}, nil
+		}
+		ft, err := c.fieldType(expr.Elt, goFieldName, gen)
+		if err != nil {
+			return ft, err
+		}
+		if ft.repeated || ft.isMap {
+			return ft, errors.New("nested lists and maps cannot be represented as a protobuf field")
+		}
+		ft.repeated = true
+		ft.optional = false
+		return ft, nil
+	case *goast.MapType:
+		key, err := c.fieldType(expr.Key, goFieldName, gen)
+		if err != nil {
+			return key, err
+		}
+		if !key.scalar || key.name == "float" || key.name == "double" || key.name == "bytes" {
+			return key, fmt.Errorf("unsupported map key type %s", key.name)
+		}
+		value, err := c.fieldType(expr.Value, goFieldName, gen)
+		if err != nil {
+			return value, err
+		}
+		if value.repeated || value.isMap {
+			return value, errors.New("nested lists and maps cannot be represented as a protobuf field")
+		}
+		return goFieldType{name: fmt.Sprintf("map<%s, %s>", key.name, value.name), isMap: true}, nil
+	case *goast.StructType:
+		// anonymous struct; declare it as a nested message
+		name := gen.uniqueName(protoMessageName(goFieldName))
+		lines, err := c.messageDecl(name, expr)
+		if err != nil {
+			return goFieldType{}, err
+		}
+		gen.nestedMessages = append(gen.nestedMessages, "")
+		gen.nestedMessages = append(gen.nestedMessages, lines...)
+		return goFieldType{name: name}, nil
+	case *goast.InterfaceType:
+		return c.wellKnownType("interface{}"), nil
+	case *goast.SelectorExpr:
+		if pkg, ok := expr.X.(*goast.Ident); ok {
+			if _, ok := goWellKnownTypes[pkg.Name+"."+expr.Sel.Name]; ok {
+				return c.wellKnownType(pkg.Name + "." + expr.Sel.Name), nil
+			}
+		}
+		return goFieldType{name: expr.Sel.Name}, nil
+	case *goast.Ident:
+		if scalar, ok := goScalarTypes[expr.Name]; ok {
+			return goFieldType{name: scalar, scalar: true}, nil
+		}
+		if _, ok := goWellKnownTypes[expr.Name]; ok {
+			return c.wellKnownType(expr.Name), nil
+		}
+		if _, ok := c.types[expr.Name]; ok && !slices.Contains(c.queue, expr.Name) {
+			c.queue = append(c.queue, expr.Name)
+		}
+		return goFieldType{name: expr.Name}, nil
+	}
+	return goFieldType{}, fmt.Errorf("unsupported type %T", expr)
+}
+
+func (c *goStructConverter) wellKnownType(goName string) goFieldType {
+	wkt := goWellKnownTypes[goName]
+	if !slices.Contains(c.imports, wkt[1]) {
+		c.imports = append(c.imports, wkt[1])
+	}
+	return goFieldType{name: wkt[0]}
+}
+
+func unwrapStar(expr goast.Expr) goast.Expr {
+	if star, ok := expr.(*goast.StarExpr); ok {
+		return star.X
+	}
+	return expr
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
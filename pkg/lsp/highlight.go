@@ -0,0 +1,143 @@
+package lsp
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/parser"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// tagRange is a half-open range of field numbers.
+type tagRange struct {
+	start, end int32
+}
+
+func (r tagRange) contains(number int32) bool {
+	return number >= r.start && number < r.end
+}
+
+func (r tagRange) overlaps(other tagRange) bool {
+	return r.start < other.end && other.start < r.end
+}
+
+// ComputeDocumentHighlights highlights the field numbers covered by the
+// extension range or reserved range at the given position. The range itself
+// is highlighted as text. Fields of the message, and other extension or
+// reserved ranges, whose numbers illegally fall within the range are
+// highlighted as writes; these are also reported as errors by the compiler.
+// Extensions declared in the same file whose numbers fall within an extension
+// range are highlighted as reads.
+func (c *Cache) ComputeDocumentHighlights(snapshot *Snapshot, params protocol.DocumentHighlightParams) ([]protocol.DocumentHighlight, error) {
+	// linked results have fully qualified extendees, but the parse result is
+	// enough for everything else
+	var parseRes parser.Result
+	if res, err := snapshot.FindResultOrPartialResultByURI(params.TextDocument.URI); err == nil {
+		parseRes = res
+	} else if parseRes, err = snapshot.FindParseResultByURI(params.TextDocument.URI); err != nil {
+		return nil, err
+	}
+	fileNode := parseRes.AST()
+	if fileNode == nil {
+		return nil, nil
+	}
+	pos := params.Position
+	nodeRange := func(n ast.Node) protocol.Range {
+		return toRange(fileNode.NodeInfo(n))
+	}
+	atPosition := func(n ast.Node) bool {
+		return n != nil && rangeContains(nodeRange(n), protocol.Range{Start: pos, End: pos})
+	}
+
+	var highlights []protocol.DocumentHighlight
+	add := func(n ast.Node, kind protocol.DocumentHighlightKind) {
+		if n != nil {
+			highlights = append(highlights, protocol.DocumentHighlight{Range: nodeRange(n), Kind: kind})
+		}
+	}
+
+	fdp := parseRes.FileDescriptorProto()
+	var visit func(prefix string, messages []*descriptorpb.DescriptorProto) bool
+	visit = func(prefix string, messages []*descriptorpb.DescriptorProto) bool {
+		for _, md := range messages {
+			fullName := prefix + md.GetName()
+			for _, er := range md.GetExtensionRange() {
+				node := parseRes.ExtensionRangeNode(er)
+				if !atPosition(node) {
+					continue
+				}
+				selected := tagRange{er.GetStart(), er.GetEnd()}
+				add(node, protocol.Text)
+				highlightRangeConflicts(parseRes, md, node, selected, add)
+				for _, ext := range extensionsInFile(fdp) {
+					if strings.TrimPrefix(ext.GetExtendee(), ".") == fullName && selected.contains(ext.GetNumber()) {
+						if fieldNode := parseRes.FieldNode(ext); fieldNode != nil {
+							add(fieldNode.GetTag(), protocol.Read)
+						}
+					}
+				}
+				return true
+			}
+			for _, rr := range md.GetReservedRange() {
+				node := parseRes.MessageReservedRangeNode(rr)
+				if !atPosition(node) {
+					continue
+				}
+				add(node, protocol.Text)
+				highlightRangeConflicts(parseRes, md, node, tagRange{rr.GetStart(), rr.GetEnd()}, add)
+				return true
+			}
+			if visit(fullName+".", md.GetNestedType()) {
+				return true
+			}
+		}
+		return false
+	}
+	var prefix string
+	if fdp.GetPackage() != "" {
+		prefix = fdp.GetPackage() + "."
+	}
+	visit(prefix, fdp.GetMessageType())
+	return highlights, nil
+}
+
+// highlightRangeConflicts highlights the fields, extension ranges and reserved
+// ranges of the message (other than the selected node) which overlap the
+// selected range.
+func highlightRangeConflicts(parseRes parser.Result, md *descriptorpb.DescriptorProto, selectedNode ast.Node, selected tagRange, add func(ast.Node, protocol.DocumentHighlightKind)) {
+	for _, fd := range md.GetField() {
+		if !selected.contains(fd.GetNumber()) {
+			continue
+		}
+		if fieldNode := parseRes.FieldNode(fd); fieldNode != nil {
+			add(fieldNode.GetTag(), protocol.Write)
+		}
+	}
+	for _, er := range md.GetExtensionRange() {
+		if node := parseRes.ExtensionRangeNode(er); node != selectedNode && selected.overlaps(tagRange{er.GetStart(), er.GetEnd()}) {
+			add(node, protocol.Write)
+		}
+	}
+	for _, rr := range md.GetReservedRange() {
+		if node := parseRes.MessageReservedRangeNode(rr); node != selectedNode && selected.overlaps(tagRange{rr.GetStart(), rr.GetEnd()}) {
+			add(node, protocol.Write)
+		}
+	}
+}
+
+// extensionsInFile returns all extensions declared in the file, including
+// those nested in messages.
+func extensionsInFile(fdp *descriptorpb.FileDescriptorProto) []*descriptorpb.FieldDescriptorProto {
+	exts := slices.Clone(fdp.GetExtension())
+	var visit func(messages []*descriptorpb.DescriptorProto)
+	visit = func(messages []*descriptorpb.DescriptorProto) {
+		for _, md := range messages {
+			exts = append(exts, md.GetExtension()...)
+			visit(md.GetNestedType())
+		}
+	}
+	visit(fdp.GetMessageType())
+	return exts
+}
@@ -0,0 +1,73 @@
+package lsp
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestDocumentHighlightRanges(t *testing.T) {
+	const source = `syntax = "proto2";
+package a;
+message A {
+  optional int32 a = 1;
+  optional int32 b = 105;
+  extensions 100 to 199;
+  reserved 150 to 160;
+}
+extend A {
+  optional int32 x = 120;
+}
+`
+	c, workspace := newTestCache(t, map[string]string{"a.proto": source}, nil)
+	uri := protocol.URIFromPath(filepath.Join(workspace, "a.proto"))
+
+	highlight := func(line, char uint32) []protocol.DocumentHighlight {
+		t.Helper()
+		highlights, err := c.ComputeDocumentHighlights(c.Snapshot(), protocol.DocumentHighlightParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     protocol.Position{Line: line, Character: char},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.SortFunc(highlights, func(a, b protocol.DocumentHighlight) int {
+			return protocol.ComparePosition(a.Range.Start, b.Range.Start)
+		})
+		return highlights
+	}
+	rng := func(line, start, end uint32) protocol.Range {
+		return protocol.Range{Start: protocol.Position{Line: line, Character: start}, End: protocol.Position{Line: line, Character: end}}
+	}
+
+	// extension range: field b illegally uses 105, reserved range overlaps,
+	// extension x is declared within it
+	got := highlight(5, 15)
+	want := []protocol.DocumentHighlight{
+		{Range: rng(4, 21, 24), Kind: protocol.Write},
+		{Range: rng(5, 13, 23), Kind: protocol.Text},
+		{Range: rng(6, 11, 21), Kind: protocol.Write},
+		{Range: rng(9, 21, 24), Kind: protocol.Read},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("extension range highlights:\ngot  %v\nwant %v", got, want)
+	}
+
+	// reserved range: only the overlapping extension range
+	got = highlight(6, 12)
+	want = []protocol.DocumentHighlight{
+		{Range: rng(5, 13, 23), Kind: protocol.Write},
+		{Range: rng(6, 11, 21), Kind: protocol.Text},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("reserved range highlights:\ngot  %v\nwant %v", got, want)
+	}
+
+	if got := highlight(3, 10); len(got) != 0 {
+		t.Errorf("expected no highlights outside of ranges, got %v", got)
+	}
+}
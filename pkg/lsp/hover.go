@@ -1,7 +1,9 @@
 package lsp
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/kralicky/protocompile/ast"
 	"github.com/kralicky/protols/pkg/format"
@@ -9,20 +11,64 @@ import (
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-func (c *Cache) ComputeHover(params protocol.TextDocumentPositionParams) (*protocol.Hover, error) {
-	desc, rng, err := c.FindTypeDescriptorAtLocation(params)
+// ComputeHover returns the hover for the given position, with its contents
+// written in markdown. Server.Hover converts them for clients which cannot
+// render markdown; see adaptHover.
+func (c *Cache) ComputeHover(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams) (*protocol.Hover, error) {
+	hover, err := c.computeHover(ctx, snapshot, params)
+	// Duration and Timestamp option values are shown in their humanized form,
+	// alongside the description of the field under the cursor, if any
+	if literal := c.tryHoverWellKnownLiteral(snapshot, params); literal != nil {
+		if err != nil || hover == nil {
+			return literal, nil
+		}
+		hover.Contents.Value += "\n---\n" + literal.Contents.Value
+	}
+	return hover, err
+}
+
+func (c *Cache) computeHover(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams) (*protocol.Hover, error) {
+	if hover := c.tryHoverInterpretedOptions(snapshot, params); hover != nil {
+		return hover, nil
+	}
+	// string option values may refer to other descriptors by name
+	desc, rng, err := c.FindStringReferenceAtLocation(ctx, snapshot, params)
+	if err == nil && desc == nil {
+		desc, rng, err = c.FindTypeDescriptorAtLocation(ctx, snapshot, params)
+	}
+	if err != nil || desc == nil {
+		// builtin scalar types have no descriptor
+		if hover := c.tryHoverScalarType(snapshot, params); hover != nil {
+			return hover, nil
+		}
+	}
 	if err != nil {
 		return nil, err
 	} else if desc == nil {
-		return c.tryHoverPackageNode(params), nil
+		if hover := c.tryHoverImportNode(snapshot, params); hover != nil {
+			return hover, nil
+		}
+		return c.tryHoverPackageNode(snapshot, params), nil
+	}
+
+	if fd, ok := desc.(protoreflect.FieldDescriptor); ok {
+		// map fields and their synthetic entry fields have no node of their own
+		// to print, so describe the synthetic entry message instead
+		if fd.IsMap() {
+			return makeMapFieldHover(fd, fd, rng), nil
+		} else if parent, ok := fd.Parent().(protoreflect.MessageDescriptor); ok && parent.IsMapEntry() {
+			if mapField, ok := findMapFieldForEntry(parent); ok {
+				return makeMapFieldHover(mapField, fd, rng), nil
+			}
+		}
 	}
 
-	location, err := c.FindDefinitionForTypeDescriptor(desc)
+	location, err := c.FindDefinitionForTypeDescriptor(snapshot, desc)
 	if err != nil {
 		return nil, err
 	}
 
-	parseRes, err := c.FindParseResultByURI(location.URI)
+	parseRes, err := snapshot.FindParseResultByURI(location.URI)
 	if err != nil {
 		return nil, err
 	}
@@ -42,7 +88,7 @@ func (c *Cache) ComputeHover(params protocol.TextDocumentPositionParams) (*proto
 		return nil, nil
 	}
 
-	path, found := findPathIntersectingToken(parseRes, tokenAtOffset, location.Range.Start)
+	path, found := c.findPathIntersectingToken(parseRes, tokenAtOffset, location.Range.Start)
 	if !found {
 		return nil, nil
 	}
@@ -51,10 +97,24 @@ func (c *Cache) ComputeHover(params protocol.TextDocumentPositionParams) (*proto
 	if err != nil {
 		return nil, err
 	}
+	value := fmt.Sprintf("```protobuf\n%s\n```\n", text)
+	// synthetic files may have been printed without the comments in the
+	// descriptor they were generated from
+	if parseRes.AST().NodeInfo(node).LeadingComments().Len() == 0 {
+		if docs := commentMarkdown(c.resolver.SyntheticLeadingComments(location.URI, desc.FullName())); docs != "" {
+			value += docs + "\n\n"
+		}
+	}
+	switch desc := desc.(type) {
+	case protoreflect.MethodDescriptor:
+		value += methodHoverDetails(desc)
+	case protoreflect.FieldDescriptor:
+		value += fieldDefaultDetails(desc)
+	}
 	return &protocol.Hover{
 		Contents: protocol.MarkupContent{
 			Kind:  protocol.Markdown,
-			Value: fmt.Sprintf("```protobuf\n%s\n```\n", text),
+			Value: value,
 		},
 		Range: rng,
 	}, nil
@@ -72,3 +132,75 @@ func makeTooltip(d protoreflect.Descriptor) *protocol.OrPTooltipPLabel {
 		},
 	}
 }
+
+// makeMapFieldHover describes a map field along with its synthetic entry
+// message. If focus is the entry's key or value field, the hover describes
+// that field in the context of the map.
+func makeMapFieldHover(mapField, focus protoreflect.FieldDescriptor, rng protocol.Range) *protocol.Hover {
+	entry := mapField.Message()
+	key, value := mapField.MapKey(), mapField.MapValue()
+
+	var b strings.Builder
+	switch focus {
+	case key:
+		fmt.Fprintf(&b, "```protobuf\n%s key = 1;\n```\n", mapFieldTypeName(key))
+		fmt.Fprintf(&b, "Key type of map field `%s`\n\n", mapField.FullName())
+	case value:
+		fmt.Fprintf(&b, "```protobuf\n%s value = 2;\n```\n", mapFieldTypeName(value))
+		fmt.Fprintf(&b, "Value type of map field `%s`\n\n", mapField.FullName())
+	default:
+		fmt.Fprintf(&b, "```protobuf\nmap<%s, %s> %s = %d;\n```\n",
+			mapFieldTypeName(key), mapFieldTypeName(value), mapField.Name(), mapField.Number())
+	}
+	b.WriteString("Synthetic map entry message:\n")
+	fmt.Fprintf(&b, "```protobuf\nmessage %s {\n  option map_entry = true;\n\n  %s key = 1;\n  %s value = 2;\n}\n```\n",
+		entry.Name(), mapFieldTypeName(key), mapFieldTypeName(value))
+	fmt.Fprintf(&b, "- key: `%s`\n", mapFieldResolvedType(key))
+	fmt.Fprintf(&b, "- value: `%s`\n", mapFieldResolvedType(value))
+
+	return &protocol.Hover{
+		Contents: protocol.MarkupContent{
+			Kind:  protocol.Markdown,
+			Value: b.String(),
+		},
+		Range: rng,
+	}
+}
+
+func mapFieldTypeName(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(fd.Message().Name())
+	case protoreflect.EnumKind:
+		return string(fd.Enum().Name())
+	default:
+		return fd.Kind().String()
+	}
+}
+
+func mapFieldResolvedType(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return fmt.Sprintf("message %s", fd.Message().FullName())
+	case protoreflect.EnumKind:
+		return fmt.Sprintf("enum %s", fd.Enum().FullName())
+	default:
+		return fd.Kind().String()
+	}
+}
+
+// findMapFieldForEntry returns the map field which declares the given
+// synthetic map entry message.
+func findMapFieldForEntry(entry protoreflect.MessageDescriptor) (protoreflect.FieldDescriptor, bool) {
+	parent, ok := entry.Parent().(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, false
+	}
+	fields := parent.Fields()
+	for i := range fields.Len() {
+		if fld := fields.Get(i); fld.IsMap() && fld.Message().FullName() == entry.FullName() {
+			return fld, true
+		}
+	}
+	return nil, false
+}
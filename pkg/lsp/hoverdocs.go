@@ -0,0 +1,41 @@
+package lsp
+
+import (
+	"strings"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// SyntheticLeadingComments returns the leading comments of the named
+// declaration in the descriptor a synthetic file was printed from, if its
+// SourceCodeInfo has any. Synthetic files printed without comments, or from
+// descriptors the printer cannot attribute comments to, still keep them here.
+func (r *Resolver) SyntheticLeadingComments(uri protocol.DocumentURI, name protoreflect.FullName) string {
+	r.pathsMu.RLock()
+	fd, ok := r.syntheticDescriptors[uri]
+	r.pathsMu.RUnlock()
+	if !ok || fd.SourceLocations().Len() == 0 {
+		return ""
+	}
+	files := new(protoregistry.Files)
+	if err := files.RegisterFile(fd); err != nil {
+		return ""
+	}
+	desc, err := files.FindDescriptorByName(name)
+	if err != nil {
+		return ""
+	}
+	return fd.SourceLocations().ByDescriptor(desc).LeadingComments
+}
+
+// commentMarkdown formats the text of a comment from SourceCodeInfo for use in
+// markdown, removing the space which usually follows the comment markers.
+func commentMarkdown(comment string) string {
+	lines := strings.Split(strings.TrimRight(comment, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
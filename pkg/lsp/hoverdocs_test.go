@@ -0,0 +1,53 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestSyntheticLeadingComments(t *testing.T) {
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("b.proto"),
+		Package: proto.String("b"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("B"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("id"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				JsonName: proto.String("id"),
+			}},
+		}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{
+				{Path: []int32{4, 0}, Span: []int32{3, 0, 5, 1}, LeadingComments: proto.String(" B is documented.\n\n Indented:\n   code\n")},
+				{Path: []int32{4, 0, 2, 0}, Span: []int32{4, 2, 16}},
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewResolver(protocol.WorkspaceFolder{URI: "file:///workspace"})
+	uri := protocol.DocumentURI("proto:///example.com/b.proto#workspace")
+	r.syntheticDescriptors[uri] = fd
+
+	if got, want := commentMarkdown(r.SyntheticLeadingComments(uri, "b.B")), "B is documented.\n\nIndented:\n  code"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	for _, name := range []string{"b.B.id", "b.C"} {
+		if got := r.SyntheticLeadingComments(uri, protoreflect.FullName(name)); got != "" {
+			t.Errorf("%s: unexpected comments %q", name, got)
+		}
+	}
+	if got := r.SyntheticLeadingComments("proto:///example.com/c.proto#workspace", "b.B"); got != "" {
+		t.Errorf("unexpected comments for unknown file: %q", got)
+	}
+}
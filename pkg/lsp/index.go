@@ -0,0 +1,261 @@
+package lsp
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile"
+	"github.com/kralicky/protocompile/protoutil"
+	"github.com/kralicky/protols/pkg/version"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// An index archive is a zip file containing the descriptors of all files
+// compiled in a workspace, which can be exported from one checkout and
+// imported in another. Importing an index lets the resolver use the archived
+// descriptors of synthetic files (those decoded from generated Go code)
+// instead of synthesizing them again, which is the slowest part of loading a
+// workspace with many Go module dependencies. Descriptors of other files are
+// included for use by other tools, but files with sources are always compiled
+// from source.
+const (
+	indexManifestName    = "manifest.json"
+	indexDescriptorsName = "descriptors.binpb"
+)
+
+// ErrIndexMismatch is returned when importing an index which was built for
+// different Go module dependencies than those of the workspace.
+var ErrIndexMismatch = errors.New("index was built for different dependencies")
+
+type IndexManifest struct {
+	// The version of protols which exported the index.
+	Version string `json:"version"`
+	// The SHA-256 hash of the workspace's go.sum file, if any. Synthetic
+	// descriptors depend on the versions of the workspace's Go dependencies.
+	GoSum string        `json:"goSum,omitempty"`
+	Files []IndexedFile `json:"files"`
+}
+
+type IndexedFile struct {
+	Path   string `json:"path"`
+	Source string `json:"source"`
+	// The name of the proto file which a synthetic file was generated from, if
+	// it differs from its path.
+	OriginalName string `json:"originalName,omitempty"`
+}
+
+type prebuiltFile struct {
+	fd           *descriptorpb.FileDescriptorProto
+	originalName string
+}
+
+// ExportIndex writes an index archive containing the descriptors of all
+// compiled files to w.
+func (c *Cache) ExportIndex(w io.Writer) error {
+	manifest := IndexManifest{
+		Version: version.FriendlyVersion(),
+		GoSum:   c.goSumHash(),
+	}
+	var set descriptorpb.FileDescriptorSet
+
+	// the archive is written from a single snapshot, so files can be
+	// recompiled in the meantime
+	snapshot, release := c.AcquireSnapshot()
+	defer release()
+	c.resolver.pathsMu.RLock()
+	for _, f := range snapshot.Results() {
+		if f.IsPlaceholder() {
+			continue
+		}
+		entry := IndexedFile{Path: f.Path()}
+		if uri, ok := c.resolver.fileURIsByPath[f.Path()]; ok {
+			entry.Source = c.resolver.importSourcesByURI[uri].String()
+			if original := c.resolver.syntheticFileOriginalNames[uri]; original != f.Path() {
+				entry.OriginalName = original
+			}
+		}
+		manifest.Files = append(manifest.Files, entry)
+		set.File = append(set.File, protoutil.ProtoFromFileDescriptor(f))
+	}
+	c.resolver.pathsMu.RUnlock()
+
+	slices.SortFunc(manifest.Files, func(a, b IndexedFile) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	slices.SortFunc(set.File, func(a, b *descriptorpb.FileDescriptorProto) int {
+		return strings.Compare(a.GetName(), b.GetName())
+	})
+	descriptors, err := proto.MarshalOptions{Deterministic: true}.Marshal(&set)
+	if err != nil {
+		return err
+	}
+	manifestJson, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	for name, data := range map[string][]byte{
+		indexManifestName:    manifestJson,
+		indexDescriptorsName: descriptors,
+	} {
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// ImportIndex reads an index archive and makes the synthetic descriptors it
+// contains available to the resolver, replacing any previously imported
+// index. It returns the number of descriptors which will be used.
+func (c *Cache) ImportIndex(r io.ReaderAt, size int64) (int, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return 0, err
+	}
+	var manifest IndexManifest
+	if err := readIndexEntry(zr, indexManifestName, func(data []byte) error {
+		return json.Unmarshal(data, &manifest)
+	}); err != nil {
+		return 0, err
+	}
+	if manifest.GoSum != c.goSumHash() {
+		return 0, ErrIndexMismatch
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := readIndexEntry(zr, indexDescriptorsName, func(data []byte) error {
+		return proto.Unmarshal(data, &set)
+	}); err != nil {
+		return 0, err
+	}
+
+	descriptors := make(map[string]*descriptorpb.FileDescriptorProto, len(set.File))
+	for _, fd := range set.File {
+		descriptors[fd.GetName()] = fd
+	}
+	prebuilt := make(map[string]prebuiltFile)
+	for _, entry := range manifest.Files {
+		fd, ok := descriptors[entry.Path]
+		if !ok || entry.Source != SourceSynthetic.String() {
+			continue
+		}
+		original := entry.OriginalName
+		if original == "" {
+			original = entry.Path
+		}
+		prebuilt[entry.Path] = prebuiltFile{fd: fd, originalName: original}
+	}
+	c.resolver.setPrebuiltFiles(prebuilt)
+	return len(prebuilt), nil
+}
+
+// ImportIndexFile is like ImportIndex, but reads the archive from a file.
+func (c *Cache) ImportIndexFile(filename string) (int, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return c.ImportIndex(f, info.Size())
+}
+
+// ReadIndexFile reads the manifest and descriptors of an index archive
+// without importing it, for use by tools which only need to inspect the
+// workspace's definitions.
+func ReadIndexFile(filename string) (*IndexManifest, *descriptorpb.FileDescriptorSet, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer zr.Close()
+	var manifest IndexManifest
+	if err := readIndexEntry(&zr.Reader, indexManifestName, func(data []byte) error {
+		return json.Unmarshal(data, &manifest)
+	}); err != nil {
+		return nil, nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := readIndexEntry(&zr.Reader, indexDescriptorsName, func(data []byte) error {
+		return proto.Unmarshal(data, &set)
+	}); err != nil {
+		return nil, nil, err
+	}
+	return &manifest, &set, nil
+}
+
+func readIndexEntry(zr *zip.Reader, name string, fn func([]byte) error) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("invalid index archive: %w", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if err := fn(data); err != nil {
+		return fmt.Errorf("invalid index archive: %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *Cache) goSumHash() string {
+	root := uriPath(protocol.DocumentURI(c.workspace.URI))
+	data, err := os.ReadFile(filepath.Join(root, "go.sum"))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *Resolver) setPrebuiltFiles(prebuilt map[string]prebuiltFile) {
+	r.pathsMu.Lock()
+	defer r.pathsMu.Unlock()
+	r.prebuiltFiles = prebuilt
+}
+
+// checkPrebuilt resolves the path to a synthetic descriptor from an imported
+// index.
+func (r *Resolver) checkPrebuilt(path string) (protocompile.SearchResult, error) {
+	prebuilt, ok := r.prebuiltFiles[path]
+	if !ok {
+		return protocompile.SearchResult{}, os.ErrNotExist
+	}
+	syntheticURI := url.URL{
+		Scheme:   "proto",
+		Path:     path,
+		Fragment: r.folder.Name,
+	}
+	uri := protocol.DocumentURI(syntheticURI.String())
+	r.filePathsByURI[uri] = path
+	r.fileURIsByPath[path] = uri
+	r.importSourcesByURI[uri] = SourceSynthetic
+	r.syntheticFileOriginalNames[uri] = prebuilt.originalName
+	return protocompile.SearchResult{
+		Version:      1,
+		ResolvedPath: protocompile.ResolvedPath(path),
+		Proto:        proto.Clone(prebuilt.fd).(*descriptorpb.FileDescriptorProto),
+	}, nil
+}
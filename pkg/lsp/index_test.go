@@ -0,0 +1,69 @@
+package lsp
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestIndexArchive(t *testing.T) {
+	const a = "syntax = \"proto3\";\npackage a;\nimport \"gen/b.proto\";\nmessage A {\n  b.B b = 1;\n}\n"
+	const b = "syntax = \"proto3\";\npackage b;\nmessage B {}\n"
+
+	exporting := t.TempDir()
+	writeFiles(t, exporting, map[string]string{"a.proto": a, "gen/b.proto": b})
+	src := NewCache(protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(exporting))}, WithSandboxedCache())
+	defer src.Close(nil)
+	src.LoadFiles([]string{filepath.Join(exporting, "a.proto"), filepath.Join(exporting, "gen", "b.proto")})
+	// pretend gen/b.proto was synthesized from generated code
+	src.resolver.pathsMu.Lock()
+	src.resolver.importSourcesByURI[protocol.URIFromPath(filepath.Join(exporting, "gen", "b.proto"))] = SourceSynthetic
+	src.resolver.pathsMu.Unlock()
+
+	var archive bytes.Buffer
+	if err := src.ExportIndex(&archive); err != nil {
+		t.Fatal(err)
+	}
+
+	importing := t.TempDir()
+	writeFiles(t, importing, map[string]string{"a.proto": a})
+	dst := NewCache(protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(importing))}, WithSandboxedCache())
+	defer dst.Close(nil)
+	n, err := dst.ImportIndex(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("imported %d files, want 1", n)
+	}
+	dst.LoadFiles([]string{filepath.Join(importing, "a.proto")})
+
+	fd, err := dst.FindFileByURI(protocol.URIFromPath(filepath.Join(importing, "a.proto")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := fd.Messages().ByName("A").Fields().ByName("b").Message(); msg == nil || msg.IsPlaceholder() {
+		t.Fatal("type of field b was not resolved from the index")
+	}
+	uri, err := dst.resolver.PathToURI("gen/b.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst.resolver.pathsMu.RLock()
+	source := dst.resolver.importSourcesByURI[uri]
+	dst.resolver.pathsMu.RUnlock()
+	if source != SourceSynthetic {
+		t.Errorf("got import source %s, want %s", source, SourceSynthetic)
+	}
+
+	mismatched := t.TempDir()
+	writeFiles(t, mismatched, map[string]string{"go.sum": "example.com/foo v1.0.0 h1:abc=\n"})
+	other := NewCache(protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(mismatched))}, WithSandboxedCache())
+	defer other.Close(nil)
+	if _, err := other.ImportIndex(bytes.NewReader(archive.Bytes()), int64(archive.Len())); !errors.Is(err, ErrIndexMismatch) {
+		t.Errorf("got error %v, want %v", err, ErrIndexMismatch)
+	}
+}
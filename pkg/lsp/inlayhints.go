@@ -9,7 +9,7 @@ import (
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-func (c *Cache) ComputeInlayHints(doc protocol.TextDocumentIdentifier, rng protocol.Range) ([]protocol.InlayHint, error) {
+func (c *Cache) ComputeInlayHints(snapshot *Snapshot, doc protocol.TextDocumentIdentifier, rng protocol.Range) ([]protocol.InlayHint, error) {
 	c.resultsMu.RLock()
 	defer c.resultsMu.RUnlock()
 	if ok, err := c.latestDocumentContentsWellFormedLocked(doc.URI, true); err != nil {
@@ -21,17 +21,17 @@ func (c *Cache) ComputeInlayHints(doc protocol.TextDocumentIdentifier, rng proto
 	hints := []protocol.InlayHint{}
 	settings := c.settings.Load()
 	if settings.InlayHints.GetExtensionTypes() {
-		hints = append(hints, c.computeMessageLiteralHints(doc, rng)...)
+		hints = append(hints, c.computeMessageLiteralHints(snapshot, doc, rng)...)
 	}
 	if settings.InlayHints.GetImports() {
-		hints = append(hints, c.computeImportHints(doc, rng)...)
+		hints = append(hints, c.computeImportHints(snapshot, doc, rng)...)
 	}
 	return hints, nil
 }
 
-func (c *Cache) computeMessageLiteralHints(doc protocol.TextDocumentIdentifier, rng protocol.Range) []protocol.InlayHint {
+func (c *Cache) computeMessageLiteralHints(snapshot *Snapshot, doc protocol.TextDocumentIdentifier, rng protocol.Range) []protocol.InlayHint {
 	var hints []protocol.InlayHint
-	res, err := c.FindResultByURI(doc.URI)
+	res, err := snapshot.FindResultOrPartialResultByURI(doc.URI)
 	if err != nil {
 		return nil
 	}
@@ -72,7 +72,7 @@ func (c *Cache) computeMessageLiteralHints(doc protocol.TextDocumentIdentifier,
 					Character: uint32(info.Start().Col) - 1,
 				}
 				var location *protocol.Location
-				if l, err := c.FindDefinitionForTypeDescriptor(desc.Message()); err == nil {
+				if l, err := c.FindDefinitionForTypeDescriptor(snapshot, desc.Message()); err == nil {
 					location = &l
 				}
 
@@ -90,13 +90,11 @@ func (c *Cache) computeMessageLiteralHints(doc protocol.TextDocumentIdentifier,
 	return hints
 }
 
-func (c *Cache) computeImportHints(doc protocol.TextDocumentIdentifier, rng protocol.Range) []protocol.InlayHint {
+func (c *Cache) computeImportHints(snapshot *Snapshot, doc protocol.TextDocumentIdentifier, rng protocol.Range) []protocol.InlayHint {
 	// show inlay hints for imports that resolve to different paths
 	var hints []protocol.InlayHint
-	c.resultsMu.RLock()
-	defer c.resultsMu.RUnlock()
 
-	res, err := c.FindParseResultByURI(doc.URI)
+	res, err := snapshot.FindParseResultByURI(doc.URI)
 	if err != nil {
 		return nil
 	}
@@ -0,0 +1,489 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/ast/paths"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protopath"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// AddFieldsFromJSON generates field declarations for each key in the given
+// JSON object, and returns an edit which inserts them into the message at the
+// given location. Nested objects become new nested messages, and arrays become
+// repeated fields. Keys which already correspond to a field in the message are
+// skipped.
+func (c *Cache) AddFieldsFromJSON(ctx context.Context, params protocol.TextDocumentPositionParams, jsonText string) (*protocol.WorkspaceEdit, error) {
+	obj, err := decodeJSONObject(jsonText)
+	if err != nil {
+		return nil, err
+	}
+	schema := &jsonObjectSchema{}
+	if err := schema.merge(obj); err != nil {
+		return nil, err
+	}
+
+	linkRes, msgNode, msgDesc, err := c.findMessageAtLocation(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	gen := newFieldGenerator(msgDesc)
+	var lines []string
+	for _, key := range schema.keys {
+		name := protoFieldName(key)
+		if msgDesc.Fields().ByName(protoreflect.Name(name)) != nil ||
+			msgDesc.Fields().ByJSONName(key) != nil {
+			continue
+		}
+		line, err := gen.field(key, schema.fields[key])
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, gen.nestedMessages...)
+	if len(lines) == 0 {
+		return nil, errors.New("all fields in the JSON object are already present in the message")
+	}
+
+	fileNode := linkRes.AST()
+	edit := insertIntoMessageEdit(fileNode, msgNode, lines)
+	return &protocol.WorkspaceEdit{
+		DocumentChanges: protocol.TextEditsToDocumentChanges(params.TextDocument.URI, fileNode.Version(), []protocol.TextEdit{edit}),
+	}, nil
+}
+
+// findMessageAtLocation returns the innermost message enclosing the given
+// location.
+func (c *Cache) findMessageAtLocation(ctx context.Context, params protocol.TextDocumentPositionParams) (linker.Result, *ast.MessageNode, protoreflect.MessageDescriptor, error) {
+	linkRes, err := c.FindResultOrPartialResultByURI(params.TextDocument.URI)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	mapper, err := c.GetMapper(params.TextDocument.URI)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	offset, err := mapper.PositionOffset(params.Position)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	token, _ := linkRes.AST().ItemAtOffset(offset)
+	path, ok := c.findPathIntersectingToken(linkRes, token, params.Position)
+	if ok {
+		for i := len(path.Path) - 1; i >= 0; i-- {
+			msgNode := paths.NodeAt[*ast.MessageNode](path.Index(i))
+			if msgNode == nil {
+				continue
+			}
+			msgPath := protopath.Values{Path: path.Path[:i+1], Values: path.Values[:i+1]}
+			desc, _, err := c.deepPathSearch(ctx, msgPath.Path, linkRes, linkRes)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if msgDesc, ok := desc.(protoreflect.MessageDescriptor); ok {
+				return linkRes, msgNode, msgDesc, nil
+			}
+		}
+	}
+	return nil, nil, nil, errors.New("no message found at the cursor position")
+}
+
+// insertIntoMessageEdit returns an edit which inserts the given lines before
+// the closing brace of the message. Lines are indented one level deeper than
+// the message itself.
+func insertIntoMessageEdit(fileNode *ast.FileNode, msgNode *ast.MessageNode, lines []string) protocol.TextEdit {
+	indentation := fileNode.NodeInfo(msgNode).Start().Col - 1
+	closeBrace := fileNode.NodeInfo(msgNode.CloseBrace)
+
+	var text strings.Builder
+	for _, line := range lines {
+		if line != "" {
+			text.WriteString(strings.Repeat(" ", indentation+2))
+			text.WriteString(line)
+		}
+		text.WriteString("\n")
+	}
+
+	insertPos := toPosition(closeBrace.Start())
+	if strings.TrimSpace(closeBrace.LeadingWhitespace()) == "" && strings.Contains(closeBrace.LeadingWhitespace(), "\n") {
+		// the closing brace is on its own line; insert at the start of that line
+		insertPos.Character = 0
+		return protocol.TextEdit{
+			Range:   protocol.Range{Start: insertPos, End: insertPos},
+			NewText: text.String(),
+		}
+	}
+	return protocol.TextEdit{
+		Range:   protocol.Range{Start: insertPos, End: insertPos},
+		NewText: "\n" + text.String() + strings.Repeat(" ", indentation),
+	}
+}
+
+// fieldGenerator assigns names and numbers to new fields and nested messages
+// added to an existing message.
+type fieldGenerator struct {
+	parent         protoreflect.MessageDescriptor
+	nextNumber     protoreflect.FieldNumber
+	usedNames      map[string]struct{}
+	nestedMessages []string
+}
+
+func newFieldGenerator(parent protoreflect.MessageDescriptor) *fieldGenerator {
+	g := &fieldGenerator{
+		parent:     parent,
+		nextNumber: 1,
+		usedNames:  map[string]struct{}{},
+	}
+	if parent != nil {
+		fields := parent.Fields()
+		for i := range fields.Len() {
+			g.nextNumber = max(g.nextNumber, fields.Get(i).Number()+1)
+		}
+	}
+	return g
+}
+
+func (g *fieldGenerator) nameInUse(name string) bool {
+	if _, ok := g.usedNames[name]; ok {
+		return true
+	}
+	if g.parent == nil {
+		return false
+	}
+	n := protoreflect.Name(name)
+	return g.parent.Fields().ByName(n) != nil ||
+		g.parent.Messages().ByName(n) != nil ||
+		g.parent.Enums().ByName(n) != nil ||
+		g.parent.Oneofs().ByName(n) != nil
+}
+
+func (g *fieldGenerator) uniqueName(name string) string {
+	unique := name
+	for i := 1; g.nameInUse(unique); i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	g.usedNames[unique] = struct{}{}
+	return unique
+}
+
+// number returns the next field number which is not used by an existing
+// field, reserved, or within an extension range. It returns an error once the
+// message has run out of valid field numbers.
+func (g *fieldGenerator) number() (protoreflect.FieldNumber, error) {
+	for {
+		n := g.nextNumber
+		if n > protowire.MaxValidNumber {
+			return 0, errors.New("no field numbers are left in the message")
+		}
+		g.nextNumber++
+		if n >= protowire.FirstReservedNumber && n <= protowire.LastReservedNumber {
+			continue // reserved for the protobuf implementation
+		}
+		if g.parent != nil && (g.parent.ReservedRanges().Has(n) || g.parent.ExtensionRanges().Has(n)) {
+			continue
+		}
+		return n, nil
+	}
+}
+
+// field returns the declaration for a field with the given JSON key. If the
+// field's type is a new message, its declaration is added to nestedMessages.
+func (g *fieldGenerator) field(key string, f *jsonFieldSchema) (string, error) {
+	name := g.uniqueName(protoFieldName(key))
+	typeName := f.kind.protoType()
+	if f.kind == jsonKindObject {
+		typeName = g.uniqueName(protoMessageName(key))
+		nested, err := f.object.messageDecl(typeName)
+		if err != nil {
+			return "", err
+		}
+		g.nestedMessages = append(g.nestedMessages, "")
+		g.nestedMessages = append(g.nestedMessages, nested...)
+	}
+	number, err := g.number()
+	if err != nil {
+		return "", fmt.Errorf("field %q: %w", key, err)
+	}
+	var decl strings.Builder
+	if f.repeated {
+		decl.WriteString("repeated ")
+	}
+	fmt.Fprintf(&decl, "%s %s = %d", typeName, name, number)
+	if defaultJSONName(name) != key {
+		fmt.Fprintf(&decl, " [json_name = %s]", strconv.Quote(key))
+	}
+	decl.WriteString(";")
+	return decl.String(), nil
+}
+
+type jsonKind int
+
+const (
+	jsonKindNull jsonKind = iota
+	jsonKindBool
+	jsonKindInt32
+	jsonKindInt64
+	jsonKindDouble
+	jsonKindString
+	jsonKindObject
+)
+
+func (k jsonKind) protoType() string {
+	switch k {
+	case jsonKindBool:
+		return "bool"
+	case jsonKindInt32:
+		return "int32"
+	case jsonKindInt64:
+		return "int64"
+	case jsonKindDouble:
+		return "double"
+	default:
+		return "string"
+	}
+}
+
+type jsonFieldSchema struct {
+	kind     jsonKind
+	repeated bool
+	object   *jsonObjectSchema
+}
+
+// jsonObjectSchema is the union of the fields seen in one or more JSON
+// objects, in the order they first appeared.
+type jsonObjectSchema struct {
+	keys   []string
+	fields map[string]*jsonFieldSchema
+}
+
+func (s *jsonObjectSchema) merge(obj *jsonObject) error {
+	if s.fields == nil {
+		s.fields = map[string]*jsonFieldSchema{}
+	}
+	for i, key := range obj.keys {
+		f, ok := s.fields[key]
+		if !ok {
+			f = &jsonFieldSchema{}
+			s.keys = append(s.keys, key)
+			s.fields[key] = f
+		}
+		value := obj.values[i]
+		if arr, ok := value.([]any); ok {
+			f.repeated = true
+			for _, elem := range arr {
+				if _, ok := elem.([]any); ok {
+					return fmt.Errorf("field %q: nested arrays cannot be represented as a protobuf field", key)
+				}
+				if err := f.mergeValue(key, elem); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := f.mergeValue(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *jsonFieldSchema) mergeValue(key string, value any) error {
+	var kind jsonKind
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case bool:
+		kind = jsonKindBool
+	case string:
+		kind = jsonKindString
+	case json.Number:
+		kind = jsonKindDouble
+		if i, err := value.Int64(); err == nil {
+			if int64(int32(i)) == i {
+				kind = jsonKindInt32
+			} else {
+				kind = jsonKindInt64
+			}
+		}
+	case *jsonObject:
+		kind = jsonKindObject
+		if f.object == nil {
+			f.object = &jsonObjectSchema{}
+		}
+		if err := f.object.merge(value); err != nil {
+			return err
+		}
+	}
+	switch {
+	case f.kind == jsonKindNull || f.kind == kind:
+		f.kind = kind
+	case f.kind >= jsonKindInt32 && f.kind <= jsonKindDouble && kind >= jsonKindInt32 && kind <= jsonKindDouble:
+		// widen numeric types to fit all values
+		f.kind = max(f.kind, kind)
+	case f.kind == jsonKindObject || kind == jsonKindObject:
+		return fmt.Errorf("field %q: cannot mix objects and other types", key)
+	default:
+		f.kind = jsonKindString
+	}
+	return nil
+}
+
+// messageDecl returns the declaration of a new message with a field for each
+// key in the schema, numbered sequentially.
+func (s *jsonObjectSchema) messageDecl(name string) ([]string, error) {
+	gen := newFieldGenerator(nil)
+	lines := []string{fmt.Sprintf("message %s {", name)}
+	var body []string
+	for _, key := range s.keys {
+		line, err := gen.field(key, s.fields[key])
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, line)
+	}
+	body = append(body, gen.nestedMessages...)
+	for _, line := range body {
+		if line == "" {
+			lines = append(lines, "")
+		} else {
+			lines = append(lines, "  "+line)
+		}
+	}
+	return append(lines, "}"), nil
+}
+
+// jsonObject is a decoded JSON object which preserves the order of its keys.
+type jsonObject struct {
+	keys   []string
+	values []any
+}
+
+func decodeJSONObject(text string) (*jsonObject, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	value, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid JSON: unexpected data after the top-level value")
+	}
+	obj, ok := value.(*jsonObject)
+	if !ok {
+		return nil, errors.New("expected a JSON object")
+	}
+	return obj, nil
+}
+
+func decodeJSONValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := &jsonObject{}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.keys = append(obj.keys, keyTok.(string))
+			obj.values = append(obj.values, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+	return tok, nil
+}
+
+// protoFieldName converts an arbitrary identifier (camelCase, PascalCase,
+// kebab-case, etc.) to a lower_snake_case field name.
+func protoFieldName(s string) string {
+	var buf bytes.Buffer
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsUpper(r):
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				buf.WriteByte('_')
+			}
+			buf.WriteRune(unicode.ToLower(r))
+		case r < unicode.MaxASCII && (unicode.IsLower(r) || unicode.IsDigit(r)):
+			buf.WriteRune(r)
+		default:
+			buf.WriteByte('_')
+		}
+	}
+	parts := strings.FieldsFunc(buf.String(), func(r rune) bool { return r == '_' })
+	name := strings.Join(parts, "_")
+	if name == "" {
+		return "field"
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "field_" + name
+	}
+	return name
+}
+
+// protoMessageName converts an arbitrary identifier to a PascalCase message
+// name.
+func protoMessageName(s string) string {
+	parts := strings.Split(protoFieldName(s), "_")
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + part[1:]
+	}
+	return strings.Join(parts, "")
+}
+
+// defaultJSONName returns the JSON name protoc assigns to a field by default.
+func defaultJSONName(name string) string {
+	var buf strings.Builder
+	upper := false
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
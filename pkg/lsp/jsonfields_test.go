@@ -0,0 +1,26 @@
+package lsp
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestFieldGeneratorNumber(t *testing.T) {
+	gen := newFieldGenerator(nil)
+	gen.nextNumber = protowire.FirstReservedNumber - 1
+	for _, want := range []protoreflect.FieldNumber{protowire.FirstReservedNumber - 1, protowire.LastReservedNumber + 1} {
+		if n, err := gen.number(); err != nil || n != want {
+			t.Fatalf("got %d, %v, want %d", n, err, want)
+		}
+	}
+
+	gen.nextNumber = protowire.MaxValidNumber
+	if n, err := gen.number(); err != nil || n != protowire.MaxValidNumber {
+		t.Fatalf("got %d, %v, want %d", n, err, protowire.MaxValidNumber)
+	}
+	if n, err := gen.number(); err == nil {
+		t.Fatalf("expected an error past the maximum field number, got %d", n)
+	}
+}
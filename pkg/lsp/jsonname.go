@@ -0,0 +1,179 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protocompile/protoutil"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// lintJSONNames reports json_name options which collide with the names that
+// JSON parsers accept for other fields in the same message. The compiler
+// already reports conflicts between effective JSON names; this rule also
+// checks the default JSON names of fields with a custom json_name, and the
+// original field names, which protojson accepts as well.
+func lintJSONNames(_ context.Context, p *lintPass) {
+	rangeMessages(p.result.Messages(), func(msg protoreflect.MessageDescriptor) {
+		fields := msg.Fields()
+		for i := range fields.Len() {
+			fd := fields.Get(i)
+			opt := jsonNameOption(fieldDeclNode(p.result, fd))
+			if opt == nil {
+				continue
+			}
+			name := fd.JSONName()
+			for j := range fields.Len() {
+				other := fields.Get(j)
+				if i == j || other.JSONName() == name {
+					// identical effective JSON names are reported by the compiler
+					continue
+				}
+				switch {
+				case string(other.Name()) == name:
+					p.report(opt.Val, "json_name %q collides with the name of field %s, which is also accepted when parsing JSON", name, other.Name())
+				case defaultJSONName(string(other.Name())) == name:
+					p.report(opt.Val, "json_name %q collides with the default JSON name of field %s", name, other.Name())
+				}
+			}
+		}
+	})
+}
+
+// addExplicitJSONNames offers to add a json_name option to the field under
+// the cursor, or to each field of the message under the cursor, whose JSON
+// name differs from its field name. This makes the name used in JSON visible
+// in the definition, and keeps it stable if the field is renamed.
+func (c *Cache) addExplicitJSONNames(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, results chan<- protocol.CodeAction) {
+	if request.Range.Start != request.Range.End {
+		return
+	}
+	offset, err := mapper.PositionOffset(request.Range.Start)
+	if err != nil {
+		return
+	}
+	fileNode := linkRes.AST()
+	contains := func(node ast.Node) bool {
+		if node == nil {
+			return false
+		}
+		info := fileNode.NodeInfo(node)
+		return info.Start().Offset <= offset && offset <= info.End().Offset
+	}
+	needsJSONName := func(fd protoreflect.FieldDescriptor) bool {
+		node := fieldDeclNode(linkRes, fd)
+		return node != nil && string(fd.Name()) != fd.JSONName() && jsonNameOption(node) == nil
+	}
+
+	var title string
+	var targets []protoreflect.FieldDescriptor
+	rangeMessages(linkRes.Messages(), func(msg protoreflect.MessageDescriptor) {
+		if title != "" {
+			return
+		}
+		fields := msg.Fields()
+		if msgNode := messageDeclNode(linkRes, msg); msgNode != nil && contains(msgNode.GetName()) {
+			for i := range fields.Len() {
+				if needsJSONName(fields.Get(i)) {
+					targets = append(targets, fields.Get(i))
+				}
+			}
+			title = "Add explicit json_name to all fields"
+			return
+		}
+		for i := range fields.Len() {
+			fd := fields.Get(i)
+			if node := fieldDeclNode(linkRes, fd); node != nil && contains(node.GetName()) {
+				if needsJSONName(fd) {
+					targets = append(targets, fd)
+				}
+				title = "Add explicit json_name"
+				return
+			}
+		}
+	})
+	if len(targets) == 0 {
+		return
+	}
+
+	results <- actionQueue.enqueue(title, protocol.RefactorRewrite, mapper.URI, fileNode.Version(), func(ca *protocol.CodeAction) error {
+		edits := make([]protocol.TextEdit, 0, len(targets))
+		for _, fd := range targets {
+			edits = append(edits, addJSONNameEdit(fileNode, fieldDeclNode(linkRes, fd), fd.JSONName()))
+		}
+		ca.Edit = &protocol.WorkspaceEdit{
+			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+				request.TextDocument.URI: edits,
+			},
+		}
+		return nil
+	})
+}
+
+// addJSONNameEdit returns an edit which adds a json_name option to the field,
+// either as the first of its existing compact options or in a new list.
+func addJSONNameEdit(fileNode *ast.FileNode, node *ast.FieldDeclNode, jsonName string) protocol.TextEdit {
+	opt := fmt.Sprintf("json_name = %q", jsonName)
+	if opts := node.GetOptions(); opts != nil && opts.OpenBracket != nil {
+		pos := toPosition(fileNode.NodeInfo(opts.OpenBracket).End())
+		if len(opts.Options) > 0 {
+			opt += ", "
+		}
+		return protocol.TextEdit{
+			Range:   protocol.Range{Start: pos, End: pos},
+			NewText: opt,
+		}
+	}
+	pos := toPosition(fileNode.NodeInfo(node.GetTag()).End())
+	return protocol.TextEdit{
+		Range:   protocol.Range{Start: pos, End: pos},
+		NewText: " [" + opt + "]",
+	}
+}
+
+// jsonNameOption returns the json_name option of the field, if it has one.
+func jsonNameOption(node *ast.FieldDeclNode) *ast.OptionNode {
+	if node == nil || node.GetOptions() == nil {
+		return nil
+	}
+	for _, opt := range node.GetOptions().Options {
+		if opt.IsIncomplete() || len(opt.Name.Parts) != 1 {
+			continue
+		}
+		fieldRef := opt.Name.Parts[0].GetFieldRef()
+		if fieldRef.GetName().AsIdentifier() == "json_name" && !fieldRef.IsExtension() {
+			return opt
+		}
+	}
+	return nil
+}
+
+// fieldDeclNode returns the declaration of the field if it is declared in the
+// given file.
+func fieldDeclNode(res linker.Result, fd protoreflect.FieldDescriptor) *ast.FieldDeclNode {
+	if fd.ParentFile() == nil || fd.ParentFile().Path() != res.Path() {
+		return nil
+	}
+	wrapper, ok := fd.(protoutil.DescriptorProtoWrapper)
+	if !ok {
+		return nil
+	}
+	return res.FieldNode(wrapper.AsProto().(*descriptorpb.FieldDescriptorProto))
+}
+
+// messageDeclNode returns the declaration of the message if it is declared in
+// the given file.
+func messageDeclNode(res linker.Result, md protoreflect.MessageDescriptor) *ast.MessageDeclNode {
+	if md.ParentFile() == nil || md.ParentFile().Path() != res.Path() {
+		return nil
+	}
+	wrapper, ok := md.(protoutil.DescriptorProtoWrapper)
+	if !ok {
+		return nil
+	}
+	return res.MessageNode(wrapper.AsProto().(*descriptorpb.DescriptorProto))
+}
@@ -0,0 +1,176 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// pendingFiles records workspace files which were discovered in lazy mode but
+// have not been compiled yet, along with the names of their packages.
+type pendingFiles struct {
+	mu       sync.Mutex
+	packages map[protocol.DocumentURI]string
+}
+
+func (p *pendingFiles) add(packages map[protocol.DocumentURI]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.packages == nil {
+		p.packages = make(map[protocol.DocumentURI]string, len(packages))
+	}
+	maps.Copy(p.packages, packages)
+}
+
+func (p *pendingFiles) remove(uris ...protocol.DocumentURI) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, uri := range uris {
+		delete(p.packages, uri)
+	}
+}
+
+func (p *pendingFiles) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.packages)
+}
+
+func (p *pendingFiles) snapshot() map[protocol.DocumentURI]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return maps.Clone(p.packages)
+}
+
+// take removes the given files and returns those which were still pending.
+func (p *pendingFiles) take(uris []protocol.DocumentURI) []protocol.DocumentURI {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	taken := uris[:0]
+	for _, uri := range uris {
+		if _, ok := p.packages[uri]; ok {
+			delete(p.packages, uri)
+			taken = append(taken, uri)
+		}
+	}
+	return taken
+}
+
+func (c *Cache) isLazy() bool {
+	return c.settings.Load().Lazy
+}
+
+// indexPending records files which were created in lazy mode. Only their
+// package names are read; they are compiled when opened, when needed to
+// answer a query, or by IndexWorkspace.
+func (c *Cache) indexPending(ctx context.Context, uris []protocol.DocumentURI) {
+	packages := make(map[protocol.DocumentURI]string, len(uris))
+	for _, uri := range uris {
+		var pkg string
+		if fh, err := c.compiler.fs.ReadFile(ctx, uri); err == nil {
+			if content, err := fh.Content(); err == nil {
+				pkg = scanPackageName(content)
+			}
+		}
+		packages[uri] = pkg
+	}
+	c.pending.add(packages)
+	slog.Debug("indexed files without compiling", "files", len(uris))
+}
+
+// scanPackageName returns the name in the package statement of a proto source
+// file without parsing it. Statements split across lines or preceded by a
+// block comment on the same line are not recognized.
+func scanPackageName(content []byte) string {
+	for len(content) > 0 {
+		var line []byte
+		line, content, _ = bytes.Cut(content, []byte("\n"))
+		line = bytes.TrimSpace(line)
+		rest, ok := bytes.CutPrefix(line, []byte("package"))
+		if !ok || len(rest) == 0 || (rest[0] != ' ' && rest[0] != '\t') {
+			continue
+		}
+		name, _, _ := bytes.Cut(rest, []byte(";"))
+		return string(bytes.TrimSpace(name))
+	}
+	return ""
+}
+
+// compilePending compiles the pending files for which match returns true, or
+// all pending files if match is nil. It must not be called while c.resultsMu
+// is held.
+func (c *Cache) compilePending(ctx context.Context, match func(uri protocol.DocumentURI, pkg string) bool) {
+	var uris []protocol.DocumentURI
+	for uri, pkg := range c.pending.snapshot() {
+		if match == nil || match(uri, pkg) {
+			uris = append(uris, uri)
+		}
+	}
+	slices.Sort(uris)
+	uris = c.pending.take(uris)
+	if len(uris) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(uris))
+	for _, uri := range uris {
+		if path, err := c.resolver.URIToPath(uri); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	slog.Info("compiling pending files", "files", len(paths), "remaining", c.pending.len())
+	c.Compile(ctx, paths, c.diagHandler.Flush)
+}
+
+// compilePendingContaining compiles the pending files whose contents contain
+// s. If fold is true, the comparison is case-insensitive.
+func (c *Cache) compilePendingContaining(ctx context.Context, s string, fold bool) {
+	needle := []byte(s)
+	if fold {
+		needle = bytes.ToLower(needle)
+	}
+	c.compilePending(ctx, func(uri protocol.DocumentURI, _ string) bool {
+		fh, err := c.compiler.fs.ReadFile(ctx, uri)
+		if err != nil {
+			return false
+		}
+		content, err := fh.Content()
+		if err != nil {
+			return false
+		}
+		if fold {
+			content = bytes.ToLower(content)
+		}
+		return bytes.Contains(content, needle)
+	})
+}
+
+// compilePendingReferences compiles the pending files which could contain
+// references to the descriptor or package name at the given location.
+func (c *Cache) compilePendingReferences(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams) {
+	if c.pending.len() == 0 {
+		return
+	}
+	if desc, _, err := c.FindTypeDescriptorAtLocation(ctx, snapshot, params); err == nil && desc != nil {
+		c.compilePendingContaining(ctx, string(desc.Name()), false)
+		return
+	}
+	if name, _, ok := c.findPackageNameAtLocation(snapshot, params); ok {
+		// references may be requested for any prefix of the package name
+		root, _, _ := strings.Cut(string(name), ".")
+		c.compilePending(ctx, func(_ protocol.DocumentURI, pkg string) bool {
+			return pkg == root || strings.HasPrefix(pkg, root+".")
+		})
+	}
+}
+
+// IndexWorkspace compiles all workspace files which have not been compiled
+// yet because the cache is in lazy mode.
+func (c *Cache) IndexWorkspace(ctx context.Context) {
+	c.compilePending(ctx, nil)
+}
@@ -0,0 +1,107 @@
+package lsp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestLazyMode(t *testing.T) {
+	handler := memSchemeHandler{
+		"mem:///workspace/a.proto": "syntax = \"proto3\";\npackage a;\nmessage A {}\n",
+		"mem:///workspace/b.proto": "syntax = \"proto3\";\npackage b;\nimport \"a.proto\";\nmessage B {\n  a.A a = 1;\n}\n",
+		"mem:///workspace/c.proto": "syntax = \"proto3\";\npackage c.d;\nmessage Unrelated {}\n",
+	}
+	ctx := context.Background()
+	c := NewCache(protocol.WorkspaceFolder{URI: "mem:///workspace"}, WithSchemeHandlers(map[string]SchemeHandler{"mem": handler}))
+	defer c.Close(nil)
+	c.DidChangeConfiguration(ctx, Settings{Lazy: true})
+	c.loadWorkspaceFiles()
+
+	if n := c.pending.len(); n != 3 {
+		t.Fatalf("expected 3 pending files, got %d", n)
+	}
+	if pkg := c.pending.snapshot()["mem:///workspace/c.proto"]; pkg != "c.d" {
+		t.Errorf("got package %q, want c.d", pkg)
+	}
+	if _, err := c.FindFileByURI("mem:///workspace/a.proto"); err == nil {
+		t.Fatal("a.proto should not be compiled before it is opened")
+	}
+
+	c.DidModifyFiles(ctx, []file.Modification{{
+		URI:        "mem:///workspace/a.proto",
+		Action:     file.Open,
+		Version:    1,
+		Text:       []byte(handler["mem:///workspace/a.proto"]),
+		LanguageID: "protobuf",
+	}})
+	if _, err := c.FindFileByURI("mem:///workspace/a.proto"); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.pending.len(); n != 2 {
+		t.Fatalf("expected 2 pending files after opening a.proto, got %d", n)
+	}
+
+	locations, err := c.FindReferences(ctx, c.Snapshot(), protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: "mem:///workspace/a.proto"},
+		Position:     protocol.Position{Line: 2, Character: 8},
+	}, protocol.ReferenceContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 || locations[0].URI != "mem:///workspace/b.proto" {
+		t.Errorf("expected a reference in b.proto, got %v", locations)
+	}
+	if _, ok := c.pending.snapshot()["mem:///workspace/c.proto"]; !ok {
+		t.Error("c.proto does not reference a.A and should not have been compiled")
+	}
+
+	if symbols := c.QueryWorkspaceSymbols(ctx, "unrelated"); len(symbols) == 0 {
+		t.Error("expected workspace symbols from c.proto")
+	}
+	if n := c.pending.len(); n != 0 {
+		t.Errorf("expected no pending files, got %d", n)
+	}
+}
+
+func TestLazyModeEagerPaths(t *testing.T) {
+	handler := memSchemeHandler{
+		"mem:///workspace/api/a.proto":    "syntax = \"proto3\";\npackage api;\nimport \"vendor/b.proto\";\nmessage A {\n  b.B b = 1;\n}\n",
+		"mem:///workspace/vendor/b.proto": "syntax = \"proto3\";\npackage b;\nmessage B {}\n",
+		"mem:///workspace/vendor/c.proto": "syntax = \"proto3\";\npackage c;\nmessage C {}\n",
+	}
+	ctx := context.Background()
+	c := NewCache(protocol.WorkspaceFolder{URI: "mem:///workspace"}, WithSchemeHandlers(map[string]SchemeHandler{"mem": handler}))
+	defer c.Close(nil)
+	c.DidChangeConfiguration(ctx, Settings{Lazy: true, EagerPaths: []string{"api/**"}})
+	c.loadWorkspaceFiles()
+
+	if _, err := c.FindFileByURI("mem:///workspace/api/a.proto"); err != nil {
+		t.Fatalf("a.proto matches the eager paths and should be compiled: %v", err)
+	}
+	// imports of eagerly compiled files are compiled along with them
+	if _, err := c.FindFileByURI("mem:///workspace/vendor/b.proto"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.FindFileByURI("mem:///workspace/vendor/c.proto"); err == nil {
+		t.Error("c.proto should not be compiled before it is needed")
+	}
+	if _, ok := c.pending.snapshot()["mem:///workspace/api/a.proto"]; ok {
+		t.Error("a.proto should not be pending")
+	}
+}
+
+func TestScanPackageName(t *testing.T) {
+	for content, want := range map[string]string{
+		"syntax = \"proto3\";\npackage foo.bar;\n":    "foo.bar",
+		"// package comment\n  package\tfoo ;\n":      "foo",
+		"syntax = \"proto3\";\nmessage packaged {}\n": "",
+		"": "",
+	} {
+		if got := scanPackageName([]byte(content)); got != want {
+			t.Errorf("scanPackageName(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
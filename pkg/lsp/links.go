@@ -6,16 +6,15 @@ import (
 
 	"github.com/kralicky/protocompile"
 	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
 	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
 )
 
-func (c *Cache) ComputeDocumentLinks(doc protocol.TextDocumentIdentifier) ([]protocol.DocumentLink, error) {
+func (c *Cache) ComputeDocumentLinks(snapshot *Snapshot, doc protocol.TextDocumentIdentifier) ([]protocol.DocumentLink, error) {
 	// link valid imports
 	var links []protocol.DocumentLink
-	c.resultsMu.RLock()
-	defer c.resultsMu.RUnlock()
 
-	res, err := c.FindParseResultByURI(doc.URI)
+	res, err := snapshot.FindParseResultByURI(doc.URI)
 	if err != nil {
 		return nil, err
 	}
@@ -80,5 +79,8 @@ func (c *Cache) ComputeDocumentLinks(doc protocol.TextDocumentIdentifier) ([]pro
 		}
 	}
 
+	if linkRes, ok := res.(linker.Result); ok {
+		links = append(links, c.fileReferenceLinks(linkRes, snapshot)...)
+	}
 	return links, nil
 }
@@ -0,0 +1,219 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile"
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protols/pkg/analysis"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// lintRule is a check that runs against a linked, workspace-local file each
+// time it is compiled. Diagnostics reported by lint rules are cleared along
+// with the compiler's diagnostics when the file is invalidated.
+type lintRule struct {
+	name string
+	// Rules belonging to a pack only run when the pack is enabled, either in
+	// the lint settings or with the 'lint' pragma.
+	pack string
+	run  func(ctx context.Context, pass *lintPass)
+}
+
+var lintRules = []lintRule{
+	{name: "field-reuse", pack: lintPackBreaking, run: lintFieldReuse},
+	{name: "resource-pattern", run: lintResourcePatterns},
+	{name: "resource-name-field", run: lintResourceNameField},
+	{name: "field-behavior", run: lintFieldBehavior},
+	{name: "json-name", run: lintJSONNames},
+	{name: "oneof-single-member", run: lintSingleMemberOneofs},
+	{name: "required-field", run: lintRequiredFields},
+	{name: "field-named-after-message", run: lintFieldNamedAfterMessage},
+	{name: "streaming-method-name", run: lintStreamingMethodNames},
+	{name: "extension-declaration", run: lintExtensionDeclarations},
+	{name: "string-escapes", run: lintStringEscapes},
+	{name: "field-paths", run: lintFieldPaths},
+	{name: "complexity", run: lintComplexity},
+	{name: "go-package-drift", run: lintGoPackageDrift},
+	{name: "stale-generated-code", run: lintStaleGeneratedCode},
+	{name: "missing-generated-code", run: lintMissingGeneratedDeclarations},
+	{name: "import-conflict", run: lintImportConflicts},
+	{name: "spelling-comments", pack: lintPackSpelling, run: lintCommentSpelling},
+	{name: "spelling-names", pack: lintPackSpelling, run: lintNameSpelling},
+	{name: "naming-conventions", pack: lintPackNaming, run: lintNamingConventions},
+	{name: "comment-coverage", pack: lintPackComments, run: lintCommentCoverage},
+	{name: "aip-method-names", pack: lintPackAIP, run: lintAIPMethodNames},
+	{name: "aip-request-response-names", pack: lintPackAIP, run: lintAIPRequestResponseNames},
+	{name: "aip-field-behavior", pack: lintPackAIP, run: lintAIPFieldBehavior},
+	{name: "aip-pagination", pack: lintPackAIP, run: lintAIPPagination},
+}
+
+type lintPass struct {
+	cache       *Cache
+	rule        string
+	result      linker.Result
+	settings    *Settings
+	diagnostics []*ProtoDiagnostic
+}
+
+// report adds a warning diagnostic for the given node. The returned diagnostic
+// can be modified to add code actions or related information.
+func (p *lintPass) report(node ast.Node, format string, args ...any) *ProtoDiagnostic {
+	return p.reportSpan(p.result.AST().NodeInfo(node), format, args...)
+}
+
+// reportSpan adds a warning diagnostic for an arbitrary range of the file.
+func (p *lintPass) reportSpan(span ast.SourceSpan, format string, args ...any) *ProtoDiagnostic {
+	d := &ProtoDiagnostic{
+		Path:     p.result.Path(),
+		Version:  p.result.AST().Version(),
+		Range:    span,
+		Severity: protocol.SeverityWarning,
+		Error:    fmt.Errorf(format, args...),
+		Code:     p.rule,
+		Metadata: map[string]string{
+			diagnosticKind: diagnosticKindLint,
+			"rule":         p.rule,
+		},
+	}
+	p.diagnostics = append(p.diagnostics, d)
+	return d
+}
+
+// lintLocked runs all enabled lint rules for the given file. It requires
+// resultsMu to be held.
+func (c *Cache) lintLocked(res linker.Result) {
+	settings := c.settings.Load()
+	if !settings.Lint.GetEnabled() {
+		return
+	}
+	if res.AST() == nil {
+		return
+	}
+	uri, err := c.resolver.PathToURI(res.Path())
+	if err != nil || !c.resolver.IsRealWorkspaceLocalFile(uri) {
+		return
+	}
+	// heavier checks can be deferred until the file is saved
+	saved := !c.hasUnsavedChanges(uri)
+	onSave := func(names ...string) bool {
+		return !saved && slices.ContainsFunc(names, func(name string) bool {
+			return name != "" && slices.Contains(settings.Lint.OnSave, name)
+		})
+	}
+	packs := c.lintPacks(settings, res.Path())
+	for _, rule := range lintRules {
+		if slices.Contains(settings.Lint.Disabled, rule.name) {
+			continue
+		}
+		if rule.pack != "" && !slices.Contains(packs, rule.pack) {
+			continue
+		}
+		if onSave(rule.name, rule.pack) {
+			continue
+		}
+		pass := &lintPass{
+			cache:    c,
+			rule:     rule.name,
+			result:   res,
+			settings: settings,
+		}
+		rule.run(c.lifetime, pass)
+		if len(pass.diagnostics) > 0 {
+			slog.Debug("lint rule reported diagnostics", "rule", rule.name, "path", res.Path(), "count", len(pass.diagnostics))
+		}
+		for _, d := range pass.diagnostics {
+			c.diagHandler.AddDiagnostic(d)
+		}
+	}
+	analyzers := analysis.Registered()
+	if !c.sandbox {
+		for _, external := range settings.Lint.External {
+			analyzers = append(analyzers, &externalAnalyzer{cache: c, settings: external})
+		}
+	}
+	for _, a := range analyzers {
+		if slices.Contains(settings.Lint.Disabled, a.Name()) || onSave(a.Name()) {
+			continue
+		}
+		for _, d := range c.runAnalyzerLocked(a, res) {
+			c.diagHandler.AddDiagnostic(d)
+		}
+	}
+}
+
+// lintPacks returns the lint packs enabled for the given file, in the settings
+// or with the 'lint' pragma.
+func (c *Cache) lintPacks(settings *Settings, path string) []string {
+	packs := settings.Lint.Packs
+	if p, ok := c.FindPragmasByPath(protocompile.ResolvedPath(path)); ok {
+		if v, ok := p.Lookup(PragmaLint); ok {
+			packs = append(slices.Clip(packs), strings.Fields(v)...)
+		}
+	}
+	return packs
+}
+
+// hasUnsavedChanges reports whether the file is open with contents which
+// differ from those on disk.
+func (c *Cache) hasUnsavedChanges(uri protocol.DocumentURI) bool {
+	fh, err := c.compiler.fs.ReadFile(c.lifetime, uri)
+	if err != nil {
+		return false
+	}
+	overlay, ok := fh.(interface{ SameContentsOnDisk() bool })
+	return ok && !overlay.SameContentsOnDisk()
+}
+
+// runAnalyzerLocked runs a registered analyzer against the given file, and
+// converts its findings to lint diagnostics. Errors and panics in the analyzer
+// are logged. It requires resultsMu to be held.
+func (c *Cache) runAnalyzerLocked(a analysis.Analyzer, res linker.Result) (diagnostics []*ProtoDiagnostic) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("analyzer panicked", "analyzer", a.Name(), "path", res.Path(), "panic", r)
+			diagnostics = nil
+		}
+	}()
+	pass := analysis.NewPass(res, c.results.AsResolver())
+	if err := a.Run(c.lifetime, pass); err != nil {
+		slog.Error("analyzer failed", "analyzer", a.Name(), "path", res.Path(), "error", err)
+		return nil
+	}
+	version := res.AST().Version()
+	for _, d := range pass.Diagnostics() {
+		pd := &ProtoDiagnostic{
+			Path:     res.Path(),
+			Version:  version,
+			Range:    d.Range,
+			Severity: d.Severity,
+			Error:    errors.New(d.Message),
+			Code:     a.Name(),
+			Metadata: map[string]string{
+				diagnosticKind: diagnosticKindLint,
+				"rule":         a.Name(),
+			},
+		}
+		for _, fix := range d.Fixes {
+			edits := make([]protocol.TextEdit, len(fix.Edits))
+			for i, edit := range fix.Edits {
+				edits[i] = protocol.TextEdit{Range: toRange(edit.Range), NewText: edit.NewText}
+			}
+			pd.CodeActions = append(pd.CodeActions, CodeAction{
+				Title:       fix.Title,
+				Path:        res.Path(),
+				Kind:        protocol.QuickFix,
+				IsPreferred: fix.IsPreferred,
+				Edits:       edits,
+			})
+		}
+		diagnostics = append(diagnostics, pd)
+	}
+	return diagnostics
+}
@@ -0,0 +1,132 @@
+package lsp
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestLintOnSave(t *testing.T) {
+	const a = `syntax = "proto3";
+package a;
+message A {
+  oneof choice {
+    string s = 1;
+  }
+}
+`
+	c, workspace := newTestCache(t, map[string]string{"a.proto": a}, &Settings{
+		Lint: LintSettings{OnSave: []string{"oneof-single-member"}},
+	})
+	ctx := context.Background()
+	uri := protocol.URIFromPath(filepath.Join(workspace, "a.proto"))
+
+	count := func() int {
+		diagnostics, _, _ := c.diagHandler.GetDiagnosticsForPath("a.proto")
+		n := 0
+		for _, d := range diagnostics {
+			if d.Code == "oneof-single-member" {
+				n++
+			}
+		}
+		return n
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("expected a diagnostic for the saved file, got %d", n)
+	}
+
+	edited := a + "// edited\n"
+	c.DidModifyFiles(ctx, []file.Modification{{
+		URI:        uri,
+		Action:     file.Open,
+		Version:    1,
+		Text:       []byte(edited),
+		LanguageID: "protobuf",
+	}})
+	if n := count(); n != 0 {
+		t.Errorf("expected no diagnostics while the file has unsaved changes, got %d", n)
+	}
+
+	if err := os.WriteFile(filepath.Join(workspace, "a.proto"), []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c.DidModifyFiles(ctx, []file.Modification{{
+		URI:    uri,
+		Action: file.Save,
+		Text:   []byte(edited),
+	}})
+	if n := count(); n != 1 {
+		t.Errorf("expected a diagnostic after saving, got %d", n)
+	}
+}
+
+func TestLintFieldReuse(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	const foo = `syntax = "proto3";
+package foo;
+message Foo {
+  string name = 1;
+  int32 count = 2;
+}
+`
+	workspace := t.TempDir()
+	writeFiles(t, workspace, map[string]string{"foo.proto": foo})
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "foo.proto"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = workspace
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	ctx := context.Background()
+	uri := protocol.URIFromPath(filepath.Join(workspace, "foo.proto"))
+	c := NewCache(protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(workspace))})
+	defer c.Close(nil)
+	c.LoadFiles([]string{filepath.Join(workspace, "foo.proto")})
+
+	messages := func(version int32) []string {
+		t.Helper()
+		c.DidModifyFiles(ctx, []file.Modification{{
+			URI:        uri,
+			Action:     file.Open,
+			Version:    version,
+			Text:       []byte(strings.Replace(foo, "int32 count = 2;", "bool enabled = 2;\n  int32 count = 3;", 1)),
+			LanguageID: "protobuf",
+		}})
+		diagnostics, _, _ := c.diagHandler.GetDiagnosticsForPath("foo.proto")
+		var messages []string
+		for _, d := range diagnostics {
+			if d.Code == "field-reuse" {
+				messages = append(messages, d.Error.Error())
+			}
+		}
+		slices.Sort(messages)
+		return messages
+	}
+	// the rule only runs if the breaking pack is enabled
+	if got := messages(1); len(got) != 0 {
+		t.Fatalf("unexpected diagnostics without the breaking pack: %v", got)
+	}
+
+	c.DidChangeConfiguration(ctx, Settings{Lint: LintSettings{Packs: []string{lintPackBreaking}}})
+	want := []string{
+		`field "count" previously used number 2, which is not reserved`,
+		`field number 2 was previously used by removed field "count"; reusing it is a breaking wire format change`,
+	}
+	if got := messages(2); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kralicky/protocompile/protoutil"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// lintSingleMemberOneofs reports oneofs containing a single field, which are
+// better expressed as an optional field. Synthetic oneofs generated for proto3
+// optional fields are ignored.
+func lintSingleMemberOneofs(_ context.Context, p *lintPass) {
+	rangeMessages(p.result.Messages(), func(msg protoreflect.MessageDescriptor) {
+		oneofs := msg.Oneofs()
+		for i := range oneofs.Len() {
+			od := oneofs.Get(i)
+			if od.IsSynthetic() || od.Fields().Len() != 1 {
+				continue
+			}
+			wrapper, ok := od.(protoutil.DescriptorProtoWrapper)
+			if !ok {
+				continue
+			}
+			oneofNode := p.result.OneofNode(wrapper.AsProto().(*descriptorpb.OneofDescriptorProto))
+			if oneofNode == nil || oneofNode.Name == nil {
+				continue
+			}
+			p.report(oneofNode.Name, "oneof %s has a single member; consider using an optional field instead", od.Name())
+		}
+	})
+}
+
+// lintRequiredFields reports required fields, which cannot be safely removed
+// or made optional once they are in use.
+func lintRequiredFields(_ context.Context, p *lintPass) {
+	rangeFields(p.result.Messages(), func(fd protoreflect.FieldDescriptor) {
+		if fd.Cardinality() != protoreflect.Required {
+			return
+		}
+		node := fieldDeclNode(p.result, fd)
+		if node == nil {
+			return
+		}
+		if label := node.GetLabel(); label != nil {
+			p.report(label, "field %s is required; required fields cannot be safely removed or made optional later", fd.Name())
+		} else {
+			p.report(node.GetName(), "field %s is required; required fields cannot be safely removed or made optional later", fd.Name())
+		}
+	})
+}
+
+// lintFieldNamedAfterMessage reports fields whose name matches the name of
+// their enclosing message. Code generators for several languages (e.g. C#)
+// derive member names that collide with the enclosing type, and have to
+// rename them.
+func lintFieldNamedAfterMessage(_ context.Context, p *lintPass) {
+	rangeFields(p.result.Messages(), func(fd protoreflect.FieldDescriptor) {
+		msg := fd.ContainingMessage()
+		if !strings.EqualFold(strings.ReplaceAll(string(fd.Name()), "_", ""), strings.ReplaceAll(string(msg.Name()), "_", "")) {
+			return
+		}
+		node := fieldDeclNode(p.result, fd)
+		if node == nil || node.GetName() == nil {
+			return
+		}
+		p.report(node.GetName(), "field %s has the same name as its enclosing message %s", fd.Name(), msg.Name())
+	})
+}
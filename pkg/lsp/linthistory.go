@@ -0,0 +1,147 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/kralicky/protocompile/protoutil"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Rules in the breaking pack compare files against the git baseline revision,
+// which requires running git. They are opt-in, since the baseline of every
+// file is read again whenever the revision moves.
+const lintPackBreaking = "breaking"
+
+// lintFieldReuse compares messages against the git baseline revision, and
+// reports fields that reuse the number or name of a field which has since been
+// removed, when the previous number was not reserved.
+func lintFieldReuse(ctx context.Context, p *lintPass) {
+	rev := p.settings.Lint.GetGitBaseline()
+	if rev == "" {
+		return
+	}
+	uri, err := p.cache.resolver.PathToURI(p.result.Path())
+	if err != nil || !uri.IsFile() {
+		return
+	}
+	prev, err := p.cache.baseline.Cached(uri.Path(), rev)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Debug("failed to read git baseline", "path", p.result.Path(), "error", err)
+		}
+		return
+	}
+	prefix := protoreflect.FullName(prev.GetPackage())
+	for _, msg := range prev.GetMessageType() {
+		checkFieldReuse(p, prefix, msg)
+	}
+}
+
+// prefetchGitBaseline reads the baseline revisions of the given workspace
+// files ahead of compiling them, so that lintFieldReuse does not need to run
+// git while resultsMu is held. Only files with the breaking pack enabled are
+// read; for packs enabled by pragma, this is known once the file has been
+// compiled.
+func (c *Cache) prefetchGitBaseline(paths []string) {
+	settings := c.settings.Load()
+	rev := settings.Lint.GetGitBaseline()
+	if rev == "" || !settings.Lint.GetEnabled() || slices.Contains(settings.Lint.Disabled, "field-reuse") {
+		return
+	}
+	var filenames []string
+	for _, path := range paths {
+		if !slices.Contains(c.lintPacks(settings, path), lintPackBreaking) {
+			continue
+		}
+		uri, err := c.resolver.PathToURI(path)
+		if err != nil || !uri.IsFile() || !c.resolver.IsRealWorkspaceLocalFile(uri) {
+			continue
+		}
+		filenames = append(filenames, uri.Path())
+	}
+	c.baseline.Prefetch(c.lifetime, rev, filenames)
+}
+
+func checkFieldReuse(p *lintPass, prefix protoreflect.FullName, prevMsg *descriptorpb.DescriptorProto) {
+	var name protoreflect.FullName
+	if prefix == "" {
+		name = protoreflect.FullName(prevMsg.GetName())
+	} else {
+		name = prefix.Append(protoreflect.Name(prevMsg.GetName()))
+	}
+	for _, nested := range prevMsg.GetNestedType() {
+		if nested.GetOptions().GetMapEntry() {
+			continue
+		}
+		checkFieldReuse(p, name, nested)
+	}
+
+	desc := p.result.FindDescriptorByName(name)
+	if desc == nil {
+		return
+	}
+	msg, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return
+	}
+
+	prevByNumber := map[protoreflect.FieldNumber]*descriptorpb.FieldDescriptorProto{}
+	prevByName := map[protoreflect.Name]*descriptorpb.FieldDescriptorProto{}
+	for _, fld := range prevMsg.GetField() {
+		prevByNumber[protoreflect.FieldNumber(fld.GetNumber())] = fld
+		prevByName[protoreflect.Name(fld.GetName())] = fld
+	}
+
+	fields := msg.Fields()
+	for i, l := 0, fields.Len(); i < l; i++ {
+		fld := fields.Get(i)
+		wrapper, ok := fld.(protoutil.DescriptorProtoWrapper)
+		if !ok {
+			continue
+		}
+		fieldNode := p.result.FieldNode(wrapper.AsProto().(*descriptorpb.FieldDescriptorProto))
+		if fieldNode == nil {
+			continue
+		}
+		if prevFld, ok := prevByNumber[fld.Number()]; ok && prevFld.GetName() != string(fld.Name()) {
+			// a field with a different name but the same type is treated as a rename
+			if !sameFieldType(prevFld, fld) && fieldNode.GetTag() != nil {
+				p.report(fieldNode.GetTag(), "field number %d was previously used by removed field %q; reusing it is a breaking wire format change",
+					fld.Number(), prevFld.GetName())
+			}
+		}
+		if prevFld, ok := prevByName[fld.Name()]; ok && protoreflect.FieldNumber(prevFld.GetNumber()) != fld.Number() {
+			if !msg.ReservedRanges().Has(protoreflect.FieldNumber(prevFld.GetNumber())) && fieldNode.GetName() != nil {
+				p.report(fieldNode.GetName(), "field %q previously used number %d, which is not reserved",
+					fld.Name(), prevFld.GetNumber())
+			}
+		}
+	}
+}
+
+// sameFieldType compares an unlinked field from a previous revision against
+// its current, linked counterpart. Type names in unlinked fields are not yet
+// resolved, so only their short names are compared.
+func sameFieldType(prev *descriptorpb.FieldDescriptorProto, cur protoreflect.FieldDescriptor) bool {
+	if (prev.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED) != (cur.Cardinality() == protoreflect.Repeated) {
+		return false
+	}
+	if prev.TypeName != nil {
+		var curName protoreflect.Name
+		switch cur.Kind() {
+		case protoreflect.MessageKind, protoreflect.GroupKind:
+			curName = cur.Message().Name()
+		case protoreflect.EnumKind:
+			curName = cur.Enum().Name()
+		default:
+			return false
+		}
+		return protoreflect.FullName(prev.GetTypeName()).Name() == curName
+	}
+	return protoreflect.Kind(prev.GetType()) == cur.Kind()
+}
@@ -0,0 +1,290 @@
+package lsp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// The compiler stops interpreting an option at the first invalid value it
+// finds, so a message literal with several mistakes only reports the first
+// one. validateOptionLiteralsLocked checks every value in the message literals
+// of the file's options against the types of the fields they are assigned to,
+// and reports each mismatch on the value itself. Diagnostics at the same
+// position as one reported by the compiler are skipped. It requires resultsMu
+// to be held.
+func (c *Cache) validateOptionLiteralsLocked(res linker.Result) {
+	fileNode := res.AST()
+	if fileNode == nil {
+		return
+	}
+	existing, _, _ := c.diagHandler.GetDiagnosticsForPath(res.Path())
+	reported := make(map[ast.SourcePos]bool, len(existing))
+	for _, d := range existing {
+		reported[d.Range.Start()] = true
+	}
+	v := &literalValidator{
+		resolver: c.results.AsResolver(),
+		fileNode: fileNode,
+		scope:    res.Package(),
+		report: func(node ast.Node, format string, args ...any) {
+			info := fileNode.NodeInfo(node)
+			if reported[info.Start()] {
+				return
+			}
+			reported[info.Start()] = true
+			c.diagHandler.AddDiagnostic(&ProtoDiagnostic{
+				Path:     res.Path(),
+				Version:  fileNode.Version(),
+				Range:    info,
+				Severity: protocol.SeverityError,
+				Error:    fmt.Errorf(format, args...),
+			})
+		},
+	}
+	ast.Inspect(fileNode, func(node ast.Node) bool {
+		optionNode, ok := node.(*ast.OptionNode)
+		if !ok {
+			return true
+		}
+		if optionNode.Val == nil {
+			return false
+		}
+		opt, ok := res.Descriptor(optionNode).(*descriptorpb.UninterpretedOption)
+		if !ok {
+			return false
+		}
+		if fd := res.FindOptionFieldDescriptor(opt); fd != nil {
+			v.validateValue(fd, optionNode.Val, false)
+		}
+		return false
+	})
+}
+
+type literalValidator struct {
+	resolver descriptorFinder
+	fileNode *ast.FileNode
+	scope    protoreflect.FullName
+	report   func(node ast.Node, format string, args ...any)
+}
+
+// validateValue checks a value assigned to the field. inList is true for the
+// elements of a list literal.
+func (v *literalValidator) validateValue(fd protoreflect.FieldDescriptor, val *ast.ValueNode, inList bool) {
+	if list := val.GetArrayLiteral(); list != nil {
+		if !fd.IsList() || inList {
+			v.report(list, "field %s is not repeated; expecting a single value, got a list", fd.Name())
+			return
+		}
+		for _, elem := range list.FilterValues() {
+			v.validateValue(fd, elem, true)
+		}
+		return
+	}
+	if fd.IsMap() {
+		if lit := val.GetMessageLiteral(); lit != nil {
+			v.validateMessage(fd.Message(), lit)
+		} else {
+			v.report(val, "expecting a message literal for map field %s, got %s", fd.Name(), describeValue(val))
+		}
+		return
+	}
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if lit := val.GetMessageLiteral(); lit != nil {
+			v.validateMessage(fd.Message(), lit)
+		} else {
+			v.report(val, "expecting %s, got %s", fd.Message().FullName(), describeValue(val))
+		}
+		return
+	}
+	if val.GetMessageLiteral() != nil {
+		v.report(val, "expecting %s, got message literal", kindName(fd))
+		return
+	}
+	if msg := checkScalarValue(fd, val.Value()); msg != "" {
+		v.report(val, "%s", msg)
+	}
+}
+
+func (v *literalValidator) validateMessage(md protoreflect.MessageDescriptor, lit *ast.MessageLiteralNode) {
+	seen := map[protoreflect.FieldNumber]bool{}
+	seenOneofs := map[protoreflect.FullName]protoreflect.Name{}
+	for _, elem := range lit.GetElements() {
+		name := elem.GetName()
+		if name == nil || name.IsIncomplete() || name.IsAnyTypeReference() || elem.GetVal() == nil {
+			continue
+		}
+		fd := v.findField(md, name)
+		if fd == nil {
+			// unknown fields are reported by the compiler
+			continue
+		}
+		if !fd.IsList() && !fd.IsMap() {
+			if seen[fd.Number()] {
+				v.report(name, "non-repeated field %s is already set", fd.Name())
+			} else if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() {
+				if other, ok := seenOneofs[od.FullName()]; ok {
+					v.report(name, "oneof %s already has field %s set", od.Name(), other)
+				}
+				seenOneofs[od.FullName()] = fd.Name()
+			}
+		}
+		seen[fd.Number()] = true
+		v.validateValue(fd, elem.GetVal(), false)
+	}
+	v.validateWellKnownMessage(md, lit)
+}
+
+func (v *literalValidator) findField(md protoreflect.MessageDescriptor, name *ast.FieldReferenceNode) protoreflect.FieldDescriptor {
+	ident := string(name.Name.AsIdentifier())
+	if name.IsExtension() {
+		xd, ok := resolveRelativeName(v.resolver, v.scope, ident, func(d protoreflect.Descriptor) bool {
+			xd, ok := d.(protoreflect.FieldDescriptor)
+			return ok && xd.IsExtension()
+		}).(protoreflect.FieldDescriptor)
+		if !ok || xd.ContainingMessage().FullName() != md.FullName() {
+			return nil
+		}
+		return xd
+	}
+	if fd := md.Fields().ByName(protoreflect.Name(ident)); fd != nil {
+		return fd
+	}
+	// groups are referenced by their type name
+	if fd := md.Fields().ByName(protoreflect.Name(strings.ToLower(ident))); fd != nil && fd.Kind() == protoreflect.GroupKind {
+		return fd
+	}
+	return nil
+}
+
+// checkScalarValue returns a description of why the value cannot be assigned
+// to the scalar or enum field, or an empty string if it can.
+func checkScalarValue(fd protoreflect.FieldDescriptor, value any) string {
+	mismatch := func() string {
+		return fmt.Sprintf("expecting %s, got %s", kindName(fd), describeGoValue(value))
+	}
+	switch fd.Kind() {
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		if _, ok := value.(string); !ok {
+			return mismatch()
+		}
+	case protoreflect.BoolKind:
+		switch value := value.(type) {
+		case ast.Identifier:
+			switch value {
+			case "true", "True", "t", "false", "False", "f":
+			default:
+				return mismatch()
+			}
+		case uint64:
+			if value > 1 {
+				return mismatch()
+			}
+		default:
+			return mismatch()
+		}
+	case protoreflect.EnumKind:
+		switch value := value.(type) {
+		case ast.Identifier:
+			if fd.Enum().Values().ByName(protoreflect.Name(value)) == nil {
+				return fmt.Sprintf("enum %s has no value named %s", fd.Enum().FullName(), value)
+			}
+		case uint64, int64:
+			n, inRange := asInt64(value)
+			if !inRange || n < math.MinInt32 || n > math.MaxInt32 {
+				return fmt.Sprintf("value %v is out of range for enum %s", value, fd.Enum().FullName())
+			}
+			if fd.Enum().IsClosed() && fd.Enum().Values().ByNumber(protoreflect.EnumNumber(n)) == nil {
+				return fmt.Sprintf("closed enum %s has no value with number %d", fd.Enum().FullName(), n)
+			}
+		default:
+			return mismatch()
+		}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		switch value := value.(type) {
+		case float64, uint64, int64:
+		case ast.Identifier:
+			switch strings.ToLower(string(value)) {
+			case "inf", "infinity", "nan":
+			default:
+				return mismatch()
+			}
+		default:
+			return mismatch()
+		}
+	default:
+		var min, max int64
+		var maxUnsigned uint64
+		switch fd.Kind() {
+		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+			min, max = math.MinInt32, math.MaxInt32
+		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+			min, max = math.MinInt64, math.MaxInt64
+		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+			maxUnsigned = math.MaxUint32
+		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+			maxUnsigned = math.MaxUint64
+		default:
+			return ""
+		}
+		switch value := value.(type) {
+		case uint64:
+			if (maxUnsigned > 0 && value > maxUnsigned) || (maxUnsigned == 0 && value > uint64(max)) {
+				return fmt.Sprintf("value %d is out of range for %s", value, kindName(fd))
+			}
+		case int64:
+			if maxUnsigned > 0 || value < min {
+				return fmt.Sprintf("value %d is out of range for %s", value, kindName(fd))
+			}
+		default:
+			return mismatch()
+		}
+	}
+	return ""
+}
+
+func asInt64(value any) (int64, bool) {
+	switch value := value.(type) {
+	case int64:
+		return value, true
+	case uint64:
+		return int64(value), value <= math.MaxInt64
+	}
+	return 0, false
+}
+
+func kindName(fd protoreflect.FieldDescriptor) string {
+	if fd.Kind() == protoreflect.EnumKind {
+		return string(fd.Enum().FullName())
+	}
+	return fd.Kind().String()
+}
+
+func describeValue(val *ast.ValueNode) string {
+	if val.GetMessageLiteral() != nil {
+		return "message literal"
+	}
+	return describeGoValue(val.Value())
+}
+
+func describeGoValue(value any) string {
+	switch value := value.(type) {
+	case string:
+		return "string"
+	case uint64, int64:
+		return "integer"
+	case float64:
+		return "float"
+	case ast.Identifier:
+		return fmt.Sprintf("identifier %s", value)
+	default:
+		return "value"
+	}
+}
@@ -0,0 +1,74 @@
+package lsp
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateOptionLiterals(t *testing.T) {
+	const source = `syntax = "proto2";
+package a;
+import "google/protobuf/descriptor.proto";
+enum E { E_ZERO = 0; E_ONE = 1; }
+message Opt {
+  optional int32 i = 1;
+  optional string s = 2;
+  optional E e = 3;
+  repeated int32 r = 4;
+  optional Opt nested = 5;
+  optional uint32 u = 6;
+  oneof choice {
+    string x = 7;
+    string y = 8;
+  }
+}
+extend google.protobuf.MessageOptions {
+  optional Opt opt = 50000;
+}
+message A {
+  option (opt) = {
+    i: "foo"
+    s: 12
+    e: 5
+    e: E_TWO
+    r: [1, "x"]
+    nested: { i: 1.5 u: -1 s: ["a"] }
+    u: 3000000000
+    i: 3000000000
+    x: "x"
+    y: "y"
+    nested: 1
+  };
+}
+`
+	c, _ := newTestCache(t, map[string]string{"a.proto": source}, nil)
+
+	diagnostics, _, _ := c.diagHandler.GetDiagnosticsForPath("a.proto")
+	var messages []string
+	for _, d := range diagnostics {
+		messages = append(messages, fmt.Sprintf("%d:%d %s", d.Range.Start().Line, d.Range.Start().Col, d.Error))
+	}
+	want := []string{
+		"22:8 expecting int32, got string", // reported by the compiler
+		"23:8 expecting string, got integer",
+		"24:8 closed enum a.E has no value with number 5",
+		"25:5 non-repeated field e is already set",
+		"25:8 enum a.E has no value named E_TWO",
+		"26:12 expecting int32, got string",
+		"27:18 expecting int32, got float",
+		"27:25 value -1 is out of range for uint32",
+		"27:31 field s is not repeated; expecting a single value, got a list",
+		"29:5 non-repeated field i is already set",
+		"29:8 value 3000000000 is out of range for int32",
+		"31:5 oneof choice already has field x set",
+		"32:5 non-repeated field nested is already set",
+		"32:13 expecting a.Opt, got integer",
+	}
+	slices.Sort(messages)
+	slices.Sort(want)
+	if !slices.Equal(messages, want) {
+		t.Errorf("got diagnostics:\n%s\nwant:\n%s", strings.Join(messages, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,271 @@
+package lsp
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protols/pkg/version"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// monikerScheme is the scheme of the monikers of proto symbols. Their
+// identifiers are fully-qualified names, which are unique among all proto
+// files which can be compiled together.
+const monikerScheme = "protobuf"
+
+// ComputeMonikers returns the moniker of the symbol at the given position. The
+// moniker is an export if the symbol is defined in a workspace-local file, and
+// an import otherwise.
+func (c *Cache) ComputeMonikers(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams) ([]protocol.Moniker, error) {
+	desc, _, err := c.FindTypeDescriptorAtLocation(ctx, snapshot, params)
+	if err != nil || desc == nil {
+		return nil, err
+	}
+	return []protocol.Moniker{c.moniker(desc)}, nil
+}
+
+func (c *Cache) moniker(desc protoreflect.Descriptor) protocol.Moniker {
+	kind := protocol.Import
+	if desc.ParentFile() != nil && c.isWorkspaceLocalPath(desc.ParentFile().Path()) {
+		kind = protocol.Export
+	}
+	return protocol.Moniker{
+		Scheme:     monikerScheme,
+		Identifier: string(desc.FullName()),
+		Unique:     protocol.Scheme,
+		Kind:       &kind,
+	}
+}
+
+func (c *Cache) isWorkspaceLocalPath(path string) bool {
+	uri, err := c.resolver.PathToURI(path)
+	return err == nil && c.resolver.IsRealWorkspaceLocalFile(uri)
+}
+
+// ExportLSIF writes an LSIF dump of the workspace-local files to w, one JSON
+// object per line. The dump contains the definitions and references of all
+// messages, enums, enum values, fields, extensions, oneofs, services and
+// methods which are defined in, or referenced by, local files, along with
+// their monikers. Symbols defined in dependencies are linked to other dumps
+// by their import monikers.
+func (c *Cache) ExportLSIF(ctx context.Context, w io.Writer) error {
+	// the dump is written from a single snapshot, so files can be recompiled
+	// in the meantime without the dump mixing results from both
+	snapshot, release := c.AcquireSnapshot()
+	defer release()
+
+	var local []linker.Result
+	for _, f := range c.searchable(snapshot.Results()) {
+		if f.IsPlaceholder() || !c.isWorkspaceLocalPath(f.Path()) {
+			continue
+		}
+		if res, ok := f.(linker.Result); ok && res.AST() != nil {
+			local = append(local, res)
+		}
+	}
+	slices.SortFunc(local, func(a, b linker.Result) int {
+		return strings.Compare(a.Path(), b.Path())
+	})
+	localFiles := make(linker.Files, len(local))
+	for i, res := range local {
+		localFiles[i] = res
+	}
+
+	// symbols defined in local files and their direct imports; transitive
+	// imports can't be referenced without a public import, which is direct
+	var symbols []protoreflect.Descriptor
+	seenFiles := map[string]bool{}
+	addSymbols := func(res linker.Result) {
+		if seenFiles[res.Path()] {
+			return
+		}
+		seenFiles[res.Path()] = true
+		res.RangeDescriptors(ctx, func(d protoreflect.Descriptor) bool {
+			switch d.(type) {
+			case protoreflect.MessageDescriptor, protoreflect.EnumDescriptor, protoreflect.EnumValueDescriptor,
+				protoreflect.FieldDescriptor, protoreflect.OneofDescriptor, protoreflect.ServiceDescriptor,
+				protoreflect.MethodDescriptor:
+				symbols = append(symbols, d)
+			}
+			return true
+		})
+	}
+	for _, res := range local {
+		addSymbols(res)
+		imports := res.Imports()
+		for i := range imports.Len() {
+			if dep, err := snapshot.FindResultByPath(imports.Get(i).Path()); err == nil {
+				addSymbols(dep)
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// occurrences of each symbol in local files, by path
+	type occurrence struct {
+		symbol       int
+		rng          protocol.Range
+		isDefinition bool
+	}
+	occurrences := map[string][]occurrence{}
+	candidates := c.referenceFilter(snapshot, localFiles)
+	for i, desc := range symbols {
+		if c.isWorkspaceLocalPath(desc.ParentFile().Path()) {
+			if res, err := snapshot.FindResultByPath(desc.ParentFile().Path()); err == nil {
+				if ref, err := findDefinition(desc, res); err == nil {
+					path := ref.NodeInfo.Start().Filename
+					occurrences[path] = append(occurrences[path], occurrence{i, toRange(ref.NodeInfo), true})
+				}
+			}
+		}
+		for _, f := range candidates(desc) {
+			for _, ref := range f.(linker.Result).FindReferences(desc) {
+				path := ref.NodeInfo.Start().Filename
+				occurrences[path] = append(occurrences[path], occurrence{i, toRange(ref.NodeInfo), false})
+			}
+		}
+	}
+
+	lw := &lsifWriter{enc: json.NewEncoder(w)}
+	lw.vertex("metaData", map[string]any{
+		"version":          "0.6.0",
+		"projectRoot":      c.workspace.URI,
+		"positionEncoding": "utf-16",
+		"toolInfo":         map[string]any{"name": "protols", "version": version.FriendlyVersion()},
+	})
+	projectID := lw.vertex("project", map[string]any{"kind": "protobuf"})
+
+	type symbolResult struct {
+		resultSet   int
+		definitions map[int][]int // document id -> range ids
+		references  map[int][]int
+	}
+	results := map[int]*symbolResult{}
+	var symbolOrder []int
+	var documents []int
+	for _, res := range local {
+		uri, err := c.resolver.PathToURI(res.Path())
+		if err != nil {
+			continue
+		}
+		docID := lw.vertex("document", map[string]any{"uri": uri, "languageId": "protobuf"})
+		documents = append(documents, docID)
+
+		occs := occurrences[res.Path()]
+		slices.SortFunc(occs, func(a, b occurrence) int {
+			return cmp.Or(
+				cmp.Compare(a.rng.Start.Line, b.rng.Start.Line),
+				cmp.Compare(a.rng.Start.Character, b.rng.Start.Character),
+				cmp.Compare(a.symbol, b.symbol),
+			)
+		})
+		occs = slices.CompactFunc(occs, func(a, b occurrence) bool {
+			return a.symbol == b.symbol && a.rng == b.rng
+		})
+		var rangeIDs []int
+		for _, occ := range occs {
+			rangeID := lw.vertex("range", map[string]any{"start": occ.rng.Start, "end": occ.rng.End})
+			rangeIDs = append(rangeIDs, rangeID)
+			sr, ok := results[occ.symbol]
+			if !ok {
+				sr = &symbolResult{
+					resultSet:   lw.vertex("resultSet", nil),
+					definitions: map[int][]int{},
+					references:  map[int][]int{},
+				}
+				results[occ.symbol] = sr
+				symbolOrder = append(symbolOrder, occ.symbol)
+			}
+			lw.edge("next", rangeID, sr.resultSet, nil)
+			if occ.isDefinition {
+				sr.definitions[docID] = append(sr.definitions[docID], rangeID)
+			} else {
+				sr.references[docID] = append(sr.references[docID], rangeID)
+			}
+		}
+		if len(rangeIDs) > 0 {
+			lw.edges("contains", docID, rangeIDs, nil)
+		}
+	}
+	if len(documents) > 0 {
+		lw.edges("contains", projectID, documents, nil)
+	}
+
+	for _, i := range symbolOrder {
+		sr := results[i]
+		moniker := c.moniker(symbols[i])
+		monikerID := lw.vertex("moniker", map[string]any{
+			"scheme":     moniker.Scheme,
+			"identifier": moniker.Identifier,
+			"unique":     moniker.Unique,
+			"kind":       *moniker.Kind,
+		})
+		lw.edge("moniker", sr.resultSet, monikerID, nil)
+
+		if len(sr.definitions) > 0 {
+			defID := lw.vertex("definitionResult", nil)
+			lw.edge("textDocument/definition", sr.resultSet, defID, nil)
+			for _, docID := range slices.Sorted(maps.Keys(sr.definitions)) {
+				lw.edges("item", defID, sr.definitions[docID], map[string]any{"document": docID})
+			}
+		}
+		refID := lw.vertex("referenceResult", nil)
+		lw.edge("textDocument/references", sr.resultSet, refID, nil)
+		for _, docID := range slices.Sorted(maps.Keys(sr.definitions)) {
+			lw.edges("item", refID, sr.definitions[docID], map[string]any{"document": docID, "property": "definitions"})
+		}
+		for _, docID := range slices.Sorted(maps.Keys(sr.references)) {
+			lw.edges("item", refID, sr.references[docID], map[string]any{"document": docID, "property": "references"})
+		}
+	}
+	return lw.err
+}
+
+// lsifWriter assigns ids to LSIF vertices and edges and writes them as JSON
+// lines. The first write error is kept and returned by ExportLSIF.
+type lsifWriter struct {
+	enc    *json.Encoder
+	nextID int
+	err    error
+}
+
+func (w *lsifWriter) emit(kind, label string, fields map[string]any) int {
+	w.nextID++
+	obj := map[string]any{"id": w.nextID, "type": kind, "label": label}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	if w.err == nil {
+		w.err = w.enc.Encode(obj)
+	}
+	return w.nextID
+}
+
+func (w *lsifWriter) vertex(label string, fields map[string]any) int {
+	return w.emit("vertex", label, fields)
+}
+
+func (w *lsifWriter) edge(label string, outV, inV int, fields map[string]any) int {
+	obj := map[string]any{"outV": outV, "inV": inV}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	return w.emit("edge", label, obj)
+}
+
+func (w *lsifWriter) edges(label string, outV int, inVs []int, fields map[string]any) int {
+	obj := map[string]any{"outV": outV, "inVs": inVs}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	return w.emit("edge", label, obj)
+}
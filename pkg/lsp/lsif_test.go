@@ -0,0 +1,120 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestExportLSIF(t *testing.T) {
+	c, workspace := newTestCache(t, map[string]string{
+		"a.proto": `syntax = "proto3";
+package a;
+message A {}
+`,
+		"b.proto": `syntax = "proto3";
+package b;
+import "a.proto";
+import "google/protobuf/timestamp.proto";
+message B {
+  a.A a = 1;
+  google.protobuf.Timestamp ts = 2;
+  repeated a.A more = 3;
+}
+`,
+	}, nil)
+
+	monikers, err := c.ComputeMonikers(context.Background(), c.Snapshot(), protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: protocol.URIFromPath(filepath.Join(workspace, "b.proto"))},
+		Position:     protocol.Position{Line: 6, Character: 20},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(monikers) != 1 || monikers[0].Identifier != "google.protobuf.Timestamp" || *monikers[0].Kind != protocol.Import {
+		t.Errorf("unexpected monikers: %+v", monikers)
+	}
+
+	var buf bytes.Buffer
+	if err := c.ExportLSIF(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	type element struct {
+		ID         int    `json:"id"`
+		Type       string `json:"type"`
+		Label      string `json:"label"`
+		URI        string `json:"uri"`
+		Identifier string `json:"identifier"`
+		Kind       string `json:"kind"`
+		OutV       int    `json:"outV"`
+		InV        int    `json:"inV"`
+		InVs       []int  `json:"inVs"`
+		Property   string `json:"property"`
+	}
+	var elements []element
+	byID := map[int]element{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e element
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := byID[e.ID]; ok {
+			t.Fatalf("duplicate id %d", e.ID)
+		}
+		for _, v := range append([]int{e.OutV, e.InV}, e.InVs...) {
+			if _, ok := byID[v]; v != 0 && !ok {
+				t.Fatalf("element %d refers to %d before it is defined", e.ID, v)
+			}
+		}
+		elements = append(elements, e)
+		byID[e.ID] = e
+	}
+
+	var documents int
+	monikerKinds := map[string]string{}
+	resultSets := map[string]int{}
+	for _, e := range elements {
+		switch {
+		case e.Label == "document":
+			documents++
+		case e.Label == "moniker" && e.Type == "edge":
+			m := byID[e.InV]
+			monikerKinds[m.Identifier] = m.Kind
+			resultSets[m.Identifier] = e.OutV
+		}
+	}
+	if documents != 2 {
+		t.Errorf("got %d documents, want 2", documents)
+	}
+	for identifier, kind := range map[string]string{
+		"a.A":                       "export",
+		"b.B":                       "export",
+		"b.B.ts":                    "export",
+		"google.protobuf.Timestamp": "import",
+	} {
+		if monikerKinds[identifier] != kind {
+			t.Errorf("moniker of %s: got kind %q, want %q", identifier, monikerKinds[identifier], kind)
+		}
+	}
+
+	// a.A is defined once and referenced twice
+	counts := map[string]int{}
+	for _, e := range elements {
+		if e.Label != "textDocument/references" || e.OutV != resultSets["a.A"] {
+			continue
+		}
+		for _, item := range elements {
+			if item.Label == "item" && item.OutV == e.InV {
+				counts[item.Property] += len(item.InVs)
+			}
+		}
+	}
+	if counts["definitions"] != 1 || counts["references"] != 2 {
+		t.Errorf("unexpected reference counts for a.A: %v", counts)
+	}
+}
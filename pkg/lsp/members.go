@@ -0,0 +1,61 @@
+package lsp
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FindMessageMembers returns the locations of the declarations of all fields
+// of the message at the given position, followed by the declarations of all
+// extensions of the message found in the workspace, ordered by field number.
+// If the position is on a field of message type, the members of that type are
+// returned.
+func (c *Cache) FindMessageMembers(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams) ([]protocol.Location, error) {
+	desc, _, err := c.FindTypeDescriptorAtLocation(ctx, snapshot, params)
+	if err != nil || desc == nil {
+		return nil, err
+	}
+	var msg protoreflect.MessageDescriptor
+	switch desc := desc.(type) {
+	case protoreflect.MessageDescriptor:
+		msg = desc
+	case protoreflect.FieldDescriptor:
+		msg = desc.Message()
+	}
+	if msg == nil {
+		return nil, nil
+	}
+
+	var members []protoreflect.FieldDescriptor
+	fields := msg.Fields()
+	for i := range fields.Len() {
+		members = append(members, fields.Get(i))
+	}
+	seen := map[protoreflect.FullName]bool{}
+	var extensions []protoreflect.FieldDescriptor
+	for _, ext := range c.FindExtensionsByMessage(msg.FullName()) {
+		if seen[ext.FullName()] {
+			continue
+		}
+		seen[ext.FullName()] = true
+		extensions = append(extensions, ext)
+	}
+	slices.SortFunc(extensions, func(a, b protoreflect.FieldDescriptor) int {
+		return cmp.Or(cmp.Compare(a.Number(), b.Number()), cmp.Compare(a.FullName(), b.FullName()))
+	})
+	members = append(members, extensions...)
+
+	locations := make([]protocol.Location, 0, len(members))
+	for _, fd := range members {
+		loc, err := c.FindDefinitionForTypeDescriptor(snapshot, fd)
+		if err != nil {
+			continue
+		}
+		locations = append(locations, loc)
+	}
+	return locations, nil
+}
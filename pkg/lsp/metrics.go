@@ -0,0 +1,203 @@
+package lsp
+
+import (
+	"cmp"
+	"encoding/json"
+	"expvar"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kralicky/protols/pkg/protocolext"
+)
+
+// metrics are published with expvar under the "protols" key, and can be
+// inspected at /debug/vars on the debug server.
+var metrics = struct {
+	filesCompiled         expvar.Int
+	compilations          expvar.Int
+	compilationsCoalesced expvar.Int
+	resolverLookups       hitRate
+	referenceQueries      latency
+	snapshotsInUse        expvar.Int
+
+	// time spent in each stage of compilation
+	resolveTime latency
+	compileTime latency
+	indexTime   latency
+	lintTime    latency
+	// how long acquired snapshots are used for, and how long each snapshot
+	// lives, from when it is published until it is replaced and no acquired
+	// use of it is ongoing
+	snapshotUseTime  latency
+	snapshotLifetime latency
+	// the most recent compile time of each file
+	fileCompileTimes fileTimings
+}{}
+
+func init() {
+	m := expvar.NewMap("protols")
+	m.Set("files_compiled", &metrics.filesCompiled)
+	m.Set("compilations", &metrics.compilations)
+	m.Set("compilations_coalesced", &metrics.compilationsCoalesced)
+	m.Set("resolver_lookups", &metrics.resolverLookups)
+	m.Set("reference_queries", &metrics.referenceQueries)
+	m.Set("resolve", &metrics.resolveTime)
+	m.Set("compile", &metrics.compileTime)
+	m.Set("index", &metrics.indexTime)
+	m.Set("lint", &metrics.lintTime)
+	m.Set("snapshots_in_use", &metrics.snapshotsInUse)
+	m.Set("snapshot_use", &metrics.snapshotUseTime)
+	m.Set("snapshot_lifetime", &metrics.snapshotLifetime)
+}
+
+// hitRate is an expvar.Var which counts cache hits and misses.
+type hitRate struct {
+	hits, misses atomic.Int64
+}
+
+func (h *hitRate) record(hit bool) {
+	if hit {
+		h.hits.Add(1)
+	} else {
+		h.misses.Add(1)
+	}
+}
+
+// String implements expvar.Var.
+func (h *hitRate) String() string {
+	hits, misses := h.hits.Load(), h.misses.Load()
+	var rate float64
+	if total := hits + misses; total > 0 {
+		rate = float64(hits) / float64(total)
+	}
+	b, _ := json.Marshal(map[string]any{
+		"hits":   hits,
+		"misses": misses,
+		"rate":   rate,
+	})
+	return string(b)
+}
+
+// latency is an expvar.Var which tracks the number, mean and maximum
+// duration of an operation.
+type latency struct {
+	count, total, max atomic.Int64
+}
+
+// since records the time elapsed since start.
+func (l *latency) since(start time.Time) {
+	d := int64(time.Since(start))
+	l.count.Add(1)
+	l.total.Add(d)
+	for {
+		prev := l.max.Load()
+		if d <= prev || l.max.CompareAndSwap(prev, d) {
+			return
+		}
+	}
+}
+
+// String implements expvar.Var.
+func (l *latency) String() string {
+	t := l.timing("")
+	b, _ := json.Marshal(map[string]any{
+		"count":   t.Count,
+		"mean_ms": t.MeanMs,
+		"max_ms":  t.MaxMs,
+	})
+	return string(b)
+}
+
+func (l *latency) timing(stage string) StageTiming {
+	count, total := l.count.Load(), l.total.Load()
+	var mean time.Duration
+	if count > 0 {
+		mean = time.Duration(total / count)
+	}
+	return StageTiming{
+		Stage:   stage,
+		Count:   count,
+		TotalMs: milliseconds(time.Duration(total)),
+		MeanMs:  milliseconds(mean),
+		MaxMs:   milliseconds(time.Duration(l.max.Load())),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return d.Seconds() * 1000
+}
+
+// fileTimings records how long the most recent compilation of each file took.
+type fileTimings struct {
+	mu    sync.Mutex
+	times map[string]time.Duration
+}
+
+func (f *fileTimings) record(path string, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.times == nil {
+		f.times = make(map[string]time.Duration)
+	}
+	f.times[path] = d
+}
+
+// slowest returns up to n files with the longest compile times, slowest
+// first.
+func (f *fileTimings) slowest(n int) []FileTiming {
+	f.mu.Lock()
+	files := make([]FileTiming, 0, len(f.times))
+	for path, d := range f.times {
+		files = append(files, FileTiming{Path: path, Milliseconds: milliseconds(d)})
+	}
+	f.mu.Unlock()
+	slices.SortFunc(files, func(a, b FileTiming) int {
+		if c := cmp.Compare(b.Milliseconds, a.Milliseconds); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return files[:min(n, len(files))]
+}
+
+const defaultSlowestFiles = 10
+
+type (
+	Metrics     = protocolext.Metrics
+	StageTiming = protocolext.StageTiming
+	MemoryUsage = protocolext.MemoryUsage
+	FileTiming  = protocolext.FileTiming
+)
+
+// CollectMetrics returns the current metrics, including up to slowestFiles
+// files with the longest compile times.
+func CollectMetrics(slowestFiles int) Metrics {
+	if slowestFiles <= 0 {
+		slowestFiles = defaultSlowestFiles
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return Metrics{
+		Stages: []StageTiming{
+			metrics.resolveTime.timing("resolve"),
+			metrics.compileTime.timing("compile"),
+			metrics.indexTime.timing("index"),
+			metrics.lintTime.timing("lint"),
+		},
+		ResolverHits:          metrics.resolverLookups.hits.Load(),
+		ResolverMisses:        metrics.resolverLookups.misses.Load(),
+		FilesCompiled:         metrics.filesCompiled.Value(),
+		Compilations:          metrics.compilations.Value(),
+		CompilationsCoalesced: metrics.compilationsCoalesced.Value(),
+		Memory: MemoryUsage{
+			HeapAllocBytes: mem.HeapAlloc,
+			HeapInuseBytes: mem.HeapInuse,
+			SysBytes:       mem.Sys,
+			NumGC:          mem.NumGC,
+		},
+		SlowestFiles: metrics.fileCompileTimes.slowest(slowestFiles),
+	}
+}
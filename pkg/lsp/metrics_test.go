@@ -0,0 +1,58 @@
+package lsp
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestFileTimingsSlowest(t *testing.T) {
+	var f fileTimings
+	f.record("a.proto", time.Millisecond)
+	f.record("b.proto", 3*time.Millisecond)
+	f.record("c.proto", 2*time.Millisecond)
+	f.record("a.proto", 2*time.Millisecond)
+
+	var paths []string
+	for _, ft := range f.slowest(2) {
+		paths = append(paths, ft.Path)
+	}
+	if !slices.Equal(paths, []string{"b.proto", "a.proto"}) {
+		t.Errorf("got %v, want [b.proto a.proto]", paths)
+	}
+	if n := len(f.slowest(10)); n != 3 {
+		t.Errorf("expected 3 files, got %d", n)
+	}
+}
+
+func TestCollectMetrics(t *testing.T) {
+	handler := memSchemeHandler{
+		"mem:///workspace/metrics.proto": "syntax = \"proto3\";\npackage metrics;\nmessage M {}\n",
+	}
+	c := NewCache(protocol.WorkspaceFolder{URI: "mem:///workspace"}, WithSchemeHandlers(map[string]SchemeHandler{"mem": handler}))
+	defer c.Close(nil)
+	c.resolver.UpdateURIPathMappings([]file.Modification{{URI: "mem:///workspace/metrics.proto", Action: file.Create}})
+	c.Compile(context.Background(), []string{"metrics.proto"})
+
+	m := CollectMetrics(1000)
+	var stages []string
+	for _, s := range m.Stages {
+		stages = append(stages, s.Stage)
+		if s.Count == 0 {
+			t.Errorf("expected the %s stage to be timed", s.Stage)
+		}
+	}
+	if !slices.Equal(stages, []string{"resolve", "compile", "index", "lint"}) {
+		t.Errorf("unexpected stages %v", stages)
+	}
+	if m.FilesCompiled == 0 || m.Compilations == 0 || m.Memory.HeapAllocBytes == 0 {
+		t.Errorf("missing counters: %+v", m)
+	}
+	if !slices.ContainsFunc(m.SlowestFiles, func(f FileTiming) bool { return f.Path == "metrics.proto" }) {
+		t.Errorf("expected metrics.proto in the slowest files, got %v", m.SlowestFiles)
+	}
+}
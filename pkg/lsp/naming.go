@@ -0,0 +1,212 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Lint rules which check the names of declarations against naming
+// conventions. These belong to the "naming" rule pack, which must be enabled
+// explicitly. The conventions default to those of the protobuf style guide,
+// and can be changed per kind of declaration with the lint.naming settings.
+
+const lintPackNaming = "naming"
+
+const (
+	namingKindMessage   = "message"
+	namingKindField     = "field"
+	namingKindOneof     = "oneof"
+	namingKindEnum      = "enum"
+	namingKindEnumValue = "enumValue"
+	namingKindService   = "service"
+	namingKindMethod    = "method"
+)
+
+type namingConvention struct {
+	pattern string
+	// a description of the default pattern, used in diagnostics
+	description string
+	// converts a name to the convention
+	convert func(words []string) string
+}
+
+var (
+	pascalCase = namingConvention{
+		pattern:     upperCamelCaseRegex.String(),
+		description: "PascalCase",
+		convert:     pascalCaseWords,
+	}
+	lowerSnakeCase = namingConvention{
+		pattern:     `^[a-z][a-z0-9]*(_[a-z0-9]+)*$`,
+		description: "lower_snake_case",
+		convert:     lowerSnakeCaseWords,
+	}
+	upperSnakeCase = namingConvention{
+		pattern:     `^[A-Z][A-Z0-9]*(_[A-Z0-9]+)*$`,
+		description: "UPPER_SNAKE_CASE",
+		convert:     upperSnakeCaseWords,
+	}
+)
+
+var defaultNamingConventions = map[string]namingConvention{
+	namingKindMessage:   pascalCase,
+	namingKindField:     lowerSnakeCase,
+	namingKindOneof:     lowerSnakeCase,
+	namingKindEnum:      pascalCase,
+	namingKindEnumValue: upperSnakeCase,
+	namingKindService:   pascalCase,
+	namingKindMethod:    pascalCase,
+}
+
+// lintNamingConventions reports declarations whose names do not match the
+// naming convention for their kind, and enum values which are not prefixed
+// with the name of their enum. Where the name can be converted to match, a
+// quick fix renames the declaration and its references.
+func lintNamingConventions(ctx context.Context, p *lintPass) {
+	settings := &p.settings.Lint.Naming
+	patterns := map[string]*regexp.Regexp{}
+	for kind, convention := range defaultNamingConventions {
+		pattern := convention.pattern
+		if custom, ok := settings.Patterns[kind]; ok {
+			pattern = custom
+		}
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			slog.Debug("invalid naming convention pattern", "kind", kind, "pattern", pattern, "error", err)
+			continue
+		}
+		patterns[kind] = re
+	}
+
+	p.result.RangeDescriptors(ctx, func(desc protoreflect.Descriptor) bool {
+		var kind string
+		switch desc := desc.(type) {
+		case protoreflect.MessageDescriptor:
+			if desc.IsMapEntry() {
+				return true
+			}
+			kind = namingKindMessage
+		case protoreflect.FieldDescriptor:
+			if desc.Kind() == protoreflect.GroupKind {
+				return true
+			}
+			kind = namingKindField
+		case protoreflect.OneofDescriptor:
+			if desc.IsSynthetic() {
+				return true
+			}
+			kind = namingKindOneof
+		case protoreflect.EnumDescriptor:
+			kind = namingKindEnum
+		case protoreflect.EnumValueDescriptor:
+			kind = namingKindEnumValue
+		case protoreflect.ServiceDescriptor:
+			kind = namingKindService
+		case protoreflect.MethodDescriptor:
+			kind = namingKindMethod
+		default:
+			return true
+		}
+		name := string(desc.Name())
+		re, hasPattern := patterns[kind]
+		matches := !hasPattern || re.MatchString(name)
+
+		var prefix string
+		if ev, ok := desc.(protoreflect.EnumValueDescriptor); ok && settings.GetEnumValuePrefix() {
+			prefix = upperSnakeCaseWords(nameWords(string(ev.Parent().Name()))) + "_"
+		}
+		hasPrefix := strings.HasPrefix(name, prefix)
+		if matches && hasPrefix {
+			return true
+		}
+
+		ref, err := findDefinition(desc, p.result)
+		if err != nil || !ref.NodeInfo.IsValid() {
+			return true
+		}
+		convention := defaultNamingConventions[kind]
+		var problems []string
+		if !matches {
+			if re.String() == convention.pattern {
+				problems = append(problems, "should be "+convention.description)
+			} else {
+				problems = append(problems, fmt.Sprintf("should match %q", re.String()))
+			}
+		}
+		if !hasPrefix {
+			problems = append(problems, fmt.Sprintf("should be prefixed with %s", prefix))
+		}
+		d := p.reportSpan(ref.NodeInfo, "%s name %s %s", kindDisplayName(kind), name, strings.Join(problems, " and "))
+
+		newName := convention.convert(nameWords(name))
+		if prefix != "" && !strings.HasPrefix(newName, prefix) {
+			newName = prefix + newName
+		}
+		if newName != name && (!hasPattern || re.MatchString(newName)) && protoreflect.Name(newName).IsValid() {
+			d.Metadata[diagnosticRenameTo] = newName
+		}
+		return true
+	})
+}
+
+func kindDisplayName(kind string) string {
+	if kind == namingKindEnumValue {
+		return "enum value"
+	}
+	return kind
+}
+
+// nameWords splits a name into words at underscores and case changes. Unlike
+// splitNameWords, digits are kept as part of the preceding word.
+func nameWords(name string) []string {
+	var words []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '_' {
+			flush()
+			continue
+		}
+		if i > 0 && isUpper(c) {
+			prev := name[i-1]
+			if isLower(prev) || (prev >= '0' && prev <= '9') ||
+				(isUpper(prev) && i+1 < len(name) && isLower(name[i+1])) {
+				flush()
+			}
+		}
+		word.WriteByte(c)
+	}
+	flush()
+	return words
+}
+
+func pascalCaseWords(words []string) string {
+	var sb strings.Builder
+	for _, w := range words {
+		w = strings.ToLower(w)
+		sb.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	return sb.String()
+}
+
+func lowerSnakeCaseWords(words []string) string {
+	return strings.ToLower(strings.Join(words, "_"))
+}
+
+func upperSnakeCaseWords(words []string) string {
+	return strings.ToUpper(strings.Join(words, "_"))
+}
@@ -0,0 +1,28 @@
+package lsp
+
+import "testing"
+
+func TestNamingConversions(t *testing.T) {
+	for _, tc := range []struct {
+		name                     string
+		pascal, snake, screaming string
+	}{
+		{"user_profile", "UserProfile", "user_profile", "USER_PROFILE"},
+		{"DisplayName", "DisplayName", "display_name", "DISPLAY_NAME"},
+		{"HTTPServer", "HttpServer", "http_server", "HTTP_SERVER"},
+		{"field2Name", "Field2Name", "field2_name", "FIELD2_NAME"},
+		{"COLOR_BLUE", "ColorBlue", "color_blue", "COLOR_BLUE"},
+		{"_leading", "Leading", "leading", "LEADING"},
+	} {
+		words := nameWords(tc.name)
+		if got := pascalCaseWords(words); got != tc.pascal {
+			t.Errorf("pascalCaseWords(%q) = %q, want %q", tc.name, got, tc.pascal)
+		}
+		if got := lowerSnakeCaseWords(words); got != tc.snake {
+			t.Errorf("lowerSnakeCaseWords(%q) = %q, want %q", tc.name, got, tc.snake)
+		}
+		if got := upperSnakeCaseWords(words); got != tc.screaming {
+			t.Errorf("upperSnakeCaseWords(%q) = %q, want %q", tc.name, got, tc.screaming)
+		}
+	}
+}
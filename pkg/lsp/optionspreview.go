@@ -0,0 +1,132 @@
+package lsp
+
+import (
+	"fmt"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// tryHoverInterpretedOptions returns a hover showing the interpreted options
+// of the declaration enclosing the 'option' keyword or compact options
+// brackets at the given position, if enabled in the settings.
+func (c *Cache) tryHoverInterpretedOptions(snapshot *Snapshot, params protocol.TextDocumentPositionParams) *protocol.Hover {
+	if !c.settings.Load().Hover.InterpretedOptions {
+		return nil
+	}
+	// options are only interpreted in fully linked results
+	res, err := snapshot.FindResultByURI(params.TextDocument.URI)
+	if err != nil {
+		return nil
+	}
+	fileNode := res.AST()
+	if fileNode == nil {
+		return nil
+	}
+	mapper, err := c.GetMapper(params.TextDocument.URI)
+	if err != nil {
+		return nil
+	}
+	offset, err := mapper.PositionOffset(params.Position)
+	if err != nil {
+		return nil
+	}
+	token, comment := fileNode.ItemAtOffset(offset)
+	if token == ast.TokenError || comment.IsValid() {
+		return nil
+	}
+
+	var decl, hovered ast.Node
+	compact := false
+	ast.Inspect(fileNode, func(node ast.Node) bool {
+		if hovered != nil {
+			return false
+		}
+		switch node := node.(type) {
+		case *ast.OptionNode:
+			if node.Keyword != nil && node.Keyword.GetToken() == token {
+				hovered = node.Keyword
+			}
+			return false
+		case *ast.CompactOptionsNode:
+			if node.OpenBracket.GetToken() == token || node.CloseBracket.GetToken() == token {
+				hovered, compact = node, true
+			}
+			return false
+		case *ast.FileNode, *ast.MessageNode, *ast.GroupNode, *ast.FieldNode, *ast.MapFieldNode,
+			*ast.OneofNode, *ast.EnumNode, *ast.EnumValueNode, *ast.ServiceNode, *ast.RPCNode:
+			decl = node
+		case *ast.ExtensionRangeNode:
+			// all ranges in the declaration share the same options
+			if len(node.Elements) > 0 && node.Elements[0].GetRange() != nil {
+				decl = node.Elements[0].GetRange()
+			}
+		}
+		return true
+	}, ast.WithIntersection(token))
+	if hovered == nil || decl == nil {
+		return nil
+	}
+	if _, isGroup := decl.(*ast.GroupNode); isGroup && !compact {
+		// option statements in the body of a group belong to its message, which
+		// has no node of its own
+		return nil
+	}
+
+	descProto := res.Descriptor(decl)
+	if descProto == nil {
+		return nil
+	}
+	text, name, ok := interpretedOptionsText(res, descProto)
+	if !ok {
+		return nil
+	}
+	value := fmt.Sprintf("`%s`", name)
+	if text == "" {
+		value += " (empty)"
+	} else {
+		value += fmt.Sprintf("\n```textproto\n%s```\n", text)
+	}
+	return &protocol.Hover{
+		Contents: protocol.MarkupContent{
+			Kind:  protocol.Markdown,
+			Value: value,
+		},
+		Range: toRange(fileNode.NodeInfo(hovered)),
+	}
+}
+
+// interpretedOptionsText returns the options of a descriptor proto in text
+// format, and the full name of the options message. Custom options are stored
+// as unknown fields, so the options are round-tripped through the wire format
+// with a resolver for the extensions visible from the file.
+func interpretedOptionsText(res linker.Result, descProto proto.Message) (string, string, bool) {
+	msg := descProto.ProtoReflect()
+	optionsField := msg.Descriptor().Fields().ByName("options")
+	if optionsField == nil || optionsField.Message() == nil {
+		return "", "", false
+	}
+	options := msg.Get(optionsField).Message()
+	name := string(optionsField.Message().FullName())
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(options.Interface())
+	if err != nil {
+		return "", "", false
+	}
+	interpreted := options.Type().New().Interface()
+	if err := (proto.UnmarshalOptions{Resolver: linker.ResolverFromFile(res)}).Unmarshal(data, interpreted); err != nil {
+		return "", "", false
+	}
+	// any options which failed to be interpreted were already reported
+	if opts, ok := interpreted.(interface {
+		GetUninterpretedOption() []*descriptorpb.UninterpretedOption
+	}); ok && len(opts.GetUninterpretedOption()) > 0 {
+		return "", "", false
+	}
+	text := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Format(interpreted)
+	return text, name, true
+}
@@ -0,0 +1,80 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestHoverInterpretedOptions(t *testing.T) {
+	const source = `syntax = "proto3";
+package ui;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.MessageOptions {
+  string label = 50000;
+}
+extend google.protobuf.FieldOptions {
+  int32 width = 50001;
+}
+message Button {
+  option (label) = "button";
+  option deprecated = true;
+  string text = 1 [(width) = 10, json_name = "t"];
+}
+`
+	c, workspace := newTestCache(t, map[string]string{"ui.proto": source}, nil)
+	uri := protocol.URIFromPath(filepath.Join(workspace, "ui.proto"))
+
+	hoverAt := func(line, char uint32) *protocol.Hover {
+		return c.tryHoverInterpretedOptions(c.Snapshot(), protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: line, Character: char},
+		})
+	}
+	if hoverAt(10, 3) != nil {
+		t.Fatal("interpreted options should only be shown when enabled")
+	}
+	c.DidChangeConfiguration(context.Background(), Settings{Hover: HoverSettings{InterpretedOptions: true}})
+
+	hover, err := c.ComputeHover(context.Background(), c.Snapshot(), protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     protocol.Position{Line: 10, Character: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hover == nil {
+		t.Fatal("expected a hover on the option keyword")
+	}
+	value := strings.Join(strings.Fields(hover.Contents.Value), " ")
+	for _, want := range []string{"`google.protobuf.MessageOptions`", `deprecated: true`, `[ui.label]: "button"`} {
+		if !strings.Contains(value, want) {
+			t.Errorf("expected %q in hover:\n%s", want, hover.Contents.Value)
+		}
+	}
+	if hover.Range.Start != (protocol.Position{Line: 10, Character: 2}) || hover.Range.End != (protocol.Position{Line: 10, Character: 8}) {
+		t.Errorf("unexpected range %v", hover.Range)
+	}
+
+	hover = hoverAt(12, 18)
+	if hover == nil {
+		t.Fatal("expected a hover on the compact options bracket")
+	}
+	value = strings.Join(strings.Fields(hover.Contents.Value), " ")
+	for _, want := range []string{"`google.protobuf.FieldOptions`", `[ui.width]: 10`} {
+		if !strings.Contains(value, want) {
+			t.Errorf("expected %q in hover:\n%s", want, hover.Contents.Value)
+		}
+	}
+	// json_name is a field of the descriptor, not an option
+	if strings.Contains(value, "json_name") {
+		t.Errorf("unexpected json_name in hover:\n%s", hover.Contents.Value)
+	}
+
+	if hoverAt(12, 10) != nil {
+		t.Error("expected no interpreted options hover on a field name")
+	}
+}
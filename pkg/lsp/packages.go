@@ -11,30 +11,38 @@ import (
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-func (c *Cache) TryFindPackageReferences(params protocol.TextDocumentPositionParams) []protocol.Location {
-	parseRes, err := c.FindParseResultByURI(params.TextDocument.URI)
+func (c *Cache) TryFindPackageReferences(snapshot *Snapshot, params protocol.TextDocumentPositionParams) []protocol.Location {
+	locations, _ := c.tryFindPackageReferences(snapshot, params)
+	return locations
+}
+
+// tryFindPackageReferences returns the references to the package name, or
+// the prefix of the package name, at the given position, and the range of the
+// name or prefix.
+func (c *Cache) tryFindPackageReferences(snapshot *Snapshot, params protocol.TextDocumentPositionParams) ([]protocol.Location, protocol.Range) {
+	parseRes, err := snapshot.FindParseResultByURI(params.TextDocument.URI)
 	if err != nil {
-		return nil
+		return nil, protocol.Range{}
 	}
 
 	mapper, err := c.GetMapper(params.TextDocument.URI)
 	if err != nil {
-		return nil
+		return nil, protocol.Range{}
 	}
 
 	offset, err := mapper.PositionOffset(params.Position)
 	if err != nil {
-		return nil
+		return nil, protocol.Range{}
 	}
 
 	fileNode := parseRes.AST()
 	if fileNode == nil {
-		return nil
+		return nil, protocol.Range{}
 	}
 
 	tokenAtOffset, comment := fileNode.ItemAtOffset(offset)
 	if tokenAtOffset == ast.TokenError || comment.IsValid() {
-		return nil
+		return nil, protocol.Range{}
 	}
 
 LOOP:
@@ -44,7 +52,7 @@ LOOP:
 				if tokenAtOffset >= decl.Name.Start() && tokenAtOffset <= decl.Name.End() {
 					switch name := decl.Name.Unwrap().(type) {
 					case *ast.IdentNode:
-						return c.FindPackageNameRefs(protoreflect.FullName(name.Val), false)
+						return c.FindPackageNameRefs(protoreflect.FullName(name.Val), false), toRange(fileNode.NodeInfo(name))
 					case *ast.CompoundIdentNode:
 						idents := name.FilterIdents()
 						for i, ident := range idents {
@@ -53,7 +61,11 @@ LOOP:
 								for j := 0; j <= i; j++ {
 									parts = append(parts, idents[j].Val)
 								}
-								return c.FindPackageNameRefs(protoreflect.FullName(strings.Join(parts, ".")), i < len(idents)-1)
+								origin := protocol.Range{
+									Start: toRange(fileNode.NodeInfo(idents[0])).Start,
+									End:   toRange(fileNode.NodeInfo(ident)).End,
+								}
+								return c.FindPackageNameRefs(protoreflect.FullName(strings.Join(parts, ".")), i < len(idents)-1), origin
 							}
 						}
 					}
@@ -62,7 +74,7 @@ LOOP:
 			break LOOP
 		}
 	}
-	return nil
+	return nil, protocol.Range{}
 }
 
 func (c *Cache) FindPackageNameRefs(name protoreflect.FullName, prefixMatch bool) []protocol.Location {
@@ -136,8 +148,8 @@ func (c *Cache) FindPackageNameRefs(name protoreflect.FullName, prefixMatch bool
 	return locations
 }
 
-func (c *Cache) tryHoverPackageNode(params protocol.TextDocumentPositionParams) *protocol.Hover {
-	parseRes, err := c.FindParseResultByURI(params.TextDocument.URI)
+func (c *Cache) tryHoverPackageNode(snapshot *Snapshot, params protocol.TextDocumentPositionParams) *protocol.Hover {
+	parseRes, err := snapshot.FindParseResultByURI(params.TextDocument.URI)
 	if err != nil {
 		return nil
 	}
@@ -223,3 +235,49 @@ LOOP:
 	}
 	return nil
 }
+
+// findPackageNameAtLocation returns the full name of the package declared in
+// the document if the position is within the name in its package statement.
+func (c *Cache) findPackageNameAtLocation(snapshot *Snapshot, params protocol.TextDocumentPositionParams) (protoreflect.FullName, protocol.Range, bool) {
+	parseRes, err := snapshot.FindParseResultByURI(params.TextDocument.URI)
+	if err != nil {
+		return "", protocol.Range{}, false
+	}
+
+	mapper, err := c.GetMapper(params.TextDocument.URI)
+	if err != nil {
+		return "", protocol.Range{}, false
+	}
+
+	offset, err := mapper.PositionOffset(params.Position)
+	if err != nil {
+		return "", protocol.Range{}, false
+	}
+
+	fileNode := parseRes.AST()
+	if fileNode == nil {
+		return "", protocol.Range{}, false
+	}
+
+	tokenAtOffset, comment := fileNode.ItemAtOffset(offset)
+	if tokenAtOffset == ast.TokenError || comment.IsValid() {
+		return "", protocol.Range{}, false
+	}
+
+	for _, decl := range fileNode.Decls {
+		if decl := decl.GetPackage(); decl != nil {
+			if decl.Name == nil {
+				return "", protocol.Range{}, false
+			}
+			if tokenAtOffset < decl.Name.Start() || tokenAtOffset > decl.Name.End() {
+				return "", protocol.Range{}, false
+			}
+			info := fileNode.NodeInfo(decl.Name)
+			if !info.IsValid() {
+				return "", protocol.Range{}, false
+			}
+			return protoreflect.FullName(decl.Name.AsIdentifier()), toRange(info), true
+		}
+	}
+	return "", protocol.Range{}, false
+}
@@ -0,0 +1,134 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/kralicky/protocompile"
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protocompile/parser"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protopath"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Hover, definition, highlight and code actions are typically requested for
+// the same position in quick succession, and each of them walks the AST to
+// find the path at that position. Each document keeps the results of its most
+// recent searches, keyed by the version of the document that was searched and
+// the position searched for. A document's memo is dropped when it is changed,
+// closed or recompiled.
+const pathMemoSize = 32
+
+// pathMemo holds the results of recent path searches in a single document.
+type pathMemo struct {
+	intersecting memo[intersectingPathKey, intersectingPathResult]
+	deep         memo[deepPathKey, deepPathResult]
+}
+
+type intersectingPathKey struct {
+	version  int32
+	token    ast.Token
+	location protocol.Position
+}
+
+type intersectingPathResult struct {
+	values protopath.Values
+	found  bool
+}
+
+type deepPathKey struct {
+	version int32
+	// version of the linked result, or -1 if there is none. While a document
+	// has errors, its latest AST is searched against an older linked result.
+	linkVersion int32
+	path        string
+}
+
+type deepPathResult struct {
+	desc protoreflect.Descriptor
+	rng  protocol.Range
+	err  error
+}
+
+// pathMemo returns the path search memo for the document at the given path.
+func (c *Cache) pathMemo(path string) *pathMemo {
+	if m, ok := c.pathMemos.Load(protocompile.ResolvedPath(path)); ok {
+		return m
+	}
+	m, _ := c.pathMemos.LoadOrStore(protocompile.ResolvedPath(path), &pathMemo{})
+	return m
+}
+
+// clearPathMemo drops the path search memo for the document at the given path.
+func (c *Cache) clearPathMemo(path string) {
+	c.pathMemos.Delete(protocompile.ResolvedPath(path))
+}
+
+// findPathIntersectingToken is a memoized wrapper around
+// computePathIntersectingToken.
+func (c *Cache) findPathIntersectingToken(parseRes parser.Result, tokenAtOffset ast.Token, location protocol.Position) (protopath.Values, bool) {
+	m := c.pathMemo(parseRes.AST().Name())
+	key := intersectingPathKey{version: parseRes.AST().Version(), token: tokenAtOffset, location: location}
+	if res, ok := m.intersecting.get(key); ok {
+		return res.values, res.found
+	}
+	values, found := computePathIntersectingToken(parseRes, tokenAtOffset, location)
+	m.intersecting.put(key, intersectingPathResult{values: values, found: found})
+	return values, found
+}
+
+// deepPathSearch is a memoized wrapper around computeDeepPathSearch. Results
+// of searches interrupted by the context are not kept.
+func (c *Cache) deepPathSearch(ctx context.Context, path protopath.Path, parseRes parser.Result, linkRes linker.Result) (protoreflect.Descriptor, protocol.Range, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, protocol.Range{}, err
+	}
+	m := c.pathMemo(parseRes.AST().Name())
+	key := deepPathKey{version: parseRes.AST().Version(), linkVersion: -1, path: path.String()}
+	if linkRes != nil {
+		key.linkVersion = linkRes.AST().Version()
+	}
+	if res, ok := m.deep.get(key); ok {
+		return res.desc, res.rng, res.err
+	}
+	desc, rng, err := computeDeepPathSearch(ctx, path, parseRes, linkRes)
+	if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		m.deep.put(key, deepPathResult{desc: desc, rng: rng, err: err})
+	}
+	return desc, rng, err
+}
+
+// memo is a small fixed-size cache which evicts its oldest entry when full.
+type memo[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries [pathMemoSize]memoEntry[K, V]
+	next    int
+}
+
+type memoEntry[K comparable, V any] struct {
+	key   K
+	value V
+	ok    bool
+}
+
+func (m *memo[K, V]) get(key K) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.entries {
+		if e.ok && e.key == key {
+			return e.value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+func (m *memo[K, V]) put(key K, value V) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[m.next] = memoEntry[K, V]{key: key, value: value, ok: true}
+	m.next = (m.next + 1) % len(m.entries)
+}
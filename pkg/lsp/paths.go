@@ -0,0 +1,81 @@
+package lsp
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+type (
+	PathMapping           = protocolext.PathMapping
+	WorkspacePathMappings = protocolext.WorkspacePathMappings
+)
+
+// PathMappings returns the resolver's URI to canonical path mappings, sorted
+// by path.
+func (r *Resolver) PathMappings() []PathMapping {
+	r.pathsMu.RLock()
+	defer r.pathsMu.RUnlock()
+	mappings := make([]PathMapping, 0, len(r.filePathsByURI))
+	for uri, path := range r.filePathsByURI {
+		reverse, ok := r.fileURIsByPath[path]
+		mappings = append(mappings, PathMapping{
+			URI:          uri,
+			Path:         path,
+			Source:       r.importSourcesByURI[uri].String(),
+			Inconsistent: !ok || reverse != uri,
+		})
+	}
+	for path, uri := range r.fileURIsByPath {
+		if forward, ok := r.filePathsByURI[uri]; ok && forward == path {
+			continue
+		}
+		mappings = append(mappings, PathMapping{
+			URI:          uri,
+			Path:         path,
+			Source:       r.importSourcesByURI[uri].String(),
+			Inconsistent: true,
+		})
+	}
+	slices.SortFunc(mappings, func(a, b PathMapping) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.URI, b.URI))
+	})
+	return mappings
+}
+
+// PathMappings returns the path mappings of the cache's resolver.
+func (c *Cache) PathMappings() WorkspacePathMappings {
+	return WorkspacePathMappings{
+		Workspace: protocol.DocumentURI(c.workspace.URI).Path(),
+		Mappings:  c.resolver.PathMappings(),
+	}
+}
+
+// WritePathMappings writes the path mappings of each workspace as a table.
+// Inconsistent mappings are marked with an asterisk.
+func WritePathMappings(w io.Writer, workspaces []WorkspacePathMappings) error {
+	for i, ws := range workspaces {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s (%d mappings)\n", ws.Workspace, len(ws.Mappings))
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "  PATH\tSOURCE\tURI")
+		for _, m := range ws.Mappings {
+			marker := " "
+			if m.Inconsistent {
+				marker = "*"
+			}
+			fmt.Fprintf(tw, "%s %s\t%s\t%s\n", marker, m.Path, m.Source, m.URI)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
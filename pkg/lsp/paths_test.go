@@ -0,0 +1,46 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestPathMappings(t *testing.T) {
+	r := NewResolver(protocol.WorkspaceFolder{URI: "file:///workspace"})
+	r.filePathsByURI["file:///workspace/b.proto"] = "b.proto"
+	r.fileURIsByPath["b.proto"] = "file:///workspace/b.proto"
+	r.importSourcesByURI["file:///workspace/b.proto"] = SourceRelativePath
+	// moved from a.proto to c.proto, but the reverse mapping was not updated
+	r.filePathsByURI["file:///workspace/c.proto"] = "example.com/c.proto"
+	r.fileURIsByPath["example.com/a.proto"] = "file:///workspace/c.proto"
+	r.importSourcesByURI["file:///workspace/c.proto"] = SourceLocalGoModule
+
+	want := []PathMapping{
+		{URI: "file:///workspace/b.proto", Path: "b.proto", Source: "relative path"},
+		{URI: "file:///workspace/c.proto", Path: "example.com/a.proto", Source: "local go module", Inconsistent: true},
+		{URI: "file:///workspace/c.proto", Path: "example.com/c.proto", Source: "local go module", Inconsistent: true},
+	}
+	got := r.PathMappings()
+	if len(got) != len(want) {
+		t.Fatalf("got %d mappings, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("mapping %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	var buf strings.Builder
+	if err := WritePathMappings(&buf, []WorkspacePathMappings{{Workspace: "/workspace", Mappings: got}}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 || lines[0] != "/workspace (3 mappings)" {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+	if !strings.HasPrefix(lines[2], "  b.proto") || !strings.HasPrefix(lines[3], "* example.com/a.proto") {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
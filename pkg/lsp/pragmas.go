@@ -14,6 +14,7 @@ const (
 	PragmaNoFormat   = "nofmt"
 	PragmaNoGenerate = "nogen"
 	PragmaDebug      = "debug"
+	PragmaLint       = "lint" // space-separated list of lint rule packs to enable
 
 	PragmaDebugWnoerror = "Wnoerror"
 	WnoerrorAll         = "all"
@@ -0,0 +1,229 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// importVisibilityActions offers to rewrite the import at the start of the
+// requested range. An import which the file does not use itself, but which
+// files importing it also import directly, can be re-exported with import
+// public. A public import can be flattened into direct imports in each file
+// which depends on it.
+func (c *Cache) importVisibilityActions(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper) []protocol.CodeAction {
+	if !c.resolver.IsRealWorkspaceLocalFile(mapper.URI) {
+		return nil
+	}
+	fileNode := linkRes.AST()
+	offset, err := mapper.PositionOffset(request.Range.Start)
+	if err != nil {
+		return nil
+	}
+	imp := importAtOffset(fileNode, offset)
+	if imp == nil || imp.Name == nil || imp.Weak != nil {
+		return nil
+	}
+	target := path.Clean(imp.Name.AsString())
+	if imp.Public != nil {
+		title := fmt.Sprintf("Replace import public %q with direct imports", target)
+		return []protocol.CodeAction{
+			actionQueue.enqueue(title, protocol.RefactorRewrite, mapper.URI, fileNode.Version(), func(ca *protocol.CodeAction) error {
+				edit, err := c.flattenPublicImport(ctx, linkRes, imp)
+				if err != nil {
+					return err
+				}
+				ca.Edit = edit
+				return nil
+			}),
+		}
+	}
+	if usesImport(linkRes, target) || len(c.reexportConsumers(linkRes.Path(), target)) == 0 {
+		return nil
+	}
+	title := fmt.Sprintf("Re-export %q with import public", target)
+	return []protocol.CodeAction{
+		actionQueue.enqueue(title, protocol.RefactorRewrite, mapper.URI, fileNode.Version(), func(ca *protocol.CodeAction) error {
+			edit, err := c.makeImportPublic(ctx, linkRes, imp)
+			if err != nil {
+				return err
+			}
+			ca.Edit = edit
+			return nil
+		}),
+	}
+}
+
+// makeImportPublic computes the edits which change an import into a public
+// import, and remove the now redundant imports of the same file from the
+// files which import this one.
+func (c *Cache) makeImportPublic(ctx context.Context, linkRes linker.Result, imp *ast.ImportNode) (*protocol.WorkspaceEdit, error) {
+	fileNode := linkRes.AST()
+	uri, err := c.resolver.PathToURI(linkRes.Path())
+	if err != nil {
+		return nil, err
+	}
+	target := path.Clean(imp.Name.AsString())
+	changes := map[protocol.DocumentURI][]protocol.TextEdit{
+		uri: {{
+			Range:   pointToRange(fileNode.NodeInfo(imp.Keyword).End()),
+			NewText: " public",
+		}},
+	}
+	for _, consumer := range c.reexportConsumers(linkRes.Path(), target) {
+		consumerURI, err := c.resolver.PathToURI(consumer.Path())
+		if err != nil {
+			return nil, err
+		}
+		consumerAST := consumer.AST()
+		for _, decl := range consumerAST.Decls {
+			if other := decl.GetImport(); other != nil && other.Name != nil && path.Clean(other.Name.AsString()) == target {
+				changes[consumerURI] = append(changes[consumerURI], protocol.TextEdit{Range: declLineRange(consumerAST, other)})
+			}
+		}
+	}
+	return c.versionedWorkspaceEdit(ctx, changes)
+}
+
+// flattenPublicImport computes the edits which replace a public import with a
+// direct import in each file that references declarations through it. The
+// import is kept as a plain import if the file uses it, and removed otherwise.
+func (c *Cache) flattenPublicImport(ctx context.Context, linkRes linker.Result, imp *ast.ImportNode) (*protocol.WorkspaceEdit, error) {
+	fileNode := linkRes.AST()
+	from := linkRes.Path()
+	uri, err := c.resolver.PathToURI(from)
+	if err != nil {
+		return nil, err
+	}
+	target := path.Clean(imp.Name.AsString())
+	var targetFile protoreflect.FileDescriptor
+	imports := linkRes.Imports()
+	for i := range imports.Len() {
+		if imports.Get(i).Path() == target {
+			targetFile = imports.Get(i).FileDescriptor
+		}
+	}
+	if targetFile == nil {
+		return nil, fmt.Errorf("%s does not import %s", from, target)
+	}
+	provided := map[string]bool{}
+	for _, f := range publicImportClosure(targetFile) {
+		provided[f.Path()] = true
+	}
+
+	changes := map[protocol.DocumentURI][]protocol.TextEdit{}
+	if usesImport(linkRes, target) {
+		// remove "public" and the whitespace following it
+		changes[uri] = []protocol.TextEdit{{
+			Range: positionsToRange(fileNode.NodeInfo(imp.Public).Start(), fileNode.NodeInfo(imp.Name).Start()),
+		}}
+	} else {
+		changes[uri] = []protocol.TextEdit{{Range: declLineRange(fileNode, imp)}}
+	}
+
+	var dependents []linker.Result
+	c.resultsMu.RLock()
+	for _, res := range c.results {
+		if res.IsPlaceholder() || res.Path() == from || !importsFile(res, from) {
+			continue
+		}
+		dependents = append(dependents, res.(linker.Result))
+	}
+	c.resultsMu.RUnlock()
+
+	needsImport := map[string]linker.Result{}
+	for _, res := range dependents {
+		if hasImport(res.AST(), target) {
+			continue
+		}
+		direct := map[string]protoreflect.FileDescriptor{}
+		resImports := res.Imports()
+		for i := range resImports.Len() {
+			direct[resImports.Get(i).Path()] = resImports.Get(i).FileDescriptor
+		}
+		for _, ref := range fileReferences(res) {
+			if !provided[ref.desc.ParentFile().Path()] || ref.via == res.Path() {
+				continue
+			}
+			if via, ok := direct[ref.via]; ok && slices.ContainsFunc(publicImportClosure(via), func(f protoreflect.FileDescriptor) bool {
+				return f.Path() == from
+			}) {
+				needsImport[res.Path()] = res
+				break
+			}
+		}
+	}
+	for _, filename := range slices.Sorted(maps.Keys(needsImport)) {
+		depURI, err := c.resolver.PathToURI(filename)
+		if err != nil {
+			return nil, err
+		}
+		if !c.resolver.IsRealWorkspaceLocalFile(depURI) {
+			return nil, fmt.Errorf("%s depends on the public import of %s, but is outside of the workspace", filename, target)
+		}
+		changes[depURI] = append(changes[depURI], editAddImport(needsImport[filename], target))
+	}
+	return c.versionedWorkspaceEdit(ctx, changes)
+}
+
+// reexportConsumers returns the files which import both from and target
+// directly, and would see target through from if it were imported publicly.
+func (c *Cache) reexportConsumers(from, target string) []linker.Result {
+	c.resultsMu.RLock()
+	defer c.resultsMu.RUnlock()
+	var consumers []linker.Result
+	for _, res := range c.results {
+		if res.IsPlaceholder() {
+			continue
+		}
+		var importsFrom, importsTarget bool
+		imports := res.Imports()
+		for i := range imports.Len() {
+			imp := imports.Get(i)
+			switch {
+			case imp.IsWeak:
+			case imp.Path() == from:
+				importsFrom = true
+			case imp.Path() == target && !imp.IsPublic:
+				importsTarget = true
+			}
+		}
+		if importsFrom && importsTarget {
+			consumers = append(consumers, res.(linker.Result))
+		}
+	}
+	slices.SortFunc(consumers, func(a, b linker.Result) int {
+		return strings.Compare(a.Path(), b.Path())
+	})
+	return consumers
+}
+
+// usesImport reports whether the file references any declaration made
+// visible by its import of target.
+func usesImport(linkRes linker.Result, target string) bool {
+	return slices.ContainsFunc(fileReferences(linkRes), func(ref fileReference) bool {
+		return ref.via == target
+	})
+}
+
+func importAtOffset(fileNode *ast.FileNode, offset int) *ast.ImportNode {
+	for _, decl := range fileNode.Decls {
+		imp := decl.GetImport()
+		if imp == nil {
+			continue
+		}
+		info := fileNode.NodeInfo(imp)
+		if offset >= info.Start().Offset && offset <= info.End().Offset {
+			return imp
+		}
+	}
+	return nil
+}
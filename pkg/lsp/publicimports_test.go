@@ -0,0 +1,105 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestImportVisibilityActions(t *testing.T) {
+	c, workspace := newTestCache(t, map[string]string{
+		"types.proto": `syntax = "proto3";
+package ui;
+message Size {
+  int32 width = 1;
+}
+`,
+		"widgets.proto": `syntax = "proto3";
+package ui;
+import "types.proto";
+message Button {}
+`,
+		"panel.proto": `syntax = "proto3";
+package ui;
+import "widgets.proto";
+import "types.proto";
+message Panel {
+  Button button = 1;
+  Size size = 2;
+}
+`,
+		"all.proto": `syntax = "proto3";
+package ui;
+import public "types.proto";
+`,
+		"window.proto": `syntax = "proto3";
+package ui;
+import "all.proto";
+message Window {
+  Size size = 1;
+}
+`,
+	}, nil)
+	ctx := context.Background()
+	uriOf := func(name string) protocol.DocumentURI {
+		return protocol.URIFromPath(filepath.Join(workspace, name))
+	}
+	resolve := func(name string, line uint32, title string) map[protocol.DocumentURI][]protocol.TextEdit {
+		t.Helper()
+		actions, err := c.GetCodeActions(ctx, &protocol.CodeActionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uriOf(name)},
+			Range:        protocol.Range{Start: protocol.Position{Line: line, Character: 2}, End: protocol.Position{Line: line, Character: 2}},
+			Context:      protocol.CodeActionContext{Only: []protocol.CodeActionKind{protocol.RefactorRewrite}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, action := range actions {
+			if action.Title != title {
+				continue
+			}
+			if _, _, err := resolveCodeAction(&action); err != nil {
+				t.Fatal(err)
+			}
+			edits := map[protocol.DocumentURI][]protocol.TextEdit{}
+			for _, change := range action.Edit.DocumentChanges {
+				edits[change.TextDocumentEdit.TextDocument.URI] = protocol.AsTextEdits(change.TextDocumentEdit.Edits)
+			}
+			return edits
+		}
+		t.Fatalf("no code action %q in %+v", title, actions)
+		return nil
+	}
+
+	// widgets.proto only imports types.proto for panel.proto
+	edits := resolve("widgets.proto", 2, `Re-export "types.proto" with import public`)
+	if len(edits) != 2 {
+		t.Fatalf("unexpected edits %+v", edits)
+	}
+	if e := edits[uriOf("widgets.proto")]; len(e) != 1 || e[0].NewText != " public" || e[0].Range.Start != (protocol.Position{Line: 2, Character: 6}) {
+		t.Errorf("unexpected edits to widgets.proto: %+v", e)
+	}
+	if e := edits[uriOf("panel.proto")]; len(e) != 1 || e[0].NewText != "" || e[0].Range != (protocol.Range{
+		Start: protocol.Position{Line: 3},
+		End:   protocol.Position{Line: 4},
+	}) {
+		t.Errorf("unexpected edits to panel.proto: %+v", e)
+	}
+
+	// all.proto doesn't use types.proto, so its import is removed
+	edits = resolve("all.proto", 2, `Replace import public "types.proto" with direct imports`)
+	if len(edits) != 2 {
+		t.Fatalf("unexpected edits %+v", edits)
+	}
+	if e := edits[uriOf("all.proto")]; len(e) != 1 || e[0].Range != (protocol.Range{
+		Start: protocol.Position{Line: 2},
+		End:   protocol.Position{Line: 3},
+	}) {
+		t.Errorf("unexpected edits to all.proto: %+v", e)
+	}
+	if e := edits[uriOf("window.proto")]; len(e) != 1 || e[0].NewText != "\nimport \"types.proto\";" {
+		t.Errorf("unexpected edits to window.proto: %+v", e)
+	}
+}
@@ -0,0 +1,56 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// editableCopyDir is the directory, relative to the workspace root, that
+// editable copies of read-only files are placed in. Copies are placed at
+// their import path within this directory.
+const editableCopyDir = "third_party"
+
+// readOnlyReason returns the reason the file is read-only, or an empty string
+// if it can be edited.
+func (c *Cache) readOnlyReason(uri protocol.DocumentURI) string {
+	if c.resolver.IsGoModuleCacheFile(uri) {
+		return "This file is in the Go module cache; changes to it will not be used."
+	}
+	return ""
+}
+
+// MakeEditableCopy copies a read-only file into the workspace, and returns the
+// URI of the copy. If a copy already exists, it is not overwritten.
+func (c *Cache) MakeEditableCopy(uri protocol.DocumentURI) (protocol.DocumentURI, error) {
+	if c.readOnlyReason(uri) == "" {
+		return "", fmt.Errorf("%s is not a read-only file", uri)
+	}
+	importPath, err := c.resolver.URIToPath(uri)
+	if err != nil {
+		return "", err
+	}
+	root := protocol.DocumentURI(c.workspace.URI).Path()
+	dest := filepath.Join(root, editableCopyDir, filepath.FromSlash(importPath))
+	destURI := protocol.URIFromPath(dest)
+	if _, err := os.Stat(dest); err == nil {
+		return destURI, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	contents, err := os.ReadFile(uri.Path())
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", err
+	}
+	// files in the module cache are read-only, so don't copy the mode
+	if err := os.WriteFile(dest, contents, 0o644); err != nil {
+		return "", err
+	}
+	return destURI, nil
+}
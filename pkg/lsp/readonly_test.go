@@ -0,0 +1,75 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestMakeEditableCopy(t *testing.T) {
+	workspace := t.TempDir()
+	modcache := t.TempDir()
+
+	src := filepath.Join(modcache, "example.com", "foo@v1.0.0", "foo", "foo.proto")
+	if err := os.MkdirAll(filepath.Dir(src), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, []byte("syntax = \"proto3\";\n"), 0o444); err != nil {
+		t.Fatal(err)
+	}
+	srcURI := protocol.URIFromPath(src)
+	localURI := protocol.URIFromPath(filepath.Join(workspace, "bar.proto"))
+
+	resolver := NewResolver(protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(workspace))})
+	resolver.filePathsByURI[srcURI] = "example.com/foo/foo.proto"
+	resolver.importSourcesByURI[srcURI] = SourceGoModuleCache
+	resolver.filePathsByURI[localURI] = "bar.proto"
+	resolver.importSourcesByURI[localURI] = SourceRelativePath
+	c := &Cache{
+		workspace: protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(workspace))},
+		resolver:  resolver,
+	}
+
+	if c.readOnlyReason(localURI) != "" {
+		t.Errorf("workspace file should not be read-only")
+	}
+	if _, err := c.MakeEditableCopy(localURI); err == nil {
+		t.Errorf("expected an error copying a workspace file")
+	}
+	if c.readOnlyReason(srcURI) == "" {
+		t.Fatalf("module cache file should be read-only")
+	}
+
+	copyURI, err := c.MakeEditableCopy(srcURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(workspace, "third_party", "example.com", "foo", "foo.proto")
+	if copyURI.Path() != want {
+		t.Fatalf("got copy at %s, want %s", copyURI.Path(), want)
+	}
+	info, err := os.Stat(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0o200 == 0 {
+		t.Errorf("copy is not writable: %v", info.Mode())
+	}
+
+	// an existing copy is not overwritten
+	if err := os.WriteFile(want, []byte("// modified\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.MakeEditableCopy(srcURI); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := os.ReadFile(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "// modified\n" {
+		t.Errorf("existing copy was overwritten: %q", contents)
+	}
+}
@@ -25,15 +25,19 @@ import (
 
 var analyzers = map[protocol.CodeActionKind][]Analyzer{
 	protocol.RefactorRewrite: {
-		simplifyRepeatedOptions,
+		(*Cache).simplifyRepeatedOptions,
 		// simplifyRepeatedFieldLiterals,
-		renumberFields,
+		(*Cache).renumberFields,
+		(*Cache).addExplicitJSONNames,
 	},
 	protocol.RefactorExtract: {
-		extractFields,
+		(*Cache).extractFields,
 	},
 	protocol.RefactorInline: {
-		inlineMessageFields,
+		(*Cache).inlineMessageFields,
+	},
+	SourceSortMembers: {
+		(*Cache).sortMembers,
 	},
 }
 
@@ -103,7 +107,7 @@ func resolveCodeAction(ca *protocol.CodeAction) (protocol.DocumentURI, int32, er
 	return actionQueue.resolve(ca)
 }
 
-func FindRefactorActions(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, want map[protocol.CodeActionKind]bool) []protocol.CodeAction {
+func (c *Cache) FindRefactorActions(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, want map[protocol.CodeActionKind]bool) []protocol.CodeAction {
 	var wg sync.WaitGroup
 	resultsC := make(chan protocol.CodeAction)
 	for kind, list := range analyzers {
@@ -114,7 +118,7 @@ func FindRefactorActions(ctx context.Context, request *protocol.CodeActionParams
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				analyzer(ctx, request, linkRes, mapper, resultsC)
+				analyzer(c, ctx, request, linkRes, mapper, resultsC)
 			}()
 		}
 	}
@@ -187,7 +191,7 @@ func RefactorUndeclaredName(ctx context.Context, cache *Cache, uri protocol.Docu
 	return actions
 }
 
-type Analyzer func(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, results chan<- protocol.CodeAction)
+type Analyzer func(c *Cache, ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, results chan<- protocol.CodeAction)
 
 type optionRefInfo struct {
 	Parent ast.Node
@@ -216,7 +220,7 @@ type optionRefInfo struct {
 //	  ...
 //	  string_list: ["foo", "bar"];
 //	};
-func simplifyRepeatedOptions(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, results chan<- protocol.CodeAction) {
+func (c *Cache) simplifyRepeatedOptions(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, results chan<- protocol.CodeAction) {
 	if request.Range == (protocol.Range{}) || request.Range.Start != request.Range.End {
 		return
 	}
@@ -231,7 +235,7 @@ func simplifyRepeatedOptions(ctx context.Context, request *protocol.CodeActionPa
 		return
 	}
 
-	nodePath, ok := findPathIntersectingToken(linkRes, token, request.Range.Start)
+	nodePath, ok := c.findPathIntersectingToken(linkRes, token, request.Range.Start)
 	if !ok {
 		return
 	}
@@ -441,7 +445,7 @@ func newFieldVisitor(tracker *paths.AncestorTracker, paths *[]protopath.Values)
 	}
 }
 
-func extractFields(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, results chan<- protocol.CodeAction) {
+func (c *Cache) extractFields(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, results chan<- protocol.CodeAction) {
 	if request.Range.Start == request.Range.End {
 		return
 	}
@@ -496,7 +500,7 @@ func extractFields(ctx context.Context, request *protocol.CodeActionParams, link
 		return
 	}
 
-	desc, _, err := deepPathSearch(parentNodePath.Path, linkRes, linkRes)
+	desc, _, err := c.deepPathSearch(ctx, parentNodePath.Path, linkRes, linkRes)
 	if err != nil {
 		return
 	}
@@ -651,7 +655,7 @@ func extractFields(ctx context.Context, request *protocol.CodeActionParams, link
 	}
 }
 
-func inlineMessageFields(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, results chan<- protocol.CodeAction) {
+func (c *Cache) inlineMessageFields(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, results chan<- protocol.CodeAction) {
 	if request.Range == (protocol.Range{}) || request.Range.Start != request.Range.End {
 		return
 	}
@@ -664,7 +668,7 @@ func inlineMessageFields(ctx context.Context, request *protocol.CodeActionParams
 	if token == ast.TokenError || comment.IsValid() {
 		return
 	}
-	path, ok := findPathIntersectingToken(linkRes, token, request.Range.Start)
+	path, ok := c.findPathIntersectingToken(linkRes, token, request.Range.Start)
 	if !ok {
 		return
 	}
@@ -674,7 +678,7 @@ func inlineMessageFields(ctx context.Context, request *protocol.CodeActionParams
 		return
 	}
 
-	desc, _, err := deepPathSearch(path.Path, linkRes, linkRes)
+	desc, _, err := c.deepPathSearch(ctx, path.Path, linkRes, linkRes)
 	if err != nil {
 		return
 	}
@@ -797,7 +801,7 @@ func inlineMessageFields(ctx context.Context, request *protocol.CodeActionParams
 	})
 }
 
-func renumberFields(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, results chan<- protocol.CodeAction) {
+func (c *Cache) renumberFields(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, results chan<- protocol.CodeAction) {
 	if request.Range == (protocol.Range{}) || request.Range.Start != request.Range.End {
 		return
 	}
@@ -810,12 +814,12 @@ func renumberFields(ctx context.Context, request *protocol.CodeActionParams, lin
 	if token == ast.TokenError || comment.IsValid() {
 		return
 	}
-	path, ok := findPathIntersectingToken(linkRes, token, request.Range.Start)
+	path, ok := c.findPathIntersectingToken(linkRes, token, request.Range.Start)
 	if !ok {
 		return
 	}
 
-	desc, _, err := deepPathSearch(path.Path, linkRes, linkRes)
+	desc, _, err := c.deepPathSearch(ctx, path.Path, linkRes, linkRes)
 	if err != nil {
 		return
 	}
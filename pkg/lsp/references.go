@@ -1,19 +1,22 @@
 package lsp
 
 import (
+	"cmp"
 	"context"
 	"slices"
+	"time"
 
 	"github.com/kralicky/protocompile/ast"
 	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-func (c *Cache) FindReferenceLocationsForTypeDescriptor(desc protoreflect.Descriptor) ([]protocol.Location, error) {
+func (c *Cache) FindReferenceLocationsForTypeDescriptor(ctx context.Context, desc protoreflect.Descriptor) ([]protocol.Location, error) {
+	defer metrics.referenceQueries.since(time.Now())
 	c.resultsMu.RLock()
 	defer c.resultsMu.RUnlock()
 	var locations []protocol.Location
-	for span := range findNodeReferences(desc, c.results) {
+	for span := range findNodeReferences(ctx, desc, c.results, c.refIndex) {
 		filename := span.NodeInfo.Start().Filename
 		uri, err := c.resolver.PathToURI(filename)
 		if err != nil {
@@ -24,31 +27,56 @@ func (c *Cache) FindReferenceLocationsForTypeDescriptor(desc protoreflect.Descri
 			Range: toRange(span.NodeInfo),
 		})
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(locations, protocol.CompareLocation)
 	return locations, nil
 }
 
-func (c *Cache) FindReferencesForTypeDescriptor(desc protoreflect.Descriptor) ([]ast.NodeReference, error) {
+func (c *Cache) FindReferencesForTypeDescriptor(ctx context.Context, desc protoreflect.Descriptor) ([]ast.NodeReference, error) {
+	defer metrics.referenceQueries.since(time.Now())
 	c.resultsMu.RLock()
 	defer c.resultsMu.RUnlock()
 	var refs []ast.NodeReference
-	for node := range findNodeReferences(desc, c.results) {
+	for node := range findNodeReferences(ctx, desc, c.searchableResultsLocked(), c.refIndex) {
 		refs = append(refs, node)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// references are found concurrently, one goroutine per file
+	slices.SortFunc(refs, compareNodeReferences)
 	return refs, nil
 }
 
-func (c *Cache) FindReferences(ctx context.Context, params protocol.TextDocumentPositionParams, refCtx protocol.ReferenceContext) ([]protocol.Location, error) {
-	desc, _, err := c.FindTypeDescriptorAtLocation(params)
+// compareNodeReferences orders references by filename, then by position.
+func compareNodeReferences(a, b ast.NodeReference) int {
+	return cmp.Or(
+		cmp.Compare(a.NodeInfo.Start().Filename, b.NodeInfo.Start().Filename),
+		cmp.Compare(a.NodeInfo.Start().Offset, b.NodeInfo.Start().Offset),
+		cmp.Compare(a.NodeInfo.End().Offset, b.NodeInfo.End().Offset),
+	)
+}
+
+// FindReferences returns the references to the symbol at the given position.
+// The symbol is found in the given snapshot, but since references may be in
+// pending files which are compiled on demand, they are searched for among the
+// latest results.
+func (c *Cache) FindReferences(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams, refCtx protocol.ReferenceContext) ([]protocol.Location, error) {
+	c.compilePendingReferences(ctx, snapshot, params)
+	desc, _, err := c.FindTypeDescriptorAtLocation(ctx, snapshot, params)
 	if err != nil {
 		return nil, err
 	}
 	if desc == nil {
-		if locations := c.TryFindPackageReferences(params); locations != nil {
+		if locations := c.TryFindPackageReferences(snapshot, params); locations != nil {
 			if !refCtx.IncludeDeclaration {
 				locations = slices.DeleteFunc(locations, func(loc protocol.Location) bool {
 					return loc.URI == params.TextDocument.URI
 				})
 			}
+			slices.SortFunc(locations, protocol.CompareLocation)
 			return locations, nil
 		}
 		return nil, nil
@@ -57,17 +85,18 @@ func (c *Cache) FindReferences(ctx context.Context, params protocol.TextDocument
 	var locations []protocol.Location
 
 	if refCtx.IncludeDeclaration {
-		if l, err := c.FindDefinitionForTypeDescriptor(desc); err == nil {
+		if l, err := c.FindDefinitionForTypeDescriptor(snapshot, desc); err == nil {
 			locations = append(locations, l)
 		} else {
 			return nil, err
 		}
 	}
 
-	refs, err := c.FindReferenceLocationsForTypeDescriptor(desc)
+	refs, err := c.FindReferenceLocationsForTypeDescriptor(ctx, desc)
 	if err != nil {
 		return nil, err
 	}
 	locations = append(locations, refs...)
+	slices.SortFunc(locations, protocol.CompareLocation)
 	return locations, nil
 }
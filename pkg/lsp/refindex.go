@@ -0,0 +1,117 @@
+package lsp
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// referenceIndex is an inverted index from identifier names to the files whose
+// sources contain them, which lets reference searches visit only the files
+// that could mention a descriptor. Names are indexed per dot-separated
+// component and in lower case (group fields are referenced by their group
+// names), so a lookup may return files which do not actually reference the
+// descriptor, but never omits one that does. Files which are not indexed are
+// always searched.
+//
+// The index is maintained during compilation and is guarded by
+// Cache.resultsMu.
+type referenceIndex struct {
+	paths map[string]map[string]struct{}
+	names map[string][]string
+}
+
+func newReferenceIndex() *referenceIndex {
+	return &referenceIndex{
+		paths: make(map[string]map[string]struct{}),
+		names: make(map[string][]string),
+	}
+}
+
+// indexed reports whether the file has been added to the index.
+func (x *referenceIndex) indexed(path string) bool {
+	_, ok := x.names[path]
+	return ok
+}
+
+// update replaces the indexed names of the file with those in its AST. If the
+// result has no AST, the file is removed from the index.
+func (x *referenceIndex) update(res linker.Result) {
+	path := res.Path()
+	x.remove(path)
+	fileNode := res.AST()
+	if fileNode == nil || !proto.HasExtension(fileNode, ast.E_FileInfo) {
+		return
+	}
+	source := proto.GetExtension(fileNode, ast.E_FileInfo).(*ast.FileInfo).Data
+	names := identifierNames(source)
+	for _, name := range names {
+		paths, ok := x.paths[name]
+		if !ok {
+			paths = make(map[string]struct{})
+			x.paths[name] = paths
+		}
+		paths[path] = struct{}{}
+	}
+	x.names[path] = names
+}
+
+// remove deletes the file from the index.
+func (x *referenceIndex) remove(path string) {
+	for _, name := range x.names[path] {
+		delete(x.paths[name], path)
+		if len(x.paths[name]) == 0 {
+			delete(x.paths, name)
+		}
+	}
+	delete(x.names, path)
+}
+
+// filter returns the files which may contain references to desc.
+func (x *referenceIndex) filter(desc protoreflect.Descriptor, files linker.Files) linker.Files {
+	if md, ok := desc.(protoreflect.MessageDescriptor); ok && md.IsMapEntry() {
+		// map entries are referenced by map<K, V> fields, which do not name them
+		return files
+	}
+	paths := x.paths[strings.ToLower(string(desc.Name()))]
+	filtered := make(linker.Files, 0, len(paths))
+	for _, f := range files {
+		if _, ok := paths[f.Path()]; ok || !x.indexed(f.Path()) {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
+
+// identifierNames returns the distinct identifier-like words in the source, in
+// lower case. Words in comments and string literals are included.
+func identifierNames(source []byte) []string {
+	seen := make(map[string]struct{})
+	var names []string
+	for len(source) > 0 {
+		start := bytes.IndexFunc(source, isIdentRune)
+		if start < 0 {
+			break
+		}
+		source = source[start:]
+		end := bytes.IndexFunc(source, func(r rune) bool { return !isIdentRune(r) })
+		if end < 0 {
+			end = len(source)
+		}
+		name := strings.ToLower(string(source[:end]))
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+		source = source[end:]
+	}
+	return names
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+}
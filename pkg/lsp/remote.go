@@ -0,0 +1,51 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// CallFunc sends a request to the client and decodes the response into result.
+// It is used to send requests which are not part of the LSP spec.
+type CallFunc func(ctx context.Context, method string, params any, result any) error
+
+// WithCallFunc sets the function used to send custom requests, such as
+// protols/readFile, to the client. It is required for remote mode.
+func WithCallFunc(call CallFunc) ServerOption {
+	return func(o *ServerOptions) {
+		o.call = call
+	}
+}
+
+// clientFileReader is the SchemeHandler used for file:// URIs in remote mode,
+// where the server may be running on a different machine than the editor and
+// must not read workspace files from its own disk. Contents of files which are
+// not open are requested from the client, and the set of workspace files is
+// learned only from workspace/didChangeWatchedFiles and didOpen; clients
+// should report existing files as created after initialization.
+type clientFileReader struct {
+	call CallFunc
+}
+
+var _ SchemeHandler = (*clientFileReader)(nil)
+
+// ReadFile implements SchemeHandler.
+func (r *clientFileReader) ReadFile(ctx context.Context, uri protocol.DocumentURI) ([]byte, error) {
+	var result *protocolext.ReadFileResult
+	if err := r.call(ctx, protocolext.ReadFileRequest, protocolext.ReadFileParams{URI: uri}, &result); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", os.ErrNotExist, uri, err)
+	}
+	if result == nil {
+		return nil, fmt.Errorf("%w: %s", os.ErrNotExist, uri)
+	}
+	return []byte(result.Contents), nil
+}
+
+// ListProtoFiles implements SchemeHandler.
+func (r *clientFileReader) ListProtoFiles(context.Context, protocol.DocumentURI) ([]protocol.DocumentURI, error) {
+	return nil, nil
+}
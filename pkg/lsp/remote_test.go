@@ -0,0 +1,72 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestRemoteMode(t *testing.T) {
+	// these paths do not exist on disk; all contents come from the client
+	files := map[protocol.DocumentURI]string{
+		"file:///remote/workspace/a.proto":   "syntax = \"proto3\";\npackage a;\nimport \"b/b.proto\";\nmessage A {\n  b.B b = 1;\n}\n",
+		"file:///remote/workspace/b/b.proto": "syntax = \"proto3\";\npackage b;\nmessage B {}\n",
+	}
+	reads := map[protocol.DocumentURI]int{}
+	call := func(_ context.Context, method string, params, result any) error {
+		if method != protocolext.ReadFileRequest {
+			return errors.New("unexpected method " + method)
+		}
+		uri := params.(protocolext.ReadFileParams).URI
+		reads[uri]++
+		contents, ok := files[uri]
+		if ok {
+			*(result.(**protocolext.ReadFileResult)) = &protocolext.ReadFileResult{Contents: contents}
+		}
+		return nil
+	}
+	s := &Server{ServerOptions: ServerOptions{call: call}, remote: true}
+	c := NewCache(protocol.WorkspaceFolder{URI: "file:///remote/workspace"}, s.cacheOptions()...)
+	defer c.Close(nil)
+	c.loadWorkspaceFiles()
+	if len(reads) != 0 {
+		t.Fatalf("files were read before being reported by the client: %v", reads)
+	}
+
+	var created []file.Modification
+	for uri := range files {
+		created = append(created, file.Modification{URI: uri, Action: file.Create, OnDisk: true, Version: -1})
+	}
+	c.DidModifyFiles(context.Background(), created)
+
+	fd, err := c.FindFileByURI("file:///remote/workspace/a.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := fd.Messages().ByName("A").Fields().ByName("b").Message(); msg.IsPlaceholder() {
+		t.Errorf("b.B was not resolved")
+	}
+	if !c.resolver.IsRealWorkspaceLocalFile("file:///remote/workspace/b/b.proto") {
+		t.Error("expected b/b.proto to be a workspace-local file")
+	}
+
+	before := reads["file:///remote/workspace/b/b.proto"]
+	files["file:///remote/workspace/b/b.proto"] = "syntax = \"proto3\";\npackage b;\nmessage B {\n  string s = 1;\n}\n"
+	c.DidModifyFiles(context.Background(), []file.Modification{
+		{URI: "file:///remote/workspace/b/b.proto", Action: file.Change, OnDisk: true, Version: -1},
+	})
+	if reads["file:///remote/workspace/b/b.proto"] == before {
+		t.Error("changed file was not read again")
+	}
+	fd, err = c.FindFileByURI("file:///remote/workspace/b/b.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fd.Messages().ByName("B").Fields().Len() != 1 {
+		t.Errorf("changed contents were not compiled")
+	}
+}
@@ -1,26 +1,44 @@
 package lsp
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
 	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-func (c *Cache) PrepareRename(in protocol.TextDocumentPositionParams) (*protocol.PrepareRenameResult, error) {
+func (c *Cache) PrepareRename(ctx context.Context, in protocol.TextDocumentPositionParams) (*protocol.PrepareRenameResult, error) {
 	c.resultsMu.RLock()
 	defer c.resultsMu.RUnlock()
+	snapshot := c.snapshot.Load()
 
-	desc, rng, err := c.FindTypeDescriptorAtLocation(in)
+	desc, rng, err := c.FindTypeDescriptorAtLocation(ctx, snapshot, in)
 	if err != nil {
 		return nil, err
 	}
 	if desc == nil {
+		if pkgName, rng, ok := c.findPackageNameAtLocation(snapshot, in); ok {
+			if err := c.canRenamePackageLocked(pkgName); err != nil {
+				return nil, err
+			}
+			return &protocol.PrepareRenameResult{
+				Range:       rng,
+				Placeholder: string(pkgName),
+			}, nil
+		}
 		return nil, fmt.Errorf("no type found at location")
 	}
 	// check if desc can be renamed
-	if err := c.canRename(desc); err != nil {
+	if err := c.canRename(snapshot, desc); err != nil {
 		return nil, err
 	}
 
@@ -30,7 +48,7 @@ func (c *Cache) PrepareRename(in protocol.TextDocumentPositionParams) (*protocol
 	}, nil
 }
 
-func (c *Cache) canRename(desc protoreflect.Descriptor) error {
+func (c *Cache) canRename(snapshot *Snapshot, desc protoreflect.Descriptor) error {
 	// A descriptor can be renamed if:
 	// 1. If it is a message, enum, service, or field
 	// 2. It is defined in a file that exists on disk in the workspace
@@ -52,7 +70,7 @@ func (c *Cache) canRename(desc protoreflect.Descriptor) error {
 
 	var definition protocol.Location
 
-	definition, err := c.FindDefinitionForTypeDescriptor(desc)
+	definition, err := c.FindDefinitionForTypeDescriptor(snapshot, desc)
 	if err != nil {
 		return fmt.Errorf("failed to find definition for %q: %w", desc.FullName(), err)
 	}
@@ -69,20 +87,38 @@ func (c *Cache) canRename(desc protoreflect.Descriptor) error {
 	return nil
 }
 
-func (c *Cache) Rename(params *protocol.RenameParams) (*protocol.WorkspaceEdit, error) {
+func (c *Cache) Rename(ctx context.Context, params *protocol.RenameParams) (*protocol.WorkspaceEdit, error) {
+	c.compilePendingReferences(ctx, c.Snapshot(), protocol.TextDocumentPositionParams{
+		TextDocument: params.TextDocument,
+		Position:     params.Position,
+	})
 	c.resultsMu.RLock()
 	defer c.resultsMu.RUnlock()
+	// the rename is computed from the latest results, which may include
+	// pending files compiled above
+	snapshot := c.snapshot.Load()
 
-	desc, _, err := c.FindTypeDescriptorAtLocation(protocol.TextDocumentPositionParams{
+	if err := c.checkCompiledDocumentVersionLocked(ctx, params.TextDocument.URI); err != nil {
+		return nil, err
+	}
+	desc, _, err := c.FindTypeDescriptorAtLocation(ctx, snapshot, protocol.TextDocumentPositionParams{
 		TextDocument: params.TextDocument,
 		Position:     params.Position,
 	})
 	if err != nil {
 		return nil, err
 	}
+	if desc == nil {
+		if pkgName, _, ok := c.findPackageNameAtLocation(snapshot, protocol.TextDocumentPositionParams{
+			TextDocument: params.TextDocument,
+			Position:     params.Position,
+		}); ok {
+			return c.renamePackageLocked(ctx, pkgName, protoreflect.FullName(params.NewName))
+		}
+	}
 
 	// check if desc can be renamed
-	if err := c.canRename(desc); err != nil {
+	if err := c.canRename(snapshot, desc); err != nil {
 		return nil, err
 	}
 
@@ -117,7 +153,7 @@ func (c *Cache) Rename(params *protocol.RenameParams) (*protocol.WorkspaceEdit,
 	}
 
 	// find all references
-	refs, err := c.FindReferencesForTypeDescriptor(desc)
+	refs, err := c.FindReferencesForTypeDescriptor(ctx, desc)
 	if err != nil {
 		return nil, err
 	}
@@ -190,7 +226,300 @@ func (c *Cache) Rename(params *protocol.RenameParams) (*protocol.WorkspaceEdit,
 	}
 
 	// the rename is valid, return the edits to the server
-	return &protocol.WorkspaceEdit{
-		Changes: editsByDocument,
-	}, nil
+	return c.versionedWorkspaceEditLocked(ctx, editsByDocument)
+}
+
+// canRenamePackageLocked checks that every file declaring the package is a
+// well-formed file local to this workspace.
+func (c *Cache) canRenamePackageLocked(name protoreflect.FullName) error {
+	var files int
+	var err error
+	c.results.RangeFilesByPackage(name, func(f linker.File) bool {
+		if f.IsPlaceholder() {
+			err = fmt.Errorf("package %q contains files with errors", name)
+			return false
+		}
+		uri, e := c.resolver.PathToURI(f.Path())
+		if e != nil {
+			err = e
+			return false
+		}
+		if !c.resolver.IsRealWorkspaceLocalFile(uri) {
+			err = fmt.Errorf("package %q contains files outside of the workspace", name)
+			return false
+		}
+		if ok, _ := c.latestDocumentContentsWellFormedLocked(uri, false); !ok {
+			err = fmt.Errorf("source file %q in package %q has errors", uri, name)
+			return false
+		}
+		files++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if files == 0 {
+		return fmt.Errorf("no files found for package %q", name)
+	}
+	return nil
+}
+
+// renamePackageLocked renames the package declaration in every file of the
+// package, and rewrites all qualified references to types declared in it.
+func (c *Cache) renamePackageLocked(ctx context.Context, oldName, newName protoreflect.FullName) (*protocol.WorkspaceEdit, error) {
+	if !newName.IsValid() {
+		return nil, fmt.Errorf("invalid package name %q", newName)
+	}
+	if err := c.canRenamePackageLocked(oldName); err != nil {
+		return nil, err
+	}
+	if oldName == newName {
+		return &protocol.WorkspaceEdit{}, nil
+	}
+
+	resolver := c.results.AsResolver()
+	editsByDocument := map[protocol.DocumentURI][]protocol.TextEdit{}
+	filesInPackage := map[string]struct{}{}
+	var descs []protoreflect.Descriptor
+	var err error
+	c.results.RangeFilesByPackage(oldName, func(f linker.File) bool {
+		res := f.(linker.Result)
+		filesInPackage[res.Path()] = struct{}{}
+		uri, e := c.resolver.PathToURI(res.Path())
+		if e != nil {
+			err = e
+			return false
+		}
+		fileNode := res.AST()
+		for _, decl := range fileNode.Decls {
+			if pkgNode := decl.GetPackage(); pkgNode != nil && pkgNode.Name != nil {
+				editsByDocument[uri] = append(editsByDocument[uri], protocol.TextEdit{
+					Range:   toRange(fileNode.NodeInfo(pkgNode.Name)),
+					NewText: string(newName),
+				})
+				break
+			}
+		}
+
+		// check for conflicts with existing types in the new package
+		topLevel := collectTopLevelDescriptors(res)
+		for _, desc := range topLevel {
+			newFqn := newName.Append(desc.Name())
+			if _, e := resolver.FindDescriptorByName(newFqn); e == nil {
+				err = fmt.Errorf("a type already exists with name %q", newFqn)
+				return false
+			}
+		}
+		for _, desc := range topLevel {
+			descs = appendNestedTypeDescriptors(descs, desc)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, desc := range descs {
+		relName := strings.TrimPrefix(string(desc.FullName()), string(oldName)+".")
+		for ref := range findNodeReferences(ctx, desc, c.results, c.refIndex) {
+			var identNode ast.Node
+			switch node := ast.Unwrap(ref.Node).(type) {
+			case *ast.IdentNode, *ast.CompoundIdentNode:
+				identNode = node
+			case *ast.FieldReferenceNode:
+				if !node.IsExtension() {
+					continue
+				}
+				identNode = node.Name.Unwrap()
+			case *ast.RPCTypeNode:
+				identNode = node.MessageType.Unwrap()
+			default:
+				continue
+			}
+			var text string
+			switch identNode := identNode.(type) {
+			case *ast.IdentNode:
+				text = identNode.Val
+			case *ast.CompoundIdentNode:
+				text = string(identNode.AsIdentifier())
+			default:
+				continue
+			}
+
+			filename := ref.NodeInfo.Start().Filename
+			qualifier, ok := strings.CutSuffix(strings.TrimPrefix(text, "."), relName)
+			if !ok {
+				continue
+			}
+			if qualifier == "" && !strings.HasPrefix(text, ".") {
+				if _, ok := filesInPackage[filename]; ok {
+					// unqualified references within the package don't need to change
+					continue
+				}
+			}
+			// other references are fully qualified, since a partially qualified
+			// name could resolve to a different package in the referencing scope
+			newText := "." + string(newName) + "." + relName
+
+			uri, err := c.resolver.PathToURI(filename)
+			if err != nil {
+				return nil, err
+			}
+			if !c.resolver.IsRealWorkspaceLocalFile(uri) {
+				return nil, fmt.Errorf("references exist outside of the workspace")
+			}
+			editsByDocument[uri] = append(editsByDocument[uri], protocol.TextEdit{
+				Range:   toRange(ref.NodeInfo.Internal().ParentFile().NodeInfo(identNode)),
+				NewText: newText,
+			})
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// references to nested types are also recorded for each of their parent
+	// types; drop edits that are contained within the edit for a longer name
+	for uri, edits := range editsByDocument {
+		editsByDocument[uri] = slices.DeleteFunc(edits, func(edit protocol.TextEdit) bool {
+			for _, other := range edits {
+				if other.Range != edit.Range &&
+					protocol.ComparePosition(other.Range.Start, edit.Range.Start) <= 0 &&
+					protocol.ComparePosition(other.Range.End, edit.Range.End) >= 0 {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
+	var moves []protocol.RenameFile
+	if c.fileRenames && c.settings.Load().Refactor.MovePackageFiles {
+		moves, err = c.packageFileMovesLocked(oldName, newName, editsByDocument)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	edit, err := c.versionedWorkspaceEditLocked(ctx, editsByDocument)
+	if err != nil {
+		return nil, err
+	}
+	// files are moved after they are edited, since the text edits refer to
+	// the files at their old locations
+	for i := range moves {
+		edit.DocumentChanges = append(edit.DocumentChanges, protocol.DocumentChanges{RenameFile: &moves[i]})
+	}
+	return edit, nil
+}
+
+// packageFileMovesLocked returns the file renames which move the files of a
+// package from the directory matching its old name to the directory matching
+// its new name, and adds edits which update imports of the moved files to
+// editsByDocument. Files of the package in other directories are not moved.
+func (c *Cache) packageFileMovesLocked(oldName, newName protoreflect.FullName, editsByDocument map[protocol.DocumentURI][]protocol.TextEdit) ([]protocol.RenameFile, error) {
+	oldDir := strings.ReplaceAll(string(oldName), ".", "/")
+	newDir := strings.ReplaceAll(string(newName), ".", "/")
+
+	newPaths := map[string]string{}
+	var moves []protocol.RenameFile
+	var err error
+	c.results.RangeFilesByPackage(oldName, func(f linker.File) bool {
+		if path.Dir(f.Path()) != oldDir {
+			return true
+		}
+		uri, e := c.resolver.PathToURI(f.Path())
+		if e != nil {
+			err = e
+			return false
+		}
+		root, ok := strings.CutSuffix(uri.Path(), filepath.FromSlash(f.Path()))
+		if !ok {
+			// the import path is not relative to a directory containing the file
+			return true
+		}
+		newPath := path.Join(newDir, path.Base(f.Path()))
+		newURI := protocol.URIFromPath(filepath.Join(root, filepath.FromSlash(newPath)))
+		if _, e := os.Stat(newURI.Path()); e == nil {
+			err = fmt.Errorf("cannot move %s: %s already exists", f.Path(), newPath)
+			return false
+		}
+		newPaths[f.Path()] = newPath
+		moves = append(moves, protocol.RenameFile{
+			Kind:   "rename",
+			OldURI: uri,
+			NewURI: newURI,
+		})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(moves) == 0 {
+		return nil, nil
+	}
+
+	for _, f := range c.results {
+		res, ok := f.(linker.Result)
+		if !ok || f.IsPlaceholder() {
+			continue
+		}
+		uri, err := c.resolver.PathToURI(res.Path())
+		if err != nil || !c.resolver.IsRealWorkspaceLocalFile(uri) {
+			continue
+		}
+		fileNode := res.AST()
+		for _, decl := range fileNode.Decls {
+			imp := decl.GetImport()
+			if imp == nil || imp.Name == nil {
+				continue
+			}
+			if newPath, ok := newPaths[path.Clean(imp.Name.AsString())]; ok {
+				editsByDocument[uri] = append(editsByDocument[uri], protocol.TextEdit{
+					Range:   toRange(fileNode.NodeInfo(imp.Name)),
+					NewText: strconv.Quote(newPath),
+				})
+			}
+		}
+	}
+	return moves, nil
+}
+
+func collectTopLevelDescriptors(f protoreflect.FileDescriptor) []protoreflect.Descriptor {
+	var descs []protoreflect.Descriptor
+	for i, l := 0, f.Messages().Len(); i < l; i++ {
+		descs = append(descs, f.Messages().Get(i))
+	}
+	for i, l := 0, f.Enums().Len(); i < l; i++ {
+		descs = append(descs, f.Enums().Get(i))
+	}
+	for i, l := 0, f.Extensions().Len(); i < l; i++ {
+		descs = append(descs, f.Extensions().Get(i))
+	}
+	for i, l := 0, f.Services().Len(); i < l; i++ {
+		descs = append(descs, f.Services().Get(i))
+	}
+	return descs
+}
+
+// appendNestedTypeDescriptors appends desc and any messages, enums, and
+// extensions nested within it.
+func appendNestedTypeDescriptors(descs []protoreflect.Descriptor, desc protoreflect.Descriptor) []protoreflect.Descriptor {
+	descs = append(descs, desc)
+	msg, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return descs
+	}
+	for i, l := 0, msg.Messages().Len(); i < l; i++ {
+		if nested := msg.Messages().Get(i); !nested.IsMapEntry() {
+			descs = appendNestedTypeDescriptors(descs, nested)
+		}
+	}
+	for i, l := 0, msg.Enums().Len(); i < l; i++ {
+		descs = append(descs, msg.Enums().Get(i))
+	}
+	for i, l := 0, msg.Extensions().Len(); i < l; i++ {
+		descs = append(descs, msg.Extensions().Get(i))
+	}
+	return descs
 }
@@ -0,0 +1,140 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestRenamePackageMovesFiles(t *testing.T) {
+	c, workspace := newTestCache(t, map[string]string{
+		"foo/v1/a.proto": `syntax = "proto3";
+package foo.v1;
+message A {}
+`,
+		"other/b.proto": `syntax = "proto3";
+package foo.v1;
+message B {}
+`,
+		"bar/bar.proto": `syntax = "proto3";
+package bar;
+import "foo/v1/a.proto";
+message Bar {
+  foo.v1.A a = 1;
+}
+`,
+	}, &Settings{Refactor: RefactorSettings{MovePackageFiles: true}})
+	ctx := context.Background()
+	aURI := protocol.URIFromPath(filepath.Join(workspace, "foo/v1/a.proto"))
+	barURI := protocol.URIFromPath(filepath.Join(workspace, "bar/bar.proto"))
+	params := &protocol.RenameParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: aURI},
+		Position:     protocol.Position{Line: 1, Character: 9},
+		NewName:      "foo.v2",
+	}
+
+	// the client does not support renaming files
+	edit, err := c.Rename(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range edit.DocumentChanges {
+		if change.RenameFile != nil {
+			t.Fatalf("unexpected file rename %+v", change.RenameFile)
+		}
+	}
+
+	c.fileRenames = true
+	edit, err = c.Rename(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var renames []protocol.RenameFile
+	var barEdits []protocol.TextEdit
+	for _, change := range edit.DocumentChanges {
+		switch {
+		case change.RenameFile != nil:
+			renames = append(renames, *change.RenameFile)
+		case change.TextDocumentEdit.TextDocument.URI == barURI:
+			for _, e := range change.TextDocumentEdit.Edits {
+				barEdits = append(barEdits, e.Value.(protocol.TextEdit))
+			}
+		}
+	}
+	// only the file in the directory matching the package is moved
+	if len(renames) != 1 || renames[0].OldURI != aURI ||
+		renames[0].NewURI != protocol.URIFromPath(filepath.Join(workspace, "foo/v2/a.proto")) {
+		t.Fatalf("unexpected file renames %+v", renames)
+	}
+	if last := edit.DocumentChanges[len(edit.DocumentChanges)-1]; last.RenameFile == nil {
+		t.Error("expected files to be renamed after they are edited")
+	}
+	var newTexts []string
+	for _, e := range barEdits {
+		newTexts = append(newTexts, e.NewText)
+	}
+	slices.Sort(newTexts)
+	if !slices.Equal(newTexts, []string{`"foo/v2/a.proto"`, ".foo.v2.A"}) {
+		t.Errorf("expected the import and reference in bar.proto to be updated, got %q", newTexts)
+	}
+}
+
+func TestRenamePackageQualifiesReferences(t *testing.T) {
+	c, workspace := newTestCache(t, map[string]string{
+		"foo/a.proto": `syntax = "proto3";
+package foo;
+message A {
+  message Nested {}
+  Nested nested = 1;
+  foo.A self = 2;
+}
+`,
+		"bar/foo/b.proto": `syntax = "proto3";
+package bar.foo;
+message B {}
+`,
+		"bar/bar.proto": `syntax = "proto3";
+package bar;
+import "foo/a.proto";
+import "bar/foo/b.proto";
+message Bar {
+  .foo.A a = 1;
+  foo.B b = 2;
+}
+`,
+	}, nil)
+	ctx := context.Background()
+	aURI := protocol.URIFromPath(filepath.Join(workspace, "foo/a.proto"))
+	barURI := protocol.URIFromPath(filepath.Join(workspace, "bar/bar.proto"))
+
+	// bar.foo shadows foo within package bar, so "foo.v2.A" would not resolve
+	// to the renamed message from bar.proto
+	edit, err := c.Rename(ctx, &protocol.RenameParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: aURI},
+		Position:     protocol.Position{Line: 1, Character: 9},
+		NewName:      "foo.v2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTexts := map[protocol.DocumentURI][]string{}
+	for _, change := range edit.DocumentChanges {
+		uri := change.TextDocumentEdit.TextDocument.URI
+		for _, e := range protocol.AsTextEdits(change.TextDocumentEdit.Edits) {
+			newTexts[uri] = append(newTexts[uri], e.NewText)
+		}
+	}
+	for _, texts := range newTexts {
+		slices.Sort(texts)
+	}
+	// unqualified references within the package are left alone
+	if want := []string{".foo.v2.A", "foo.v2"}; !slices.Equal(newTexts[aURI], want) {
+		t.Errorf("got edits %q in a.proto, want %q", newTexts[aURI], want)
+	}
+	if want := []string{".foo.v2.A"}; !slices.Equal(newTexts[barURI], want) {
+		t.Errorf("got edits %q in bar.proto, want %q", newTexts[barURI], want)
+	}
+}
@@ -0,0 +1,69 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// forgetFileLocked removes the path mapping of a file which is not in the
+// workspace, along with its synthetic source and everything recorded about
+// where it was found, and returns its path. The file is found again the next
+// time its path is resolved.
+func (r *Resolver) forgetFileLocked(uri protocol.DocumentURI) (string, bool) {
+	path, ok := r.filePathsByURI[uri]
+	if !ok {
+		return "", false
+	}
+	if r.goLanguageDriver.HasGoModule() {
+		r.goLanguageDriver.ForgetImport(path)
+		if requested := r.importOrigins[uri].requestedPath; requested != "" {
+			r.goLanguageDriver.ForgetImport(requested)
+		}
+	}
+	delete(r.filePathsByURI, uri)
+	if r.fileURIsByPath[path] == uri {
+		delete(r.fileURIsByPath, path)
+	}
+	delete(r.importSourcesByURI, uri)
+	delete(r.importOrigins, uri)
+	delete(r.importConflicts, path)
+	delete(r.syntheticFiles, uri)
+	delete(r.syntheticDescriptors, uri)
+	delete(r.syntheticFileOriginalNames, uri)
+	r.fsDelegate.invalidate(uri)
+	return path, true
+}
+
+// Reresolve discards how the file with the given URI was resolved, and
+// recompiles it and the files which depend on it. Files from go modules and
+// synthetic files are looked up again from scratch; workspace files have their
+// path mapping recreated from disk, as if they were deleted and created again.
+// Unresolved imports of the file are retried when it is recompiled.
+func (c *Cache) Reresolve(ctx context.Context, uri protocol.DocumentURI) error {
+	c.resolver.pathsMu.RLock()
+	_, known := c.resolver.filePathsByURI[uri]
+	workspace := isWorkspaceImportSource(c.resolver.importSourcesByURI[uri])
+	c.resolver.pathsMu.RUnlock()
+	if !known {
+		return fmt.Errorf("unknown file: %s", uri)
+	}
+	if workspace {
+		slog.Info("re-resolving workspace file", "uri", uri)
+		c.DidModifyFiles(ctx, []file.Modification{
+			{URI: uri, Action: file.Delete, OnDisk: true, Version: -1},
+			{URI: uri, Action: file.Create, OnDisk: true, Version: -1},
+		})
+		return nil
+	}
+
+	c.resolver.pathsMu.Lock()
+	path, _ := c.resolver.forgetFileLocked(uri)
+	c.resolver.pathsMu.Unlock()
+	slog.Info("re-resolving file", "uri", uri, "path", path)
+	c.Compile(ctx, []string{path}, c.diagHandler.Flush)
+	return nil
+}
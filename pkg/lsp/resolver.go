@@ -18,7 +18,6 @@ import (
 
 	"github.com/kralicky/protocompile"
 	"github.com/kralicky/protocompile/linker"
-	"github.com/kralicky/protols/pkg/format"
 	"github.com/kralicky/tools-lite/gopls/pkg/cache"
 	"github.com/kralicky/tools-lite/gopls/pkg/file"
 	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
@@ -37,32 +36,74 @@ const (
 	SourceLocalGoModule
 	SourceGoModuleCache
 	SourceSynthetic
+	SourceImportAlias
 )
 
 type Resolver struct {
 	*cache.OverlayFS
-	fsDelegate                 *cache.MemoizedFS
-	folder                     protocol.WorkspaceFolder
-	goLanguageDriver           *GoLanguageDriver
+	fsDelegate       *schemeFS
+	folder           protocol.WorkspaceFolder
+	goLanguageDriver *GoLanguageDriver
+	// the reason the go language driver could not be created, if it is nil
+	// outside of sandbox mode
+	goLanguageDriverErr        error
 	pathsMu                    sync.RWMutex
 	filePathsByURI             map[protocol.DocumentURI]string // URI -> canonical file path (go package + file name)
 	fileURIsByPath             map[string]protocol.DocumentURI // canonical file path (go package + file name) -> URI
 	importSourcesByURI         map[protocol.DocumentURI]ImportSource
 	syntheticFileOriginalNames map[protocol.DocumentURI]string
 	syntheticFiles             map[protocol.DocumentURI]string
+	// the descriptors synthetic files were printed from, and the settings
+	// used to print them
+	syntheticDescriptors  map[protocol.DocumentURI]protoreflect.FileDescriptor
+	syntheticFileSettings SyntheticFileSettings
+	// where files were found, for files from go modules or which were found
+	// under a different path than the one they were imported with
+	importOrigins map[protocol.DocumentURI]importOrigin
+	// the order in which import sources are tried, and the configured and
+	// session orders it is chosen from
+	importPrecedence         []string
+	importPrecedenceSetting  []string
+	importPrecedenceOverride []string
+	// import paths provided by both a workspace file and a go module, keyed by
+	// path. Paths which were checked and have no conflict map to an empty
+	// entry.
+	importConflicts map[string]importConflict
+	importAliases   []importAlias
+	// synthetic descriptors from an imported index, keyed by path
+	prebuiltFiles map[string]prebuiltFile
 }
 
 func NewResolver(folder protocol.WorkspaceFolder) *Resolver {
-	fsDelegate := cache.NewMemoizedFS()
+	return newResolver(folder, &CacheOptions{})
+}
+
+func newResolver(folder protocol.WorkspaceFolder, options *CacheOptions) *Resolver {
+	fsDelegate := &schemeFS{disk: cache.NewMemoizedFS(), handlers: options.schemeHandlers}
+	var goLanguageDriver *GoLanguageDriver
+	var goLanguageDriverErr error
+	if !options.sandbox {
+		// the go language driver runs the go command. Without it, imports are
+		// only resolved from the workspace and well-known paths.
+		goLanguageDriver, goLanguageDriverErr = newGoLanguageDriver(uriPath(protocol.DocumentURI(folder.URI)))
+		if goLanguageDriverErr != nil {
+			slog.Warn("go language driver unavailable", "error", goLanguageDriverErr)
+		}
+	}
 	return &Resolver{
 		folder:                     folder,
 		OverlayFS:                  cache.NewOverlayFS(fsDelegate),
 		fsDelegate:                 fsDelegate,
-		goLanguageDriver:           NewGoLanguageDriver(protocol.DocumentURI(folder.URI).Path()),
+		goLanguageDriver:           goLanguageDriver,
+		goLanguageDriverErr:        goLanguageDriverErr,
 		filePathsByURI:             make(map[protocol.DocumentURI]string),
 		fileURIsByPath:             make(map[string]protocol.DocumentURI),
 		syntheticFileOriginalNames: make(map[protocol.DocumentURI]string),
 		syntheticFiles:             make(map[protocol.DocumentURI]string),
+		syntheticDescriptors:       make(map[protocol.DocumentURI]protoreflect.FileDescriptor),
+		importOrigins:              make(map[protocol.DocumentURI]importOrigin),
+		importPrecedence:           defaultImportPrecedence,
+		importConflicts:            make(map[string]importConflict),
 		importSourcesByURI:         map[protocol.DocumentURI]ImportSource{},
 	}
 }
@@ -111,6 +152,9 @@ func (r *Resolver) UpdateURIPathMappings(modifications []file.Modification) {
 	r.pathsMu.Lock()
 	defer r.pathsMu.Unlock()
 	for _, m := range modifications {
+		if m.Action != file.Open && m.Action != file.Close {
+			r.fsDelegate.invalidate(m.URI)
+		}
 		switch m.Action {
 		case file.Close:
 		case file.Change, file.Save:
@@ -140,6 +184,7 @@ func (r *Resolver) UpdateURIPathMappings(modifications []file.Modification) {
 						delete(r.filePathsByURI, m.URI)
 						delete(r.fileURIsByPath, existingPath)
 						delete(r.importSourcesByURI, m.URI)
+						delete(r.importOrigins, m.URI)
 						continue
 					}
 					slog.With(
@@ -162,7 +207,17 @@ func (r *Resolver) UpdateURIPathMappings(modifications []file.Modification) {
 				}
 			}
 		case file.Create:
+			if !m.URI.IsFile() || r.HasSchemeHandler(m.URI) {
+				r.createVirtualFileLocked(m.URI)
+				continue
+			}
 			filename := m.URI.Path()
+			if aliasedPath, ok := r.aliasedPathLocked(filename); ok {
+				r.filePathsByURI[m.URI] = aliasedPath
+				r.fileURIsByPath[aliasedPath] = m.URI
+				r.importSourcesByURI[m.URI] = SourceImportAlias
+				continue
+			}
 			f, err := os.Open(filename)
 			if err != nil {
 				slog.With(
@@ -196,6 +251,8 @@ func (r *Resolver) UpdateURIPathMappings(modifications []file.Modification) {
 			path := r.filePathsByURI[m.URI]
 			delete(r.filePathsByURI, m.URI)
 			delete(r.importSourcesByURI, m.URI)
+			delete(r.importOrigins, m.URI)
+			delete(r.importConflicts, path)
 			delete(r.fileURIsByPath, path)
 		case file.Open:
 			// not necessarily a local go module
@@ -204,6 +261,36 @@ func (r *Resolver) UpdateURIPathMappings(modifications []file.Modification) {
 	}
 }
 
+// HasSchemeHandler reports whether the URI is read using a registered
+// SchemeHandler rather than from disk.
+func (r *Resolver) HasSchemeHandler(uri protocol.DocumentURI) bool {
+	_, ok := r.fsDelegate.handlerFor(uri)
+	return ok
+}
+
+// createVirtualFileLocked adds a path mapping for a file read by a
+// SchemeHandler. Go modules are not supported for these files, so the path is
+// always relative to the workspace root.
+func (r *Resolver) createVirtualFileLocked(uri protocol.DocumentURI) {
+	if _, ok := r.fsDelegate.handlerFor(uri); !ok {
+		slog.With("uri", uri).Debug("no handler for URI scheme")
+		return
+	}
+	relativePath, ok := strings.CutPrefix(string(uri), strings.TrimSuffix(r.folder.URI, "/")+"/")
+	if !ok {
+		slog.With("uri", uri).Warn("file is not within the workspace root")
+		return
+	}
+	relativePath, err := url.PathUnescape(relativePath)
+	if err != nil {
+		slog.With("uri", uri, "error", err).Warn("invalid URI")
+		return
+	}
+	r.filePathsByURI[uri] = relativePath
+	r.fileURIsByPath[relativePath] = uri
+	r.importSourcesByURI[uri] = SourceRelativePath
+}
+
 // CheckIncompleteDescriptors fills in placeholder sources for synthetic files
 // that did not have fully linked descriptors at the time of creation, and
 // returns a list of paths that need to be compiled again.
@@ -248,8 +335,7 @@ func (r *Resolver) CheckIncompleteDescriptors(results linker.Files) []string {
 					// r.syntheticFiles[uri] = fmt.Sprintf("// failed to generate synthetic file descriptor: %s", err.Error())
 					continue
 				}
-				var src bytes.Buffer
-				err = format.PrintAndFormatFileDescriptor(newFile, &src)
+				src, err := r.printSyntheticFileLocked(uri, newFile)
 				if err != nil {
 					slog.With(
 						"uri", string(uri),
@@ -257,7 +343,7 @@ func (r *Resolver) CheckIncompleteDescriptors(results linker.Files) []string {
 					).Error("failed to generate synthetic file source")
 					continue
 				}
-				r.syntheticFiles[uri] = src.String()
+				r.syntheticFiles[uri] = src
 				// these files aren't going to have ASTs yet and will need to be recompiled
 				compileAgain = append(compileAgain, path)
 			}
@@ -271,6 +357,7 @@ func (r *Resolver) CheckIncompleteDescriptors(results linker.Files) []string {
 // 2. Check if the path is a file on disk
 // 3. Check if the path is a go module containing proto sources
 // 3.5. Check if the path is a go module path containing generated code, but no proto sources
+// (steps 2 and 3 are tried in the order set by the importPrecedence setting)
 // 4. Check if the path is found in the global message cache
 // 5. Try more complex path resolution strategies
 // 6. Try to analyze existing generated code to find the path used to generate it
@@ -282,6 +369,15 @@ func (r *Resolver) FindFileByPath(path protocompile.UnresolvedPath, whence proto
 	if lockedTime >= 10*time.Millisecond {
 		slog.Debug(fmt.Sprintf("warn: FindFileByPath blocked for %s", lockedTime))
 	}
+	defer metrics.resolveTime.since(time.Now())
+	_, known := r.fileURIsByPath[string(path)]
+	metrics.resolverLookups.record(known)
+	if res, ok, err := r.findAliasedFileLocked(string(path), whence); ok {
+		if err != nil {
+			slog.With("path", path, "error", err).Debug("could not resolve aliased path")
+		}
+		return res, err
+	}
 	res, err := r.findFileByPathLocked(string(path), whence)
 	if err != nil {
 		if whence != nil {
@@ -333,21 +429,13 @@ func (r *Resolver) findFileByPathLocked(path string, whence protocompile.ImportC
 		lg.Error("failed to check well-known import path")
 		return protocompile.SearchResult{}, err
 	}
-	if !isSynthetic {
-		if result, err := r.checkFS(path, whence); err == nil {
-			lg.With("time", time.Since(start)).Debug("resolved to cached file")
-			return result, nil
-		} else if !errors.Is(err, os.ErrNotExist) {
-			slog.With("path", path, "error", err).Debug("failed to check cached file")
-			return protocompile.SearchResult{}, err
-		}
-	}
-
-	if result, err := r.checkGoModule(path, whence); err == nil {
-		lg.With("time", time.Since(start)).Debug("resolved to go module")
+	previous := r.fileURIsByPath[path]
+	if result, source, err := r.resolveInOrderLocked(path, whence, isSynthetic); err == nil {
+		lg.With("time", time.Since(start), "source", source).Debug("resolved path")
+		r.recordConflictsLocked(path, source, previous)
 		return result, nil
-	} else if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, ErrNoModule) {
-		lg.Debug("failed to check go module")
+	} else if !errors.Is(err, os.ErrNotExist) {
+		lg.With("source", source, "error", err).Debug("failed to resolve path")
 		return protocompile.SearchResult{}, err
 	}
 	if IsWellKnownPath(path) {
@@ -428,6 +516,7 @@ func (r *Resolver) checkGoModule(path string, whence protocompile.ImportContext)
 		} else {
 			r.importSourcesByURI[uri] = SourceGoModuleCache
 		}
+		r.importOrigins[uri] = importOrigin{module: res.Module}
 		return protocompile.SearchResult{
 			Version:      1,
 			ResolvedPath: protocompile.ResolvedPath(path),
@@ -494,6 +583,12 @@ func (r *Resolver) checkGoModule(path string, whence protocompile.ImportContext)
 		r.fileURIsByPath[resolved] = uri
 		r.importSourcesByURI[uri] = SourceSynthetic
 		r.syntheticFileOriginalNames[uri] = original
+		origin := importOrigin{module: res.Module, descriptorName: synthesized.GetName()}
+		if res.KnownAltPath != "" {
+			origin.requestedPath = path
+			origin.resolution = "known alternative path"
+		}
+		r.importOrigins[uri] = origin
 		return protocompile.SearchResult{
 			Version:      1,
 			ResolvedPath: protocompile.ResolvedPath(resolved),
@@ -523,15 +618,15 @@ func (r *Resolver) checkGlobalCache(path string) (protocompile.SearchResult, err
 	uri := protocol.DocumentURI(syntheticURI.String())
 	r.filePathsByURI[uri] = path
 	r.fileURIsByPath[path] = uri
-	var src bytes.Buffer
-	err = format.PrintAndFormatFileDescriptor(fd, &src)
+	r.importSourcesByURI[uri] = SourceWellKnown
+	src, err := r.printSyntheticFileLocked(uri, fd)
 	if err != nil {
 		return protocompile.SearchResult{
 			ResolvedPath: protocompile.ResolvedPath(path),
 			Proto:        protodesc.ToFileDescriptorProto(fd),
 		}, nil
 	}
-	r.syntheticFiles[uri] = src.String()
+	r.syntheticFiles[uri] = src
 	return protocompile.SearchResult{
 		ResolvedPath: protocompile.ResolvedPath(path),
 		Source:       strings.NewReader(r.syntheticFiles[uri]),
@@ -569,7 +664,20 @@ func (r *Resolver) LookupGoModule(filename string, f io.Reader) (string, error)
 	return "", fmt.Errorf("could not determine go module for %s", filename)
 }
 
+// IsGoModuleCacheFile reports whether the file was resolved from the Go module
+// cache, and is therefore read-only.
+func (r *Resolver) IsGoModuleCacheFile(uri protocol.DocumentURI) bool {
+	r.pathsMu.RLock()
+	defer r.pathsMu.RUnlock()
+	return r.importSourcesByURI[uri] == SourceGoModuleCache
+}
+
 func (r *Resolver) IsRealWorkspaceLocalFile(uri protocol.DocumentURI) bool {
+	if r.HasSchemeHandler(uri) {
+		r.pathsMu.RLock()
+		defer r.pathsMu.RUnlock()
+		return r.importSourcesByURI[uri] == SourceRelativePath
+	}
 	if !uri.IsFile() {
 		return false
 	}
@@ -618,6 +726,9 @@ func (r *Resolver) PreloadWellKnownPaths() {
 }
 
 func (r *Resolver) FindGeneratedFiles(uri protocol.DocumentURI, fd protoreflect.FileDescriptor) ([]ParsedGoFile, error) {
+	if r.goLanguageDriver == nil {
+		return nil, ErrNoModule
+	}
 	return r.goLanguageDriver.FindGeneratedFiles(uri, fd.Options().(*descriptorpb.FileOptions), fd.Path())
 }
 
@@ -714,7 +825,7 @@ func (r *Resolver) translatePathLocked(path string, whence protocompile.ImportCo
 	}
 
 	var translatedPath string
-	if !uri.IsFile() {
+	if !uri.IsFile() || r.HasSchemeHandler(uri) {
 		return "", os.ErrNotExist
 	}
 	// simple cases:
@@ -783,6 +894,11 @@ func (r *Resolver) translatePathLocked(path string, whence protocompile.ImportCo
 		r.filePathsByURI[translatedURI] = canonicalName
 		r.fileURIsByPath[canonicalName] = translatedURI
 		r.importSourcesByURI[translatedURI] = SourceLocalGoModule
+		r.importOrigins[translatedURI] = importOrigin{
+			requestedPath: path,
+			resolution:    "relative to " + fd.GetName(),
+			module:        r.importOrigins[uri].module,
+		}
 		return canonicalName, nil
 	case SourceGoModuleCache:
 		originalDir := filepath.Dir(filename)
@@ -797,6 +913,11 @@ func (r *Resolver) translatePathLocked(path string, whence protocompile.ImportCo
 		r.filePathsByURI[translatedURI] = canonicalName
 		r.fileURIsByPath[canonicalName] = translatedURI
 		r.importSourcesByURI[translatedURI] = SourceGoModuleCache
+		r.importOrigins[translatedURI] = importOrigin{
+			requestedPath: path,
+			resolution:    "relative to " + fd.GetName(),
+			module:        r.importOrigins[uri].module,
+		}
 		return canonicalName, nil
 	case SourceRelativePath:
 		// it's already a relative path, so just make it relative to that one
@@ -0,0 +1,334 @@
+package lsp
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Support for AIP resource annotations (https://google.aip.dev/123).
+
+const (
+	resourceOptionName           = "google.api.resource"
+	resourceDefinitionOptionName = "google.api.resource_definition"
+)
+
+// resourceDefinition is a resource type declared by a google.api.resource
+// message option, or a google.api.resource_definition file option.
+type resourceDefinition struct {
+	desc     protoreflect.Descriptor
+	resource *annotations.ResourceDescriptor
+}
+
+// optionExtensionValues returns the values of the extension with the given
+// name set in an options message, unmarshaled as T. Interpreted options may
+// contain either generated or dynamic messages, depending on the resolver that
+// was used, so the value is round-tripped through the wire format.
+func optionExtensionValues[T proto.Message](opts proto.Message, name protoreflect.FullName, newT func() T) []T {
+	if opts == nil || !opts.ProtoReflect().IsValid() {
+		return nil
+	}
+	var values []T
+	unmarshal := func(msg protoreflect.Message) {
+		data, err := proto.Marshal(msg.Interface())
+		if err != nil {
+			return
+		}
+		out := newT()
+		if err := proto.Unmarshal(data, out); err == nil {
+			values = append(values, out)
+		}
+	}
+	opts.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.FullName() != name || fd.Kind() != protoreflect.MessageKind {
+			return true
+		}
+		if fd.IsList() {
+			for i := range v.List().Len() {
+				unmarshal(v.List().Get(i).Message())
+			}
+		} else {
+			unmarshal(v.Message())
+		}
+		return false
+	})
+	return values
+}
+
+func newResourceDescriptor() *annotations.ResourceDescriptor {
+	return &annotations.ResourceDescriptor{}
+}
+
+func messageResource(opts *descriptorpb.MessageOptions) *annotations.ResourceDescriptor {
+	if res := optionExtensionValues(opts, resourceOptionName, newResourceDescriptor); len(res) > 0 {
+		return res[0]
+	}
+	return nil
+}
+
+func fileResourceDefinitions(opts *descriptorpb.FileOptions) []*annotations.ResourceDescriptor {
+	return optionExtensionValues(opts, resourceDefinitionOptionName, newResourceDescriptor)
+}
+
+// findResourceDefinitions returns all resource types declared in the
+// workspace, keyed by type name.
+func (c *Cache) findResourceDefinitions(ctx context.Context) map[string]resourceDefinition {
+	var mu sync.Mutex
+	defs := map[string]resourceDefinition{}
+	seenFiles := map[string]struct{}{}
+	add := func(desc protoreflect.Descriptor, res *annotations.ResourceDescriptor) {
+		if res.GetType() == "" {
+			return
+		}
+		if _, ok := defs[res.GetType()]; !ok {
+			defs[res.GetType()] = resourceDefinition{desc: desc, resource: res}
+		}
+	}
+	c.RangeAllDescriptors(ctx, func(d protoreflect.Descriptor) bool {
+		var res *annotations.ResourceDescriptor
+		if msg, ok := d.(protoreflect.MessageDescriptor); ok {
+			if opts, ok := msg.Options().(*descriptorpb.MessageOptions); ok {
+				res = messageResource(opts)
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if res != nil {
+			add(d, res)
+		}
+		if f := d.ParentFile(); f != nil {
+			if _, ok := seenFiles[f.Path()]; !ok {
+				seenFiles[f.Path()] = struct{}{}
+				if opts, ok := f.Options().(*descriptorpb.FileOptions); ok {
+					for _, res := range fileResourceDefinitions(opts) {
+						add(f, res)
+					}
+				}
+			}
+		}
+		return true
+	})
+	return defs
+}
+
+// resolveResourceReference resolves a resource type name to the message or
+// file which declares it.
+func resolveResourceReference(c *Cache, _ protoreflect.FullName, value string) protoreflect.Descriptor {
+	if value == "*" {
+		return nil
+	}
+	if def, ok := c.findResourceDefinitions(context.TODO())[value]; ok {
+		return def.desc
+	}
+	return nil
+}
+
+// completeResourceTypes returns completions for resource type names, which
+// replace the entire string literal containing the cursor.
+func (c *Cache) completeResourceTypes(valueNode *ast.ValueNode, fileNode *ast.FileNode, pos protocol.Position) []protocol.CompletionItem {
+	rng := protocol.Range{Start: pos, End: pos}
+	switch {
+	case valueNode.GetStringLiteral() != nil, valueNode.GetCompoundStringLiteral() != nil:
+		rng = toRange(fileNode.NodeInfo(valueNode.Unwrap()))
+	case valueNode.GetVal() != nil:
+		return nil
+	}
+	defs := c.findResourceDefinitions(context.TODO())
+	types := make([]string, 0, len(defs))
+	for t := range defs {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	items := make([]protocol.CompletionItem, 0, len(types))
+	for _, t := range types {
+		def := defs[t]
+		quoted := strconv.Quote(t)
+		item := protocol.CompletionItem{
+			Label:      t,
+			Kind:       protocol.ReferenceCompletion,
+			FilterText: quoted,
+			TextEdit: &protocol.Or_CompletionItem_textEdit{
+				Value: protocol.TextEdit{
+					Range:   rng,
+					NewText: quoted,
+				},
+			},
+		}
+		if msg, ok := def.desc.(protoreflect.MessageDescriptor); ok {
+			item.Detail = string(msg.FullName())
+		} else {
+			item.Detail = def.desc.ParentFile().Path()
+		}
+		if len(def.resource.GetPattern()) > 0 {
+			item.Documentation = &protocol.Or_CompletionItem_documentation{
+				Value: protocol.MarkupContent{
+					Kind:  protocol.Markdown,
+					Value: "```\n" + strings.Join(def.resource.GetPattern(), "\n") + "\n```",
+				},
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+var (
+	resourceTypeRegex       = regexp.MustCompile(`^[a-z][a-z0-9.-]*/[A-Z][a-zA-Z0-9]*$`)
+	resourceCollectionRegex = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+	resourceVariableRegex   = regexp.MustCompile(`^\{[a-z][a-z0-9_]*\}$`)
+)
+
+// lintResourcePatterns checks that resource types and patterns declared by
+// google.api.resource and google.api.resource_definition options are well
+// formed.
+func lintResourcePatterns(_ context.Context, p *lintPass) {
+	fileNode := p.result.AST()
+	var fileOptNodes []*ast.OptionNode
+	for _, decl := range fileNode.Decls {
+		if opt := decl.GetOption(); opt != nil && isOptionNamed(p.result, opt, resourceDefinitionOptionName) {
+			fileOptNodes = append(fileOptNodes, opt)
+		}
+	}
+	for i, res := range fileResourceDefinitions(p.result.FileDescriptorProto().GetOptions()) {
+		if len(fileOptNodes) == 0 {
+			break
+		}
+		node := fileOptNodes[0]
+		if i < len(fileOptNodes) {
+			node = fileOptNodes[i]
+		}
+		checkResourceDescriptor(p, node, res)
+	}
+
+	ast.Inspect(fileNode, func(n ast.Node) bool {
+		msgNode, ok := n.(*ast.MessageNode)
+		if !ok {
+			return true
+		}
+		msg, ok := p.result.Descriptor(msgNode).(*descriptorpb.DescriptorProto)
+		if !ok {
+			return true
+		}
+		res := messageResource(msg.GetOptions())
+		if res == nil {
+			return true
+		}
+		checkResourceDescriptor(p, findResourceOptionNode(p.result, msgNode), res)
+		return true
+	})
+}
+
+// lintResourceNameField checks that messages annotated with google.api.resource
+// contain a string field holding the resource name.
+func lintResourceNameField(_ context.Context, p *lintPass) {
+	ast.Inspect(p.result.AST(), func(n ast.Node) bool {
+		msgNode, ok := n.(*ast.MessageNode)
+		if !ok {
+			return true
+		}
+		msg, ok := p.result.Descriptor(msgNode).(*descriptorpb.DescriptorProto)
+		if !ok {
+			return true
+		}
+		res := messageResource(msg.GetOptions())
+		if res == nil {
+			return true
+		}
+		nameField := res.GetNameField()
+		if nameField == "" {
+			nameField = "name"
+		}
+		idx := slices.IndexFunc(msg.GetField(), func(fld *descriptorpb.FieldDescriptorProto) bool {
+			return fld.GetName() == nameField
+		})
+		switch {
+		case idx == -1:
+			p.report(msgNode.GetName(), "resource message %s is missing a %q field", msg.GetName(), nameField)
+		case msg.GetField()[idx].GetType() != descriptorpb.FieldDescriptorProto_TYPE_STRING:
+			if fieldNode := p.result.FieldNode(msg.GetField()[idx]); fieldNode != nil {
+				p.report(fieldNode, "resource name field %q must be a string", nameField)
+			}
+		}
+		return true
+	})
+}
+
+func checkResourceDescriptor(p *lintPass, node ast.Node, res *annotations.ResourceDescriptor) {
+	if res.GetType() == "" {
+		p.report(node, "resource is missing a type")
+	} else if !resourceTypeRegex.MatchString(res.GetType()) {
+		p.report(node, "invalid resource type %q: expected {Service Name}/{Type}, e.g. \"library.googleapis.com/Book\"", res.GetType())
+	}
+	for _, pattern := range res.GetPattern() {
+		if err := validateResourcePattern(pattern); err != "" {
+			p.report(node, "invalid resource pattern %q: %s", pattern, err)
+		}
+	}
+}
+
+// validateResourcePattern returns a description of the first problem found in
+// the given resource name pattern, or an empty string if it is valid.
+func validateResourcePattern(pattern string) string {
+	if pattern == "" {
+		return "pattern is empty"
+	}
+	if strings.HasPrefix(pattern, "/") || strings.HasSuffix(pattern, "/") {
+		return "pattern must not begin or end with '/'"
+	}
+	seen := map[string]struct{}{}
+	for _, segment := range strings.Split(pattern, "/") {
+		switch {
+		case segment == "":
+			return "pattern contains an empty segment"
+		case strings.HasPrefix(segment, "{"):
+			if !resourceVariableRegex.MatchString(segment) {
+				return "variable " + segment + " must be a snake_case name in braces"
+			}
+			if _, ok := seen[segment]; ok {
+				return "variable " + segment + " appears more than once"
+			}
+			seen[segment] = struct{}{}
+		case !resourceCollectionRegex.MatchString(segment):
+			return "collection identifier " + strconv.Quote(segment) + " must be lowerCamelCase"
+		}
+	}
+	return ""
+}
+
+// findResourceOptionNode returns the first google.api.resource option declared
+// in the message, or the message name if there is none.
+func findResourceOptionNode(res linker.Result, msgNode *ast.MessageNode) ast.Node {
+	for _, decl := range msgNode.GetDecls() {
+		if opt := decl.GetOption(); opt != nil && isOptionNamed(res, opt, resourceOptionName) {
+			return opt
+		}
+	}
+	return msgNode.GetName()
+}
+
+// isOptionNamed reports whether the first component of the option's name
+// refers to the extension with the given name.
+func isOptionNamed(res linker.Result, opt *ast.OptionNode, name protoreflect.FullName) bool {
+	if opt.Name == nil || len(opt.Name.Parts) == 0 {
+		return false
+	}
+	ref := opt.Name.Parts[0].GetFieldRef()
+	if ref == nil || !ref.IsExtension() {
+		return false
+	}
+	fd := res.FindFieldDescriptorByFieldReferenceNode(ref)
+	return fd != nil && fd.FullName() == name
+}
@@ -0,0 +1,102 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestSandboxedCache(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "go.mod"), []byte("module example.com/sandbox\n\ngo 1.22\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(workspace, "a.proto")
+	if err := os.WriteFile(filename, []byte("syntax = \"proto3\";\npackage a;\nimport \"google/protobuf/any.proto\";\nmessage A {\n  google.protobuf.Any any = 1;\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCache(protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(workspace))}, WithSandboxedCache())
+	defer c.Close(nil)
+	if c.resolver.goLanguageDriver != nil {
+		t.Fatal("go language driver should not be created in sandbox mode")
+	}
+	if _, err := c.baseline.FileAtRevision(context.Background(), filename, "HEAD"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected git baseline to be unavailable, got %v", err)
+	}
+
+	c.LoadFiles([]string{filename})
+	path, err := c.resolver.URIToPath(protocol.URIFromPath(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "a.proto" {
+		t.Errorf("got path %q, want a.proto", path)
+	}
+	fd, err := c.FindFileByURI(protocol.URIFromPath(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := fd.Messages().ByName("A").Fields().ByName("any").Message(); msg.IsPlaceholder() {
+		t.Error("well-known import was not resolved")
+	}
+}
+
+func TestMissingGoToolchain(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "go.mod"), []byte("module example.com/nogo\n\ngo 1.22\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, workspace, map[string]string{
+		"a.proto": "syntax = \"proto3\";\npackage a;\nimport \"b.proto\";\nmessage A {\n    b.B b = 1;\n  Missing m = 2;\n}\n",
+		"b.proto": "syntax = \"proto3\";\npackage b;\nmessage B {}\n",
+	})
+	t.Setenv("PATH", t.TempDir())
+
+	c := NewCache(protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(workspace)), Name: "nogo"})
+	defer c.Close(nil)
+	if c.resolver.goLanguageDriver != nil {
+		t.Fatal("go language driver should not be created without a go toolchain")
+	}
+	if !errors.Is(c.resolver.goLanguageDriverErr, ErrGoToolchainUnavailable) {
+		t.Fatalf("expected ErrGoToolchainUnavailable, got %v", c.resolver.goLanguageDriverErr)
+	}
+	if msg := c.GoToolchainWarning(); !strings.Contains(msg, "nogo") {
+		t.Errorf("unexpected warning: %q", msg)
+	}
+
+	c.LoadFiles([]string{filepath.Join(workspace, "a.proto"), filepath.Join(workspace, "b.proto")})
+	uri := protocol.URIFromPath(filepath.Join(workspace, "a.proto"))
+
+	all, err := c.XGetAllDiagnostics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all[uri]) != 1 || !strings.Contains(all[uri][0].Message, "Missing") {
+		t.Errorf("unexpected diagnostics: %+v", all[uri])
+	}
+
+	locations, err := c.FindDefinitions(context.Background(), c.Snapshot(), protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     protocol.Position{Line: 4, Character: 7},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 || locations[0].URI != protocol.URIFromPath(filepath.Join(workspace, "b.proto")) {
+		t.Errorf("unexpected definition: %+v", locations)
+	}
+
+	edits, err := c.FormatDocument(protocol.TextDocumentIdentifier{URI: uri}, protocol.FormattingOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits) == 0 {
+		t.Error("expected formatting edits")
+	}
+}
@@ -0,0 +1,176 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+type scalarTypeInfo struct {
+	wireType string
+	encoding string
+	values   string
+	goType   string
+	javaType string
+	pyType   string
+}
+
+// scalarTypes describes the builtin scalar types, following the scalar value
+// types table in the protobuf language guide.
+var scalarTypes = map[string]scalarTypeInfo{
+	"double": {
+		wireType: "I64",
+		encoding: "IEEE 754 double-precision floating point, always 8 bytes.",
+		values:   "±1.7976931348623157e308, inf, -inf, nan",
+		goType:   "float64", javaType: "double", pyType: "float",
+	},
+	"float": {
+		wireType: "I32",
+		encoding: "IEEE 754 single-precision floating point, always 4 bytes.",
+		values:   "±3.4028235e38, inf, -inf, nan",
+		goType:   "float32", javaType: "float", pyType: "float",
+	},
+	"int32": {
+		wireType: "VARINT",
+		encoding: "Variable-length encoding. Inefficient for negative numbers, which always take 10 bytes – if the field is likely to have negative values, use `sint32` instead.",
+		values:   "-2³¹ to 2³¹-1",
+		goType:   "int32", javaType: "int", pyType: "int",
+	},
+	"int64": {
+		wireType: "VARINT",
+		encoding: "Variable-length encoding. Inefficient for negative numbers, which always take 10 bytes – if the field is likely to have negative values, use `sint64` instead.",
+		values:   "-2⁶³ to 2⁶³-1",
+		goType:   "int64", javaType: "long", pyType: "int",
+	},
+	"uint32": {
+		wireType: "VARINT",
+		encoding: "Variable-length encoding.",
+		values:   "0 to 2³²-1",
+		goType:   "uint32", javaType: "int", pyType: "int",
+	},
+	"uint64": {
+		wireType: "VARINT",
+		encoding: "Variable-length encoding.",
+		values:   "0 to 2⁶⁴-1",
+		goType:   "uint64", javaType: "long", pyType: "int",
+	},
+	"sint32": {
+		wireType: "VARINT",
+		encoding: "ZigZag variable-length encoding. Encodes negative numbers more efficiently than `int32`.",
+		values:   "-2³¹ to 2³¹-1",
+		goType:   "int32", javaType: "int", pyType: "int",
+	},
+	"sint64": {
+		wireType: "VARINT",
+		encoding: "ZigZag variable-length encoding. Encodes negative numbers more efficiently than `int64`.",
+		values:   "-2⁶³ to 2⁶³-1",
+		goType:   "int64", javaType: "long", pyType: "int",
+	},
+	"fixed32": {
+		wireType: "I32",
+		encoding: "Always 4 bytes. More efficient than `uint32` if values are often greater than 2²⁸.",
+		values:   "0 to 2³²-1",
+		goType:   "uint32", javaType: "int", pyType: "int",
+	},
+	"fixed64": {
+		wireType: "I64",
+		encoding: "Always 8 bytes. More efficient than `uint64` if values are often greater than 2⁵⁶.",
+		values:   "0 to 2⁶⁴-1",
+		goType:   "uint64", javaType: "long", pyType: "int",
+	},
+	"sfixed32": {
+		wireType: "I32",
+		encoding: "Always 4 bytes.",
+		values:   "-2³¹ to 2³¹-1",
+		goType:   "int32", javaType: "int", pyType: "int",
+	},
+	"sfixed64": {
+		wireType: "I64",
+		encoding: "Always 8 bytes.",
+		values:   "-2⁶³ to 2⁶³-1",
+		goType:   "int64", javaType: "long", pyType: "int",
+	},
+	"bool": {
+		wireType: "VARINT",
+		encoding: "Variable-length encoding, always 1 byte.",
+		values:   "true, false",
+		goType:   "bool", javaType: "boolean", pyType: "bool",
+	},
+	"string": {
+		wireType: "LEN",
+		encoding: "Length-delimited. Must contain UTF-8 encoded or 7-bit ASCII text.",
+		values:   "up to 2³² bytes",
+		goType:   "string", javaType: "String", pyType: "str",
+	},
+	"bytes": {
+		wireType: "LEN",
+		encoding: "Length-delimited. May contain any arbitrary sequence of bytes.",
+		values:   "up to 2³² bytes",
+		goType:   "[]byte", javaType: "ByteString", pyType: "bytes",
+	},
+}
+
+// tryHoverScalarType returns a hover describing a builtin scalar type, if the
+// given position is on the type of a field or map field.
+func (c *Cache) tryHoverScalarType(snapshot *Snapshot, params protocol.TextDocumentPositionParams) *protocol.Hover {
+	parseRes, err := snapshot.FindParseResultByURI(params.TextDocument.URI)
+	if err != nil {
+		return nil
+	}
+	mapper, err := c.GetMapper(params.TextDocument.URI)
+	if err != nil {
+		return nil
+	}
+	offset, err := mapper.PositionOffset(params.Position)
+	if err != nil {
+		return nil
+	}
+	fileNode := parseRes.AST()
+	token, comment := fileNode.ItemAtOffset(offset)
+	if token == ast.TokenError || comment.IsValid() {
+		return nil
+	}
+
+	var typeNode *ast.IdentNode
+	ast.Inspect(fileNode, func(node ast.Node) bool {
+		var candidates []*ast.IdentNode
+		switch node := node.(type) {
+		case *ast.FieldNode:
+			candidates = append(candidates, node.GetFieldType().GetIdent())
+		case *ast.MapTypeNode:
+			candidates = append(candidates, node.GetKeyType(), node.GetValueType().GetIdent())
+		}
+		for _, ident := range candidates {
+			if ident != nil && ident.GetToken() == token {
+				typeNode = ident
+			}
+		}
+		return typeNode == nil
+	}, ast.WithIntersection(token))
+	if typeNode == nil {
+		return nil
+	}
+	name := string(typeNode.AsIdentifier())
+	info, ok := scalarTypes[name]
+	if !ok {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "```protobuf\n%s\n```\n", name)
+	fmt.Fprintf(&b, "Builtin scalar type (wire type `%s`)\n\n", info.wireType)
+	fmt.Fprintf(&b, "%s\n\n", info.encoding)
+	fmt.Fprintf(&b, "Range: %s\n\n", info.values)
+	b.WriteString("| Go | Java | Python |\n|---|---|---|\n")
+	fmt.Fprintf(&b, "| `%s` | `%s` | `%s` |\n", info.goType, info.javaType, info.pyType)
+
+	return &protocol.Hover{
+		Contents: protocol.MarkupContent{
+			Kind:  protocol.Markdown,
+			Value: b.String(),
+		},
+		Range: toRange(fileNode.NodeInfo(typeNode)),
+	}
+}
@@ -0,0 +1,187 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/cache"
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// A SchemeHandler provides access to files identified by URIs with a scheme
+// other than file://, such as those used by remote collaboration sessions
+// (vsls:) or archive-backed workspaces. Handlers are registered with
+// WithSchemeHandler when the server is constructed.
+type SchemeHandler interface {
+	// ReadFile returns the contents of the file with the given URI. If the file
+	// does not exist, the returned error should wrap os.ErrNotExist.
+	ReadFile(ctx context.Context, uri protocol.DocumentURI) ([]byte, error)
+	// ListProtoFiles returns the URIs of all .proto files under the given root,
+	// which is the URI of a workspace folder.
+	ListProtoFiles(ctx context.Context, root protocol.DocumentURI) ([]protocol.DocumentURI, error)
+}
+
+// A DirectoryReader is a SchemeHandler which can also list the files in a
+// directory. Implementing it is optional: files other than .proto files which
+// are found by name pattern, such as smoke test requests, can only be
+// discovered in directories that can be listed.
+type DirectoryReader interface {
+	// ReadDir returns the URIs of the files in the given directory, which is
+	// identified by a URI without a trailing slash.
+	ReadDir(ctx context.Context, dir protocol.DocumentURI) ([]protocol.DocumentURI, error)
+}
+
+// WithSchemeHandler registers a handler for URIs with the given scheme (without
+// the trailing colon). Handlers for the file and proto schemes are ignored.
+func WithSchemeHandler(scheme string, handler SchemeHandler) ServerOption {
+	return func(o *ServerOptions) {
+		if scheme == "file" || scheme == "proto" {
+			return
+		}
+		if o.schemeHandlers == nil {
+			o.schemeHandlers = make(map[string]SchemeHandler)
+		}
+		o.schemeHandlers[scheme] = handler
+	}
+}
+
+// WithSchemeHandlers sets the handlers used by the cache's resolver to read
+// files with non-file URI schemes.
+func WithSchemeHandlers(handlers map[string]SchemeHandler) CacheOption {
+	return func(o *CacheOptions) {
+		o.schemeHandlers = handlers
+	}
+}
+
+func uriScheme(uri protocol.DocumentURI) string {
+	scheme, _, ok := strings.Cut(string(uri), ":")
+	if !ok {
+		return ""
+	}
+	return scheme
+}
+
+// uriPath returns the path component of the URI. Unlike DocumentURI.Path, it
+// does not panic for URIs with schemes other than file://.
+func uriPath(uri protocol.DocumentURI) string {
+	if uri.IsFile() {
+		return uri.Path()
+	}
+	u, err := url.Parse(string(uri))
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// schemeFS is a file.Source which reads URIs using the handler registered for
+// their scheme, and otherwise reads file:// URIs from disk. Contents read by a
+// handler are kept until the file is invalidated.
+type schemeFS struct {
+	disk     *cache.MemoizedFS
+	handlers map[string]SchemeHandler
+
+	mu    sync.Mutex
+	files map[protocol.DocumentURI]*virtualFile
+}
+
+var _ file.Source = (*schemeFS)(nil)
+
+func (fs *schemeFS) handlerFor(uri protocol.DocumentURI) (SchemeHandler, bool) {
+	h, ok := fs.handlers[uriScheme(uri)]
+	return h, ok
+}
+
+// invalidate discards the cached contents of a file read by a handler.
+func (fs *schemeFS) invalidate(uri protocol.DocumentURI) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.files, uri)
+}
+
+// ReadFile implements file.Source.
+func (fs *schemeFS) ReadFile(ctx context.Context, uri protocol.DocumentURI) (file.Handle, error) {
+	h, ok := fs.handlerFor(uri)
+	if !ok {
+		if !uri.IsFile() {
+			return &virtualFile{uri: uri, err: fmt.Errorf("%w: no handler for URI scheme %q", os.ErrNotExist, uriScheme(uri))}, nil
+		}
+		return fs.disk.ReadFile(ctx, uri)
+	}
+	fs.mu.Lock()
+	fh, ok := fs.files[uri]
+	fs.mu.Unlock()
+	if ok {
+		return fh, nil
+	}
+	content, err := h.ReadFile(ctx, uri)
+	if err != nil {
+		return &virtualFile{uri: uri, err: err}, nil
+	}
+	fh = &virtualFile{
+		uri:     uri,
+		content: content,
+		hash:    file.HashOf(content),
+	}
+	fs.mu.Lock()
+	if fs.files == nil {
+		fs.files = make(map[protocol.DocumentURI]*virtualFile)
+	}
+	fs.files[uri] = fh
+	fs.mu.Unlock()
+	return fh, nil
+}
+
+// readDir returns the URIs of the files in the given directory, using the
+// handler registered for its scheme, or the file system for file:// URIs.
+func (fs *schemeFS) readDir(ctx context.Context, dir protocol.DocumentURI) ([]protocol.DocumentURI, error) {
+	h, ok := fs.handlerFor(dir)
+	if !ok {
+		if !dir.IsFile() {
+			return nil, fmt.Errorf("%w: no handler for URI scheme %q", os.ErrNotExist, uriScheme(dir))
+		}
+		entries, err := os.ReadDir(dir.Path())
+		if err != nil {
+			return nil, err
+		}
+		var uris []protocol.DocumentURI
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				uris = append(uris, protocol.URIFromPath(filepath.Join(dir.Path(), entry.Name())))
+			}
+		}
+		return uris, nil
+	}
+	lister, ok := h.(DirectoryReader)
+	if !ok {
+		return nil, fmt.Errorf("the handler for URI scheme %q cannot list directories", uriScheme(dir))
+	}
+	return lister.ReadDir(ctx, dir)
+}
+
+// A virtualFile is a file read by a SchemeHandler, or a failure to read one.
+type virtualFile struct {
+	uri     protocol.DocumentURI
+	content []byte
+	hash    file.Hash
+	err     error
+}
+
+func (h *virtualFile) URI() protocol.DocumentURI { return h.uri }
+
+func (h *virtualFile) Identity() file.Identity {
+	return file.Identity{
+		URI:  h.uri,
+		Hash: h.hash,
+	}
+}
+
+func (h *virtualFile) SameContentsOnDisk() bool { return true }
+func (h *virtualFile) Version() int32           { return 0 }
+func (h *virtualFile) Content() ([]byte, error) { return h.content, h.err }
@@ -0,0 +1,81 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+type memSchemeHandler map[protocol.DocumentURI]string
+
+func (h memSchemeHandler) ReadFile(_ context.Context, uri protocol.DocumentURI) ([]byte, error) {
+	contents, ok := h[uri]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", os.ErrNotExist, uri)
+	}
+	return []byte(contents), nil
+}
+
+func (h memSchemeHandler) ListProtoFiles(_ context.Context, root protocol.DocumentURI) ([]protocol.DocumentURI, error) {
+	var uris []protocol.DocumentURI
+	for uri := range h {
+		if strings.HasPrefix(string(uri), string(root)+"/") && strings.HasSuffix(string(uri), ".proto") {
+			uris = append(uris, uri)
+		}
+	}
+	slices.Sort(uris)
+	return uris, nil
+}
+
+func TestSchemeHandler(t *testing.T) {
+	handler := memSchemeHandler{
+		"mem:///workspace/a.proto":   "syntax = \"proto3\";\npackage a;\nimport \"b/b.proto\";\nmessage A {\n  b.B b = 1;\n}\n",
+		"mem:///workspace/b/b.proto": "syntax = \"proto3\";\npackage b;\nmessage B {}\n",
+	}
+	var opts ServerOptions
+	opts.apply(WithSchemeHandler("mem", handler), WithSchemeHandler("file", handler))
+	if _, ok := opts.schemeHandlers["file"]; ok {
+		t.Fatal("handler for the file scheme should be ignored")
+	}
+
+	c := NewCache(protocol.WorkspaceFolder{URI: "mem:///workspace"}, WithSchemeHandlers(opts.schemeHandlers))
+	defer c.Close(nil)
+	c.loadWorkspaceFiles()
+
+	path, err := c.resolver.URIToPath("mem:///workspace/b/b.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "b/b.proto" {
+		t.Errorf("got path %q, want %q", path, "b/b.proto")
+	}
+	if !c.resolver.IsRealWorkspaceLocalFile("mem:///workspace/a.proto") {
+		t.Error("expected a.proto to be a workspace-local file")
+	}
+
+	fd, err := c.FindFileByURI("mem:///workspace/a.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := fd.Messages().ByName("A").Fields().ByName("b")
+	if field == nil || field.Message() == nil || field.Message().FullName() != "b.B" || field.Message().IsPlaceholder() {
+		t.Errorf("b.B was not resolved: %v", field)
+	}
+
+	mapper, err := c.GetMapper("mem:///workspace/b/b.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(mapper.Content) != handler["mem:///workspace/b/b.proto"] {
+		t.Errorf("unexpected mapper content: %q", mapper.Content)
+	}
+
+	if c.resolver.HasSchemeHandler("other:///workspace/a.proto") {
+		t.Error("unexpected handler for an unregistered scheme")
+	}
+}
@@ -1,6 +1,7 @@
 package lsp
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"slices"
@@ -25,8 +26,12 @@ var ErrNoDescriptorFound = fmt.Errorf("failed to find descriptor")
 
 // Traverses the given path backwards to find the closest top-level mapped
 // descriptor, then traverses forwards to find the deeply nested descriptor
-// for the original ast node.
-func deepPathSearch(path protopath.Path, parseRes parser.Result, linkRes linker.Result) (protoreflect.Descriptor, protocol.Range, error) {
+// for the original ast node. Returns the context's error if it is cancelled
+// before the search completes.
+func computeDeepPathSearch(ctx context.Context, path protopath.Path, parseRes parser.Result, linkRes linker.Result) (protoreflect.Descriptor, protocol.Range, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, protocol.Range{}, err
+	}
 	root := linkRes.AST()
 	if len(path) == 0 {
 		panic("bug: empty path")
@@ -152,9 +157,15 @@ func deepPathSearch(path protopath.Path, parseRes parser.Result, linkRes linker.
 				switch nodeDescriptor := nodeDescriptor.(type) {
 				case *descriptorpb.UninterpretedOption_NamePart:
 					switch nodeDescriptor.GetNamePart() {
-					case "default", "json_name":
+					case "default":
+						return resolveDefaultPseudoOption(linkRes, values, currentNode)
+					case "json_name":
 						return nil, protocol.Range{}, fmt.Errorf("option %q is a language builtin", nodeDescriptor.GetNamePart())
 					}
+				case *descriptorpb.UninterpretedOption:
+					if isDefaultPseudoOption(nodeDescriptor.GetName()) {
+						return resolveDefaultPseudoOption(linkRes, values, currentNode)
+					}
 				}
 				return nil, protocol.Range{}, fmt.Errorf("could not find descriptor for %T", nodeDescriptor)
 			}
@@ -171,6 +182,9 @@ func deepPathSearch(path protopath.Path, parseRes parser.Result, linkRes linker.
 	stack.push(root, linkRes)
 
 	for i := len(stack) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return nil, protocol.Range{}, err
+		}
 		want := stack[i]
 		if want.isResolved() {
 			continue
@@ -366,7 +380,19 @@ func deepPathSearch(path protopath.Path, parseRes parser.Result, linkRes linker.
 				// If we get here, we passed through a synthetic map type node, which
 				// is directly mapped -- we just couldn't detect it earlier since it
 				// isn't actually present at the location we're looking at.
-				want.desc = haveDesc.MapValue().Message()
+				if i > 0 && stack[i-1].node == ast.Node(wantNode.KeyType) {
+					// the key type is always a scalar; resolve to the synthetic key field
+					want.desc = haveDesc.MapKey()
+					break
+				}
+				switch value := haveDesc.MapValue(); value.Kind() {
+				case protoreflect.MessageKind:
+					want.desc = value.Message()
+				case protoreflect.EnumKind:
+					want.desc = value.Enum()
+				default:
+					want.desc = value
+				}
 			case *ast.CompactOptionsNode:
 				want.desc = haveDesc.Options().(*descriptorpb.FieldOptions).ProtoReflect().Descriptor()
 			case ast.AnyIdentValueNode:
@@ -374,6 +400,9 @@ func deepPathSearch(path protopath.Path, parseRes parser.Result, linkRes linker.
 				switch haveNode := have.node.(type) {
 				case *ast.FieldReferenceNode:
 					want.desc = haveDesc
+				case *ast.MapTypeNode:
+					// synthetic map entry key field
+					want.desc = haveDesc
 				case *ast.MessageFieldNode:
 					switch haveDesc.Kind() {
 					case protoreflect.EnumKind:
@@ -497,6 +526,12 @@ func deepPathSearch(path protopath.Path, parseRes parser.Result, linkRes linker.
 		return nil, protocol.Range{}, nil
 	}
 
+	// the value type of a map field is not present in the path; narrow the
+	// range from the whole map type to just the value type
+	if mapType, ok := stack[0].node.(*ast.MapTypeNode); ok && mapType.ValueType != nil {
+		return stack[0].desc, toRange(root.NodeInfo(mapType.ValueType)), nil
+	}
+
 	// as a special case, adjust the range for compound identifiers
 	if _, ok := stack[0].node.(*ast.IdentNode); ok {
 		if compoundIdent, ok := stack[1].node.(*ast.CompoundIdentNode); ok {
@@ -645,7 +680,7 @@ func findNarrowestSemanticToken(parseRes parser.Result, tokens []semanticItem, p
 //	    __ <- [(file)→(message Foo)→(field bar)→(compact options)]
 //	  ];
 //	}
-func findPathIntersectingToken(parseRes parser.Result, tokenAtOffset ast.Token, location protocol.Position) (protopath.Values, bool) {
+func computePathIntersectingToken(parseRes parser.Result, tokenAtOffset ast.Token, location protocol.Position) (protopath.Values, bool) {
 	tracker := &paths.AncestorTracker{}
 	paths := []protopath.Values{}
 	fileNode := parseRes.AST()
@@ -850,60 +885,100 @@ func findPathsEnclosingRange(parseRes parser.Result, start, end ast.Token, visit
 	return paths[lowerBound:], true
 }
 
+// findDefinition returns a reference to the name of the declaration of the
+// descriptor, or to the file node for file descriptors.
 func findDefinition(desc protoreflect.Descriptor, linkRes linker.Result) (ast.NodeReference, error) {
+	decl, err := findDeclaration(desc, linkRes)
+	if err != nil {
+		return ast.NodeReference{}, err
+	}
+	var node ast.Node = decl
+	if named, ok := decl.(interface{ GetName() *ast.IdentNode }); ok {
+		name := named.GetName()
+		if name == nil {
+			return ast.NodeReference{}, fmt.Errorf("failed to find node for %q", desc.FullName())
+		}
+		node = name
+	}
+	return ast.NewNodeReference(linkRes.AST(), node), nil
+}
+
+// findDeclaration returns the node declaring the descriptor: the whole
+// message, field, enum value, etc. including its body and options.
+func findDeclaration(desc protoreflect.Descriptor, linkRes linker.Result) (ast.Node, error) {
 	var node ast.Node
 	switch desc := desc.(type) {
 	case protoreflect.MessageDescriptor:
-		node = linkRes.MessageNode(desc.(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.DescriptorProto)).GetName()
+		node = nonNilNode(linkRes.MessageNode(desc.(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.DescriptorProto)))
 	case protoreflect.EnumDescriptor:
-		node = linkRes.EnumNode(desc.(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.EnumDescriptorProto)).GetName()
+		node = nonNilNode(linkRes.EnumNode(desc.(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.EnumDescriptorProto)))
 	case protoreflect.ServiceDescriptor:
-		node = linkRes.ServiceNode(desc.(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.ServiceDescriptorProto)).GetName()
+		node = nonNilNode(linkRes.ServiceNode(desc.(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.ServiceDescriptorProto)))
 	case protoreflect.MethodDescriptor:
-		node = linkRes.MethodNode(desc.(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.MethodDescriptorProto)).GetName()
+		node = nonNilNode(linkRes.MethodNode(desc.(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.MethodDescriptorProto)))
 	case protoreflect.FieldDescriptor:
 		if !desc.IsExtension() {
 			switch desc := desc.(type) {
 			case protoutil.DescriptorProtoWrapper:
-				node = linkRes.FieldNode(desc.AsProto().(*descriptorpb.FieldDescriptorProto)).GetName()
+				node = nonNilNode(linkRes.FieldNode(desc.AsProto().(*descriptorpb.FieldDescriptorProto)))
 			default:
 				// these can be internal filedesc.Field descriptors for e.g. builtin options
-				node = linkRes.FieldNode(linkRes.FindDescriptorByName(desc.FullName()).(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.FieldDescriptorProto)).GetName()
+				node = nonNilNode(linkRes.FieldNode(linkRes.FindDescriptorByName(desc.FullName()).(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.FieldDescriptorProto)))
 			}
 		} else {
 			switch desc := desc.(type) {
 			case protoutil.DescriptorProtoWrapper:
-				node = linkRes.FieldNode(desc.AsProto().(*descriptorpb.FieldDescriptorProto)).GetName()
+				node = nonNilNode(linkRes.FieldNode(desc.AsProto().(*descriptorpb.FieldDescriptorProto)))
 			case protoreflect.ExtensionTypeDescriptor:
-				node = linkRes.FieldNode(desc.Descriptor().(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.FieldDescriptorProto)).GetName()
+				node = nonNilNode(linkRes.FieldNode(desc.Descriptor().(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.FieldDescriptorProto)))
 			}
 		}
 	case protoreflect.EnumValueDescriptor:
 		// TODO(editions): builtin enums aren't wrappers here yet
 		switch desc := desc.(type) {
 		case protoutil.DescriptorProtoWrapper:
-			node = linkRes.EnumValueNode(desc.AsProto().(*descriptorpb.EnumValueDescriptorProto)).GetName()
+			node = nonNilNode(linkRes.EnumValueNode(desc.AsProto().(*descriptorpb.EnumValueDescriptorProto)))
 		default:
-			node = linkRes.EnumValueNode(linkRes.FindDescriptorByName(desc.FullName()).(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.EnumValueDescriptorProto)).GetName()
+			node = nonNilNode(linkRes.EnumValueNode(linkRes.FindDescriptorByName(desc.FullName()).(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.EnumValueDescriptorProto)))
 		}
 	case protoreflect.OneofDescriptor:
-		node = linkRes.OneofNode(desc.(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.OneofDescriptorProto)).GetName()
+		node = nonNilNode(linkRes.OneofNode(desc.(protoutil.DescriptorProtoWrapper).AsProto().(*descriptorpb.OneofDescriptorProto)))
 	case protoreflect.FileDescriptor:
 		node = linkRes.FileNode()
 		slog.Debug("definition is an import: ", "import", linkRes.Path())
 	default:
-		return ast.NodeReference{}, fmt.Errorf("unexpected descriptor type %T", desc)
+		return nil, fmt.Errorf("unexpected descriptor type %T", desc)
 	}
 	if node == nil {
-		return ast.NodeReference{}, fmt.Errorf("failed to find node for %q", desc.FullName())
+		return nil, fmt.Errorf("failed to find node for %q", desc.FullName())
 	}
 	if _, ok := node.(*ast.NoSourceNode); ok {
-		return ast.NodeReference{}, fmt.Errorf("no source available")
+		return nil, fmt.Errorf("no source available")
 	}
-	return ast.NewNodeReference(linkRes.AST(), node), nil
+	return node, nil
 }
 
-func findNodeReferences(desc protoreflect.Descriptor, files linker.Files) <-chan ast.NodeReference {
+// nonNilNode converts a possibly nil node pointer to an interface which is
+// nil if the pointer is.
+func nonNilNode[T any, P interface {
+	*T
+	ast.Node
+}](node P) ast.Node {
+	if node == nil {
+		return nil
+	}
+	return node
+}
+
+// findNodeReferences searches all files for references to the given
+// descriptor. If index is non-nil, only files which it reports as possibly
+// containing references are searched. The returned channel is closed once all
+// files have been searched, or early if the context is cancelled; callers
+// should check the context's error to distinguish the two.
+func findNodeReferences(ctx context.Context, desc protoreflect.Descriptor, files linker.Files, index *referenceIndex) <-chan ast.NodeReference {
+	if index != nil {
+		files = index.filter(desc, files)
+	}
 	var wg sync.WaitGroup
 	refs := make(chan ast.NodeReference, len(files))
 	seen := sync.Map{}
@@ -915,9 +990,16 @@ func findNodeReferences(desc protoreflect.Descriptor, files linker.Files) <-chan
 		res := res.(linker.Result)
 		go func() {
 			defer wg.Done()
+			if ctx.Err() != nil {
+				return
+			}
 			for _, ref := range res.FindReferences(desc) {
 				if _, seen := seen.LoadOrStore(ref.String(), struct{}{}); !seen {
-					refs <- ref
+					select {
+					case refs <- ref:
+					case <-ctx.Done():
+						return
+					}
 				}
 			}
 		}()
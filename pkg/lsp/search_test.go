@@ -0,0 +1,205 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kralicky/protocompile"
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestFindNodeReferencesCancelled(t *testing.T) {
+	compiler := protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{
+				"a.proto": `syntax = "proto3"; package a; message A {}`,
+				"b.proto": `syntax = "proto3"; package b; import "a.proto"; message B { a.A a = 1; }`,
+				"c.proto": `syntax = "proto3"; package c; import "a.proto"; message C { a.A a = 1; }`,
+			}),
+		},
+	}
+	res, err := compiler.Compile(context.Background(), "a.proto", "b.proto", "c.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := res.Files.FindFileByPath("a.proto").Messages().ByName("A")
+
+	count := func(ctx context.Context) int {
+		n := 0
+		for range findNodeReferences(ctx, desc, res.Files, nil) {
+			n++
+		}
+		return n
+	}
+	if n := count(context.Background()); n != 2 {
+		t.Fatalf("expected 2 references, got %d", n)
+	}
+	ctx, ca := context.WithCancel(context.Background())
+	ca()
+	if n := count(ctx); n != 0 {
+		t.Fatalf("expected no references after cancellation, got %d", n)
+	}
+}
+
+func TestReferenceIndex(t *testing.T) {
+	compiler := protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{
+				"a.proto": `syntax = "proto3"; package a; message A { message Nested {} }`,
+				"b.proto": `syntax = "proto3"; package b; import "a.proto"; message B { a.A.Nested a = 1; }`,
+				"c.proto": `syntax = "proto3"; package c; message C {}`,
+			}),
+		},
+		RetainASTs: true,
+	}
+	res, err := compiler.Compile(context.Background(), "a.proto", "b.proto", "c.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := newReferenceIndex()
+	for _, f := range res.Files {
+		index.update(f.(linker.Result))
+	}
+	desc := res.Files.FindFileByPath("a.proto").Messages().ByName("A").Messages().ByName("Nested")
+
+	var paths []string
+	for _, f := range index.filter(desc, res.Files) {
+		paths = append(paths, f.Path())
+	}
+	slices.Sort(paths)
+	if !slices.Equal(paths, []string{"a.proto", "b.proto"}) {
+		t.Errorf("unexpected candidate files: %v", paths)
+	}
+	n := 0
+	for range findNodeReferences(context.Background(), desc, res.Files, index) {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("expected 1 reference, got %d", n)
+	}
+
+	index.remove("b.proto")
+	if index.indexed("b.proto") {
+		t.Error("b.proto should no longer be indexed")
+	}
+	if len(index.filter(desc, res.Files)) != 2 {
+		t.Error("files which are not indexed should always be searched")
+	}
+}
+
+func TestSemanticTokenIndex(t *testing.T) {
+	items := []semanticItem{
+		{line: 0, start: 0, len: 6},
+		{line: 0, start: 9, len: 8},
+		{line: 3, start: 2, len: 4},
+		{line: 5, start: 0, len: 1},
+		{line: 5, start: 4, len: 3},
+	}
+	index := newSemanticTokenIndex(nil, nil, items)
+	for line, want := range []int{2, 0, 0, 1, 0, 2, 0} {
+		if got := len(index.line(uint32(line))); got != want {
+			t.Errorf("line %d: got %d tokens, want %d", line, got, want)
+		}
+	}
+	if tokens := index.line(5); tokens[0].start != 0 || tokens[1].start != 4 {
+		t.Errorf("unexpected tokens on line 5: %v", tokens)
+	}
+	if len(newSemanticTokenIndex(nil, nil, nil).line(0)) != 0 {
+		t.Error("expected no tokens in an empty index")
+	}
+
+	// a token spanning lines 1 to 3 is found on each of them
+	node := &ast.IdentNode{}
+	index = newSemanticTokenIndex(nil, nil, []semanticItem{
+		{line: 0, start: 0, len: 6},
+		{lang: tokenLanguageProto, line: 1, start: 4, len: 1, endLine: 3, endCol: 2, node: node},
+		{line: 3, start: 4, len: 3},
+	})
+	for line, want := range []int{1, 1, 1, 2} {
+		if got := len(index.line(uint32(line))); got != want {
+			t.Errorf("line %d: got %d tokens, want %d", line, got, want)
+		}
+	}
+	for _, pos := range []protocol.Position{{Line: 1, Character: 10}, {Line: 2, Character: 0}, {Line: 3, Character: 2}} {
+		if item, ok := findNarrowestSemanticToken(nil, index.line(pos.Line), pos); !ok || item.node != node {
+			t.Errorf("%v: expected to find the multi-line token", pos)
+		}
+	}
+	if item, ok := findNarrowestSemanticToken(nil, index.line(3), protocol.Position{Line: 3, Character: 3}); ok && item.node == node {
+		t.Error("found the multi-line token past its end")
+	}
+}
+
+func TestMemo(t *testing.T) {
+	var m memo[int, string]
+	for i := range pathMemoSize {
+		m.put(i, fmt.Sprint(i))
+	}
+	if v, ok := m.get(0); !ok || v != "0" {
+		t.Fatalf("got %q, %v", v, ok)
+	}
+	m.put(pathMemoSize, "new")
+	if _, ok := m.get(0); ok {
+		t.Error("expected the oldest entry to be evicted")
+	}
+	if v, ok := m.get(pathMemoSize); !ok || v != "new" {
+		t.Errorf("got %q, %v", v, ok)
+	}
+	if _, ok := m.get(-1); ok {
+		t.Error("unexpected entry")
+	}
+}
+
+func TestPathMemo(t *testing.T) {
+	const a = "syntax = \"proto3\";\npackage a;\nmessage A {}\n"
+	c, workspace := newTestCache(t, map[string]string{"a.proto": a}, nil)
+	ctx := context.Background()
+	uri := protocol.URIFromPath(filepath.Join(workspace, "a.proto"))
+	c.DidModifyFiles(ctx, []file.Modification{{
+		URI:        uri,
+		Action:     file.Open,
+		Version:    1,
+		Text:       []byte(a),
+		LanguageID: "protobuf",
+	}})
+	search := func() {
+		t.Helper()
+		res, err := c.FindResultByPath("a.proto")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, _ := res.AST().ItemAtOffset(len("syntax = \"proto3\";\npackage a;\nmessage A"))
+		if _, found := c.findPathIntersectingToken(res, token, protocol.Position{Line: 2, Character: 9}); !found {
+			t.Fatal("expected to find a path")
+		}
+	}
+	memoized := func() bool {
+		_, ok := c.pathMemos.Load("a.proto")
+		return ok
+	}
+
+	search()
+	if !memoized() {
+		t.Fatal("expected the search to be memoized")
+	}
+	c.DidModifyFiles(ctx, []file.Modification{{
+		URI:     uri,
+		Action:  file.Change,
+		Version: 2,
+		Text:    []byte(a + "\n"),
+	}})
+	if memoized() {
+		t.Error("expected the memo to be cleared when the document changed")
+	}
+	search()
+	c.DidModifyFiles(ctx, []file.Modification{{URI: uri, Action: file.Close}})
+	if memoized() {
+		t.Error("expected the memo to be cleared when the document was closed")
+	}
+}
@@ -85,6 +85,10 @@ type semanticItem struct {
 	typ         tokenType
 	mods        tokenModifier
 
+	// for tokens spanning multiple lines, the 0-indexed line and column at
+	// which the token ends; zero otherwise
+	endLine, endCol uint32
+
 	// An AST node associated with this token. Used for hover, definitions, etc.
 	node ast.Node
 
@@ -115,7 +119,7 @@ func (s *semanticItems) AST() *ast.FileNode {
 	return s.parseRes.AST()
 }
 
-func (c *Cache) ComputeSemanticTokens(doc protocol.TextDocumentIdentifier) ([]uint32, error) {
+func (c *Cache) ComputeSemanticTokens(snapshot *Snapshot, doc protocol.TextDocumentIdentifier) ([]uint32, error) {
 	c.resultsMu.RLock()
 	defer c.resultsMu.RUnlock()
 	if ok, err := c.latestDocumentContentsWellFormedLocked(doc.URI, false); err != nil {
@@ -124,14 +128,14 @@ func (c *Cache) ComputeSemanticTokens(doc protocol.TextDocumentIdentifier) ([]ui
 		return nil, fmt.Errorf("document contents not well formed")
 	}
 
-	result, err := semanticTokensFull(c, doc)
+	result, err := semanticTokensFull(c, snapshot, doc)
 	if err != nil {
 		return nil, err
 	}
 	return result.Data, nil
 }
 
-func (c *Cache) ComputeSemanticTokensRange(doc protocol.TextDocumentIdentifier, rng protocol.Range) ([]uint32, error) {
+func (c *Cache) ComputeSemanticTokensRange(snapshot *Snapshot, doc protocol.TextDocumentIdentifier, rng protocol.Range) ([]uint32, error) {
 	c.resultsMu.RLock()
 	defer c.resultsMu.RUnlock()
 	if ok, err := c.latestDocumentContentsWellFormedLocked(doc.URI, false); err != nil {
@@ -140,19 +144,19 @@ func (c *Cache) ComputeSemanticTokensRange(doc protocol.TextDocumentIdentifier,
 		return nil, fmt.Errorf("document contents not well formed")
 	}
 
-	result, err := semanticTokensRange(c, doc, rng)
+	result, err := semanticTokensRange(c, snapshot, doc, rng)
 	if err != nil {
 		return nil, err
 	}
 	return result.Data, nil
 }
 
-func semanticTokensFull(cache *Cache, doc protocol.TextDocumentIdentifier) (*protocol.SemanticTokens, error) {
-	parseRes, err := cache.FindParseResultByURI(doc.URI)
+func semanticTokensFull(cache *Cache, snapshot *Snapshot, doc protocol.TextDocumentIdentifier) (*protocol.SemanticTokens, error) {
+	parseRes, err := snapshot.FindParseResultByURI(doc.URI)
 	if err != nil {
 		return nil, err
 	}
-	maybeLinkRes, _ := cache.FindResultOrPartialResultByURI(doc.URI)
+	maybeLinkRes, _ := snapshot.FindResultOrPartialResultByURI(doc.URI)
 
 	enc := semanticItems{
 		parseRes:     parseRes,
@@ -165,12 +169,12 @@ func semanticTokensFull(cache *Cache, doc protocol.TextDocumentIdentifier) (*pro
 	return ret, err
 }
 
-func semanticTokensRange(cache *Cache, doc protocol.TextDocumentIdentifier, rng protocol.Range) (*protocol.SemanticTokens, error) {
-	parseRes, err := cache.FindParseResultByURI(doc.URI)
+func semanticTokensRange(cache *Cache, snapshot *Snapshot, doc protocol.TextDocumentIdentifier, rng protocol.Range) (*protocol.SemanticTokens, error) {
+	parseRes, err := snapshot.FindParseResultByURI(doc.URI)
 	if err != nil {
 		return nil, err
 	}
-	maybeLinkRes, _ := cache.FindResultOrPartialResultByURI(doc.URI)
+	maybeLinkRes, _ := snapshot.FindResultOrPartialResultByURI(doc.URI)
 
 	mapper, err := cache.GetMapper(doc.URI)
 	if err != nil {
@@ -307,6 +311,10 @@ func (s *semanticItems) mktokens(node ast.Node, path protopath.Path, tt tokenTyp
 		node:  node,
 		path:  path,
 	}
+	if end := info.End(); end.Line != info.Start().Line {
+		nodeTk.endLine = uint32(end.Line - 1)
+		nodeTk.endCol = uint32(end.Col - 1)
+	}
 	s.items = append(s.items, nodeTk)
 
 	s.mkcomments(node)
@@ -1,6 +1,7 @@
 package lsp
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
@@ -10,8 +11,9 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 
-	"github.com/kralicky/protols/pkg/sources"
+	"github.com/kralicky/protols/pkg/protocolext"
 	"github.com/kralicky/tools-lite/gopls/pkg/file"
 	"github.com/kralicky/tools-lite/gopls/pkg/progress"
 	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
@@ -28,16 +30,29 @@ type Server struct {
 
 	client             protocol.ClientCloser
 	clientCapabilities protocol.ClientCapabilities
+	semanticLegend     semanticTokenLegend
+	remote             bool
 
 	trackerMu    sync.Mutex
 	tracker      *progress.Tracker
 	shutdownOnce sync.Once
+
+	shutdownRequested atomic.Bool
+	exited            atomic.Bool
 }
 
 type ServerOptions struct {
 	unknownCommandHandlers map[string]UnknownCommandHandler
+	notify                 NotifyFunc
+	schemeHandlers         map[string]SchemeHandler
+	call                   CallFunc
+	sandbox                bool
 }
 
+// NotifyFunc sends a notification to the client. It is used to send
+// notifications which are not part of the LSP spec.
+type NotifyFunc func(ctx context.Context, method string, params any) error
+
 type ServerOption func(*ServerOptions)
 
 func (o *ServerOptions) apply(opts ...ServerOption) {
@@ -57,6 +72,24 @@ func WithUnknownCommandHandler(handler UnknownCommandHandler, cmds ...string) Se
 	}
 }
 
+// WithSandbox prevents the server from running any subprocesses, such as the
+// go or git commands. Sandbox mode can also be enabled by the client using
+// initialization options.
+func WithSandbox() ServerOption {
+	return func(o *ServerOptions) {
+		o.sandbox = true
+	}
+}
+
+// WithNotifyFunc sets the function used to send custom notifications, such as
+// protols/readOnlyFile, to the client. If unset, these notifications are not
+// sent.
+func WithNotifyFunc(notify NotifyFunc) ServerOption {
+	return func(o *ServerOptions) {
+		o.notify = notify
+	}
+}
+
 func NewServer(client protocol.ClientCloser, opts ...ServerOption) *Server {
 	var options ServerOptions
 	options.apply(opts...)
@@ -68,13 +101,38 @@ func NewServer(client protocol.ClientCloser, opts ...ServerOption) *Server {
 		"pid", os.Getpid(),
 	).Info("starting server")
 
-	return &Server{
+	s := &Server{
 		ServerOptions: options,
 		caches:        map[string]*Cache{},
 		cacheCancels:  map[string]context.CancelCauseFunc{},
 		client:        client,
 		tracker:       progress.NewTracker(client),
 	}
+	liveServers.Store(s, true)
+	return s
+}
+
+// cacheOptions returns the options used to create caches for workspace
+// folders. In remote mode, file:// URIs are read using the client.
+func (s *Server) cacheOptions() []CacheOption {
+	opts := []CacheOption{WithSyntheticFilesChangedFunc(s.refreshTextDocumentContent)}
+	if s.sandbox {
+		opts = append(opts, WithSandboxedCache())
+	}
+	if caps := s.clientCapabilities.Workspace.WorkspaceEdit; caps != nil && caps.DocumentChanges &&
+		slices.Contains(caps.ResourceOperations, protocol.Rename) {
+		opts = append(opts, WithFileRenames())
+	}
+	if !s.remote {
+		return append(opts, WithSchemeHandlers(s.schemeHandlers))
+	}
+	handlers := map[string]SchemeHandler{
+		"file": &clientFileReader{call: s.call},
+	}
+	for scheme, h := range s.schemeHandlers {
+		handlers[scheme] = h
+	}
+	return append(opts, WithSchemeHandlers(handlers))
 }
 
 // requires s.cachesMu held for writing
@@ -108,11 +166,12 @@ func (s *Server) cacheInitLocked(cache *Cache, path string) {
 
 // requires s.cachesMu held for writing
 func (s *Server) cacheDestroyLocked(path string, err error) {
-	if _, ok := s.caches[path]; ok {
+	if cache, ok := s.caches[path]; ok {
 		delete(s.caches, path)
 		ca := s.cacheCancels[path]
 		delete(s.cacheCancels, path)
 		ca(err)
+		cache.Close(err)
 	}
 }
 
@@ -120,12 +179,33 @@ func (s *Server) cacheDestroyLocked(path string, err error) {
 func (s *Server) Initialize(ctx context.Context, params *protocol.ParamInitialize) (result *protocol.InitializeResult, err error) {
 	folders := params.WorkspaceFolders
 	s.clientCapabilities = params.Capabilities
+	s.semanticLegend = newSemanticTokenLegend(params.Capabilities.TextDocument.SemanticTokens)
 	s.tracker.SetSupportsWorkDoneProgress(params.Capabilities.Window.WorkDoneProgress)
+	var initOptions InitializationOptions
+	if params.InitializationOptions != nil {
+		if err := decodeSettings(params.InitializationOptions, &initOptions); err != nil {
+			slog.Error("failed to decode initialization options", "error", err)
+		}
+	}
+	if initOptions.Sandbox {
+		s.sandbox = true
+	}
+	if s.sandbox {
+		slog.Info("sandbox mode enabled, external commands will not be run")
+	}
+	if initOptions.Remote {
+		if s.call == nil {
+			slog.Warn("remote mode is not supported by this connection, reading files from disk")
+		} else {
+			slog.Info("remote mode enabled, reading workspace files from the client")
+			s.remote = true
+		}
+	}
 	s.cachesMu.Lock()
 	for _, folder := range folders {
-		path := protocol.DocumentURI(folder.URI).Path()
+		path := uriPath(protocol.DocumentURI(folder.URI))
 		slog.Info("adding workspace folder", "path", path)
-		cache := NewCache(folder)
+		cache := NewCache(folder, s.cacheOptions()...)
 		s.cacheInitLocked(cache, path)
 	}
 	s.cachesMu.Unlock()
@@ -142,12 +222,12 @@ func (s *Server) Initialize(ctx context.Context, params *protocol.ParamInitializ
 		Type:    protocol.Info,
 		Message: fmt.Sprintf("initialized workspace folders: %v", folders),
 	})
-	return &protocol.InitializeResult{
+	result = &protocol.InitializeResult{
 		Capabilities: protocol.ServerCapabilities{
 			TextDocumentSync: protocol.TextDocumentSyncOptions{
 				OpenClose: true,
-				Change:    protocol.Incremental,
-				Save:      &protocol.SaveOptions{IncludeText: false},
+				Change:    initOptions.GetTextDocumentSync(),
+				Save:      &protocol.SaveOptions{IncludeText: true},
 			},
 			HoverProvider: &protocol.Or_ServerCapabilities_hoverProvider{Value: true},
 			Workspace: &protocol.WorkspaceOptions{
@@ -167,8 +247,11 @@ func (s *Server) Initialize(ctx context.Context, params *protocol.ParamInitializ
 					},
 				},
 			},
-			InlayHintProvider:    true,
-			DocumentLinkProvider: &protocol.DocumentLinkOptions{},
+			InlayHintProvider:         true,
+			DocumentLinkProvider:      &protocol.DocumentLinkOptions{},
+			DocumentHighlightProvider: &protocol.Or_ServerCapabilities_documentHighlightProvider{Value: true},
+			ColorProvider:             &protocol.Or_ServerCapabilities_colorProvider{Value: true},
+			MonikerProvider:           &protocol.Or_ServerCapabilities_monikerProvider{Value: true},
 			DocumentFormattingProvider: &protocol.Or_ServerCapabilities_documentFormattingProvider{
 				Value: protocol.DocumentFormattingOptions{},
 			},
@@ -184,6 +267,7 @@ func (s *Server) Initialize(ctx context.Context, params *protocol.ParamInitializ
 					protocol.RefactorRewrite,
 					protocol.RefactorInline,
 					protocol.RefactorExtract,
+					SourceSortMembers,
 				},
 			},
 			RenameProvider: &protocol.RenameOptions{
@@ -195,22 +279,23 @@ func (s *Server) Initialize(ctx context.Context, params *protocol.ParamInitializ
 			ReferencesProvider:      &protocol.Or_ServerCapabilities_referencesProvider{Value: true},
 			WorkspaceSymbolProvider: &protocol.Or_ServerCapabilities_workspaceSymbolProvider{Value: true},
 			DefinitionProvider:      &protocol.Or_ServerCapabilities_definitionProvider{Value: true},
-			SemanticTokensProvider: &protocol.SemanticTokensOptions{
-				Legend: protocol.SemanticTokensLegend{
-					TokenTypes:     semanticTokenTypes,
-					TokenModifiers: semanticTokenModifiers,
-				},
-				Full:  &protocol.Or_SemanticTokensOptions_full{Value: true},
-				Range: &protocol.Or_SemanticTokensOptions_range{Value: true},
+			TypeDefinitionProvider:  &protocol.Or_ServerCapabilities_typeDefinitionProvider{Value: true},
+			DocumentSymbolProvider:  &protocol.Or_ServerCapabilities_documentSymbolProvider{Value: true},
+			Experimental: map[string]any{
+				protocolext.ExperimentalCapability: protocolext.Version,
 			},
-			DocumentSymbolProvider: &protocol.Or_ServerCapabilities_documentSymbolProvider{Value: true},
 		},
 
 		ServerInfo: &protocol.ServerInfo{
 			Name:    "protols",
 			Version: "0.0.1",
 		},
-	}, nil
+	}
+	// semantic tokens are only provided for the requests the client supports
+	if opts := semanticTokensOptions(params.Capabilities.TextDocument.SemanticTokens, s.semanticLegend); opts != nil {
+		result.Capabilities.SemanticTokensProvider = opts
+	}
+	return result, nil
 }
 
 func (s *Server) CacheForURI(uri protocol.DocumentURI) (*Cache, error) {
@@ -271,13 +356,32 @@ func (s *Server) CacheForWorkspace(workspace protocol.WorkspaceFolder) (*Cache,
 	return nil, fmt.Errorf("%w: workspace %s does not exist", jsonrpc2.ErrMethodNotFound, workspace.Name)
 }
 
+// snapshotForURI returns the cache for the given URI along with its latest
+// snapshot. Requests read from the snapshot throughout, so that they observe
+// the results of a single compilation even if files change while they run.
+func (s *Server) snapshotForURI(method string, uri protocol.DocumentURI) (*Cache, *Snapshot, error) {
+	c, err := s.CacheForURI(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot := c.Snapshot()
+	slog.Debug("handling request", "method", method, "uri", uri, "snapshot", snapshot.ID())
+	return c, snapshot, nil
+}
+
 // Completion implements protocol.Server.
 func (s *Server) Completion(ctx context.Context, params *protocol.CompletionParams) (result *protocol.CompletionList, err error) {
-	c, err := s.CacheForURI(params.TextDocument.URI)
+	c, snapshot, err := s.snapshotForURI("textDocument/completion", params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
-	return c.GetCompletions(params)
+	result, err = c.GetCompletions(ctx, snapshot, params)
+	if err != nil {
+		return nil, err
+	}
+	s.adaptCompletionDocs(result)
+	s.adaptCompletionSnippets(result)
+	return result, nil
 }
 
 // Initialized implements protocol.Server.
@@ -294,52 +398,91 @@ func (s *Server) Initialized(ctx context.Context, params *protocol.InitializedPa
 		return err
 	}
 
+	// Fetch the configuration before loading files, since it can affect which
+	// files are loaded and how their imports are resolved
+	if s.clientCapabilities.Workspace.Configuration {
+		if err := s.DidChangeConfiguration(ctx, &protocol.DidChangeConfigurationParams{}); err != nil {
+			slog.Error("failed to fetch configuration", "error", err)
+		}
+	}
+
+	s.cachesMu.RLock()
+	caches := slices.Collect(maps.Values(s.caches))
+	s.cachesMu.RUnlock()
+	s.showGoToolchainWarnings(ctx, caches)
+
 	// Load files immediately after LSP initialization
 	s.loadWorkspaceFiles()
 
 	return nil
 }
 
+// showGoToolchainWarnings shows a warning for each workspace which is within a
+// Go module, but for which the go command could not be run.
+func (s *Server) showGoToolchainWarnings(ctx context.Context, caches []*Cache) {
+	for _, c := range caches {
+		if msg := c.GoToolchainWarning(); msg != "" {
+			if err := s.client.ShowMessage(ctx, &protocol.ShowMessageParams{
+				Type:    protocol.Warning,
+				Message: msg,
+			}); err != nil {
+				slog.Error("failed to show message", "error", err)
+			}
+		}
+	}
+}
+
 func (s *Server) loadWorkspaceFiles() {
 	s.cachesMu.RLock()
 	defer s.cachesMu.RUnlock()
 
-	for path, cache := range s.caches {
-		cache.LoadFiles(sources.SearchDirs(path))
+	for _, cache := range s.caches {
+		cache.loadWorkspaceFiles()
 	}
 }
 
 // Definition implements protocol.Server.
 func (s *Server) Definition(ctx context.Context, params *protocol.DefinitionParams) (result []protocol.Location, err error) {
-	c, err := s.CacheForURI(params.TextDocument.URI)
+	c, snapshot, err := s.snapshotForURI("textDocument/definition", params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
 
-	desc, _, err := c.FindTypeDescriptorAtLocation(params.TextDocumentPositionParams)
-	if err != nil {
-		return nil, err
-	} else if desc == nil {
-		if locations := c.TryFindPackageReferences(params.TextDocumentPositionParams); locations != nil {
-			return locations, nil
-		}
-		return nil, nil
-	}
-	loc, err := c.FindDefinitionForTypeDescriptor(desc)
+	return c.FindDefinitions(ctx, snapshot, params.TextDocumentPositionParams)
+}
+
+// DefinitionLinks is like Definition, but returns location links, which
+// include the range of the symbol the definitions were found for and the
+// full range of each declaration.
+func (s *Server) DefinitionLinks(ctx context.Context, params *protocol.DefinitionParams) ([]protocol.LocationLink, error) {
+	c, snapshot, err := s.snapshotForURI("textDocument/definition", params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
-	return []protocol.Location{loc}, nil
+
+	return c.FindDefinitionLinks(ctx, snapshot, params.TextDocumentPositionParams)
+}
+
+// ClientSupportsDefinitionLinks reports whether the client accepts location
+// links in response to definition requests.
+func (s *Server) ClientSupportsDefinitionLinks() bool {
+	return s.clientCapabilities.TextDocument.Definition != nil &&
+		s.clientCapabilities.TextDocument.Definition.LinkSupport
 }
 
 // Hover implements protocol.Server.
 func (s *Server) Hover(ctx context.Context, params *protocol.HoverParams) (result *protocol.Hover, err error) {
-	c, err := s.CacheForURI(params.TextDocument.URI)
+	c, snapshot, err := s.snapshotForURI("textDocument/hover", params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.ComputeHover(params.TextDocumentPositionParams)
+	result, err = c.ComputeHover(ctx, snapshot, params.TextDocumentPositionParams)
+	if err != nil {
+		return nil, err
+	}
+	s.adaptHover(result)
+	return result, nil
 }
 
 // DidOpen implements protocol.Server.
@@ -350,7 +493,7 @@ func (s *Server) DidOpen(ctx context.Context, params *protocol.DidOpenTextDocume
 	}
 
 	uri := params.TextDocument.URI
-	if !uri.IsFile() {
+	if !uri.IsFile() && !c.resolver.HasSchemeHandler(uri) {
 		return nil
 	}
 	c.DidModifyFiles(ctx, []file.Modification{
@@ -362,6 +505,14 @@ func (s *Server) DidOpen(ctx context.Context, params *protocol.DidOpenTextDocume
 			LanguageID: params.TextDocument.LanguageID,
 		},
 	})
+	if reason := c.readOnlyReason(uri); reason != "" && s.notify != nil {
+		if err := s.notify(ctx, protocolext.ReadOnlyFileNotification, protocolext.ReadOnlyFileParams{
+			URI:    uri,
+			Reason: reason,
+		}); err != nil {
+			slog.Warn("failed to send read-only file notification", "uri", uri, "error", err)
+		}
+	}
 	return nil
 }
 
@@ -373,7 +524,7 @@ func (s *Server) DidClose(ctx context.Context, params *protocol.DidCloseTextDocu
 	}
 
 	uri := params.TextDocument.URI
-	if !uri.IsFile() {
+	if !uri.IsFile() && !c.resolver.HasSchemeHandler(uri) {
 		return nil
 	}
 	c.DidModifyFiles(ctx, []file.Modification{
@@ -395,7 +546,7 @@ func (s *Server) DidChange(ctx context.Context, params *protocol.DidChangeTextDo
 	}
 
 	uri := params.TextDocument.URI
-	if !uri.IsFile() {
+	if !uri.IsFile() && !c.resolver.HasSchemeHandler(uri) {
 		return nil
 	}
 	text, err := c.ChangedText(ctx, params.TextDocument, params.ContentChanges)
@@ -423,6 +574,9 @@ func (s *Server) DidChangeWatchedFiles(ctx context.Context, params *protocol.Did
 		if err != nil {
 			continue
 		}
+		if change.Type == protocol.Created && cache.isExcluded(uri) {
+			continue
+		}
 		modsByCache[cache] = append(modsByCache[cache], file.Modification{
 			URI:     uri,
 			Action:  changeTypeToFileAction(change.Type),
@@ -536,23 +690,37 @@ func (s *Server) DidSave(ctx context.Context, params *protocol.DidSaveTextDocume
 		URI:    params.TextDocument.URI,
 		Action: file.Save,
 	}
+	var mods []file.Modification
 	if params.Text != nil {
 		mod.Text = []byte(*params.Text)
+		// the saved contents should match the document; if they don't, such as
+		// after a change was missed, apply them as a change before saving
+		if fh, err := c.compiler.fs.ReadFile(ctx, mod.URI); err == nil {
+			if content, err := fh.Content(); err == nil && !bytes.Equal(content, mod.Text) {
+				mods = append(mods, file.Modification{
+					URI:     mod.URI,
+					Action:  file.Change,
+					Version: fh.Version(),
+					Text:    mod.Text,
+				})
+			}
+		}
 	}
-	c.DidModifyFiles(ctx, []file.Modification{mod})
+	c.DidModifyFiles(ctx, append(mods, mod))
 	return nil
 }
 
 // SemanticTokensFull implements protocol.Server.
 func (s *Server) SemanticTokensFull(ctx context.Context, params *protocol.SemanticTokensParams) (result *protocol.SemanticTokens, err error) {
-	c, err := s.CacheForURI(params.TextDocument.URI)
+	c, snapshot, err := s.snapshotForURI("textDocument/semanticTokens/full", params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
-	tokens, err := c.ComputeSemanticTokens(params.TextDocument)
+	tokens, err := c.ComputeSemanticTokens(snapshot, params.TextDocument)
 	if err != nil {
 		return nil, err
 	}
+	s.semanticLegend.remapModifiers(tokens)
 	return &protocol.SemanticTokens{
 		Data: tokens,
 	}, nil
@@ -565,14 +733,15 @@ func (s *Server) SemanticTokensFullDelta(ctx context.Context, params *protocol.S
 
 // SemanticTokensRange implements protocol.Server.
 func (s *Server) SemanticTokensRange(ctx context.Context, params *protocol.SemanticTokensRangeParams) (result *protocol.SemanticTokens, err error) {
-	c, err := s.CacheForURI(params.TextDocument.URI)
+	c, snapshot, err := s.snapshotForURI("textDocument/semanticTokens/range", params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
-	tokens, err := c.ComputeSemanticTokensRange(params.TextDocument, params.Range)
+	tokens, err := c.ComputeSemanticTokensRange(snapshot, params.TextDocument, params.Range)
 	if err != nil {
 		return nil, err
 	}
+	s.semanticLegend.remapModifiers(tokens)
 	return &protocol.SemanticTokens{
 		Data: tokens,
 	}, nil
@@ -585,14 +754,20 @@ func (s *Server) SemanticTokensRefresh(ctx context.Context) (err error) {
 
 // DocumentSymbol implements protocol.Server.
 func (s *Server) DocumentSymbol(ctx context.Context, params *protocol.DocumentSymbolParams) (result []interface{}, err error) {
-	c, err := s.CacheForURI(params.TextDocument.URI)
+	c, snapshot, err := s.snapshotForURI("textDocument/documentSymbol", params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
-	symbols, err := c.DocumentSymbolsForFile(params.TextDocument.URI)
+	symbols, err := c.DocumentSymbolsForFile(snapshot, params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
+	if !s.clientCapabilities.TextDocument.DocumentSymbol.HierarchicalDocumentSymbolSupport {
+		for _, symbol := range flattenDocumentSymbols(params.TextDocument.URI, symbols, "") {
+			result = append(result, symbol)
+		}
+		return result, nil
+	}
 	for _, symbol := range symbols {
 		result = append(result, symbol)
 	}
@@ -732,22 +907,30 @@ func (s *Server) DiagnosticWorkspace(ctx context.Context, params *protocol.Works
 }
 
 // DocumentColor implements protocol.Server.
-func (*Server) DocumentColor(context.Context, *protocol.DocumentColorParams) ([]protocol.ColorInformation, error) {
-	return nil, nil
+func (s *Server) DocumentColor(ctx context.Context, params *protocol.DocumentColorParams) ([]protocol.ColorInformation, error) {
+	c, snapshot, err := s.snapshotForURI("textDocument/documentColor", params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return c.ComputeDocumentColors(snapshot, params.TextDocument)
 }
 
 // DocumentHighlight implements protocol.Server.
-func (*Server) DocumentHighlight(context.Context, *protocol.DocumentHighlightParams) ([]protocol.DocumentHighlight, error) {
-	return nil, nil
+func (s *Server) DocumentHighlight(ctx context.Context, params *protocol.DocumentHighlightParams) ([]protocol.DocumentHighlight, error) {
+	c, snapshot, err := s.snapshotForURI("textDocument/documentHighlight", params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return c.ComputeDocumentHighlights(snapshot, *params)
 }
 
 // DocumentLink implements protocol.Server.
 func (s *Server) DocumentLink(ctx context.Context, params *protocol.DocumentLinkParams) ([]protocol.DocumentLink, error) {
-	c, err := s.CacheForURI(params.TextDocument.URI)
+	c, snapshot, err := s.snapshotForURI("textDocument/documentLink", params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
-	return c.ComputeDocumentLinks(params.TextDocument)
+	return c.ComputeDocumentLinks(snapshot, params.TextDocument)
 }
 
 // Formatting implements protocol.Server.
@@ -761,24 +944,25 @@ func (s *Server) Formatting(ctx context.Context, params *protocol.DocumentFormat
 
 // InlayHint implements protocol.Server.
 func (s *Server) InlayHint(ctx context.Context, params *protocol.InlayHintParams) ([]protocol.InlayHint, error) {
-	c, err := s.CacheForURI(params.TextDocument.URI)
+	c, snapshot, err := s.snapshotForURI("textDocument/inlayHint", params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
-	return c.ComputeInlayHints(params.TextDocument, params.Range)
+	return c.ComputeInlayHints(snapshot, params.TextDocument, params.Range)
 }
 
 // References implements protocol.Server.
 func (s *Server) References(ctx context.Context, params *protocol.ReferenceParams) ([]protocol.Location, error) {
-	c, err := s.CacheForURI(params.TextDocument.URI)
+	c, snapshot, err := s.snapshotForURI("textDocument/references", params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
-	return c.FindReferences(ctx, params.TextDocumentPositionParams, params.Context)
+	return c.FindReferences(ctx, snapshot, params.TextDocumentPositionParams, params.Context)
 }
 
 // Shutdown implements protocol.Server.
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownRequested.Store(true)
 	s.shutdownOnce.Do(func() { s.shutdown(ctx) })
 	return nil
 }
@@ -786,11 +970,28 @@ func (s *Server) Shutdown(ctx context.Context) error {
 // Exit implements protocol.Server.
 func (s *Server) Exit(ctx context.Context) error {
 	s.shutdownOnce.Do(func() { s.shutdown(ctx) })
-	return nil
+	s.exited.Store(true)
+	return s.client.Close()
+}
+
+// ShutdownRequested reports whether the client has sent a shutdown request.
+// Once it has, the only message the server should handle is exit.
+func (s *Server) ShutdownRequested() bool {
+	return s.shutdownRequested.Load()
+}
+
+// Exited reports whether the server has received an exit notification, and
+// whether it was preceded by a shutdown request. Per the spec, the server
+// process should exit with a non-zero status if it was not.
+func (s *Server) Exited() (exited, clean bool) {
+	return s.exited.Load(), s.shutdownRequested.Load()
 }
 
 func (s *Server) shutdown(_ context.Context) {
 	slog.Info("server is shutting down")
+	liveServers.Delete(s)
+	s.cachesMu.Lock()
+	defer s.cachesMu.Unlock()
 	for path := range s.caches {
 		s.cacheDestroyLocked(path, fmt.Errorf("server is shutting down"))
 	}
@@ -802,18 +1003,21 @@ func (s *Server) DidChangeWorkspaceFolders(ctx context.Context, params *protocol
 	added := params.Event.Added
 	removed := params.Event.Removed
 	s.cachesMu.Lock()
+	var caches []*Cache
 	for _, folder := range added {
-		path := protocol.DocumentURI(folder.URI).Path()
+		path := uriPath(protocol.DocumentURI(folder.URI))
 		slog.Info("adding workspace folder", "path", path)
-		c := NewCache(folder)
+		c := NewCache(folder, s.cacheOptions()...)
 		s.cacheInitLocked(c, path)
+		caches = append(caches, c)
 	}
 	for _, folder := range removed {
-		path := protocol.DocumentURI(folder.URI).Path()
+		path := uriPath(protocol.DocumentURI(folder.URI))
 		slog.Info("removing workspace folder", "path", path)
 		s.cacheDestroyLocked(path, fmt.Errorf("workspace folder removed: %s", path))
 	}
 	s.cachesMu.Unlock()
+	s.showGoToolchainWarnings(ctx, caches)
 	return nil
 }
 
@@ -823,7 +1027,16 @@ func (s *Server) CodeAction(ctx context.Context, params *protocol.CodeActionPara
 	if err != nil {
 		return nil, err
 	}
-	return c.GetCodeActions(ctx, params)
+	actions, err := c.GetCodeActions(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	for i := range actions {
+		if err := s.adaptWorkspaceEdit(actions[i].Edit); err != nil {
+			return nil, err
+		}
+	}
+	return actions, nil
 }
 
 func changesToDocumentChanges(changes map[protocol.DocumentURI][]protocol.TextEdit) []protocol.DocumentChanges {
@@ -852,7 +1065,7 @@ func (s *Server) PrepareRename(ctx context.Context, params *protocol.PrepareRena
 	if err != nil {
 		return nil, err
 	}
-	return c.PrepareRename(params.TextDocumentPositionParams)
+	return c.PrepareRename(ctx, params.TextDocumentPositionParams)
 }
 
 // Rename implements protocol.Server.
@@ -861,22 +1074,34 @@ func (s *Server) Rename(ctx context.Context, params *protocol.RenameParams) (*pr
 	if err != nil {
 		return nil, err
 	}
-	return c.Rename(params)
+	edit, err := c.Rename(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.adaptWorkspaceEdit(edit); err != nil {
+		return nil, err
+	}
+	return edit, nil
 }
 
 // CodeLens implements protocol.Server.
 func (s *Server) CodeLens(ctx context.Context, params *protocol.CodeLensParams) (result []protocol.CodeLens, err error) {
-	c, err := s.CacheForURI(params.TextDocument.URI)
+	c, snapshot, err := s.snapshotForURI("textDocument/codeLens", params.TextDocument.URI)
 	if err != nil {
 		return nil, err
 	}
-	return c.ComputeCodeLens(params.TextDocument.URI)
+	return c.ComputeCodeLens(snapshot, params.TextDocument.URI)
 }
 
 // Symbol implements protocol.Server.
 func (s *Server) Symbol(ctx context.Context, params *protocol.WorkspaceSymbolParams) ([]protocol.SymbolInformation, error) {
+	s.cachesMu.RLock()
+	caches := slices.SortedFunc(maps.Values(s.caches), func(a, b *Cache) int {
+		return strings.Compare(a.workspace.URI, b.workspace.URI)
+	})
+	s.cachesMu.RUnlock()
 	var symbolInfos []protocol.SymbolInformation
-	for _, c := range s.caches {
+	for _, c := range caches {
 		symbolInfos = append(symbolInfos, c.QueryWorkspaceSymbols(ctx, params.Query)...)
 	}
 	return symbolInfos, nil
@@ -889,11 +1114,26 @@ func (s *Server) ResolveCodeAction(ctx context.Context, codeAction *protocol.Cod
 		return nil, err
 	}
 	if s.clientSupportsResolveEdits() {
-		if codeAction.Edit != nil {
-			codeAction.Edit.DocumentChanges = protocol.TextEditsToDocumentChanges(uri, version, codeAction.Edit.Changes[uri])
-			codeAction.Edit.Changes = nil
+		if codeAction.Edit != nil && len(codeAction.Edit.Changes) > 0 {
+			c, err := s.CacheForURI(uri)
+			if err != nil {
+				return nil, err
+			}
+			// the edits were computed from the version of the document the
+			// action was offered for
+			if err := c.checkDocumentVersion(ctx, uri, version); err != nil {
+				return nil, err
+			}
+			edit, err := c.versionedWorkspaceEdit(ctx, codeAction.Edit.Changes)
+			if err != nil {
+				return nil, err
+			}
+			codeAction.Edit = edit
 		}
 	}
+	if err := s.adaptWorkspaceEdit(codeAction.Edit); err != nil {
+		return nil, err
+	}
 	return codeAction, nil
 }
 
@@ -920,14 +1160,7 @@ func (s *Server) DidChangeConfiguration(ctx context.Context, params *protocol.Di
 			continue
 		}
 		var settings Settings
-		decoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
-			ErrorUnused:      false,
-			ErrorUnset:       false,
-			ZeroFields:       false,
-			WeaklyTypedInput: true,
-			Result:           &settings,
-		})
-		if err := decoder.Decode(resp[0]); err != nil {
+		if err := decodeSettings(resp[0], &settings); err != nil {
 			slog.Error("failed to decode configuration", "workspace", c.workspace.Name, "error", err)
 			continue
 		}
@@ -936,6 +1169,20 @@ func (s *Server) DidChangeConfiguration(ctx context.Context, params *protocol.Di
 	return nil
 }
 
+func decodeSettings(input any, result any) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ErrorUnused:      false,
+		ErrorUnset:       false,
+		ZeroFields:       false,
+		WeaklyTypedInput: true,
+		Result:           result,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(input)
+}
+
 // =====================
 // Unimplemented Methods
 // =====================
@@ -965,8 +1212,28 @@ func (*Server) Supertypes(context.Context, *protocol.TypeHierarchySupertypesPara
 }
 
 // TypeDefinition implements protocol.Server.
-func (*Server) TypeDefinition(context.Context, *protocol.TypeDefinitionParams) ([]protocol.Location, error) {
-	return nil, notImplemented("TypeDefinition")
+func (s *Server) TypeDefinition(ctx context.Context, params *protocol.TypeDefinitionParams) ([]protocol.Location, error) {
+	c, snapshot, err := s.snapshotForURI("textDocument/typeDefinition", params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return c.FindTypeDefinitionsAtLocation(ctx, snapshot, params.TextDocumentPositionParams)
+}
+
+// TypeDefinitionLinks is like TypeDefinition, but returns location links.
+func (s *Server) TypeDefinitionLinks(ctx context.Context, params *protocol.TypeDefinitionParams) ([]protocol.LocationLink, error) {
+	c, snapshot, err := s.snapshotForURI("textDocument/typeDefinition", params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return c.FindTypeDefinitionLinks(ctx, snapshot, params.TextDocumentPositionParams)
+}
+
+// ClientSupportsTypeDefinitionLinks reports whether the client accepts
+// location links in response to type definition requests.
+func (s *Server) ClientSupportsTypeDefinitionLinks() bool {
+	return s.clientCapabilities.TextDocument.TypeDefinition != nil &&
+		s.clientCapabilities.TextDocument.TypeDefinition.LinkSupport
 }
 
 // WillCreateFiles implements protocol.Server.
@@ -1011,7 +1278,7 @@ func (s *Server) CodeLensResolve(ctx context.Context, params *protocol.CodeLens)
 
 // ColorPresentation implements protocol.Server.
 func (s *Server) ColorPresentation(ctx context.Context, params *protocol.ColorPresentationParams) (result []protocol.ColorPresentation, err error) {
-	return nil, notImplemented("ColorPresentation")
+	return ComputeColorPresentations(*params), nil
 }
 
 // CompletionResolve implements protocol.Server.
@@ -1105,8 +1372,12 @@ func (*Server) LinkedEditingRange(context.Context, *protocol.LinkedEditingRangeP
 }
 
 // Moniker implements protocol.Server.
-func (*Server) Moniker(context.Context, *protocol.MonikerParams) ([]protocol.Moniker, error) {
-	return nil, notImplemented("Moniker")
+func (s *Server) Moniker(ctx context.Context, params *protocol.MonikerParams) ([]protocol.Moniker, error) {
+	c, snapshot, err := s.snapshotForURI("textDocument/moniker", params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return c.ComputeMonikers(ctx, snapshot, params.TextDocumentPositionParams)
 }
 
 // Implementation implements protocol.Server.
@@ -0,0 +1,115 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protols/pkg/protocolext"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type (
+	Service = protocolext.Service
+	Method  = protocolext.Method
+)
+
+// FindServices returns all services declared in workspace-local files, sorted
+// by name, along with their methods in declaration order.
+func (c *Cache) FindServices(ctx context.Context, snapshot *Snapshot) ([]Service, error) {
+	var services []Service
+	for _, sd := range c.workspaceServices(snapshot) {
+		svc, err := c.describeService(snapshot, sd)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, svc)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(services, func(a, b Service) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return services, nil
+}
+
+func (c *Cache) workspaceServices(snapshot *Snapshot) []protoreflect.ServiceDescriptor {
+	var services []protoreflect.ServiceDescriptor
+	for _, res := range snapshot.Results() {
+		if res.IsPlaceholder() {
+			continue
+		}
+		uri, err := c.resolver.PathToURI(res.Path())
+		if err != nil || !c.resolver.IsRealWorkspaceLocalFile(uri) {
+			continue
+		}
+		sds := res.Services()
+		for i := range sds.Len() {
+			services = append(services, sds.Get(i))
+		}
+	}
+	return services
+}
+
+func (c *Cache) describeService(snapshot *Snapshot, sd protoreflect.ServiceDescriptor) (Service, error) {
+	loc, err := c.FindDefinitionForTypeDescriptor(snapshot, sd)
+	if err != nil {
+		return Service{}, err
+	}
+	opts, _ := sd.Options().(*descriptorpb.ServiceOptions)
+	svc := Service{
+		Name:        string(sd.FullName()),
+		Path:        sd.ParentFile().Path(),
+		Location:    loc,
+		Deprecated:  opts.GetDeprecated(),
+		Annotations: optionsJSON(opts),
+		Methods:     []Method{},
+	}
+	methods := sd.Methods()
+	for i := range methods.Len() {
+		md := methods.Get(i)
+		loc, err := c.FindDefinitionForTypeDescriptor(snapshot, md)
+		if err != nil {
+			return Service{}, err
+		}
+		opts, _ := md.Options().(*descriptorpb.MethodOptions)
+		svc.Methods = append(svc.Methods, Method{
+			Name:            string(md.Name()),
+			FullPath:        fmt.Sprintf("/%s/%s", sd.FullName(), md.Name()),
+			Location:        loc,
+			RequestType:     string(md.Input().FullName()),
+			ResponseType:    string(md.Output().FullName()),
+			ClientStreaming: md.IsStreamingClient(),
+			ServerStreaming: md.IsStreamingServer(),
+			Deprecated:      opts.GetDeprecated(),
+			Annotations:     optionsJSON(opts),
+		})
+	}
+	return svc, nil
+}
+
+// optionsJSON returns the options message in protojson format, or nil if no
+// options are set.
+func optionsJSON(opts proto.Message) json.RawMessage {
+	if opts == nil || !opts.ProtoReflect().IsValid() || proto.Size(opts) == 0 {
+		return nil
+	}
+	data, err := protojson.Marshal(opts)
+	if err != nil {
+		return nil
+	}
+	// protojson output is deliberately unstable; compact it so that clients
+	// can compare annotations textually
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil || buf.String() == "{}" {
+		return nil
+	}
+	return buf.Bytes()
+}
@@ -1,7 +1,110 @@
 package lsp
 
+import (
+	"github.com/kralicky/protols/pkg/format"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
 type Settings struct {
 	InlayHints InlayHintsSettings `mapstructure:"inlayHints"`
+	Lint       LintSettings       `mapstructure:"lint"`
+	Refactor   RefactorSettings   `mapstructure:"refactor"`
+	// Maps fully-qualified option field names to the kind of reference their
+	// string values contain ("type", "method", "resource" or "extension"),
+	// enabling hover and go-to-definition on those values. The "file" and
+	// "workspaceFile" kinds are paths relative to the directory of the file
+	// declaring the option, or to the workspace root, and are shown as
+	// document links. An empty kind disables a builtin mapping.
+	StringReferences map[string]string `mapstructure:"stringReferences"`
+	// Maps fully-qualified names of option fields whose values are field paths
+	// to the message the paths select fields of. Fields of type
+	// google.protobuf.FieldMask always contain field paths; string fields
+	// listed here contain a path or a comma-separated list of paths. Targets
+	// are "input" or "output" for the request or response type of the
+	// enclosing method, "parent" for the enclosing message, "sibling:<field>"
+	// for the type of, or the type named by, another field of the same message
+	// literal, or a message name. An empty target is inferred: "input" within
+	// a method, and "parent" elsewhere.
+	FieldPaths map[string]string `mapstructure:"fieldPaths"`
+	// Maps import paths to the files they refer to, for workspaces using import
+	// roots that cannot be inferred. Keys are import paths, or prefixes ending
+	// in "/*". Values starting with "/", "./" or "../" are files or directories
+	// (relative to the workspace root); other values are import paths, which
+	// are then resolved normally. Aliases take precedence over all other ways
+	// of resolving an import.
+	//
+	// For example, {"company/protos/*": "./third_party/protos/*"} resolves
+	// "company/protos/foo/foo.proto" to third_party/protos/foo/foo.proto.
+	ImportAliases map[string]string `mapstructure:"importAliases"`
+	// The order in which sources are tried for import paths which can be
+	// resolved from more than one: "workspace" for files in the workspace,
+	// "index" for the index archive, and "goModule" for go modules required
+	// by the local module. Sources which are not listed follow the listed ones
+	// in this default order. Imports resolved from one source but also provided
+	// by another are reported with an informational diagnostic.
+	ImportPrecedence []string `mapstructure:"importPrecedence"`
+	// Glob patterns matching paths, relative to the workspace root, which are
+	// not searched for .proto files, ignored by the file watcher, and not
+	// searched for references. "**" matches any number of directories, e.g.
+	// "**/testdata/**" or "bazel-out/**".
+	Exclude []string `mapstructure:"exclude"`
+	// If true, workspace files are only indexed by path and package name when
+	// they are discovered, and are compiled when opened or when needed to answer
+	// a query such as find references or workspace symbols. Diagnostics are
+	// only reported for compiled files. The protols/indexWorkspace command
+	// compiles all remaining files.
+	Lazy bool `mapstructure:"lazy"`
+	// In lazy mode, glob patterns matching paths, relative to the workspace
+	// root, of files which are still compiled on startup, such as the
+	// directories a team works in most. Other files are compiled when needed.
+	// Uses the same syntax as "exclude".
+	EagerPaths []string `mapstructure:"eagerPaths"`
+	// Path to an index archive, relative to the workspace root, created with
+	// 'protols export-index' or the protols/exportIndex command. Synthetic
+	// files found in the archive are loaded from it instead of being generated
+	// from Go sources. The archive is ignored if it was exported with a
+	// different go.sum.
+	IndexArchive string `mapstructure:"indexArchive"`
+	// Fully-qualified names of string option fields which hold colors, written
+	// as hex strings such as "#ff8800". Editors show a color swatch and picker
+	// for their values.
+	ColorFields []string `mapstructure:"colorFields"`
+	// Discovery and execution of example requests for workspace methods. See
+	// the protols/smokeTests command.
+	SmokeTests SmokeTestSettings `mapstructure:"smokeTests"`
+	// How synthetic files, which are generated from descriptors for imports
+	// with no source on disk, are rendered.
+	SyntheticFiles SyntheticFileSettings `mapstructure:"syntheticFiles"`
+	// Additional content shown on hover.
+	Hover HoverSettings `mapstructure:"hover"`
+	// Options for formatting documents. The defaults match 'protols fmt'.
+	Format format.FormatterOptions `mapstructure:"format"`
+}
+
+// InitializationOptions are read from the initialize request, and configure
+// behavior which cannot change for the lifetime of the server.
+type InitializationOptions struct {
+	// The kind of text document sync the server advertises: "incremental"
+	// (the default) or "full".
+	TextDocumentSync string `mapstructure:"textDocumentSync"`
+	// If true, the server never reads workspace files from its own disk.
+	// Contents of files which are not open are requested from the client with
+	// protols/readFile, and workspace files are discovered only through
+	// workspace/didChangeWatchedFiles. This allows the server to run on a
+	// different machine or container than the editor.
+	Remote bool `mapstructure:"remote"`
+	// If true, the server does not run any subprocesses, such as the go or git
+	// commands. This is intended for opening untrusted repositories. Imports
+	// are resolved from the filesystem only, and features which depend on the
+	// go toolchain or git are disabled.
+	Sandbox bool `mapstructure:"sandbox"`
+}
+
+func (o *InitializationOptions) GetTextDocumentSync() protocol.TextDocumentSyncKind {
+	if o.TextDocumentSync == "full" {
+		return protocol.Full
+	}
+	return protocol.Incremental
 }
 
 type InlayHintsSettings struct {
@@ -22,3 +125,141 @@ func (s *InlayHintsSettings) GetImports() bool {
 	}
 	return *s.Imports
 }
+
+type HoverSettings struct {
+	// If true, hovering the 'option' keyword of an option declaration, or the
+	// brackets of a compact options list, shows the options of the enclosing
+	// declaration in text format, as they are stored in its descriptor after
+	// custom options have been interpreted.
+	InterpretedOptions bool `mapstructure:"interpretedOptions"`
+}
+
+type LintSettings struct {
+	Enabled *bool `mapstructure:"enabled"`
+	// Names of lint rules to disable
+	Disabled []string `mapstructure:"disabled"`
+	// Names of optional rule packs to enable, such as "aip" or "breaking".
+	// Packs can also be enabled for individual files with the 'protols:lint'
+	// pragma.
+	Packs []string `mapstructure:"packs"`
+	// The git revision that files are compared against by the "breaking" lint
+	// pack and by refactorings which check for breaking changes. Set to an
+	// empty string to disable.
+	GitBaseline *string `mapstructure:"gitBaseline"`
+	// A regular expression which the names of streaming methods must match.
+	// Set to an empty string to disable the check.
+	StreamingMethodPattern *string `mapstructure:"streamingMethodPattern"`
+	// External analyzer binaries to run after the builtin lint rules. See
+	// ExternalAnalyzerSettings.
+	External []ExternalAnalyzerSettings `mapstructure:"external"`
+	// Names of lint rules, rule packs and analyzers (including external
+	// analyzers) which only run when a file's contents are saved, rather than
+	// each time it is compiled. Use this for heavier checks, such as
+	// "field-reuse" (which reads the git baseline), "stale-generated-code" or
+	// an enabled pack, to keep diagnostics fast while typing. Diagnostics from
+	// these checks are not shown while a file has unsaved changes.
+	OnSave []string `mapstructure:"onSave"`
+	// Settings for the rules in the "spelling" pack.
+	Spelling SpellingSettings `mapstructure:"spelling"`
+	// Settings for the rules in the "naming" pack.
+	Naming NamingSettings `mapstructure:"naming"`
+	// Size limits for declarations. All limits are unset by default.
+	Complexity ComplexitySettings `mapstructure:"complexity"`
+	// Settings for the rule in the "comments" pack.
+	CommentCoverage CommentCoverageSettings `mapstructure:"commentCoverage"`
+}
+
+type SpellingSettings struct {
+	// Words which are never reported as misspelled.
+	Ignore []string `mapstructure:"ignore"`
+	// Maps misspelled words (in lower case) to their corrections, in addition
+	// to the builtin list of common misspellings. Mapping a word to an empty
+	// string stops it from being reported.
+	Corrections map[string]string `mapstructure:"corrections"`
+}
+
+type NamingSettings struct {
+	// Maps kinds of declarations ("message", "field", "oneof", "enum",
+	// "enumValue", "service" and "method") to regular expressions which their
+	// names must match, overriding the conventions of the protobuf style
+	// guide. An empty pattern disables the check for that kind.
+	Patterns map[string]string `mapstructure:"patterns"`
+	// Whether enum value names must be prefixed with the name of their enum
+	// in UPPER_SNAKE_CASE. Defaults to true.
+	EnumValuePrefix *bool `mapstructure:"enumValuePrefix"`
+}
+
+type ComplexitySettings struct {
+	// The maximum number of fields in a message.
+	MaxFields int `mapstructure:"maxFields"`
+	// The maximum nesting depth of messages. Top-level messages have a depth
+	// of 1.
+	MaxNestingDepth int `mapstructure:"maxNestingDepth"`
+	// The maximum number of fields in a oneof.
+	MaxOneofMembers int `mapstructure:"maxOneofMembers"`
+	// The maximum number of methods in a service.
+	MaxMethods int `mapstructure:"maxMethods"`
+	// The severity of diagnostics for declarations exceeding a limit, either
+	// "warning" (the default) or "hint".
+	Severity string `mapstructure:"severity"`
+}
+
+type CommentCoverageSettings struct {
+	// Kinds of declarations which require leading comments: "message",
+	// "field", "enum", "enumValue", "service" and "method". Defaults to
+	// messages, fields, services and methods.
+	Kinds []string `mapstructure:"kinds"`
+	// Glob patterns matching the import paths of files which require
+	// comments. If empty, all files require comments.
+	Paths []string `mapstructure:"paths"`
+}
+
+func (s *NamingSettings) GetEnumValuePrefix() bool {
+	if s.EnumValuePrefix == nil {
+		return true
+	}
+	return *s.EnumValuePrefix
+}
+
+func (s *LintSettings) GetEnabled() bool {
+	if s.Enabled == nil {
+		return true
+	}
+	return *s.Enabled
+}
+
+func (s *LintSettings) GetGitBaseline() string {
+	if s.GitBaseline == nil {
+		return "HEAD"
+	}
+	return *s.GitBaseline
+}
+
+func (s *LintSettings) GetStreamingMethodPattern() string {
+	if s.StreamingMethodPattern == nil {
+		return defaultStreamingMethodPattern
+	}
+	return *s.StreamingMethodPattern
+}
+
+type RefactorSettings struct {
+	// Text which marks a message as under development when it appears in the
+	// message's leading comments, allowing its fields to be renumbered. Set to
+	// an empty string to disable.
+	UnstableAnnotation *string `mapstructure:"unstableAnnotation"`
+	// Glob patterns matching the import paths of files whose messages are all
+	// considered to be under development.
+	UnstablePaths []string `mapstructure:"unstablePaths"`
+	// If true, renaming a package also moves the files in the directory
+	// matching the package name (e.g. foo/v1 for foo.v1) to the directory
+	// matching the new name, and updates imports of those files. Requires
+	// client support for renaming files in workspace edits.
+	MovePackageFiles bool `mapstructure:"movePackageFiles"`
+}
+
+func (s *RefactorSettings) GetUnstableAnnotation() string {
+	if s.UnstableAnnotation == nil {
+		return "@unstable"
+	}
+	return *s.UnstableAnnotation
+}
@@ -0,0 +1,292 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Smoke tests are example requests for workspace methods, which can be sent
+// to a running server to check that it responds without error. They are
+// discovered from two sources:
+//
+//   - the value of the method option named by the smokeTests.option setting,
+//     which is either a message of the method's request type, or a string
+//     containing the request in text format;
+//   - text format files next to the file declaring the service, named
+//     <Service>.<Method>.textproto or <Service>.<Method>.<name>.textproto.
+//
+// Tests are listed with the protols/smokeTests command, and run with the
+// protols/runSmokeTests command, which sends a protols/smokeTestResult
+// notification as each test completes.
+
+const defaultSmokeTestTimeout = 10 * time.Second
+
+type SmokeTestSettings struct {
+	// Fully-qualified name of a method option holding an example request for
+	// the method.
+	Option string `mapstructure:"option"`
+	// Address of the gRPC server that smoke tests are run against, such as
+	// "localhost:8080". Connections are made without TLS.
+	Endpoint string `mapstructure:"endpoint"`
+	// Timeout for each test, as a Go duration string. Defaults to 10s.
+	Timeout string `mapstructure:"timeout"`
+}
+
+// A SmokeTest is an example request for a method.
+type SmokeTest struct {
+	// Identifies the test: the method's path, followed by "#option" or
+	// "#<filename>" depending on where the request was found.
+	ID              string `json:"id"`
+	Service         string `json:"service"`
+	Method          string `json:"method"`
+	FullPath        string `json:"fullPath"`
+	ClientStreaming bool   `json:"clientStreaming,omitempty"`
+	ServerStreaming bool   `json:"serverStreaming,omitempty"`
+	// The location of the method option or the companion file.
+	Location protocol.Location `json:"location"`
+	// The request, in text format.
+	Request string `json:"request"`
+
+	md protoreflect.MethodDescriptor
+}
+
+type SmokeTestResult = protocolext.SmokeTestResult
+
+// FindSmokeTests returns the smoke tests for all methods declared in
+// workspace-local files, sorted by ID.
+func (c *Cache) FindSmokeTests(ctx context.Context, snapshot *Snapshot) ([]SmokeTest, error) {
+	settings := c.settings.Load().SmokeTests
+	tests := []SmokeTest{}
+	for _, sd := range c.workspaceServices(snapshot) {
+		methods := sd.Methods()
+		for i := range methods.Len() {
+			md := methods.Get(i)
+			if request, ok := smokeTestOption(md, protoreflect.FullName(settings.Option)); ok {
+				loc, err := c.FindDefinitionForTypeDescriptor(snapshot, md)
+				if err != nil {
+					return nil, err
+				}
+				tests = append(tests, newSmokeTest(md, "option", loc, request))
+			}
+		}
+		uri, err := c.resolver.PathToURI(sd.ParentFile().Path())
+		if err != nil {
+			continue
+		}
+		for _, companion := range c.smokeTestCompanions(ctx, uri, sd) {
+			fh, err := c.compiler.fs.ReadFile(ctx, companion)
+			if err != nil {
+				continue
+			}
+			data, err := fh.Content()
+			if err != nil {
+				continue
+			}
+			name := path.Base(uriPath(companion))
+			parts := strings.Split(strings.TrimSuffix(name, ".textproto"), ".")
+			md := methods.ByName(protoreflect.Name(parts[1]))
+			loc := protocol.Location{URI: companion}
+			tests = append(tests, newSmokeTest(md, name, loc, string(data)))
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(tests, func(a, b SmokeTest) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return tests, nil
+}
+
+// smokeTestCompanions returns the URIs of the text format files which may
+// hold requests for methods of the service declared in the file with the given
+// URI. Files are read through the cache's file source, so directories which
+// cannot be listed are only checked for <Service>.<Method>.textproto.
+func (c *Cache) smokeTestCompanions(ctx context.Context, uri protocol.DocumentURI, sd protoreflect.ServiceDescriptor) []protocol.DocumentURI {
+	i := strings.LastIndexByte(string(uri), '/')
+	if i < 0 {
+		return nil
+	}
+	dir := uri[:i]
+	candidates, _ := c.resolver.fsDelegate.readDir(ctx, dir)
+	methods := sd.Methods()
+	for i := range methods.Len() {
+		candidates = append(candidates, dir+"/"+protocol.DocumentURI(fmt.Sprintf("%s.%s.textproto", sd.Name(), methods.Get(i).Name())))
+	}
+	var uris []protocol.DocumentURI
+	for _, candidate := range candidates {
+		name := path.Base(uriPath(candidate))
+		if !strings.HasSuffix(name, ".textproto") {
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(name, ".textproto"), ".")
+		if len(parts) < 2 || parts[0] != string(sd.Name()) || methods.ByName(protoreflect.Name(parts[1])) == nil {
+			continue
+		}
+		uris = append(uris, candidate)
+	}
+	slices.Sort(uris)
+	return slices.Compact(uris)
+}
+
+func newSmokeTest(md protoreflect.MethodDescriptor, source string, loc protocol.Location, request string) SmokeTest {
+	fullPath := fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+	return SmokeTest{
+		ID:              fullPath + "#" + source,
+		Service:         string(md.Parent().FullName()),
+		Method:          string(md.Name()),
+		FullPath:        fullPath,
+		ClientStreaming: md.IsStreamingClient(),
+		ServerStreaming: md.IsStreamingServer(),
+		Location:        loc,
+		Request:         request,
+		md:              md,
+	}
+}
+
+// smokeTestOption returns the request held by the named option of the method,
+// in text format.
+func smokeTestOption(md protoreflect.MethodDescriptor, name protoreflect.FullName) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	var request string
+	var found bool
+	md.Options().ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if !fd.IsExtension() || fd.FullName() != name {
+			return true
+		}
+		switch fd.Kind() {
+		case protoreflect.StringKind:
+			request, found = v.String(), true
+		case protoreflect.MessageKind:
+			request, found = prototext.Format(v.Message().Interface()), true
+		}
+		return false
+	})
+	return request, found
+}
+
+// RunSmokeTests runs the smoke tests with the given IDs (or all tests, if
+// none are given) against the endpoint, calling report with the result of
+// each test as it completes. If endpoint is empty, the smokeTests.endpoint
+// setting is used.
+func (c *Cache) RunSmokeTests(ctx context.Context, ids []string, endpoint string, report func(SmokeTestResult)) ([]SmokeTestResult, error) {
+	settings := c.settings.Load().SmokeTests
+	if endpoint == "" {
+		endpoint = settings.Endpoint
+	}
+	if endpoint == "" {
+		return nil, errors.New("no smoke test endpoint configured")
+	}
+	timeout := defaultSmokeTestTimeout
+	if settings.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(settings.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid smoke test timeout: %w", err)
+		}
+	}
+	snapshot := c.Snapshot()
+	tests, err := c.FindSmokeTests(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		tests = slices.DeleteFunc(tests, func(t SmokeTest) bool {
+			return !slices.Contains(ids, t.ID)
+		})
+	}
+
+	conn, err := grpc.NewClient(endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	results := []SmokeTestResult{}
+	for _, test := range tests {
+		start := time.Now()
+		responses, err := runSmokeTest(ctx, conn, test, snapshot.Results().AsResolver(), timeout)
+		result := SmokeTestResult{
+			ID:         test.ID,
+			Passed:     err == nil,
+			Responses:  responses,
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+		if report != nil {
+			report(result)
+		}
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// runSmokeTest sends the test's request to the server. Types referred to by
+// Any fields and extensions in the request and responses are looked up with
+// the given resolver.
+func runSmokeTest(ctx context.Context, conn *grpc.ClientConn, test SmokeTest, resolver linker.Resolver, timeout time.Duration) ([]string, error) {
+	if test.ClientStreaming {
+		return nil, errors.New("client streaming methods are not supported")
+	}
+	request := dynamicpb.NewMessage(test.md.Input())
+	if err := (prototext.UnmarshalOptions{Resolver: resolver}).Unmarshal([]byte(test.Request), request); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	ctx, ca := context.WithTimeout(ctx, timeout)
+	defer ca()
+	format := func(m proto.Message) string {
+		return prototext.MarshalOptions{Multiline: true, Resolver: resolver}.Format(m)
+	}
+
+	if !test.ServerStreaming {
+		response := dynamicpb.NewMessage(test.md.Output())
+		if err := conn.Invoke(ctx, test.FullPath, request, response); err != nil {
+			return nil, err
+		}
+		return []string{format(response)}, nil
+	}
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, test.FullPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(request); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	var responses []string
+	for {
+		response := dynamicpb.NewMessage(test.md.Output())
+		if err := stream.RecvMsg(response); err != nil {
+			if errors.Is(err, io.EOF) {
+				return responses, nil
+			}
+			return responses, err
+		}
+		responses = append(responses, format(response))
+	}
+}
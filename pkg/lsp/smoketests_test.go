@@ -0,0 +1,154 @@
+package lsp
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestSmokeTests(t *testing.T) {
+	// an echo server which repeats responses to server streaming methods
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		if method == "/foo.FooService/Fail" {
+			return status.Error(codes.Unavailable, "failed")
+		}
+		msg := &emptypb.Empty{}
+		if err := stream.RecvMsg(msg); err != nil {
+			return err
+		}
+		n := 1
+		if method == "/foo.FooService/Repeat" {
+			n = 2
+		}
+		for range n {
+			if err := stream.SendMsg(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	c, _ := newTestCache(t, map[string]string{
+		"foo.proto": `syntax = "proto3";
+package foo;
+import "google/protobuf/any.proto";
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.MethodOptions {
+  string example = 50000;
+}
+service FooService {
+  rpc Echo(Msg) returns (Msg) {
+    option (example) = "text: 'hello'";
+  }
+  rpc Repeat(Msg) returns (stream Msg);
+  rpc Fail(Msg) returns (Msg);
+  rpc Wrap(Wrapper) returns (Wrapper);
+}
+message Msg {
+  string text = 1;
+}
+message Wrapper {
+  google.protobuf.Any any = 1;
+}
+`,
+		"FooService.Repeat.textproto":   `text: "again"`,
+		"FooService.Fail.textproto":     `text: "oops"`,
+		"FooService.Missing.textproto":  `text: "ignored"`,
+		"BarService.Echo.textproto":     `text: "ignored"`,
+		"FooService.Echo.bad.textproto": `unknown_field: 1`,
+		// foo.Msg is only known to the workspace
+		"FooService.Wrap.textproto": `any { [type.googleapis.com/foo.Msg] { text: "inner" } }`,
+	}, &Settings{
+		SmokeTests: SmokeTestSettings{Option: "foo.example", Endpoint: lis.Addr().String()},
+	})
+
+	tests, err := c.FindSmokeTests(context.Background(), c.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, test := range tests {
+		ids = append(ids, test.ID)
+	}
+	wantIDs := []string{
+		"/foo.FooService/Echo#FooService.Echo.bad.textproto",
+		"/foo.FooService/Echo#option",
+		"/foo.FooService/Fail#FooService.Fail.textproto",
+		"/foo.FooService/Repeat#FooService.Repeat.textproto",
+		"/foo.FooService/Wrap#FooService.Wrap.textproto",
+	}
+	if strings.Join(ids, "\n") != strings.Join(wantIDs, "\n") {
+		t.Fatalf("got tests:\n%s\nwant:\n%s", strings.Join(ids, "\n"), strings.Join(wantIDs, "\n"))
+	}
+	if tests[1].Request != "text: 'hello'" || tests[1].Location.Range.Start.Line != 8 {
+		t.Errorf("unexpected test: %+v", tests[1])
+	}
+
+	var reported []string
+	results, err := c.RunSmokeTests(context.Background(), nil, "", func(r SmokeTestResult) {
+		reported = append(reported, r.ID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(reported, "\n") != strings.Join(wantIDs, "\n") {
+		t.Errorf("got notifications for:\n%s", strings.Join(reported, "\n"))
+	}
+	var got []string
+	for _, r := range results {
+		var responses []string
+		for _, resp := range r.Responses {
+			responses = append(responses, strings.Join(strings.Fields(resp), " "))
+		}
+		errMsg, _, _ := strings.Cut(r.Error, ":")
+		got = append(got, r.ID+" "+strings.Join(responses, "|")+" "+errMsg)
+	}
+	want := []string{
+		"/foo.FooService/Echo#FooService.Echo.bad.textproto  invalid request",
+		`/foo.FooService/Echo#option text: "hello" `,
+		"/foo.FooService/Fail#FooService.Fail.textproto  rpc error",
+		`/foo.FooService/Repeat#FooService.Repeat.textproto text: "again"|text: "again" `,
+		`/foo.FooService/Wrap#FooService.Wrap.textproto any: { [type.googleapis.com/foo.Msg]: { text: "inner" } } `,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got results:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if results[0].Passed || !results[1].Passed || results[2].Passed || !results[3].Passed || !results[4].Passed {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
+
+func TestSmokeTestsSchemeHandler(t *testing.T) {
+	// the handler cannot list directories, so only requests named after a
+	// method are found
+	handler := memSchemeHandler{
+		"mem:///workspace/foo.proto":                       "syntax = \"proto3\";\npackage foo;\nservice FooService {\n  rpc Echo(Msg) returns (Msg);\n}\nmessage Msg {}\n",
+		"mem:///workspace/FooService.Echo.textproto":       "",
+		"mem:///workspace/FooService.Echo.named.textproto": "",
+	}
+	c := NewCache(protocol.WorkspaceFolder{URI: "mem:///workspace"}, WithSchemeHandlers(map[string]SchemeHandler{"mem": handler}))
+	defer c.Close(nil)
+	c.loadWorkspaceFiles()
+
+	tests, err := c.FindSmokeTests(context.Background(), c.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) != 1 || tests[0].Location.URI != "mem:///workspace/FooService.Echo.textproto" {
+		t.Errorf("unexpected tests %+v", tests)
+	}
+}
@@ -0,0 +1,234 @@
+package lsp
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kralicky/protocompile"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protocompile/parser"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A Snapshot is an immutable view of the cache's compilation results and the
+// document versions they were compiled from. A new snapshot is published
+// each time a compilation finishes, and never changes afterwards.
+//
+// The Find methods of Cache always see the latest results, but a request
+// which looks up several results in turn may see some of them before a
+// recompile and some after. Requests which need a consistent view, such as
+// those which combine the parse and link results of a file, should take a
+// snapshot once and use it throughout instead.
+type Snapshot struct {
+	id       uint64
+	resolver *Resolver
+	results  linker.Files
+	partial  map[protocompile.ResolvedPath]linker.Result
+	unlinked map[protocompile.ResolvedPath]parser.Result
+	versions map[protocol.DocumentURI]int32
+
+	published time.Time
+	mu        sync.Mutex
+	users     int
+	retired   bool
+}
+
+// Snapshot returns the most recently published snapshot. Like the Find
+// methods, it waits for any compilation in progress to finish, so it must not
+// be called while resultsMu is held.
+func (c *Cache) Snapshot() *Snapshot {
+	c.resultsMu.RLock()
+	defer c.resultsMu.RUnlock()
+	return c.snapshot.Load()
+}
+
+// AcquireSnapshot is like Snapshot, but also tracks how long the caller uses
+// the snapshot, for the snapshot_use and snapshot_lifetime metrics. It is
+// meant for long-running operations such as exports. Tracking only affects
+// metrics: snapshots never change once published, and remain valid for as
+// long as they are referenced. The returned function ends the use.
+func (c *Cache) AcquireSnapshot() (*Snapshot, func()) {
+	c.resultsMu.RLock()
+	defer c.resultsMu.RUnlock()
+	snapshot := c.snapshot.Load()
+	return snapshot, snapshot.acquire()
+}
+
+// publishSnapshotLocked publishes a snapshot of the current results. Results
+// are replaced in place while compiling, so the snapshot keeps its own copy
+// of each collection. resultsMu must be write-locked.
+func (c *Cache) publishSnapshotLocked() {
+	c.partialResultsMu.Lock()
+	snapshot := &Snapshot{
+		id:       c.snapshotIDs.Add(1),
+		resolver: c.resolver,
+		results:  slices.Clone(c.results),
+		partial:  maps.Clone(c.partiallyLinkedResults),
+		unlinked: maps.Clone(c.unlinkedResults),
+		versions: c.documentVersions.snapshot(),
+
+		published: time.Now(),
+	}
+	c.partialResultsMu.Unlock()
+	if prev := c.snapshot.Swap(snapshot); prev != nil {
+		prev.retire()
+	}
+	slog.Debug("published snapshot", "snapshot", snapshot)
+}
+
+// acquire records a use of the snapshot, and returns a function which ends
+// it.
+func (s *Snapshot) acquire() func() {
+	s.mu.Lock()
+	s.users++
+	s.mu.Unlock()
+	metrics.snapshotsInUse.Add(1)
+	slog.Debug("acquired snapshot", "snapshot", s)
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			metrics.snapshotsInUse.Add(-1)
+			metrics.snapshotUseTime.since(start)
+			slog.Debug("released snapshot", "snapshot", s, "used", time.Since(start))
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.users--
+			if s.users == 0 && s.retired {
+				metrics.snapshotLifetime.since(s.published)
+			}
+		})
+	}
+}
+
+// retire marks the snapshot as replaced by a newer one. For the lifetime
+// metric, its lifetime ends once no acquired use of it is ongoing.
+func (s *Snapshot) retire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retired = true
+	if s.users == 0 {
+		metrics.snapshotLifetime.since(s.published)
+	}
+}
+
+// ID returns the sequence number of the snapshot, which increases each time
+// a snapshot is published. IDs are included in logs to tell which results a
+// request observed.
+func (s *Snapshot) ID() uint64 {
+	return s.id
+}
+
+// LogValue implements slog.LogValuer.
+func (s *Snapshot) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("id", s.id),
+		slog.Int("files", len(s.results)),
+	)
+}
+
+// DocumentVersion returns the version of the document that the snapshot's
+// results for the given URI were compiled from, or -1 if the results were
+// read from disk.
+func (s *Snapshot) DocumentVersion(uri protocol.DocumentURI) (int32, bool) {
+	v, ok := s.versions[uri]
+	return v, ok
+}
+
+// Results returns the linker results in the snapshot. Files which failed to
+// link are represented by placeholders. The returned slice must not be
+// modified.
+func (s *Snapshot) Results() linker.Files {
+	return s.results
+}
+
+func (s *Snapshot) FindResultByURI(uri protocol.DocumentURI) (linker.Result, error) {
+	path, err := s.resolver.URIToPath(uri)
+	if err != nil {
+		return nil, err
+	}
+	return s.FindResultByPath(path)
+}
+
+func (s *Snapshot) FindResultByPath(path string) (linker.Result, error) {
+	f := s.results.FindFileByPath(path)
+	if f == nil {
+		return nil, fmt.Errorf("FindResultByPath: package not found: %q", path)
+	}
+	res, ok := f.(linker.Result)
+	if !ok {
+		// placeholder for a file that failed to link
+		return nil, fmt.Errorf("FindResultByPath: no linker result for %q", path)
+	}
+	return res, nil
+}
+
+func (s *Snapshot) FindResultOrPartialResultByURI(uri protocol.DocumentURI) (linker.Result, error) {
+	path, err := s.resolver.URIToPath(uri)
+	if err != nil {
+		return nil, err
+	}
+	return s.FindResultOrPartialResultByPath(path)
+}
+
+func (s *Snapshot) FindResultOrPartialResultByPath(path string) (linker.Result, error) {
+	if pr, ok := s.partial[protocompile.ResolvedPath(path)]; ok {
+		return pr, nil
+	}
+	return s.FindResultByPath(path)
+}
+
+func (s *Snapshot) FindParseResultByURI(uri protocol.DocumentURI) (parser.Result, error) {
+	path, err := s.resolver.URIToPath(uri)
+	if err != nil {
+		return nil, err
+	}
+	return s.FindParseResultByPath(path)
+}
+
+func (s *Snapshot) FindParseResultByPath(path string) (parser.Result, error) {
+	if pr, ok := s.unlinked[protocompile.ResolvedPath(path)]; ok {
+		return pr, nil
+	}
+	return s.FindResultOrPartialResultByPath(path)
+}
+
+// FindDescriptorByName finds a descriptor by name among the snapshot's
+// results.
+func (s *Snapshot) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	return s.results.AsResolver().FindDescriptorByName(name)
+}
+
+// referenceFilter returns a function which narrows files in the snapshot to
+// those which may contain references to a descriptor, like
+// referenceIndex.filter. The index follows the latest results, so files which
+// have been recompiled since the snapshot was published are always included.
+func (c *Cache) referenceFilter(s *Snapshot, files linker.Files) func(desc protoreflect.Descriptor) linker.Files {
+	var stale linker.Files
+	staleAsOf := s.id
+	return func(desc protoreflect.Descriptor) linker.Files {
+		c.resultsMu.RLock()
+		defer c.resultsMu.RUnlock()
+		if latest := c.snapshot.Load(); latest.id != staleAsOf {
+			staleAsOf = latest.id
+			stale = stale[:0]
+			for _, f := range files {
+				if latest.results.FindFileByPath(f.Path()) != f {
+					stale = append(stale, f)
+				}
+			}
+		}
+		candidates := c.refIndex.filter(desc, files)
+		for _, f := range stale {
+			if !slices.Contains(candidates, f) {
+				candidates = append(candidates, f)
+			}
+		}
+		return candidates
+	}
+}
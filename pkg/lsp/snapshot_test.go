@@ -0,0 +1,89 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestSnapshots(t *testing.T) {
+	const a = "syntax = \"proto3\";\npackage a;\nmessage A {}\n"
+	c, workspace := newTestCache(t, map[string]string{"a.proto": a}, nil)
+	ctx := context.Background()
+	uri := protocol.URIFromPath(filepath.Join(workspace, "a.proto"))
+
+	before := c.Snapshot()
+	c.DidModifyFiles(ctx, []file.Modification{{
+		URI:        uri,
+		Action:     file.Open,
+		Version:    2,
+		Text:       []byte(a + "message B {}\n"),
+		LanguageID: "protobuf",
+	}})
+	after := c.Snapshot()
+	if after.ID() <= before.ID() {
+		t.Fatalf("expected a new snapshot after compiling, got %d then %d", before.ID(), after.ID())
+	}
+
+	// the earlier snapshot is unaffected by the recompile
+	res, err := before.FindResultByURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := res.Messages().Len(); n != 1 {
+		t.Errorf("expected 1 message in the earlier snapshot, got %d", n)
+	}
+	if _, err := before.FindDescriptorByName("a.B"); err == nil {
+		t.Errorf("expected a.B to be missing from the earlier snapshot")
+	}
+
+	res, err = after.FindResultByURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := res.Messages().Len(); n != 2 {
+		t.Errorf("expected 2 messages in the latest snapshot, got %d", n)
+	}
+	if v, ok := after.DocumentVersion(uri); !ok || v != 2 {
+		t.Errorf("expected document version 2, got %d", v)
+	}
+}
+
+func TestSnapshotLifetime(t *testing.T) {
+	const a = "syntax = \"proto3\";\npackage a;\nmessage A {}\n"
+	c, workspace := newTestCache(t, map[string]string{"a.proto": a}, nil)
+	ctx := context.Background()
+	uri := protocol.URIFromPath(filepath.Join(workspace, "a.proto"))
+
+	inUse := metrics.snapshotsInUse.Value()
+	lifetimes := metrics.snapshotLifetime.count.Load()
+	snapshot, release := c.AcquireSnapshot()
+	if n := metrics.snapshotsInUse.Value(); n != inUse+1 {
+		t.Errorf("expected %d snapshots in use, got %d", inUse+1, n)
+	}
+	c.DidModifyFiles(ctx, []file.Modification{{
+		URI:        uri,
+		Action:     file.Open,
+		Version:    2,
+		Text:       []byte(a + "message B {}\n"),
+		LanguageID: "protobuf",
+	}})
+	if c.Snapshot() == snapshot {
+		t.Fatal("expected a new snapshot after compiling")
+	}
+	// the acquired snapshot is still in use after being replaced
+	if n := metrics.snapshotLifetime.count.Load(); n != lifetimes {
+		t.Errorf("expected the snapshot's lifetime not to end while it is in use")
+	}
+	release()
+	release()
+	if n := metrics.snapshotsInUse.Value(); n != inUse {
+		t.Errorf("expected %d snapshots in use after releasing, got %d", inUse, n)
+	}
+	if n := metrics.snapshotLifetime.count.Load(); n != lifetimes+1 {
+		t.Errorf("expected the snapshot's lifetime to end when released, got %d lifetimes", n-lifetimes)
+	}
+}
@@ -0,0 +1,249 @@
+package lsp
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// SourceSortMembers is the kind of code actions which reorder the
+// declarations of a message, enum or service.
+const SourceSortMembers protocol.CodeActionKind = "source.sortMembers"
+
+// sortableMember is a declaration which can be reordered along with its
+// attached comments.
+type sortableMember struct {
+	node ast.Node
+	// only one of number or name is used as the sort key, depending on the
+	// kind of block
+	number int64
+	name   string
+}
+
+type sortableBlock struct {
+	title   string
+	members []sortableMember
+	// decls contains all declarations in the block, in order. Declarations
+	// which are not members separate groups of members which are sorted
+	// independently.
+	decls []ast.Node
+}
+
+// sortMembers offers to sort the fields of the message or oneof, the values
+// of the enum, or the methods of the service at the cursor. Declarations are
+// only reordered within groups of consecutive members; blank lines and other
+// declarations such as options or nested messages start a new group. Comments
+// attached to a declaration move with it.
+func (c *Cache) sortMembers(ctx context.Context, request *protocol.CodeActionParams, linkRes linker.Result, mapper *protocol.Mapper, results chan<- protocol.CodeAction) {
+	offset, err := mapper.PositionOffset(request.Range.Start)
+	if err != nil {
+		return
+	}
+	fileNode := linkRes.AST()
+	block := findSortableBlock(fileNode, offset)
+	if block == nil {
+		return
+	}
+	edits, err := sortMemberEdits(fileNode, mapper, block)
+	if err != nil || len(edits) == 0 {
+		return
+	}
+	results <- actionQueue.enqueue(block.title, SourceSortMembers, mapper.URI, fileNode.Version(), func(ca *protocol.CodeAction) error {
+		ca.Edit = &protocol.WorkspaceEdit{
+			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+				request.TextDocument.URI: edits,
+			},
+		}
+		return nil
+	})
+}
+
+// findSortableBlock returns the innermost message, oneof, enum or service
+// containing the given offset.
+func findSortableBlock(fileNode *ast.FileNode, offset int) *sortableBlock {
+	contains := func(node ast.Node) bool {
+		info := fileNode.NodeInfo(node)
+		return info.Start().Offset <= offset && offset <= info.End().Offset
+	}
+	var visitMessageDecls func(decls []*ast.MessageElement) *sortableBlock
+	visitMessage := func(decls []*ast.MessageElement) *sortableBlock {
+		if inner := visitMessageDecls(decls); inner != nil {
+			return inner
+		}
+		block := &sortableBlock{title: "Sort fields by number"}
+		for _, decl := range decls {
+			node := decl.Unwrap()
+			block.decls = append(block.decls, node)
+			switch node := node.(type) {
+			case *ast.FieldNode:
+				block.members = append(block.members, sortableMember{node: node, number: int64(node.Tag.GetVal())})
+			case *ast.MapFieldNode:
+				block.members = append(block.members, sortableMember{node: node, number: int64(node.Tag.GetVal())})
+			case *ast.GroupNode:
+				block.members = append(block.members, sortableMember{node: node, number: int64(node.Tag.GetVal())})
+			}
+		}
+		return block
+	}
+	visitEnum := func(enum *ast.EnumNode) *sortableBlock {
+		block := &sortableBlock{title: "Sort enum values by number"}
+		for _, decl := range enum.Decls {
+			node := decl.Unwrap()
+			block.decls = append(block.decls, node)
+			if val, ok := node.(*ast.EnumValueNode); ok && val.Number != nil {
+				number, _ := val.Number.AsInt64()
+				block.members = append(block.members, sortableMember{node: node, number: number})
+			}
+		}
+		return block
+	}
+	visitMessageDecls = func(decls []*ast.MessageElement) *sortableBlock {
+		for _, decl := range decls {
+			node := decl.Unwrap()
+			if node == nil || !contains(node) {
+				continue
+			}
+			switch node := node.(type) {
+			case *ast.MessageNode:
+				return visitMessage(node.Decls)
+			case *ast.GroupNode:
+				return visitMessage(node.Decls)
+			case *ast.EnumNode:
+				return visitEnum(node)
+			case *ast.OneofNode:
+				block := &sortableBlock{title: "Sort fields by number"}
+				for _, decl := range node.Decls {
+					node := decl.Unwrap()
+					block.decls = append(block.decls, node)
+					switch node := node.(type) {
+					case *ast.FieldNode:
+						block.members = append(block.members, sortableMember{node: node, number: int64(node.Tag.GetVal())})
+					case *ast.GroupNode:
+						block.members = append(block.members, sortableMember{node: node, number: int64(node.Tag.GetVal())})
+					}
+				}
+				return block
+			}
+		}
+		return nil
+	}
+
+	for _, decl := range fileNode.Decls {
+		node := decl.Unwrap()
+		if node == nil || !contains(node) {
+			continue
+		}
+		switch node := node.(type) {
+		case *ast.MessageNode:
+			return visitMessage(node.Decls)
+		case *ast.EnumNode:
+			return visitEnum(node)
+		case *ast.ServiceNode:
+			block := &sortableBlock{title: "Sort methods by name"}
+			for _, decl := range node.Decls {
+				node := decl.Unwrap()
+				block.decls = append(block.decls, node)
+				if rpc, ok := node.(*ast.RPCNode); ok && rpc.Name != nil {
+					block.members = append(block.members, sortableMember{node: node, name: string(rpc.Name.AsIdentifier())})
+				}
+			}
+			return block
+		}
+	}
+	return nil
+}
+
+// memberSpan is the byte range of a member declaration, extended to whole
+// lines and including its leading and trailing comments.
+type memberSpan struct {
+	member     sortableMember
+	start, end int
+}
+
+// sortMemberEdits returns edits which sort each group of consecutive members
+// in the block, or no edits if the block is already sorted.
+func sortMemberEdits(fileNode *ast.FileNode, mapper *protocol.Mapper, block *sortableBlock) ([]protocol.TextEdit, error) {
+	content := mapper.Content
+	isMember := map[ast.Node]sortableMember{}
+	for _, m := range block.members {
+		isMember[m.node] = m
+	}
+
+	var groups [][]memberSpan
+	var current []memberSpan
+	flush := func() {
+		if len(current) > 1 {
+			groups = append(groups, current)
+		}
+		current = nil
+	}
+	for _, decl := range block.decls {
+		m, ok := isMember[decl]
+		if !ok {
+			flush()
+			continue
+		}
+		span := memberSpanOf(fileNode, content, m)
+		if len(current) > 0 {
+			prev := current[len(current)-1]
+			if span.start <= prev.end {
+				// more than one declaration on a line; can't reorder by lines
+				return nil, nil
+			}
+			if bytes.Count(content[prev.end:span.start], []byte("\n")) > 1 {
+				flush()
+			}
+		}
+		current = append(current, span)
+	}
+	flush()
+
+	var edits []protocol.TextEdit
+	for _, group := range groups {
+		sorted := slices.Clone(group)
+		slices.SortStableFunc(sorted, func(a, b memberSpan) int {
+			return cmp.Or(cmp.Compare(a.member.number, b.member.number), strings.Compare(a.member.name, b.member.name))
+		})
+		if slices.EqualFunc(group, sorted, func(a, b memberSpan) bool { return a.member.node == b.member.node }) {
+			continue
+		}
+		texts := make([]string, len(sorted))
+		for i, span := range sorted {
+			texts[i] = string(content[span.start:span.end])
+		}
+		rng, err := mapper.OffsetRange(group[0].start, group[len(group)-1].end)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, protocol.TextEdit{
+			Range:   rng,
+			NewText: strings.Join(texts, "\n"),
+		})
+	}
+	return edits, nil
+}
+
+func memberSpanOf(fileNode *ast.FileNode, content []byte, m sortableMember) memberSpan {
+	info := fileNode.NodeInfo(m.node)
+	start := info.Start().Offset
+	if comments := info.LeadingComments(); comments.Len() > 0 {
+		start = comments.Index(0).Start().Offset
+	}
+	end := info.End().Offset
+	if comments := info.TrailingComments(); comments.Len() > 0 {
+		end = max(end, comments.Index(comments.Len()-1).End().Offset)
+	}
+	start = bytes.LastIndexByte(content[:start], '\n') + 1
+	if i := bytes.IndexByte(content[end:], '\n'); i >= 0 {
+		end += i
+	} else {
+		end = len(content)
+	}
+	return memberSpan{member: m, start: start, end: end}
+}
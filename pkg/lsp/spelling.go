@@ -0,0 +1,326 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Lint rules which check the spelling of comments and declared names. These
+// belong to the "spelling" rule pack, which must be enabled explicitly.
+//
+// Rather than checking words against a full dictionary, which would report
+// most abbreviations and domain-specific terms, words are checked against a
+// list of common misspellings with known corrections. The list can be
+// extended, and individual words ignored, with the lint.spelling settings.
+
+const lintPackSpelling = "spelling"
+
+// commonMisspellings maps common misspellings to their corrections. All words
+// are lowercase.
+var commonMisspellings = map[string]string{
+	"accomodate":       "accommodate",
+	"acheive":          "achieve",
+	"adress":           "address",
+	"agregate":         "aggregate",
+	"allign":           "align",
+	"alot":             "a lot",
+	"ammount":          "amount",
+	"apparantly":       "apparently",
+	"appearence":       "appearance",
+	"arguement":        "argument",
+	"assosiated":       "associated",
+	"attribte":         "attribute",
+	"authentification": "authentication",
+	"availible":        "available",
+	"avaliable":        "available",
+	"begining":         "beginning",
+	"beleive":          "believe",
+	"buisness":         "business",
+	"calender":         "calendar",
+	"cancelation":      "cancellation",
+	"catagory":         "category",
+	"certian":          "certain",
+	"changable":        "changeable",
+	"collegue":         "colleague",
+	"comission":        "commission",
+	"commited":         "committed",
+	"comparision":      "comparison",
+	"compatability":    "compatibility",
+	"compatable":       "compatible",
+	"completly":        "completely",
+	"concious":         "conscious",
+	"configuraton":     "configuration",
+	"conjuction":       "conjunction",
+	"connecter":        "connector",
+	"consistant":       "consistent",
+	"containg":         "containing",
+	"contaning":        "containing",
+	"curent":           "current",
+	"currenly":         "currently",
+	"decription":       "description",
+	"definately":       "definitely",
+	"defualt":          "default",
+	"dependant":        "dependent",
+	"dependancy":       "dependency",
+	"depricated":       "deprecated",
+	"desciption":       "description",
+	"destionation":     "destination",
+	"diffrent":         "different",
+	"dissapear":        "disappear",
+	"doesnt":           "doesn't",
+	"durring":          "during",
+	"embarass":         "embarrass",
+	"enviroment":       "environment",
+	"equivelant":       "equivalent",
+	"existance":        "existence",
+	"existant":         "existent",
+	"expresion":        "expression",
+	"familar":          "familiar",
+	"finaly":           "finally",
+	"foriegn":          "foreign",
+	"formated":         "formatted",
+	"fowards":          "forwards",
+	"freind":           "friend",
+	"fullfill":         "fulfill",
+	"gaurantee":        "guarantee",
+	"guage":            "gauge",
+	"happend":          "happened",
+	"heirarchy":        "hierarchy",
+	"identifer":        "identifier",
+	"immediatly":       "immediately",
+	"implemention":     "implementation",
+	"incase":           "in case",
+	"independant":      "independent",
+	"indentifier":      "identifier",
+	"infomation":       "information",
+	"informations":     "information",
+	"initalize":        "initialize",
+	"intial":           "initial",
+	"interupt":         "interrupt",
+	"lenght":           "length",
+	"maintainance":     "maintenance",
+	"maintenence":      "maintenance",
+	"managment":        "management",
+	"messsage":         "message",
+	"millenium":        "millennium",
+	"mispell":          "misspell",
+	"neccessary":       "necessary",
+	"necesary":         "necessary",
+	"noticable":        "noticeable",
+	"occassion":        "occasion",
+	"occured":          "occurred",
+	"occurence":        "occurrence",
+	"occuring":         "occurring",
+	"ommit":            "omit",
+	"ommited":          "omitted",
+	"optinal":          "optional",
+	"orginal":          "original",
+	"paramter":         "parameter",
+	"paramters":        "parameters",
+	"particuler":       "particular",
+	"payed":            "paid",
+	"perfomance":       "performance",
+	"permision":        "permission",
+	"persistant":       "persistent",
+	"posession":        "possession",
+	"preceed":          "precede",
+	"prefered":         "preferred",
+	"prefering":        "preferring",
+	"presense":         "presence",
+	"previos":          "previous",
+	"priviledge":       "privilege",
+	"probablly":        "probably",
+	"proccess":         "process",
+	"publically":       "publicly",
+	"recieve":          "receive",
+	"recieved":         "received",
+	"recipt":           "receipt",
+	"recomend":         "recommend",
+	"reccomend":        "recommend",
+	"refered":          "referred",
+	"refrence":         "reference",
+	"relevent":         "relevant",
+	"repsonse":         "response",
+	"reponse":          "response",
+	"requst":           "request",
+	"resouce":          "resource",
+	"responce":         "response",
+	"retreive":         "retrieve",
+	"retrived":         "retrieved",
+	"seperate":         "separate",
+	"seperated":        "separated",
+	"seperator":        "separator",
+	"sucess":           "success",
+	"successfull":      "successful",
+	"sucessful":        "successful",
+	"supress":          "suppress",
+	"suport":           "support",
+	"targetted":        "targeted",
+	"tommorow":         "tomorrow",
+	"transfered":       "transferred",
+	"truely":           "truly",
+	"unecessary":       "unnecessary",
+	"untill":           "until",
+	"usefull":          "useful",
+	"vaildate":         "validate",
+	"verison":          "version",
+	"wich":             "which",
+	"writting":         "writing",
+}
+
+// spellingChecker looks up corrections in the builtin list of misspellings,
+// extended and overridden by the user's settings.
+type spellingChecker struct {
+	settings *SpellingSettings
+}
+
+func (s spellingChecker) correction(word string) (string, bool) {
+	lower := strings.ToLower(word)
+	if slices.ContainsFunc(s.settings.Ignore, func(w string) bool { return strings.EqualFold(w, word) }) {
+		return "", false
+	}
+	correction, ok := s.settings.Corrections[lower]
+	if !ok {
+		correction, ok = commonMisspellings[lower]
+	}
+	if !ok || correction == "" {
+		return "", false
+	}
+	return matchCase(word, correction), true
+}
+
+// matchCase returns the correction in the same case as the word it replaces:
+// upper case, title case, or lower case.
+func matchCase(word, correction string) string {
+	switch {
+	case len(word) > 1 && strings.ToUpper(word) == word:
+		return strings.ToUpper(correction)
+	case unicode.IsUpper([]rune(word)[0]):
+		return strings.ToUpper(correction[:1]) + correction[1:]
+	default:
+		return correction
+	}
+}
+
+// lintCommentSpelling reports misspelled words in comments, with quick fixes
+// to correct them.
+func lintCommentSpelling(_ context.Context, p *lintPass) {
+	checker := spellingChecker{settings: &p.settings.Lint.Spelling}
+	fileNode := p.result.AST()
+	items := fileNode.Items()
+	for item, ok := items.First(); ok; item, ok = items.Next(item) {
+		_, comment := fileNode.GetItem(item)
+		if !comment.IsValid() || comment.IsVirtual() {
+			continue
+		}
+		text := comment.RawText()
+		offset := comment.Start().Offset
+		for _, loc := range splitNameWords(text) {
+			word := text[loc[0]:loc[1]]
+			correction, ok := checker.correction(word)
+			if !ok {
+				continue
+			}
+			span := ast.NewSourceSpan(fileNode.SourcePos(offset+loc[0]), fileNode.SourcePos(offset+loc[1]))
+			d := p.reportSpan(span, "%q is misspelled; did you mean %q?", word, correction)
+			d.Severity = protocol.SeverityInformation
+			d.CodeActions = append(d.CodeActions, CodeAction{
+				Title:       fmt.Sprintf("Change %q to %q", word, correction),
+				Path:        p.result.Path(),
+				Kind:        protocol.QuickFix,
+				IsPreferred: true,
+				Edits:       []protocol.TextEdit{{Range: toRange(span), NewText: correction}},
+			})
+		}
+	}
+}
+
+// lintNameSpelling reports misspelled words in the names of declarations,
+// with quick fixes to rename them.
+func lintNameSpelling(ctx context.Context, p *lintPass) {
+	checker := spellingChecker{settings: &p.settings.Lint.Spelling}
+	p.result.RangeDescriptors(ctx, func(desc protoreflect.Descriptor) bool {
+		switch desc := desc.(type) {
+		case protoreflect.MessageDescriptor:
+			if desc.IsMapEntry() {
+				return true
+			}
+		case protoreflect.FieldDescriptor:
+			if desc.Kind() == protoreflect.GroupKind {
+				return true
+			}
+		case protoreflect.OneofDescriptor:
+			if desc.IsSynthetic() {
+				return true
+			}
+		case protoreflect.EnumDescriptor, protoreflect.EnumValueDescriptor,
+			protoreflect.ServiceDescriptor, protoreflect.MethodDescriptor:
+		default:
+			return true
+		}
+		name := string(desc.Name())
+		newName := name
+		var misspelled []string
+		for _, w := range slices.Backward(splitNameWords(name)) {
+			word := name[w[0]:w[1]]
+			correction, ok := checker.correction(word)
+			if !ok || strings.ContainsAny(correction, " '") {
+				continue
+			}
+			misspelled = append(misspelled, fmt.Sprintf("%q (%q)", word, correction))
+			newName = newName[:w[0]] + correction + newName[w[1]:]
+		}
+		if len(misspelled) == 0 {
+			return true
+		}
+		ref, err := findDefinition(desc, p.result)
+		if err != nil || !ref.NodeInfo.IsValid() {
+			return true
+		}
+		slices.Reverse(misspelled)
+		d := p.reportSpan(ref.NodeInfo, "%s contains misspelled words: %s", name, strings.Join(misspelled, ", "))
+		d.Metadata[diagnosticRenameTo] = newName
+		return true
+	})
+}
+
+// splitNameWords returns the start and end offsets of the words in a
+// snake_case or CamelCase name, or in text containing such names. A run of capitals is a single word, except
+// for its last letter if a lower case letter follows (as in "HTTPServer").
+func splitNameWords(name string) [][2]int {
+	var words [][2]int
+	start := -1
+	for i := 0; i <= len(name); i++ {
+		var boundary, end bool
+		if i == len(name) || !isLetter(name[i]) {
+			end = true
+		} else if start >= 0 {
+			prev := name[i-1]
+			switch {
+			case isLower(prev) && isUpper(name[i]):
+				boundary = true
+			case isUpper(prev) && isUpper(name[i]) && i+1 < len(name) && isLower(name[i+1]):
+				boundary = true
+			}
+		}
+		if (end || boundary) && start >= 0 {
+			words = append(words, [2]int{start, i})
+			start = -1
+		}
+		if !end && start < 0 {
+			start = i
+		}
+	}
+	return words
+}
+
+func isLetter(c byte) bool { return isLower(c) || isUpper(c) }
+func isLower(c byte) bool  { return c >= 'a' && c <= 'z' }
+func isUpper(c byte) bool  { return c >= 'A' && c <= 'Z' }
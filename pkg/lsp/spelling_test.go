@@ -0,0 +1,52 @@
+package lsp
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitNameWords(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want []string
+	}{
+		{"foo_bar_baz", []string{"foo", "bar", "baz"}},
+		{"FooBar", []string{"Foo", "Bar"}},
+		{"HTTPServer", []string{"HTTP", "Server"}},
+		{"getHTTP2Config", []string{"get", "HTTP", "Config"}},
+		{"FOO_BAR", []string{"FOO", "BAR"}},
+		{"// a comment, with punctuation.", []string{"a", "comment", "with", "punctuation"}},
+	} {
+		var got []string
+		for _, w := range splitNameWords(tc.name) {
+			got = append(got, tc.name[w[0]:w[1]])
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("splitNameWords(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSpellingCorrection(t *testing.T) {
+	checker := spellingChecker{settings: &SpellingSettings{
+		Ignore:      []string{"Seperate"},
+		Corrections: map[string]string{"protbuf": "protobuf", "adress": ""},
+	}}
+	for _, tc := range []struct {
+		word, want string
+		ok         bool
+	}{
+		{"recieve", "receive", true},
+		{"Recieve", "Receive", true},
+		{"RECIEVE", "RECEIVE", true},
+		{"protbuf", "protobuf", true},
+		{"seperate", "", false},
+		{"adress", "", false},
+		{"receive", "", false},
+	} {
+		got, ok := checker.correction(tc.word)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("correction(%q) = %q, %v, want %q, %v", tc.word, got, ok, tc.want, tc.ok)
+		}
+	}
+}
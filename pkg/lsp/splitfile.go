@@ -0,0 +1,180 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type (
+	FileSplitGroup    = protocolext.FileSplitGroup
+	FileSplitProposal = protocolext.FileSplitProposal
+	FileSplitResult   = protocolext.FileSplitResult
+)
+
+// ProposeFileSplit proposes a split of a file by dependency clusters: groups
+// of top-level messages and enums which reference each other, directly or
+// indirectly. The largest cluster stays in the original file along with any
+// services and extensions, and each other cluster is moved into its own file,
+// named after its first declaration.
+func (c *Cache) ProposeFileSplit(ctx context.Context, uri protocol.DocumentURI) (*FileSplitProposal, error) {
+	linkRes, err := c.FindResultByURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	return proposeFileSplit(linkRes, c.siblingExists(ctx, uri)), nil
+}
+
+// SplitFile computes the edits which move each group of declarations into a
+// new file. If no groups are given, the proposed split is used.
+func (c *Cache) SplitFile(ctx context.Context, uri protocol.DocumentURI, groups []FileSplitGroup) (*NewFilesEdit, error) {
+	linkRes, err := c.FindResultByURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	mapper, err := c.GetMapper(uri)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		groups = proposeFileSplit(linkRes, c.siblingExists(ctx, uri)).Groups
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no split found: the declarations in %s all depend on each other", linkRes.Path())
+	}
+	declsByName := map[string]ast.Node{}
+	for _, decl := range topLevelDecls(linkRes.AST()) {
+		declsByName[string(topLevelDeclNameNode(decl).AsIdentifier())] = decl
+	}
+	extractions := make([]declExtraction, len(groups))
+	moved := map[string]bool{}
+	for i, group := range groups {
+		extractions[i].filename = group.Filename
+		for _, name := range group.Declarations {
+			decl, ok := declsByName[name]
+			if !ok {
+				return nil, fmt.Errorf("no top-level message, enum, or service named %q", name)
+			}
+			if moved[name] {
+				return nil, fmt.Errorf("%s is in more than one group", name)
+			}
+			moved[name] = true
+			extractions[i].decls = append(extractions[i].decls, decl)
+		}
+	}
+	return c.extractDecls(ctx, linkRes, mapper, extractions)
+}
+
+// proposeFileSplit proposes a split of the file. Proposed file names do not
+// conflict with files for which exists returns true.
+func proposeFileSplit(linkRes linker.Result, exists func(filename string) bool) *FileSplitProposal {
+	fileNode := linkRes.AST()
+	decls := topLevelDecls(fileNode)
+	names := make([]string, len(decls))
+	index := map[protoreflect.FullName]int{}
+	for i, decl := range decls {
+		names[i] = string(topLevelDeclNameNode(decl).AsIdentifier())
+		index[linkRes.Package().Append(protoreflect.Name(names[i]))] = i
+	}
+
+	// union the declarations containing each reference with the declarations
+	// they reference
+	parent := make([]int, len(decls))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	isService := func(i int) bool {
+		_, ok := decls[i].(*ast.ServiceNode)
+		return ok
+	}
+	declAt := func(offset int) int {
+		for i, decl := range decls {
+			info := fileNode.NodeInfo(decl)
+			if offset >= info.Start().Offset && offset < info.End().Offset {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, ref := range fileReferences(linkRes) {
+		if ref.via != linkRes.Path() {
+			continue
+		}
+		from := declAt(ref.offset)
+		to, ok := index[topLevelParent(ref.desc).FullName()]
+		if from == -1 || !ok || isService(from) || isService(to) {
+			continue
+		}
+		parent[find(from)] = find(to)
+	}
+
+	var clusters [][]int
+	clusterOf := map[int]int{}
+	var remaining []string
+	for i := range decls {
+		if isService(i) {
+			remaining = append(remaining, names[i])
+			continue
+		}
+		root := find(i)
+		if c, ok := clusterOf[root]; ok {
+			clusters[c] = append(clusters[c], i)
+		} else {
+			clusterOf[root] = len(clusters)
+			clusters = append(clusters, []int{i})
+		}
+	}
+	// the largest cluster stays in place; ties go to the earliest cluster
+	proposal := &FileSplitProposal{Groups: []FileSplitGroup{}}
+	largest := 0
+	for i, cluster := range clusters {
+		if len(cluster) > len(clusters[largest]) {
+			largest = i
+		}
+	}
+	filenames := map[string]bool{}
+	for i, cluster := range clusters {
+		if i == largest {
+			for _, j := range cluster {
+				remaining = append(remaining, names[j])
+			}
+			continue
+		}
+		filename := extractedFilename(names[cluster[0]])
+		for n := 2; filenames[filename] || exists(filename); n++ {
+			filename = fmt.Sprintf("%s_%d.proto", strings.TrimSuffix(extractedFilename(names[cluster[0]]), ".proto"), n)
+		}
+		filenames[filename] = true
+		group := FileSplitGroup{Filename: filename}
+		for _, j := range cluster {
+			group.Declarations = append(group.Declarations, names[j])
+		}
+		proposal.Groups = append(proposal.Groups, group)
+	}
+	slices.Sort(remaining)
+	proposal.Remaining = remaining
+	return proposal
+}
+
+// siblingExists returns a function which reports whether a file with the
+// given name exists in the directory of the file with the given URI.
+func (c *Cache) siblingExists(ctx context.Context, uri protocol.DocumentURI) func(filename string) bool {
+	return func(filename string) bool {
+		sibling, err := siblingURI(uri, filename)
+		return err == nil && c.fileExists(ctx, sibling)
+	}
+}
@@ -0,0 +1,118 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestSplitFile(t *testing.T) {
+	c, workspace := newTestCache(t, map[string]string{
+		"api.proto": `syntax = "proto3";
+package api;
+
+message User {
+  string name = 1;
+  Role role = 2;
+}
+
+enum Role {
+  ROLE_UNSPECIFIED = 0;
+}
+
+message GetUserRequest {
+  string name = 1;
+}
+
+message Invoice {
+  repeated LineItem items = 1;
+}
+
+message LineItem {
+  int64 amount = 1;
+}
+
+message Currency {
+  string code = 1;
+}
+
+service Users {
+  rpc GetUser(GetUserRequest) returns (User);
+}
+`,
+	}, nil)
+	uri := protocol.URIFromPath(filepath.Join(workspace, "api.proto"))
+
+	proposal, err := c.ProposeFileSplit(context.Background(), uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// services don't join clusters, so the request is in a cluster of its own
+	want := []FileSplitGroup{
+		{Filename: "get_user_request.proto", Declarations: []string{"GetUserRequest"}},
+		{Filename: "invoice.proto", Declarations: []string{"Invoice", "LineItem"}},
+		{Filename: "currency.proto", Declarations: []string{"Currency"}},
+	}
+	if !slices.EqualFunc(proposal.Groups, want, func(a, b FileSplitGroup) bool {
+		return a.Filename == b.Filename && slices.Equal(a.Declarations, b.Declarations)
+	}) {
+		t.Errorf("unexpected groups %+v", proposal.Groups)
+	}
+	if !slices.Equal(proposal.Remaining, []string{"Role", "User", "Users"}) {
+		t.Errorf("unexpected remaining declarations %v", proposal.Remaining)
+	}
+
+	edit, err := c.SplitFile(context.Background(), uri, []FileSplitGroup{
+		{Filename: "billing.proto", Declarations: []string{"Invoice", "LineItem", "Currency"}},
+		{Filename: "users.proto", Declarations: []string{"User", "Role", "GetUserRequest"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edit.Files) != 2 {
+		t.Fatalf("expected 2 new files, got %+v", edit.Files)
+	}
+	// the files are created by the client when it applies the edit
+	if _, err := os.Stat(filepath.Join(workspace, "billing.proto")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected billing.proto not to be written, got %v", err)
+	}
+	billing, users := edit.Files[0].Content, edit.Files[1].Content
+	if strings.Contains(billing, "import") || !strings.Contains(billing, "message Invoice {") || !strings.Contains(billing, "message Currency {") {
+		t.Errorf("unexpected billing.proto:\n%s", billing)
+	}
+	if strings.Contains(users, "import") || !strings.Contains(users, "enum Role {") {
+		t.Errorf("unexpected users.proto:\n%s", users)
+	}
+	// the service stays, and imports the file its types were moved to
+	changes := edit.Edit.DocumentChanges
+	if len(changes) != 1 {
+		t.Fatalf("unexpected edit %+v", edit.Edit)
+	}
+	var imports []string
+	for _, e := range protocol.AsTextEdits(changes[0].TextDocumentEdit.Edits) {
+		if e.NewText != "" {
+			imports = append(imports, e.NewText)
+		}
+	}
+	if !slices.Equal(imports, []string{"\nimport \"users.proto\";"}) {
+		t.Errorf("unexpected imports %q", imports)
+	}
+
+	preview := c.PreviewNewFilesEdit(edit, 0)
+	if len(preview.Files) != 3 || !preview.Files[2].Created {
+		t.Errorf("unexpected preview %+v", preview)
+	}
+
+	if _, err := c.SplitFile(context.Background(), uri, []FileSplitGroup{
+		{Filename: "a.proto", Declarations: []string{"User"}},
+		{Filename: "b.proto", Declarations: []string{"User"}},
+	}); err == nil {
+		t.Error("expected an error for a declaration in more than one group")
+	}
+}
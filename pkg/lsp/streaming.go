@@ -0,0 +1,109 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protols/pkg/x/protogen/strs"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// defaultStreamingMethodPattern matches method names which convey that the
+// method streams, e.g. "StreamEvents" or "WatchJobs".
+const defaultStreamingMethodPattern = `Stream|Watch|Subscribe|Tail|Follow|Listen`
+
+// lintStreamingMethodNames reports streaming methods whose names do not match
+// the configured pattern, since callers can't otherwise tell from the name
+// alone that the method streams.
+func lintStreamingMethodNames(_ context.Context, p *lintPass) {
+	pattern := p.settings.Lint.GetStreamingMethodPattern()
+	if pattern == "" {
+		return
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		slog.Warn("invalid streaming method pattern", "pattern", pattern, "error", err)
+		return
+	}
+	rangeMethods(p.result, func(md protoreflect.MethodDescriptor, rpcNode *ast.RPCNode) {
+		if !md.IsStreamingClient() && !md.IsStreamingServer() {
+			return
+		}
+		if !re.MatchString(string(md.Name())) {
+			p.report(rpcNode.Name, "%s method %s should have a name matching %q", methodStreamingKind(md), md.Name(), pattern)
+		}
+	})
+}
+
+// methodStreamingKind describes which sides of the method stream.
+func methodStreamingKind(md protoreflect.MethodDescriptor) string {
+	switch {
+	case md.IsStreamingClient() && md.IsStreamingServer():
+		return "bidirectional streaming"
+	case md.IsStreamingClient():
+		return "client streaming"
+	case md.IsStreamingServer():
+		return "server streaming"
+	default:
+		return "unary"
+	}
+}
+
+// methodHoverDetails summarizes the streaming behavior of a method along with
+// its resolved request and response types, its path on the wire, and the
+// names of the Go symbols generated for it by protoc-gen-go-grpc.
+func methodHoverDetails(md protoreflect.MethodDescriptor) string {
+	var b strings.Builder
+	kind := methodStreamingKind(md)
+	fmt.Fprintf(&b, "%s%s method\n\n", strings.ToUpper(kind[:1]), kind[1:])
+	fmt.Fprintf(&b, "- request: `%s`\n", streamingTypeName(md.Input(), md.IsStreamingClient()))
+	fmt.Fprintf(&b, "- response: `%s`\n", streamingTypeName(md.Output(), md.IsStreamingServer()))
+	fmt.Fprintf(&b, "- path: `/%s/%s`\n", md.Parent().FullName(), md.Name())
+
+	svc := GoIdent(md.Parent())
+	fmt.Fprintf(&b, "\nGenerated Go code\n\n")
+	fmt.Fprintf(&b, "- client method: `%sClient.%s`\n", svc, GoIdent(md))
+	fmt.Fprintf(&b, "- server method: `%sServer.%s`\n", svc, GoIdent(md))
+	fmt.Fprintf(&b, "- request type: `*%s`\n", goMessageTypeName(md.Input(), md.ParentFile()))
+	fmt.Fprintf(&b, "- response type: `*%s`\n", goMessageTypeName(md.Output(), md.ParentFile()))
+	return b.String()
+}
+
+// goMessageTypeName returns the name of the Go type generated for a message,
+// as referred to from code generated for the given file. Types in other Go
+// packages are qualified with their package name, if it is known.
+func goMessageTypeName(msg protoreflect.MessageDescriptor, from protoreflect.FileDescriptor) string {
+	name := GoIdent(msg)
+	pkgPath, pkgName := goPackageOption(msg.ParentFile())
+	if fromPath, _ := goPackageOption(from); pkgName == "" || pkgPath == fromPath {
+		return name
+	}
+	return pkgName + "." + name
+}
+
+// goPackageOption returns the import path and package name declared by the
+// go_package option of a file, if it has one.
+func goPackageOption(fd protoreflect.FileDescriptor) (pkgPath, pkgName string) {
+	opts, ok := fd.Options().(*descriptorpb.FileOptions)
+	if !ok || opts.GetGoPackage() == "" {
+		return "", ""
+	}
+	pkgPath, pkgName, ok = strings.Cut(opts.GetGoPackage(), ";")
+	if !ok {
+		pkgName = path.Base(pkgPath)
+	}
+	return pkgPath, strs.GoSanitized(pkgName)
+}
+
+func streamingTypeName(msg protoreflect.MessageDescriptor, stream bool) string {
+	if stream {
+		return fmt.Sprintf("stream message %s", msg.FullName())
+	}
+	return fmt.Sprintf("message %s", msg.FullName())
+}
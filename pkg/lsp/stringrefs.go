@@ -0,0 +1,221 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/ast/paths"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protopath"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// A stringReferenceResolver resolves the descriptor named by the value of a
+// string option field. Names are resolved relative to the given scope, which
+// is the package of the file containing the option.
+type stringReferenceResolver func(c *Cache, scope protoreflect.FullName, value string) protoreflect.Descriptor
+
+// stringReferenceResolvers contains the kinds of references that can be
+// assigned to option fields, either by builtinStringReferences or by the
+// "stringReferences" setting.
+var stringReferenceResolvers = map[string]stringReferenceResolver{
+	"type":      resolveTypeReference,
+	"method":    resolveMethodReference,
+	"resource":  resolveResourceReference,
+	"extension": resolveExtensionReference,
+}
+
+// builtinStringReferences maps well-known option fields to the kind of
+// reference their string values contain.
+var builtinStringReferences = map[protoreflect.FullName]string{
+	"google.api.HttpRule.selector":                                "method",
+	"google.api.ResourceReference.type":                           "resource",
+	"google.api.ResourceReference.child_type":                     "resource",
+	"google.longrunning.OperationInfo.response_type":              "type",
+	"google.longrunning.OperationInfo.metadata_type":              "type",
+	"google.protobuf.ExtensionRangeOptions.Declaration.full_name": "extension",
+	"google.protobuf.ExtensionRangeOptions.Declaration.type":      "type",
+}
+
+// resolveTypeReference resolves a message or enum name, which may be fully
+// qualified (with or without a leading dot), relative to the scope, or a type
+// URL as used in google.protobuf.Any.
+func resolveTypeReference(c *Cache, scope protoreflect.FullName, value string) protoreflect.Descriptor {
+	if _, name, ok := cutLast(value, "/"); ok {
+		value = name
+	}
+	return resolveRelativeName(c, scope, value, func(d protoreflect.Descriptor) bool {
+		switch d.(type) {
+		case protoreflect.MessageDescriptor, protoreflect.EnumDescriptor:
+			return true
+		}
+		return false
+	})
+}
+
+// resolveMethodReference resolves a method name in either the
+// "pkg.Service.Method" or "/pkg.Service/Method" form.
+func resolveMethodReference(c *Cache, scope protoreflect.FullName, value string) protoreflect.Descriptor {
+	if strings.HasPrefix(value, "/") {
+		value = "." + strings.ReplaceAll(value[1:], "/", ".")
+	}
+	return resolveRelativeName(c, scope, value, func(d protoreflect.Descriptor) bool {
+		_, ok := d.(protoreflect.MethodDescriptor)
+		return ok
+	})
+}
+
+type descriptorFinder interface {
+	FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error)
+}
+
+// resolveRelativeName follows the protobuf scoping rules to find a descriptor
+// by name using the given resolver. Names with a leading dot are fully
+// qualified; otherwise the scope and each of its parents are searched,
+// innermost first.
+func resolveRelativeName(resolver descriptorFinder, scope protoreflect.FullName, name string, filter func(protoreflect.Descriptor) bool) protoreflect.Descriptor {
+	if name == "" {
+		return nil
+	}
+	find := func(fqn protoreflect.FullName) protoreflect.Descriptor {
+		if !fqn.IsValid() {
+			return nil
+		}
+		if d, err := resolver.FindDescriptorByName(fqn); err == nil && filter(d) {
+			return d
+		}
+		return nil
+	}
+	if strings.HasPrefix(name, ".") {
+		return find(protoreflect.FullName(name[1:]))
+	}
+	for {
+		if scope == "" {
+			return find(protoreflect.FullName(name))
+		}
+		if d := find(protoreflect.FullName(string(scope) + "." + name)); d != nil {
+			return d
+		}
+		scope = scope.Parent()
+	}
+}
+
+// stringReferenceKind returns the kind of reference contained in the string
+// values of the given field, if any. User settings take precedence over the
+// builtin mappings.
+func (c *Cache) stringReferenceKind(field protoreflect.FieldDescriptor) (string, bool) {
+	if field.Kind() != protoreflect.StringKind {
+		return "", false
+	}
+	if kind, ok := c.settings.Load().StringReferences[string(field.FullName())]; ok {
+		return kind, kind != ""
+	}
+	kind, ok := builtinStringReferences[field.FullName()]
+	return kind, ok
+}
+
+// FindStringReferenceAtLocation resolves the descriptor named by a string
+// literal option value at the given location, if the option field is known to
+// contain references. Returns a nil descriptor if the location is not within
+// such a string literal.
+func (c *Cache) FindStringReferenceAtLocation(ctx context.Context, snapshot *Snapshot, params protocol.TextDocumentPositionParams) (protoreflect.Descriptor, protocol.Range, error) {
+	linkRes, err := snapshot.FindResultOrPartialResultByURI(params.TextDocument.URI)
+	if err != nil {
+		return nil, protocol.Range{}, err
+	}
+	mapper, err := c.GetMapper(params.TextDocument.URI)
+	if err != nil {
+		return nil, protocol.Range{}, err
+	}
+	offset, err := mapper.PositionOffset(params.Position)
+	if err != nil {
+		return nil, protocol.Range{}, err
+	}
+	fileNode := linkRes.AST()
+	token, comment := fileNode.ItemAtOffset(offset)
+	if token == ast.TokenError || comment.IsValid() {
+		return nil, protocol.Range{}, nil
+	}
+
+	var strNode ast.Node
+	var value string
+	var path protopath.Values
+	tracker := &paths.AncestorTracker{}
+	ast.Inspect(fileNode, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.CompoundStringLiteralNode:
+			strNode, value = node, node.AsString()
+		case *ast.StringLiteralNode:
+			strNode, value = node, node.AsString()
+		}
+		if strNode != nil {
+			path = tracker.Values()
+			return false
+		}
+		return true
+	}, append(tracker.AsWalkOptions(), ast.WithIntersection(token))...)
+	if strNode == nil {
+		return nil, protocol.Range{}, nil
+	}
+
+	if fp, ok := c.fieldPathValueAt(ctx, linkRes, c, c.settings.Load(), path, strNode, value); ok {
+		// field paths refer to the field named by each segment
+		if fp.offset < 0 {
+			return nil, protocol.Range{}, nil
+		}
+		for _, seg := range fp.segments() {
+			if seg.field != nil && offset >= fp.offset+seg.start && offset <= fp.offset+seg.end {
+				return seg.field, toRange(fp.span(fileNode, seg)), nil
+			}
+		}
+		return nil, protocol.Range{}, nil
+	}
+	field := c.findStringValueField(ctx, linkRes, path)
+	if field == nil {
+		return nil, protocol.Range{}, nil
+	}
+	kind, ok := c.stringReferenceKind(field)
+	if !ok {
+		return nil, protocol.Range{}, nil
+	}
+	resolve, ok := stringReferenceResolvers[kind]
+	if !ok {
+		return nil, protocol.Range{}, nil
+	}
+	desc := resolve(c, linkRes.Package(), value)
+	if desc == nil {
+		return nil, protocol.Range{}, nil
+	}
+	return desc, toRange(fileNode.NodeInfo(strNode)), nil
+}
+
+// findStringValueField returns the field that the value at the end of the
+// path is assigned to, which is either a field in a message literal or the
+// option itself.
+func (c *Cache) findStringValueField(ctx context.Context, linkRes linker.Result, path protopath.Values) protoreflect.FieldDescriptor {
+	for i := len(path.Path) - 1; i >= 0; i-- {
+		if _, ok := path.Index(i).Value.Interface().(protoreflect.Message); !ok {
+			// lists of nodes, such as the components of a compound string
+			continue
+		}
+		if paths.NodeAt[*ast.MessageFieldNode](path.Index(i)) != nil {
+			desc, _, err := c.deepPathSearch(ctx, path.Path[:i+1], linkRes, linkRes)
+			if err != nil {
+				return nil
+			}
+			fd, _ := desc.(protoreflect.FieldDescriptor)
+			return fd
+		}
+		if optionNode := paths.NodeAt[*ast.OptionNode](path.Index(i)); optionNode != nil {
+			opt, ok := linkRes.Descriptor(optionNode).(*descriptorpb.UninterpretedOption)
+			if !ok {
+				return nil
+			}
+			return linkRes.FindOptionFieldDescriptor(opt)
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"slices"
 
 	"github.com/kralicky/protocompile/ast"
 	"github.com/kralicky/protocompile/parser"
@@ -13,14 +14,10 @@ import (
 	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-func (c *Cache) DocumentSymbolsForFile(uri protocol.DocumentURI) ([]protocol.DocumentSymbol, error) {
-	c.resultsMu.RLock()
-	defer c.resultsMu.RUnlock()
-	return c.documentSymbolsForFileLocked(uri)
-}
-
-func (c *Cache) documentSymbolsForFileLocked(uri protocol.DocumentURI) ([]protocol.DocumentSymbol, error) {
-	f, err := c.FindResultByURI(uri)
+func (c *Cache) DocumentSymbolsForFile(snapshot *Snapshot, uri protocol.DocumentURI) ([]protocol.DocumentSymbol, error) {
+	// symbols only require the AST, so they can still be computed for files
+	// which contain syntax errors or failed to link.
+	f, err := snapshot.FindParseResultByURI(uri)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +44,38 @@ func (c *Cache) documentSymbolsForFileLocked(uri protocol.DocumentURI) ([]protoc
 	return symbols, nil
 }
 
+// flattenDocumentSymbols converts a symbol hierarchy into a flat list for
+// clients which do not support hierarchical document symbols. The container
+// name of each symbol is the dot-separated chain of its enclosing symbols.
+func flattenDocumentSymbols(uri protocol.DocumentURI, symbols []protocol.DocumentSymbol, containerName string) []protocol.SymbolInformation {
+	var flat []protocol.SymbolInformation
+	for _, sym := range symbols {
+		flat = append(flat, protocol.SymbolInformation{
+			Name:       sym.Name,
+			Kind:       sym.Kind,
+			Tags:       sym.Tags,
+			Deprecated: sym.Deprecated,
+			Location: protocol.Location{
+				URI:   uri,
+				Range: sym.Range,
+			},
+			ContainerName: containerName,
+		})
+		if len(sym.Children) > 0 {
+			childContainer := sym.Name
+			if containerName != "" {
+				childContainer = containerName + "." + sym.Name
+			}
+			flat = append(flat, flattenDocumentSymbols(uri, sym.Children, childContainer)...)
+		}
+	}
+	return flat
+}
+
 func (c *Cache) QueryWorkspaceSymbols(ctx context.Context, query string) []protocol.SymbolInformation {
+	if query != "" && c.pending.len() > 0 {
+		c.compilePendingContaining(ctx, query, true)
+	}
 	c.resultsMu.RLock()
 	defer c.resultsMu.RUnlock()
 
@@ -59,7 +87,7 @@ func (c *Cache) QueryWorkspaceSymbols(ctx context.Context, query string) []proto
 		if err != nil {
 			return protocol.SymbolInformation{}, false
 		}
-		res, err := c.FindResultByURI(uri)
+		res, err := c.FindResultOrPartialResultByURI(uri)
 		if err != nil {
 			return protocol.SymbolInformation{}, false
 		}
@@ -103,12 +131,29 @@ func (c *Cache) QueryWorkspaceSymbols(ctx context.Context, query string) []proto
 	}
 	select {
 	case <-done:
-		return store.Results()
+		return sortEqualSymbols(store.Results())
 	case <-ctx.Done():
 		return nil
 	}
 }
 
+// sortEqualSymbols orders symbols with the same name, such as duplicate
+// definitions in different files, by location. Results are otherwise ordered
+// by score, so symbols with the same name are always adjacent.
+func sortEqualSymbols(symbols []protocol.SymbolInformation) []protocol.SymbolInformation {
+	for start := 0; start < len(symbols); {
+		end := start + 1
+		for end < len(symbols) && symbols[end].Name == symbols[start].Name {
+			end++
+		}
+		slices.SortFunc(symbols[start:end], func(a, b protocol.SymbolInformation) int {
+			return protocol.CompareLocation(a.Location, b.Location)
+		})
+		start = end
+	}
+	return symbols
+}
+
 func toSymbolInformation(uri protocol.DocumentURI, res parser.Result, desc protoreflect.Descriptor) (protocol.SymbolInformation, bool) {
 	if wrapper, ok := desc.(protoutil.DescriptorProtoWrapper); ok {
 		descpb := wrapper.AsProto()
@@ -154,6 +199,9 @@ func symbolKind(desc protoreflect.Descriptor) protocol.SymbolKind {
 
 func messageSymbols(fn *ast.FileNode, node *ast.MessageNode) []protocol.DocumentSymbol {
 	symbols := []protocol.DocumentSymbol{}
+	if node.Name == nil {
+		return symbols
+	}
 	sym := protocol.DocumentSymbol{
 		Name:           string(node.Name.AsIdentifier()),
 		Kind:           protocol.Class,
@@ -163,7 +211,7 @@ func messageSymbols(fn *ast.FileNode, node *ast.MessageNode) []protocol.Document
 	for _, decl := range node.Decls {
 		switch node := decl.Unwrap().(type) {
 		case *ast.FieldNode:
-			if node.IsIncomplete() {
+			if node.IsIncomplete() || node.Name == nil || node.FieldType == nil {
 				continue
 			}
 			sym.Children = append(sym.Children, protocol.DocumentSymbol{
@@ -174,6 +222,9 @@ func messageSymbols(fn *ast.FileNode, node *ast.MessageNode) []protocol.Document
 				SelectionRange: toRange(fn.NodeInfo(node.Name)),
 			})
 		case *ast.MapFieldNode:
+			if node.Name == nil || node.MapType == nil || node.MapType.KeyType == nil || node.MapType.ValueType == nil {
+				continue
+			}
 			sym.Children = append(sym.Children, protocol.DocumentSymbol{
 				Name:           string(node.Name.AsIdentifier()),
 				Detail:         fmt.Sprintf("map<%s, %s>", string(node.KeyField().GetName().AsIdentifier()), string(node.ValueField().GetName().AsIdentifier())),
@@ -194,6 +245,9 @@ func messageSymbols(fn *ast.FileNode, node *ast.MessageNode) []protocol.Document
 }
 
 func enumSymbols(fn *ast.FileNode, node *ast.EnumNode) []protocol.DocumentSymbol {
+	if node.Name == nil {
+		return nil
+	}
 	sym := protocol.DocumentSymbol{
 		Name:           string(node.Name.AsIdentifier()),
 		Kind:           protocol.Enum,
@@ -203,6 +257,9 @@ func enumSymbols(fn *ast.FileNode, node *ast.EnumNode) []protocol.DocumentSymbol
 	for _, decl := range node.Decls {
 		switch node := decl.Unwrap().(type) {
 		case *ast.EnumValueNode:
+			if node.Name == nil {
+				continue
+			}
 			sym.Children = append(sym.Children, protocol.DocumentSymbol{
 				Name:           string(node.Name.AsIdentifier()),
 				Kind:           protocol.EnumMember,
@@ -219,7 +276,7 @@ func extendSymbols(fn *ast.FileNode, node *ast.ExtendNode) []protocol.DocumentSy
 	for _, decl := range node.Decls {
 		switch decl := decl.Unwrap().(type) {
 		case *ast.FieldNode:
-			if decl.IsIncomplete() {
+			if decl.IsIncomplete() || decl.Name == nil || decl.FieldType == nil || node.Extendee == nil {
 				continue
 			}
 			symbols = append(symbols, protocol.DocumentSymbol{
@@ -235,6 +292,9 @@ func extendSymbols(fn *ast.FileNode, node *ast.ExtendNode) []protocol.DocumentSy
 }
 
 func serviceSymbols(fn *ast.FileNode, node *ast.ServiceNode) []protocol.DocumentSymbol {
+	if node.Name == nil {
+		return nil
+	}
 	service := protocol.DocumentSymbol{
 		Name:           string(node.Name.AsIdentifier()),
 		Kind:           protocol.Interface,
@@ -244,8 +304,13 @@ func serviceSymbols(fn *ast.FileNode, node *ast.ServiceNode) []protocol.Document
 	for _, decl := range node.Decls {
 		switch node := decl.Unwrap().(type) {
 		case *ast.RPCNode:
+			if node.Name == nil {
+				continue
+			}
 			var detail string
 			switch {
+			case node.Input == nil || node.Output == nil:
+				// incomplete
 			case node.Input.Stream != nil && node.Output.Stream != nil:
 				detail = "stream (bidirectional)"
 			case node.Input.Stream != nil:
@@ -0,0 +1,128 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/kralicky/protols/pkg/format"
+	"github.com/kralicky/protols/pkg/format/protoprint"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// SyntheticFileSettings configures how synthetic files are printed. Synthetic
+// files are regenerated when these settings change.
+type SyntheticFileSettings struct {
+	// Which comments to include: "all" (the default), "doc" for only the
+	// leading comments of declarations, or "none". Comments are only available
+	// for descriptors which include source code info.
+	Comments string `mapstructure:"comments"`
+	// The order of declarations: "number" (the default) orders fields,
+	// extensions and enum values by number and leaves other declarations in
+	// the order they appear in the descriptor, "canonical" sorts all
+	// declarations by kind and then by name or number, and "none" keeps the
+	// order of the descriptor.
+	Sort string `mapstructure:"sort"`
+	// The spacing between declarations: "default", "compact" to omit blank
+	// lines between all declarations, options and comments, or "expanded" to
+	// separate every declaration with a blank line.
+	Layout string `mapstructure:"layout"`
+}
+
+// printer returns a printer for synthetic files with these settings.
+func (s SyntheticFileSettings) printer() *protoprint.Printer {
+	printer := format.NewDefaultPrinter()
+	switch s.Comments {
+	case "doc":
+		printer.OmitComments = protoprint.CommentsNonDoc
+	case "none":
+		printer.OmitComments = protoprint.CommentsAll
+	}
+	switch s.Sort {
+	case "canonical":
+		printer.CustomSortFunction = nil
+		printer.SortElements = true
+	case "none":
+		printer.CustomSortFunction = nil
+	}
+	switch s.Layout {
+	case "compact":
+		printer.Compact = protoprint.CompactAll
+	case "expanded":
+		printer.Compact = 0
+	}
+	return printer
+}
+
+// SetSyntheticFileSettings changes how synthetic files are printed, and
+// reports whether the settings changed. Existing synthetic files are not
+// regenerated until regenerateSyntheticFilesLocked is called.
+func (r *Resolver) SetSyntheticFileSettings(settings SyntheticFileSettings) bool {
+	r.pathsMu.Lock()
+	defer r.pathsMu.Unlock()
+	if r.syntheticFileSettings == settings {
+		return false
+	}
+	r.syntheticFileSettings = settings
+	return true
+}
+
+// printSyntheticFileLocked prints the source of the synthetic file with the
+// given URI, and records the descriptor it was printed from so that it can be
+// printed again if the settings change.
+func (r *Resolver) printSyntheticFileLocked(uri protocol.DocumentURI, fd protoreflect.FileDescriptor) (string, error) {
+	var src bytes.Buffer
+	if err := format.PrintAndFormatFileDescriptorWithPrinter(fd, r.syntheticFileSettings.printer(), &src); err != nil {
+		return "", err
+	}
+	r.syntheticDescriptors[uri] = fd
+	return src.String(), nil
+}
+
+// regenerateSyntheticFilesLocked prints all synthetic files again with the
+// current settings, and returns the URIs of the files whose source changed.
+func (r *Resolver) regenerateSyntheticFilesLocked() []protocol.DocumentURI {
+	var changed []protocol.DocumentURI
+	for _, uri := range slices.Sorted(maps.Keys(r.syntheticDescriptors)) {
+		src, err := r.printSyntheticFileLocked(uri, r.syntheticDescriptors[uri])
+		if err != nil {
+			slog.With(
+				"uri", string(uri),
+				"error", err,
+			).Error("failed to regenerate synthetic file source")
+			continue
+		}
+		if src == r.syntheticFiles[uri] {
+			continue
+		}
+		r.syntheticFiles[uri] = src
+		changed = append(changed, uri)
+	}
+	return changed
+}
+
+// regenerateSyntheticFiles prints all synthetic files again after their
+// settings have changed, and recompiles those whose source changed along with
+// the files which import them. Clients are asked to refresh the changed files.
+func (c *Cache) regenerateSyntheticFiles(ctx context.Context) {
+	c.resolver.pathsMu.Lock()
+	changed := c.resolver.regenerateSyntheticFilesLocked()
+	var paths []string
+	for _, uri := range changed {
+		if path, ok := c.resolver.filePathsByURI[uri]; ok {
+			paths = append(paths, path)
+		}
+	}
+	c.resolver.pathsMu.Unlock()
+	if len(changed) == 0 {
+		return
+	}
+	slog.Info("synthetic file settings changed, regenerating synthetic files", "files", len(changed))
+	c.Compile(ctx, paths, c.diagHandler.Flush)
+	if c.onSyntheticFilesChanged != nil {
+		c.onSyntheticFilesChanged(ctx, changed)
+	}
+}
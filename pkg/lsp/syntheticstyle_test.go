@@ -0,0 +1,88 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/protols/pkg/format"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestSyntheticFileSettings(t *testing.T) {
+	c, workspace := newTestCache(t, map[string]string{
+		"a.proto": `syntax = "proto3";
+package a;
+import "google/protobuf/type.proto";
+// A has a comment.
+message A {
+  google.protobuf.Type t = 1; // trailing
+}
+`,
+	}, nil)
+	aURI := protocol.URIFromPath(filepath.Join(workspace, "a.proto"))
+	uri, err := c.resolver.PathToURI("google/protobuf/type.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := func(settings SyntheticFileSettings) string {
+		t.Helper()
+		if err := c.DidChangeConfiguration(context.Background(), Settings{SyntheticFiles: settings}); err != nil {
+			t.Fatal(err)
+		}
+		src, err := c.GetSyntheticFileContents(context.Background(), uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return src
+	}
+
+	src := contents(SyntheticFileSettings{})
+	if strings.Index(src, "message Type ") > strings.Index(src, "message Enum ") {
+		t.Errorf("expected declarations in descriptor order:\n%s", src)
+	}
+	src = contents(SyntheticFileSettings{Sort: "canonical"})
+	if strings.Index(src, "message Type ") < strings.Index(src, "message Enum ") {
+		t.Errorf("expected declarations in canonical order:\n%s", src)
+	}
+	if !strings.Contains(contents(SyntheticFileSettings{Layout: "expanded"}), "string name = 1;\n\n") {
+		t.Error("expected blank lines between fields")
+	}
+
+	// the regenerated file is compiled again, and its importers still link
+	fd, err := c.FindFileByURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fd.Messages().ByName("Type") == nil {
+		t.Error("regenerated file was not compiled")
+	}
+	all, err := c.XGetAllDiagnostics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all[aURI]) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", all[aURI])
+	}
+
+	a, err := c.FindFileByURI(aURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for comments, want := range map[string][]bool{
+		"":     {true, true},
+		"doc":  {true, false},
+		"none": {false, false},
+	} {
+		var buf bytes.Buffer
+		if err := format.PrintAndFormatFileDescriptorWithPrinter(a, SyntheticFileSettings{Comments: comments}.printer(), &buf); err != nil {
+			t.Fatal(err)
+		}
+		got := []bool{strings.Contains(buf.String(), "A has a comment"), strings.Contains(buf.String(), "trailing")}
+		if got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("comments %q: got (leading, trailing) %v, want %v:\n%s", comments, got, want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package lsp
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// Synthetic files are served to clients with the workspace/textDocumentContent
+// request added in LSP 3.18, so that editors can open proto:// URIs without
+// client-specific support for the protols/syntheticFileContents command. The
+// protocol package predates 3.18, so the types are defined here.
+const (
+	TextDocumentContentMethod        = "workspace/textDocumentContent"
+	TextDocumentContentRefreshMethod = "workspace/textDocumentContent/refresh"
+)
+
+// TextDocumentContentOptions is the value of the
+// workspace.textDocumentContent server capability.
+type TextDocumentContentOptions struct {
+	// The schemes of the URIs the server provides content for.
+	Schemes []string `json:"schemes"`
+}
+
+type TextDocumentContentParams struct {
+	URI protocol.DocumentURI `json:"uri"`
+}
+
+type TextDocumentContentResult struct {
+	Text string `json:"text"`
+}
+
+type TextDocumentContentRefreshParams struct {
+	URI protocol.DocumentURI `json:"uri"`
+}
+
+// TextDocumentContentCapability returns the options to advertise in the
+// workspace.textDocumentContent server capability.
+func (s *Server) TextDocumentContentCapability() TextDocumentContentOptions {
+	return TextDocumentContentOptions{
+		Schemes: []string{"proto"},
+	}
+}
+
+// TextDocumentContent returns the contents of a synthetic file.
+func (s *Server) TextDocumentContent(ctx context.Context, params *TextDocumentContentParams) (*TextDocumentContentResult, error) {
+	c, err := s.CacheForURI(params.URI)
+	if err != nil {
+		return nil, err
+	}
+	text, err := c.GetSyntheticFileContents(ctx, params.URI)
+	if err != nil {
+		return nil, err
+	}
+	return &TextDocumentContentResult{Text: text}, nil
+}
+
+// WithSyntheticFilesChangedFunc sets a function which is called with the URIs
+// of synthetic files whose contents changed after they were first generated.
+func WithSyntheticFilesChangedFunc(fn func(ctx context.Context, uris []protocol.DocumentURI)) CacheOption {
+	return func(o *CacheOptions) {
+		o.onSyntheticFilesChanged = fn
+	}
+}
+
+// refreshTextDocumentContent asks the client to request the contents of the
+// given synthetic files again.
+func (s *Server) refreshTextDocumentContent(ctx context.Context, uris []protocol.DocumentURI) {
+	if s.call == nil {
+		return
+	}
+	for _, uri := range uris {
+		if err := s.call(ctx, TextDocumentContentRefreshMethod, TextDocumentContentRefreshParams{URI: uri}, nil); err != nil {
+			slog.Debug("failed to refresh text document content", "uri", uri, "error", err)
+		}
+	}
+}
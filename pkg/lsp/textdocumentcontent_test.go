@@ -0,0 +1,63 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestTextDocumentContent(t *testing.T) {
+	workspace := t.TempDir()
+	writeFiles(t, workspace, map[string]string{
+		"a.proto": `syntax = "proto3";
+package a;
+import "google/protobuf/type.proto";
+message A {
+  google.protobuf.Type t = 1;
+}
+`,
+	})
+	var refreshed []protocol.DocumentURI
+	c := NewCache(protocol.WorkspaceFolder{URI: string(protocol.URIFromPath(workspace))},
+		WithSandboxedCache(),
+		WithSyntheticFilesChangedFunc(func(_ context.Context, uris []protocol.DocumentURI) {
+			refreshed = append(refreshed, uris...)
+		}),
+	)
+	defer c.Close(nil)
+	c.LoadFiles([]string{filepath.Join(workspace, "a.proto")})
+	s := &Server{caches: map[string]*Cache{workspace: c}}
+
+	uri, err := c.resolver.PathToURI("google/protobuf/type.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.TextDocumentContent(context.Background(), &TextDocumentContentParams{URI: uri})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Text, "message Type ") {
+		t.Errorf("unexpected contents:\n%s", result.Text)
+	}
+	if len(refreshed) != 0 {
+		t.Errorf("unexpected refresh before settings changed: %v", refreshed)
+	}
+
+	if err := c.DidChangeConfiguration(context.Background(), Settings{SyntheticFiles: SyntheticFileSettings{Sort: "canonical"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(refreshed, uri) {
+		t.Errorf("expected %s to be refreshed, got %v", uri, refreshed)
+	}
+	updated, err := s.TextDocumentContent(context.Background(), &TextDocumentContentParams{URI: uri})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Text == result.Text {
+		t.Error("contents did not change after settings changed")
+	}
+}
@@ -0,0 +1,115 @@
+package lsp
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protocompile/parser"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// semanticTokenIndex holds the semantic tokens of a document bucketed by line,
+// so that the tokens at a position can be found without walking the AST or
+// scanning every token in the document. It is valid for as long as the parse
+// and link results it was built from are current.
+type semanticTokenIndex struct {
+	parseRes parser.Result
+	linkRes  linker.Result
+
+	// sorted by line, then by start. Tokens spanning multiple lines appear
+	// once for each line they cover.
+	items []semanticItem
+	// the tokens on line i are items[lines[i]:lines[i+1]]
+	lines []int
+}
+
+// restOfLine is the length of a token which continues onto the next line.
+const restOfLine = math.MaxUint32 >> 1
+
+func newSemanticTokenIndex(parseRes parser.Result, linkRes linker.Result, items []semanticItem) *semanticTokenIndex {
+	if slices.ContainsFunc(items, isMultilineToken) {
+		items = splitMultilineTokens(items)
+	}
+	var numLines int
+	if len(items) > 0 {
+		numLines = int(items[len(items)-1].line) + 1
+	}
+	lines := make([]int, numLines+1)
+	i := 0
+	for line := range numLines {
+		lines[line] = i
+		for i < len(items) && int(items[i].line) == line {
+			i++
+		}
+	}
+	lines[numLines] = len(items)
+	return &semanticTokenIndex{
+		parseRes: parseRes,
+		linkRes:  linkRes,
+		items:    items,
+		lines:    lines,
+	}
+}
+
+func isMultilineToken(item semanticItem) bool {
+	return item.endLine > item.line
+}
+
+// splitMultilineTokens returns a copy of items in which each token spanning
+// multiple lines is replaced with one token for each line it covers.
+func splitMultilineTokens(items []semanticItem) []semanticItem {
+	split := make([]semanticItem, 0, len(items))
+	for _, item := range items {
+		if !isMultilineToken(item) {
+			split = append(split, item)
+			continue
+		}
+		for line := item.line; line <= item.endLine; line++ {
+			part := item
+			part.line = line
+			switch line {
+			case item.line:
+				part.len = restOfLine
+			case item.endLine:
+				part.start, part.len = 0, item.endCol
+			default:
+				part.start, part.len = 0, restOfLine
+			}
+			split = append(split, part)
+		}
+	}
+	slices.SortStableFunc(split, func(a, b semanticItem) int {
+		return cmp.Or(cmp.Compare(a.line, b.line), cmp.Compare(a.start, b.start))
+	})
+	return split
+}
+
+// line returns the tokens on the given line, sorted by start position.
+func (x *semanticTokenIndex) line(line uint32) []semanticItem {
+	if int(line)+1 >= len(x.lines) {
+		return nil
+	}
+	return x.items[x.lines[line]:x.lines[line+1]]
+}
+
+// semanticTokenIndex returns the semantic token index of the document,
+// computing it if the document has been parsed or linked again since the index
+// was last built. Comments are not included.
+func (c *Cache) semanticTokenIndex(uri protocol.DocumentURI, parseRes parser.Result, linkRes linker.Result) *semanticTokenIndex {
+	if x, ok := c.tokenIndexes.Load(uri); ok && x.parseRes == parseRes && x.linkRes == linkRes {
+		return x
+	}
+	enc := semanticItems{
+		options: semanticItemsOptions{
+			skipComments: true,
+		},
+		parseRes:     parseRes,
+		maybeLinkRes: linkRes,
+	}
+	computeSemanticTokens(c, &enc)
+	x := newSemanticTokenIndex(parseRes, linkRes, enc.items)
+	c.tokenIndexes.Store(uri, x)
+	return x
+}
@@ -0,0 +1,96 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// StaleDocumentError is returned when edits would be computed from a version
+// of a document older than the one last sent by the client, which would
+// produce misplaced edits if they were applied.
+type StaleDocumentError struct {
+	URI            protocol.DocumentURI
+	Version        int32
+	CurrentVersion int32
+}
+
+func (e *StaleDocumentError) Error() string {
+	return fmt.Sprintf("%s has changed since the edit was computed (version %d, current version %d); try again",
+		e.URI.Path(), e.Version, e.CurrentVersion)
+}
+
+// documentVersion returns the version of the document last sent by the
+// client, or 0 if the document is not open.
+func (c *Cache) documentVersion(ctx context.Context, uri protocol.DocumentURI) int32 {
+	fh, err := c.compiler.fs.ReadFile(ctx, uri)
+	if err != nil {
+		return 0
+	}
+	return fh.Version()
+}
+
+// checkDocumentVersion returns a StaleDocumentError if the document has
+// changed since the given version.
+func (c *Cache) checkDocumentVersion(ctx context.Context, uri protocol.DocumentURI, version int32) error {
+	if current := c.documentVersion(ctx, uri); current != version {
+		return &StaleDocumentError{URI: uri, Version: version, CurrentVersion: current}
+	}
+	return nil
+}
+
+// compiledDocumentVersionLocked returns the version of the document which the
+// latest result for it was compiled from.
+func (c *Cache) compiledDocumentVersionLocked(uri protocol.DocumentURI) (int32, error) {
+	path, err := c.resolver.URIToPath(uri)
+	if err != nil {
+		return 0, err
+	}
+	res, err := c.findResultOrPartialResultByPathLocked(path)
+	if err != nil {
+		return 0, err
+	}
+	return res.AST().Version(), nil
+}
+
+// checkCompiledDocumentVersionLocked returns a StaleDocumentError if the
+// document has changed since its latest result was compiled.
+func (c *Cache) checkCompiledDocumentVersionLocked(ctx context.Context, uri protocol.DocumentURI) error {
+	version, err := c.compiledDocumentVersionLocked(uri)
+	if err != nil {
+		return err
+	}
+	return c.checkDocumentVersion(ctx, uri, version)
+}
+
+// versionedWorkspaceEdit is like versionedWorkspaceEditLocked, but acquires
+// the results lock.
+func (c *Cache) versionedWorkspaceEdit(ctx context.Context, changes map[protocol.DocumentURI][]protocol.TextEdit) (*protocol.WorkspaceEdit, error) {
+	c.resultsMu.RLock()
+	defer c.resultsMu.RUnlock()
+	return c.versionedWorkspaceEditLocked(ctx, changes)
+}
+
+// versionedWorkspaceEditLocked returns a workspace edit containing the given
+// text edits, where each document is identified by the version its edits were
+// computed from. Returns a StaleDocumentError if any document has changed
+// since then, so the client never applies edits to the wrong version.
+func (c *Cache) versionedWorkspaceEditLocked(ctx context.Context, changes map[protocol.DocumentURI][]protocol.TextEdit) (*protocol.WorkspaceEdit, error) {
+	edit := &protocol.WorkspaceEdit{
+		DocumentChanges: []protocol.DocumentChanges{},
+	}
+	for _, uri := range slices.Sorted(maps.Keys(changes)) {
+		version, err := c.compiledDocumentVersionLocked(uri)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.checkDocumentVersion(ctx, uri, version); err != nil {
+			return nil, err
+		}
+		edit.DocumentChanges = append(edit.DocumentChanges, protocol.TextEditsToDocumentChanges(uri, version, changes[uri])...)
+	}
+	return edit, nil
+}
@@ -0,0 +1,78 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestRenameDocumentVersions(t *testing.T) {
+	const a = `syntax = "proto3";
+package ui;
+message Size {
+  int32 width = 1;
+}
+`
+	c, workspace := newTestCache(t, map[string]string{
+		"a.proto": a,
+		"b.proto": `syntax = "proto3";
+package ui;
+import "a.proto";
+message Button {
+  Size size = 1;
+}
+`,
+	}, nil)
+	ctx := context.Background()
+	aURI := protocol.URIFromPath(filepath.Join(workspace, "a.proto"))
+	bURI := protocol.URIFromPath(filepath.Join(workspace, "b.proto"))
+	c.DidModifyFiles(ctx, []file.Modification{{
+		URI:        aURI,
+		Action:     file.Open,
+		Version:    4,
+		Text:       []byte(a),
+		LanguageID: "protobuf",
+	}})
+
+	params := &protocol.RenameParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: aURI},
+		Position:     protocol.Position{Line: 2, Character: 9},
+		NewName:      "Dimensions",
+	}
+	edit, err := c.Rename(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edit.Changes) != 0 || len(edit.DocumentChanges) != 2 {
+		t.Fatalf("expected versioned document changes, got %+v", edit)
+	}
+	versions := map[protocol.DocumentURI]int32{}
+	for _, change := range edit.DocumentChanges {
+		versions[change.TextDocumentEdit.TextDocument.URI] = change.TextDocumentEdit.TextDocument.Version
+	}
+	if versions[aURI] != 4 || versions[bURI] != 0 {
+		t.Errorf("unexpected document versions %v", versions)
+	}
+
+	// simulate an edit which has not been compiled yet
+	if err := c.compiler.fs.UpdateOverlays(ctx, []file.Modification{{
+		URI:     aURI,
+		Action:  file.Change,
+		Version: 5,
+		Text:    []byte(a + "\n"),
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Rename(ctx, params)
+	var stale *StaleDocumentError
+	if !errors.As(err, &stale) {
+		t.Fatalf("expected a stale document error, got %v", err)
+	}
+	if stale.URI != aURI || stale.Version != 4 || stale.CurrentVersion != 5 {
+		t.Errorf("unexpected error %+v", stale)
+	}
+}
@@ -2,6 +2,7 @@ package lsp
 
 import (
 	"context"
+	"maps"
 	"sync"
 
 	"github.com/kralicky/tools-lite/gopls/pkg/file"
@@ -27,6 +28,13 @@ func (t *documentVersionQueue) Get(uri protocol.DocumentURI) int32 {
 	return t.versions[uri]
 }
 
+// snapshot returns a copy of the current document versions.
+func (t *documentVersionQueue) snapshot() map[protocol.DocumentURI]int32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return maps.Clone(t.versions)
+}
+
 func (t *documentVersionQueue) Wait(ctx context.Context, uri protocol.DocumentURI, version int32) error {
 	t.mu.Lock()
 	if currentVersion, ok := t.versions[uri]; ok && (currentVersion >= version || currentVersion == -1) {
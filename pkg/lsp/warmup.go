@@ -0,0 +1,125 @@
+package lsp
+
+import (
+	"context"
+	goparser "go/parser"
+	"go/token"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// maxConcurrentWarmups limits the number of Go packages parsed at once while
+// warming up synthetic files, to leave room for foreground requests.
+const maxConcurrentWarmups = 4
+
+// warmSyntheticImports synthesizes, in the background, the descriptors of all
+// generated Go packages which are transitively imported by generated code in
+// the local Go module, so that the first compilation which imports one of them
+// does not have to parse the Go sources.
+func (c *Cache) warmSyntheticImports() {
+	driver := c.resolver.goLanguageDriver
+	if !driver.HasGoModule() {
+		return
+	}
+	start := time.Now()
+	candidates := driver.SyntheticImportCandidates(c.lifetime)
+	var eg errgroup.Group
+	eg.SetLimit(maxConcurrentWarmups)
+	for _, importName := range candidates {
+		eg.Go(func() error {
+			if c.lifetime.Err() != nil {
+				return nil
+			}
+			res, err := driver.ImportFromGoModule(importName)
+			if err != nil || res.SourceExists {
+				return nil
+			}
+			if _, err := driver.SynthesizeFromGoSource(importName, res); err != nil {
+				slog.Debug("failed to warm up synthetic file", "import", importName, "error", err)
+			}
+			return nil
+		})
+	}
+	eg.Wait()
+	slog.Debug("warmed up synthetic files", "candidates", len(candidates), "time", time.Since(start))
+}
+
+// SyntheticImportCandidates returns the import names of the proto files whose
+// generated Go code is transitively imported by generated code in the local
+// module, and which are not part of the local module themselves.
+func (s *GoLanguageDriver) SyntheticImportCandidates(ctx context.Context) []string {
+	var queue []string
+	filepath.WalkDir(s.localModDir, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != s.localModDir && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isGeneratedMessageFile(d.Name()) {
+			queue = append(queue, p)
+		}
+		return nil
+	})
+
+	seenPackages := map[string]bool{}
+	var candidates []string
+	for len(queue) > 0 && ctx.Err() == nil {
+		filename := queue[0]
+		queue = queue[1:]
+		f, err := goparser.ParseFile(token.NewFileSet(), filename, nil, goparser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		for _, spec := range f.Imports {
+			pkgPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || seenPackages[pkgPath] {
+				continue
+			}
+			seenPackages[pkgPath] = true
+			if first, _, _ := strings.Cut(pkgPath, "/"); !strings.Contains(first, ".") ||
+				pkgPath == s.localModName || strings.HasPrefix(pkgPath, s.localModName+"/") ||
+				strings.HasPrefix(pkgPath, "google.golang.org/protobuf/") {
+				// standard library, local, or well-known types
+				continue
+			}
+			_, dir := s.moduleResolver.FindPackage(pkgPath)
+			if dir == "" {
+				continue
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				if entry.IsDir() || !isGeneratedMessageFile(entry.Name()) {
+					continue
+				}
+				candidates = append(candidates, path.Join(pkgPath, strings.TrimSuffix(entry.Name(), ".pb.go")+".proto"))
+				queue = append(queue, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	slices.Sort(candidates)
+	return candidates
+}
+
+func isGeneratedMessageFile(name string) bool {
+	return strings.HasSuffix(name, ".pb.go") && !strings.HasSuffix(name, "_grpc.pb.go")
+}
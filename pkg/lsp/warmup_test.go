@@ -0,0 +1,41 @@
+package lsp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSyntheticImportCandidates(t *testing.T) {
+	workspace := t.TempDir()
+	files := map[string]string{
+		"go.mod":              "module example.com/a\n\ngo 1.22\n\nrequire example.com/dep v0.0.0\n\nreplace example.com/dep => ./dep\n",
+		"api/a.pb.go":         "package api\n\nimport (\n\t\"fmt\"\n\t\"example.com/dep/b\"\n)\n",
+		"api/a_grpc.pb.go":    "package api\n\nimport \"example.com/dep/ignored\"\n",
+		"dep/go.mod":          "module example.com/dep\n\ngo 1.22\n",
+		"dep/b/b.pb.go":       "package b\n\nimport \"example.com/dep/c\"\n",
+		"dep/c/c.pb.go":       "package c\n",
+		"dep/c/c_grpc.pb.go":  "package c\n",
+		"dep/ignored/x.pb.go": "package ignored\n",
+	}
+	for name, contents := range files {
+		filename := filepath.Join(workspace, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	driver := NewGoLanguageDriver(workspace)
+	if !driver.HasGoModule() {
+		t.Skip("go command not available")
+	}
+	got := driver.SyntheticImportCandidates(context.Background())
+	want := []string{"example.com/dep/b/b.proto", "example.com/dep/c/c.proto"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -4,6 +4,9 @@ package lsp
 import (
 	"strings"
 
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
 	_ "buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
 	_ "google.golang.org/genproto/googleapis/api/annotations"
 	_ "google.golang.org/genproto/googleapis/api/configchange"
@@ -72,3 +75,48 @@ func IsWellKnownPath(path string) bool {
 var wellKnownModuleImports = []string{
 	"buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate/validate.proto",
 }
+
+// wellKnownTypeImports contains the files defining the google.protobuf
+// well-known types. Types from these files are offered as completions even if
+// they are not imported anywhere in the workspace.
+var wellKnownTypeImports = []string{
+	"google/protobuf/any.proto",
+	"google/protobuf/duration.proto",
+	"google/protobuf/empty.proto",
+	"google/protobuf/field_mask.proto",
+	"google/protobuf/struct.proto",
+	"google/protobuf/timestamp.proto",
+	"google/protobuf/wrappers.proto",
+}
+
+// findWellKnownTypesByPrefix returns the well-known types whose names start
+// with the given prefix. If the prefix is qualified, it is matched against
+// the full name of each type; otherwise, it is matched against the type's
+// simple name.
+func findWellKnownTypesByPrefix(prefix string, filter func(protoreflect.Descriptor) bool) []protoreflect.Descriptor {
+	qualified := strings.Contains(prefix, ".")
+	prefix = strings.TrimPrefix(prefix, ".")
+	var results []protoreflect.Descriptor
+	add := func(d protoreflect.Descriptor) {
+		name := string(d.Name())
+		if qualified {
+			name = string(d.FullName())
+		}
+		if strings.HasPrefix(name, prefix) && filter(d) {
+			results = append(results, d)
+		}
+	}
+	for _, path := range wellKnownTypeImports {
+		fd, err := protoregistry.GlobalFiles.FindFileByPath(path)
+		if err != nil {
+			continue
+		}
+		for i := 0; i < fd.Messages().Len(); i++ {
+			add(fd.Messages().Get(i))
+		}
+		for i := 0; i < fd.Enums().Len(); i++ {
+			add(fd.Enums().Get(i))
+		}
+	}
+	return results
+}
@@ -0,0 +1,256 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	durationFullName  protoreflect.FullName = "google.protobuf.Duration"
+	timestampFullName protoreflect.FullName = "google.protobuf.Timestamp"
+	fieldMaskFullName protoreflect.FullName = "google.protobuf.FieldMask"
+)
+
+// Limits on the values of well-known types, from their definitions in
+// google/protobuf/duration.proto and google/protobuf/timestamp.proto.
+const (
+	maxDurationSeconds = 315576000000
+	maxDurationNanos   = 999999999
+	minTimestampSecs   = -62135596800 // 0001-01-01T00:00:00Z
+	maxTimestampSecs   = 253402300799 // 9999-12-31T23:59:59Z
+)
+
+// wellKnownLiteral describes the canonical message literal form of a
+// well-known type, offered as a completion for option values of that type.
+type wellKnownLiteral struct {
+	label   string
+	snippet string
+}
+
+var wellKnownLiterals = map[protoreflect.FullName]wellKnownLiteral{
+	durationFullName: {
+		label:   "{ seconds: 0, nanos: 0 }",
+		snippet: "{ seconds: ${1:0}, nanos: ${2:0} }",
+	},
+	timestampFullName: {
+		label:   "{ seconds: 0, nanos: 0 }",
+		snippet: "{ seconds: ${1:0}, nanos: ${2:0} }",
+	},
+	fieldMaskFullName: {
+		label:   `{ paths: [""] }`,
+		snippet: `{ paths: ["${1}"] }`,
+	},
+}
+
+var fieldMaskPathPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)*$`)
+
+// validateWellKnownMessage checks the values of a message literal of a
+// well-known type against the constraints documented for that type, which the
+// compiler does not enforce. Values of the wrong type have already been
+// reported by validateValue.
+func (v *literalValidator) validateWellKnownMessage(md protoreflect.MessageDescriptor, lit *ast.MessageLiteralNode) {
+	switch md.FullName() {
+	case durationFullName:
+		seconds, secondsNode := literalIntField(lit, "seconds")
+		nanos, nanosNode := literalIntField(lit, "nanos")
+		if secondsNode != nil && (seconds < -maxDurationSeconds || seconds > maxDurationSeconds) {
+			v.report(secondsNode, "duration seconds must be between -%d and %d", maxDurationSeconds, maxDurationSeconds)
+		}
+		if nanosNode != nil {
+			switch {
+			case nanos < -maxDurationNanos || nanos > maxDurationNanos:
+				v.report(nanosNode, "duration nanos must be between -%d and %d", maxDurationNanos, maxDurationNanos)
+			case (seconds < 0 && nanos > 0) || (seconds > 0 && nanos < 0):
+				v.report(nanosNode, "duration nanos must have the same sign as seconds")
+			}
+		}
+	case timestampFullName:
+		seconds, secondsNode := literalIntField(lit, "seconds")
+		nanos, nanosNode := literalIntField(lit, "nanos")
+		if secondsNode != nil && (seconds < minTimestampSecs || seconds > maxTimestampSecs) {
+			v.report(secondsNode, "timestamp seconds must be between %d (0001-01-01T00:00:00Z) and %d (9999-12-31T23:59:59Z)", minTimestampSecs, maxTimestampSecs)
+		}
+		if nanosNode != nil && (nanos < 0 || nanos > maxDurationNanos) {
+			v.report(nanosNode, "timestamp nanos must be between 0 and %d", maxDurationNanos)
+		}
+	case fieldMaskFullName:
+		for _, elem := range lit.GetElements() {
+			if elem.GetName() == nil || string(elem.GetName().Name.AsIdentifier()) != "paths" || elem.GetVal() == nil {
+				continue
+			}
+			values := []*ast.ValueNode{elem.GetVal()}
+			if list := elem.GetVal().GetArrayLiteral(); list != nil {
+				values = list.FilterValues()
+			}
+			for _, val := range values {
+				if path, ok := val.Value().(string); ok && !fieldMaskPathPattern.MatchString(path) {
+					v.report(val, "invalid field mask path %q: expecting dot-separated lower_snake_case field names", path)
+				}
+			}
+		}
+	}
+}
+
+// literalIntField returns the integer value of the named field in a message
+// literal, and the value's node. The node is nil if the field is not set to
+// an integer which fits in an int64.
+func literalIntField(lit *ast.MessageLiteralNode, name string) (int64, *ast.ValueNode) {
+	for _, elem := range lit.GetElements() {
+		if elem.GetName() == nil || elem.GetName().IsExtension() || string(elem.GetName().Name.AsIdentifier()) != name || elem.GetVal() == nil {
+			continue
+		}
+		if n, ok := asInt64(elem.GetVal().Value()); ok {
+			return n, elem.GetVal()
+		}
+		return 0, nil
+	}
+	return 0, nil
+}
+
+// humanizeWellKnownLiteral formats a Duration or Timestamp message literal the
+// way it would be written in JSON, e.g. "1.5s" or "2024-01-01T00:00:00Z".
+func humanizeWellKnownLiteral(md protoreflect.MessageDescriptor, lit *ast.MessageLiteralNode) (string, bool) {
+	seconds, _ := literalIntField(lit, "seconds")
+	nanos, _ := literalIntField(lit, "nanos")
+	switch md.FullName() {
+	case durationFullName:
+		if seconds < -maxDurationSeconds || seconds > maxDurationSeconds || nanos < -maxDurationNanos || nanos > maxDurationNanos ||
+			(seconds < 0 && nanos > 0) || (seconds > 0 && nanos < 0) {
+			return "", false
+		}
+		return formatDuration(seconds, nanos), true
+	case timestampFullName:
+		if seconds < minTimestampSecs || seconds > maxTimestampSecs || nanos < 0 || nanos > maxDurationNanos {
+			return "", false
+		}
+		return time.Unix(seconds, nanos).UTC().Format(time.RFC3339Nano), true
+	}
+	return "", false
+}
+
+// formatDuration formats a duration as a decimal number of seconds, followed
+// by the equivalent Go duration if it is at least a minute long.
+func formatDuration(seconds, nanos int64) string {
+	sign := ""
+	if seconds < 0 || nanos < 0 {
+		sign = "-"
+		seconds, nanos = -seconds, -nanos
+	}
+	text := fmt.Sprintf("%s%d", sign, seconds)
+	if nanos != 0 {
+		text += strings.TrimRight(fmt.Sprintf(".%09d", nanos), "0")
+	}
+	text += "s"
+	if seconds >= 60 && seconds < maxDurationSeconds/100 {
+		d := time.Duration(seconds)*time.Second + time.Duration(nanos)
+		text += fmt.Sprintf(" (%s%s)", sign, d)
+	}
+	return text
+}
+
+// tryHoverWellKnownLiteral returns a hover showing the humanized value of the
+// innermost Duration or Timestamp message literal in an option value at the
+// given position.
+func (c *Cache) tryHoverWellKnownLiteral(snapshot *Snapshot, params protocol.TextDocumentPositionParams) *protocol.Hover {
+	res, err := snapshot.FindResultOrPartialResultByURI(params.TextDocument.URI)
+	if err != nil {
+		return nil
+	}
+	fileNode := res.AST()
+	if fileNode == nil {
+		return nil
+	}
+	mapper, err := c.GetMapper(params.TextDocument.URI)
+	if err != nil {
+		return nil
+	}
+	offset, err := mapper.PositionOffset(params.Position)
+	if err != nil {
+		return nil
+	}
+	token, comment := fileNode.ItemAtOffset(offset)
+	if token == ast.TokenError || comment.IsValid() {
+		return nil
+	}
+
+	var md protoreflect.MessageDescriptor
+	var lit *ast.MessageLiteralNode
+	ast.Inspect(fileNode, func(node ast.Node) bool {
+		optionNode, ok := node.(*ast.OptionNode)
+		if !ok {
+			return true
+		}
+		if optionNode.Val == nil {
+			return false
+		}
+		opt, ok := res.Descriptor(optionNode).(*descriptorpb.UninterpretedOption)
+		if !ok {
+			return false
+		}
+		if fd := res.FindOptionFieldDescriptor(opt); fd != nil {
+			md, lit = findWellKnownLiteralAt(c, res, fd, optionNode.Val, token)
+		}
+		return false
+	}, ast.WithIntersection(token))
+	if lit == nil {
+		return nil
+	}
+	text, ok := humanizeWellKnownLiteral(md, lit)
+	if !ok {
+		return nil
+	}
+	return &protocol.Hover{
+		Contents: protocol.MarkupContent{
+			Kind:  protocol.Markdown,
+			Value: fmt.Sprintf("`%s`: `%s`", md.FullName(), text),
+		},
+		Range: toRange(fileNode.NodeInfo(lit)),
+	}
+}
+
+// findWellKnownLiteralAt descends into the value assigned to the field and
+// returns the innermost Duration or Timestamp message literal containing the
+// token.
+func findWellKnownLiteralAt(c *Cache, res linker.Result, fd protoreflect.FieldDescriptor, val *ast.ValueNode, token ast.Token) (protoreflect.MessageDescriptor, *ast.MessageLiteralNode) {
+	if val == nil || token < val.Start() || token > val.End() {
+		return nil, nil
+	}
+	if list := val.GetArrayLiteral(); list != nil {
+		for _, elem := range list.FilterValues() {
+			if md, lit := findWellKnownLiteralAt(c, res, fd, elem, token); lit != nil {
+				return md, lit
+			}
+		}
+		return nil, nil
+	}
+	lit := val.GetMessageLiteral()
+	if lit == nil || (fd.Kind() != protoreflect.MessageKind && fd.Kind() != protoreflect.GroupKind) {
+		return nil, nil
+	}
+	md := fd.Message()
+	v := &literalValidator{resolver: c, fileNode: res.AST(), scope: res.Package()}
+	for _, elem := range lit.GetElements() {
+		name := elem.GetName()
+		if name == nil || name.IsIncomplete() || name.IsAnyTypeReference() {
+			continue
+		}
+		if field := v.findField(md, name); field != nil {
+			if innerMd, innerLit := findWellKnownLiteralAt(c, res, field, elem.GetVal(), token); innerLit != nil {
+				return innerMd, innerLit
+			}
+		}
+	}
+	switch md.FullName() {
+	case durationFullName, timestampFullName:
+		return md, lit
+	}
+	return nil, nil
+}
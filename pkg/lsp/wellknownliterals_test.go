@@ -0,0 +1,104 @@
+package lsp
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestValidateWellKnownLiterals(t *testing.T) {
+	const source = `syntax = "proto3";
+package a;
+import "google/protobuf/descriptor.proto";
+import "google/protobuf/duration.proto";
+import "google/protobuf/field_mask.proto";
+import "google/protobuf/timestamp.proto";
+message Opt {
+  google.protobuf.Duration d = 1;
+  google.protobuf.Timestamp ts = 2;
+  google.protobuf.FieldMask mask = 3;
+  repeated google.protobuf.Duration ds = 4;
+}
+extend google.protobuf.MessageOptions {
+  Opt opt = 50000;
+}
+message A {
+  option (opt) = {
+    d: { seconds: 400000000000 nanos: 1 }
+    ts: { seconds: -62135596801 nanos: -1 }
+    mask: { paths: ["foo.bar_baz", "Foo", "a..b"] }
+    ds: [{ seconds: -1 nanos: 5 }, { seconds: 1 nanos: 1000000000 }]
+  };
+}
+message B {
+  option (a.opt).d = { seconds: 90 nanos: 500000000 };
+}
+`
+	c, workspace := newTestCache(t, map[string]string{"a.proto": source}, nil)
+
+	diagnostics, _, _ := c.diagHandler.GetDiagnosticsForPath("a.proto")
+	var messages []string
+	for _, d := range diagnostics {
+		messages = append(messages, fmt.Sprintf("%d:%d %s", d.Range.Start().Line, d.Range.Start().Col, d.Error))
+	}
+	want := []string{
+		"18:19 duration seconds must be between -315576000000 and 315576000000",
+		"19:20 timestamp seconds must be between -62135596800 (0001-01-01T00:00:00Z) and 253402300799 (9999-12-31T23:59:59Z)",
+		"19:40 timestamp nanos must be between 0 and 999999999",
+		"20:22 invalid field path \"foo.bar_baz\": message a.A has no field named \"foo\"",
+		"20:36 invalid field mask path \"Foo\": expecting dot-separated lower_snake_case field names",
+		"20:43 invalid field mask path \"a..b\": expecting dot-separated lower_snake_case field names",
+		"21:31 duration nanos must have the same sign as seconds",
+		"21:56 duration nanos must be between -999999999 and 999999999",
+	}
+	slices.Sort(messages)
+	slices.Sort(want)
+	if !slices.Equal(messages, want) {
+		t.Errorf("got diagnostics:\n%s\nwant:\n%s", strings.Join(messages, "\n"), strings.Join(want, "\n"))
+	}
+
+	uri := protocol.URIFromPath(filepath.Join(workspace, "a.proto"))
+	for _, tc := range []struct {
+		pos  protocol.Position
+		want string
+	}{
+		{pos: protocol.Position{Line: 24, Character: 23}, want: "`google.protobuf.Duration`: `90.5s (1m30.5s)`"},
+		// invalid durations are not humanized
+		{pos: protocol.Position{Line: 20, Character: 10}, want: ""},
+		{pos: protocol.Position{Line: 17, Character: 10}, want: ""},
+	} {
+		hover := c.tryHoverWellKnownLiteral(c.Snapshot(), protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     tc.pos,
+		})
+		var got string
+		if hover != nil {
+			got = hover.Contents.Value
+		}
+		if got != tc.want {
+			t.Errorf("hover at %v: got %q, want %q", tc.pos, got, tc.want)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for _, tc := range []struct {
+		seconds, nanos int64
+		want           string
+	}{
+		{0, 0, "0s"},
+		{1, 500000000, "1.5s"},
+		{-1, -500000000, "-1.5s"},
+		{0, 1000, "0.000001s"},
+		{3600, 0, "3600s (1h0m0s)"},
+		{315576000000, 0, "315576000000s"},
+	} {
+		if got := formatDuration(tc.seconds, tc.nanos); got != tc.want {
+			t.Errorf("formatDuration(%d, %d) = %q, want %q", tc.seconds, tc.nanos, got, tc.want)
+		}
+	}
+}
@@ -8,11 +8,13 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/kralicky/codegen/cli"
 	"github.com/kralicky/codegen/pathbuilder"
 	"github.com/kralicky/protocompile/linker"
 	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/protocolext"
 	"github.com/kralicky/protols/pkg/util"
 	"github.com/kralicky/protols/sdk/codegen"
 	"github.com/kralicky/protols/sdk/codegen/generators/golang"
@@ -24,15 +26,62 @@ import (
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
-func NewStreamServer() jsonrpc2.StreamServer {
-	return &streamServer{}
+// ErrExitWithoutShutdown is returned from ServeStream if the client sent an
+// exit notification without first sending a shutdown request.
+var ErrExitWithoutShutdown = errors.New("received exit notification before shutdown request")
+
+type StreamServerOptions struct {
+	sandbox       bool
+	serverOptions []lsp.ServerOption
+}
+
+type StreamServerOption func(*StreamServerOptions)
+
+func (o *StreamServerOptions) apply(opts ...StreamServerOption) {
+	for _, op := range opts {
+		op(o)
+	}
+}
+
+// WithSandbox prevents the server from running any subprocesses. See
+// lsp.WithSandbox.
+func WithSandbox(sandbox bool) StreamServerOption {
+	return func(o *StreamServerOptions) {
+		o.sandbox = sandbox
+	}
 }
 
-type streamServer struct{}
+// WithServerOptions adds options to the server created for each stream, such
+// as additional scheme handlers.
+func WithServerOptions(opts ...lsp.ServerOption) StreamServerOption {
+	return func(o *StreamServerOptions) {
+		o.serverOptions = append(o.serverOptions, opts...)
+	}
+}
+
+func NewStreamServer(opts ...StreamServerOption) jsonrpc2.StreamServer {
+	var options StreamServerOptions
+	options.apply(opts...)
+	return &streamServer{
+		StreamServerOptions: options,
+	}
+}
+
+type streamServer struct {
+	StreamServerOptions
+}
 
 func (s *streamServer) ServeStream(ctx context.Context, conn jsonrpc2.Conn) error {
+	ctx, ca := context.WithCancel(ctx)
+	defer ca()
+
 	client := protocol.ClientDispatcher(conn)
-	server := lsp.NewServer(client,
+	serverOpts := []lsp.ServerOption{
+		lsp.WithNotifyFunc(conn.Notify),
+		lsp.WithCallFunc(func(ctx context.Context, method string, params, result any) error {
+			_, err := conn.Call(ctx, method, params, result)
+			return err
+		}),
 		lsp.WithUnknownCommandHandler(
 			&unknownHandler{
 				Generators: []codegen.Generator{
@@ -42,22 +91,172 @@ func (s *streamServer) ServeStream(ctx context.Context, conn jsonrpc2.Conn) erro
 					cli.Generator,
 				},
 			},
-			"protols/generate",
-			"protols/generateWorkspace",
+			protocolext.GenerateCommand,
+			protocolext.GenerateWorkspaceCommand,
 		),
-	)
-	handler := protocol.CancelHandler(
+	}
+	if s.sandbox {
+		serverOpts = append(serverOpts, lsp.WithSandbox())
+	}
+	serverOpts = append(serverOpts, s.serverOptions...)
+	server := lsp.NewServer(client, serverOpts...)
+	var handler jsonrpc2.Handler = protocol.CancelHandler(
 		AsyncHandler(
-			jsonrpc2.MustReplyHandler(
-				protocol.ServerHandler(server, jsonrpc2.MethodNotFound))))
-	conn.Go(ctx, handler)
+			RecoverHandler(conn,
+				jsonrpc2.MustReplyHandler(
+					ShutdownHandler(server,
+						LocationLinkHandler(server,
+							TextDocumentContentHandler(server,
+								protocol.ServerHandler(server, jsonrpc2.MethodNotFound))))))))
+	var inflight sync.WaitGroup
+	conn.Go(ctx, InFlightHandler(&inflight, handler))
 	<-conn.Done()
+	// requests still being handled are cancelled, and ServeStream returns once
+	// they have replied. When serving several clients, the connection is not
+	// counted as closed until then, so the idle timeout cannot expire while a
+	// request is in flight.
+	ca()
+	inflight.Wait()
+	if exited, clean := server.Exited(); exited {
+		if !clean {
+			return ErrExitWithoutShutdown
+		}
+		return nil
+	}
 	if err := conn.Err(); err != nil {
 		return fmt.Errorf("server exited with error: %w", err)
 	}
 	return nil
 }
 
+// ShutdownHandler rejects all requests other than shutdown once the server has
+// received a shutdown request, as required by the spec. Notifications other
+// than exit are dropped.
+func ShutdownHandler(server *lsp.Server, handler jsonrpc2.Handler) jsonrpc2.Handler {
+	return func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if !server.ShutdownRequested() {
+			return handler(ctx, reply, req)
+		}
+		switch req.Method() {
+		case "shutdown", "exit":
+			return handler(ctx, reply, req)
+		}
+		if _, isCall := req.(*jsonrpc2.Call); isCall {
+			return reply(ctx, nil, fmt.Errorf("%w: server is shutting down", jsonrpc2.ErrInvalidRequest))
+		}
+		return reply(ctx, nil, nil)
+	}
+}
+
+// LocationLinkHandler replies to definition and type definition requests
+// with location links instead of locations if the client supports them.
+// Links cannot be returned through the protocol.Server interface, which only
+// allows locations.
+func LocationLinkHandler(server *lsp.Server, handler jsonrpc2.Handler) jsonrpc2.Handler {
+	return func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		var links []protocol.LocationLink
+		var err error
+		switch req.Method() {
+		case "textDocument/definition":
+			if !server.ClientSupportsDefinitionLinks() {
+				return handler(ctx, reply, req)
+			}
+			var params protocol.DefinitionParams
+			if err := protocol.UnmarshalJSON(req.Params(), &params); err != nil {
+				return reply(ctx, nil, fmt.Errorf("%w: %s", jsonrpc2.ErrParse, err))
+			}
+			links, err = server.DefinitionLinks(ctx, &params)
+		case "textDocument/typeDefinition":
+			if !server.ClientSupportsTypeDefinitionLinks() {
+				return handler(ctx, reply, req)
+			}
+			var params protocol.TypeDefinitionParams
+			if err := protocol.UnmarshalJSON(req.Params(), &params); err != nil {
+				return reply(ctx, nil, fmt.Errorf("%w: %s", jsonrpc2.ErrParse, err))
+			}
+			links, err = server.TypeDefinitionLinks(ctx, &params)
+		default:
+			return handler(ctx, reply, req)
+		}
+		if err != nil {
+			return reply(ctx, nil, err)
+		}
+		return reply(ctx, links, nil)
+	}
+}
+
+// TextDocumentContentHandler serves the contents of synthetic files with the
+// workspace/textDocumentContent request, and adds the corresponding capability
+// to the initialize result. Neither is part of the protocol.Server interface,
+// which predates LSP 3.18.
+func TextDocumentContentHandler(server *lsp.Server, handler jsonrpc2.Handler) jsonrpc2.Handler {
+	return func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		switch req.Method() {
+		case "initialize":
+			return handler(ctx, func(ctx context.Context, result any, err error) error {
+				if err != nil {
+					return reply(ctx, result, err)
+				}
+				result, err = withTextDocumentContentCapability(result, server.TextDocumentContentCapability())
+				return reply(ctx, result, err)
+			}, req)
+		case lsp.TextDocumentContentMethod:
+			var params lsp.TextDocumentContentParams
+			if err := protocol.UnmarshalJSON(req.Params(), &params); err != nil {
+				return reply(ctx, nil, fmt.Errorf("%w: %s", jsonrpc2.ErrParse, err))
+			}
+			result, err := server.TextDocumentContent(ctx, &params)
+			if err != nil {
+				return reply(ctx, nil, err)
+			}
+			return reply(ctx, result, nil)
+		default:
+			return handler(ctx, reply, req)
+		}
+	}
+}
+
+// withTextDocumentContentCapability returns the initialize result with the
+// workspace.textDocumentContent capability set.
+func withTextDocumentContentCapability(result any, options lsp.TextDocumentContentOptions) (any, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	capabilities, _ := fields["capabilities"].(map[string]any)
+	if capabilities == nil {
+		capabilities = map[string]any{}
+		fields["capabilities"] = capabilities
+	}
+	workspace, _ := capabilities["workspace"].(map[string]any)
+	if workspace == nil {
+		workspace = map[string]any{}
+		capabilities["workspace"] = workspace
+	}
+	workspace["textDocumentContent"] = options
+	return fields, nil
+}
+
+// InFlightHandler adds each request passed to the handler to wg, and marks it
+// done once it has been replied to. Notifications are not tracked.
+func InFlightHandler(wg *sync.WaitGroup, handler jsonrpc2.Handler) jsonrpc2.Handler {
+	return func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if _, isCall := req.(*jsonrpc2.Call); !isCall {
+			return handler(ctx, reply, req)
+		}
+		wg.Add(1)
+		var once sync.Once
+		return handler(ctx, func(ctx context.Context, result any, err error) error {
+			defer once.Do(wg.Done)
+			return reply(ctx, result, err)
+		}, req)
+	}
+}
+
 // methods that are intended to be long-lived, and should not hold up the queue
 var streamingRequestMethods = map[string]bool{
 	"workspace/diagnostic":     true,
@@ -99,8 +298,8 @@ type unknownHandler struct {
 // Execute implements lsp.UnknownCommandHandler.
 func (h *unknownHandler) Execute(ctx context.Context, uc lsp.UnknownCommand) (any, error) {
 	switch uc.Command {
-	case "protols/generate":
-		var req lsp.GenerateCodeRequest
+	case protocolext.GenerateCommand:
+		var req protocolext.GenerateCodeRequest
 		if err := json.Unmarshal(uc.Arguments[0], &req); err != nil {
 			return nil, err
 		}
@@ -108,7 +307,7 @@ func (h *unknownHandler) Execute(ctx context.Context, uc lsp.UnknownCommand) (an
 			return nil, errors.New("no cache available")
 		}
 		return nil, h.doGenerate(ctx, uc.Cache, req.URIs)
-	case "protols/generateWorkspace":
+	case protocolext.GenerateWorkspaceCommand:
 		if uc.Cache == nil {
 			return nil, errors.New("no cache available")
 		}
@@ -0,0 +1,46 @@
+package lsprpc
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/pkg/event"
+	"github.com/kralicky/tools-lite/pkg/jsonrpc2"
+)
+
+// RecoverHandler returns a handler which recovers from panics in the given
+// handler. A recovered panic is logged, reported to the client with a
+// protols/serverError notification, and returned to the caller as an internal
+// error if the request has not already been replied to.
+func RecoverHandler(conn jsonrpc2.Conn, handler jsonrpc2.Handler) jsonrpc2.Handler {
+	return func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) (err error) {
+		var once sync.Once
+		replyOnce := func(ctx context.Context, result interface{}, err error) error {
+			var replyErr error
+			once.Do(func() {
+				replyErr = reply(ctx, result, err)
+			})
+			return replyErr
+		}
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			params := protocolext.ServerErrorParams{
+				Method:  req.Method(),
+				Message: fmt.Sprint(r),
+				Stack:   string(debug.Stack()),
+			}
+			event.Error(ctx, "recovered from panic", fmt.Errorf("%s: %s\n%s", params.Method, params.Message, params.Stack))
+			if notifyErr := conn.Notify(ctx, protocolext.ServerErrorNotification, params); notifyErr != nil {
+				event.Error(ctx, "failed to send server error notification", notifyErr)
+			}
+			err = replyOnce(ctx, nil, fmt.Errorf("%w: panic handling %s: %s", jsonrpc2.ErrInternal, params.Method, params.Message))
+		}()
+		return handler(ctx, replyOnce, req)
+	}
+}
@@ -0,0 +1,407 @@
+package lsptest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+const (
+	scheme  = "mem"
+	rootURI = protocol.DocumentURI(scheme + ":///workspace")
+)
+
+// Env is the environment of a single test: a server, and an editor connected
+// to it which keeps the workspace and its open documents in memory.
+type Env struct {
+	T   *testing.T
+	Ctx context.Context
+	// Server sends requests and notifications to the server under test.
+	Server protocol.Server
+
+	files    *memFiles
+	settings map[string]any
+
+	mu          sync.Mutex
+	buffers     map[string]*buffer
+	diagnostics map[protocol.DocumentURI][]protocol.Diagnostic
+	published   chan struct{}
+}
+
+// A buffer is a document which is open in the editor.
+type buffer struct {
+	version int32
+	content string
+}
+
+// URI returns the URI of the workspace file with the given path.
+func (e *Env) URI(path string) protocol.DocumentURI {
+	return rootURI + "/" + protocol.DocumentURI(path)
+}
+
+// Path returns the path of the workspace file with the given URI.
+func (e *Env) Path(uri protocol.DocumentURI) string {
+	return strings.TrimPrefix(string(uri), string(rootURI)+"/")
+}
+
+// OpenFile opens the workspace file with the given path in the editor.
+func (e *Env) OpenFile(path string) {
+	e.T.Helper()
+	content, ok := e.files.read(path)
+	if !ok {
+		e.T.Fatalf("no workspace file %s", path)
+	}
+	e.mu.Lock()
+	e.buffers[path] = &buffer{version: 1, content: content}
+	e.mu.Unlock()
+	if err := e.Server.DidOpen(e.Ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{
+			URI:        e.URI(path),
+			LanguageID: languageID(path),
+			Version:    1,
+			Text:       content,
+		},
+	}); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// CloseFile closes the document with the given path, discarding any changes
+// which were not saved.
+func (e *Env) CloseFile(path string) {
+	e.T.Helper()
+	e.mu.Lock()
+	delete(e.buffers, path)
+	e.mu.Unlock()
+	if err := e.Server.DidClose(e.Ctx, &protocol.DidCloseTextDocumentParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: e.URI(path)},
+	}); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// SetBufferContent replaces the content of an open document.
+func (e *Env) SetBufferContent(path string, content string) {
+	e.T.Helper()
+	if err := e.setBufferContent(e.Ctx, path, content); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+func (e *Env) setBufferContent(ctx context.Context, path string, content string) error {
+	e.mu.Lock()
+	buf, ok := e.buffers[path]
+	if !ok {
+		e.mu.Unlock()
+		return fmt.Errorf("%s is not open", path)
+	}
+	buf.version++
+	buf.content = content
+	version := buf.version
+	e.mu.Unlock()
+	return e.Server.DidChange(ctx, &protocol.DidChangeTextDocumentParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: e.URI(path)},
+			Version:                version,
+		},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: content}},
+	})
+}
+
+// BufferText returns the content of an open document.
+func (e *Env) BufferText(path string) string {
+	e.T.Helper()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	buf, ok := e.buffers[path]
+	if !ok {
+		e.T.Fatalf("%s is not open", path)
+	}
+	return buf.content
+}
+
+// SaveBuffer writes the content of an open document to the workspace.
+func (e *Env) SaveBuffer(path string) {
+	e.T.Helper()
+	content := e.BufferText(path)
+	e.files.write(path, content)
+	if err := e.Server.DidSave(e.Ctx, &protocol.DidSaveTextDocumentParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: e.URI(path)},
+		Text:         &content,
+	}); err != nil {
+		e.T.Fatal(err)
+	}
+	if err := e.notifyWatchedFiles(e.Ctx, protocol.FileEvent{URI: e.URI(path), Type: protocol.Changed}); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+// ReadWorkspaceFile returns the content of a workspace file, which does not
+// include unsaved changes to open documents.
+func (e *Env) ReadWorkspaceFile(path string) string {
+	e.T.Helper()
+	content, ok := e.files.read(path)
+	if !ok {
+		e.T.Fatalf("no workspace file %s", path)
+	}
+	return content
+}
+
+// WriteWorkspaceFile creates or replaces a workspace file, and notifies the
+// server of the change.
+func (e *Env) WriteWorkspaceFile(path string, content string) {
+	e.T.Helper()
+	typ := protocol.Changed
+	if _, ok := e.files.read(path); !ok {
+		typ = protocol.Created
+	}
+	e.files.write(path, content)
+	if err := e.notifyWatchedFiles(e.Ctx, protocol.FileEvent{URI: e.URI(path), Type: typ}); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+func (e *Env) notifyWatchedFiles(ctx context.Context, events ...protocol.FileEvent) error {
+	return e.Server.DidChangeWatchedFiles(ctx, &protocol.DidChangeWatchedFilesParams{Changes: events})
+}
+
+// RegexpSearch returns the location of the first match of re in the document
+// with the given path, or the workspace file if it is not open. If re has a
+// subgroup, the location of the first subgroup is returned instead.
+func (e *Env) RegexpSearch(path string, re string) protocol.Location {
+	e.T.Helper()
+	content := e.content(path)
+	match := regexp.MustCompile(re).FindStringSubmatchIndex(content)
+	if match == nil {
+		e.T.Fatalf("no match for %q in %s", re, path)
+	}
+	start, end := match[0], match[1]
+	if len(match) > 2 {
+		start, end = match[2], match[3]
+	}
+	mapper := protocol.NewMapper(e.URI(path), []byte(content))
+	rng, err := mapper.OffsetRange(start, end)
+	if err != nil {
+		e.T.Fatal(err)
+	}
+	return protocol.Location{URI: e.URI(path), Range: rng}
+}
+
+func (e *Env) content(path string) string {
+	if content, ok := e.bufferContent(path); ok {
+		return content
+	}
+	return e.ReadWorkspaceFile(path)
+}
+
+func (e *Env) bufferContent(path string) (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	buf, ok := e.buffers[path]
+	if !ok {
+		return "", false
+	}
+	return buf.content, true
+}
+
+// Diagnostics returns the diagnostics most recently published for the file
+// with the given path.
+func (e *Env) Diagnostics(path string) []protocol.Diagnostic {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.diagnostics[e.URI(path)]
+}
+
+// AwaitDiagnostics waits until the diagnostics published for the file with
+// the given path satisfy cond, and returns them. The test fails if they do not
+// within 10 seconds.
+func (e *Env) AwaitDiagnostics(path string, cond func([]protocol.Diagnostic) bool) []protocol.Diagnostic {
+	e.T.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		e.mu.Lock()
+		diagnostics, published := e.diagnostics[e.URI(path)], e.published
+		e.mu.Unlock()
+		if cond(diagnostics) {
+			return diagnostics
+		}
+		select {
+		case <-published:
+		case <-timeout:
+			e.T.Fatalf("timed out waiting for diagnostics in %s, last published: %v", path, diagnostics)
+		}
+	}
+}
+
+// ApplyEdit applies a workspace edit returned by the server, such as the
+// edit of a code action, to the open documents and workspace files it
+// changes.
+func (e *Env) ApplyEdit(edit *protocol.WorkspaceEdit) {
+	e.T.Helper()
+	if err := e.applyEdit(e.Ctx, edit); err != nil {
+		e.T.Fatal(err)
+	}
+}
+
+func (e *Env) applyEdit(ctx context.Context, edit *protocol.WorkspaceEdit) error {
+	for _, change := range edit.DocumentChanges {
+		switch {
+		case change.TextDocumentEdit != nil:
+			edits := protocol.AsTextEdits(change.TextDocumentEdit.Edits)
+			if err := e.applyTextEdits(ctx, change.TextDocumentEdit.TextDocument.URI, edits); err != nil {
+				return err
+			}
+		case change.RenameFile != nil:
+			if err := e.renameFile(ctx, change.RenameFile.OldURI, change.RenameFile.NewURI); err != nil {
+				return err
+			}
+		}
+	}
+	uris := make([]protocol.DocumentURI, 0, len(edit.Changes))
+	for uri := range edit.Changes {
+		uris = append(uris, uri)
+	}
+	slices.Sort(uris)
+	for _, uri := range uris {
+		if err := e.applyTextEdits(ctx, uri, edit.Changes[uri]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Env) applyTextEdits(ctx context.Context, uri protocol.DocumentURI, edits []protocol.TextEdit) error {
+	path := e.Path(uri)
+	content, open := e.bufferContent(path)
+	if !open {
+		var ok bool
+		if content, ok = e.files.read(path); !ok {
+			return fmt.Errorf("no workspace file %s", path)
+		}
+	}
+	updated, _, err := protocol.ApplyEdits(protocol.NewMapper(uri, []byte(content)), edits)
+	if err != nil {
+		return err
+	}
+	if open {
+		return e.setBufferContent(ctx, path, string(updated))
+	}
+	e.files.write(path, string(updated))
+	return e.notifyWatchedFiles(ctx, protocol.FileEvent{URI: uri, Type: protocol.Changed})
+}
+
+func (e *Env) renameFile(ctx context.Context, oldURI, newURI protocol.DocumentURI) error {
+	oldPath, newPath := e.Path(oldURI), e.Path(newURI)
+	if err := e.files.rename(oldPath, newPath); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	buf, open := e.buffers[oldPath]
+	var opened protocol.TextDocumentItem
+	if open {
+		delete(e.buffers, oldPath)
+		e.buffers[newPath] = buf
+		opened = protocol.TextDocumentItem{
+			URI:        newURI,
+			LanguageID: languageID(newPath),
+			Version:    buf.version,
+			Text:       buf.content,
+		}
+	}
+	e.mu.Unlock()
+	if open {
+		if err := e.Server.DidClose(ctx, &protocol.DidCloseTextDocumentParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: oldURI},
+		}); err != nil {
+			return err
+		}
+	}
+	if err := e.notifyWatchedFiles(ctx,
+		protocol.FileEvent{URI: oldURI, Type: protocol.Deleted},
+		protocol.FileEvent{URI: newURI, Type: protocol.Created},
+	); err != nil {
+		return err
+	}
+	if open {
+		return e.Server.DidOpen(ctx, &protocol.DidOpenTextDocumentParams{TextDocument: opened})
+	}
+	return nil
+}
+
+func languageID(filename string) protocol.LanguageKind {
+	if path.Ext(filename) == ".proto" {
+		return "protobuf"
+	}
+	return "plaintext"
+}
+
+// memFiles serves the workspace files to the server.
+type memFiles struct {
+	mu    sync.Mutex
+	files Workspace
+}
+
+func (fs *memFiles) read(path string) (string, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	content, ok := fs.files[path]
+	return content, ok
+}
+
+func (fs *memFiles) write(path string, content string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.files[path] = content
+}
+
+func (fs *memFiles) rename(oldPath, newPath string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	content, ok := fs.files[oldPath]
+	if !ok {
+		return fmt.Errorf("no workspace file %s", oldPath)
+	}
+	if _, ok := fs.files[newPath]; ok {
+		return fmt.Errorf("%s already exists", newPath)
+	}
+	delete(fs.files, oldPath)
+	fs.files[newPath] = content
+	return nil
+}
+
+// ReadFile implements lsp.SchemeHandler.
+func (fs *memFiles) ReadFile(_ context.Context, uri protocol.DocumentURI) ([]byte, error) {
+	path, ok := strings.CutPrefix(string(uri), string(rootURI)+"/")
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", os.ErrNotExist, uri)
+	}
+	content, ok := fs.read(path)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", os.ErrNotExist, uri)
+	}
+	return []byte(content), nil
+}
+
+// ListProtoFiles implements lsp.SchemeHandler.
+func (fs *memFiles) ListProtoFiles(_ context.Context, root protocol.DocumentURI) ([]protocol.DocumentURI, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var uris []protocol.DocumentURI
+	for filename := range fs.files {
+		uri := rootURI + "/" + protocol.DocumentURI(filename)
+		if path.Ext(filename) == ".proto" && strings.HasPrefix(string(uri), string(root)+"/") {
+			uris = append(uris, uri)
+		}
+	}
+	slices.Sort(uris)
+	return uris, nil
+}
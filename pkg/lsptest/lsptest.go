@@ -0,0 +1,261 @@
+// Package lsptest provides an end-to-end test harness for the language server.
+//
+// Each test runs against a fresh server connected to a minimal editor over an
+// in-memory jsonrpc2 pipe. The workspace is described in the test itself,
+// either as a map of relative paths to file contents or as a txtar archive.
+// The server reads workspace files through a SchemeHandler for mem:// URIs,
+// and documents opened in the editor are sent to the server as overlays, so
+// tests never read or write files on disk. The server runs in sandbox mode,
+// and does not run any external commands.
+package lsptest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/lsprpc"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration/fake"
+	"github.com/kralicky/tools-lite/pkg/jsonrpc2"
+	"github.com/kralicky/tools-lite/pkg/jsonrpc2/servertest"
+)
+
+// Workspace maps slash-separated paths, relative to the workspace root, to
+// file contents.
+type Workspace map[string]string
+
+// ParseTxtar returns the workspace contained in a txtar archive.
+func ParseTxtar(archive string) Workspace {
+	ws := Workspace{}
+	for path, content := range fake.UnpackTxt(archive) {
+		ws[path] = string(content)
+	}
+	return ws
+}
+
+// TestFunc is the body of a test. The environment is connected to a server
+// whose workspace has finished its initial load.
+type TestFunc func(t *testing.T, env *Env)
+
+type options struct {
+	capabilities  protocol.ClientCapabilities
+	settings      map[string]any
+	serverOptions []lsp.ServerOption
+	logs          io.Writer
+}
+
+// Option configures a test run.
+type Option func(*options)
+
+// WithCapabilities replaces the capabilities the editor reports to the server.
+func WithCapabilities(caps protocol.ClientCapabilities) Option {
+	return func(o *options) {
+		o.capabilities = caps
+	}
+}
+
+// WithSettings sets the settings returned for workspace/configuration
+// requests, in the same form as the "protols" section of the editor's
+// settings.
+func WithSettings(settings map[string]any) Option {
+	return func(o *options) {
+		o.settings = settings
+	}
+}
+
+// WithServerOptions adds options to the server under test. This allows
+// downstream projects to test servers constructed with additional options,
+// such as their own scheme handlers.
+func WithServerOptions(opts ...lsp.ServerOption) Option {
+	return func(o *options) {
+		o.serverOptions = append(o.serverOptions, opts...)
+	}
+}
+
+// WithLogs writes the jsonrpc2 traffic of failed tests to w.
+func WithLogs(w io.Writer) Option {
+	return func(o *options) {
+		o.logs = w
+	}
+}
+
+// DefaultCapabilities returns the capabilities the editor reports if none are
+// provided with WithCapabilities. The editor accepts versioned document
+// changes and file renames in workspace edits, and answers configuration
+// requests.
+func DefaultCapabilities() protocol.ClientCapabilities {
+	var caps protocol.ClientCapabilities
+	caps.Workspace.Configuration = true
+	caps.Workspace.WorkspaceEdit = &protocol.WorkspaceEditClientCapabilities{
+		DocumentChanges:    true,
+		ResourceOperations: []protocol.ResourceOperationKind{protocol.Rename},
+	}
+	return caps
+}
+
+// Run starts a server for the given workspace and runs the test function
+// against it once the workspace has been loaded.
+func Run(t *testing.T, ws Workspace, test TestFunc, opts ...Option) {
+	t.Helper()
+
+	o := options{
+		capabilities: DefaultCapabilities(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ctx, ca := context.WithCancel(context.Background())
+	defer ca()
+
+	env := &Env{
+		T:           t,
+		Ctx:         ctx,
+		files:       &memFiles{files: make(Workspace, len(ws))},
+		buffers:     make(map[string]*buffer),
+		diagnostics: make(map[protocol.DocumentURI][]protocol.Diagnostic),
+		published:   make(chan struct{}),
+		settings:    o.settings,
+	}
+	for path, content := range ws {
+		env.files.files[path] = content
+	}
+
+	ls := &loggingFramer{}
+	ss := lsprpc.NewStreamServer(
+		lsprpc.WithSandbox(true),
+		lsprpc.WithServerOptions(append([]lsp.ServerOption{lsp.WithSchemeHandler(scheme, env.files)}, o.serverOptions...)...),
+	)
+	ts := servertest.NewPipeServer(ss, ls.framer(jsonrpc2.NewRawStream))
+	conn := ts.Connect(ctx)
+	conn.Go(ctx, protocol.Handlers(env.handle))
+	env.Server = protocol.ServerDispatcher(conn)
+	defer func() {
+		if t.Failed() && o.logs != nil {
+			ls.printBuffers(t.Name(), o.logs)
+		}
+	}()
+
+	params := &protocol.ParamInitialize{}
+	params.ClientInfo = &protocol.ClientInfo{Name: "lsptest"}
+	params.Capabilities = o.capabilities
+	params.WorkspaceFolders = []protocol.WorkspaceFolder{{URI: string(rootURI), Name: "workspace"}}
+	if _, err := env.Server.Initialize(ctx, params); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Server.Initialized(ctx, &protocol.InitializedParams{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		// the server should close the connection after shutdown and exit
+		closeCtx, ca := context.WithTimeout(ctx, 10*time.Second)
+		defer ca()
+		if err := env.Server.Shutdown(closeCtx); err != nil {
+			t.Errorf("shutting down the server: %v", err)
+		}
+		if err := env.Server.Exit(closeCtx); err != nil {
+			t.Errorf("exiting the server: %v", err)
+		}
+		select {
+		case <-conn.Done():
+		case <-closeCtx.Done():
+			t.Errorf("connection not closed: %v", closeCtx.Err())
+		}
+	}()
+	test(t, env)
+}
+
+type loggingFramer struct {
+	mu  sync.Mutex
+	buf *safeBuffer
+}
+
+// safeBuffer is a threadsafe buffer for logs.
+type safeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (s *loggingFramer) framer(f jsonrpc2.Framer) jsonrpc2.Framer {
+	return func(nc net.Conn) jsonrpc2.Stream {
+		s.mu.Lock()
+		framed := false
+		if s.buf == nil {
+			s.buf = &safeBuffer{buf: bytes.Buffer{}}
+			framed = true
+		}
+		s.mu.Unlock()
+		stream := f(nc)
+		if framed {
+			return protocol.LoggingStream(stream, s.buf)
+		}
+		return stream
+	}
+}
+
+func (s *loggingFramer) printBuffers(testname string, w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.buf == nil {
+		return
+	}
+	fmt.Fprintf(w, "#### Start Test Logs for %q\n", testname)
+	s.buf.mu.Lock()
+	io.Copy(w, &s.buf.buf)
+	s.buf.mu.Unlock()
+	fmt.Fprintf(w, "#### End Test Logs for %q\n", testname)
+}
+
+// handle answers requests and notifications sent by the server.
+func (e *Env) handle(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	switch req.Method() {
+	case "workspace/configuration":
+		var params protocol.ParamConfiguration
+		if err := json.Unmarshal(req.Params(), &params); err != nil {
+			return reply(ctx, nil, err)
+		}
+		results := make([]any, len(params.Items))
+		for i := range results {
+			results[i] = e.settings
+		}
+		return reply(ctx, results, nil)
+	case "workspace/applyEdit":
+		var params protocol.ApplyWorkspaceEditParams
+		if err := json.Unmarshal(req.Params(), &params); err != nil {
+			return reply(ctx, nil, err)
+		}
+		if err := e.applyEdit(ctx, &params.Edit); err != nil {
+			return reply(ctx, &protocol.ApplyWorkspaceEditResult{FailureReason: err.Error()}, nil)
+		}
+		return reply(ctx, &protocol.ApplyWorkspaceEditResult{Applied: true}, nil)
+	case "textDocument/publishDiagnostics":
+		var params protocol.PublishDiagnosticsParams
+		if err := json.Unmarshal(req.Params(), &params); err != nil {
+			return reply(ctx, nil, err)
+		}
+		e.mu.Lock()
+		e.diagnostics[params.URI] = params.Diagnostics
+		close(e.published)
+		e.published = make(chan struct{})
+		e.mu.Unlock()
+		return reply(ctx, nil, nil)
+	}
+	// progress, registrations, refresh requests, and log messages need no
+	// handling of their own
+	return reply(ctx, nil, nil)
+}
@@ -0,0 +1,63 @@
+package lsptest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kralicky/protols/pkg/lsptest"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+func TestRun(t *testing.T) {
+	ws := lsptest.ParseTxtar(`
+-- a/a.proto --
+syntax = "proto3";
+package a;
+message A {}
+-- b/b.proto --
+syntax = "proto3";
+package b;
+import "a/a.proto";
+message B {
+  a.A a = 1;
+}
+`)
+	lsptest.Run(t, ws, func(t *testing.T, env *lsptest.Env) {
+		env.OpenFile("b/b.proto")
+		loc := env.RegexpSearch("b/b.proto", `a\.(A)`)
+		locations, err := env.Server.Definition(env.Ctx, &protocol.DefinitionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+				Position:     loc.Range.Start,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(locations) != 1 || locations[0].URI != env.URI("a/a.proto") {
+			t.Fatalf("unexpected definitions %v", locations)
+		}
+
+		// edits to files which are not open are applied to the workspace
+		edit, err := env.Server.Rename(env.Ctx, &protocol.RenameParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+			Position:     loc.Range.Start,
+			NewName:      "Renamed",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		env.ApplyEdit(edit)
+		if got := env.BufferText("b/b.proto"); !strings.Contains(got, "a.Renamed a = 1;") {
+			t.Errorf("unexpected b/b.proto:\n%s", got)
+		}
+		if got := env.ReadWorkspaceFile("a/a.proto"); !strings.Contains(got, "message Renamed {}") {
+			t.Errorf("unexpected a/a.proto:\n%s", got)
+		}
+
+		env.SetBufferContent("b/b.proto", strings.Replace(env.BufferText("b/b.proto"), "a.Renamed", "a.Missing", 1))
+		env.AwaitDiagnostics("b/b.proto", func(diagnostics []protocol.Diagnostic) bool {
+			return len(diagnostics) > 0
+		})
+	})
+}
@@ -0,0 +1,189 @@
+package protocolext
+
+import "github.com/kralicky/tools-lite/gopls/pkg/protocol"
+
+// SelectRangeParams is the argument of SelectRangeCommand.
+type SelectRangeParams struct {
+	// A range in the current document that should be selected. Setting the
+	// start and end position to the same location has the effect of
+	// moving the cursor to that location.
+	SelectRange protocol.Range `json:"selectRange"`
+	// A range in the current document that will be revealed by the editor.
+	RevealRange protocol.Range `json:"revealRange"`
+	// Whether to highlight the revealed range.
+	HighlightRevealedRange bool `json:"highlightRevealedRange"`
+}
+
+// SyntheticFileContentsRequest is the argument of SyntheticFileContentsCommand.
+type SyntheticFileContentsRequest struct {
+	// The URI of the file to update.
+	URI string `json:"uri"`
+}
+
+// DocumentASTRequest is the argument of DocumentASTCommand. The AST is
+// returned once the given version of the document has been compiled.
+type DocumentASTRequest struct {
+	// The URI of the file to retrieve the AST for.
+	URI     string `json:"uri"`
+	Version int32  `json:"version"`
+}
+
+type ReindexWorkspacesRequest struct{}
+
+// IndexWorkspaceRequest is the argument of IndexWorkspaceCommand.
+type IndexWorkspaceRequest struct {
+	// The workspace to compile. If empty, all workspaces are compiled.
+	Workspace protocol.WorkspaceFolder `json:"workspace,omitempty"`
+}
+
+// ExportIndexRequest is the argument of ExportIndexCommand.
+type ExportIndexRequest struct {
+	Workspace protocol.WorkspaceFolder `json:"workspace"`
+	// The file to write the index archive to.
+	Path string `json:"path"`
+}
+
+// ImportIndexRequest is the argument of ImportIndexCommand.
+type ImportIndexRequest struct {
+	Workspace protocol.WorkspaceFolder `json:"workspace"`
+	// The index archive to import.
+	Path string `json:"path"`
+}
+
+type BugReportRequest struct{}
+
+// PathMappingsRequest is the argument of PathMappingsCommand.
+type PathMappingsRequest struct {
+	// The workspace to list path mappings for. If empty, the mappings of all
+	// workspaces are listed.
+	Workspace protocol.WorkspaceFolder `json:"workspace,omitempty"`
+}
+
+type RefreshModulesRequest struct {
+	Workspace protocol.WorkspaceFolder `json:"workspace"`
+}
+
+// GeneratedDefinitionParams is the argument of GoToGeneratedDefinitionCommand.
+type GeneratedDefinitionParams struct {
+	protocol.TextDocumentPositionParams
+}
+
+// MessageMembersParams is the argument of MessageMembersCommand.
+type MessageMembersParams struct {
+	protocol.TextDocumentPositionParams
+}
+
+// DuplicateMessagesRequest is the argument of DuplicateMessagesCommand.
+type DuplicateMessagesRequest struct {
+	Workspace protocol.WorkspaceFolder `json:"workspace"`
+}
+
+// ServicesRequest is the argument of ServicesCommand.
+type ServicesRequest struct {
+	Workspace protocol.WorkspaceFolder `json:"workspace"`
+}
+
+// GenerateCodeRequest is the argument of GenerateCommand.
+type GenerateCodeRequest struct {
+	// The URIs of the files to generate code for. All URIs in this list must
+	// belong to the same workspace; the server will look at the first URI in
+	// the list to determine which workspace to use.
+	URIs []protocol.DocumentURI `json:"uris"`
+}
+
+// GenerateWorkspaceRequest is the argument of GenerateWorkspaceCommand.
+type GenerateWorkspaceRequest struct {
+	Workspace protocol.WorkspaceFolder `json:"workspace"`
+}
+
+// AddFieldsFromJSONRequest is the argument of AddFieldsFromJSONCommand.
+type AddFieldsFromJSONRequest struct {
+	protocol.TextDocumentPositionParams
+	// A JSON object containing the fields to add to the message at the given
+	// position.
+	JSON string `json:"json"`
+}
+
+// MessageFromGoStructRequest is the argument of MessageFromGoStructCommand.
+type MessageFromGoStructRequest struct {
+	protocol.TextDocumentPositionParams
+	// Go source containing one or more struct declarations. If TypeName is
+	// empty, the first struct in the source is converted.
+	Source string `json:"source,omitempty"`
+	// The name of the struct to convert. If Source is empty, this must be a
+	// qualified name (e.g. "example.com/foo/bar.Baz") which will be resolved
+	// using the workspace's Go module.
+	TypeName string `json:"typeName,omitempty"`
+}
+
+// ExtractToFileRequest is the argument of ExtractToFileCommand.
+type ExtractToFileRequest struct {
+	protocol.TextDocumentPositionParams
+	// The name of the new file, relative to the directory of the original file.
+	// If empty, the file is named after the declaration at the given position.
+	Filename string `json:"filename,omitempty"`
+}
+
+// SplitFileRequest is the argument of SplitFileCommand and
+// ProposeFileSplitCommand.
+type SplitFileRequest struct {
+	URI protocol.DocumentURI `json:"uri"`
+	// The groups of declarations to move into new files. If empty, the
+	// proposed split is used.
+	Groups []FileSplitGroup `json:"groups,omitempty"`
+	// If true, a preview of the edit is returned along with it, as a
+	// FileSplitResult. Otherwise, the result is a NewFilesEdit.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// SetImportPrecedenceRequest is the argument of SetImportPrecedenceCommand.
+type SetImportPrecedenceRequest struct {
+	// The order in which import sources are tried for the rest of the session,
+	// overriding the importPrecedence setting. Sources which are not listed
+	// follow the listed ones in their default order. If empty, the setting is
+	// used again.
+	Precedence []string `json:"precedence"`
+}
+
+// ReresolveRequest is the argument of ReresolveCommand.
+type ReresolveRequest struct {
+	URI protocol.DocumentURI `json:"uri"`
+}
+
+// MetricsRequest is the argument of MetricsCommand.
+type MetricsRequest struct {
+	// The number of slowest files to include. Defaults to 10.
+	SlowestFiles int `json:"slowestFiles,omitempty"`
+}
+
+// FileInfoRequest is the argument of FileInfoCommand.
+type FileInfoRequest struct {
+	URI protocol.DocumentURI `json:"uri"`
+}
+
+// SmokeTestsRequest is the argument of SmokeTestsCommand.
+type SmokeTestsRequest struct {
+	Workspace protocol.WorkspaceFolder `json:"workspace"`
+}
+
+// RunSmokeTestsRequest is the argument of RunSmokeTestsCommand.
+type RunSmokeTestsRequest struct {
+	Workspace protocol.WorkspaceFolder `json:"workspace"`
+	// IDs of the tests to run. If empty, all tests are run.
+	IDs []string `json:"ids,omitempty"`
+	// Overrides the smokeTests.endpoint setting.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// MakeEditableCopyRequest is the argument of MakeEditableCopyCommand.
+type MakeEditableCopyRequest struct {
+	// The URI of the read-only file to copy.
+	URI protocol.DocumentURI `json:"uri"`
+}
+
+// PreviewRenameRequest is the argument of PreviewRenameCommand.
+type PreviewRenameRequest struct {
+	protocol.RenameParams
+	// The maximum number of snippets to include for each file. Defaults to 3.
+	MaxSnippets int `json:"maxSnippets,omitempty"`
+}
@@ -0,0 +1,30 @@
+package protocolext
+
+import "github.com/kralicky/tools-lite/gopls/pkg/protocol"
+
+// ReadOnlyFileParams are the parameters of ReadOnlyFileNotification.
+type ReadOnlyFileParams struct {
+	URI protocol.DocumentURI `json:"uri"`
+	// A human-readable explanation of why the file is read-only.
+	Reason string `json:"reason"`
+}
+
+// ReadFileParams are the parameters of ReadFileRequest.
+type ReadFileParams struct {
+	URI protocol.DocumentURI `json:"uri"`
+}
+
+// ServerErrorParams are the parameters of a protols/serverError notification.
+type ServerErrorParams struct {
+	// Method is the method of the message which caused the panic.
+	Method string `json:"method"`
+	// Message is the value passed to panic.
+	Message string `json:"message"`
+	// Stack is the stack trace of the goroutine which panicked.
+	Stack string `json:"stack"`
+}
+
+// ReadFileResult is the result of ReadFileRequest.
+type ReadFileResult struct {
+	Contents string `json:"contents"`
+}
@@ -0,0 +1,126 @@
+// Package protocolext defines the extensions protols makes to the language
+// server protocol: the commands it accepts through workspace/executeCommand,
+// the notifications and requests it sends to the client, and the types of
+// their parameters and results. Client extensions written in Go can depend on
+// this package instead of the server.
+//
+// Changes to the methods and types in this package are backwards compatible
+// within a version: fields may be added, but not removed or changed. The
+// version is advertised in the experimental capabilities of the server's
+// initialize result, under the "protocolext" key.
+package protocolext
+
+// Version is the version of the protocol extensions implemented by the server.
+const Version = "1"
+
+// ExperimentalCapability is the key of the version in the server's
+// experimental capabilities.
+const ExperimentalCapability = "protocolext"
+
+// Commands accepted by workspace/executeCommand. Unless noted otherwise, each
+// command takes a single argument of the type named after it, e.g.
+// SyntheticFileContentsRequest for SyntheticFileContentsCommand.
+const (
+	// Returns the contents of a synthetic file as a string.
+	SyntheticFileContentsCommand = "protols/syntheticFileContents"
+	// Returns a text dump of the AST of a document.
+	DocumentASTCommand = "protols/ast"
+	// Discards and recreates the caches of all workspaces. Takes no arguments.
+	ReindexWorkspacesCommand = "protols/reindexWorkspaces"
+	// Compiles all files in a workspace, or in all workspaces. The argument
+	// is optional.
+	IndexWorkspaceCommand = "protols/indexWorkspace"
+	// Writes the index archive of a workspace to a file.
+	ExportIndexCommand = "protols/exportIndex"
+	// Loads synthetic files from an index archive. Returns the number of
+	// files loaded.
+	ImportIndexCommand = "protols/importIndex"
+	// Reloads the go modules required by each workspace. Takes no arguments.
+	RefreshModulesCommand = "protols/refreshModules"
+	// Overrides the importPrecedence setting. Returns []ImportConflict.
+	SetImportPrecedenceCommand = "protols/setImportPrecedence"
+	// Resolves the imports of a file again.
+	ReresolveCommand = "protols/reresolve"
+	// Returns a bug report as a markdown string. Takes no arguments.
+	BugReportCommand = "protols/bugReport"
+	// Returns Metrics. The argument is optional.
+	MetricsCommand = "protols/metrics"
+	// Returns the FileInfo of a file.
+	FileInfoCommand = "protols/fileInfo"
+	// Returns []WorkspacePathMappings. The argument is PathMappingsRequest,
+	// and is optional.
+	PathMappingsCommand = "protols/paths"
+	// Returns the locations of the generated Go code for the declaration at a
+	// position, as []protocol.Location. The argument is
+	// GeneratedDefinitionParams.
+	GoToGeneratedDefinitionCommand = "protols/goToGeneratedDefinition"
+	// Returns the locations of the members of the message at a position, as
+	// []protocol.Location. The argument is MessageMembersParams.
+	MessageMembersCommand = "protols/messageMembers"
+	// Returns the groups of structurally identical messages in a workspace.
+	DuplicateMessagesCommand = "protols/duplicateMessages"
+	// Returns the services in a workspace and their methods.
+	ServicesCommand = "protols/services"
+	// Returns the smoke tests found in a workspace.
+	SmokeTestsCommand = "protols/smokeTests"
+	// Runs smoke tests, sending a SmokeTestResultNotification as each one
+	// completes. Returns []SmokeTestResult.
+	RunSmokeTestsCommand = "protols/runSmokeTests"
+	// Copies a read-only file into the workspace. Returns the URI of the copy.
+	MakeEditableCopyCommand = "protols/makeEditableCopy"
+	// Adds fields to a message from a JSON object, applying the edit with
+	// workspace/applyEdit.
+	AddFieldsFromJSONCommand = "protols/addFieldsFromJSON"
+	// Returns a preview of the edit a rename would make.
+	PreviewRenameCommand = "protols/previewRename"
+	// Moves the declaration at a position into a new file.
+	ExtractToFileCommand = "protols/extractToFile"
+	// Returns a FileSplitProposal for a file. The argument is
+	// SplitFileRequest, of which only the URI is used.
+	ProposeFileSplitCommand = "protols/proposeFileSplit"
+	// Splits a file into several new files.
+	SplitFileCommand = "protols/splitFile"
+	// Converts a Go struct into a message.
+	MessageFromGoStructCommand = "protols/messageFromGoStruct"
+	// Generates code for a set of files. The argument is GenerateCodeRequest.
+	GenerateCommand = "protols/generate"
+	// Generates code for all files in a workspace.
+	GenerateWorkspaceCommand = "protols/generateWorkspace"
+)
+
+// Commands the server asks the client to execute, from code lenses and code
+// actions. Clients are expected to forward the generate and extract commands
+// to the corresponding server commands, after any user interaction they need.
+const (
+	// Selects and reveals a range in the current document. The argument is
+	// SelectRangeParams.
+	SelectRangeCommand = "protols.api.selectRange"
+	// Forwarded to GenerateCommand, with the same argument.
+	ClientGenerateCommand = "protols.generate"
+	// Forwarded to GenerateWorkspaceCommand, with the same argument.
+	ClientGenerateWorkspaceCommand = "protols.generateWorkspace"
+	// Forwarded to ExtractToFileCommand, with the same argument.
+	ClientExtractToFileCommand = "protols.extractToFile"
+)
+
+// Notifications and requests sent from the server to the client.
+const (
+	// ReadOnlyFileNotification is sent to the client when a file is opened
+	// which cannot be edited, such as a file in the Go module cache. Edits to
+	// these files would never be picked up by the go toolchain, so the client
+	// should prevent them, and can offer to make an editable copy instead.
+	// The parameters are ReadOnlyFileParams.
+	ReadOnlyFileNotification = "protols/readOnlyFile"
+	// SmokeTestResultNotification is sent to the client with a
+	// SmokeTestResult each time a smoke test run by RunSmokeTestsCommand
+	// completes.
+	SmokeTestResultNotification = "protols/smokeTestResult"
+	// ServerErrorNotification is sent to the client when the server recovers
+	// from a panic while handling a message. The parameters are
+	// ServerErrorParams.
+	ServerErrorNotification = "protols/serverError"
+	// ReadFileRequest is sent to the client in remote mode to read the
+	// contents of a workspace file which is not open in the editor. The
+	// parameters are ReadFileParams, and the result is ReadFileResult.
+	ReadFileRequest = "protols/readFile"
+)
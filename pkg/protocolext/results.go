@@ -0,0 +1,233 @@
+package protocolext
+
+import (
+	"encoding/json"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// ImportConflict describes an import path which can be resolved from more
+// than one source, and which of them was chosen.
+type ImportConflict struct {
+	Path string `json:"path"`
+	// The source the file was resolved from: "workspace" or "goModule".
+	Chosen string `json:"chosen"`
+	// The file in the workspace providing the path.
+	WorkspaceURI protocol.DocumentURI `json:"workspaceURI"`
+	// The go module providing the path.
+	GoModule GoModuleInfo `json:"goModule"`
+}
+
+// FileInfo describes where a file was found by the resolver. It is returned
+// by the protols/fileInfo command.
+type FileInfo struct {
+	URI protocol.DocumentURI `json:"uri"`
+	// The canonical import path of the file.
+	Path string `json:"path"`
+	// How the file was found, such as "relative path" or "synthetic".
+	Source string `json:"source"`
+	// For synthetic files, the name of the file in the descriptor they were
+	// generated from, if it differs from the canonical path.
+	OriginalName string `json:"originalName,omitempty"`
+	// The import path the file was requested with, if it differs from the
+	// canonical path, and how it was mapped to the canonical path.
+	RequestedPath string `json:"requestedPath,omitempty"`
+	Resolution    string `json:"resolution,omitempty"`
+	// The go module containing the file, or the generated code it was
+	// synthesized from.
+	GoModule *GoModuleInfo `json:"goModule,omitempty"`
+}
+
+// GoModuleInfo describes a go module providing a file.
+type GoModuleInfo struct {
+	Path    string `json:"path"`
+	Version string `json:"version,omitempty"`
+	Dir     string `json:"dir,omitempty"`
+	// All versions of the module required in the build graph, if there is
+	// more than one. Only Version is used in the build.
+	RequiredVersions []string `json:"requiredVersions,omitempty"`
+}
+
+// PathMapping is an entry in the resolver's table of canonical import paths.
+type PathMapping struct {
+	URI    protocol.DocumentURI `json:"uri"`
+	Path   string               `json:"path"`
+	Source string               `json:"source"`
+	// Inconsistent is set if the mapping only exists in one direction, i.e.
+	// the path does not map back to the URI or vice versa. This usually means
+	// a file was moved or deleted without the mappings being updated.
+	Inconsistent bool `json:"inconsistent,omitempty"`
+}
+
+// WorkspacePathMappings contains the path mappings of a single workspace.
+type WorkspacePathMappings struct {
+	Workspace string        `json:"workspace"`
+	Mappings  []PathMapping `json:"mappings"`
+}
+
+// Metrics is a snapshot of the performance counters of the server process,
+// returned by the protols/metrics command.
+type Metrics struct {
+	// Time spent in each stage, in the order: resolve (finding the source of
+	// an import path), compile (parsing, linking and interpreting options of a
+	// single file, which the compiler does not time separately), index
+	// (updating the reference index) and lint (running lint rules and
+	// validating option values).
+	Stages []StageTiming `json:"stages"`
+	// Lookups of import paths which were already mapped to a file (hits), or
+	// had to be searched for (misses).
+	ResolverHits   int64 `json:"resolverHits"`
+	ResolverMisses int64 `json:"resolverMisses"`
+	// The number of files compiled, the number of compilations they were
+	// compiled in, and the number of requests which were served by a
+	// compilation that had already been requested.
+	FilesCompiled         int64        `json:"filesCompiled"`
+	Compilations          int64        `json:"compilations"`
+	CompilationsCoalesced int64        `json:"compilationsCoalesced"`
+	Memory                MemoryUsage  `json:"memory"`
+	SlowestFiles          []FileTiming `json:"slowestFiles"`
+}
+
+// StageTiming is the time spent in one stage of compilation.
+type StageTiming struct {
+	Stage   string  `json:"stage"`
+	Count   int64   `json:"count"`
+	TotalMs float64 `json:"totalMs"`
+	MeanMs  float64 `json:"meanMs"`
+	MaxMs   float64 `json:"maxMs"`
+}
+
+// MemoryUsage is a summary of the memory statistics of the server process.
+type MemoryUsage struct {
+	HeapAllocBytes uint64 `json:"heapAllocBytes"`
+	HeapInuseBytes uint64 `json:"heapInuseBytes"`
+	SysBytes       uint64 `json:"sysBytes"`
+	NumGC          uint32 `json:"numGC"`
+}
+
+// FileTiming is the duration of the most recent compilation of a file.
+type FileTiming struct {
+	Path         string  `json:"path"`
+	Milliseconds float64 `json:"milliseconds"`
+}
+
+// A FileSplitGroup is a set of top-level declarations to be moved into a new
+// file together.
+type FileSplitGroup struct {
+	// The name of the new file, relative to the directory of the original file.
+	Filename string `json:"filename"`
+	// The names of the top-level messages, enums, and services to move.
+	Declarations []string `json:"declarations"`
+}
+
+// FileSplitProposal is the result of ProposeFileSplitCommand.
+type FileSplitProposal struct {
+	Groups []FileSplitGroup `json:"groups"`
+	// The declarations which stay in the original file.
+	Remaining []string `json:"remaining"`
+}
+
+// SmokeTestResult is the outcome of running a smoke test.
+type SmokeTestResult struct {
+	ID     string `json:"id"`
+	Passed bool   `json:"passed"`
+	// The responses received, in text format. Server streaming methods may
+	// receive any number of responses.
+	Responses  []string `json:"responses,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	DurationMs int64    `json:"durationMs"`
+}
+
+// A Service describes a service declared in the workspace.
+type Service struct {
+	Name       string            `json:"name"`
+	Path       string            `json:"path"`
+	Location   protocol.Location `json:"location"`
+	Deprecated bool              `json:"deprecated,omitempty"`
+	// The service's options, in protojson format. Custom options are keyed
+	// by their bracketed extension names, e.g. "[google.api.default_host]".
+	Annotations json.RawMessage `json:"annotations,omitempty"`
+	Methods     []Method        `json:"methods"`
+}
+
+// A Method describes a method of a Service.
+type Method struct {
+	Name string `json:"name"`
+	// The method's path on the wire, e.g. "/foo.v1.FooService/GetFoo".
+	FullPath        string            `json:"fullPath"`
+	Location        protocol.Location `json:"location"`
+	RequestType     string            `json:"requestType"`
+	ResponseType    string            `json:"responseType"`
+	ClientStreaming bool              `json:"clientStreaming,omitempty"`
+	ServerStreaming bool              `json:"serverStreaming,omitempty"`
+	Deprecated      bool              `json:"deprecated,omitempty"`
+	// The method's options, in protojson format.
+	Annotations json.RawMessage `json:"annotations,omitempty"`
+}
+
+// A DuplicateMessageGroup contains messages which are structurally identical:
+// they have the same fields, types and options, and differ only in name.
+type DuplicateMessageGroup struct {
+	Messages []DuplicateMessage `json:"messages"`
+}
+
+// A DuplicateMessage is a member of a DuplicateMessageGroup.
+type DuplicateMessage struct {
+	Name     string            `json:"name"`
+	Location protocol.Location `json:"location"`
+}
+
+// WorkspaceEditPreview summarizes the changes a workspace edit would make,
+// so that large refactors can be reviewed before they are applied.
+type WorkspaceEditPreview struct {
+	// The edit being previewed, which can be applied by the client once the
+	// preview is confirmed.
+	Edit *protocol.WorkspaceEdit `json:"edit"`
+	// The total number of text edits in all files.
+	TotalEdits int `json:"totalEdits"`
+	// The files touched by the edit, sorted by path.
+	Files []FileEditPreview `json:"files"`
+}
+
+// FileEditPreview summarizes the changes an edit makes to a single file.
+type FileEditPreview struct {
+	URI protocol.DocumentURI `json:"uri"`
+	// The path of the file relative to its import root, if known.
+	Path string `json:"path,omitempty"`
+	// The number of text edits in the file.
+	Edits int `json:"edits"`
+	// If the edit moves the file, its new location.
+	RenamedTo protocol.DocumentURI `json:"renamedTo,omitempty"`
+	// Whether the file is created by the edit.
+	Created bool `json:"created,omitempty"`
+	// Lines changed by the edit, before and after it is applied.
+	Snippets []EditSnippet `json:"snippets,omitempty"`
+}
+
+// An EditSnippet shows lines changed by an edit.
+type EditSnippet struct {
+	// The zero-based line number of the first changed line.
+	Line   uint32 `json:"line"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// NewFilesEdit is a workspace edit which also creates new files. The server
+// does not apply it; the client creates each of the files with its contents
+// and applies the edit, as a single operation if it can.
+type NewFilesEdit struct {
+	Files []NewFile               `json:"files"`
+	Edit  *protocol.WorkspaceEdit `json:"edit"`
+}
+
+// A NewFile is a file created by a NewFilesEdit.
+type NewFile struct {
+	URI     protocol.DocumentURI `json:"uri"`
+	Content string               `json:"content"`
+}
+
+// FileSplitResult is the result of SplitFileCommand when DryRun is set.
+type FileSplitResult struct {
+	Edit    *NewFilesEdit         `json:"edit"`
+	Preview *WorkspaceEditPreview `json:"preview"`
+}
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/sources"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+// BuildBugReportCmd represents the bugreport command
+func BuildBugReportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bugreport",
+		Short: "Prints information about the environment and workspace to include in bug reports",
+		Long: `
+Loads the workspace in the current directory and prints a markdown report
+containing version information, the Go toolchain environment, workspace and
+resolver statistics, and the logs written while loading the workspace.
+
+The same report can be generated from a running server with the
+protols/bugReport command.
+`[1:],
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			// logs are only written to the report
+			slog.SetDefault(slog.New(lsp.DefaultLogTail.Handler(slog.NewTextHandler(io.Discard, nil), slog.LevelInfo)))
+
+			cache := lsp.NewCache(protocol.WorkspaceFolder{
+				URI:  string(protocol.URIFromPath(cwd)),
+				Name: cwd,
+			})
+			cache.LoadFiles(sources.SearchDirs(cwd))
+			lsp.WriteBugReport(cmd.Context(), cmd.OutOrStdout(), []*lsp.Cache{cache}, lsp.DefaultLogTail)
+			return nil
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/sources"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// defaultIndexFile is the index archive written by export-index by default.
+// If it exists in the current directory, message names are completed from it
+// instead of compiling the workspace.
+const defaultIndexFile = "protols-index.zip"
+
+// BuildCompletionCmd represents the completion command
+func BuildCompletionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "completion [bash|zsh|fish|powershell]",
+		Short: "Generates shell completion scripts",
+		Long: `
+Prints a completion script for the given shell. In addition to subcommands and
+flags, the generated completions include proto file paths and message names
+found in the workspace in the current directory, for flags such as
+'protols decode --type' and 'protols query --file'.
+
+Message names are read from the index archive written by 'protols export-index'
+(` + defaultIndexFile + `) if it exists in the current directory; otherwise the
+workspace is compiled each time they are completed, which may be slow in large
+workspaces.
+
+Examples:
+  source <(protols completion bash)
+  protols completion zsh > "${fpath[1]}/_protols"
+  protols completion fish > ~/.config/fish/completions/protols.fish
+`[1:],
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := cmd.Root()
+			out := cmd.OutOrStdout()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(out, true)
+			case "zsh":
+				return root.GenZshCompletion(out)
+			case "fish":
+				return root.GenFishCompletion(out, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(out)
+			default:
+				return fmt.Errorf("unsupported shell %q", args[0])
+			}
+		},
+	}
+	return cmd
+}
+
+// completeProtoFiles completes the paths of proto files in the workspace,
+// relative to the current directory.
+func completeProtoFiles(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var paths []string
+	for _, path := range sources.SearchDirs(cwd) {
+		rel, err := filepath.Rel(cwd, path)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(rel, toComplete) {
+			paths = append(paths, rel)
+		}
+	}
+	slices.Sort(paths)
+	return paths, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeMessageNames completes the full names of messages in the workspace,
+// with the file declaring each message as its description.
+func completeMessageNames(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	names := indexedMessageNames(defaultIndexFile)
+	if names == nil {
+		names = compiledMessageNames()
+	}
+	var completions []string
+	for _, name := range names {
+		if strings.HasPrefix(name, toComplete) {
+			completions = append(completions, name)
+		}
+	}
+	slices.Sort(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// indexedMessageNames returns the names of messages in the given index
+// archive, or nil if it could not be read.
+func indexedMessageNames(filename string) []string {
+	_, set, err := lsp.ReadIndexFile(filename)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	var walk func(prefix string, file string, msgs []*descriptorpb.DescriptorProto)
+	walk = func(prefix string, file string, msgs []*descriptorpb.DescriptorProto) {
+		for _, msg := range msgs {
+			if msg.GetOptions().GetMapEntry() {
+				continue
+			}
+			name := prefix + msg.GetName()
+			names = append(names, name+"\t"+file)
+			walk(name+".", file, msg.GetNestedType())
+		}
+	}
+	for _, fd := range set.GetFile() {
+		prefix := ""
+		if pkg := fd.GetPackage(); pkg != "" {
+			prefix = pkg + "."
+		}
+		walk(prefix, fd.GetName(), fd.GetMessageType())
+	}
+	return names
+}
+
+// compiledMessageNames compiles the workspace in the current directory and
+// returns the names of its messages, as found by decode.
+func compiledMessageNames() []string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	cache := lsp.NewCache(protocol.WorkspaceFolder{
+		URI: string(protocol.URIFromPath(cwd)),
+	})
+	defer cache.Close(nil)
+	cache.LoadFiles(sources.SearchDirs(cwd))
+	var names []string
+	var walk func(d protoreflect.MessageDescriptor)
+	walk = func(d protoreflect.MessageDescriptor) {
+		if d.IsMapEntry() {
+			return
+		}
+		names = append(names, string(d.FullName())+"\t"+d.ParentFile().Path())
+		nested := d.Messages()
+		for i, l := 0, nested.Len(); i < l; i++ {
+			walk(nested.Get(i))
+		}
+	}
+	for _, d := range cache.XGetAllMessages() {
+		walk(d)
+	}
+	return names
+}
@@ -72,6 +72,8 @@ will be printed instead.
 	}
 	cmd.Flags().StringVarP(&msgType, "type", "t", "", "The message type to use when decoding")
 	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text|json)")
+	cmd.RegisterFlagCompletionFunc("type", completeMessageNames)
+	cmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions([]string{"text", "json"}, cobra.ShellCompDirectiveNoFileComp))
 	return cmd
 }
 
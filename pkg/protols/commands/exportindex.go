@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/sources"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+// BuildExportIndexCmd represents the export-index command
+func BuildExportIndexCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "export-index",
+		Short: "Exports the compiled descriptors of the workspace to an index archive",
+		Long: `
+Loads and compiles the workspace in the current directory and writes the
+descriptors of all compiled files, including synthetic files generated from Go
+sources, to a zip archive.
+
+The archive can be committed or distributed alongside a large proto
+repository, and imported in another checkout by setting the indexArchive
+setting to its path. Synthetic files are then loaded from the archive instead
+of being generated from Go sources, which is usually the slowest part of
+loading a workspace. The archive records the hash of the workspace's go.sum,
+and is ignored if the dependencies of the importing checkout differ.
+`[1:],
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			cache := lsp.NewCache(protocol.WorkspaceFolder{
+				URI:  string(protocol.URIFromPath(cwd)),
+				Name: cwd,
+			})
+			cache.LoadFiles(sources.SearchDirs(cwd))
+
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			if err := cache.ExportIndex(f); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "protols-index.zip", "the file to write the index archive to")
+	return cmd
+}
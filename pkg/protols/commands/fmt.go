@@ -9,20 +9,26 @@ import (
 // FmtCmd represents the fmt command
 func BuildFmtCmd() *cobra.Command {
 	var write bool
+	var options format.FormatterOptions
 	cmd := &cobra.Command{
-		Use:   "fmt [filenames...]",
-		Short: "Format proto source files",
+		Use:               "fmt [filenames...]",
+		Short:             "Format proto source files",
+		ValidArgsFunction: completeProtoFiles,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var eg errgroup.Group
 			for _, filename := range args {
 				filename := filename
 				eg.Go(func() error {
-					return format.FileInPlace(filename)
+					return format.FileInPlaceWithOptions(filename, options)
 				})
 			}
 			return eg.Wait()
 		},
 	}
 	cmd.Flags().BoolVarP(&write, "write", "w", false, "write result to (source) file instead of stdout")
+	cmd.Flags().StringVar(&options.Indent, "indent", "  ", "string written for each level of indentation")
+	cmd.Flags().BoolVar(&options.DisableColumnAlignment, "no-align", false, "do not align fields, enum values and options into columns")
+	cmd.Flags().IntVar(&options.ExpandCompactOptions, "expand-options", 0, "write compact options with at least this many options one per line (0 to only expand multi-line options)")
+	cmd.Flags().IntVar(&options.CommentWidth, "comment-width", 0, "rewrap line comments preceding declarations to this many columns (0 to disable)")
 	return cmd
 }
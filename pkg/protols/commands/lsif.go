@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/sources"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+// BuildLSIFCmd represents the lsif command
+func BuildLSIFCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "lsif",
+		Short: "Writes an LSIF index of the workspace's proto symbols",
+		Long: `
+Loads and compiles the workspace in the current directory and writes an LSIF
+dump of its definitions and references, for use by code intelligence
+services. Every symbol has a moniker with the "protobuf" scheme and the
+symbol's fully-qualified name as its identifier; symbols defined in the
+workspace are exported, and symbols defined in dependencies are imported, so
+that references between dumps of different repositories can be resolved.
+
+The dump can be converted to a SCIP index with 'scip convert --from <file>'.
+`[1:],
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			cache := lsp.NewCache(protocol.WorkspaceFolder{
+				URI:  string(protocol.URIFromPath(cwd)),
+				Name: cwd,
+			})
+			cache.LoadFiles(sources.SearchDirs(cwd))
+
+			out := cmd.OutOrStdout()
+			if output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			bw := bufio.NewWriter(out)
+			if err := cache.ExportLSIF(cmd.Context(), bw); err != nil {
+				return err
+			}
+			return bw.Flush()
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "dump.lsif", "the file to write the dump to, or - for stdout")
+	return cmd
+}
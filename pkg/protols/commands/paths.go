@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/sources"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+// BuildPathsCmd represents the paths command
+func BuildPathsCmd() *cobra.Command {
+	var jsonOutput bool
+	cmd := &cobra.Command{
+		Use:   "paths",
+		Short: "Prints the mappings between file URIs and canonical import paths",
+		Long: `
+Loads the workspace in the current directory and prints the resolver's table
+of file URIs and the canonical import paths they are known by, along with
+where each file was found (well-known, relative path, local go module, go
+module cache, or synthetic). Mappings which only exist in one direction are
+marked with an asterisk.
+
+This is useful for debugging imports which cannot be found because a file
+was canonicalized to an unexpected path. The same table can be retrieved from
+a running server with the protols/paths command.
+`[1:],
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			cache := lsp.NewCache(protocol.WorkspaceFolder{
+				URI:  string(protocol.URIFromPath(cwd)),
+				Name: cwd,
+			})
+			cache.LoadFiles(sources.SearchDirs(cwd))
+			workspaces := []lsp.WorkspacePathMappings{cache.PathMappings()}
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(workspaces)
+			}
+			return lsp.WritePathMappings(cmd.OutOrStdout(), workspaces)
+		},
+	}
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "print the mappings as json")
+	return cmd
+}
@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/sources"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+// BuildQueryCmd represents the query command
+func BuildQueryCmd() *cobra.Command {
+	var file string
+	var line, col int
+	cmd := &cobra.Command{
+		Use:   "query",
+		Short: "Runs a single language server query and prints the result as JSON",
+		Long: `
+Loads and compiles the workspace in the current directory, runs a single
+language server query, and prints the result to stdout as JSON, in the form of
+the corresponding LSP response. This allows scripts and simple editor
+integrations to use protols without implementing an LSP client.
+
+Positions given with --line and --col are 1-based, as shown by most editors
+and in compiler errors. Positions and ranges in the output are 0-based, as in
+the LSP specification. A query with no result prints null.
+
+Examples:
+  protols query definition --file foo/bar.proto --line 10 --col 4
+  protols query references --file foo/bar.proto --line 10 --col 4
+  protols query hover --file foo/bar.proto --line 10 --col 4
+  protols query symbols --file foo/bar.proto
+  protols query symbols --query Bar
+`[1:],
+	}
+	cmd.PersistentFlags().StringVarP(&file, "file", "f", "", "the file to query")
+	cmd.PersistentFlags().IntVarP(&line, "line", "l", 0, "the line number of the position to query (1-based)")
+	cmd.PersistentFlags().IntVarP(&col, "col", "c", 0, "the column number of the position to query (1-based)")
+	cmd.RegisterFlagCompletionFunc("file", completeProtoFiles)
+
+	position := func() (protocol.TextDocumentPositionParams, error) {
+		if file == "" {
+			return protocol.TextDocumentPositionParams{}, errors.New("--file is required")
+		}
+		if line < 1 || col < 1 {
+			return protocol.TextDocumentPositionParams{}, errors.New("--line and --col are required, and must be at least 1")
+		}
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return protocol.TextDocumentPositionParams{}, err
+		}
+		return protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: protocol.URIFromPath(abs)},
+			Position:     protocol.Position{Line: uint32(line - 1), Character: uint32(col - 1)},
+		}, nil
+	}
+
+	var includeDeclaration bool
+	references := &cobra.Command{
+		Use:   "references",
+		Short: "Prints the locations of references to the symbol at a position",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params, err := position()
+			if err != nil {
+				return err
+			}
+			return runQuery(cmd, func(ctx context.Context, c *lsp.Cache) (any, error) {
+				return c.FindReferences(ctx, c.Snapshot(), params, protocol.ReferenceContext{IncludeDeclaration: includeDeclaration})
+			})
+		},
+	}
+	references.Flags().BoolVar(&includeDeclaration, "include-declaration", false, "include the symbol's declaration in the results")
+
+	var query string
+	symbols := &cobra.Command{
+		Use:   "symbols",
+		Short: "Prints the symbols in a file, or the workspace symbols matching a query",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return runQuery(cmd, func(ctx context.Context, c *lsp.Cache) (any, error) {
+					return c.QueryWorkspaceSymbols(ctx, query), nil
+				})
+			}
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return err
+			}
+			return runQuery(cmd, func(ctx context.Context, c *lsp.Cache) (any, error) {
+				return c.DocumentSymbolsForFile(c.Snapshot(), protocol.URIFromPath(abs))
+			})
+		},
+	}
+	symbols.Flags().StringVarP(&query, "query", "q", "", "the workspace symbol query, if --file is not set")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "definition",
+			Short: "Prints the location of the definition of the symbol at a position",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				params, err := position()
+				if err != nil {
+					return err
+				}
+				return runQuery(cmd, func(ctx context.Context, c *lsp.Cache) (any, error) {
+					return c.FindDefinitions(ctx, c.Snapshot(), params)
+				})
+			},
+		},
+		references,
+		&cobra.Command{
+			Use:   "hover",
+			Short: "Prints the hover contents for the symbol at a position",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				params, err := position()
+				if err != nil {
+					return err
+				}
+				return runQuery(cmd, func(ctx context.Context, c *lsp.Cache) (any, error) {
+					return c.ComputeHover(ctx, c.Snapshot(), params)
+				})
+			},
+		},
+		symbols,
+	)
+	return cmd
+}
+
+// runQuery loads the workspace in the current directory, runs the query, and
+// prints its result as indented JSON.
+func runQuery(cmd *cobra.Command, query func(context.Context, *lsp.Cache) (any, error)) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	cache := lsp.NewCache(protocol.WorkspaceFolder{
+		URI:  string(protocol.URIFromPath(cwd)),
+		Name: cwd,
+	})
+	cache.LoadFiles(sources.SearchDirs(cwd))
+
+	result, err := query(cmd.Context(), cache)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
@@ -7,10 +7,13 @@ import (
 	"io"
 	"log/slog"
 	"net"
+	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/kralicky/protols/pkg/lsp"
 	"github.com/kralicky/protols/pkg/lsprpc"
 	"github.com/kralicky/tools-lite/pkg/event"
 	"github.com/kralicky/tools-lite/pkg/event/core"
@@ -70,16 +73,58 @@ func (s *stdioAddr) String() string {
 
 // ServeCmd represents the serve command
 func BuildServeCmd() *cobra.Command {
-	var pipe string
+	var pipe, listen string
 	var stdio bool
+	var idleTimeout time.Duration
+	var debugAddr string
+	var sandbox bool
+	var watch, jsonStream bool
+	var watchInterval time.Duration
 	cmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Start the language server",
+		Long: `
+Starts the language server, communicating with an LSP client over stdin/stdout
+(--stdio) or a unix socket (--pipe).
+
+With --listen, the server instead accepts any number of client connections on
+a TCP address, or a unix socket if the address is prefixed with "unix;". Each
+client is served independently. With --idle-timeout, the server exits once no
+client has been connected for the given duration.
+
+With --watch, no LSP client is used. Instead, the workspace in the current
+directory is compiled and linted, and then checked again each time a proto
+file is created, changed, or deleted. The diagnostics for the workspace are
+printed after each check, in the form "path:line:col: severity: message",
+followed by a summary line. This is useful in a terminal alongside an editor
+which does not support LSP. With --json-stream, each check instead prints a
+single line of JSON, for consumption by other tools:
+
+  {"time": "...", "changed": ["foo/bar.proto"], "errors": 1, "warnings": 0,
+   "files": [{"path": "foo/bar.proto", "uri": "file:///...", "diagnostics": [...]}]}
+
+Diagnostics in the JSON output are LSP diagnostics, with 0-based positions.
+`[1:],
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if watch {
+				if stdio || pipe != "" {
+					return errors.New("--watch cannot be used with --stdio or --pipe")
+				}
+				return runWatch(cmd.Context(), cmd.OutOrStdout(), watchInterval, jsonStream, sandbox)
+			}
+			if jsonStream {
+				return errors.New("--json-stream requires --watch")
+			}
+			if listen != "" && (stdio || pipe != "") {
+				return errors.New("--listen cannot be used with --stdio or --pipe")
+			}
+			if idleTimeout > 0 && listen == "" {
+				return errors.New("--idle-timeout requires --listen")
+			}
 			// When using stdio, silence all logging AND redirect command output to avoid interfering with LSP communication
 			if stdio {
 				// Disable all logging in stdio mode
-				slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{})))
+				slog.SetDefault(slog.New(lsp.DefaultLogTail.Handler(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}), slog.LevelInfo)))
 				// Disable event exporter
 				event.SetExporter(func(ctx context.Context, e core.Event, lm label.Map) context.Context {
 					return ctx
@@ -88,10 +133,10 @@ func BuildServeCmd() *cobra.Command {
 				cmd.SetOut(os.Stderr)
 				cmd.SetErr(os.Stderr)
 			} else {
-				slog.SetDefault(slog.New(slog.NewTextHandler(cmd.OutOrStderr(), &slog.HandlerOptions{
+				slog.SetDefault(slog.New(lsp.DefaultLogTail.Handler(slog.NewTextHandler(cmd.OutOrStderr(), &slog.HandlerOptions{
 					AddSource: true,
 					Level:     slog.LevelDebug,
-				})))
+				}), slog.LevelInfo)))
 				var eventMu sync.Mutex
 				event.SetExporter(func(ctx context.Context, e core.Event, lm label.Map) context.Context {
 					eventMu.Lock()
@@ -117,6 +162,30 @@ func BuildServeCmd() *cobra.Command {
 				})
 			}
 
+			if debugAddr != "" {
+				l, err := net.Listen("tcp", debugAddr)
+				if err != nil {
+					return err
+				}
+				defer l.Close()
+				slog.Info("serving debug endpoints", "addr", l.Addr().String())
+				go http.Serve(l, lsp.DebugHandler())
+			}
+
+			if listen != "" {
+				network, addr := "tcp", listen
+				if path, ok := strings.CutPrefix(listen, "unix;"); ok {
+					network, addr = "unix", path
+				}
+				slog.Info("listening for clients", "network", network, "addr", addr)
+				err := jsonrpc2.ListenAndServe(cmd.Context(), network, addr, lsprpc.NewStreamServer(lsprpc.WithSandbox(sandbox)), idleTimeout)
+				if errors.Is(err, jsonrpc2.ErrIdleTimeout) {
+					slog.Info("no clients connected, shutting down", "timeout", idleTimeout)
+					return nil
+				}
+				return err
+			}
+
 			var stream jsonrpc2.Stream
 			if stdio {
 				// Use stdin/stdout for communication
@@ -136,7 +205,7 @@ func BuildServeCmd() *cobra.Command {
 			}
 
 			conn := jsonrpc2.NewConn(stream)
-			ss := lsprpc.NewStreamServer()
+			ss := lsprpc.NewStreamServer(lsprpc.WithSandbox(sandbox))
 			err := ss.ServeStream(cmd.Context(), conn)
 			if stdio && err != nil {
 				// In stdio mode, don't let Cobra print error messages to stdout
@@ -148,6 +217,13 @@ func BuildServeCmd() *cobra.Command {
 
 	cmd.Flags().StringVar(&pipe, "pipe", "", "socket name to listen on")
 	cmd.Flags().BoolVar(&stdio, "stdio", false, "use stdin/stdout for communication")
+	cmd.Flags().StringVar(&listen, "listen", "", "address to accept client connections on (e.g. localhost:4389, or unix;/path/to/socket)")
+	cmd.Flags().StringVar(&debugAddr, "debug-addr", "", "serve pprof profiles, expvar metrics, and a status page at this address (e.g. localhost:6060)")
+	cmd.Flags().BoolVar(&sandbox, "sandbox", false, "do not run any external commands (go, git), for use with untrusted repositories")
+	cmd.Flags().BoolVar(&watch, "watch", false, "check the workspace in the current directory each time a file changes, printing diagnostics to stdout instead of serving an LSP client")
+	cmd.Flags().BoolVar(&jsonStream, "json-stream", false, "with --watch, print the result of each check as a single line of JSON")
+	cmd.Flags().DurationVar(&watchInterval, "watch-interval", 500*time.Millisecond, "with --watch, how often to poll the workspace for changes")
+	cmd.Flags().DurationVar(&idleTimeout, "idle-timeout", 0, "with --listen, exit once no client has been connected for this long (e.g. 30m); 0 disables the timeout")
 
 	return cmd
 }
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/kralicky/protols/pkg/sources"
+	"github.com/kralicky/protols/pkg/tags"
+	"github.com/spf13/cobra"
+)
+
+// BuildTagsCmd represents the tags command
+func BuildTagsCmd() *cobra.Command {
+	var output string
+	var etags bool
+	cmd := &cobra.Command{
+		Use:   "tags [files or directories...]",
+		Short: "Writes a ctags or etags file for proto sources",
+		Long: `
+Writes a tags file covering the packages, messages, enums, enum values,
+fields, oneofs, services and rpcs declared in the given proto files, or in all
+proto files under the given directories (the current directory by default).
+Files are only parsed, so tags are generated even for files with unresolved
+imports or syntax errors.
+
+By default, tags are written in the extended ctags format used by vim, under
+both their simple and fully-qualified names. With --etags, they are written in
+the etags format used by emacs. Paths in the tags file are relative to the
+directory containing it.
+`[1:],
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output == "" {
+				output = "tags"
+				if etags {
+					output = "TAGS"
+				}
+			}
+			if len(args) == 0 {
+				args = []string{"."}
+			}
+			var filenames []string
+			for _, arg := range args {
+				if info, err := os.Stat(arg); err == nil && info.IsDir() {
+					filenames = append(filenames, sources.SearchDirs(arg)...)
+				} else {
+					filenames = append(filenames, arg)
+				}
+			}
+			outDir := "."
+			if output != "-" {
+				outDir = filepath.Dir(output)
+			}
+			absOutDir, err := filepath.Abs(outDir)
+			if err != nil {
+				return err
+			}
+
+			var files []tags.File
+			for _, filename := range filenames {
+				source, err := os.ReadFile(filename)
+				if err != nil {
+					return err
+				}
+				path := filename
+				if abs, err := filepath.Abs(filename); err == nil {
+					if rel, err := filepath.Rel(absOutDir, abs); err == nil {
+						path = rel
+					}
+				}
+				files = append(files, tags.File{Path: filepath.ToSlash(path), Source: source})
+			}
+
+			out := cmd.OutOrStdout()
+			if output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			if etags {
+				return tags.WriteEtags(out, files)
+			}
+			return tags.WriteCtags(out, files)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "the file to write tags to, or - for stdout (default \"tags\", or \"TAGS\" with --etags)")
+	cmd.Flags().BoolVarP(&etags, "etags", "e", false, "write tags in the etags format")
+	return cmd
+}
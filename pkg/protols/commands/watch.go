@@ -0,0 +1,209 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/sources"
+	"github.com/kralicky/tools-lite/gopls/pkg/file"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+)
+
+// watchReport is written after each check in watch mode. With --json-stream,
+// each report is written as a single line of JSON.
+type watchReport struct {
+	Time time.Time `json:"time"`
+	// Paths of the files which changed since the last check, relative to the
+	// workspace root. Empty for the initial check.
+	Changed  []string          `json:"changed,omitempty"`
+	Files    []watchFileReport `json:"files"`
+	Errors   int               `json:"errors"`
+	Warnings int               `json:"warnings"`
+}
+
+type watchFileReport struct {
+	Path        string                `json:"path"`
+	URI         protocol.DocumentURI  `json:"uri"`
+	Diagnostics []protocol.Diagnostic `json:"diagnostics"`
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// runWatch compiles and lints the workspace in the current directory, then
+// polls it for changes to proto files, rechecking the workspace and writing a
+// report each time a file is created, changed, or deleted. It runs until the
+// context is canceled.
+func runWatch(ctx context.Context, out io.Writer, interval time.Duration, jsonStream bool, sandbox bool) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	var opts []lsp.CacheOption
+	if sandbox {
+		opts = append(opts, lsp.WithSandboxedCache())
+	}
+	cache := lsp.NewCache(protocol.WorkspaceFolder{
+		URI:  string(protocol.URIFromPath(cwd)),
+		Name: cwd,
+	}, opts...)
+	defer cache.Close(nil)
+
+	files := sources.SearchDirs(cwd)
+	stamps := statFiles(files)
+	cache.LoadFiles(files)
+	if err := writeWatchReport(out, cache, cwd, nil, jsonStream); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		current := statFiles(sources.SearchDirs(cwd))
+		mods := diffStamps(stamps, current)
+		stamps = current
+		if len(mods) == 0 {
+			continue
+		}
+		cache.DidModifyFiles(ctx, mods)
+		changed := make([]string, 0, len(mods))
+		for _, m := range mods {
+			changed = append(changed, relPath(cwd, m.URI.Path()))
+		}
+		slices.Sort(changed)
+		if err := writeWatchReport(out, cache, cwd, changed, jsonStream); err != nil {
+			return err
+		}
+	}
+}
+
+func statFiles(files []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(files))
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		stamps[f] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps
+}
+
+// diffStamps returns the modifications needed to go from one set of file
+// stamps to another.
+func diffStamps(prev, current map[string]fileStamp) []file.Modification {
+	var mods []file.Modification
+	add := func(path string, action file.Action) {
+		mods = append(mods, file.Modification{
+			URI:     protocol.URIFromPath(path),
+			Action:  action,
+			Version: -1,
+			OnDisk:  true,
+		})
+	}
+	for path, stamp := range current {
+		if old, ok := prev[path]; !ok {
+			add(path, file.Create)
+		} else if old != stamp {
+			add(path, file.Change)
+		}
+	}
+	for path := range prev {
+		if _, ok := current[path]; !ok {
+			add(path, file.Delete)
+		}
+	}
+	return mods
+}
+
+func writeWatchReport(out io.Writer, cache *lsp.Cache, cwd string, changed []string, jsonStream bool) error {
+	all, err := cache.XGetAllDiagnostics()
+	if err != nil {
+		return err
+	}
+	report := watchReport{
+		Time:    time.Now(),
+		Changed: changed,
+		Files:   []watchFileReport{},
+	}
+	for uri, diagnostics := range all {
+		if len(diagnostics) == 0 || !uri.IsFile() {
+			continue
+		}
+		for i, d := range diagnostics {
+			// data holds the server's code actions, which are of no use here
+			diagnostics[i].Data = nil
+			switch d.Severity {
+			case protocol.SeverityError:
+				report.Errors++
+			case protocol.SeverityWarning:
+				report.Warnings++
+			}
+		}
+		report.Files = append(report.Files, watchFileReport{
+			Path:        relPath(cwd, uri.Path()),
+			URI:         uri,
+			Diagnostics: diagnostics,
+		})
+	}
+	slices.SortFunc(report.Files, func(a, b watchFileReport) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	if jsonStream {
+		return json.NewEncoder(out).Encode(report)
+	}
+	for _, f := range report.Files {
+		for _, d := range f.Diagnostics {
+			msg := fmt.Sprintf("%s:%d:%d: %s: %s", f.Path, d.Range.Start.Line+1, d.Range.Start.Character+1, severityName(d.Severity), d.Message)
+			if d.Code != nil {
+				msg += fmt.Sprintf(" (%v)", d.Code)
+			}
+			fmt.Fprintln(out, msg)
+		}
+	}
+	summary := fmt.Sprintf("[%s] %d errors, %d warnings", report.Time.Format(time.TimeOnly), report.Errors, report.Warnings)
+	if len(changed) > 0 {
+		summary += fmt.Sprintf(" (%d files changed)", len(changed))
+	}
+	_, err = fmt.Fprintln(out, summary)
+	return err
+}
+
+func severityName(s protocol.DiagnosticSeverity) string {
+	switch s {
+	case protocol.SeverityError:
+		return "error"
+	case protocol.SeverityWarning:
+		return "warning"
+	case protocol.SeverityInformation:
+		return "info"
+	default:
+		return "hint"
+	}
+}
+
+func relPath(base, path string) string {
+	if rel, err := filepath.Rel(base, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
@@ -14,12 +14,23 @@ func BuildRootCmd() *cobra.Command {
 		Use:     "protols",
 		Short:   "Protobuf Language Server",
 		Version: version.FriendlyVersion(),
+		// replaced by the completion command, which is registered below
+		CompletionOptions: cobra.CompletionOptions{
+			DisableDefaultCmd: true,
+		},
 	}
 
 	rootCmd.AddCommand(commands.BuildFmtCmd())
 	rootCmd.AddCommand(commands.BuildServeCmd())
 	rootCmd.AddCommand(commands.BuildVetCmd())
 	rootCmd.AddCommand(commands.BuildDecodeCmd())
+	rootCmd.AddCommand(commands.BuildBugReportCmd())
+	rootCmd.AddCommand(commands.BuildPathsCmd())
+	rootCmd.AddCommand(commands.BuildExportIndexCmd())
+	rootCmd.AddCommand(commands.BuildLSIFCmd())
+	rootCmd.AddCommand(commands.BuildTagsCmd())
+	rootCmd.AddCommand(commands.BuildQueryCmd())
+	rootCmd.AddCommand(commands.BuildCompletionCmd())
 	//+cobra:subcommands
 
 	return rootCmd
@@ -0,0 +1,53 @@
+package sources
+
+import (
+	"path"
+	"strings"
+)
+
+// Excludes is a list of glob patterns matching paths which should not be
+// searched. Patterns are matched against slash-separated paths relative to the
+// search root, using the syntax of path.Match, with the addition that a "**"
+// path element matches zero or more path elements. A pattern which matches a
+// directory excludes everything within it.
+type Excludes []string
+
+// Match reports whether the slash-separated relative path, or any of its parent
+// directories, is matched by one of the patterns.
+func (e Excludes) Match(rel string) bool {
+	if len(e) == 0 || rel == "" || rel == "." {
+		return false
+	}
+	elems := strings.Split(rel, "/")
+	for _, pattern := range e {
+		patternElems := strings.Split(strings.Trim(pattern, "/"), "/")
+		for i := 1; i <= len(elems); i++ {
+			if matchElems(patternElems, elems[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchElems(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
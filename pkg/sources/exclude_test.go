@@ -0,0 +1,53 @@
+package sources
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExcludes(t *testing.T) {
+	excludes := Excludes{"**/node_modules/**", "bazel-out/**", "**/testdata/**", "gen/*.proto"}
+	cases := map[string]bool{
+		"foo.proto":                         false,
+		"node_modules/x/foo.proto":          true,
+		"a/b/node_modules/foo.proto":        true,
+		"bazel-out":                         true,
+		"bazel-out/k8-fastbuild/foo.proto":  true,
+		"src/bazel-out/foo.proto":           false,
+		"pkg/testdata/foo.proto":            true,
+		"pkg/testdata":                      true,
+		"gen/foo.proto":                     true,
+		"gen/nested/foo.proto":              false,
+		"testdata.proto":                    false,
+		"a/node_modules_not_really/x.proto": false,
+	}
+	for rel, want := range cases {
+		if got := excludes.Match(rel); got != want {
+			t.Errorf("Match(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
+
+func TestSearchDirsExcluding(t *testing.T) {
+	dir := t.TempDir()
+	for _, rel := range []string{"a.proto", "testdata/b.proto", "sub/testdata/c.proto", "sub/d.proto", "bazel-out/e.proto"} {
+		filename := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := SearchDirsExcluding(Excludes{"**/testdata/**", "bazel-out/**"}, dir)
+	for i, f := range files {
+		rel, _ := filepath.Rel(dir, f)
+		files[i] = filepath.ToSlash(rel)
+	}
+	slices.Sort(files)
+	if want := []string{"a.proto", "sub/d.proto"}; !slices.Equal(files, want) {
+		t.Errorf("got %v, want %v", files, want)
+	}
+}
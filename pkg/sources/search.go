@@ -7,6 +7,12 @@ import (
 )
 
 func SearchDirs(dirs ...string) []string {
+	return SearchDirsExcluding(nil, dirs...)
+}
+
+// SearchDirsExcluding is like SearchDirs, but skips files and directories
+// matched by the given patterns, relative to each search directory.
+func SearchDirsExcluding(excludes Excludes, dirs ...string) []string {
 	var files []string
 	for _, dir := range dirs {
 		if !filepath.IsAbs(dir) {
@@ -16,7 +22,16 @@ func SearchDirs(dirs ...string) []string {
 			}
 		}
 		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
 			name := d.Name()
+			if rel, err := filepath.Rel(dir, path); err == nil && excludes.Match(filepath.ToSlash(rel)) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
 			if d.IsDir() {
 				if name == "node_modules" {
 					return fs.SkipDir
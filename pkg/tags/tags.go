@@ -0,0 +1,311 @@
+// Package tags generates ctags and etags files for proto sources, for editors
+// which navigate using tags files instead of a language server.
+package tags
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile/ast"
+	"github.com/kralicky/protocompile/parser"
+	"github.com/kralicky/protocompile/reporter"
+)
+
+// Kind is the kind of declaration a tag refers to. Kinds are named and
+// lettered like those of the Universal Ctags protobuf parser.
+type Kind struct {
+	Letter byte
+	Name   string
+}
+
+var (
+	KindPackage = Kind{'p', "package"}
+	KindMessage = Kind{'m', "message"}
+	KindField   = Kind{'f', "field"}
+	KindEnumVal = Kind{'e', "enumerator"}
+	KindEnum    = Kind{'g', "enum"}
+	KindService = Kind{'s', "service"}
+	KindRPC     = Kind{'r', "rpc"}
+	KindOneof   = Kind{'o', "oneof"}
+)
+
+// A Tag is a named declaration in a proto source file.
+type Tag struct {
+	Name string
+	// The fully-qualified name of the declaration.
+	FullName string
+	Kind     Kind
+	// The kind and fully-qualified name of the enclosing declaration, if any.
+	ScopeKind Kind
+	Scope     string
+	// The 1-based line number of the declaration's name, and the byte offset
+	// of the start of that line.
+	Line       int
+	LineOffset int
+	// The text of the line, up to and including the end of the name.
+	LinePrefix string
+	// The full text of the line.
+	LineText string
+}
+
+// File is a proto source file to generate tags for. Path is the name written
+// in the tags file.
+type File struct {
+	Path   string
+	Source []byte
+}
+
+// Parse returns the tags declared in the source. Syntax errors are ignored;
+// tags are generated for all declarations the parser could recover.
+func Parse(f File) []Tag {
+	handler := reporter.NewHandler(reporter.NewReporter(
+		func(reporter.ErrorWithPos) error { return nil },
+		func(reporter.ErrorWithPos) {},
+	))
+	fileNode, _ := parser.Parse(f.Path, bytes.NewReader(f.Source), handler, 0)
+	if fileNode == nil {
+		return nil
+	}
+	g := &generator{fileNode: fileNode, source: f.Source}
+	var pkg string
+	for _, decl := range fileNode.GetDecls() {
+		if p := decl.GetPackage(); p != nil && p.GetName() != nil {
+			pkg = string(p.GetName().AsIdentifier())
+			g.add(p.GetName(), pkg, pkg, KindPackage, Kind{}, "")
+		}
+	}
+	for _, decl := range fileNode.GetDecls() {
+		switch {
+		case decl.GetMessage() != nil:
+			g.message(decl.GetMessage(), pkg, KindPackage)
+		case decl.GetEnum() != nil:
+			g.enum(decl.GetEnum(), pkg, KindPackage)
+		case decl.GetService() != nil:
+			g.service(decl.GetService(), pkg)
+		case decl.GetExtend() != nil:
+			g.extend(decl.GetExtend(), pkg, KindPackage)
+		}
+	}
+	return g.tags
+}
+
+type generator struct {
+	fileNode *ast.FileNode
+	source   []byte
+	tags     []Tag
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+func (g *generator) add(node ast.Node, name, fullName string, kind, scopeKind Kind, scope string) {
+	info := g.fileNode.NodeInfo(node)
+	if !info.IsValid() {
+		return
+	}
+	start := info.Start()
+	// the end position's offset is that of the last character, not after it
+	end := start.Offset + len(info.RawText())
+	lineStart := bytes.LastIndexByte(g.source[:start.Offset], '\n') + 1
+	lineEnd := bytes.IndexByte(g.source[lineStart:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(g.source)
+	} else {
+		lineEnd += lineStart
+	}
+	if scope == "" {
+		scopeKind = Kind{}
+	}
+	g.tags = append(g.tags, Tag{
+		Name:       name,
+		FullName:   fullName,
+		Kind:       kind,
+		ScopeKind:  scopeKind,
+		Scope:      scope,
+		Line:       start.Line,
+		LineOffset: lineStart,
+		LinePrefix: string(g.source[lineStart:end]),
+		LineText:   strings.TrimSuffix(string(g.source[lineStart:lineEnd]), "\r"),
+	})
+}
+
+func (g *generator) message(msg *ast.MessageNode, scope string, scopeKind Kind) {
+	if msg.GetName() == nil {
+		return
+	}
+	name := string(msg.GetName().AsIdentifier())
+	fullName := qualify(scope, name)
+	g.add(msg.GetName(), name, fullName, KindMessage, scopeKind, scope)
+	g.messageBody(msg.GetDecls(), fullName)
+}
+
+func (g *generator) messageBody(decls []*ast.MessageElement, scope string) {
+	for _, decl := range decls {
+		switch {
+		case decl.GetField() != nil:
+			g.field(decl.GetField().GetName(), scope, KindMessage, scope)
+		case decl.GetMapField() != nil:
+			g.field(decl.GetMapField().GetName(), scope, KindMessage, scope)
+		case decl.GetGroup() != nil:
+			g.group(decl.GetGroup(), scope, KindMessage, scope)
+		case decl.GetOneof() != nil:
+			g.oneof(decl.GetOneof(), scope)
+		case decl.GetMessage() != nil:
+			g.message(decl.GetMessage(), scope, KindMessage)
+		case decl.GetEnum() != nil:
+			g.enum(decl.GetEnum(), scope, KindMessage)
+		case decl.GetExtend() != nil:
+			g.extend(decl.GetExtend(), scope, KindMessage)
+		}
+	}
+}
+
+// field adds a field of the parent message (or package, for extensions). The
+// tag's scope is usually the parent, but is the oneof for fields in a oneof.
+func (g *generator) field(name *ast.IdentNode, parent string, scopeKind Kind, scope string) {
+	if name == nil {
+		return
+	}
+	g.add(name, string(name.AsIdentifier()), qualify(parent, string(name.AsIdentifier())), KindField, scopeKind, scope)
+}
+
+// group adds a field and a message for a group, which are named in lower and
+// title case respectively. Both are declared in the parent message (or
+// package, for extensions), even if the group is in a oneof.
+func (g *generator) group(group *ast.GroupNode, parent string, scopeKind Kind, scope string) {
+	if group.GetName() == nil {
+		return
+	}
+	name := string(group.GetName().AsIdentifier())
+	g.add(group.GetName(), strings.ToLower(name), qualify(parent, strings.ToLower(name)), KindField, scopeKind, scope)
+	if scopeKind == KindOneof {
+		scopeKind = KindMessage
+	}
+	g.add(group.GetName(), name, qualify(parent, name), KindMessage, scopeKind, parent)
+	g.messageBody(group.GetDecls(), qualify(parent, name))
+}
+
+func (g *generator) oneof(oneof *ast.OneofNode, scope string) {
+	if oneof.GetName() == nil {
+		return
+	}
+	name := string(oneof.GetName().AsIdentifier())
+	oneofName := qualify(scope, name)
+	g.add(oneof.GetName(), name, oneofName, KindOneof, KindMessage, scope)
+	for _, decl := range oneof.GetDecls() {
+		switch {
+		case decl.GetField() != nil:
+			g.field(decl.GetField().GetName(), scope, KindOneof, oneofName)
+		case decl.GetGroup() != nil:
+			g.group(decl.GetGroup(), scope, KindOneof, oneofName)
+		}
+	}
+}
+
+func (g *generator) enum(enum *ast.EnumNode, scope string, scopeKind Kind) {
+	if enum.GetName() == nil {
+		return
+	}
+	name := string(enum.GetName().AsIdentifier())
+	fullName := qualify(scope, name)
+	g.add(enum.GetName(), name, fullName, KindEnum, scopeKind, scope)
+	for _, decl := range enum.GetDecls() {
+		if val := decl.GetEnumValue(); val != nil && val.GetName() != nil {
+			// enum values are siblings of their enum
+			valName := string(val.GetName().AsIdentifier())
+			g.add(val.GetName(), valName, qualify(scope, valName), KindEnumVal, KindEnum, fullName)
+		}
+	}
+}
+
+func (g *generator) service(svc *ast.ServiceNode, scope string) {
+	if svc.GetName() == nil {
+		return
+	}
+	name := string(svc.GetName().AsIdentifier())
+	fullName := qualify(scope, name)
+	g.add(svc.GetName(), name, fullName, KindService, KindPackage, scope)
+	for _, decl := range svc.GetDecls() {
+		if rpc := decl.GetRpc(); rpc != nil && rpc.GetName() != nil {
+			rpcName := string(rpc.GetName().AsIdentifier())
+			g.add(rpc.GetName(), rpcName, qualify(fullName, rpcName), KindRPC, KindService, fullName)
+		}
+	}
+}
+
+func (g *generator) extend(extend *ast.ExtendNode, scope string, scopeKind Kind) {
+	for _, decl := range extend.GetDecls() {
+		switch {
+		case decl.GetField() != nil:
+			g.field(decl.GetField().GetName(), scope, scopeKind, scope)
+		case decl.GetGroup() != nil:
+			g.group(decl.GetGroup(), scope, scopeKind, scope)
+		}
+	}
+}
+
+// WriteCtags writes tags in the extended ctags format, sorted by name. Each
+// tag is written under its simple name and, if different, its
+// fully-qualified name.
+func WriteCtags(w io.Writer, files []File) error {
+	type entry struct {
+		name, path string
+		tag        Tag
+	}
+	var entries []entry
+	for _, f := range files {
+		for _, tag := range Parse(f) {
+			entries = append(entries, entry{tag.Name, f.Path, tag})
+			if tag.FullName != tag.Name {
+				entries = append(entries, entry{tag.FullName, f.Path, tag})
+			}
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		if c := strings.Compare(a.name, b.name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.path, b.path)
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString("!_TAG_FILE_FORMAT\t2\t/extended format; --format=1 will not append ;\" to lines/\n")
+	buf.WriteString("!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/\n")
+	buf.WriteString("!_TAG_PROGRAM_NAME\tprotols\t//\n")
+	for _, e := range entries {
+		fmt.Fprintf(&buf, "%s\t%s\t/^%s$/;\"\t%c\tline:%d", e.name, e.path, escapePattern(e.tag.LineText), e.tag.Kind.Letter, e.tag.Line)
+		if e.tag.Scope != "" {
+			fmt.Fprintf(&buf, "\t%s:%s", e.tag.ScopeKind.Name, e.tag.Scope)
+		}
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// escapePattern escapes a line for use in a ctags search pattern.
+func escapePattern(line string) string {
+	return strings.NewReplacer(`\`, `\\`, `/`, `\/`).Replace(line)
+}
+
+// WriteEtags writes tags in the etags (Emacs) format.
+func WriteEtags(w io.Writer, files []File) error {
+	var buf bytes.Buffer
+	for _, f := range files {
+		var section bytes.Buffer
+		for _, tag := range Parse(f) {
+			fmt.Fprintf(&section, "%s\x7f%s\x01%d,%d\n", tag.LinePrefix, tag.FullName, tag.Line, tag.LineOffset)
+		}
+		fmt.Fprintf(&buf, "\x0c\n%s,%d\n", f.Path, section.Len())
+		buf.Write(section.Bytes())
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,109 @@
+package tags
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testSource = `syntax = "proto2";
+package a.b;
+
+message Outer {
+  optional string name = 1;
+  map<string, Outer> children = 2;
+  oneof choice {
+    int32 id = 3;
+    group Extra = 4 {
+      optional int32 x = 1;
+    }
+  }
+  enum Color {
+    RED = 0;
+  }
+}
+
+service Svc {
+  rpc Get(Outer) returns (Outer);
+}
+
+extend Outer {
+  optional int32 ext = 100;
+}
+`
+
+func TestParse(t *testing.T) {
+	var got []string
+	for _, tag := range Parse(File{Path: "a.proto", Source: []byte(testSource)}) {
+		got = append(got, tag.FullName+" "+tag.Kind.Name+" "+tag.ScopeKind.Name+":"+tag.Scope)
+	}
+	want := []string{
+		"a.b package :",
+		"a.b.Outer message package:a.b",
+		"a.b.Outer.name field message:a.b.Outer",
+		"a.b.Outer.children field message:a.b.Outer",
+		"a.b.Outer.choice oneof message:a.b.Outer",
+		"a.b.Outer.id field oneof:a.b.Outer.choice",
+		"a.b.Outer.extra field oneof:a.b.Outer.choice",
+		"a.b.Outer.Extra message message:a.b.Outer",
+		"a.b.Outer.Extra.x field message:a.b.Outer.Extra",
+		"a.b.Outer.Color enum message:a.b.Outer",
+		"a.b.Outer.RED enumerator enum:a.b.Outer.Color",
+		"a.b.Svc service package:a.b",
+		"a.b.Svc.Get rpc service:a.b.Svc",
+		"a.b.ext field package:a.b",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestWriteCtags(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCtags(&buf, []File{{Path: "dir/a.proto", Source: []byte(testSource)}}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for _, want := range []string{
+		"Get\tdir/a.proto\t/^  rpc Get(Outer) returns (Outer);$/;\"\tr\tline:19\tservice:a.b.Svc",
+		"a.b.Svc.Get\tdir/a.proto\t/^  rpc Get(Outer) returns (Outer);$/;\"\tr\tline:19\tservice:a.b.Svc",
+		"a.b\tdir/a.proto\t/^package a.b;$/;\"\tp\tline:2",
+	} {
+		found := false
+		for _, line := range lines {
+			if line == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing line %q in:\n%s", want, buf.String())
+		}
+	}
+	var names []string
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "!_TAG_") {
+			names = append(names, line[:strings.IndexByte(line, '\t')])
+		}
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] > names[i] {
+			t.Errorf("tags are not sorted: %q before %q", names[i-1], names[i])
+		}
+	}
+}
+
+func TestWriteEtags(t *testing.T) {
+	var buf bytes.Buffer
+	source := "syntax = \"proto3\";\npackage a;\nmessage M {\n  int32 f = 1;\n}\n"
+	if err := WriteEtags(&buf, []File{{Path: "a.proto", Source: []byte(source)}}); err != nil {
+		t.Fatal(err)
+	}
+	section := "package a\x7fa\x012,19\n" +
+		"message M\x7fa.M\x013,30\n" +
+		"  int32 f\x7fa.M.f\x014,42\n"
+	want := "\x0c\na.proto," + strconv.Itoa(len(section)) + "\n" + section
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,326 @@
+// Package workspace loads and links the proto files in a directory using the
+// same import resolution as the language server, including imports from Go
+// module dependencies and synthetic files generated from Go sources, for use
+// by other Go tools. No language server protocol types are exposed.
+package workspace
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kralicky/protocompile/linker"
+	"github.com/kralicky/protocompile/protoutil"
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/sources"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A Workspace contains the linked results of all proto files found in a
+// directory, and the files they import. Results do not change after Load
+// returns.
+type Workspace struct {
+	root     string
+	cache    *lsp.Cache
+	snapshot *lsp.Snapshot
+	release  func()
+}
+
+type options struct {
+	sandbox       bool
+	exclude       []string
+	importAliases map[string]string
+}
+
+// An Option configures how a workspace is loaded.
+type Option func(*options)
+
+func (o *options) apply(opts ...Option) {
+	for _, op := range opts {
+		op(o)
+	}
+}
+
+// WithSandbox prevents any subprocesses, such as the go command, from being
+// run. Imports are resolved from the filesystem only.
+func WithSandbox() Option {
+	return func(o *options) {
+		o.sandbox = true
+	}
+}
+
+// WithExclude skips files and directories matching the given glob patterns,
+// relative to the workspace root, when searching for proto files. Excluded
+// files are still loaded if they are imported.
+func WithExclude(patterns ...string) Option {
+	return func(o *options) {
+		o.exclude = append(o.exclude, patterns...)
+	}
+}
+
+// WithImportAliases maps import paths to the files they refer to, like the
+// language server's "importAliases" setting.
+func WithImportAliases(aliases map[string]string) Option {
+	return func(o *options) {
+		o.importAliases = aliases
+	}
+}
+
+// Load finds, compiles and links all proto files in dir and its
+// subdirectories. Files which fail to compile are omitted from the results;
+// errors in individual files are not returned, but can be found with
+// Diagnostics. If ctx is cancelled, loading stops and ctx's error is returned.
+func Load(ctx context.Context, dir string, opts ...Option) (*Workspace, error) {
+	var o options
+	o.apply(opts...)
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var cacheOpts []lsp.CacheOption
+	if o.sandbox {
+		cacheOpts = append(cacheOpts, lsp.WithSandboxedCache())
+	}
+	cache := lsp.NewCache(protocol.WorkspaceFolder{
+		URI: string(protocol.URIFromPath(root)),
+	}, cacheOpts...)
+	if err := cache.DidChangeConfiguration(ctx, lsp.Settings{
+		Exclude:       o.exclude,
+		ImportAliases: o.importAliases,
+	}); err != nil {
+		cache.Close(err)
+		return nil, err
+	}
+	cache.LoadFilesContext(ctx, sources.SearchDirsExcluding(o.exclude, root))
+	if err := ctx.Err(); err != nil {
+		cache.Close(err)
+		return nil, err
+	}
+	snapshot, release := cache.AcquireSnapshot()
+	return &Workspace{
+		root:     root,
+		cache:    cache,
+		snapshot: snapshot,
+		release:  release,
+	}, nil
+}
+
+// Close releases the resources held by the workspace.
+func (w *Workspace) Close() {
+	w.release()
+	w.cache.Close(nil)
+}
+
+// Root returns the absolute path of the workspace directory.
+func (w *Workspace) Root() string {
+	return w.root
+}
+
+// Files returns the linked results of all loaded files, including imported
+// files outside the workspace, sorted by import path.
+func (w *Workspace) Files() []linker.Result {
+	var files []linker.Result
+	for _, f := range w.snapshot.Results() {
+		if res, ok := f.(linker.Result); ok && !f.IsPlaceholder() {
+			files = append(files, res)
+		}
+	}
+	slices.SortFunc(files, func(a, b linker.Result) int {
+		return strings.Compare(a.Path(), b.Path())
+	})
+	return files
+}
+
+// File returns the linked result of the file with the given import path.
+func (w *Workspace) File(path string) (linker.Result, error) {
+	return w.snapshot.FindResultByPath(path)
+}
+
+// Resolver returns a resolver for the descriptors in all loaded files.
+func (w *Workspace) Resolver() linker.Resolver {
+	return w.snapshot.Results().AsResolver()
+}
+
+// Severity is the severity of a diagnostic.
+type Severity int
+
+const (
+	SeverityError Severity = iota + 1
+	SeverityWarning
+	SeverityInfo
+	SeverityHint
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	case SeverityHint:
+		return "hint"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// A Diagnostic is an error, warning or lint finding reported for a file.
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	// The name of the lint rule or warning category which reported the
+	// diagnostic, if any.
+	Code string
+	// The 1-based positions of the start and end of the diagnostic. Columns
+	// are counted in UTF-16 code units.
+	Line, Col       int
+	EndLine, EndCol int
+}
+
+// Diagnostics returns the diagnostics reported while compiling and linting
+// the file with the given import path, sorted by position. Files which
+// failed to compile are not included in Files, but their diagnostics are
+// available here.
+func (w *Workspace) Diagnostics(path string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, d := range w.cache.XGetDiagnosticsForPath(path) {
+		diag := Diagnostic{
+			Severity: Severity(d.Severity),
+			Message:  d.Message,
+			Line:     int(d.Range.Start.Line) + 1,
+			Col:      int(d.Range.Start.Character) + 1,
+			EndLine:  int(d.Range.End.Line) + 1,
+			EndCol:   int(d.Range.End.Character) + 1,
+		}
+		if d.Code != nil {
+			diag.Code = fmt.Sprint(d.Code)
+		}
+		diagnostics = append(diagnostics, diag)
+	}
+	return diagnostics
+}
+
+// A PathMapping associates the import path of a file with its location.
+type PathMapping struct {
+	// The path used to import the file.
+	Path string
+	// The file's location: an absolute path for files on disk, or a URI for
+	// other files, such as synthetic files generated from Go sources.
+	Location string
+	// How the file was found, e.g. "relative path", "go module cache" or
+	// "synthetic".
+	Source string
+}
+
+// PathMappings returns the locations of all files known to the resolver,
+// sorted by import path.
+func (w *Workspace) PathMappings() []PathMapping {
+	var mappings []PathMapping
+	for _, m := range w.cache.PathMappings().Mappings {
+		if m.Inconsistent {
+			continue
+		}
+		location := string(m.URI)
+		if m.URI.IsFile() {
+			location = m.URI.Path()
+		}
+		mappings = append(mappings, PathMapping{
+			Path:     m.Path,
+			Location: location,
+			Source:   m.Source,
+		})
+	}
+	return mappings
+}
+
+// A Symbol is a named declaration in a loaded file.
+type Symbol struct {
+	Descriptor protoreflect.Descriptor
+	// The import path of the file declaring the symbol.
+	Path string
+	// The 1-based position of the start of the declaration.
+	Line, Col int
+}
+
+// Symbols returns the messages, enums, enum values, fields, extensions,
+// services and methods declared in files within the workspace directory,
+// sorted by full name. Map entry messages and their fields are omitted.
+func (w *Workspace) Symbols() []Symbol {
+	local := w.localPaths()
+	var symbols []Symbol
+	for _, res := range w.Files() {
+		if !local[res.Path()] || res.AST() == nil {
+			continue
+		}
+		res.RangeDescriptors(context.Background(), func(d protoreflect.Descriptor) bool {
+			switch d := d.(type) {
+			case protoreflect.MessageDescriptor:
+				if d.IsMapEntry() {
+					return true
+				}
+			case protoreflect.FieldDescriptor:
+				if d.ContainingMessage().IsMapEntry() {
+					return true
+				}
+			case protoreflect.EnumDescriptor, protoreflect.EnumValueDescriptor,
+				protoreflect.ServiceDescriptor, protoreflect.MethodDescriptor:
+			default:
+				return true
+			}
+			wrapper, ok := d.(protoutil.DescriptorProtoWrapper)
+			if !ok {
+				return true
+			}
+			node := res.Node(wrapper.AsProto())
+			if node == nil {
+				return true
+			}
+			pos := res.AST().NodeInfo(node).Start()
+			symbols = append(symbols, Symbol{
+				Descriptor: d,
+				Path:       res.Path(),
+				Line:       pos.Line,
+				Col:        pos.Col,
+			})
+			return true
+		})
+	}
+	slices.SortFunc(symbols, func(a, b Symbol) int {
+		return cmp.Or(
+			strings.Compare(string(a.Descriptor.FullName()), string(b.Descriptor.FullName())),
+			strings.Compare(a.Path, b.Path),
+		)
+	})
+	return symbols
+}
+
+// Lookup finds a symbol in any loaded file by its fully-qualified name.
+func (w *Workspace) Lookup(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	d, err := w.snapshot.FindDescriptorByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return d, nil
+}
+
+// localPaths returns the import paths of files on disk within the workspace
+// directory.
+func (w *Workspace) localPaths() map[string]bool {
+	paths := map[string]bool{}
+	for _, m := range w.cache.PathMappings().Mappings {
+		if !m.URI.IsFile() {
+			continue
+		}
+		rel, err := filepath.Rel(w.root, m.URI.Path())
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			paths[m.Path] = true
+		}
+	}
+	return paths
+}
@@ -0,0 +1,112 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"a/a.proto": "syntax = \"proto3\";\npackage a;\nimport \"b/b.proto\";\nmessage A {\n  b.B b = 1;\n  map<string, b.B> m = 2;\n}\n",
+		"b/b.proto": "syntax = \"proto3\";\npackage b;\nenum B {\n  B_UNSPECIFIED = 0;\n}\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ws, err := Load(context.Background(), dir, WithSandbox())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	var paths []string
+	for _, f := range ws.Files() {
+		paths = append(paths, f.Path())
+	}
+	if !slices.Contains(paths, "a/a.proto") || !slices.Contains(paths, "b/b.proto") {
+		t.Fatalf("expected both files to be loaded, got %v", paths)
+	}
+	res, err := ws.File("a/a.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind := res.Messages().ByName("A").Fields().ByName("b").Enum(); kind == nil || kind.FullName() != "b.B" {
+		t.Errorf("expected field a.A.b to resolve to enum b.B")
+	}
+
+	var mapped bool
+	for _, m := range ws.PathMappings() {
+		if m.Path == "b/b.proto" {
+			mapped = m.Location == filepath.Join(dir, "b/b.proto")
+		}
+	}
+	if !mapped {
+		t.Errorf("expected b/b.proto to be mapped to its location on disk")
+	}
+
+	var symbols []string
+	for _, s := range ws.Symbols() {
+		symbols = append(symbols, fmt.Sprintf("%s %s:%d:%d", s.Descriptor.FullName(), s.Path, s.Line, s.Col))
+	}
+	expected := []string{
+		"a.A a/a.proto:4:1",
+		"a.A.b a/a.proto:5:3",
+		"a.A.m a/a.proto:6:3",
+		"b.B b/b.proto:3:1",
+		"b.B_UNSPECIFIED b/b.proto:4:3",
+	}
+	if !slices.Equal(symbols, expected) {
+		t.Errorf("expected symbols:\n%v\ngot:\n%v", expected, symbols)
+	}
+
+	if _, err := ws.Lookup("a.A"); err != nil {
+		t.Error(err)
+	}
+	if _, err := ws.Lookup("a.Missing"); err == nil {
+		t.Error("expected an error looking up a missing symbol")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.proto"), []byte("syntax = \"proto3\";\npackage a;\nmessage A {\n  Missing m = 1;\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ws, err := Load(context.Background(), dir, WithSandbox())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	var errs []Diagnostic
+	for _, d := range ws.Diagnostics("a.proto") {
+		if d.Severity == SeverityError {
+			errs = append(errs, d)
+		}
+	}
+	if len(errs) != 1 || errs[0].Line != 4 || errs[0].Col != 3 {
+		t.Fatalf("expected an error for the unresolved type, got %+v", errs)
+	}
+	if len(ws.Diagnostics("missing.proto")) != 0 {
+		t.Error("expected no diagnostics for an unknown file")
+	}
+
+	ctx, ca := context.WithCancel(context.Background())
+	ca()
+	if _, err := Load(ctx, dir, WithSandbox()); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected loading to be cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBugReport(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+message Foo {}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		env.Await(integration.NoDiagnostics(integration.ForFile("foo.proto")))
+
+		res, err := env.Editor.Server.ExecuteCommand(env.Ctx, &protocol.ExecuteCommandParams{
+			Command: "protols/bugReport",
+		})
+		require.NoError(t, err)
+		report, ok := res.(string)
+		require.True(t, ok, "unexpected result type %T", res)
+		require.Contains(t, report, "# protols bug report")
+		require.Contains(t, report, "### "+env.Sandbox.Workdir.RootURI().Path())
+		require.Contains(t, report, "- synthetic files:")
+		require.Contains(t, report, "## Recent logs")
+	})
+}
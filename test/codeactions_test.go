@@ -1,8 +1,10 @@
 package test
 
 import (
+	"os/exec"
 	"testing"
 
+	"github.com/kralicky/protols/pkg/lsp"
 	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
 	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
 	"github.com/stretchr/testify/require"
@@ -121,6 +123,382 @@ message Foo {
 			env.ApplyCodeAction(actions[0])
 			env.SaveBuffer("options.proto")
 			require.Equal(t, want[1:], env.BufferText("options.proto"))
-		})
+		}, withDocumentChanges())
 	}
 }
+
+func TestAddExplicitJSONNames(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+message Foo {
+  string user_id = 1;
+  string name = 2;
+  repeated string display_names = 3 [deprecated = true];
+  string created_at = 4 [json_name = "created"];
+}
+`
+	const want = `
+syntax = "proto3";
+
+package foo;
+
+message Foo {
+  string user_id = 1 [json_name = "userId"];
+  string name = 2;
+  repeated string display_names = 3 [json_name = "displayNames", deprecated = true];
+  string created_at = 4 [json_name = "created"];
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+
+		actions, err := env.Editor.CodeActions(env.Ctx, env.RegexpSearch("foo.proto", `  string n()ame`), nil, protocol.RefactorRewrite)
+		require.NoError(t, err)
+		for _, action := range actions {
+			require.NotContains(t, action.Title, "json_name")
+		}
+
+		actions, err = env.Editor.CodeActions(env.Ctx, env.RegexpSearch("foo.proto", `message F()oo`), nil, protocol.RefactorRewrite)
+		require.NoError(t, err)
+		var found bool
+		for _, action := range actions {
+			if action.Title == "Add explicit json_name to all fields" {
+				env.ApplyCodeAction(action)
+				found = true
+			}
+		}
+		require.True(t, found)
+		require.Equal(t, want[1:], env.BufferText("foo.proto"))
+	}, withDocumentChanges())
+}
+
+func TestEnumQuickFixes(t *testing.T) {
+	const src = `
+-- zero.proto --
+syntax = "proto3";
+
+package foo;
+
+enum Color {
+  RED = 1;
+  GREEN = 2;
+}
+-- alias.proto --
+syntax = "proto3";
+
+package foo;
+
+enum Status {
+  STATUS_UNSPECIFIED = 0;
+  STATUS_OK = 1;
+  STATUS_SUCCESS = 1;
+}
+-- unused.proto --
+syntax = "proto3";
+
+package foo;
+
+enum Kind {
+  option allow_alias = true;
+  KIND_UNSPECIFIED = 0;
+  KIND_A = 1;
+}
+`
+	cases := []struct {
+		file  string
+		title string
+		want  string
+	}{
+		{
+			file:  "zero.proto",
+			title: "Insert COLOR_UNSPECIFIED = 0",
+			want: `
+syntax = "proto3";
+
+package foo;
+
+enum Color {
+  COLOR_UNSPECIFIED = 0;
+  RED = 1;
+  GREEN = 2;
+}
+`,
+		},
+		{
+			file:  "alias.proto",
+			title: "Add allow_alias option",
+			want: `
+syntax = "proto3";
+
+package foo;
+
+enum Status {
+  option allow_alias = true;
+  STATUS_UNSPECIFIED = 0;
+  STATUS_OK = 1;
+  STATUS_SUCCESS = 1;
+}
+`,
+		},
+		{
+			file:  "unused.proto",
+			title: "Remove allow_alias option",
+			want: `
+syntax = "proto3";
+
+package foo;
+
+enum Kind {
+  KIND_UNSPECIFIED = 0;
+  KIND_A = 1;
+}
+`,
+		},
+	}
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		for _, tc := range cases {
+			env.OpenFile(tc.file)
+			var diag protocol.PublishDiagnosticsParams
+			env.OnceMet(
+				integration.Diagnostics(integration.ForFile(tc.file)),
+				integration.ReadDiagnostics(tc.file, &diag),
+			)
+			require.NotEmpty(t, diag.Diagnostics, tc.file)
+			actions, err := env.Editor.CodeActions(env.Ctx, protocol.Location{
+				URI:   env.Sandbox.Workdir.URI(tc.file),
+				Range: diag.Diagnostics[0].Range,
+			}, diag.Diagnostics, protocol.QuickFix)
+			require.NoError(t, err)
+			var found bool
+			for _, action := range actions {
+				if action.Title == tc.title {
+					env.ApplyCodeAction(action)
+					found = true
+				}
+			}
+			require.True(t, found, tc.file)
+			require.Equal(t, tc.want[1:], env.BufferText(tc.file), tc.file)
+		}
+	}, withDocumentChanges())
+}
+
+func TestSortMembers(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+message Foo {
+  // c is the third field
+  string c = 3;
+  string a = 1; // a
+  string b = 2;
+
+  option deprecated = true;
+
+  int32 z = 10;
+  int32 y = 9;
+  oneof choice {
+    string d = 5;
+    string e = 4;
+  }
+}
+
+enum Color {
+  COLOR_UNSPECIFIED = 0;
+  BLUE = 2;
+  // red
+  RED = 1;
+}
+
+service Svc {
+  rpc Watch(Foo) returns (Foo);
+  rpc Get(Foo) returns (Foo);
+}
+`
+	cases := []struct {
+		pos   string
+		title string
+		want  string
+	}{
+		{
+			pos:   `message F()oo`,
+			title: "Sort fields by number",
+			want: `
+message Foo {
+  string a = 1; // a
+  string b = 2;
+  // c is the third field
+  string c = 3;
+
+  option deprecated = true;
+
+  int32 y = 9;
+  int32 z = 10;
+  oneof choice {
+    string d = 5;
+    string e = 4;
+  }
+}
+`,
+		},
+		{
+			pos:   `oneof ch()oice`,
+			title: "Sort fields by number",
+			want: `
+  oneof choice {
+    string e = 4;
+    string d = 5;
+  }
+`,
+		},
+		{
+			pos:   `enum C()olor`,
+			title: "Sort enum values by number",
+			want: `
+enum Color {
+  COLOR_UNSPECIFIED = 0;
+  // red
+  RED = 1;
+  BLUE = 2;
+}
+`,
+		},
+		{
+			pos:   `service S()vc`,
+			title: "Sort methods by name",
+			want: `
+service Svc {
+  rpc Get(Foo) returns (Foo);
+  rpc Watch(Foo) returns (Foo);
+}
+`,
+		},
+	}
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		for _, tc := range cases {
+			actions, err := env.Editor.CodeActions(env.Ctx, env.RegexpSearch("foo.proto", tc.pos), nil, lsp.SourceSortMembers)
+			require.NoError(t, err)
+			var found bool
+			for _, action := range actions {
+				if action.Title == tc.title {
+					env.ApplyCodeAction(action)
+					found = true
+				}
+			}
+			require.True(t, found, tc.pos)
+			require.Contains(t, env.BufferText("foo.proto"), tc.want[1:], tc.pos)
+		}
+
+		// already sorted
+		actions, err := env.Editor.CodeActions(env.Ctx, env.RegexpSearch("foo.proto", `enum C()olor`), nil, lsp.SourceSortMembers)
+		require.NoError(t, err)
+		require.Empty(t, actions)
+	}, withDocumentChanges())
+}
+
+func TestCompactFieldNumbers(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	const src = `
+-- draft.proto --
+syntax = "proto3";
+
+package foo;
+
+// @unstable
+message Draft {
+  reserved 2;
+  string a = 1;
+  string b = 5;
+  oneof choice {
+    string c = 9;
+  }
+  map<string, string> d = 12;
+}
+
+message Stable {
+  string a = 1;
+  string b = 5;
+}
+-- released.proto --
+syntax = "proto3";
+
+package foo;
+
+// @unstable
+message Released {
+  string a = 1;
+  string b = 5;
+}
+`
+	const want = `
+syntax = "proto3";
+
+package foo;
+
+// @unstable
+message Draft {
+  reserved 2;
+  string a = 1;
+  string b = 3;
+  oneof choice {
+    string c = 4;
+  }
+  map<string, string> d = 5;
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		dir := env.Sandbox.Workdir.RootURI().Path()
+		for _, args := range [][]string{
+			{"init", "-q"},
+			{"add", "released.proto"},
+			{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+		} {
+			cmd := exec.Command("git", args...)
+			cmd.Dir = dir
+			out, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(out))
+		}
+
+		env.OpenFile("draft.proto")
+		actions, err := env.Editor.CodeActions(env.Ctx, env.RegexpSearch("draft.proto", `message St()able`), nil, protocol.RefactorRewrite)
+		require.NoError(t, err)
+		for _, action := range actions {
+			require.NotEqual(t, "Compact field numbers", action.Title)
+		}
+
+		actions, err = env.Editor.CodeActions(env.Ctx, env.RegexpSearch("draft.proto", `message Dr()aft`), nil, protocol.RefactorRewrite)
+		require.NoError(t, err)
+		var found bool
+		for _, action := range actions {
+			if action.Title == "Compact field numbers" {
+				require.Nil(t, action.Disabled)
+				env.ApplyCodeAction(action)
+				found = true
+			}
+		}
+		require.True(t, found)
+		require.Contains(t, env.BufferText("draft.proto"), want[1:])
+
+		env.OpenFile("released.proto")
+		actions, err = env.Editor.CodeActions(env.Ctx, env.RegexpSearch("released.proto", `message Re()leased`), nil, protocol.RefactorRewrite)
+		require.NoError(t, err)
+		found = false
+		for _, action := range actions {
+			if action.Title == "Compact field numbers" {
+				require.NotNil(t, action.Disabled)
+				require.Equal(t, "field b of Released exists in git revision HEAD; renumbering it would break wire compatibility", action.Disabled.Reason)
+				found = true
+			}
+		}
+		require.True(t, found)
+	}, withDocumentChanges())
+}
@@ -0,0 +1,301 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompletionIncompleteStatements(t *testing.T) {
+	const src = `
+-- defs.proto --
+syntax = "proto3";
+
+package foo;
+
+import "google/protobuf/descriptor.proto";
+
+extend google.protobuf.FileOptions {
+  string fileOpt = 5000;
+}
+extend google.protobuf.FieldOptions {
+  string fieldOpt = 5000;
+}
+extend google.protobuf.MethodOptions {
+  string methodOpt = 5000;
+}
+
+message Req {}
+message Res {}
+-- fileopt.proto --
+syntax = "proto3";
+
+package foo;
+
+import "defs.proto";
+
+option (
+-- fieldopt.proto --
+syntax = "proto3";
+
+package foo;
+
+import "defs.proto";
+
+message Foo {
+  string name = 1 [deprecated = true, (
+}
+-- rpcinput.proto --
+syntax = "proto3";
+
+package foo;
+
+import "defs.proto";
+
+service Svc {
+  rpc A (R
+}
+-- rpcoutput.proto --
+syntax = "proto3";
+
+package foo;
+
+import "defs.proto";
+
+service Svc {
+  rpc A (Req) returns (stream R
+}
+-- methodopt.proto --
+syntax = "proto3";
+
+package foo;
+
+import "defs.proto";
+
+service Svc {
+  rpc A (Req) returns (Res) {
+    option (
+  }
+}
+-- bracesinstrings.proto --
+syntax = "proto3";
+
+package foo;
+
+import "defs.proto";
+
+service Svc {
+  rpc A (Req) returns (Res) {
+    option (methodOpt) = "{";
+  }
+  rpc B (R
+}
+-- bracesincomments.proto --
+syntax = "proto3";
+
+package foo;
+
+import "defs.proto";
+
+message Foo { // }
+  string name = 1 [
+    deprecated = true, // {
+    (
+}
+`
+	cases := []struct {
+		file  string
+		re    string
+		want  []string
+		exact bool
+	}{
+		{file: "fileopt.proto", re: `option \(()`, want: []string{"(fileOpt)"}, exact: true},
+		{file: "fieldopt.proto", re: `true, \(()`, want: []string{"(fieldOpt)"}, exact: true},
+		{file: "rpcinput.proto", re: `rpc A \(R()`, want: []string{"Req", "Res"}},
+		{file: "rpcoutput.proto", re: `stream R()`, want: []string{"Req", "Res"}},
+		{file: "methodopt.proto", re: `    option \(()`, want: []string{"(methodOpt)"}, exact: true},
+		{file: "bracesinstrings.proto", re: `rpc B \(R()`, want: []string{"Req", "Res"}},
+		{file: "bracesincomments.proto", re: `\n    \(()`, want: []string{"(fieldOpt)"}, exact: true},
+	}
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		for _, tc := range cases {
+			env.OpenFile(tc.file)
+			list := env.Completion(env.RegexpSearch(tc.file, tc.re))
+			var labels []string
+			for _, item := range list.Items {
+				labels = append(labels, item.Label)
+			}
+			if tc.exact {
+				require.Equal(t, tc.want, labels, tc.file)
+			} else {
+				require.Subset(t, labels, tc.want, tc.file)
+			}
+		}
+
+	})
+}
+
+func TestCompletionFieldBehavior(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+import "google/api/field_behavior.proto";
+
+message Foo {
+  string a = 1 [(google.api.field_behavior) = ];
+  string b = 2 [(google.api.field_behavior) = [REQUIRED, IMMUTABLE, ];
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		labels := func(re string) []string {
+			var labels []string
+			for _, item := range env.Completion(env.RegexpSearch("foo.proto", re)).Items {
+				labels = append(labels, item.Label)
+			}
+			return labels
+		}
+		require.Subset(t, labels(`a = 1 \[\(google.api.field_behavior\) = ()`), []string{"REQUIRED", "OUTPUT_ONLY", "IMMUTABLE"})
+
+		got := labels(`IMMUTABLE, ()`)
+		require.Contains(t, got, "OUTPUT_ONLY")
+		require.NotContains(t, got, "REQUIRED")
+		require.NotContains(t, got, "IMMUTABLE")
+	})
+}
+
+func TestCompletionWellKnownTypes(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+import "google/protobuf/any.proto";
+
+message Foo {
+  Time a = 1;
+  google.protobuf.Dur b = 2;
+  An c = 3;
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		find := func(re, label string) protocol.CompletionItem {
+			t.Helper()
+			for _, item := range env.Completion(env.RegexpSearch("foo.proto", re)).Items {
+				if item.Label == label {
+					return item
+				}
+			}
+			t.Fatalf("no completion with label %q", label)
+			return protocol.CompletionItem{}
+		}
+
+		ts := find(`  Time()`, "google.protobuf.Timestamp")
+		require.Equal(t, "google.protobuf.Timestamp", ts.TextEdit.Value.(protocol.InsertReplaceEdit).NewText)
+		require.Len(t, ts.AdditionalTextEdits, 1)
+		require.Contains(t, ts.AdditionalTextEdits[0].NewText, `import "google/protobuf/timestamp.proto";`)
+
+		dur := find(`google.protobuf.Dur()`, "google.protobuf.Duration")
+		require.Len(t, dur.AdditionalTextEdits, 1)
+		require.Contains(t, dur.AdditionalTextEdits[0].NewText, `import "google/protobuf/duration.proto";`)
+
+		// already imported
+		anyItem := find(`  An()`, "google.protobuf.Any")
+		require.Empty(t, anyItem.AdditionalTextEdits)
+	})
+}
+
+func TestCompletionDefaultOption(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto2";
+
+package foo;
+
+enum Color {
+  RED = 0;
+  GREEN = 1;
+  BLUE = 2;
+}
+
+message Foo {
+  optional Color a = 1 [default = ];
+  optional Color b = 2 [default = GREEN];
+  optional bool c = 3 [deprecated = true, default = ];
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		labels := func(re string) []string {
+			var labels []string
+			for _, item := range env.Completion(env.RegexpSearch("foo.proto", re)).Items {
+				labels = append(labels, item.Label)
+			}
+			return labels
+		}
+		require.Equal(t, []string{"RED", "GREEN", "BLUE"}, labels(`a = 1 \[default = ()`))
+		require.Equal(t, []string{"true", "false"}, labels(`c = 3 \[deprecated = true, default = ()`))
+	})
+	const valid = `
+-- foo.proto --
+syntax = "proto2";
+
+package foo;
+
+enum Color {
+  RED = 0;
+  GREEN = 1;
+  BLUE = 2;
+}
+
+message Foo {
+  optional Color b = 2 [default = GREEN];
+}
+`
+	Run(t, valid, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		var labels []string
+		for _, item := range env.Completion(env.RegexpSearch("foo.proto", `default = G()`)).Items {
+			labels = append(labels, item.Label)
+		}
+		require.Equal(t, []string{"GREEN"}, labels)
+	})
+}
+
+func TestCompletionWithSyntaxErrors(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+message Foo {
+  string name = 1;
+}
+
+message Broken {
+  string x = ;
+  rpc (
+}}
+
+message Bar {
+  Fo foo = 1;
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		list := env.Completion(env.RegexpSearch("foo.proto", `  Fo() foo = 1;`))
+		var labels []string
+		for _, item := range list.Items {
+			labels = append(labels, item.Label)
+		}
+		require.Contains(t, labels, "Foo")
+	})
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportConflicts(t *testing.T) {
+	// api/foo.proto is also provided by the example.com/app/api module, which
+	// is replaced with a copy outside the workspace
+	module := t.TempDir()
+	for name, contents := range map[string]string{
+		"go.mod": "module example.com/app/api\n\ngo 1.22\n",
+		"api.go": "package api\n",
+		"foo.proto": `syntax = "proto3";
+
+package api;
+
+message Foo {
+  string module = 1;
+}
+`,
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(module, name), []byte(contents), 0o644))
+	}
+	src := fmt.Sprintf(`
+-- go.mod --
+module example.com/app
+
+go 1.22
+
+require example.com/app/api v0.0.0
+
+replace example.com/app/api => %s
+-- a.proto --
+syntax = "proto3";
+
+package a;
+
+import "example.com/app/api/foo.proto";
+
+message A {
+  api.Foo foo = 1;
+}
+-- api/foo.proto --
+syntax = "proto3";
+
+package api;
+
+message Foo {
+  string workspace = 1;
+}
+`, module)
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("a.proto")
+		workspaceCopy := env.Sandbox.Workdir.URI("api/foo.proto")
+
+		var diag protocol.PublishDiagnosticsParams
+		env.OnceMet(
+			integration.Diagnostics(integration.ForFile("a.proto"), integration.WithMessage("using the workspace copy")),
+			integration.ReadDiagnostics("a.proto", &diag),
+		)
+		require.Len(t, diag.Diagnostics, 1)
+		require.Equal(t, protocol.SeverityInformation, diag.Diagnostics[0].Severity)
+		require.Contains(t, diag.Diagnostics[0].Message, "example.com/app/api/foo.proto is also provided by the go module example.com/app/api@v0.0.0")
+
+		setPrecedence := func(precedence ...string) []lsp.ImportConflict {
+			data, err := json.Marshal(protocolext.SetImportPrecedenceRequest{Precedence: precedence})
+			require.NoError(t, err)
+			res, err := env.Editor.Server.ExecuteCommand(env.Ctx, &protocol.ExecuteCommandParams{
+				Command:   "protols/setImportPrecedence",
+				Arguments: []json.RawMessage{data},
+			})
+			require.NoError(t, err)
+			data, err = json.Marshal(res)
+			require.NoError(t, err)
+			var conflicts []lsp.ImportConflict
+			require.NoError(t, json.Unmarshal(data, &conflicts))
+			return conflicts
+		}
+
+		conflicts := setPrecedence("goModule")
+		require.Len(t, conflicts, 1)
+		require.Equal(t, "example.com/app/api/foo.proto", conflicts[0].Path)
+		require.Equal(t, "goModule", conflicts[0].Chosen)
+		require.Equal(t, workspaceCopy, conflicts[0].WorkspaceURI)
+		require.Equal(t, "example.com/app/api", conflicts[0].GoModule.Path)
+
+		env.Await(
+			integration.Diagnostics(integration.ForFile("a.proto"), integration.WithMessage("using the copy in the go module example.com/app/api@v0.0.0")),
+		)
+		definition, err := env.Editor.Server.Definition(env.Ctx, &protocol.DefinitionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: env.Sandbox.Workdir.URI("a.proto")},
+				Position:     env.RegexpSearch("a.proto", `api\.(Foo)`).Range.Start,
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, definition, 1)
+		require.Equal(t, protocol.URIFromPath(filepath.Join(module, "foo.proto")), definition[0].URI)
+
+		conflicts = setPrecedence()
+		require.Len(t, conflicts, 1)
+		require.Equal(t, "workspace", conflicts[0].Chosen)
+		env.Await(
+			integration.Diagnostics(integration.ForFile("a.proto"), integration.WithMessage("using the workspace copy")),
+		)
+	})
+}
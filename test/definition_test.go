@@ -0,0 +1,124 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypeDefinition(t *testing.T) {
+	const src = `
+-- types.proto --
+syntax = "proto3";
+
+package foo;
+
+message Request {}
+message Response {}
+enum Kind {
+  KIND_UNSPECIFIED = 0;
+}
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+import "types.proto";
+
+message Foo {
+  Request request = 1;
+  Kind kind = 2;
+  map<string, Response> responses = 3;
+  string name = 4;
+}
+
+service Svc {
+  rpc Get(Request) returns (Response);
+  rpc Echo(Request) returns (Request);
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		typeDefinitions := func(re string) []protocol.Location {
+			loc := env.RegexpSearch("foo.proto", re)
+			locations, err := env.Editor.Server.TypeDefinition(env.Ctx, &protocol.TypeDefinitionParams{
+				TextDocumentPositionParams: protocol.LocationTextDocumentPositionParams(loc),
+			})
+			require.NoError(t, err)
+			return locations
+		}
+		request := env.RegexpSearch("types.proto", `message (Request)`)
+		response := env.RegexpSearch("types.proto", `message (Response)`)
+
+		require.Equal(t, []protocol.Location{request}, typeDefinitions(`Request (r)equest`))
+		require.Equal(t, []protocol.Location{env.RegexpSearch("types.proto", `enum (Kind)`)}, typeDefinitions(`Kind (k)ind`))
+		require.Equal(t, []protocol.Location{response}, typeDefinitions(`(r)esponses`))
+		require.Empty(t, typeDefinitions(`string (n)ame`))
+		require.Equal(t, []protocol.Location{request, response}, typeDefinitions(`rpc (G)et`))
+		require.Equal(t, []protocol.Location{request}, typeDefinitions(`rpc (E)cho`))
+	})
+}
+
+func TestReferencesOrder(t *testing.T) {
+	const src = `
+-- types.proto --
+syntax = "proto3";
+
+package foo;
+
+message Request {}
+-- c.proto --
+syntax = "proto3";
+
+package foo;
+
+import "types.proto";
+
+message C {
+  Request a = 1;
+  Request b = 2;
+}
+-- a.proto --
+syntax = "proto3";
+
+package foo;
+
+import "types.proto";
+
+message A {
+  Request a = 1;
+}
+-- b.proto --
+syntax = "proto3";
+
+package foo;
+
+import "types.proto";
+
+service B {
+  rpc Get(Request) returns (Request);
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("types.proto")
+		loc := env.RegexpSearch("types.proto", `message (Request)`)
+		for range 5 {
+			refs := env.References(loc)
+			var got []string
+			for _, ref := range refs {
+				got = append(got, env.Sandbox.Workdir.URIToPath(ref.URI)+":"+fmt.Sprint(ref.Range.Start.Line))
+			}
+			require.Equal(t, []string{
+				"a.proto:7",
+				"b.proto:7",
+				"b.proto:7",
+				"c.proto:7",
+				"c.proto:8",
+				"types.proto:4",
+			}, got)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuplicateMessages(t *testing.T) {
+	const src = `
+-- money.proto --
+syntax = "proto3";
+
+package money;
+
+message Money {
+  string currency = 1;
+  int64 units = 2;
+  map<string, string> labels = 3;
+}
+-- orders.proto --
+syntax = "proto3";
+
+package orders;
+
+// Price is a copy of money.Money.
+message Price {
+  string currency = 1;
+  int64 units = 2;
+  map<string, string> labels = 3;
+}
+
+message Order {
+  Price total = 1;
+  repeated Price items = 2;
+}
+
+message NotADuplicate {
+  string currency = 1;
+  int64 units = 3;
+}
+`
+	const want = `
+syntax = "proto3";
+
+package orders;
+import "money.proto";
+
+message Order {
+  money.Money total = 1;
+  repeated money.Money items = 2;
+}
+
+message NotADuplicate {
+  string currency = 1;
+  int64 units = 3;
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("orders.proto")
+
+		data, err := json.Marshal(protocolext.DuplicateMessagesRequest{
+			Workspace: protocol.WorkspaceFolder{URI: string(env.Sandbox.Workdir.RootURI())},
+		})
+		require.NoError(t, err)
+		res, err := env.Editor.Server.ExecuteCommand(env.Ctx, &protocol.ExecuteCommandParams{
+			Command:   "protols/duplicateMessages",
+			Arguments: []json.RawMessage{data},
+		})
+		require.NoError(t, err)
+		data, err = json.Marshal(res)
+		require.NoError(t, err)
+		var groups []lsp.DuplicateMessageGroup
+		require.NoError(t, json.Unmarshal(data, &groups))
+		require.Equal(t, []lsp.DuplicateMessageGroup{
+			{
+				Messages: []lsp.DuplicateMessage{
+					{Name: "money.Money", Location: env.RegexpSearch("money.proto", `message (Money)`)},
+					{Name: "orders.Price", Location: env.RegexpSearch("orders.proto", `message (Price)`)},
+				},
+			},
+		}, groups)
+
+		actions, err := env.Editor.CodeActions(env.Ctx, env.RegexpSearch("orders.proto", `message Pr()ice`), nil, protocol.RefactorRewrite)
+		require.NoError(t, err)
+		var found bool
+		for _, action := range actions {
+			if action.Title == "Replace with duplicate money.Money (money.proto)" {
+				env.ApplyCodeAction(action)
+				found = true
+			}
+		}
+		require.True(t, found)
+		require.Equal(t, want[1:], env.BufferText("orders.proto"))
+	}, withDocumentChanges())
+}
@@ -0,0 +1,169 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestSyntheticFileInfo(t *testing.T) {
+	// generated code for api/v1/b.proto, which is not present in the module
+	embedded, err := proto.Marshal(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("b.proto"),
+		Package:     proto.String("b"),
+		Options:     &descriptorpb.FileOptions{GoPackage: proto.String("example.com/info/api/v1")},
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("B")}},
+	})
+	require.NoError(t, err)
+	src := fmt.Sprintf(`
+-- go.mod --
+module example.com/info
+
+go 1.22
+-- a.proto --
+syntax = "proto3";
+
+package a;
+
+import "example.com/info/api/v1/b.proto";
+
+message A {
+  b.B b = 1;
+}
+-- api/v1/b.pb.go --
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: b.proto
+
+package v1
+
+var file_b_proto_rawDesc = []byte{%s}
+`, rawDescLiteral(embedded))
+
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("a.proto")
+		env.Await(integration.NoDiagnostics(integration.ForFile("a.proto")))
+
+		loc := env.RegexpSearch("a.proto", `example.com/info/api/v1/(b).proto`)
+		hover, err := env.Editor.Server.Hover(env.Ctx, &protocol.HoverParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+				Position:     loc.Range.Start,
+			},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, hover)
+		require.Contains(t, hover.Contents.Value, "- path: `example.com/info/api/v1/b.proto`\n")
+		require.Contains(t, hover.Contents.Value, "- source: synthetic\n")
+		require.Contains(t, hover.Contents.Value, "- original name: `b.proto`\n")
+		require.Contains(t, hover.Contents.Value, "- go module: `example.com/info`\n")
+
+		definition, err := env.Editor.Server.Definition(env.Ctx, &protocol.DefinitionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+				Position:     env.RegexpSearch("a.proto", `b\.(B) b`).Range.Start,
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, definition, 1)
+
+		args, err := json.Marshal(protocolext.FileInfoRequest{URI: definition[0].URI})
+		require.NoError(t, err)
+		res, err := env.Editor.Server.ExecuteCommand(env.Ctx, &protocol.ExecuteCommandParams{
+			Command:   "protols/fileInfo",
+			Arguments: []json.RawMessage{args},
+		})
+		require.NoError(t, err)
+		data, err := json.Marshal(res)
+		require.NoError(t, err)
+		var info lsp.FileInfo
+		require.NoError(t, json.Unmarshal(data, &info))
+		require.Equal(t, lsp.FileInfo{
+			URI:          definition[0].URI,
+			Path:         "example.com/info/api/v1/b.proto",
+			Source:       "synthetic",
+			OriginalName: "b.proto",
+			GoModule: &lsp.GoModuleInfo{
+				Path: "example.com/info",
+				Dir:  env.Sandbox.Workdir.RootURI().Path(),
+			},
+		}, info)
+	})
+}
+
+func TestSyntheticFileHoverComments(t *testing.T) {
+	// generated code for api/v1/b.proto, with its source code info retained
+	embedded, err := proto.Marshal(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("b.proto"),
+		Package:     proto.String("b"),
+		Options:     &descriptorpb.FileOptions{GoPackage: proto.String("example.com/info/api/v1")},
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("B")}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{{
+				Path:            []int32{4, 0},
+				Span:            []int32{3, 0, 12},
+				LeadingComments: proto.String(" B is documented.\n Second line.\n"),
+			}},
+		},
+	})
+	require.NoError(t, err)
+	src := fmt.Sprintf(`
+-- go.mod --
+module example.com/info
+
+go 1.22
+-- a.proto --
+syntax = "proto3";
+
+package a;
+
+import "example.com/info/api/v1/b.proto";
+
+message A {
+  b.B b = 1;
+}
+-- api/v1/b.pb.go --
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: b.proto
+
+package v1
+
+var file_b_proto_rawDesc = []byte{%s}
+`, rawDescLiteral(embedded))
+
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("a.proto")
+		env.Await(integration.NoDiagnostics(integration.ForFile("a.proto")))
+
+		loc := env.RegexpSearch("a.proto", `b\.(B) b`)
+		hover, err := env.Editor.Server.Hover(env.Ctx, &protocol.HoverParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+				Position:     loc.Range.Start,
+			},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, hover)
+		require.Contains(t, hover.Contents.Value, "// B is documented.\n// Second line.\nmessage B {}")
+	})
+}
+
+// rawDescLiteral formats a serialized descriptor as the elements of the byte
+// slice literal in generated code.
+func rawDescLiteral(desc []byte) string {
+	var b strings.Builder
+	for _, c := range desc {
+		fmt.Fprintf(&b, "0x%02x, ", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageFromGoStruct(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+`
+	const want = `
+syntax = "proto3";
+
+package foo;
+import "google/protobuf/timestamp.proto";
+
+message User {
+  string user_id = 1 [json_name = "id"];
+  optional string nickname = 2;
+  repeated Address addresses = 3;
+  map<string, int64> scores = 4;
+  google.protobuf.Timestamp created_at = 5 [json_name = "created_at"];
+  bytes avatar = 6;
+  Settings settings = 7;
+
+  message Settings {
+    bool dark_mode = 1 [json_name = "dark"];
+  }
+}
+
+message Address {
+  string street = 1;
+  uint32 zip_code = 2;
+}`
+	const goSource = `
+type User struct {
+	UserID    string           ` + "`json:\"id\"`" + `
+	Nickname  *string          ` + "`json:\"nickname,omitempty\"`" + `
+	Addresses []*Address
+	Scores    map[string]int
+	CreatedAt time.Time        ` + "`json:\"created_at\"`" + `
+	Avatar    []byte
+	Settings  struct {
+		DarkMode bool ` + "`json:\"dark\"`" + `
+	}
+	internal string
+	Ignored  string ` + "`json:\"-\"`" + `
+}
+
+type Address struct {
+	Street  string
+	ZipCode uint16
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		env.Await(integration.NoDiagnostics(integration.ForFile("foo.proto")))
+
+		loc := env.RegexpSearch("foo.proto", `package foo;\n\n()`)
+		args, err := json.Marshal(protocolext.MessageFromGoStructRequest{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+				Position:     loc.Range.Start,
+			},
+			Source: goSource,
+		})
+		require.NoError(t, err)
+		_, err = env.Editor.Server.ExecuteCommand(env.Ctx, &protocol.ExecuteCommandParams{
+			Command:   "protols/messageFromGoStruct",
+			Arguments: []json.RawMessage{args},
+		})
+		require.NoError(t, err)
+		require.Equal(t, want[1:], env.BufferText("foo.proto"))
+	}, withDocumentChanges())
+}
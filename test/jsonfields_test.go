@@ -0,0 +1,82 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddFieldsFromJSON(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+message Foo {
+  string id = 1;
+  reserved 2;
+}
+`
+	const want = `
+syntax = "proto3";
+
+package foo;
+
+message Foo {
+  string id = 1;
+  reserved 2;
+  string display_name = 3 [json_name = "display-name"];
+  int32 count = 4;
+  int64 created_at = 5 [json_name = "created_at"];
+  double ratio = 6;
+  bool enabled = 7;
+  repeated string tags = 8;
+  repeated Items items = 9;
+  Owner owner = 10;
+
+  message Items {
+    string name = 1;
+    double value = 2;
+  }
+
+  message Owner {
+    string user_id = 1;
+  }
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		env.Await(integration.NoDiagnostics(integration.ForFile("foo.proto")))
+
+		loc := env.RegexpSearch("foo.proto", `reserved 2;()`)
+		args, err := json.Marshal(protocolext.AddFieldsFromJSONRequest{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+				Position:     loc.Range.Start,
+			},
+			JSON: `{
+  "id": "abc",
+  "display-name": "Foo",
+  "count": 1,
+  "created_at": 1700000000000,
+  "ratio": 0.5,
+  "enabled": true,
+  "tags": ["a", "b"],
+  "items": [{"name": "x", "value": 1}, {"name": "y", "value": 1.5}],
+  "owner": {"userId": "u1"}
+}`,
+		})
+		require.NoError(t, err)
+		_, err = env.Editor.Server.ExecuteCommand(env.Ctx, &protocol.ExecuteCommandParams{
+			Command:   "protols/addFieldsFromJSON",
+			Arguments: []json.RawMessage{args},
+		})
+		require.NoError(t, err)
+		require.Equal(t, want[1:], env.BufferText("foo.proto"))
+	}, withDocumentChanges())
+}
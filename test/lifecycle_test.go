@@ -0,0 +1,94 @@
+package test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kralicky/protols/pkg/lsprpc"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/kralicky/tools-lite/pkg/jsonrpc2"
+	"github.com/kralicky/tools-lite/pkg/jsonrpc2/servertest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestsAfterShutdown(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+message Foo {}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		require.NoError(t, env.Editor.Shutdown(env.Ctx))
+
+		_, err := env.Editor.Server.Hover(env.Ctx, &protocol.HoverParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: env.Editor.TextDocumentIdentifier("foo.proto"),
+				Position:     protocol.Position{Line: 4, Character: 9},
+			},
+		})
+		var wireErr *jsonrpc2.WireError
+		require.ErrorAs(t, err, &wireErr)
+		require.Equal(t, jsonrpc2.ErrInvalidRequest.(*jsonrpc2.WireError).Code, wireErr.Code)
+	})
+}
+
+func TestIdleTimeout(t *testing.T) {
+	ctx, ca := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ca()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() {
+		served <- jsonrpc2.Serve(ctx, ln, lsprpc.NewStreamServer(lsprpc.WithSandbox(true)), 100*time.Millisecond)
+	}()
+
+	nc, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	conn := jsonrpc2.NewConn(jsonrpc2.NewHeaderStream(nc))
+	conn.Go(ctx, jsonrpc2.MethodNotFound)
+
+	// a connected client keeps the server alive, even if it sends nothing
+	select {
+	case err := <-served:
+		t.Fatalf("server exited while a client was connected: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	require.NoError(t, conn.Close())
+	select {
+	case err := <-served:
+		require.ErrorIs(t, err, jsonrpc2.ErrIdleTimeout)
+	case <-ctx.Done():
+		t.Fatal("server did not exit after the idle timeout")
+	}
+}
+
+func TestTextDocumentContentCapability(t *testing.T) {
+	ctx, ca := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ca()
+
+	ts := servertest.NewPipeServer(lsprpc.NewStreamServer(lsprpc.WithSandbox(true)), jsonrpc2.NewRawStream)
+	conn := ts.Connect(ctx)
+	conn.Go(ctx, jsonrpc2.MethodNotFound)
+
+	var result struct {
+		Capabilities struct {
+			Workspace struct {
+				TextDocumentContent struct {
+					Schemes []string `json:"schemes"`
+				} `json:"textDocumentContent"`
+			} `json:"workspace"`
+		} `json:"capabilities"`
+	}
+	_, err := conn.Call(ctx, "initialize", &protocol.ParamInitialize{}, &result)
+	require.NoError(t, err)
+	require.Equal(t, []string{"proto"}, result.Capabilities.Workspace.TextDocumentContent.Schemes)
+}
@@ -0,0 +1,691 @@
+package test
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestLintAIP(t *testing.T) {
+	const src = `
+-- library.proto --
+//protols:lint aip
+syntax = "proto3";
+
+package library;
+
+import "google/api/field_behavior.proto";
+import "google/protobuf/empty.proto";
+
+service Library {
+  rpc GetBook(GetBookRequest) returns (Book);
+  rpc ListBooks(ListBooksRequest) returns (ListBooksResponse);
+  rpc DeleteBook(DeleteBookRequest) returns (google.protobuf.Empty);
+  rpc CreateBook(CreateBookRequest) returns (CreateBookResponse);
+  rpc archive_book(ArchiveBookRequest) returns (google.protobuf.Empty);
+  rpc MoveBook(MoveBookReq) returns (Book);
+}
+
+message Book {
+  string name = 1;
+}
+
+message GetBookRequest {
+  string name = 1 [(google.api.field_behavior) = REQUIRED];
+}
+
+message ListBooksRequest {
+  string parent    = 1 [(google.api.field_behavior) = REQUIRED];
+  int64 page_size  = 2;
+  string page_token = 3;
+}
+
+message ListBooksResponse {
+  repeated Book books = 1;
+}
+
+message DeleteBookRequest {
+  string name = 1;
+}
+
+message CreateBookRequest {
+  string parent = 1 [(google.api.field_behavior) = REQUIRED];
+  Book book     = 2 [(google.api.field_behavior) = REQUIRED];
+}
+
+message CreateBookResponse {}
+
+message ArchiveBookRequest {}
+
+message MoveBookReq {}
+-- nopack.proto --
+syntax = "proto3";
+
+package nopack;
+
+service Svc {
+  rpc do_thing(Req) returns (Res);
+}
+
+message Req {}
+message Res {}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("library.proto")
+		var diag protocol.PublishDiagnosticsParams
+		env.OnceMet(
+			integration.Diagnostics(integration.ForFile("library.proto")),
+			integration.ReadDiagnostics("library.proto", &diag),
+		)
+		var messages []string
+		for _, d := range diag.Diagnostics {
+			messages = append(messages, d.Message)
+		}
+		require.ElementsMatch(t, []string{
+			`CreateBook should return the resource message Book`,
+			`method name archive_book should be UpperCamelCase`,
+			`request message for MoveBook should be named MoveBookRequest`,
+			`response message for MoveBook should be named MoveBookResponse`,
+			`field library.DeleteBookRequest.name should be annotated with (google.api.field_behavior) = REQUIRED`,
+			`pagination field library.ListBooksRequest.page_size should be of type int32`,
+			`ListBooksResponse is missing the pagination field "string next_page_token"`,
+		}, messages)
+
+		env.OpenFile("nopack.proto")
+		env.Await(integration.NoDiagnostics(integration.ForFile("nopack.proto")))
+	})
+}
+
+func TestLintFieldBehavior(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+import "google/api/field_behavior.proto";
+
+service Svc {
+  rpc Create(CreateRequest) returns (Thing);
+}
+
+message CreateRequest {
+  string parent = 1 [(google.api.field_behavior) = REQUIRED];
+  string etag   = 2 [(google.api.field_behavior) = OUTPUT_ONLY];
+  Thing thing   = 3 [(google.api.field_behavior) = REQUIRED];
+}
+
+message Thing {
+  string name       = 1 [(google.api.field_behavior) = REQUIRED, (google.api.field_behavior) = OUTPUT_ONLY];
+  string created_by = 2 [(google.api.field_behavior) = OUTPUT_ONLY];
+  string secret     = 3 [(google.api.field_behavior) = INPUT_ONLY, (google.api.field_behavior) = INPUT_ONLY];
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		var diag protocol.PublishDiagnosticsParams
+		env.OnceMet(
+			integration.Diagnostics(integration.ForFile("foo.proto")),
+			integration.ReadDiagnostics("foo.proto", &diag),
+		)
+		var messages []string
+		for _, d := range diag.Diagnostics {
+			messages = append(messages, d.Message)
+		}
+		require.ElementsMatch(t, []string{
+			`field is OUTPUT_ONLY, but foo.CreateRequest is only used in requests`,
+			`field behaviors REQUIRED and OUTPUT_ONLY are contradictory`,
+			`field behavior INPUT_ONLY is specified more than once`,
+		}, messages)
+	})
+}
+
+func TestLintJSONName(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+message Foo {
+  string user_id = 1 [json_name = "id"];
+  string userId2 = 2 [json_name = "userId"];
+  string id_value = 3;
+  string other = 4 [json_name = "id_value"];
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		var diag protocol.PublishDiagnosticsParams
+		env.OnceMet(
+			integration.Diagnostics(integration.ForFile("foo.proto")),
+			integration.ReadDiagnostics("foo.proto", &diag),
+		)
+		var messages []string
+		for _, d := range diag.Diagnostics {
+			messages = append(messages, d.Message)
+		}
+		require.ElementsMatch(t, []string{
+			`json_name "userId" collides with the default JSON name of field user_id`,
+			`json_name "id_value" collides with the name of field id_value, which is also accepted when parsing JSON`,
+		}, messages)
+	})
+}
+
+func TestLintFieldUsage(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+message Foo {
+  oneof single {
+    string a = 1;
+  }
+  oneof multiple {
+    string b = 2;
+    string c = 3;
+  }
+  optional string d = 4;
+  string foo = 5;
+}
+-- bar.proto --
+syntax = "proto2";
+
+package foo;
+
+message Bar {
+  required string name = 1;
+  optional string value = 2;
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		for file, want := range map[string][]string{
+			"foo.proto": {
+				`oneof single has a single member; consider using an optional field instead`,
+				`field foo has the same name as its enclosing message Foo`,
+			},
+			"bar.proto": {
+				`field name is required; required fields cannot be safely removed or made optional later`,
+			},
+		} {
+			env.OpenFile(file)
+			var diag protocol.PublishDiagnosticsParams
+			env.OnceMet(
+				integration.Diagnostics(integration.ForFile(file)),
+				integration.ReadDiagnostics(file, &diag),
+			)
+			var messages []string
+			for _, d := range diag.Diagnostics {
+				messages = append(messages, d.Message)
+			}
+			require.ElementsMatch(t, want, messages, file)
+		}
+	})
+}
+
+func TestLintStreamingMethodNames(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+service Foo {
+  rpc GetFoo(Request) returns (Response);
+  rpc WatchFoos(Request) returns (stream Response);
+  rpc UploadFoos(stream Request) returns (Response);
+  rpc Exchange(stream Request) returns (stream Response);
+}
+
+message Request {}
+message Response {}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		var diag protocol.PublishDiagnosticsParams
+		env.OnceMet(
+			integration.Diagnostics(integration.ForFile("foo.proto")),
+			integration.ReadDiagnostics("foo.proto", &diag),
+		)
+		var messages []string
+		for _, d := range diag.Diagnostics {
+			messages = append(messages, d.Message)
+		}
+		require.ElementsMatch(t, []string{
+			`client streaming method UploadFoos should have a name matching "Stream|Watch|Subscribe|Tail|Follow|Listen"`,
+			`bidirectional streaming method Exchange should have a name matching "Stream|Watch|Subscribe|Tail|Follow|Listen"`,
+		}, messages)
+	})
+}
+
+func TestLintExtensionDeclarations(t *testing.T) {
+	const src = `
+-- base.proto --
+syntax = "proto2";
+
+package base;
+
+message Base {
+  extensions 100 to 199 [
+    declaration = { number: 100, full_name: ".ext.declared", type: "string" },
+    declaration = { number: 101, full_name: ".ext.renamed", type: "string" },
+    declaration = { number: 102, full_name: ".ext.typed", type: "int32" },
+    verification = DECLARATION
+  ];
+  extensions 200 to 299;
+}
+-- ext.proto --
+syntax = "proto2";
+
+package ext;
+
+import "base.proto";
+
+message Value {}
+
+extend base.Base {
+  optional string declared = 100;
+  optional string wrong_name = 101;
+  optional string typed = 102;
+  repeated Value undeclared = 103;
+  optional string unverified = 200;
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("base.proto")
+		env.OpenFile("ext.proto")
+		var diag protocol.PublishDiagnosticsParams
+		env.OnceMet(
+			integration.Diagnostics(integration.ForFile("ext.proto")),
+			integration.ReadDiagnostics("ext.proto", &diag),
+		)
+		var messages []string
+		var undeclared protocol.Diagnostic
+		for _, d := range diag.Diagnostics {
+			messages = append(messages, d.Message)
+			if d.Range.Start.Line == 12 {
+				undeclared = d
+			}
+		}
+		require.ElementsMatch(t, []string{
+			`extension number 101 is declared in base.Base with full_name ".ext.renamed", not ".ext.wrong_name"`,
+			`extension typed is declared in base.Base with type "int32", not "string"`,
+			`extension number 103 is not declared in the extension range of base.Base`,
+		}, messages)
+
+		actions, err := env.Editor.CodeActions(env.Ctx, protocol.Location{
+			URI:   env.Sandbox.Workdir.URI("ext.proto"),
+			Range: undeclared.Range,
+		}, []protocol.Diagnostic{undeclared}, protocol.QuickFix)
+		require.NoError(t, err)
+		var found bool
+		for _, action := range actions {
+			if action.Title == "Declare extension ext.undeclared in base.Base" {
+				env.EditBuffer("base.proto", action.Edit.Changes[env.Sandbox.Workdir.URI("base.proto")]...)
+				found = true
+			}
+		}
+		require.True(t, found)
+		require.Contains(t, env.BufferText("base.proto"),
+			`    verification = DECLARATION,
+    declaration = { number: 103, full_name: ".ext.undeclared", type: ".ext.Value", repeated: true }
+  ];`)
+	})
+}
+
+func TestLintStringEscapes(t *testing.T) {
+	const src = `
+-- a.proto --
+syntax = "proto2";
+
+package a;
+
+import "google/protobuf/descriptor.proto";
+
+extend google.protobuf.MessageOptions {
+  optional string label = 50000;
+  optional bytes data = 50001;
+}
+
+message A {
+  option (label) = "\xff\xfe";
+  option (data) = "\xff\xfe";
+  optional string s = 1 [default = "caf\303\251"];
+  optional string t = 2 [default = "\351t\351"];
+  optional string u = 3 [default = "\uD83D"];
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("a.proto")
+		var diag protocol.PublishDiagnosticsParams
+		env.OnceMet(
+			integration.Diagnostics(integration.ForFile("a.proto")),
+			integration.ReadDiagnostics("a.proto", &diag),
+		)
+		var messages []string
+		for _, d := range diag.Diagnostics {
+			messages = append(messages, fmt.Sprintf("%d: %s", d.Range.Start.Line, d.Message))
+		}
+		require.ElementsMatch(t, []string{
+			`12: value of string field label is not valid UTF-8; use a bytes field for binary data`,
+			`15: value of string field t is not valid UTF-8; use a bytes field for binary data`,
+			`16: unicode escape \uD83D is a surrogate code point, which cannot be encoded in UTF-8 and will be replaced with U+FFFD`,
+		}, messages)
+	})
+}
+
+func TestLintSpelling(t *testing.T) {
+	const src = `
+-- a.proto --
+//protols:lint spelling
+syntax = "proto3";
+
+package a;
+
+// Stores the recieved adress of a Client.
+message ClientAdress {
+  string adress_line = 1;
+}
+
+message Request {
+  ClientAdress client = 1;
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("a.proto")
+		var diag protocol.PublishDiagnosticsParams
+		env.OnceMet(
+			integration.Diagnostics(integration.ForFile("a.proto")),
+			integration.ReadDiagnostics("a.proto", &diag),
+		)
+		var messages []string
+		var nameDiag, commentDiag protocol.Diagnostic
+		for _, d := range diag.Diagnostics {
+			messages = append(messages, fmt.Sprintf("%d: %s", d.Range.Start.Line, d.Message))
+			switch d.Code {
+			case "spelling-names":
+				if d.Range.Start.Line == 6 {
+					nameDiag = d
+				}
+			case "spelling-comments":
+				if strings.Contains(d.Message, "recieved") {
+					commentDiag = d
+				}
+			}
+		}
+		require.ElementsMatch(t, []string{
+			`5: "recieved" is misspelled; did you mean "received"?`,
+			`5: "adress" is misspelled; did you mean "address"?`,
+			`6: ClientAdress contains misspelled words: "Adress" ("Address")`,
+			`7: adress_line contains misspelled words: "adress" ("address")`,
+		}, messages)
+
+		actions, err := env.Editor.CodeActions(env.Ctx, protocol.Location{
+			URI:   env.Sandbox.Workdir.URI("a.proto"),
+			Range: commentDiag.Range,
+		}, []protocol.Diagnostic{commentDiag}, protocol.QuickFix)
+		require.NoError(t, err)
+		require.Len(t, actions, 1)
+		require.Equal(t, `Change "recieved" to "received"`, actions[0].Title)
+		env.EditBuffer("a.proto", actions[0].Edit.Changes[env.Sandbox.Workdir.URI("a.proto")]...)
+
+		actions, err = env.Editor.CodeActions(env.Ctx, protocol.Location{
+			URI:   env.Sandbox.Workdir.URI("a.proto"),
+			Range: nameDiag.Range,
+		}, []protocol.Diagnostic{nameDiag}, protocol.QuickFix)
+		require.NoError(t, err)
+		require.Len(t, actions, 1)
+		require.Equal(t, "Rename to ClientAddress", actions[0].Title)
+		env.ApplyCodeAction(actions[0])
+
+		require.Equal(t, `//protols:lint spelling
+syntax = "proto3";
+
+package a;
+
+// Stores the received adress of a Client.
+message ClientAddress {
+  string adress_line = 1;
+}
+
+message Request {
+  ClientAddress client = 1;
+}
+`, env.BufferText("a.proto"))
+	}, withDocumentChanges())
+}
+
+func TestLintNamingConventions(t *testing.T) {
+	const src = `
+-- a.proto --
+//protols:lint naming
+syntax = "proto3";
+
+package a;
+
+message user_profile {
+  string DisplayName = 1;
+  Color color = 2;
+  oneof Contact {
+    string email = 3;
+    string phone = 4;
+  }
+}
+
+enum Color {
+  COLOR_UNSPECIFIED = 0;
+  RED = 1;
+  color_blue = 2;
+}
+
+service profiles {
+  rpc get_profile(user_profile) returns (user_profile);
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("a.proto")
+		var diag protocol.PublishDiagnosticsParams
+		env.OnceMet(
+			integration.Diagnostics(integration.ForFile("a.proto")),
+			integration.ReadDiagnostics("a.proto", &diag),
+		)
+		var messages []string
+		diagnostics := map[string]protocol.Diagnostic{}
+		for _, d := range diag.Diagnostics {
+			messages = append(messages, d.Message)
+			diagnostics[d.Message] = d
+		}
+		require.ElementsMatch(t, []string{
+			`message name user_profile should be PascalCase`,
+			`field name DisplayName should be lower_snake_case`,
+			`oneof name Contact should be lower_snake_case`,
+			`enum value name RED should be prefixed with COLOR_`,
+			`enum value name color_blue should be UPPER_SNAKE_CASE and should be prefixed with COLOR_`,
+			`service name profiles should be PascalCase`,
+			`method name get_profile should be PascalCase`,
+		}, messages)
+
+		for _, tc := range []struct {
+			message string
+			title   string
+		}{
+			{`message name user_profile should be PascalCase`, "Rename to UserProfile"},
+			{`enum value name RED should be prefixed with COLOR_`, "Rename to COLOR_RED"},
+			{`enum value name color_blue should be UPPER_SNAKE_CASE and should be prefixed with COLOR_`, "Rename to COLOR_BLUE"},
+		} {
+			d := diagnostics[tc.message]
+			actions, err := env.Editor.CodeActions(env.Ctx, protocol.Location{
+				URI:   env.Sandbox.Workdir.URI("a.proto"),
+				Range: d.Range,
+			}, []protocol.Diagnostic{d}, protocol.QuickFix)
+			require.NoError(t, err)
+			require.Len(t, actions, 1)
+			require.Equal(t, tc.title, actions[0].Title)
+			env.ApplyCodeAction(actions[0])
+		}
+		require.Equal(t, `//protols:lint naming
+syntax = "proto3";
+
+package a;
+
+message UserProfile {
+  string DisplayName = 1;
+  Color color = 2;
+  oneof Contact {
+    string email = 3;
+    string phone = 4;
+  }
+}
+
+enum Color {
+  COLOR_UNSPECIFIED = 0;
+  COLOR_RED = 1;
+  COLOR_BLUE = 2;
+}
+
+service profiles {
+  rpc get_profile(UserProfile) returns (UserProfile);
+}
+`, env.BufferText("a.proto"))
+	}, withDocumentChanges())
+}
+
+func TestLintGoPackageDrift(t *testing.T) {
+	const src = `
+-- go.mod --
+module example.com/drift
+
+go 1.22
+-- api/v1/a.proto --
+syntax = "proto3";
+
+package api.v1;
+
+option go_package = "example.com/drift/api/v1;apiv1";
+
+message A {}
+-- gen/api/v1/a.pb.go --
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: api/v1/a.proto
+
+package apiv1
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("api/v1/a.proto")
+		var diag protocol.PublishDiagnosticsParams
+		env.OnceMet(
+			integration.Diagnostics(integration.ForFile("api/v1/a.proto")),
+			integration.ReadDiagnostics("api/v1/a.proto", &diag),
+		)
+		var messages []string
+		for _, d := range diag.Diagnostics {
+			messages = append(messages, fmt.Sprintf("%d: %s", d.Range.Start.Line, d.Message))
+		}
+		require.ElementsMatch(t, []string{
+			`4: generated code for this file is in package example.com/drift/gen/api/v1, but go_package refers to example.com/drift/api/v1`,
+		}, messages)
+
+		uri := env.Sandbox.Workdir.URI("api/v1/a.proto")
+		d := diag.Diagnostics[0]
+		actions, err := env.Editor.CodeActions(env.Ctx, protocol.Location{URI: uri, Range: d.Range}, []protocol.Diagnostic{d}, protocol.QuickFix)
+		require.NoError(t, err)
+		require.Len(t, actions, 1)
+		require.Equal(t, `Change go_package to "example.com/drift/gen/api/v1;apiv1"`, actions[0].Title)
+		env.EditBuffer("api/v1/a.proto", actions[0].Edit.Changes[uri]...)
+		require.Contains(t, env.BufferText("api/v1/a.proto"), `option go_package = "example.com/drift/gen/api/v1;apiv1";`)
+	})
+}
+
+func TestLintStaleGeneratedCode(t *testing.T) {
+	// generated code for a version of a.proto without A's "id" and "b" fields
+	// or message B
+	embedded, err := proto.Marshal(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("a.proto"),
+		Package: proto.String("a"),
+		Options: &descriptorpb.FileOptions{GoPackage: proto.String("example.com/stale")},
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("A"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("name"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				JsonName: proto.String("name"),
+			}},
+		}},
+	})
+	require.NoError(t, err)
+	var rawDesc strings.Builder
+	for _, b := range embedded {
+		fmt.Fprintf(&rawDesc, "0x%02x, ", b)
+	}
+	src := fmt.Sprintf(`
+-- go.mod --
+module example.com/stale
+
+go 1.22
+-- a.proto --
+syntax = "proto3";
+
+package a;
+
+option go_package = "example.com/stale";
+
+message A {
+  string name = 1;
+  string id = 2;
+  B b = 3;
+}
+
+message B {
+  string x = 1;
+}
+-- a.pb.go --
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: a.proto
+
+package stale
+
+var file_a_proto_rawDesc = []byte{%s}
+`, rawDesc.String())
+
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("a.proto")
+		var diag protocol.PublishDiagnosticsParams
+		env.OnceMet(
+			integration.Diagnostics(integration.ForFile("a.proto")),
+			integration.ReadDiagnostics("a.proto", &diag),
+		)
+		var messages []string
+		for _, d := range diag.Diagnostics {
+			messages = append(messages, fmt.Sprintf("%d: %s", d.Range.Start.Line, d.Message))
+		}
+		require.ElementsMatch(t, []string{
+			`0: generated code is out of date (a.pb.go)`,
+			`8: id is missing from the generated code`,
+			`9: b is missing from the generated code`,
+			`12: B is missing from the generated code`,
+		}, messages)
+
+		uri := env.Sandbox.Workdir.URI("a.proto")
+		i := slices.IndexFunc(diag.Diagnostics, func(d protocol.Diagnostic) bool { return d.Range.Start.Line == 0 })
+		actions, err := env.Editor.CodeActions(env.Ctx, protocol.Location{URI: uri, Range: diag.Diagnostics[i].Range}, diag.Diagnostics[i:i+1], protocol.QuickFix)
+		require.NoError(t, err)
+		require.Len(t, actions, 1)
+		require.Equal(t, "protols/generate", actions[0].Command.Command)
+
+		// removing the new declarations brings the file back in sync
+		env.RegexpReplace("a.proto", "\n  string id = 2;\n  B b = 3;\n}\n\nmessage B {\n  string x = 1;", "")
+		env.Await(integration.NoDiagnostics(integration.ForFile("a.proto")))
+	})
+}
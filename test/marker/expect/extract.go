@@ -34,8 +34,11 @@ type Identifier string
 func Parse(filename string, content []byte) ([]*Note, error) {
 	switch filepath.Ext(filename) {
 	case ".proto":
-		filenode, err := parser.Parse(filename, bytes.NewReader(content), reporter.NewHandler(nil), 0)
-		if err != nil {
+		// syntax errors are left for the server under test to report, so that
+		// notes can be placed in files which do not parse cleanly
+		ignoreErrors := reporter.NewReporter(func(reporter.ErrorWithPos) error { return nil }, nil)
+		filenode, err := parser.Parse(filename, bytes.NewReader(content), reporter.NewHandler(ignoreErrors), 0)
+		if filenode == nil {
 			return nil, err
 		}
 		return ExtractProto(filenode)
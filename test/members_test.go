@@ -0,0 +1,76 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageMembers(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto2";
+
+package foo;
+
+message Foo {
+  optional string name = 1;
+  optional int32 count = 2;
+  extensions 100 to 200;
+}
+-- ext1.proto --
+syntax = "proto2";
+
+package foo;
+
+import "foo.proto";
+
+extend Foo {
+  optional string ext_b = 101;
+}
+-- ext2.proto --
+syntax = "proto2";
+
+package foo;
+
+import "foo.proto";
+
+message Bar {
+  extend Foo {
+    optional string ext_a = 100;
+  }
+  optional Foo foo = 1;
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("ext2.proto")
+		members := func(loc protocol.Location) []protocol.Location {
+			data, err := json.Marshal(protocolext.MessageMembersParams{
+				TextDocumentPositionParams: protocol.LocationTextDocumentPositionParams(loc),
+			})
+			require.NoError(t, err)
+			res, err := env.Editor.Server.ExecuteCommand(env.Ctx, &protocol.ExecuteCommandParams{
+				Command:   "protols/messageMembers",
+				Arguments: []json.RawMessage{data},
+			})
+			require.NoError(t, err)
+			data, err = json.Marshal(res)
+			require.NoError(t, err)
+			var locations []protocol.Location
+			require.NoError(t, json.Unmarshal(data, &locations))
+			return locations
+		}
+		want := []protocol.Location{
+			env.RegexpSearch("foo.proto", `optional string (name)`),
+			env.RegexpSearch("foo.proto", `optional int32 (count)`),
+			env.RegexpSearch("ext2.proto", `optional string (ext_a)`),
+			env.RegexpSearch("ext1.proto", `optional string (ext_b)`),
+		}
+		require.Equal(t, want, members(env.RegexpSearch("foo.proto", `message F()oo`)))
+		require.Equal(t, want, members(env.RegexpSearch("ext2.proto", `optional Foo f()oo`)))
+	})
+}
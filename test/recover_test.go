@@ -0,0 +1,71 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kralicky/protols/pkg/lsprpc"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/pkg/jsonrpc2"
+	"github.com/kralicky/tools-lite/pkg/jsonrpc2/servertest"
+	"github.com/stretchr/testify/require"
+)
+
+type panickingServer struct{}
+
+func (panickingServer) ServeStream(ctx context.Context, conn jsonrpc2.Conn) error {
+	conn.Go(ctx, lsprpc.AsyncHandler(
+		lsprpc.RecoverHandler(conn,
+			jsonrpc2.MustReplyHandler(func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+				if req.Method() == "panic" {
+					var m map[string]int
+					m["x"] = 1
+				}
+				return reply(ctx, "ok", nil)
+			}))))
+	<-conn.Done()
+	return conn.Err()
+}
+
+func TestRecoverHandler(t *testing.T) {
+	ctx, ca := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ca()
+
+	ts := servertest.NewPipeServer(panickingServer{}, jsonrpc2.NewRawStream)
+	conn := ts.Connect(ctx)
+	notifications := make(chan protocolext.ServerErrorParams, 1)
+	conn.Go(ctx, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == protocolext.ServerErrorNotification {
+			var params protocolext.ServerErrorParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return err
+			}
+			notifications <- params
+		}
+		return reply(ctx, nil, nil)
+	})
+
+	var result string
+	_, err := conn.Call(ctx, "panic", nil, &result)
+	var wireErr *jsonrpc2.WireError
+	require.True(t, errors.As(err, &wireErr))
+	require.Equal(t, jsonrpc2.ErrInternal.(*jsonrpc2.WireError).Code, wireErr.Code)
+	require.Contains(t, wireErr.Message, "assignment to entry in nil map")
+
+	select {
+	case params := <-notifications:
+		require.Equal(t, "panic", params.Method)
+		require.Contains(t, params.Message, "assignment to entry in nil map")
+		require.Contains(t, params.Stack, "panickingServer")
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for server error notification")
+	}
+
+	// the server should still be able to handle requests
+	_, err = conn.Call(ctx, "ok", nil, &result)
+	require.NoError(t, err)
+	require.Equal(t, "ok", result)
+}
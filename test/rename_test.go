@@ -0,0 +1,83 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenamePackage(t *testing.T) {
+	const src = `
+-- foo/a.proto --
+syntax = "proto3";
+
+package foo.v1;
+
+message A {
+  message Nested {}
+  B b = 1;
+}
+
+-- foo/b.proto --
+syntax = "proto3";
+
+package foo.v1;
+
+message B {}
+
+-- bar/bar.proto --
+syntax = "proto3";
+
+package bar;
+
+import "foo/a.proto";
+
+message Bar {
+  foo.v1.A a = 1;
+  .foo.v1.A.Nested nested = 2;
+}
+
+service BarService {
+  rpc Get(foo.v1.A) returns (Bar);
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo/a.proto")
+		env.OpenFile("bar/bar.proto")
+		env.Await(
+			integration.NoDiagnostics(integration.ForFile("foo/a.proto")),
+			integration.NoDiagnostics(integration.ForFile("bar/bar.proto")),
+		)
+
+		loc := env.RegexpSearch("foo/a.proto", `package (foo)\.v1`)
+		prep, err := env.Editor.Server.PrepareRename(env.Ctx, &protocol.PrepareRenameParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+				Position:     loc.Range.Start,
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "foo.v1", prep.Placeholder)
+
+		edit, err := env.Editor.Server.Rename(env.Ctx, &protocol.RenameParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: loc.URI},
+			Position:     loc.Range.Start,
+			NewName:      "foo.v2",
+		})
+		require.NoError(t, err)
+
+		newTextByFile := map[string][]string{}
+		require.Empty(t, edit.Changes)
+		for _, change := range edit.DocumentChanges {
+			path := env.Sandbox.Workdir.URIToPath(change.TextDocumentEdit.TextDocument.URI)
+			for _, e := range protocol.AsTextEdits(change.TextDocumentEdit.Edits) {
+				newTextByFile[path] = append(newTextByFile[path], e.NewText)
+			}
+		}
+		require.ElementsMatch(t, []string{"foo.v2"}, newTextByFile["foo/a.proto"])
+		require.ElementsMatch(t, []string{"foo.v2"}, newTextByFile["foo/b.proto"])
+		require.ElementsMatch(t, []string{".foo.v2.A", ".foo.v2.A.Nested", ".foo.v2.A"}, newTextByFile["bar/bar.proto"])
+	}, withDocumentChanges())
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// generatedCode returns the source of a .pb.go file embedding the descriptor.
+func generatedCode(t *testing.T, fd *descriptorpb.FileDescriptorProto) string {
+	t.Helper()
+	embedded, err := proto.Marshal(fd)
+	require.NoError(t, err)
+	var rawDesc strings.Builder
+	for _, b := range embedded {
+		fmt.Fprintf(&rawDesc, "0x%02x, ", b)
+	}
+	return fmt.Sprintf(`// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: %s
+
+package v1
+
+var file_%s_rawDesc = []byte{%s}
+`, fd.GetName(), strings.ReplaceAll(strings.TrimSuffix(fd.GetName(), ".proto"), "/", "_")+"_proto", rawDesc.String())
+}
+
+func TestReresolve(t *testing.T) {
+	b := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("b.proto"),
+		Package:     proto.String("b"),
+		Options:     &descriptorpb.FileOptions{GoPackage: proto.String("example.com/reresolve/api/v1")},
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("B")}},
+	}
+	src := fmt.Sprintf(`
+-- go.mod --
+module example.com/reresolve
+
+go 1.22
+-- a.proto --
+syntax = "proto3";
+
+package a;
+
+import "example.com/reresolve/api/v1/b.proto";
+
+message A {
+  b.B b = 1;
+  b.C c = 2;
+}
+-- api/v1/b.pb.go --
+%s`, generatedCode(t, b))
+
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("a.proto")
+		env.Await(integration.Diagnostics(integration.ForFile("a.proto"), integration.WithMessage("b.C")))
+
+		res, err := env.Editor.Server.ExecuteCommand(env.Ctx, &protocol.ExecuteCommandParams{
+			Command: "protols/paths",
+		})
+		require.NoError(t, err)
+		data, err := json.Marshal(res)
+		require.NoError(t, err)
+		var workspaces []lsp.WorkspacePathMappings
+		require.NoError(t, json.Unmarshal(data, &workspaces))
+		require.Len(t, workspaces, 1)
+		var synthetic protocol.DocumentURI
+		for _, m := range workspaces[0].Mappings {
+			if m.Path == "example.com/reresolve/api/v1/b.proto" {
+				synthetic = m.URI
+			}
+		}
+		require.NotEmpty(t, synthetic)
+
+		// the generated code is updated outside the editor
+		b.MessageType = append(b.MessageType, &descriptorpb.DescriptorProto{Name: proto.String("C")})
+		require.NoError(t, env.Sandbox.Workdir.WriteFile(env.Ctx, "api/v1/b.pb.go", generatedCode(t, b)))
+
+		args, err := json.Marshal(protocolext.ReresolveRequest{URI: synthetic})
+		require.NoError(t, err)
+		_, err = env.Editor.Server.ExecuteCommand(env.Ctx, &protocol.ExecuteCommandParams{
+			Command:   "protols/reresolve",
+			Arguments: []json.RawMessage{args},
+		})
+		require.NoError(t, err)
+		env.Await(integration.NoDiagnostics(integration.ForFile("a.proto")))
+
+		contents, err := env.Editor.Server.ExecuteCommand(env.Ctx, &protocol.ExecuteCommandParams{
+			Command:   "protols/syntheticFileContents",
+			Arguments: []json.RawMessage{args},
+		})
+		require.NoError(t, err)
+		require.Contains(t, contents, "message C {}")
+	})
+}
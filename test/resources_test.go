@@ -0,0 +1,79 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceAnnotations(t *testing.T) {
+	const src = `
+-- library.proto --
+syntax = "proto3";
+
+package library;
+
+import "google/api/resource.proto";
+
+message Book {
+  option (google.api.resource) = {
+    type: "library.googleapis.com/Book"
+    pattern: "shelves/{shelf}/books/{book}"
+  };
+  string name = 1;
+}
+
+message Shelf {
+  option (google.api.resource) = {
+    type: "library.googleapis.com/Shelf"
+    pattern: "shelves/{shelf}/"
+    pattern: "Shelves/{shelf}/books/{shelf}"
+  };
+  string id = 1;
+}
+-- service.proto --
+syntax = "proto3";
+
+package library;
+
+import "google/api/resource.proto";
+
+message GetBookRequest {
+  string name = 1 [(google.api.resource_reference).type = "library.googleapis.com/Book"];
+}
+
+message ListBooksRequest {
+  string parent = 1 [(google.api.resource_reference) = {child_type: ""}];
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("library.proto")
+		var diag protocol.PublishDiagnosticsParams
+		env.OnceMet(
+			integration.Diagnostics(integration.ForFile("library.proto")),
+			integration.ReadDiagnostics("library.proto", &diag),
+		)
+		var messages []string
+		for _, d := range diag.Diagnostics {
+			messages = append(messages, d.Message)
+		}
+		require.ElementsMatch(t, []string{
+			`invalid resource pattern "shelves/{shelf}/": pattern must not begin or end with '/'`,
+			`invalid resource pattern "Shelves/{shelf}/books/{shelf}": collection identifier "Shelves" must be lowerCamelCase`,
+			`resource message Shelf is missing a "name" field`,
+		}, messages)
+
+		env.OpenFile("service.proto")
+		loc := env.GoToDefinition(env.RegexpSearch("service.proto", `"library.googleapis.com/(Book)"`))
+		require.Equal(t, env.RegexpSearch("library.proto", `message (Book)`), loc)
+
+		list := env.Completion(env.RegexpSearch("service.proto", `child_type: "()"`))
+		var labels []string
+		for _, item := range list.Items {
+			labels = append(labels, item.Label)
+		}
+		require.Equal(t, []string{"library.googleapis.com/Book", "library.googleapis.com/Shelf"}, labels)
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/kralicky/protols/pkg/lsprpc"
 	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
@@ -51,8 +52,8 @@ func Main(m *testing.M) {
 	code = m.Run()
 }
 
-func Run(t *testing.T, files string, f TestFunc) {
-	runner.Run(t, files, f)
+func Run(t *testing.T, files string, f TestFunc, opts ...RunOption) {
+	runner.Run(t, files, f, opts...)
 }
 
 type Runner struct {
@@ -63,46 +64,59 @@ type Runner struct {
 
 type (
 	TestFunc  func(t *testing.T, env *integration.Env)
+	RunOption func(*runConfig)
 	runConfig struct {
-		editor  fake.EditorConfig
-		sandbox fake.SandboxConfig
+		editor fake.EditorConfig
 	}
 )
 
-func defaultConfig() runConfig {
-	return runConfig{
-		editor: fake.EditorConfig{
-			ClientName: "gotest",
-			FileAssociations: map[string]string{
-				"protobuf": `.*\.proto$`,
-			},
-			CapabilitiesJSON: []byte(`{"textDocument":{"codeAction":{"resolveSupport":{"properties":["edit"]}}}}`),
+func defaultEditorConfig() fake.EditorConfig {
+	return fake.EditorConfig{
+		ClientName: "gotest",
+		FileAssociations: map[string]string{
+			"protobuf": `.*\.proto$`,
 		},
+		CapabilitiesJSON: []byte(`{"textDocument":{"codeAction":{"resolveSupport":{"properties":["edit"]}}}}`),
 	}
 }
 
-// Run executes the test function in the default configured gopls execution
-// modes. For each a test run, a new workspace is created containing the
-// un-txtared files specified by filedata.
-func (r *Runner) Run(t *testing.T, files string, test TestFunc, opts ...integration.RunOption) {
-	// TODO(rfindley): this function has gotten overly complicated, and warrants
-	// refactoring.
+// withEditorConfig replaces the configuration of the fake editor.
+func withEditorConfig(config fake.EditorConfig) RunOption {
+	return func(c *runConfig) {
+		c.editor = config
+	}
+}
+
+// withDocumentChanges configures the editor to accept versioned document
+// changes in workspace edits. The fake editor only applies edits in that form,
+// so tests which apply code actions or read document changes need it.
+func withDocumentChanges() RunOption {
+	config := defaultEditorConfig()
+	config.CapabilitiesJSON = []byte(`{"textDocument":{"codeAction":{"resolveSupport":{"properties":["edit"]}}},"workspace":{"workspaceEdit":{"documentChanges":true}}}`)
+	return withEditorConfig(config)
+}
+
+// Run executes the test function against an in-process server. For each test
+// run, a new workspace is created containing the un-txtared files specified
+// by files.
+func (r *Runner) Run(t *testing.T, files string, test TestFunc, opts ...RunOption) {
 	t.Helper()
 
-	config := defaultConfig()
+	config := runConfig{editor: defaultEditorConfig()}
+	for _, opt := range opts {
+		opt(&config)
+	}
 	t.Run("in-process", func(t *testing.T) {
-		// TODO: shutdown is broken in the upstream code; if it gets fixed, this
-		// should implement and verify correct shutdown behavior.
 		ctx, ca := context.WithCancel(context.Background())
 		defer ca()
 		rootDir := filepath.Join(r.tempDir, filepath.FromSlash(t.Name()))
 		if err := os.MkdirAll(rootDir, 0o755); err != nil {
 			t.Fatal(err)
 		}
-		files := fake.UnpackTxt(files)
-		config.sandbox.Files = files
-		config.sandbox.RootDir = rootDir
-		sandbox, err := fake.NewSandbox(&config.sandbox)
+		sandbox, err := fake.NewSandbox(&fake.SandboxConfig{
+			RootDir: rootDir,
+			Files:   fake.UnpackTxt(files),
+		})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -113,18 +127,23 @@ func (r *Runner) Run(t *testing.T, files string, test TestFunc, opts ...integrat
 				}
 			}
 		}()
-		ss := lsprpc.NewStreamServer()
 
-		framer := jsonrpc2.NewRawStream
 		ls := &loggingFramer{}
-		framer = ls.framer(jsonrpc2.NewRawStream)
-		ts := servertest.NewPipeServer(ss, framer)
+		ts := servertest.NewPipeServer(lsprpc.NewStreamServer(), ls.framer(jsonrpc2.NewRawStream))
 		awaiter := integration.NewAwaiter(sandbox.Workdir)
 		const skipApplyEdits = false
 		editor, err := fake.NewEditor(sandbox, config.editor).Connect(ctx, ts, awaiter.Hooks(), skipApplyEdits)
 		if err != nil {
 			t.Fatal(err)
 		}
+		defer func() {
+			// the server should close the connection after shutdown and exit
+			closeCtx, ca := context.WithTimeout(ctx, 10*time.Second)
+			defer ca()
+			if err := editor.Close(closeCtx); err != nil {
+				t.Errorf("closing the editor: %v", err)
+			}
+		}()
 		env := &integration.Env{
 			T:       t,
 			Ctx:     ctx,
@@ -201,9 +220,9 @@ func (s *loggingFramer) printBuffers(testname string, w io.Writer) {
 	if s.buf == nil {
 		return
 	}
-	fmt.Fprintf(os.Stderr, "#### Start Gopls Test Logs for %q\n", testname)
+	fmt.Fprintf(w, "#### Start Test Logs for %q\n", testname)
 	s.buf.mu.Lock()
 	io.Copy(w, &s.buf.buf)
 	s.buf.mu.Unlock()
-	fmt.Fprintf(os.Stderr, "#### End Gopls Test Logs for %q\n", testname)
+	fmt.Fprintf(w, "#### End Test Logs for %q\n", testname)
 }
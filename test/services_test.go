@@ -0,0 +1,108 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kralicky/protols/pkg/lsp"
+	"github.com/kralicky/protols/pkg/protocolext"
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServices(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+import "google/api/annotations.proto";
+
+service FooService {
+  rpc GetFoo(Foo) returns (Foo) {
+    option (google.api.http) = {get: "/v1/foo"};
+  }
+  rpc WatchFoos(Foo) returns (stream Foo) {
+    option deprecated = true;
+  }
+}
+
+message Foo {}
+-- bar.proto --
+syntax = "proto3";
+
+package bar;
+
+import "foo.proto";
+
+service BarService {
+  option deprecated = true;
+  rpc Chat(stream foo.Foo) returns (stream foo.Foo);
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		env.OpenFile("bar.proto")
+
+		data, err := json.Marshal(protocolext.ServicesRequest{
+			Workspace: protocol.WorkspaceFolder{URI: string(env.Sandbox.Workdir.RootURI())},
+		})
+		require.NoError(t, err)
+		res, err := env.Editor.Server.ExecuteCommand(env.Ctx, &protocol.ExecuteCommandParams{
+			Command:   "protols/services",
+			Arguments: []json.RawMessage{data},
+		})
+		require.NoError(t, err)
+		data, err = json.Marshal(res)
+		require.NoError(t, err)
+		var services []lsp.Service
+		require.NoError(t, json.Unmarshal(data, &services))
+		require.Equal(t, []lsp.Service{
+			{
+				Name:        "bar.BarService",
+				Path:        "bar.proto",
+				Location:    env.RegexpSearch("bar.proto", `service (BarService)`),
+				Deprecated:  true,
+				Annotations: json.RawMessage(`{"deprecated":true}`),
+				Methods: []lsp.Method{
+					{
+						Name:            "Chat",
+						FullPath:        "/bar.BarService/Chat",
+						Location:        env.RegexpSearch("bar.proto", `rpc (Chat)`),
+						RequestType:     "foo.Foo",
+						ResponseType:    "foo.Foo",
+						ClientStreaming: true,
+						ServerStreaming: true,
+					},
+				},
+			},
+			{
+				Name:     "foo.FooService",
+				Path:     "foo.proto",
+				Location: env.RegexpSearch("foo.proto", `service (FooService)`),
+				Methods: []lsp.Method{
+					{
+						Name:         "GetFoo",
+						FullPath:     "/foo.FooService/GetFoo",
+						Location:     env.RegexpSearch("foo.proto", `rpc (GetFoo)`),
+						RequestType:  "foo.Foo",
+						ResponseType: "foo.Foo",
+						Annotations:  json.RawMessage(`{"[google.api.http]":{"get":"/v1/foo"}}`),
+					},
+					{
+						Name:            "WatchFoos",
+						FullPath:        "/foo.FooService/WatchFoos",
+						Location:        env.RegexpSearch("foo.proto", `rpc (WatchFoos)`),
+						RequestType:     "foo.Foo",
+						ResponseType:    "foo.Foo",
+						ServerStreaming: true,
+						Deprecated:      true,
+						Annotations:     json.RawMessage(`{"deprecated":true}`),
+					},
+				},
+			},
+		}, services)
+	})
+}
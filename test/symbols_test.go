@@ -0,0 +1,99 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kralicky/tools-lite/gopls/pkg/protocol"
+	"github.com/kralicky/tools-lite/gopls/pkg/test/integration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentSymbolsWithSyntaxErrors(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+message Foo {
+  string name = 1;
+}
+
+message Broken {
+  string x = ;
+  rpc (
+}}
+
+message Bar {
+  Foo foo = 1;
+}
+`
+	Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		symbols, err := env.Editor.Server.DocumentSymbol(env.Ctx, &protocol.DocumentSymbolParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: env.Sandbox.Workdir.URI("foo.proto")},
+		})
+		require.NoError(t, err)
+
+		var decoded []protocol.DocumentSymbol
+		data, err := json.Marshal(symbols)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &decoded))
+
+		var names []string
+		for _, sym := range decoded {
+			names = append(names, sym.Name)
+		}
+		require.Contains(t, names, "Foo")
+		require.Contains(t, names, "Bar")
+	})
+}
+
+func TestFlatDocumentSymbols(t *testing.T) {
+	const src = `
+-- foo.proto --
+syntax = "proto3";
+
+package foo;
+
+message Outer {
+  message Inner {
+    string name = 1;
+  }
+  Inner inner = 1;
+}
+
+service FooService {
+  rpc Get(Outer) returns (Outer);
+}
+`
+	config := defaultEditorConfig()
+	config.CapabilitiesJSON = []byte(`{"textDocument":{"documentSymbol":{"hierarchicalDocumentSymbolSupport":false}}}`)
+	runner.Run(t, src, func(t *testing.T, env *integration.Env) {
+		env.OpenFile("foo.proto")
+		symbols, err := env.Editor.Server.DocumentSymbol(env.Ctx, &protocol.DocumentSymbolParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: env.Sandbox.Workdir.URI("foo.proto")},
+		})
+		require.NoError(t, err)
+
+		var decoded []protocol.SymbolInformation
+		data, err := json.Marshal(symbols)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &decoded))
+
+		containers := map[string]string{}
+		for _, sym := range decoded {
+			require.Equal(t, env.Sandbox.Workdir.URI("foo.proto"), sym.Location.URI)
+			containers[sym.Name] = sym.ContainerName
+		}
+		require.Equal(t, map[string]string{
+			"Outer":      "",
+			"Inner":      "Outer",
+			"name":       "Outer.Inner",
+			"inner":      "Outer",
+			"FooService": "",
+			"Get":        "FooService",
+		}, containers)
+	}, withEditorConfig(config))
+}